@@ -5,9 +5,11 @@ import (
 	"errors"
 	"fmt"
 	"github.com/golang/glog"
+	"github.com/open-horizon/anax/containermessage"
 	"github.com/open-horizon/anax/metering"
 	"github.com/open-horizon/anax/policy"
 	"net/http"
+	"time"
 )
 
 // Protocol message types
@@ -308,6 +310,13 @@ func DecideOnProposal(p ProtocolHandler,
 			// compatible with the producer's policy.
 		} else if err := policy.Are_Compatible(producerPolicy, termsAndConditions); err != nil {
 			replyErr = errors.New(fmt.Sprintf("Protocol %v decide on proposal received error, T and C policy is not compatible, rejecting proposal: %v", p.Name(), err))
+
+			// Agreements can only be made while the availability schedules in the policies are open.
+		} else if now := time.Now(); !mergedPolicy.Availability.IsOpenAt(now) || !termsAndConditions.Availability.IsOpenAt(now) {
+			replyErr = errors.New(fmt.Sprintf("Protocol %v decide on proposal received error, policy availability is closed, rejecting proposal: %v %v", p.Name(), mergedPolicy.Availability, termsAndConditions.Availability))
+			// A node that refuses privileged workloads rejects the proposal before the workload is deployed.
+		} else if err := checkPrivileged(mergedPolicy, termsAndConditions); err != nil {
+			replyErr = errors.New(fmt.Sprintf("Protocol %v decide on proposal received error, %v, rejecting proposal", p.Name(), err))
 		} else if err := p.PolicyManager().FinalAgreement(policies, proposal.AgreementId(), myOrg); err != nil {
 			replyErr = errors.New(fmt.Sprintf("Protocol %v decide on proposal received error, unable to record agreement state in PM: %v", p.Name(), err))
 		} else {
@@ -319,6 +328,26 @@ func DecideOnProposal(p ProtocolHandler,
 
 }
 
+// Returns an error when the producer policy refuses privileged workloads and a workload in the terms and conditions
+// asks for a privileged container.
+func checkPrivileged(producerPolicy *policy.Policy, termsAndConditions *policy.Policy) error {
+	if !producerPolicy.RefusePrivileged {
+		return nil
+	}
+	for _, wl := range termsAndConditions.Workloads {
+		if wl.Deployment == "" {
+			continue
+		}
+		dd := new(containermessage.DeploymentDescription)
+		if err := json.Unmarshal([]byte(wl.Deployment), dd); err != nil {
+			return errors.New(fmt.Sprintf("unable to demarshal deployment of workload %v, error: %v", wl.WorkloadURL, err))
+		} else if dd.RequestsPrivileged() {
+			return errors.New(fmt.Sprintf("node refuses privileged workloads and workload %v is privileged", wl.WorkloadURL))
+		}
+	}
+	return nil
+}
+
 // Send a reply to the proposal.
 func SendResponse(p ProtocolHandler,
 	proposal Proposal,
@@ -351,6 +380,25 @@ func SendResponse(p ProtocolHandler,
 
 }
 
+// Reject a proposal without deciding on it, when the node cannot take on any agreement. The proposal never reached
+// the policy manager, so there is no agreement count to cancel.
+func RejectProposal(p ProtocolHandler,
+	proposal Proposal,
+	myId string,
+	reason error,
+	messageTarget interface{},
+	sendMessage func(mt interface{}, pay []byte) error) error {
+
+	glog.Warningf(AAPlogString(p.Name(), fmt.Sprintf("rejecting proposal %v, %v", proposal.ShortString(), reason)))
+
+	reply := NewProposalReply(p.Name(), proposal.Version(), proposal.AgreementId(), myId)
+	if err := SendProtocolMessage(messageTarget, reply, sendMessage); err != nil {
+		return errors.New(fmt.Sprintf("Protocol %v error sending proposal rejection %v, %v", p.Name(), reply, err))
+	}
+	return nil
+
+}
+
 // Confirm a reply from a producer.
 func Confirm(p ProtocolHandler,
 	replyValid bool,
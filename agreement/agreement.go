@@ -4,7 +4,6 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
-	"github.com/boltdb/bolt"
 	"github.com/golang/glog"
 	"github.com/open-horizon/anax/abstractprotocol"
 	"github.com/open-horizon/anax/config"
@@ -16,7 +15,6 @@ import (
 	"github.com/open-horizon/anax/version"
 	"github.com/open-horizon/anax/worker"
 	"net/http"
-	"reflect"
 	"strconv"
 	"strings"
 	"time"
@@ -28,7 +26,7 @@ const HEARTBEAT = "HeartBeat"
 // must be safely-constructed!!
 type AgreementWorker struct {
 	worker.BaseWorker        // embedded field
-	db                       *bolt.DB
+	db                       persistence.Store
 	httpClient               *http.Client // a shared http client
 	userId                   string
 	deviceId                 string
@@ -41,7 +39,7 @@ type AgreementWorker struct {
 	producerPH               map[string]producer.ProducerProtocolHandler
 }
 
-func NewAgreementWorker(name string, cfg *config.HorizonConfig, db *bolt.DB, pm *policy.PolicyManager) *AgreementWorker {
+func NewAgreementWorker(name string, cfg *config.HorizonConfig, db persistence.Store, pm *policy.PolicyManager) *AgreementWorker {
 
 	id := ""
 	token := ""
@@ -610,8 +608,6 @@ func (w *AgreementWorker) patchNodeKey() error {
 
 func (w *AgreementWorker) advertiseAllPolicies(location string) error {
 
-	var pType, pValue, pCompare string
-
 	dev, err := persistence.FindExchangeDevice(w.db)
 	if err != nil {
 		return errors.New(fmt.Sprintf("AgreementWorker received error getting device name: %v", err))
@@ -651,32 +647,9 @@ func (w *AgreementWorker) advertiseAllPolicies(location string) error {
 				return errors.New(fmt.Sprintf("AgreementWorker received error calculating properties: %v", err))
 			} else {
 				for _, prop := range *props {
-					switch prop.Value.(type) {
-					case string:
-						pType = "string"
-						pValue = prop.Value.(string)
-						pCompare = "in"
-					case int:
-						pType = "int"
-						pValue = strconv.Itoa(prop.Value.(int))
-						pCompare = ">="
-					case bool:
-						pType = "boolean"
-						pValue = strconv.FormatBool(prop.Value.(bool))
-						pCompare = "="
-					case []string:
-						pType = "list"
-						pValue = exchange.ConvertToString(prop.Value.([]string))
-						pCompare = "in"
-					default:
-						return errors.New(fmt.Sprintf("AgreementWorker encountered unsupported property type: %v", reflect.TypeOf(prop.Value).String()))
-					}
-					// Now put the property together
-					newProp := &exchange.MSProp{
-						Name:     prop.Name,
-						Value:    pValue,
-						PropType: pType,
-						Op:       pCompare,
+					newProp, err := exchange.ConvertPropertyToExchangeFormat(&prop)
+					if err != nil {
+						return errors.New(fmt.Sprintf("AgreementWorker got error converting property %v to exchange format: %v", prop, err))
 					}
 					newMS.Properties = append(newMS.Properties, *newProp)
 				}
@@ -5,12 +5,14 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
-	"github.com/boltdb/bolt"
 	"github.com/golang/glog"
 	"github.com/open-horizon/anax/abstractprotocol"
+	"github.com/open-horizon/anax/basicprotocol"
 	"github.com/open-horizon/anax/config"
+	"github.com/open-horizon/anax/cutil"
 	"github.com/open-horizon/anax/events"
 	"github.com/open-horizon/anax/exchange"
+	"github.com/open-horizon/anax/persistence"
 	"github.com/open-horizon/anax/policy"
 	"github.com/open-horizon/anax/version"
 	"github.com/open-horizon/anax/worker"
@@ -26,6 +28,8 @@ const HEARTBEAT = "AgbotHeartBeat"
 const GOVERN_AGREEMENTS = "AgBotGovernAgreements"
 const GOVERN_ARCHIVED_AGREEMENTS = "AgBotGovernArchivedAgreements"
 const GOVERN_BC_NEEDS = "AgBotGovernBlockchain"
+const GOVERN_ROLLOUTS = "AgBotGovernRollouts"
+const PARTITIONS = "AgBotPartitions"
 const POLICY_WATCHER = "AgBotPolicyWatcher"
 const GENERATE_POLICY = "AgBotPolicyGenerator"
 
@@ -38,7 +42,8 @@ type DVState struct {
 // must be safely-constructed!!
 type AgreementBotWorker struct {
 	worker.BaseWorker // embedded field
-	db                *bolt.DB
+	db                persistence.Store
+	store             AgbotStore
 	httpClient        *http.Client // a shared HTTP client instance for this worker
 	agbotId           string
 	token             string
@@ -48,13 +53,16 @@ type AgreementBotWorker struct {
 	PatternManager    *PatternManager
 	NHManager         *NodeHealthManager
 	GovTiming         DVState
+	Partitions        *PartitionManager
+	Searches          *SearchScheduler
 }
 
-func NewAgreementBotWorker(name string, cfg *config.HorizonConfig, db *bolt.DB) *AgreementBotWorker {
+func NewAgreementBotWorker(name string, cfg *config.HorizonConfig, db persistence.Store) *AgreementBotWorker {
 
 	worker := &AgreementBotWorker{
 		BaseWorker:     worker.NewBaseWorker(name, cfg),
 		db:             db,
+		store:          NewBoltAgbotStore(db),
 		httpClient:     cfg.Collaborators.HTTPClientFactory.NewHTTPClient(nil),
 		agbotId:        cfg.AgreementBot.ExchangeId,
 		token:          cfg.AgreementBot.ExchangeToken,
@@ -63,6 +71,8 @@ func NewAgreementBotWorker(name string, cfg *config.HorizonConfig, db *bolt.DB)
 		PatternManager: NewPatternManager(),
 		NHManager:      NewNodeHealthManager(),
 		GovTiming:      DVState{},
+		Partitions:     NewPartitionManager(cfg.AgreementBot.ExchangeId),
+		Searches:       NewSearchScheduler(searchInterval(cfg), fullSearchInterval(cfg), searchPageSize(cfg)),
 	}
 
 	glog.Info("Starting AgreementBot worker")
@@ -145,6 +155,16 @@ func (w *AgreementBotWorker) NewEvent(incoming events.Message) {
 			}
 		}
 
+	case *events.AgbotAgreementEndedMessage:
+		if w.ready {
+			msg, _ := incoming.(*events.AgbotAgreementEndedMessage)
+			switch msg.Event().Id {
+			case events.AGBOT_AGREEMENT_ENDED:
+				aeCmd := NewAgreementEndedCommand(*msg)
+				w.Commands <- aeCmd
+			}
+		}
+
 	case *events.ABApiWorkloadUpgradeMessage:
 		if w.ready {
 			msg, _ := incoming.(*events.ABApiWorkloadUpgradeMessage)
@@ -244,6 +264,15 @@ func (w *AgreementBotWorker) Initialize() bool {
 		return false
 	}
 
+	// Split the nodes with the other agbots before making any agreements. The agreements with nodes that belong to
+	// another agbot now are handed off once the partitions have been stable for a while.
+	if w.Config.AgreementBot.PartitionAgbots {
+		w.updatePartitions()
+	}
+
+	// Learn whether the exchange can page through the node searches before searching for nodes.
+	w.checkSearchPaging()
+
 	// The agbot worker is now ready to handle incoming messages
 	w.ready = true
 
@@ -254,6 +283,7 @@ func (w *AgreementBotWorker) Initialize() bool {
 	w.DispatchSubworker(GOVERN_AGREEMENTS, w.GovernAgreements, int(w.BaseWorker.Manager.Config.AgreementBot.ProcessGovernanceIntervalS))
 	w.DispatchSubworker(GOVERN_ARCHIVED_AGREEMENTS, w.GovernArchivedAgreements, 1800)
 	w.DispatchSubworker(GOVERN_BC_NEEDS, w.GovernBlockchainNeeds, 60)
+	w.DispatchSubworker(GOVERN_ROLLOUTS, w.GovernRollouts, 30)
 	if w.Config.AgreementBot.CheckUpdatedPolicyS != 0 {
 		// Use custom subworker APIs for the policy watcher because it is stateful and already does its own time management.
 		ch := w.AddSubworker(POLICY_WATCHER)
@@ -261,6 +291,9 @@ func (w *AgreementBotWorker) Initialize() bool {
 
 		w.DispatchSubworker(GENERATE_POLICY, w.GeneratePolicyFromPatterns, int(w.Config.AgreementBot.CheckUpdatedPolicyS))
 	}
+	if w.Config.AgreementBot.PartitionAgbots {
+		w.DispatchSubworker(PARTITIONS, w.updatePartitions, w.partitionCheckInterval())
+	}
 
 	return true
 }
@@ -296,6 +329,9 @@ func (w *AgreementBotWorker) CommandHandler(command worker.Command) bool {
 			w.pm.UpdatePolicy(cmd.Msg.Org(), pol)
 			glog.V(5).Infof("AgreementBotWorker updated policy in PM.")
 
+			// Search for all the nodes of the changed policy again.
+			w.Searches.Reset(cmd.Msg.Org(), pol.Header.Name)
+
 			for _, agp := range pol.AgreementProtocols {
 				// Update the protocol handler map and make sure there are workers available if the policy has a new protocol in it.
 				if _, ok := w.consumerPH[agp.Name]; !ok {
@@ -317,6 +353,17 @@ func (w *AgreementBotWorker) CommandHandler(command worker.Command) bool {
 
 		}
 
+	case *AgreementEndedCommand:
+		cmd := command.(*AgreementEndedCommand)
+
+		// The node of the agreement is free again, but the searches for changed nodes dont find it because it kept
+		// heartbeating, so search for all the nodes of the policy next time.
+		w.Searches.AgreementEnded(cmd.Msg.Org, cmd.Msg.PolicyName)
+
+	case *SearchDoneCommand:
+		cmd := command.(*SearchDoneCommand)
+		w.makeAgreements(cmd.Org, &cmd.Policy, cmd.Candidates)
+
 	case *PolicyDeletedCommand:
 		cmd := command.(*PolicyDeletedCommand)
 
@@ -439,97 +486,174 @@ func (w *AgreementBotWorker) NoWorkHandler() {
 
 }
 
-// Search the exchange and make agreements with any device that is eligible based on the policies we have and
-// agreement protocols that we support.
+// Start a search pass for each policy that is due for one. Agreements are proposed once all the pages of a search are
+// read, when the main loop handles the SearchDoneCommand of the pass.
 func (w *AgreementBotWorker) findAndMakeAgreements() {
 
 	// Get a list of all the orgs we are serving
 	allOrgs := w.pm.GetAllPolicyOrgs()
+	searched := make(map[string]bool)
 
 	for _, org := range allOrgs {
 		// Get a copy of all policies in the policy manager so that we can safely iterate the list
 		policies := w.pm.GetAllAvailablePolicies(org)
 		for _, consumerPolicy := range policies {
+			searched[searchKey(org, consumerPolicy.Header.Name)] = true
+			if page, due := w.Searches.Next(org, consumerPolicy.Header.Name, time.Now().Unix()); due {
+				go w.searchPolicy(org, consumerPolicy, page)
+			}
+		}
+	}
 
-			if devices, err := w.searchExchange(&consumerPolicy, org); err != nil {
-				glog.Errorf("AgreementBotWorker received error searching for %v, error: %v", &consumerPolicy, err)
-			} else {
+	// Forget the searches of deleted policies.
+	w.Searches.Retain(searched)
+}
 
-				for _, dev := range *devices {
+// Read all the pages of a search pass of the policy, starting with the given page, and hand the compatible nodes of
+// the whole pass to the main loop. This function runs on its own goroutine so that a policy with a lot of nodes
+// doesnt hold up the main loop.
+func (w *AgreementBotWorker) searchPolicy(org string, consumerPolicy policy.Policy, page *SearchPage) {
+	for page != nil {
+		devices, err := w.searchExchange(&consumerPolicy, org, page)
+		if err != nil {
+			glog.Errorf("AgreementBotWorker received error searching for %v, error: %v", &consumerPolicy, err)
+			w.Searches.PageFailed(page, time.Now().Unix())
+			return
+		}
 
-					glog.V(3).Infof("AgreementBotWorker picked up %v", dev.ShortString())
-					glog.V(5).Infof("AgreementBotWorker picked up %v", dev)
+		ids, candidates := w.compatibleNodes(&consumerPolicy, devices)
+		var found []*placementCandidate
+		if page, found = w.Searches.PageDone(page, ids, candidates, time.Now().Unix()); page == nil && len(found) != 0 {
+			w.Commands <- NewSearchDoneCommand(org, consumerPolicy, found)
+		}
+	}
+}
 
-					// Check for agreements already in progress with this device
-					if found, err := w.alreadyMakingAgreementWith(&dev, &consumerPolicy); err != nil {
-						glog.Errorf("AgreementBotWorker received error trying to find pending agreements: %v", err)
-						continue
-					} else if found {
-						glog.V(5).Infof("AgreementBotWorker skipping device id %v, agreement attempt already in progress with %v", dev.Id, consumerPolicy.Header.Name)
-						continue
-					}
+// Return the ids of the devices found by a search, and the devices that the agbot can propose an agreement to.
+func (w *AgreementBotWorker) compatibleNodes(consumerPolicy *policy.Policy, devices *[]exchange.SearchResultDevice) ([]string, []*placementCandidate) {
 
-					// If the device is not ready to make agreements yet, then skip it.
-					if len(dev.PublicKey) == 0 || string(dev.PublicKey) == "" {
-						glog.V(5).Infof("AgreementBotWorker skipping device id %v, node is not ready to exchange messages", dev.Id)
-						continue
-					}
+	ids := make([]string, 0, len(*devices))
+	candidates := make([]*placementCandidate, 0, len(*devices))
+	for _, dev := range *devices {
+		ids = append(ids, dev.Id)
 
-					// The only reason for no microservices in the device search result is because the search was pattern based.
-					// In this case there will not be any policies from the producer side to work with. The agbot assumes that
-					// device side anax will not allow microservice registration that is incompatible with the pattern.
-
-					// If there are no microservices in the returned device then we cant do any of the
-					// producer side policy merge and compatibility checks until we get the node's policies from the
-					// exchange. It is preferable to NOT call the exchange on the main agbot thread. So, make an
-					// agreement protocol choice based solely on the consumer side policy. Once the new agreement
-					// attempt gets on a worker thread, then we can perform the policy checks and merges.
-					producerPolicy := policy.Policy_Factory("empty")
-					err := error(nil)
-					if len(dev.Microservices) != 0 {
-
-						// For every microservice required by the workload, deserialize the JSON policy blob into a policy object and
-						// then merge them all together.
-						if producerPolicy, err = w.MergeAllProducerPolicies(&dev); err != nil {
-							glog.Errorf("AgreementBotWorker unable to merge microservice policies, error: %v", err)
-							continue
-						} else if producerPolicy == nil {
-							glog.Errorf("AgreementBotWorker unable to create merged policy from producer %v", dev)
-							continue
-						}
+		glog.V(3).Infof("AgreementBotWorker picked up %v", dev.ShortString())
+		glog.V(5).Infof("AgreementBotWorker picked up %v", dev)
 
-						// Check to see if the device's merged policy is compatible with the consumer
-						if err := policy.Are_Compatible(producerPolicy, &consumerPolicy); err != nil {
-							glog.Errorf("AgreementBotWorker received error comparing %v and %v, error: %v", *producerPolicy, consumerPolicy, err)
-							continue
-						}
+		// Check for agreements already in progress with this device
+		if found, err := w.alreadyMakingAgreementWith(&dev, consumerPolicy); err != nil {
+			glog.Errorf("AgreementBotWorker received error trying to find pending agreements: %v", err)
+			continue
+		} else if found {
+			glog.V(5).Infof("AgreementBotWorker skipping device id %v, agreement attempt already in progress with %v", dev.Id, consumerPolicy.Header.Name)
+			continue
+		}
 
-					}
+		// If the device is not ready to make agreements yet, then skip it.
+		if len(dev.PublicKey) == 0 || string(dev.PublicKey) == "" {
+			glog.V(5).Infof("AgreementBotWorker skipping device id %v, node is not ready to exchange messages", dev.Id)
+			continue
+		}
 
-					// Select a worker pool based on the agreement protocol that will be used.
-					protocol := policy.Select_Protocol(producerPolicy, &consumerPolicy)
-					cmd := NewMakeAgreementCommand(*producerPolicy, consumerPolicy, org, dev)
-
-					bcType, bcName, bcOrg := producerPolicy.RequiresKnownBC(protocol)
-
-					if _, ok := w.consumerPH[protocol]; !ok {
-						glog.Errorf("AgreementBotWorker unable to find protocol handler for %v.", protocol)
-					} else if bcType != "" && !w.consumerPH[protocol].IsBlockchainWritable(bcType, bcName, bcOrg) {
-						// Get that blockchain running if it isn't up.
-						glog.V(5).Infof("AgreementBotWorker skipping device id %v, requires blockchain %v %v %v that isnt ready yet.", dev.Id, bcType, bcName, bcOrg)
-						w.BaseWorker.Manager.Messages <- events.NewNewBCContainerMessage(events.NEW_BC_CLIENT, bcType, bcName, bcOrg, w.Manager.Config.AgreementBot.ExchangeURL, w.agbotId, w.token)
-						continue
-					} else if !w.consumerPH[protocol].AcceptCommand(cmd) {
-						glog.Errorf("AgreementBotWorker protocol handler for %v not accepting new agreement commands.", protocol)
-					} else {
-						w.consumerPH[protocol].HandleMakeAgreement(cmd, w.consumerPH[protocol])
-						glog.V(5).Infof("AgreementBoWorker queued agreement attempt for policy %v and protocol %v", consumerPolicy.Header.Name, protocol)
-					}
+		// The only reason for no microservices in the device search result is because the search was pattern based.
+		// In this case there will not be any policies from the producer side to work with. The agbot assumes that
+		// device side anax will not allow microservice registration that is incompatible with the pattern.
+
+		// If there are no microservices in the returned device then we cant do any of the
+		// producer side policy merge and compatibility checks until we get the node's policies from the
+		// exchange. So, make an agreement protocol choice based solely on the consumer side policy. Once
+		// the new agreement attempt gets on a worker thread, then we can perform the policy checks and merges.
+		producerPolicy := policy.Policy_Factory("empty")
+		err := error(nil)
+		if len(dev.Microservices) != 0 {
+
+			// For every microservice required by the workload, deserialize the JSON policy blob into a policy object and
+			// then merge them all together.
+			if producerPolicy, err = w.MergeAllProducerPolicies(&dev); err != nil {
+				glog.Errorf("AgreementBotWorker unable to merge microservice policies, error: %v", err)
+				continue
+			} else if producerPolicy == nil {
+				glog.Errorf("AgreementBotWorker unable to create merged policy from producer %v", dev)
+				continue
+			}
 
-				}
+			// Check to see if the device's merged policy is compatible with the consumer
+			if err := policy.Are_Compatible(producerPolicy, consumerPolicy); err != nil {
+				glog.Errorf("AgreementBotWorker received error comparing %v and %v, error: %v", *producerPolicy, *consumerPolicy, err)
+				continue
+			}
 
+		}
+
+		// The HA partners and the properties of a node found by a pattern search are read from the node's policies
+		// in the exchange, the same policies that the agreement is made from, when the node has to be keyed to its
+		// partition, or ranked or spread by its properties.
+		nodePolicy := producerPolicy
+		if len(dev.Microservices) == 0 && (len(w.Partitions.Members()) > 1 || usesNodeProperties(consumerPolicy)) {
+			if nodePolicy, err = w.getNodePolicy(dev.Id); err != nil {
+				glog.Errorf("AgreementBotWorker unable to read the policies of device id %v, error: %v", dev.Id, err)
+				continue
 			}
 		}
+
+		// Leave the node to the agbot that owns it when the agbots split the nodes between them. The node is keyed the
+		// same way as its agreement.
+		if key := partitionKey(dev.Id, nodePolicy.HAGroup.Partners); !w.Partitions.Owns(key) {
+			glog.V(5).Infof("AgreementBotWorker skipping device id %v, node belongs to agbot %v", dev.Id, w.Partitions.Owner(key))
+			continue
+		}
+
+		// Dont propose an agreement while the node or this agbot is outside of its availability schedule. The device
+		// will be found again by a later search, when the schedule might be open.
+		if now := time.Now(); !producerPolicy.Availability.IsOpenAt(now) || !consumerPolicy.Availability.IsOpenAt(now) {
+			glog.V(5).Infof("AgreementBotWorker skipping device id %v, policy availability is closed, %v %v", dev.Id, producerPolicy.Availability, consumerPolicy.Availability)
+			continue
+		}
+
+		candidates = append(candidates, &placementCandidate{device: dev, producerPolicy: producerPolicy, nodePolicy: nodePolicy})
+	}
+
+	return ids, candidates
+}
+
+// Propose agreements to the compatible nodes of a whole search. The nodes that best match the placement preferences of
+// the policy go first, and only as many nodes as the policy's max agreements allows get a proposal.
+func (w *AgreementBotWorker) makeAgreements(org string, consumerPolicy *policy.Policy, candidates []*placementCandidate) {
+
+	// The policy might have been deleted while the search was in progress.
+	if w.pm.GetPolicy(org, consumerPolicy.Header.Name) == nil {
+		glog.V(5).Infof("AgreementBotWorker skipping search results of policy %v, the policy no longer exists", consumerPolicy.Header.Name)
+		return
+	}
+
+	candidates = w.rankCandidates(consumerPolicy, candidates)
+	candidates = w.spreadCandidates(consumerPolicy, candidates)
+	candidates = w.limitCandidates(consumerPolicy, candidates)
+
+	for _, candidate := range candidates {
+		dev := candidate.device
+		producerPolicy := candidate.producerPolicy
+
+		// Select a worker pool based on the agreement protocol that will be used.
+		protocol := policy.Select_Protocol(producerPolicy, consumerPolicy)
+		cmd := NewMakeAgreementCommand(*producerPolicy, *consumerPolicy, org, dev)
+
+		bcType, bcName, bcOrg := producerPolicy.RequiresKnownBC(protocol)
+
+		if _, ok := w.consumerPH[protocol]; !ok {
+			glog.Errorf("AgreementBotWorker unable to find protocol handler for %v.", protocol)
+		} else if bcType != "" && !w.consumerPH[protocol].IsBlockchainWritable(bcType, bcName, bcOrg) {
+			// Get that blockchain running if it isn't up.
+			glog.V(5).Infof("AgreementBotWorker skipping device id %v, requires blockchain %v %v %v that isnt ready yet.", dev.Id, bcType, bcName, bcOrg)
+			w.BaseWorker.Manager.Messages <- events.NewNewBCContainerMessage(events.NEW_BC_CLIENT, bcType, bcName, bcOrg, w.Manager.Config.AgreementBot.ExchangeURL, w.agbotId, w.token)
+			continue
+		} else if !w.consumerPH[protocol].AcceptCommand(cmd) {
+			glog.Errorf("AgreementBotWorker protocol handler for %v not accepting new agreement commands.", protocol)
+		} else {
+			w.consumerPH[protocol].HandleMakeAgreement(cmd, w.consumerPH[protocol])
+			glog.V(5).Infof("AgreementBoWorker queued agreement attempt for policy %v and protocol %v", consumerPolicy.Header.Name, protocol)
+		}
+
 	}
 }
 
@@ -561,10 +685,28 @@ func (w *AgreementBotWorker) alreadyMakingAgreementWith(dev *exchange.SearchResu
 // The list of microservices in a device object that comes back in a search only includes the microservices that we
 // searched for.
 func (w *AgreementBotWorker) MergeAllProducerPolicies(dev *exchange.SearchResultDevice) (*policy.Policy, error) {
+	return w.mergeProducerPolicies(dev.Microservices)
+}
+
+// Merge the policies of all the microservices that a node registered in the exchange. A node without microservices has
+// an empty policy.
+func (w *AgreementBotWorker) getNodePolicy(deviceId string) (*policy.Policy, error) {
+	if dev, err := GetDevice(w.httpClient, deviceId, w.Config.AgreementBot.ExchangeURL, w.agbotId, w.token); err != nil {
+		return nil, err
+	} else if producerPolicy, err := w.mergeProducerPolicies(dev.RegisteredMicroservices); err != nil {
+		return nil, err
+	} else if producerPolicy == nil {
+		return policy.Policy_Factory("empty"), nil
+	} else {
+		return producerPolicy, nil
+	}
+}
+
+func (w *AgreementBotWorker) mergeProducerPolicies(microservices []exchange.Microservice) (*policy.Policy, error) {
 
 	var producerPolicy *policy.Policy
 
-	for _, msDef := range dev.Microservices {
+	for _, msDef := range microservices {
 		tempPolicy := new(policy.Policy)
 		if len(msDef.Policy) == 0 {
 			return nil, errors.New(fmt.Sprintf("empty policy blob for %v, skipping this device.", msDef.Url))
@@ -720,8 +862,8 @@ func DeleteMessage(msgId int, agbotId, agbotToken, exchangeURL string, httpClien
 // There are 2 ways to search the exchange; (a) by pattern and workload URL, or (b) by list of microservices.
 // If the agbot is working with a policy file that was generated from a pattern, then it will do searches by
 // pattern. If the agbot is working with a manually created policy file, then it will do searches by list of
-// microservices.
-func (w *AgreementBotWorker) searchExchange(pol *policy.Policy, searchOrg string) (*[]exchange.SearchResultDevice, error) {
+// microservices. Each search reads one page of the nodes, the page is chosen by the search scheduler.
+func (w *AgreementBotWorker) searchExchange(pol *policy.Policy, searchOrg string, page *SearchPage) (*[]exchange.SearchResultDevice, error) {
 
 	// If it is a pattern based policy, search by worload URL and pattern.
 	if pol.PatternId != "" {
@@ -730,6 +872,11 @@ func (w *AgreementBotWorker) searchExchange(pol *policy.Policy, searchOrg string
 		ser := exchange.CreateSearchPatternRequest()
 		ser.SecondsStale = w.Config.AgreementBot.ActiveDeviceTimeoutS
 		ser.WorkloadURL = pol.Workloads[0].WorkloadURL
+		if page.NumEntries != 0 {
+			ser.StartAfterId = page.StartAfter
+			ser.NumEntries = page.NumEntries
+			ser.ChangedSince = searchTime(page.ChangedSince)
+		}
 
 		// Invoke the exchange
 		var resp interface{}
@@ -748,7 +895,7 @@ func (w *AgreementBotWorker) searchExchange(pol *policy.Policy, searchOrg string
 				time.Sleep(10 * time.Second)
 				continue
 			} else {
-				glog.V(3).Infof("AgreementBotWorker found %v devices in exchange.", len(resp.(*exchange.SearchExchangePatternResponse).Devices))
+				glog.V(3).Infof("AgreementBotWorker found %v devices in exchange for page %v.", len(resp.(*exchange.SearchExchangePatternResponse).Devices), page)
 				dev := resp.(*exchange.SearchExchangePatternResponse).Devices
 				return &dev, nil
 			}
@@ -796,6 +943,11 @@ func (w *AgreementBotWorker) searchExchange(pol *policy.Policy, searchOrg string
 		ser := exchange.CreateSearchMSRequest()
 		ser.SecondsStale = w.Config.AgreementBot.ActiveDeviceTimeoutS
 		ser.DesiredMicroservices = desiredMS
+		if page.NumEntries != 0 {
+			ser.StartAfterId = page.StartAfter
+			ser.NumEntries = page.NumEntries
+			ser.ChangedSince = searchTime(page.ChangedSince)
+		}
 
 		// Invoke the exchange
 		var resp interface{}
@@ -814,7 +966,7 @@ func (w *AgreementBotWorker) searchExchange(pol *policy.Policy, searchOrg string
 				time.Sleep(10 * time.Second)
 				continue
 			} else {
-				glog.V(3).Infof("AgreementBotWorker found %v devices in exchange.", len(resp.(*exchange.SearchExchangeMSResponse).Devices))
+				glog.V(3).Infof("AgreementBotWorker found %v devices in exchange for page %v.", len(resp.(*exchange.SearchExchangeMSResponse).Devices), page)
 				dev := resp.(*exchange.SearchExchangeMSResponse).Devices
 				return &dev, nil
 			}
@@ -822,6 +974,14 @@ func (w *AgreementBotWorker) searchExchange(pol *policy.Policy, searchOrg string
 	}
 }
 
+// The changed since time of a search request in the exchange's time format, empty for a search of all the nodes.
+func searchTime(changedSince int64) string {
+	if changedSince == 0 {
+		return ""
+	}
+	return time.Unix(changedSince, 0).UTC().Format(cutil.ExchangeTimeFormat)
+}
+
 func (w *AgreementBotWorker) makeNewMSSearchElement(specRef string, org string, version string, arch string, pol *policy.Policy) (*exchange.Microservice, error) {
 	newMS := new(exchange.Microservice)
 	newMS.Url = specRef
@@ -1093,7 +1253,7 @@ func (w *AgreementBotWorker) GeneratePolicyFromPatterns() int {
 func (w *AgreementBotWorker) internalGeneratePolicyFromPatterns() error {
 
 	// Get the configured org/pattern pairs for this agbot.
-	pats, err := w.getAgbotPatterns()
+	pats, err := w.getAgbotPatterns(w.agbotId)
 	if err != nil {
 		return errors.New(fmt.Sprintf("unable to retrieve agbot pattern metadata, error %v", err))
 	}
@@ -1120,11 +1280,11 @@ func (w *AgreementBotWorker) internalGeneratePolicyFromPatterns() error {
 
 }
 
-func (w *AgreementBotWorker) getAgbotPatterns() (map[string]exchange.ServedPattern, error) {
+func (w *AgreementBotWorker) getAgbotPatterns(agbotId string) (map[string]exchange.ServedPattern, error) {
 
 	var resp interface{}
 	resp = new(exchange.GetAgbotsPatternsResponse)
-	targetURL := w.Config.AgreementBot.ExchangeURL + "orgs/" + exchange.GetOrg(w.agbotId) + "/agbots/" + exchange.GetId(w.agbotId) + "/patterns"
+	targetURL := w.Config.AgreementBot.ExchangeURL + "orgs/" + exchange.GetOrg(agbotId) + "/agbots/" + exchange.GetId(agbotId) + "/patterns"
 	for {
 		if err, tpErr := exchange.InvokeExchange(w.httpClient, "GET", targetURL, w.agbotId, w.token, nil, &resp); err != nil {
 			glog.Errorf(AWlogString(err.Error()))
@@ -1135,7 +1295,7 @@ func (w *AgreementBotWorker) getAgbotPatterns() (map[string]exchange.ServedPatte
 			continue
 		} else {
 			pats := resp.(*exchange.GetAgbotsPatternsResponse).Patterns
-			glog.V(5).Infof(AWlogString(fmt.Sprintf("retrieved agbot patterns from exchange %v", pats)))
+			glog.V(5).Infof(AWlogString(fmt.Sprintf("retrieved agbot %v patterns from exchange %v", agbotId, pats)))
 			return pats, nil
 		}
 	}
@@ -1149,15 +1309,270 @@ func (w *AgreementBotWorker) heartBeat() int {
 	if err := version.VerifyExchangeVersion(w.Config.Collaborators.HTTPClientFactory, w.Manager.Config.AgreementBot.ExchangeURL); err != nil {
 		glog.Errorf(AWlogString(fmt.Sprintf("Error verifiying exchange version. error: %v", err)))
 	}
+	w.checkSearchPaging()
 
 	targetURL := w.Manager.Config.AgreementBot.ExchangeURL + "orgs/" + exchange.GetOrg(w.agbotId) + "/agbots/" + exchange.GetId(w.agbotId) + "/heartbeat"
 	exchange.Heartbeat(w.Config.Collaborators.HTTPClientFactory.NewHTTPClient(nil), targetURL, w.agbotId, w.token)
 	return 0
 }
 
+// Page through the node searches only when the exchange supports it. An older exchange ignores the paging parameters
+// of a search and returns the first nodes every time, so the agbot searches for all the nodes at once instead.
+func (w *AgreementBotWorker) checkSearchPaging() {
+	if paging, err := version.ExchangeVersionAtLeast(w.Config.Collaborators.HTTPClientFactory, w.Config.AgreementBot.ExchangeURL, version.SEARCH_PAGING_EXCHANGE_VERSION); err != nil {
+		glog.Errorf(AWlogString(fmt.Sprintf("unable to check whether the exchange can page through searches, error: %v", err)))
+	} else if w.Searches.SetPaging(paging) {
+		glog.V(3).Infof(AWlogString(fmt.Sprintf("exchange search paging is now %v", paging)))
+	}
+}
+
+// Learn which agbots share the nodes with this agbot and hand off the agreements with the nodes that now belong to
+// another agbot, once the agbots sharing the nodes have been the same for a while. This function is called by the
+// partitions subworker.
+func (w *AgreementBotWorker) updatePartitions() int {
+
+	if members, err := w.getPartitionMembers(); err != nil {
+		glog.Errorf(AWlogString(fmt.Sprintf("unable to refresh the agbot partitions, error %v", err)))
+	} else if w.Partitions.SetMembers(members) {
+		glog.V(3).Infof(AWlogString(fmt.Sprintf("agbot partitions changed, %v, handing off agreements when unchanged for %v seconds", w.Partitions, w.partitionStableTime())))
+
+		// The nodes that this agbot now owns are only found by a search for all the nodes, so start all the searches over.
+		w.Searches.Retain(map[string]bool{})
+	}
+
+	// The nodes handed off by the other agbots are free at about the same time, start the searches over for them too.
+	if w.Partitions.HandOffDue(time.Now(), time.Duration(w.partitionStableTime())*time.Second) {
+		w.handOffAgreements()
+		w.adoptDepartedAgreements()
+		w.Searches.Retain(map[string]bool{})
+	}
+	return 0
+}
+
+// The members of the partitions are the agbots that are heartbeating to the exchange and serve the same patterns as
+// this agbot. The agbots are listed from this agbot's org and the orgs of the patterns it serves, agbots in any other
+// org are not seen.
+func (w *AgreementBotWorker) getPartitionMembers() ([]string, error) {
+
+	myPatterns, err := w.getAgbotPatterns(w.agbotId)
+	if err != nil {
+		return nil, err
+	}
+
+	agbots, err := w.getServingAgbots(myPatterns)
+	if err != nil {
+		return nil, err
+	}
+
+	members := make([]string, 0)
+	for _, id := range activeAgbots(w.agbotId, agbots, time.Now().Unix(), w.partitionMemberTimeout()) {
+		if id == w.agbotId {
+			members = append(members, id)
+		} else if pats, err := w.getAgbotPatterns(id); err != nil {
+			return nil, err
+		} else if servedPatternsKey(pats) == servedPatternsKey(myPatterns) {
+			members = append(members, id)
+		}
+	}
+	return members, nil
+}
+
+// Return the agbots of this agbot's org and of the orgs of the given patterns. An org other than this agbot's org
+// that this agbot cannot list is left out.
+func (w *AgreementBotWorker) getServingAgbots(pats map[string]exchange.ServedPattern) (map[string]exchange.Agbot, error) {
+
+	orgs := []string{exchange.GetOrg(w.agbotId)}
+	for _, pat := range pats {
+		if !contains(orgs, pat.Org) {
+			orgs = append(orgs, pat.Org)
+		}
+	}
+
+	agbots := make(map[string]exchange.Agbot)
+	for _, org := range orgs {
+		var resp interface{}
+		resp = new(exchange.GetAgbotsResponse)
+		targetURL := w.Config.AgreementBot.ExchangeURL + "orgs/" + org + "/agbots"
+		for {
+			if err, tpErr := exchange.InvokeExchange(w.httpClient, "GET", targetURL, w.agbotId, w.token, nil, &resp); err != nil && org == exchange.GetOrg(w.agbotId) {
+				glog.Errorf(AWlogString(err.Error()))
+				return nil, err
+			} else if err != nil {
+				glog.Warningf(AWlogString(fmt.Sprintf("unable to list the agbots in org %v, leaving them out of the partitions, error %v", org, err)))
+				break
+			} else if tpErr != nil {
+				glog.Warningf(AWlogString(tpErr.Error()))
+				time.Sleep(10 * time.Second)
+				continue
+			} else {
+				for id, ag := range resp.(*exchange.GetAgbotsResponse).Agbots {
+					agbots[id] = ag
+				}
+				break
+			}
+		}
+	}
+	return agbots, nil
+}
+
+// Hand off the agreements with nodes that belong to another agbot. The nodes move the agreements to the other agbot,
+// so the workloads keep running. Agreements that are not finalized yet are left to finish or time out, the other agbot
+// makes a new agreement with the node after that. Only the basic protocol can hand off agreements, agreements of the
+// other protocols stay with the agbot that made them.
+func (w *AgreementBotWorker) handOffAgreements() {
+
+	bph, ok := w.consumerPH[basicprotocol.PROTOCOL_NAME].(*BasicProtocolHandler)
+	if !ok {
+		return
+	}
+
+	if agreements, err := FindAgreements(w.db, []AFilter{UnarchivedAFilter()}, basicprotocol.PROTOCOL_NAME); err != nil {
+		glog.Errorf(AWlogString(fmt.Sprintf("unable to read agreements from database for protocol %v, error: %v", basicprotocol.PROTOCOL_NAME, err)))
+	} else {
+		for _, ag := range agreements {
+			if ag.AgreementTimedout != 0 || ag.AgreementFinalizedTime == 0 {
+				continue
+			} else if owner := w.Partitions.Owner(partitionKey(ag.DeviceId, ag.HAPartners)); owner != w.agbotId {
+				glog.V(3).Infof(AWlogString(fmt.Sprintf("handing off agreement %v with %v to agbot %v", ag.CurrentAgreementId, ag.DeviceId, owner)))
+				bph.HandOffAgreement(ag.CurrentAgreementId, ag.DeviceId, owner)
+			}
+		}
+	}
+}
+
+// Take over the agreements of the agbots that stopped heartbeating, with the nodes that this agbot now owns. The
+// agreements of an agbot are found in the exchange and their nodes through the node health of the agreement's
+// pattern, so agreements made without a pattern are left to be cancelled by their nodes.
+func (w *AgreementBotWorker) adoptDepartedAgreements() {
+
+	bph, ok := w.consumerPH[basicprotocol.PROTOCOL_NAME].(*BasicProtocolHandler)
+	if !ok {
+		return
+	}
+
+	myPatterns, err := w.getAgbotPatterns(w.agbotId)
+	if err != nil {
+		glog.Errorf(AWlogString(fmt.Sprintf("unable to find departed agbots, error %v", err)))
+		return
+	}
+	agbots, err := w.getServingAgbots(myPatterns)
+	if err != nil {
+		glog.Errorf(AWlogString(fmt.Sprintf("unable to find departed agbots, error %v", err)))
+		return
+	}
+
+	active := activeAgbots(w.agbotId, agbots, time.Now().Unix(), w.partitionMemberTimeout())
+	nodeHealth := make(map[string]*exchange.NodeHealthStatus)
+	for id := range agbots {
+		if contains(active, id) {
+			continue
+		} else if pats, err := w.getAgbotPatterns(id); err != nil {
+			glog.Errorf(AWlogString(fmt.Sprintf("unable to read the patterns of agbot %v, error %v", id, err)))
+			continue
+		} else if servedPatternsKey(pats) != servedPatternsKey(myPatterns) {
+			continue
+		}
+
+		var resp interface{}
+		resp = new(exchange.AllAgbotAgreementsResponse)
+		targetURL := w.Config.AgreementBot.ExchangeURL + "orgs/" + exchange.GetOrg(id) + "/agbots/" + exchange.GetId(id) + "/agreements"
+		if err, tpErr := exchange.InvokeExchange(w.httpClient, "GET", targetURL, w.agbotId, w.token, nil, &resp); err != nil || tpErr != nil {
+			glog.Errorf(AWlogString(fmt.Sprintf("unable to read the agreements of departed agbot %v, error %v, transport error %v", id, err, tpErr)))
+			continue
+		}
+
+		for agreementId, exAg := range resp.(*exchange.AllAgbotAgreementsResponse).Agreements {
+			if exAg.Workload.Pattern == "" || exAg.State != "Finalized Agreement" {
+				continue
+			}
+
+			pattern := exAg.Workload.Org + "/" + exAg.Workload.Pattern
+			if _, ok := nodeHealth[pattern]; !ok {
+				if status, err := exchange.GetNodeHealthStatus(w.Config.Collaborators.HTTPClientFactory, pattern, exAg.Workload.Org, "", w.Config.AgreementBot.ExchangeURL, w.agbotId, w.token); err != nil {
+					glog.Errorf(AWlogString(fmt.Sprintf("unable to read the nodes of pattern %v, error %v", pattern, err)))
+				} else {
+					nodeHealth[pattern] = status
+				}
+			}
+
+			deviceId := ""
+			if status := nodeHealth[pattern]; status != nil {
+				for nodeId, node := range status.Nodes {
+					if _, there := node.Agreements[agreementId]; there {
+						deviceId = nodeId
+						break
+					}
+				}
+			}
+
+			if deviceId == "" {
+				glog.V(5).Infof(AWlogString(fmt.Sprintf("no node found for agreement %v of departed agbot %v", agreementId, id)))
+			} else if ag, err := FindSingleAgreementByAgreementId(w.db, agreementId, basicprotocol.PROTOCOL_NAME, []AFilter{UnarchivedAFilter()}); err != nil {
+				glog.Errorf(AWlogString(fmt.Sprintf("unable to read agreement %v from database, error: %v", agreementId, err)))
+			} else if ag != nil {
+				continue
+			} else if nodePolicy, err := w.getNodePolicy(deviceId); err != nil {
+				glog.Errorf(AWlogString(fmt.Sprintf("unable to read the policies of node %v, error %v", deviceId, err)))
+			} else if w.Partitions.Owns(partitionKey(deviceId, nodePolicy.HAGroup.Partners)) {
+				glog.V(3).Infof(AWlogString(fmt.Sprintf("taking over agreement %v with %v from departed agbot %v", agreementId, deviceId, id)))
+				bph.HandOffAgreement(agreementId, deviceId, w.agbotId)
+			}
+		}
+	}
+}
+
+// An agbot that has missed 3 heartbeats no longer shares the nodes, unless the config says otherwise.
+func (w *AgreementBotWorker) partitionMemberTimeout() int {
+	if w.Config.AgreementBot.PartitionMemberTimeoutS != 0 {
+		return w.Config.AgreementBot.PartitionMemberTimeoutS
+	}
+	return 3 * w.partitionCheckInterval()
+}
+
+// The agreements are handed off when the partitions have been unchanged for twice the time that an agbot can go without
+// heartbeating, so that an agbot that misses a few heartbeats does not get its nodes handed off and back again.
+func (w *AgreementBotWorker) partitionStableTime() int {
+	if w.Config.AgreementBot.PartitionStableS != 0 {
+		return w.Config.AgreementBot.PartitionStableS
+	}
+	return 2 * w.partitionMemberTimeout()
+}
+
+// The partitions are checked as often as the agbot heartbeats.
+func (w *AgreementBotWorker) partitionCheckInterval() int {
+	if w.Config.AgreementBot.ExchangeHeartbeat != 0 {
+		return w.Config.AgreementBot.ExchangeHeartbeat
+	}
+	return 60
+}
+
 // ==========================================================================================================
 // Utility functions
 
 var AWlogString = func(v interface{}) string {
 	return fmt.Sprintf("AgreementBotWorker %v", v)
 }
+
+// The number of seconds between searches of the exchange for the nodes of a policy.
+func searchInterval(cfg *config.HorizonConfig) int {
+	if cfg.AgreementBot.SearchIntervalS != 0 {
+		return cfg.AgreementBot.SearchIntervalS
+	}
+	return 10
+}
+
+// The number of seconds between searches for all the nodes of a policy.
+func fullSearchInterval(cfg *config.HorizonConfig) int {
+	if cfg.AgreementBot.FullSearchIntervalS != 0 {
+		return cfg.AgreementBot.FullSearchIntervalS
+	}
+	return 300
+}
+
+// The number of nodes in a page of search results.
+func searchPageSize(cfg *config.HorizonConfig) int {
+	if cfg.AgreementBot.SearchPageSize != 0 {
+		return cfg.AgreementBot.SearchPageSize
+	}
+	return 100
+}
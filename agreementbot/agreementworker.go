@@ -4,12 +4,13 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
-	"github.com/boltdb/bolt"
 	"github.com/golang/glog"
 	"github.com/open-horizon/anax/abstractprotocol"
 	"github.com/open-horizon/anax/config"
 	"github.com/open-horizon/anax/cutil"
+	"github.com/open-horizon/anax/events"
 	"github.com/open-horizon/anax/exchange"
+	"github.com/open-horizon/anax/persistence"
 	"github.com/open-horizon/anax/policy"
 	"math/rand"
 	"net/http"
@@ -123,11 +124,12 @@ type AgreementWorker interface {
 
 type BaseAgreementWorker struct {
 	pm         *policy.PolicyManager
-	db         *bolt.DB
+	db         persistence.Store
 	config     *config.HorizonConfig
 	alm        *AgreementLockManager
 	workerID   string
 	httpClient *http.Client
+	messages   chan events.Message // outgoing events for the other workers
 }
 
 func (b *BaseAgreementWorker) AgreementLockManager() *AgreementLockManager {
@@ -320,7 +322,7 @@ func (b *BaseAgreementWorker) InitiateNewAgreement(cph ConsumerProtocolHandler,
 	}
 
 	// Create pending agreement in database
-	if err := AgreementAttempt(b.db, agreementIdString, wi.Org, wi.Device.Id, wi.ConsumerPolicy.Header.Name, bcType, bcName, bcOrg, cph.Name(), wi.ConsumerPolicy.PatternId, wi.ConsumerPolicy.NodeH); err != nil {
+	if err := AgreementAttempt(b.db, agreementIdString, wi.Org, wi.Device.Id, wi.ConsumerPolicy.Header.Name, bcType, bcName, bcOrg, cph.Name(), wi.ConsumerPolicy.PatternId, wi.ConsumerPolicy.NodeH, wi.ProducerPolicy.Properties); err != nil {
 		glog.Errorf(BAWlogstring(workerId, fmt.Sprintf("error persisting agreement attempt: %v", err)))
 
 		// Create message target for protocol message
@@ -644,6 +646,11 @@ func (b *BaseAgreementWorker) CancelAgreement(cph ConsumerProtocolHandler, agree
 			glog.Errorf(BAWlogstring(workerId, fmt.Sprintf("error archiving terminated agreement: %v, error: %v", ag.CurrentAgreementId, err)))
 		}
 
+		// Let the agbot know that the node can be found by a search for the policy again.
+		if b.messages != nil {
+			b.messages <- events.NewAgbotAgreementEndedMessage(events.AGBOT_AGREEMENT_ENDED, ag.CurrentAgreementId, ag.Org, ag.PolicyName)
+		}
+
 	}
 }
 
@@ -3,31 +3,34 @@ package agreementbot
 import (
 	"encoding/json"
 	"fmt"
-	"github.com/boltdb/bolt"
 	"github.com/golang/glog"
 	"github.com/gorilla/mux"
 	"github.com/open-horizon/anax/apicommon"
 	"github.com/open-horizon/anax/config"
+	"github.com/open-horizon/anax/eventlog"
 	"github.com/open-horizon/anax/events"
 	"github.com/open-horizon/anax/exchange"
+	"github.com/open-horizon/anax/metrics"
+	"github.com/open-horizon/anax/persistence"
 	"github.com/open-horizon/anax/policy"
 	"github.com/open-horizon/anax/worker"
 	"io/ioutil"
 	"net/http"
 	"sort"
+	"strconv"
 	"sync"
 )
 
 type API struct {
 	worker.Manager // embedded field
 	name           string
-	db             *bolt.DB
+	db             persistence.Store
 	pm             *policy.PolicyManager
 	bcState        map[string]map[string]apicommon.BlockchainState
 	bcStateLock    sync.Mutex
 }
 
-func NewAPIListener(name string, config *config.HorizonConfig, db *bolt.DB) *API {
+func NewAPIListener(name string, config *config.HorizonConfig, db persistence.Store) *API {
 	messages := make(chan events.Message)
 
 	listener := &API{
@@ -114,8 +117,14 @@ func (a *API) listen(apiListen string) {
 
 		router.HandleFunc("/agreement", a.agreement).Methods("GET", "OPTIONS")
 		router.HandleFunc("/agreement/{id}", a.agreement).Methods("GET", "DELETE", "OPTIONS")
+		router.HandleFunc("/policy/explain", a.policyExplain).Methods("GET", "OPTIONS")
 		router.HandleFunc("/policy/{name}/upgrade", a.policyUpgrade).Methods("POST", "OPTIONS")
 		router.HandleFunc("/workloadusage", a.workloadusage).Methods("GET", "OPTIONS")
+		router.HandleFunc("/rollout", a.rollout).Methods("GET", "POST", "OPTIONS")
+		router.HandleFunc("/rollout/{id}", a.rollout).Methods("GET", "OPTIONS")
+		router.HandleFunc("/rollout/{id}/{action}", a.rolloutAction).Methods("POST", "OPTIONS")
+		router.HandleFunc("/eventlog", a.eventlog).Methods("GET", "OPTIONS")
+		router.HandleFunc("/metrics", a.metrics).Methods("GET", "OPTIONS")
 		router.HandleFunc("/status", a.status).Methods("GET", "OPTIONS")
 		router.HandleFunc("/node", a.node).Methods("GET", "OPTIONS")
 
@@ -317,6 +326,49 @@ func (a *API) policyUpgrade(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+func (a *API) policyExplain(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case "GET":
+		nodeId := r.URL.Query().Get("node")
+		policyName := r.URL.Query().Get("policy")
+
+		if nodeId == "" {
+			writeInputErr(w, http.StatusBadRequest, &APIUserInputError{Input: "node", Error: "node id must be specified"})
+			return
+		} else if exchange.GetOrg(nodeId) == "" || exchange.GetId(nodeId) == "" {
+			writeInputErr(w, http.StatusBadRequest, &APIUserInputError{Input: "node", Error: fmt.Sprintf("node id %v must be of the form org/id", nodeId)})
+			return
+		}
+		glog.V(3).Infof(APIlogString(fmt.Sprintf("handling GET of policy explain for node %v", nodeId)))
+
+		workloadResolver := func(wURL string, wOrg string, wVersion string, wArch string) (*policy.APISpecList, error) {
+			asl, _, err := exchange.WorkloadResolver(a.Config.Collaborators.HTTPClientFactory, wURL, wOrg, wVersion, wArch, a.Config.AgreementBot.ExchangeURL, a.Config.AgreementBot.ExchangeId, a.Config.AgreementBot.ExchangeToken)
+			if err != nil {
+				glog.Errorf(APIlogString(fmt.Sprintf("unable to resolve workload, error %v", err)))
+			}
+			return asl, err
+		}
+
+		if pm, err := policy.Initialize(a.Config.AgreementBot.PolicyPath, a.Config.ArchSynonyms, workloadResolver, false); err != nil {
+			glog.Error(APIlogString(fmt.Sprintf("error initializing policy manager, error: %v", err)))
+			w.WriteHeader(http.StatusInternalServerError)
+		} else if dev, err := GetDevice(a.Config.Collaborators.HTTPClientFactory.NewHTTPClient(nil), nodeId, a.Config.AgreementBot.ExchangeURL, a.Config.AgreementBot.ExchangeId, a.Config.AgreementBot.ExchangeToken); err != nil {
+			writeInputErr(w, http.StatusBadRequest, &APIUserInputError{Input: "node", Error: fmt.Sprintf("unable to retrieve node %v from the exchange, error: %v", nodeId, err)})
+		} else if explanation, err := ExplainNode(nodeId, dev, pm, policyName, a.Config.AgreementBot.NoDataIntervalS); err != nil {
+			glog.Error(APIlogString(fmt.Sprintf("error explaining policies for node %v, error: %v", nodeId, err)))
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+		} else {
+			writeResponse(w, explanation, http.StatusOK)
+		}
+
+	case "OPTIONS":
+		w.Header().Set("Allow", "GET, OPTIONS")
+		w.WriteHeader(http.StatusOK)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
 func (a *API) workloadusage(w http.ResponseWriter, r *http.Request) {
 
 	switch r.Method {
@@ -341,6 +393,198 @@ func (a *API) workloadusage(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+func (a *API) rollout(w http.ResponseWriter, r *http.Request) {
+
+	switch r.Method {
+	case "GET":
+		pathVars := mux.Vars(r)
+		if id := pathVars["id"]; id != "" {
+			if rid, err := strconv.ParseUint(id, 10, 64); err != nil {
+				writeInputErr(w, http.StatusBadRequest, &APIUserInputError{Input: "id", Error: fmt.Sprintf("rollout id %v is not a number", id)})
+			} else if rollout, err := FindSingleRollout(a.db, rid); err != nil {
+				glog.Error(APIlogString(fmt.Sprintf("error finding rollout %v, error: %v", rid, err)))
+				http.Error(w, "Internal server error", http.StatusInternalServerError)
+			} else if rollout == nil {
+				writeInputErr(w, http.StatusNotFound, &APIUserInputError{Input: "id", Error: fmt.Sprintf("rollout %v not found", rid)})
+			} else {
+				writeResponse(w, rollout, http.StatusOK)
+			}
+			return
+		}
+
+		if rollouts, err := FindRollouts(a.db, []RolloutFilter{}); err != nil {
+			glog.Error(APIlogString(fmt.Sprintf("error finding all rollouts, error: %v", err)))
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+		} else {
+			sort.Sort(RolloutsById(rollouts))
+			writeResponse(w, rollouts, http.StatusOK)
+		}
+
+	case "POST":
+		// Demarshal the input body and verify it.
+		var request RolloutRequest
+		body, _ := ioutil.ReadAll(r.Body)
+		if err := json.Unmarshal(body, &request); err != nil {
+			writeInputErr(w, http.StatusBadRequest, &APIUserInputError{Input: "body", Error: fmt.Sprintf("user submitted data couldn't be deserialized to struct: %v. Error: %v", string(body), err)})
+			return
+		} else if ok, msg := request.IsValid(); !ok {
+			writeInputErr(w, http.StatusBadRequest, &APIUserInputError{Input: "body", Error: msg})
+			return
+		}
+		glog.V(3).Infof(APIlogString(fmt.Sprintf("handling POST of rollout for policy %v", request.Policy)))
+
+		workloadResolver := func(wURL string, wOrg string, wVersion string, wArch string) (*policy.APISpecList, error) {
+			asl, _, err := exchange.WorkloadResolver(a.Config.Collaborators.HTTPClientFactory, wURL, wOrg, wVersion, wArch, a.Config.AgreementBot.ExchangeURL, a.Config.AgreementBot.ExchangeId, a.Config.AgreementBot.ExchangeToken)
+			if err != nil {
+				glog.Errorf(APIlogString(fmt.Sprintf("unable to resolve workload, error %v", err)))
+			}
+			return asl, err
+		}
+
+		// The policy name can be either the name of the policy within the header of the policy file or the name of the file itself.
+		var pol *policy.Policy
+		policyName := request.Policy
+		if pm, err := policy.Initialize(a.Config.AgreementBot.PolicyPath, a.Config.ArchSynonyms, workloadResolver, false); err != nil {
+			glog.Error(APIlogString(fmt.Sprintf("error initializing policy manager, error: %v", err)))
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		} else if pol = pm.GetPolicy(request.Org, policyName); pol == nil {
+			if name := pm.WatcherContent.GetPolicyName(request.Org, policyName); name != "" {
+				policyName = name
+				pol = pm.GetPolicy(request.Org, policyName)
+			}
+		}
+
+		if pol == nil {
+			writeInputErr(w, http.StatusBadRequest, &APIUserInputError{Input: "policy", Error: fmt.Sprintf("no policies with the name %v", request.Policy)})
+			return
+		}
+
+		// Find the workload the devices are upgraded to, either by its priority or its version.
+		var target *policy.Workload
+		for ix, wl := range pol.Workloads {
+			if (request.Priority != 0 && wl.Priority.PriorityValue == request.Priority) || (request.Priority == 0 && wl.Version == request.Version) {
+				target = &pol.Workloads[ix]
+				break
+			}
+		}
+		if target == nil {
+			writeInputErr(w, http.StatusBadRequest, &APIUserInputError{Input: "body", Error: fmt.Sprintf("policy %v has no workload with priority %v or version %v", policyName, request.Priority, request.Version)})
+			return
+		} else if target.Priority.PriorityValue == 0 {
+			writeInputErr(w, http.StatusBadRequest, &APIUserInputError{Input: "body", Error: fmt.Sprintf("policy %v does not use workload priorities", policyName)})
+			return
+		}
+
+		// The devices in the rollout are the ones using the workload rollback feature with this policy.
+		if wlusages, err := FindWorkloadUsages(a.db, []WUFilter{PWUFilter(policyName)}); err != nil {
+			glog.Error(APIlogString(fmt.Sprintf("error finding workload usages for policy %v, error: %v", policyName, err)))
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+		} else if agreements, err := policyAgreements(NewBoltAgbotStore(a.db), policyName); err != nil {
+			glog.Error(APIlogString(fmt.Sprintf("error finding agreements for policy %v, error: %v", policyName, err)))
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+		} else if rollout, err := NewRollout(a.db, request.Org, policyName, target.Priority.PriorityValue, request.Plan, wlusages, rolloutGroups(pol.Spread, wlusages, agreements)); err != nil {
+			writeInputErr(w, http.StatusBadRequest, &APIUserInputError{Input: "body", Error: err.Error()})
+		} else {
+			writeResponse(w, rollout, http.StatusCreated)
+		}
+
+	case "OPTIONS":
+		w.Header().Set("Allow", "GET, POST, OPTIONS")
+		w.WriteHeader(http.StatusOK)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func (a *API) rolloutAction(w http.ResponseWriter, r *http.Request) {
+
+	switch r.Method {
+	case "POST":
+		pathVars := mux.Vars(r)
+		id := pathVars["id"]
+		action := pathVars["action"]
+
+		rid, err := strconv.ParseUint(id, 10, 64)
+		if err != nil {
+			writeInputErr(w, http.StatusBadRequest, &APIUserInputError{Input: "id", Error: fmt.Sprintf("rollout id %v is not a number", id)})
+			return
+		} else if rollout, err := FindSingleRollout(a.db, rid); err != nil {
+			glog.Error(APIlogString(fmt.Sprintf("error finding rollout %v, error: %v", rid, err)))
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		} else if rollout == nil {
+			writeInputErr(w, http.StatusNotFound, &APIUserInputError{Input: "id", Error: fmt.Sprintf("rollout %v not found", rid)})
+			return
+		}
+		glog.V(3).Infof(APIlogString(fmt.Sprintf("handling POST of %v for rollout %v", action, rid)))
+
+		// The rollout governance picks up the new state the next time it runs.
+		var actionErr error
+		if rollout, err := RolloutUpdate(a.db, rid, func(current *Rollout) bool {
+			actionErr = applyRolloutAction(current, action)
+			return actionErr == nil
+		}); err != nil {
+			glog.Error(APIlogString(fmt.Sprintf("error updating rollout %v, error: %v", rid, err)))
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+		} else if actionErr != nil {
+			writeInputErr(w, http.StatusBadRequest, &APIUserInputError{Input: "action", Error: actionErr.Error()})
+		} else {
+			writeResponse(w, rollout, http.StatusOK)
+		}
+
+	case "OPTIONS":
+		w.Header().Set("Allow", "POST, OPTIONS")
+		w.WriteHeader(http.StatusOK)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func (a *API) eventlog(w http.ResponseWriter, r *http.Request) {
+
+	switch r.Method {
+	case "GET":
+		q := r.URL.Query()
+		if filters, input, err := eventlog.QueryFilters(q.Get("event_id"), q.Get("agreement_id"), q.Get("since"), q.Get("until")); err != nil {
+			writeInputErr(w, http.StatusBadRequest, &APIUserInputError{Input: input, Error: err.Error()})
+		} else if records, err := eventlog.FindEventRecords(a.db, filters); err != nil {
+			glog.Error(APIlogString(fmt.Sprintf("error reading event log, error: %v", err)))
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+		} else {
+			writeResponse(w, records, http.StatusOK)
+		}
+
+	case "OPTIONS":
+		w.Header().Set("Allow", "GET, OPTIONS")
+		w.WriteHeader(http.StatusOK)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func (a *API) metrics(w http.ResponseWriter, r *http.Request) {
+
+	switch r.Method {
+	case "GET":
+		if err := UpdateAgreementMetrics(a.db); err != nil {
+			glog.Error(APIlogString(fmt.Sprintf("error updating agreement metrics, error: %v", err)))
+		}
+
+		w.Header().Set("Content-Type", metrics.CONTENT_TYPE)
+		w.WriteHeader(http.StatusOK)
+		if err := metrics.AgbotRegistry.Write(w); err != nil {
+			glog.Error(APIlogString(err))
+		}
+
+	case "OPTIONS":
+		w.Header().Set("Allow", "GET, OPTIONS")
+		w.WriteHeader(http.StatusOK)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
 func (a *API) status(w http.ResponseWriter, r *http.Request) {
 	switch r.Method {
 	case "GET":
@@ -481,6 +725,21 @@ func (s WorkloadUsagesByDeviceId) Less(i, j int) bool {
 	return s[i].DeviceId < s[j].DeviceId
 }
 
+// Helper functions for sorting rollouts
+type RolloutsById []Rollout
+
+func (s RolloutsById) Len() int {
+	return len(s)
+}
+
+func (s RolloutsById) Swap(i, j int) {
+	s[i], s[j] = s[j], s[i]
+}
+
+func (s RolloutsById) Less(i, j int) bool {
+	return s[i].Id < s[j].Id
+}
+
 // Log string prefix api
 var APIlogString = func(v interface{}) string {
 	return fmt.Sprintf("AgreementBotWorker API %v", v)
@@ -499,6 +758,23 @@ func (b *UpgradeDevice) IsValid() (bool, string) {
 	return true, ""
 }
 
+type RolloutRequest struct {
+	Org      string      `json:"org"`
+	Policy   string      `json:"policy"`
+	Priority int         `json:"priority"` // the priority of the workload to upgrade to
+	Version  string      `json:"version"`  // the version of the workload to upgrade to, when the priority is not given
+	Plan     RolloutPlan `json:"plan"`
+}
+
+func (b *RolloutRequest) IsValid() (bool, string) {
+	if b.Policy == "" {
+		return false, "must specify policy"
+	} else if b.Priority == 0 && b.Version == "" {
+		return false, "must specify either priority or version"
+	}
+	return b.Plan.IsValid()
+}
+
 // Utility functions used by all the http handlers for each API path.
 func serializeResponse(w http.ResponseWriter, payload interface{}) ([]byte, bool) {
 	glog.V(6).Infof(APIlogString(fmt.Sprintf("response payload before serialization (%T): %v", payload, payload)))
@@ -2,15 +2,16 @@ package agreementbot
 
 import (
 	"fmt"
-	"github.com/boltdb/bolt"
 	"github.com/golang/glog"
 	"github.com/open-horizon/anax/basicprotocol"
 	"github.com/open-horizon/anax/config"
 	"github.com/open-horizon/anax/exchange"
+	"github.com/open-horizon/anax/persistence"
 	"github.com/open-horizon/anax/policy"
 	"github.com/satori/go.uuid"
 	"math/rand"
 	"runtime"
+	"strings"
 )
 
 type BasicAgreementWorker struct {
@@ -18,7 +19,7 @@ type BasicAgreementWorker struct {
 	protocolHandler *BasicProtocolHandler
 }
 
-func NewBasicAgreementWorker(c *BasicProtocolHandler, cfg *config.HorizonConfig, db *bolt.DB, pm *policy.PolicyManager, alm *AgreementLockManager) *BasicAgreementWorker {
+func NewBasicAgreementWorker(c *BasicProtocolHandler, cfg *config.HorizonConfig, db persistence.Store, pm *policy.PolicyManager, alm *AgreementLockManager) *BasicAgreementWorker {
 
 	p := &BasicAgreementWorker{
 		BaseAgreementWorker: &BaseAgreementWorker{
@@ -28,6 +29,7 @@ func NewBasicAgreementWorker(c *BasicProtocolHandler, cfg *config.HorizonConfig,
 			alm:        alm,
 			workerID:   uuid.NewV4().String(),
 			httpClient: cfg.Collaborators.HTTPClientFactory.NewHTTPClient(nil),
+			messages:   c.messages,
 		},
 		protocolHandler: c,
 	}
@@ -65,6 +67,54 @@ func (b BAgreementVerification) String() string {
 		b.workType, b.Verify, b.From, b.SenderId, pkey, b.MessageId)
 }
 
+const AGREEMENT_HANDOFF = "AGREEMENT_HANDOFF"
+
+type BAgreementHandoff struct {
+	workType    string
+	AgreementId string
+	DeviceId    string
+	NewConsumer string // exchange Id of the agbot taking over the agreement
+}
+
+func (b BAgreementHandoff) Type() string {
+	return b.workType
+}
+
+func (b BAgreementHandoff) String() string {
+	return fmt.Sprintf("WorkType: %v, "+
+		"AgreementId: %v, "+
+		"DeviceId: %v, "+
+		"NewConsumer: %v",
+		b.workType, b.AgreementId, b.DeviceId, b.NewConsumer)
+}
+
+const AGREEMENT_ADOPTION = "AGREEMENT_ADOPTION"
+
+type BAgreementAdoption struct {
+	workType     string
+	Reply        basicprotocol.BAgreementHandoffReply
+	SenderId     string // exchange Id of sender
+	SenderPubKey []byte
+	MessageId    int
+}
+
+func (b BAgreementAdoption) Type() string {
+	return b.workType
+}
+
+func (b BAgreementAdoption) String() string {
+	pkey := "not set"
+	if len(b.SenderPubKey) != 0 {
+		pkey = "set"
+	}
+	return fmt.Sprintf("WorkType: %v, "+
+		"Reply: %v, "+
+		"SenderId: %v, "+
+		"SenderPubKey: %v, "+
+		"MessageId: %v",
+		b.workType, b.Reply.ShortString(), b.SenderId, pkey, b.MessageId)
+}
+
 // This function receives an event to "make a new agreement" from the Process function, and then synchronously calls a function
 // to actually work through the agreement protocol.
 func (a *BasicAgreementWorker) start(work chan AgreementWork, random *rand.Rand) {
@@ -140,6 +190,21 @@ func (a *BasicAgreementWorker) start(work chan AgreementWork, random *rand.Rand)
 				}
 			}
 
+		} else if workItem.Type() == AGREEMENT_HANDOFF {
+			wi := workItem.(BAgreementHandoff)
+			a.HandOffAgreement(&wi)
+
+		} else if workItem.Type() == AGREEMENT_ADOPTION {
+			wi := workItem.(BAgreementAdoption)
+			a.AdoptAgreement(&wi)
+
+			// Get rid of the original agreement handoff reply message.
+			if wi.MessageId != 0 {
+				if err := a.protocolHandler.DeleteMessage(wi.MessageId); err != nil {
+					glog.Errorf(bwlogstring(a.workerID, fmt.Sprintf("error deleting message %v from exchange", wi.MessageId)))
+				}
+			}
+
 		} else {
 			glog.Errorf(bwlogstring(a.workerID, fmt.Sprintf("received unknown work request: %v", workItem)))
 		}
@@ -150,6 +215,149 @@ func (a *BasicAgreementWorker) start(work chan AgreementWork, random *rand.Rand)
 	}
 }
 
+// Ask the node to move an agreement to the agbot that now owns the node. The agbot that has the agreement stops
+// governing it once the node has been asked, without cancelling it, so the workload keeps running. An agbot can also
+// ask for the agreement of an agbot that stopped heartbeating, this agbot has no record of such an agreement.
+func (a *BasicAgreementWorker) HandOffAgreement(wi *BAgreementHandoff) {
+
+	lock := a.alm.getAgreementLock(wi.AgreementId)
+	lock.Lock()
+	defer lock.Unlock()
+
+	ag, err := FindSingleAgreementByAgreementId(a.db, wi.AgreementId, a.protocolHandler.Name(), []AFilter{UnarchivedAFilter()})
+	if err != nil {
+		glog.Errorf(bwlogstring(a.workerID, fmt.Sprintf("error querying agreement %v, error: %v", wi.AgreementId, err)))
+		return
+	} else if ag == nil && wi.NewConsumer != a.protocolHandler.ExchangeId() {
+		glog.V(3).Infof(bwlogstring(a.workerID, fmt.Sprintf("nothing to hand off for agreement %v, no database record.", wi.AgreementId)))
+		return
+	} else if ag != nil && (ag.AgreementTimedout != 0 || ag.AgreementFinalizedTime == 0) {
+		glog.V(3).Infof(bwlogstring(a.workerID, fmt.Sprintf("not handing off agreement %v, it is terminating or not finalized.", wi.AgreementId)))
+		return
+	}
+
+	if whisperTo, pubkeyTo, err := a.protocolHandler.GetDeviceMessageEndpoint(wi.DeviceId, a.workerID); err != nil {
+		glog.Errorf(bwlogstring(a.workerID, fmt.Sprintf("error obtaining message target for handoff message: %v", err)))
+		return
+	} else if mt, err := exchange.CreateMessageTarget(wi.DeviceId, nil, pubkeyTo, whisperTo); err != nil {
+		glog.Errorf(bwlogstring(a.workerID, fmt.Sprintf("error creating message target: %v", err)))
+		return
+	} else if err := a.protocolHandler.agreementPH.SendAgreementHandoff(wi.AgreementId, wi.NewConsumer, mt, a.protocolHandler.GetSendMessage()); err != nil {
+		glog.Errorf(bwlogstring(a.workerID, fmt.Sprintf("error trying to send agreement handoff for %v to %v, error: %v", wi.AgreementId, wi.DeviceId, err)))
+		return
+	}
+
+	glog.V(3).Infof(bwlogstring(a.workerID, fmt.Sprintf("asked %v to hand off agreement %v to agbot %v", wi.DeviceId, wi.AgreementId, wi.NewConsumer)))
+	if ag == nil {
+		return
+	}
+
+	// Stop counting the agreement against the policy, the new agbot counts it once it takes over the agreement.
+	if pol, err := policy.DemarshalPolicy(ag.Policy); err != nil {
+		glog.Errorf(bwlogstring(a.workerID, fmt.Sprintf("error demarshalling policy from agreement %v, error: %v", ag.CurrentAgreementId, err)))
+	} else if existingPol := a.pm.GetPolicy(ag.Org, pol.Header.Name); existingPol == nil {
+		glog.Warningf(bwlogstring(a.workerID, fmt.Sprintf("agreement %v has a policy %v that doesn't exist anymore", ag.CurrentAgreementId, pol.Header.Name)))
+	} else if err := a.pm.CancelAgreement([]policy.Policy{*existingPol}, ag.CurrentAgreementId, ag.Org); err != nil {
+		glog.Warningf(bwlogstring(a.workerID, fmt.Sprintf("error removing agreement %v from the agreement count, error: %v", ag.CurrentAgreementId, err)))
+	}
+
+	// The new agbot records the agreement in the exchange and keeps its own workload usage.
+	if err := DeleteConsumerAgreement(a.httpClient, a.config.AgreementBot.ExchangeURL, a.protocolHandler.ExchangeId(), a.protocolHandler.ExchangeToken(), ag.CurrentAgreementId); err != nil {
+		glog.Errorf(bwlogstring(a.workerID, fmt.Sprintf("error deleting agreement %v in exchange: %v", ag.CurrentAgreementId, err)))
+	}
+	if err := DeleteWorkloadUsage(a.db, ag.DeviceId, ag.PolicyName); err != nil {
+		glog.Warningf(bwlogstring(a.workerID, fmt.Sprintf("error deleting workload usage for %v using policy %v, error: %v", ag.DeviceId, ag.PolicyName, err)))
+	}
+
+	reason := a.protocolHandler.GetTerminationCode(TERM_REASON_PARTITION_HANDOFF)
+	if _, err := ArchiveAgreement(a.db, ag.CurrentAgreementId, a.protocolHandler.Name(), reason, a.protocolHandler.GetTerminationReason(reason)); err != nil {
+		glog.Errorf(bwlogstring(a.workerID, fmt.Sprintf("error archiving handed off agreement: %v, error: %v", ag.CurrentAgreementId, err)))
+	}
+}
+
+// Take over an agreement that a node handed off to this agbot. The agreement is recorded the same as a finalized agreement
+// made by this agbot, as long as this agbot serves the policy that the agreement was made from. An agreement that is not
+// taken over is cancelled by the node, when this agbot tells the node that it does not know the agreement.
+func (a *BasicAgreementWorker) AdoptAgreement(wi *BAgreementAdoption) {
+
+	agreementId := wi.Reply.AgreementId()
+	lock := a.alm.getAgreementLock(agreementId)
+	lock.Lock()
+	defer lock.Unlock()
+
+	proposal, err := a.protocolHandler.agreementPH.DemarshalProposal(wi.Reply.Proposal)
+	if err != nil {
+		glog.Errorf(bwlogstring(a.workerID, fmt.Sprintf("error demarshalling proposal of handed off agreement %v, error: %v", agreementId, err)))
+		return
+	} else if proposal.AgreementId() != agreementId {
+		glog.Errorf(bwlogstring(a.workerID, fmt.Sprintf("handed off agreement %v has the proposal of agreement %v", agreementId, proposal.AgreementId())))
+		return
+	}
+
+	tcPolicy, err := policy.DemarshalPolicy(proposal.TsAndCs())
+	if err != nil {
+		glog.Errorf(bwlogstring(a.workerID, fmt.Sprintf("error demarshalling TsandCs policy of handed off agreement %v, error: %v", agreementId, err)))
+		return
+	}
+
+	org, consumerPolicy := a.findAdoptedPolicy(tcPolicy)
+	if consumerPolicy == nil {
+		glog.Warningf(bwlogstring(a.workerID, fmt.Sprintf("not taking over agreement %v from %v, this agbot does not serve the policy in %v", agreementId, wi.Reply.FormerConsumer, tcPolicy.Header.Name)))
+		return
+	}
+
+	if ag, err := FindSingleAgreementByAgreementId(a.db, agreementId, a.protocolHandler.Name(), []AFilter{UnarchivedAFilter()}); err != nil {
+		glog.Errorf(bwlogstring(a.workerID, fmt.Sprintf("error querying agreement %v, error: %v", agreementId, err)))
+		return
+	} else if ag != nil && ag.AgreementTimedout == 0 {
+		glog.V(3).Infof(bwlogstring(a.workerID, fmt.Sprintf("agreement %v is already governed by this agbot", agreementId)))
+		return
+	}
+
+	// The copy of the consumer policy in the agreement has the API specs that the workload was chosen for.
+	consumerPolicy.APISpecs = tcPolicy.APISpecs
+
+	if err := a.pm.AttemptingAgreement([]policy.Policy{*consumerPolicy}, agreementId, org); err != nil {
+		glog.Errorf(bwlogstring(a.workerID, fmt.Sprintf("cannot update agreement count for %v, error: %v", agreementId, err)))
+		return
+	} else if ag, err := AgreementAdopted(a.db, agreementId, org, wi.SenderId, consumerPolicy, wi.Reply.Proposal, tcPolicy, wi.Reply.ProposalSig, a.protocolHandler.Name(), proposal.Version(), a.config.AgreementBot.ProcessGovernanceIntervalS); err != nil {
+		glog.Errorf(bwlogstring(a.workerID, fmt.Sprintf("error persisting handed off agreement %v, error: %v", agreementId, err)))
+		if err := a.pm.CancelAgreement([]policy.Policy{*consumerPolicy}, agreementId, org); err != nil {
+			glog.Errorf(bwlogstring(a.workerID, fmt.Sprintf("error removing agreement %v from the agreement count, error: %v", agreementId, err)))
+		}
+		return
+	} else if err := a.pm.FinalAgreement([]policy.Policy{*consumerPolicy}, agreementId, org); err != nil {
+		glog.Errorf(bwlogstring(a.workerID, fmt.Sprintf("cannot update agreement count for %v, error: %v", agreementId, err)))
+	} else if err := a.protocolHandler.RecordConsumerAgreementState(agreementId, consumerPolicy, ag.Org, "Finalized Agreement", a.workerID); err != nil {
+		glog.Errorf(bwlogstring(a.workerID, fmt.Sprintf("error setting agreement %v finalized state in exchange: %v", agreementId, err)))
+	}
+
+	// Keep track of the workload the node is running, the same as for an agreement made by this agbot.
+	if len(tcPolicy.Workloads) != 0 && !tcPolicy.Workloads[0].HasEmptyPriority() {
+		wl := tcPolicy.Workloads[0]
+		if wlUsage, err := UpdateWUAgreementId(a.db, wi.SenderId, consumerPolicy.Header.Name, agreementId); err == nil && wlUsage != nil {
+			glog.V(5).Infof(bwlogstring(a.workerID, fmt.Sprintf("updated workload usage for %v with agreement %v", wi.SenderId, agreementId)))
+		} else if err := NewWorkloadUsage(a.db, wi.SenderId, tcPolicy.HAGroup.Partners, "", consumerPolicy.Header.Name, wl.Priority.PriorityValue, wl.Priority.RetryDurationS, wl.Priority.VerifiedDurationS, false, agreementId); err != nil {
+			glog.Errorf(bwlogstring(a.workerID, fmt.Sprintf("error creating workload usage for %v with policy %v, error: %v", wi.SenderId, consumerPolicy.Header.Name, err)))
+		}
+	}
+
+	glog.V(3).Infof(bwlogstring(a.workerID, fmt.Sprintf("took over agreement %v with %v from agbot %v", agreementId, wi.SenderId, wi.Reply.FormerConsumer)))
+}
+
+// Find the policy that the terms and conditions of an agreement were made from. The name of the terms and conditions
+// ends with the name of the consumer policy, see policy.Create_Terms_And_Conditions.
+func (a *BasicAgreementWorker) findAdoptedPolicy(tcPolicy *policy.Policy) (string, *policy.Policy) {
+	for _, org := range a.pm.GetAllPolicyOrgs() {
+		for _, pol := range a.pm.GetAllPolicies(org) {
+			if pol.PatternId == tcPolicy.PatternId && strings.HasSuffix(tcPolicy.Header.Name, " merged with "+pol.Header.Name) {
+				return org, &pol
+			}
+		}
+	}
+	return "", nil
+}
+
 var bwlogstring = func(workerID string, v interface{}) string {
 	return fmt.Sprintf("BasicAgreementWorker (%v): %v", workerID, v)
 }
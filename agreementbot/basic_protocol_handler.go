@@ -3,7 +3,6 @@ package agreementbot
 import (
 	"errors"
 	"fmt"
-	"github.com/boltdb/bolt"
 	"github.com/golang/glog"
 	"github.com/open-horizon/anax/abstractprotocol"
 	"github.com/open-horizon/anax/basicprotocol"
@@ -11,6 +10,7 @@ import (
 	"github.com/open-horizon/anax/events"
 	"github.com/open-horizon/anax/exchange"
 	"github.com/open-horizon/anax/metering"
+	"github.com/open-horizon/anax/persistence"
 	"github.com/open-horizon/anax/policy"
 	"github.com/open-horizon/anax/worker"
 	"math/rand"
@@ -23,7 +23,7 @@ type BasicProtocolHandler struct {
 	Work        chan AgreementWork // outgoing commands for the workers
 }
 
-func NewBasicProtocolHandler(name string, cfg *config.HorizonConfig, db *bolt.DB, pm *policy.PolicyManager, messages chan events.Message) *BasicProtocolHandler {
+func NewBasicProtocolHandler(name string, cfg *config.HorizonConfig, db persistence.Store, pm *policy.PolicyManager, messages chan events.Message) *BasicProtocolHandler {
 	if name == basicprotocol.PROTOCOL_NAME {
 		return &BasicProtocolHandler{
 			BaseConsumerProtocolHandler: &BaseConsumerProtocolHandler{
@@ -97,6 +97,16 @@ func (c *BasicProtocolHandler) AcceptCommand(cmd worker.Command) bool {
 	return false
 }
 
+// Queue the handoff of an agreement to the given agbot.
+func (c *BasicProtocolHandler) HandOffAgreement(agreementId string, deviceId string, newConsumer string) {
+	c.WorkQueue() <- BAgreementHandoff{
+		workType:    AGREEMENT_HANDOFF,
+		AgreementId: agreementId,
+		DeviceId:    deviceId,
+		NewConsumer: newConsumer,
+	}
+}
+
 func (c *BasicProtocolHandler) PersistAgreement(wi *InitiateAgreement, proposal abstractprotocol.Proposal, workerID string) error {
 
 	return c.BaseConsumerProtocolHandler.PersistBaseAgreement(wi, proposal, workerID, "", "")
@@ -154,6 +164,8 @@ func (c *BasicProtocolHandler) GetTerminationCode(reason string) uint {
 		return basicprotocol.AB_CANCEL_NODE_HEARTBEAT
 	case TERM_REASON_AG_MISSING:
 		return basicprotocol.AB_CANCEL_AG_MISSING
+	case TERM_REASON_PARTITION_HANDOFF:
+		return basicprotocol.AB_CANCEL_PARTITION_HANDOFF
 	default:
 		return 999
 	}
@@ -205,6 +217,17 @@ func (b *BasicProtocolHandler) HandleExtensionMessage(cmd *NewProtocolMessageCom
 		b.WorkQueue() <- agreementWork
 		glog.V(5).Infof(BsCPHlogString(fmt.Sprintf("queued agreement verify message")))
 
+	} else if reply, perr := b.agreementPH.ValidateAgreementHandoffReply(string(cmd.Message)); perr == nil {
+		agreementWork := BAgreementAdoption{
+			workType:     AGREEMENT_ADOPTION,
+			Reply:        *reply,
+			SenderId:     cmd.From,
+			SenderPubKey: cmd.PubKey,
+			MessageId:    cmd.MessageId,
+		}
+		b.WorkQueue() <- agreementWork
+		glog.V(5).Infof(BsCPHlogString(fmt.Sprintf("queued agreement handoff reply message")))
+
 	} else {
 		glog.V(5).Infof(BsCPHlogString(fmt.Sprintf("ignoring  message: %v because it is an unknown type", string(cmd.Message))))
 		return errors.New(BsCPHlogString(fmt.Sprintf("unknown protocol msg %s", cmd.Message)))
@@ -56,6 +56,40 @@ func NewPolicyDeletedCommand(msg events.PolicyDeletedMessage) *PolicyDeletedComm
 	}
 }
 
+// ==============================================================================================================
+type AgreementEndedCommand struct {
+	Msg events.AgbotAgreementEndedMessage
+}
+
+func (a AgreementEndedCommand) ShortString() string {
+	return fmt.Sprintf("%v", a)
+}
+
+func NewAgreementEndedCommand(msg events.AgbotAgreementEndedMessage) *AgreementEndedCommand {
+	return &AgreementEndedCommand{
+		Msg: msg,
+	}
+}
+
+// ==============================================================================================================
+type SearchDoneCommand struct {
+	Org        string
+	Policy     policy.Policy
+	Candidates []*placementCandidate
+}
+
+func (s SearchDoneCommand) ShortString() string {
+	return fmt.Sprintf("Org: %v, Policy: %v, Candidates: %v", s.Org, s.Policy.Header.Name, len(s.Candidates))
+}
+
+func NewSearchDoneCommand(org string, pol policy.Policy, candidates []*placementCandidate) *SearchDoneCommand {
+	return &SearchDoneCommand{
+		Org:        org,
+		Policy:     pol,
+		Candidates: candidates,
+	}
+}
+
 // ==============================================================================================================
 type NewProtocolMessageCommand struct {
 	Message   []byte
@@ -4,20 +4,20 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
-	"github.com/boltdb/bolt"
 	"github.com/golang/glog"
 	"github.com/open-horizon/anax/abstractprotocol"
 	"github.com/open-horizon/anax/config"
 	"github.com/open-horizon/anax/events"
 	"github.com/open-horizon/anax/exchange"
 	"github.com/open-horizon/anax/metering"
+	"github.com/open-horizon/anax/persistence"
 	"github.com/open-horizon/anax/policy"
 	"github.com/open-horizon/anax/worker"
 	"net/http"
 	"time"
 )
 
-func CreateConsumerPH(name string, cfg *config.HorizonConfig, db *bolt.DB, pm *policy.PolicyManager, msgq chan events.Message) ConsumerProtocolHandler {
+func CreateConsumerPH(name string, cfg *config.HorizonConfig, db persistence.Store, pm *policy.PolicyManager, msgq chan events.Message) ConsumerProtocolHandler {
 	if handler := NewCSProtocolHandler(name, cfg, db, pm, msgq); handler != nil {
 		return handler
 	} else if handler := NewBasicProtocolHandler(name, cfg, db, pm, msgq); handler != nil {
@@ -69,7 +69,7 @@ type ConsumerProtocolHandler interface {
 type BaseConsumerProtocolHandler struct {
 	name             string
 	pm               *policy.PolicyManager
-	db               *bolt.DB
+	db               persistence.Store
 	config           *config.HorizonConfig
 	httpClient       *http.Client // shared HTTP client instance
 	agbotId          string
@@ -528,6 +528,7 @@ const TERM_REASON_CANCEL_FORCED_UPGRADE = "ForceUpgrade"
 const TERM_REASON_CANCEL_BC_WRITE_FAILED = "WriteFailed"
 const TERM_REASON_NODE_HEARTBEAT = "NodeHeartbeat"
 const TERM_REASON_AG_MISSING = "AgreementMissing"
+const TERM_REASON_PARTITION_HANDOFF = "PartitionHandoff"
 
 var BCPHlogstring = func(p string, v interface{}) string {
 	return fmt.Sprintf("Base Consumer Protocol Handler (%v) %v", p, v)
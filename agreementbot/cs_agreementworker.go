@@ -2,11 +2,11 @@ package agreementbot
 
 import (
 	"fmt"
-	"github.com/boltdb/bolt"
 	"github.com/golang/glog"
 	"github.com/open-horizon/anax/citizenscientist"
 	"github.com/open-horizon/anax/config"
 	"github.com/open-horizon/anax/exchange"
+	"github.com/open-horizon/anax/persistence"
 	"github.com/open-horizon/anax/policy"
 	"github.com/satori/go.uuid"
 	"math/rand"
@@ -18,7 +18,7 @@ type CSAgreementWorker struct {
 	protocolHandler *CSProtocolHandler
 }
 
-func NewCSAgreementWorker(c *CSProtocolHandler, cfg *config.HorizonConfig, db *bolt.DB, pm *policy.PolicyManager, alm *AgreementLockManager) *CSAgreementWorker {
+func NewCSAgreementWorker(c *CSProtocolHandler, cfg *config.HorizonConfig, db persistence.Store, pm *policy.PolicyManager, alm *AgreementLockManager) *CSAgreementWorker {
 
 	p := &CSAgreementWorker{
 		BaseAgreementWorker: &BaseAgreementWorker{
@@ -28,6 +28,7 @@ func NewCSAgreementWorker(c *CSProtocolHandler, cfg *config.HorizonConfig, db *b
 			alm:        alm,
 			workerID:   uuid.NewV4().String(),
 			httpClient: cfg.Collaborators.HTTPClientFactory.NewHTTPClient(nil),
+			messages:   c.messages,
 		},
 		protocolHandler: c,
 	}
@@ -3,7 +3,6 @@ package agreementbot
 import (
 	"errors"
 	"fmt"
-	"github.com/boltdb/bolt"
 	"github.com/golang/glog"
 	"github.com/open-horizon/anax/abstractprotocol"
 	"github.com/open-horizon/anax/citizenscientist"
@@ -12,6 +11,7 @@ import (
 	"github.com/open-horizon/anax/events"
 	"github.com/open-horizon/anax/exchange"
 	"github.com/open-horizon/anax/metering"
+	"github.com/open-horizon/anax/persistence"
 	"github.com/open-horizon/anax/policy"
 	"github.com/open-horizon/anax/worker"
 	"math/rand"
@@ -36,7 +36,7 @@ type CSProtocolHandler struct {
 	bcStateLock        sync.Mutex
 }
 
-func NewCSProtocolHandler(name string, cfg *config.HorizonConfig, db *bolt.DB, pm *policy.PolicyManager, messages chan events.Message) *CSProtocolHandler {
+func NewCSProtocolHandler(name string, cfg *config.HorizonConfig, db persistence.Store, pm *policy.PolicyManager, messages chan events.Message) *CSProtocolHandler {
 	if name == citizenscientist.PROTOCOL_NAME {
 		return &CSProtocolHandler{
 			BaseConsumerProtocolHandler: &BaseConsumerProtocolHandler{
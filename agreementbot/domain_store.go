@@ -0,0 +1,203 @@
+package agreementbot
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/open-horizon/anax/persistence"
+	"sort"
+	"strconv"
+	"sync"
+)
+
+// The AgbotStore is the storage interface of the agbot in terms of the records it keeps: the agreements it has
+// with nodes and the workload usages of those nodes. BoltAgbotStore keeps the records as JSON in the buckets of
+// a Store, which is how the agbot keeps them in its BoltDB database. MemoryAgbotStore keeps the records in maps,
+// for unit tests. The domain records of the node are in persistence.DomainStore.
+type AgbotStore interface {
+	FindAgreements(filters []AFilter, protocol string) ([]Agreement, error)
+	SaveAgreement(ag *Agreement) error // Insert or replace the agreement
+	DeleteAgreement(agreementId string, protocol string) error
+	FindWorkloadUsages(filters []WUFilter) ([]WorkloadUsage, error)
+	SaveWorkloadUsage(wu *WorkloadUsage) error // Insert or replace the usage, a new usage (Id 0) is given an id
+	DeleteWorkloadUsage(deviceId string, policyName string) error
+}
+
+// The agbot records kept in the buckets of a Store.
+type BoltAgbotStore struct {
+	db persistence.Store
+}
+
+func NewBoltAgbotStore(db persistence.Store) *BoltAgbotStore {
+	return &BoltAgbotStore{
+		db: db,
+	}
+}
+
+func (s *BoltAgbotStore) FindAgreements(filters []AFilter, protocol string) ([]Agreement, error) {
+	return FindAgreements(s.db, filters, protocol)
+}
+
+func (s *BoltAgbotStore) SaveAgreement(ag *Agreement) error {
+	if ag.CurrentAgreementId == "" {
+		return errors.New("Agreement id empty, cannot save")
+	}
+	return putRecord(s.db, bucketName(ag.AgreementProtocol), ag.CurrentAgreementId, ag)
+}
+
+func (s *BoltAgbotStore) DeleteAgreement(agreementId string, protocol string) error {
+	return DeleteAgreement(s.db, agreementId, protocol)
+}
+
+func (s *BoltAgbotStore) FindWorkloadUsages(filters []WUFilter) ([]WorkloadUsage, error) {
+	return FindWorkloadUsages(s.db, filters)
+}
+
+func (s *BoltAgbotStore) SaveWorkloadUsage(wu *WorkloadUsage) error {
+	if wu.Id == 0 {
+		return WUPersistNew(s.db, wuBucketName(), wu)
+	}
+	return putRecord(s.db, wuBucketName(), strconv.FormatUint(wu.Id, 10), wu)
+}
+
+func (s *BoltAgbotStore) DeleteWorkloadUsage(deviceId string, policyName string) error {
+	return DeleteWorkloadUsage(s.db, deviceId, policyName)
+}
+
+// Write a record to a bucket as JSON, replacing the record with the same key.
+func putRecord(db persistence.Store, bucket string, key string, record interface{}) error {
+	return db.Update(func(tx persistence.Tx) error {
+		if b, err := tx.CreateBucketIfNotExists([]byte(bucket)); err != nil {
+			return err
+		} else if serial, err := json.Marshal(record); err != nil {
+			return fmt.Errorf("Failed to serialize %v record: %v. Error: %v", bucket, record, err)
+		} else {
+			return b.Put([]byte(key), serial)
+		}
+	})
+}
+
+// An AgbotStore that keeps its records in maps. Records are copied in and out by value, so callers cannot
+// change a stored record without saving it again. Records are returned in key order, like the buckets of a Store.
+type MemoryAgbotStore struct {
+	lock       sync.Mutex
+	agreements map[string]map[string]Agreement // keyed by protocol, then agreement id
+	usages     map[uint64]WorkloadUsage
+	usageSeq   uint64
+}
+
+func NewMemoryAgbotStore() *MemoryAgbotStore {
+	return &MemoryAgbotStore{
+		agreements: make(map[string]map[string]Agreement),
+		usages:     make(map[uint64]WorkloadUsage),
+	}
+}
+
+func (s *MemoryAgbotStore) FindAgreements(filters []AFilter, protocol string) ([]Agreement, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	agreements := make([]Agreement, 0)
+	byId := s.agreements[protocol]
+	keys := make([]string, 0, len(byId))
+	for id := range byId {
+		keys = append(keys, id)
+	}
+	sort.Strings(keys)
+	for _, id := range keys {
+		ag := byId[id]
+		exclude := false
+		for _, filterFn := range filters {
+			if !filterFn(ag) {
+				exclude = true
+			}
+		}
+		if !exclude {
+			agreements = append(agreements, ag)
+		}
+	}
+	return agreements, nil
+}
+
+func (s *MemoryAgbotStore) SaveAgreement(ag *Agreement) error {
+	if ag.CurrentAgreementId == "" {
+		return errors.New("Agreement id empty, cannot save")
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if _, ok := s.agreements[ag.AgreementProtocol]; !ok {
+		s.agreements[ag.AgreementProtocol] = make(map[string]Agreement)
+	}
+	s.agreements[ag.AgreementProtocol][ag.CurrentAgreementId] = *ag
+	return nil
+}
+
+func (s *MemoryAgbotStore) DeleteAgreement(agreementId string, protocol string) error {
+	if agreementId == "" {
+		return fmt.Errorf("Missing required arg pk")
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	// Like the bucket implementation, an agreement that is already gone is not an error.
+	delete(s.agreements[protocol], agreementId)
+	return nil
+}
+
+func (s *MemoryAgbotStore) FindWorkloadUsages(filters []WUFilter) ([]WorkloadUsage, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	wlUsages := make([]WorkloadUsage, 0)
+	keys := make([]string, 0, len(s.usages))
+	for id := range s.usages {
+		keys = append(keys, strconv.FormatUint(id, 10))
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		id, _ := strconv.ParseUint(key, 10, 64)
+		wu := s.usages[id]
+		exclude := false
+		for _, filterFn := range filters {
+			if !filterFn(wu) {
+				exclude = true
+			}
+		}
+		if !exclude {
+			wlUsages = append(wlUsages, wu)
+		}
+	}
+	return wlUsages, nil
+}
+
+func (s *MemoryAgbotStore) SaveWorkloadUsage(wu *WorkloadUsage) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if wu.Id == 0 {
+		s.usageSeq += 1
+		wu.Id = s.usageSeq
+	}
+	s.usages[wu.Id] = *wu
+	return nil
+}
+
+func (s *MemoryAgbotStore) DeleteWorkloadUsage(deviceId string, policyName string) error {
+	if deviceId == "" || policyName == "" {
+		return fmt.Errorf("Missing required arg deviceid or policyName")
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	for id, wu := range s.usages {
+		if wu.DeviceId == deviceId && wu.PolicyName == policyName {
+			delete(s.usages, id)
+			return nil
+		}
+	}
+	return fmt.Errorf("Unable to locate workload usage for device: %v, and policy: %v", deviceId, policyName)
+}
@@ -0,0 +1,65 @@
+// +build unit
+
+package agreementbot
+
+import (
+	"github.com/open-horizon/anax/persistence"
+	"testing"
+)
+
+// Both agbot store implementations must behave the same way, so the same checks are run against each of them.
+func Test_MemoryAgbotStore(t *testing.T) {
+	checkAgbotStore(t, NewMemoryAgbotStore())
+}
+
+func Test_BoltAgbotStore(t *testing.T) {
+	checkAgbotStore(t, NewBoltAgbotStore(persistence.NewMemoryStore()))
+}
+
+func checkAgbotStore(t *testing.T, store AgbotStore) {
+
+	// Agreements are kept per protocol and can be replaced.
+	for _, ag := range []Agreement{
+		{CurrentAgreementId: "ag2", AgreementProtocol: "Basic", DeviceId: "myorg/d2", PolicyName: "p1"},
+		{CurrentAgreementId: "ag1", AgreementProtocol: "Basic", DeviceId: "myorg/d1", PolicyName: "p1"},
+		{CurrentAgreementId: "ag3", AgreementProtocol: "Citizen Scientist", DeviceId: "myorg/d3", PolicyName: "p1"},
+	} {
+		if err := store.SaveAgreement(&ag); err != nil {
+			t.Fatalf("unable to save agreement %v, error: %v", ag.CurrentAgreementId, err)
+		}
+	}
+	archived := Agreement{CurrentAgreementId: "ag2", AgreementProtocol: "Basic", DeviceId: "myorg/d2", PolicyName: "p1", Archived: true}
+	if err := store.SaveAgreement(&Agreement{AgreementProtocol: "Basic"}); err == nil {
+		t.Errorf("expected an agreement without an id to be refused")
+	} else if err := store.SaveAgreement(&archived); err != nil {
+		t.Fatalf("unable to replace agreement, error: %v", err)
+	}
+
+	if ags, err := store.FindAgreements([]AFilter{}, "Basic"); err != nil || len(ags) != 2 || ags[0].CurrentAgreementId != "ag1" {
+		t.Errorf("expected ag1 and ag2 in key order, got %v %v", ags, err)
+	} else if ags, err := policyAgreements(store, "p1"); err != nil || len(ags) != 2 {
+		t.Errorf("expected 2 unarchived agreements on the policy, got %v %v", ags, err)
+	} else if err := store.DeleteAgreement("ag1", "Basic"); err != nil {
+		t.Errorf("unexpected error %v", err)
+	} else if ags, _ := store.FindAgreements([]AFilter{UnarchivedAFilter()}, "Basic"); len(ags) != 0 {
+		t.Errorf("expected no unarchived agreements, got %v", ags)
+	}
+
+	// Workload usages are given an id when they are first saved.
+	wu := &WorkloadUsage{DeviceId: "myorg/d1", PolicyName: "p1", Priority: 1}
+	if err := store.SaveWorkloadUsage(wu); err != nil || wu.Id == 0 {
+		t.Errorf("expected the usage to be given an id, got %v %v", wu.Id, err)
+	}
+	wu.Priority = 2
+	if err := store.SaveWorkloadUsage(wu); err != nil {
+		t.Errorf("unexpected error %v", err)
+	} else if wus, err := store.FindWorkloadUsages([]WUFilter{DaPWUFilter("myorg/d1", "p1")}); err != nil || len(wus) != 1 || wus[0].Priority != 2 {
+		t.Errorf("expected the replaced usage, got %v %v", wus, err)
+	} else if err := store.DeleteWorkloadUsage("myorg/d1", "p1"); err != nil {
+		t.Errorf("unexpected error %v", err)
+	} else if err := store.DeleteWorkloadUsage("myorg/d1", "p1"); err == nil {
+		t.Errorf("expected the deletion of a missing usage to fail")
+	} else if wus, _ := store.FindWorkloadUsages([]WUFilter{}); len(wus) != 0 {
+		t.Errorf("expected no usages, got %v", wus)
+	}
+}
@@ -0,0 +1,73 @@
+package agreementbot
+
+import (
+	"fmt"
+	"github.com/open-horizon/anax/exchange"
+	"github.com/open-horizon/anax/policy"
+)
+
+// The output of the policy explain API. It explains why a node is or is not compatible with the
+// policies this agbot is serving.
+type NodePolicyExplanation struct {
+	NodeId        string                            `json:"node"`
+	Pattern       string                            `json:"pattern"`
+	ProducerMerge []policy.CompatibilityExplanation `json:"producer_merge,omitempty"` // Results of merging the node's microservice policies
+	Policies      []policy.CompatibilityExplanation `json:"policies"`                 // Results of comparing the node with each agbot policy
+}
+
+// This function mimics the policy checks that the agbot performs before making an agreement with a device,
+// but instead of stopping at the first failure, it records the result of every policy clause. If
+// policyName is not empty, only the agbot policy with that name is explained.
+func ExplainNode(nodeId string, dev *exchange.Device, pm *policy.PolicyManager, policyName string, defaultNoData uint64) (*NodePolicyExplanation, error) {
+
+	res := &NodePolicyExplanation{
+		NodeId:        nodeId,
+		Pattern:       dev.Pattern,
+		ProducerMerge: make([]policy.CompatibilityExplanation, 0, 5),
+		Policies:      make([]policy.CompatibilityExplanation, 0, 10),
+	}
+
+	// Merge all the node's microservice policies together, recording the compatibility of each step in the merge.
+	var producerPolicy *policy.Policy
+	for _, ms := range dev.RegisteredMicroservices {
+		if pol, err := policy.DemarshalPolicy(ms.Policy); err != nil {
+			return nil, fmt.Errorf("error demarshalling node %v policy for %v, error: %v", nodeId, ms.Url, err)
+		} else if producerPolicy == nil {
+			producerPolicy = pol
+		} else if ex := policy.Explain_Compatible_Producers(producerPolicy, pol); !ex.Compatible {
+			res.ProducerMerge = append(res.ProducerMerge, *ex)
+			return res, nil
+		} else if merged, err := policy.Are_Compatible_Producers(producerPolicy, pol, defaultNoData); err != nil {
+			return nil, fmt.Errorf("error merging policies %v and %v, error: %v", producerPolicy, pol, err)
+		} else {
+			res.ProducerMerge = append(res.ProducerMerge, *ex)
+			producerPolicy = merged
+		}
+	}
+
+	// A node without microservices has no producer side policy, which is handled the same way that
+	// the agbot handles it when searching for devices.
+	if producerPolicy == nil {
+		producerPolicy = policy.Policy_Factory("empty")
+	}
+
+	for _, org := range pm.GetAllPolicyOrgs() {
+		for _, consumerPolicy := range pm.GetAllPolicies(org) {
+			if policyName != "" && consumerPolicy.Header.Name != policyName {
+				continue
+			}
+
+			// Policies generated from a pattern only apply to nodes that are using the same pattern.
+			if consumerPolicy.PatternId != "" && consumerPolicy.PatternId != dev.Pattern {
+				ex := policy.NewCompatibilityExplanation(producerPolicy.Header.Name, consumerPolicy.Header.Name)
+				ex.Add(policy.EXPLAIN_PATTERN, fmt.Errorf("node pattern %v is not policy pattern %v", dev.Pattern, consumerPolicy.PatternId))
+				res.Policies = append(res.Policies, *ex)
+				continue
+			}
+
+			res.Policies = append(res.Policies, *policy.Explain_Compatibility(producerPolicy, &consumerPolicy))
+		}
+	}
+
+	return res, nil
+}
@@ -0,0 +1,59 @@
+package agreementbot
+
+import (
+	"github.com/open-horizon/anax/metrics"
+	"github.com/open-horizon/anax/persistence"
+	"github.com/open-horizon/anax/policy"
+)
+
+// The states that an agbot agreement can be in, from the metrics point of view.
+const (
+	AB_STATE_PROPOSED  = "proposed"
+	AB_STATE_CREATED   = "created"
+	AB_STATE_FINALIZED = "finalized"
+	AB_STATE_TIMEDOUT  = "timedout"
+	AB_STATE_ARCHIVED  = "archived"
+)
+
+var agbotAgreementsByState = metrics.AgbotRegistry.NewGaugeVec("anax_agbot_agreements", "The number of agreements the agbot has with nodes, by agreement protocol and state.", "protocol", "state")
+
+// Returns the most advanced state that the agreement has reached.
+func agreementState(ag *Agreement) string {
+	if ag.Archived {
+		return AB_STATE_ARCHIVED
+	} else if ag.AgreementTimedout != 0 {
+		return AB_STATE_TIMEDOUT
+	} else if ag.AgreementFinalizedTime != 0 {
+		return AB_STATE_FINALIZED
+	} else if ag.AgreementCreationTime != 0 {
+		return AB_STATE_CREATED
+	}
+	return AB_STATE_PROPOSED
+}
+
+// Refresh the metrics that are computed from the agbot database.
+func UpdateAgreementMetrics(db persistence.Store) error {
+
+	for _, agp := range policy.AllAgreementProtocols() {
+		ags, err := FindAgreements(db, []AFilter{}, agp)
+		if err != nil {
+			return err
+		}
+
+		counts := map[string]int{
+			AB_STATE_PROPOSED:  0,
+			AB_STATE_CREATED:   0,
+			AB_STATE_FINALIZED: 0,
+			AB_STATE_TIMEDOUT:  0,
+			AB_STATE_ARCHIVED:  0,
+		}
+		for ix := range ags {
+			counts[agreementState(&ags[ix])] += 1
+		}
+		for state, count := range counts {
+			agbotAgreementsByState.Set(float64(count), agp, state)
+		}
+	}
+
+	return nil
+}
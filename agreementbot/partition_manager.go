@@ -0,0 +1,200 @@
+package agreementbot
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"github.com/golang/glog"
+	"github.com/open-horizon/anax/cutil"
+	"github.com/open-horizon/anax/exchange"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// The Partition manager's job is to split the nodes between the agbots that serve the same patterns, so that only one
+// of them makes agreements with each node. The nodes are placed on a consistent hash ring on which every agbot has a
+// number of points. A node belongs to the agbot with the first point at or after the hash of the node. When an agbot
+// joins or leaves, only the nodes between its points and the points before them change owner.
+//
+// The members of the ring are learned from the list of agbots in the exchange. An agbot is a member while it keeps
+// heartbeating to the exchange. The manager always counts its own agbot as a member, so an agbot alone in the ring
+// owns every node.
+//
+// Agreements with the nodes that move to another agbot are handed off. The agbot that has an agreement asks the node to
+// move the agreement to the new owner, which takes over governing it, so the workload keeps running. The agreements of
+// an agbot that stopped heartbeating are asked for by their new owners. So that an agbot that restarts or misses a few
+// heartbeats does not cause a round of hand-offs, the hand-off waits until the members have been unchanged for a while.
+
+// The number of points each agbot has on the ring. More points spread the nodes more evenly between the agbots.
+const PARTITION_POINTS_PER_AGBOT = 128
+
+type ringPoint struct {
+	hash  uint32
+	agbot string
+}
+
+type ringPointsByHash []ringPoint
+
+func (s ringPointsByHash) Len() int {
+	return len(s)
+}
+
+func (s ringPointsByHash) Swap(i, j int) {
+	s[i], s[j] = s[j], s[i]
+}
+
+func (s ringPointsByHash) Less(i, j int) bool {
+	return s[i].hash < s[j].hash || (s[i].hash == s[j].hash && s[i].agbot < s[j].agbot)
+}
+
+type PartitionManager struct {
+	lock    sync.Mutex
+	self    string      // the id of this agbot, org/id
+	members []string    // the ids of the agbots in the ring, sorted
+	ring    []ringPoint // the points of the members, sorted by hash
+	changed time.Time   // when the members last changed
+	handOff bool        // true when the members changed since the agreements were last handed off
+}
+
+func (p *PartitionManager) String() string {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	return fmt.Sprintf("Self: %v, Members: %v", p.self, p.members)
+}
+
+func NewPartitionManager(self string) *PartitionManager {
+	p := &PartitionManager{
+		self: self,
+	}
+	p.SetMembers([]string{})
+	p.handOff = false
+	return p
+}
+
+// Replace the members of the ring. Returns true when the members changed.
+func (p *PartitionManager) SetMembers(agbots []string) bool {
+
+	members := []string{p.self}
+	for _, id := range agbots {
+		if !contains(members, id) {
+			members = append(members, id)
+		}
+	}
+	sort.Strings(members)
+
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	if strings.Join(members, ",") == strings.Join(p.members, ",") {
+		return false
+	}
+
+	ring := make([]ringPoint, 0, len(members)*PARTITION_POINTS_PER_AGBOT)
+	for _, id := range members {
+		for i := 0; i < PARTITION_POINTS_PER_AGBOT; i++ {
+			ring = append(ring, ringPoint{hash: partitionHash(id + "-" + strconv.Itoa(i)), agbot: id})
+		}
+	}
+	sort.Sort(ringPointsByHash(ring))
+
+	p.members = members
+	p.ring = ring
+	p.changed = time.Now()
+	p.handOff = true
+	return true
+}
+
+// Returns true when the members changed and have been unchanged for at least the given time since, and the agreements
+// have not been handed off since the change. Returns true once for each change that lasts.
+func (p *PartitionManager) HandOffDue(now time.Time, stable time.Duration) bool {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	if !p.handOff || now.Sub(p.changed) < stable {
+		return false
+	}
+	p.handOff = false
+	return true
+}
+
+// Return a copy of the members of the ring.
+func (p *PartitionManager) Members() []string {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	return append([]string{}, p.members...)
+}
+
+// Return the agbot that owns the given partition key.
+func (p *PartitionManager) Owner(key string) string {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	h := partitionHash(key)
+	ix := sort.Search(len(p.ring), func(i int) bool { return p.ring[i].hash >= h })
+	if ix == len(p.ring) {
+		ix = 0
+	}
+	return p.ring[ix].agbot
+}
+
+// Return true when this agbot owns the given partition key.
+func (p *PartitionManager) Owns(key string) bool {
+	return p.Owner(key) == p.self
+}
+
+// The ids are hashed with SHA-256 because FNV spreads similar ids, like node1 and node2, poorly around the ring.
+func partitionHash(s string) uint32 {
+	sum := sha256.Sum256([]byte(s))
+	return binary.BigEndian.Uint32(sum[:4])
+}
+
+// The partition key of a node. The nodes in an HA group have to be governed by the same agbot so that it can stagger
+// their workload upgrades, so the whole group is keyed by the lowest node id in the group.
+func partitionKey(deviceId string, haPartners []string) string {
+	key := deviceId
+	for _, partner := range haPartners {
+		if partner != "" && partner < key {
+			key = partner
+		}
+	}
+	return key
+}
+
+// Return the ids of the agbots that heartbeated to the exchange within the timeout, sorted. The given agbot is always
+// included.
+func activeAgbots(self string, agbots map[string]exchange.Agbot, now int64, timeoutS int) []string {
+	active := []string{self}
+	for id, ag := range agbots {
+		if id == self || ag.LastHeartbeat == "" {
+			continue
+		} else if lastHB := cutil.TimeInSeconds(ag.LastHeartbeat); lastHB+int64(timeoutS) >= now {
+			active = append(active, id)
+		} else {
+			glog.V(5).Infof(AWlogString(fmt.Sprintf("agbot %v has not heartbeated since %v, leaving it out of the partitions", id, ag.LastHeartbeat)))
+		}
+	}
+	sort.Strings(active)
+	return active
+}
+
+// Return a key that is the same for agbots that serve the same patterns.
+func servedPatternsKey(pats map[string]exchange.ServedPattern) string {
+	keys := make([]string, 0, len(pats))
+	for _, pat := range pats {
+		keys = append(keys, pat.Org+"/"+pat.Pattern)
+	}
+	sort.Strings(keys)
+	return strings.Join(keys, ",")
+}
+
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
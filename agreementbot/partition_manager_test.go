@@ -0,0 +1,139 @@
+// +build unit
+
+package agreementbot
+
+import (
+	"fmt"
+	"github.com/open-horizon/anax/cutil"
+	"github.com/open-horizon/anax/exchange"
+	"testing"
+	"time"
+)
+
+func Test_PartitionManager_alone(t *testing.T) {
+	pm := NewPartitionManager("myorg/agbot1")
+
+	if members := pm.Members(); len(members) != 1 || members[0] != "myorg/agbot1" {
+		t.Errorf("expected the agbot to be the only member, got %v", members)
+	}
+	for i := 0; i < 100; i++ {
+		if key := fmt.Sprintf("myorg/node%v", i); !pm.Owns(key) {
+			t.Errorf("expected an agbot alone to own %v", key)
+		}
+	}
+
+	// The agbot is always a member, even when the exchange does not list it.
+	if pm.SetMembers([]string{}) {
+		t.Errorf("expected no change to the members")
+	}
+}
+
+func Test_PartitionManager_rebalance(t *testing.T) {
+	agbots := []string{"myorg/agbot1", "myorg/agbot2", "myorg/agbot3"}
+	managers := make([]*PartitionManager, 0)
+	for _, id := range agbots {
+		pm := NewPartitionManager(id)
+		if !pm.SetMembers(agbots) {
+			t.Errorf("expected the members to change")
+		} else if pm.SetMembers(agbots) {
+			t.Errorf("expected setting the same members to be no change")
+		}
+		managers = append(managers, pm)
+	}
+
+	// Every node is owned by exactly one agbot, and each agbot gets a fair share.
+	nodes := 3000
+	owners := make(map[string]string)
+	counts := make(map[string]int)
+	for i := 0; i < nodes; i++ {
+		key := fmt.Sprintf("myorg/node%v", i)
+		owning := 0
+		for _, pm := range managers {
+			if pm.Owns(key) {
+				owning += 1
+				owners[key] = pm.self
+			}
+		}
+		if owning != 1 {
+			t.Fatalf("expected %v to be owned by one agbot, owned by %v", key, owning)
+		}
+		counts[owners[key]] += 1
+	}
+	for _, id := range agbots {
+		if counts[id] < nodes/6 {
+			t.Errorf("expected %v to own about a third of the nodes, owns %v", id, counts[id])
+		}
+	}
+
+	// When an agbot leaves, only its nodes move.
+	managers[0].SetMembers(agbots[:2])
+	for key, owner := range owners {
+		newOwner := managers[0].Owner(key)
+		if owner != "myorg/agbot3" && newOwner != owner {
+			t.Errorf("expected %v to stay with %v, moved to %v", key, owner, newOwner)
+		} else if newOwner == "myorg/agbot3" {
+			t.Errorf("expected %v to move off the agbot that left", key)
+		}
+	}
+}
+
+func Test_PartitionManager_HandOffDue(t *testing.T) {
+	pm := NewPartitionManager("myorg/agbot1")
+	stable := 5 * time.Minute
+
+	// Nothing changed, nothing to hand off.
+	if pm.HandOffDue(time.Now().Add(time.Hour), stable) {
+		t.Errorf("expected no hand-off without a change")
+	}
+
+	// The hand-off waits until the members have been unchanged for the stable time, and happens once.
+	pm.SetMembers([]string{"myorg/agbot2"})
+	if pm.HandOffDue(time.Now(), stable) {
+		t.Errorf("expected no hand-off right after a change")
+	}
+
+	// Another change restarts the wait, e.g. an agbot that missed a few heartbeats and is back.
+	pm.SetMembers([]string{})
+	if pm.HandOffDue(time.Now().Add(stable/2), stable) {
+		t.Errorf("expected no hand-off before the members are stable")
+	} else if !pm.HandOffDue(time.Now().Add(stable), stable) {
+		t.Errorf("expected a hand-off once the members are stable")
+	} else if pm.HandOffDue(time.Now().Add(2*stable), stable) {
+		t.Errorf("expected one hand-off for a change")
+	}
+}
+
+func Test_partitionKey(t *testing.T) {
+	if key := partitionKey("myorg/node2", nil); key != "myorg/node2" {
+		t.Errorf("expected the node id as the key, got %v", key)
+	} else if key := partitionKey("myorg/node2", []string{"myorg/node3", "myorg/node1"}); key != "myorg/node1" {
+		t.Errorf("expected the lowest HA partner as the key, got %v", key)
+	} else if key := partitionKey("myorg/node1", []string{"myorg/node2"}); key != "myorg/node1" {
+		t.Errorf("expected the node itself as the key, got %v", key)
+	}
+}
+
+func Test_activeAgbots(t *testing.T) {
+	now := time.Now().Unix()
+	hb := func(ago int64) string {
+		return time.Unix(now-ago, 0).UTC().Format(cutil.ExchangeTimeFormat)
+	}
+
+	agbots := map[string]exchange.Agbot{
+		"myorg/agbot1": {LastHeartbeat: hb(500)},
+		"myorg/agbot2": {LastHeartbeat: hb(30)},
+		"myorg/agbot3": {LastHeartbeat: hb(400)},
+		"myorg/agbot4": {},
+	}
+	if active := activeAgbots("myorg/agbot1", agbots, now, 180); len(active) != 2 || active[0] != "myorg/agbot1" || active[1] != "myorg/agbot2" {
+		t.Errorf("expected agbot1 and agbot2 to be active, got %v", active)
+	}
+
+	a := map[string]exchange.ServedPattern{"x": {Org: "myorg", Pattern: "p2"}, "y": {Org: "myorg", Pattern: "p1"}}
+	b := map[string]exchange.ServedPattern{"1": {Org: "myorg", Pattern: "p1"}, "2": {Org: "myorg", Pattern: "p2"}}
+	if servedPatternsKey(a) != servedPatternsKey(b) {
+		t.Errorf("expected the same patterns to have the same key, got %v and %v", servedPatternsKey(a), servedPatternsKey(b))
+	} else if servedPatternsKey(a) == servedPatternsKey(nil) {
+		t.Errorf("expected different patterns to have different keys")
+	}
+}
@@ -4,8 +4,8 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
-	"github.com/boltdb/bolt"
 	"github.com/golang/glog"
+	"github.com/open-horizon/anax/persistence"
 	"github.com/open-horizon/anax/policy"
 	"time"
 )
@@ -55,6 +55,7 @@ type Agreement struct {
 	NHCheckAgreementStatus         int      `json:"check_agreement_status"`            // How often to check that the node agreement entry still exists in the exchange (in seconds)
 	Pattern                        string   `json:"pattern"`                           // The pattern used to make the agreement
 
+	NodeProperties policy.PropertyList `json:"node_properties"` // The properties of the node, from the producer policy used to make the proposal
 }
 
 func (a Agreement) String() string {
@@ -95,7 +96,8 @@ func (a Agreement) String() string {
 		"BCUpdateAckTime: %v, "+
 		"NHMissingHBInterval: %v, "+
 		"NHCheckAgreementStatus: %v, "+
-		"Pattern: %v",
+		"Pattern: %v, "+
+		"NodeProperties: %v",
 		a.Archived, a.CurrentAgreementId, a.Org, a.AgreementProtocol, a.AgreementProtocolVersion, a.DeviceId, a.HAPartners,
 		a.AgreementInceptionTime, a.AgreementCreationTime, a.AgreementFinalizedTime,
 		a.AgreementTimedout, a.ProposalSig, a.ProposalHash, a.ConsumerProposalSig, a.PolicyName, a.CounterPartyAddress,
@@ -103,11 +105,11 @@ func (a Agreement) String() string {
 		a.DisableDataVerificationChecks, a.DataVerifiedTime, a.DataNotificationSent,
 		a.MeteringTokens, a.MeteringPerTimeUnit, a.MeteringNotificationInterval, a.MeteringNotificationSent, a.MeteringNotificationMsgs,
 		a.TerminatedReason, a.TerminatedDescription, a.BlockchainType, a.BlockchainName, a.BlockchainOrg, a.BCUpdateAckTime,
-		a.NHMissingHBInterval, a.NHCheckAgreementStatus, a.Pattern)
+		a.NHMissingHBInterval, a.NHCheckAgreementStatus, a.Pattern, a.NodeProperties)
 }
 
 // private factory method for agreement w/out persistence safety:
-func agreement(agreementid string, org string, deviceid string, policyName string, bcType string, bcName string, bcOrg string, agreementProto string, pattern string, nhPolicy policy.NodeHealth) (*Agreement, error) {
+func agreement(agreementid string, org string, deviceid string, policyName string, bcType string, bcName string, bcOrg string, agreementProto string, pattern string, nhPolicy policy.NodeHealth, nodeProps policy.PropertyList) (*Agreement, error) {
 	if agreementid == "" || agreementProto == "" {
 		return nil, errors.New("Illegal input: agreement id or agreement protocol is empty")
 	} else {
@@ -152,12 +154,13 @@ func agreement(agreementid string, org string, deviceid string, policyName strin
 			NHMissingHBInterval:            nhPolicy.MissingHBInterval,
 			NHCheckAgreementStatus:         nhPolicy.CheckAgreementStatus,
 			Pattern:                        pattern,
+			NodeProperties:                 nodeProps,
 		}, nil
 	}
 }
 
-func AgreementAttempt(db *bolt.DB, agreementid string, org string, deviceid string, policyName string, bcType string, bcName string, bcOrg string, agreementProto string, pattern string, nhPolicy policy.NodeHealth) error {
-	if agreement, err := agreement(agreementid, org, deviceid, policyName, bcType, bcName, bcOrg, agreementProto, pattern, nhPolicy); err != nil {
+func AgreementAttempt(db persistence.Store, agreementid string, org string, deviceid string, policyName string, bcType string, bcName string, bcOrg string, agreementProto string, pattern string, nhPolicy policy.NodeHealth, nodeProps policy.PropertyList) error {
+	if agreement, err := agreement(agreementid, org, deviceid, policyName, bcType, bcName, bcOrg, agreementProto, pattern, nhPolicy, nodeProps); err != nil {
 		return err
 	} else if err := PersistNew(db, agreement.CurrentAgreementId, bucketName(agreementProto), &agreement); err != nil {
 		return err
@@ -166,7 +169,7 @@ func AgreementAttempt(db *bolt.DB, agreementid string, org string, deviceid stri
 	}
 }
 
-func AgreementUpdate(db *bolt.DB, agreementid string, proposal string, policy string, dvPolicy policy.DataVerification, defaultCheckRate uint64, hash string, sig string, protocol string, agreementProtoVersion int) (*Agreement, error) {
+func AgreementUpdate(db persistence.Store, agreementid string, proposal string, policy string, dvPolicy policy.DataVerification, defaultCheckRate uint64, hash string, sig string, protocol string, agreementProtoVersion int) (*Agreement, error) {
 	if agreement, err := singleAgreementUpdate(db, agreementid, protocol, func(a Agreement) *Agreement {
 		a.AgreementCreationTime = uint64(time.Now().Unix())
 		a.Proposal = proposal
@@ -197,7 +200,7 @@ func AgreementUpdate(db *bolt.DB, agreementid string, proposal string, policy st
 	}
 }
 
-func AgreementMade(db *bolt.DB, agreementId string, counterParty string, signature string, protocol string, hapartners []string, bcType string, bcName string, bcOrg string) (*Agreement, error) {
+func AgreementMade(db persistence.Store, agreementId string, counterParty string, signature string, protocol string, hapartners []string, bcType string, bcName string, bcOrg string) (*Agreement, error) {
 	if agreement, err := singleAgreementUpdate(db, agreementId, protocol, func(a Agreement) *Agreement {
 		a.CounterPartyAddress = counterParty
 		a.ProposalSig = signature
@@ -213,7 +216,7 @@ func AgreementMade(db *bolt.DB, agreementId string, counterParty string, signatu
 	}
 }
 
-func AgreementBlockchainUpdate(db *bolt.DB, agreementId string, consumerSig string, hash string, counterParty string, signature string, protocol string) (*Agreement, error) {
+func AgreementBlockchainUpdate(db persistence.Store, agreementId string, consumerSig string, hash string, counterParty string, signature string, protocol string) (*Agreement, error) {
 	if agreement, err := singleAgreementUpdate(db, agreementId, protocol, func(a Agreement) *Agreement {
 		a.ConsumerProposalSig = consumerSig
 		a.ProposalHash = hash
@@ -227,7 +230,7 @@ func AgreementBlockchainUpdate(db *bolt.DB, agreementId string, consumerSig stri
 	}
 }
 
-func AgreementBlockchainUpdateAck(db *bolt.DB, agreementId string, protocol string) (*Agreement, error) {
+func AgreementBlockchainUpdateAck(db persistence.Store, agreementId string, protocol string) (*Agreement, error) {
 	if agreement, err := singleAgreementUpdate(db, agreementId, protocol, func(a Agreement) *Agreement {
 		a.BCUpdateAckTime = uint64(time.Now().Unix())
 		return &a
@@ -238,7 +241,7 @@ func AgreementBlockchainUpdateAck(db *bolt.DB, agreementId string, protocol stri
 	}
 }
 
-func AgreementFinalized(db *bolt.DB, agreementid string, protocol string) (*Agreement, error) {
+func AgreementFinalized(db persistence.Store, agreementid string, protocol string) (*Agreement, error) {
 	if agreement, err := singleAgreementUpdate(db, agreementid, protocol, func(a Agreement) *Agreement {
 		a.AgreementFinalizedTime = uint64(time.Now().Unix())
 		return &a
@@ -249,7 +252,46 @@ func AgreementFinalized(db *bolt.DB, agreementid string, protocol string) (*Agre
 	}
 }
 
-func AgreementTimedout(db *bolt.DB, agreementid string, protocol string) (*Agreement, error) {
+// Record an agreement that a node handed off to this agbot from another agbot. The agreement is recorded as finalized,
+// because it was finalized with the agbot that made it. A record left from an earlier time that this agbot had the
+// agreement is replaced. The properties of the node are the properties of the terms and conditions that the consumer
+// policy doesnt have, because the consumer's value of a property replaces the node's value in the terms and
+// conditions.
+func AgreementAdopted(db persistence.Store, agreementid string, org string, deviceid string, pol *policy.Policy, proposal string, tsandcs *policy.Policy, signature string, protocol string, agreementProtoVersion int, defaultCheckRate uint64) (*Agreement, error) {
+	if polBytes, err := json.Marshal(pol); err != nil {
+		return nil, errors.New(fmt.Sprintf("error marshalling policy for storage %v, error: %v", pol, err))
+	} else if existing, err := FindSingleAgreementByAgreementId(db, agreementid, protocol, []AFilter{}); err != nil {
+		return nil, err
+	} else if existing != nil && DeleteAgreement(db, agreementid, protocol) != nil {
+		return nil, errors.New(fmt.Sprintf("unable to delete earlier record of agreement %v", agreementid))
+	} else if err := AgreementAttempt(db, agreementid, org, deviceid, pol.Header.Name, "", "", "", protocol, pol.PatternId, pol.NodeH, nodeProperties(tsandcs, pol)); err != nil {
+		return nil, err
+	} else if _, err := AgreementUpdate(db, agreementid, proposal, string(polBytes), tsandcs.DataVerify, defaultCheckRate, "", "", protocol, agreementProtoVersion); err != nil {
+		return nil, err
+	} else if _, err := AgreementMade(db, agreementid, deviceid, signature, protocol, tsandcs.HAGroup.Partners, "", "", ""); err != nil {
+		return nil, err
+	} else {
+		return AgreementFinalized(db, agreementid, protocol)
+	}
+}
+
+// Returns the properties of the terms and conditions that the consumer policy doesnt have.
+func nodeProperties(tsandcs *policy.Policy, pol *policy.Policy) policy.PropertyList {
+	consumer := make(map[string]bool)
+	for _, prop := range pol.Properties {
+		consumer[prop.Name] = true
+	}
+
+	props := policy.PropertyList{}
+	for _, prop := range tsandcs.Properties {
+		if !consumer[prop.Name] {
+			props = append(props, prop)
+		}
+	}
+	return props
+}
+
+func AgreementTimedout(db persistence.Store, agreementid string, protocol string) (*Agreement, error) {
 	if agreement, err := singleAgreementUpdate(db, agreementid, protocol, func(a Agreement) *Agreement {
 		a.AgreementTimedout = uint64(time.Now().Unix())
 		return &a
@@ -260,7 +302,7 @@ func AgreementTimedout(db *bolt.DB, agreementid string, protocol string) (*Agree
 	}
 }
 
-func DataVerified(db *bolt.DB, agreementid string, protocol string) (*Agreement, error) {
+func DataVerified(db persistence.Store, agreementid string, protocol string) (*Agreement, error) {
 	if agreement, err := singleAgreementUpdate(db, agreementid, protocol, func(a Agreement) *Agreement {
 		a.DataVerifiedTime = uint64(time.Now().Unix())
 		return &a
@@ -271,7 +313,7 @@ func DataVerified(db *bolt.DB, agreementid string, protocol string) (*Agreement,
 	}
 }
 
-func DataNotVerified(db *bolt.DB, agreementid string, protocol string) (*Agreement, error) {
+func DataNotVerified(db persistence.Store, agreementid string, protocol string) (*Agreement, error) {
 	if agreement, err := singleAgreementUpdate(db, agreementid, protocol, func(a Agreement) *Agreement {
 		a.DataVerificationMissedCount += 1
 		return &a
@@ -282,7 +324,7 @@ func DataNotVerified(db *bolt.DB, agreementid string, protocol string) (*Agreeme
 	}
 }
 
-func DataNotification(db *bolt.DB, agreementid string, protocol string) (*Agreement, error) {
+func DataNotification(db persistence.Store, agreementid string, protocol string) (*Agreement, error) {
 	if agreement, err := singleAgreementUpdate(db, agreementid, protocol, func(a Agreement) *Agreement {
 		a.DataNotificationSent = uint64(time.Now().Unix())
 		return &a
@@ -293,7 +335,7 @@ func DataNotification(db *bolt.DB, agreementid string, protocol string) (*Agreem
 	}
 }
 
-func MeteringNotification(db *bolt.DB, agreementid string, protocol string, mn string) (*Agreement, error) {
+func MeteringNotification(db persistence.Store, agreementid string, protocol string, mn string) (*Agreement, error) {
 	if agreement, err := singleAgreementUpdate(db, agreementid, protocol, func(a Agreement) *Agreement {
 		a.MeteringNotificationSent = uint64(time.Now().Unix())
 		if len(a.MeteringNotificationMsgs) == 0 {
@@ -318,7 +360,7 @@ func (a *Agreement) FinalizedWithinTolerance(tolerance uint64) bool {
 	return a.AgreementFinalizedTime > tolerate
 }
 
-func ArchiveAgreement(db *bolt.DB, agreementid string, protocol string, reason uint, desc string) (*Agreement, error) {
+func ArchiveAgreement(db persistence.Store, agreementid string, protocol string, reason uint, desc string) (*Agreement, error) {
 	if agreement, err := singleAgreementUpdate(db, agreementid, protocol, func(a Agreement) *Agreement {
 		a.Archived = true
 		a.TerminatedReason = reason
@@ -332,7 +374,7 @@ func ArchiveAgreement(db *bolt.DB, agreementid string, protocol string, reason u
 }
 
 // no error on not found, only nil
-func FindSingleAgreementByAgreementId(db *bolt.DB, agreementid string, protocol string, filters []AFilter) (*Agreement, error) {
+func FindSingleAgreementByAgreementId(db persistence.Store, agreementid string, protocol string, filters []AFilter) (*Agreement, error) {
 	filters = append(filters, IdAFilter(agreementid))
 
 	if agreements, err := FindAgreements(db, filters, protocol); err != nil {
@@ -347,7 +389,7 @@ func FindSingleAgreementByAgreementId(db *bolt.DB, agreementid string, protocol
 }
 
 // no error on not found, only nil
-func FindSingleAgreementByAgreementIdAllProtocols(db *bolt.DB, agreementid string, protocols []string, filters []AFilter) (*Agreement, error) {
+func FindSingleAgreementByAgreementIdAllProtocols(db persistence.Store, agreementid string, protocols []string, filters []AFilter) (*Agreement, error) {
 	filters = append(filters, IdAFilter(agreementid))
 
 	for _, protocol := range protocols {
@@ -364,7 +406,7 @@ func FindSingleAgreementByAgreementIdAllProtocols(db *bolt.DB, agreementid strin
 	return nil, nil
 }
 
-func singleAgreementUpdate(db *bolt.DB, agreementid string, protocol string, fn func(Agreement) *Agreement) (*Agreement, error) {
+func singleAgreementUpdate(db persistence.Store, agreementid string, protocol string, fn func(Agreement) *Agreement) (*Agreement, error) {
 	if agreement, err := FindSingleAgreementByAgreementId(db, agreementid, protocol, []AFilter{}); err != nil {
 		return nil, err
 	} else if agreement == nil {
@@ -376,8 +418,8 @@ func singleAgreementUpdate(db *bolt.DB, agreementid string, protocol string, fn
 }
 
 // does whole-member replacements of values that are legal to change during the course of an agreement's life
-func persistUpdatedAgreement(db *bolt.DB, agreementid string, protocol string, update *Agreement) error {
-	return db.Update(func(tx *bolt.Tx) error {
+func persistUpdatedAgreement(db persistence.Store, agreementid string, protocol string, update *Agreement) error {
+	return db.Update(func(tx persistence.Tx) error {
 		if b, err := tx.CreateBucketIfNotExists([]byte(AGREEMENTS + "-" + protocol)); err != nil {
 			return err
 		} else {
@@ -502,12 +544,12 @@ func persistUpdatedAgreement(db *bolt.DB, agreementid string, protocol string, u
 	})
 }
 
-func DeleteAgreement(db *bolt.DB, pk string, protocol string) error {
+func DeleteAgreement(db persistence.Store, pk string, protocol string) error {
 	if pk == "" {
 		return fmt.Errorf("Missing required arg pk")
 	} else {
 
-		return db.Update(func(tx *bolt.Tx) error {
+		return db.Update(func(tx persistence.Tx) error {
 			b := tx.Bucket([]byte(bucketName(protocol)))
 			if b == nil {
 				return fmt.Errorf("Unknown bucket: %v", bucketName(protocol))
@@ -547,10 +589,10 @@ func DevPolAFilter(deviceId string, policyName string) AFilter {
 
 type AFilter func(Agreement) bool
 
-func FindAgreements(db *bolt.DB, filters []AFilter, protocol string) ([]Agreement, error) {
+func FindAgreements(db persistence.Store, filters []AFilter, protocol string) ([]Agreement, error) {
 	agreements := make([]Agreement, 0)
 
-	readErr := db.View(func(tx *bolt.Tx) error {
+	readErr := db.View(func(tx persistence.Tx) error {
 
 		if b := tx.Bucket([]byte(bucketName(protocol))); b != nil {
 			b.ForEach(func(k, v []byte) error {
@@ -587,11 +629,11 @@ func FindAgreements(db *bolt.DB, filters []AFilter, protocol string) ([]Agreemen
 	}
 }
 
-func PersistNew(db *bolt.DB, pk string, bucket string, record interface{}) error {
+func PersistNew(db persistence.Store, pk string, bucket string, record interface{}) error {
 	if pk == "" || bucket == "" {
 		return fmt.Errorf("Missing required args, pk and/or bucket")
 	} else {
-		writeErr := db.Update(func(tx *bolt.Tx) error {
+		writeErr := db.Update(func(tx persistence.Tx) error {
 
 			if b, err := tx.CreateBucketIfNotExists([]byte(bucket)); err != nil {
 				return err
@@ -614,3 +656,24 @@ func PersistNew(db *bolt.DB, pk string, bucket string, record interface{}) error
 func bucketName(protocol string) string {
 	return AGREEMENTS + "-" + protocol
 }
+
+// The migrations of the agbot database.
+var Migrations = persistence.NewMigrations("agreementbot")
+
+func init() {
+	// Agreements written before metering notifications were tracked have no message history. The history
+	// always has 2 slots, the newest message first.
+	Migrations.Register(1, "add the metering notification history to agreements", func(tx persistence.Tx) error {
+		for _, protocol := range policy.AllAgreementProtocols() {
+			if err := persistence.UpgradeRecords(tx, bucketName(protocol), func(key string, record map[string]interface{}) error {
+				if msgs, ok := record["metering_notification_msgs"].([]interface{}); !ok || len(msgs) != 2 {
+					record["metering_notification_msgs"] = []string{"", ""}
+				}
+				return nil
+			}); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
@@ -0,0 +1,43 @@
+// +build unit
+
+package agreementbot
+
+import (
+	"github.com/open-horizon/anax/persistence"
+	"github.com/open-horizon/anax/policy"
+	"testing"
+)
+
+// An agreement handed off to this agbot is recorded as finalized and replaces the record of an earlier time that this
+// agbot had the agreement.
+func Test_AgreementAdopted(t *testing.T) {
+
+	db := persistence.NewMemoryStore()
+
+	if err := AgreementAttempt(db, "ag1", "myorg", "myorg/d1", "p1", "", "", "", "Basic", "myorg/pat1", policy.NodeHealth{}, nil); err != nil {
+		t.Fatalf("unable to record agreement attempt, error: %v", err)
+	} else if _, err := ArchiveAgreement(db, "ag1", "Basic", 210, "handed off"); err != nil {
+		t.Fatalf("unable to archive agreement, error: %v", err)
+	}
+
+	pol := policy.Policy_Factory("p1")
+	pol.PatternId = "myorg/pat1"
+	tsandcs := policy.Policy_Factory("ms1 merged with p1")
+	tsandcs.HAGroup.Partners = []string{"myorg/d2"}
+
+	if ag, err := AgreementAdopted(db, "ag1", "myorg", "myorg/d1", pol, "proposal", tsandcs, "sig", "Basic", 2, 60); err != nil {
+		t.Fatalf("unable to adopt agreement, error: %v", err)
+	} else if ag.Archived || ag.AgreementFinalizedTime == 0 || ag.AgreementTimedout != 0 {
+		t.Errorf("expected an unarchived finalized agreement, got %v", ag)
+	} else if ag.DeviceId != "myorg/d1" || ag.CounterPartyAddress != "myorg/d1" || ag.ProposalSig != "sig" || ag.Proposal != "proposal" {
+		t.Errorf("expected the node and proposal of the handoff, got %v", ag)
+	} else if ag.Pattern != "myorg/pat1" || ag.PolicyName != "p1" || ag.AgreementProtocolVersion != 2 {
+		t.Errorf("expected the consumer policy and protocol version, got %v", ag)
+	} else if len(ag.HAPartners) != 1 || ag.HAPartners[0] != "myorg/d2" {
+		t.Errorf("expected the HA partners of the terms and conditions, got %v", ag.HAPartners)
+	}
+
+	if ags, err := FindAgreements(db, []AFilter{}, "Basic"); err != nil || len(ags) != 1 {
+		t.Errorf("expected only the adopted agreement, got %v %v", ags, err)
+	}
+}
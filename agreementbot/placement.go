@@ -0,0 +1,237 @@
+package agreementbot
+
+import (
+	"fmt"
+	"github.com/golang/glog"
+	"github.com/open-horizon/anax/exchange"
+	"github.com/open-horizon/anax/policy"
+	"sort"
+	"time"
+)
+
+// The agbot ranks the compatible nodes that a search finds, on all the pages of the search, before it proposes
+// agreements to them. The ranking follows the placement preferences of the consumer policy, see policy/placement.go.
+// Each kind of preference has a scorer that computes a raw score for a node, where a higher score is better. The raw
+// scores of a preference are scaled to the range 0 to 1 across the nodes being ranked, so that preferences with very
+// different units (MB of ram and km of distance) can be weighed against each other. A node that a preference cant score
+// gets -1 for it, which puts it below the nodes that the preference can score. New kinds of preferences are added by
+// registering a scorer.
+
+// A node that was found by a search and is compatible with the consumer policy.
+type placementCandidate struct {
+	device         exchange.SearchResultDevice
+	producerPolicy *policy.Policy
+	nodePolicy     *policy.Policy // The policies of the node, which hold the properties that rank the node
+	failures       int            // The number of recently failed agreements with the node on this policy
+	retries        int            // The number of workload retries of the node on this policy
+	score          float64        // The weighted score of the node, higher is better
+}
+
+func (c placementCandidate) String() string {
+	return fmt.Sprintf("Device: %v, Failures: %v, Retries: %v, Score: %v", c.device.Id, c.failures, c.retries, c.score)
+}
+
+// A scorer returns the raw score of a node for a preference, and false when it cant score the node.
+type PlacementScorer func(pref policy.PlacementPreference, c *placementCandidate) (float64, bool)
+
+var placementScorers = map[string]PlacementScorer{
+	policy.PLACEMENT_PROPERTY:  scorePropertyPreference,
+	policy.PLACEMENT_PROXIMITY: scoreProximityPreference,
+	policy.PLACEMENT_FAILURES:  scoreFailuresPreference,
+	policy.PLACEMENT_RETRIES:   scoreRetriesPreference,
+}
+
+func scorePropertyPreference(pref policy.PlacementPreference, c *placementCandidate) (float64, bool) {
+	value, ok := candidateProperty(c, pref.Property)
+	if !ok {
+		return 0, false
+	} else if pref.GetOrder() == policy.PLACEMENT_ORDER_LOWER {
+		return -value, true
+	}
+	return value, true
+}
+
+func scoreProximityPreference(pref policy.PlacementPreference, c *placementCandidate) (float64, bool) {
+	lat, latOk := candidateProperty(c, policy.PLACEMENT_LAT_PROPERTY)
+	lon, lonOk := candidateProperty(c, policy.PLACEMENT_LON_PROPERTY)
+	if !latOk || !lonOk {
+		return 0, false
+	}
+	return -policy.GeoDistanceKM(pref.Lat, pref.Lon, lat, lon), true
+}
+
+func scoreFailuresPreference(pref policy.PlacementPreference, c *placementCandidate) (float64, bool) {
+	return -float64(c.failures), true
+}
+
+func scoreRetriesPreference(pref policy.PlacementPreference, c *placementCandidate) (float64, bool) {
+	return -float64(c.retries), true
+}
+
+// Returns the numeric value of a property of the node.
+func candidateProperty(c *placementCandidate, name string) (float64, bool) {
+	if c.nodePolicy == nil {
+		return 0, false
+	}
+	for _, prop := range c.nodePolicy.Properties {
+		if prop.Name == name {
+			return prop.NumericValue()
+		}
+	}
+	return 0, false
+}
+
+type candidatesByScore []*placementCandidate
+
+func (s candidatesByScore) Len() int {
+	return len(s)
+}
+
+func (s candidatesByScore) Swap(i, j int) {
+	s[i], s[j] = s[j], s[i]
+}
+
+func (s candidatesByScore) Less(i, j int) bool {
+	return s[i].score > s[j].score
+}
+
+// Score the candidates and sort them with the best candidate first. Candidates with the same score stay in the order
+// they were found in.
+func scoreCandidates(placement policy.Placement, candidates []*placementCandidate) {
+	for _, c := range candidates {
+		c.score = 0
+	}
+
+	for _, pref := range placement {
+		scorer, ok := placementScorers[pref.Kind]
+		if !ok {
+			continue
+		}
+
+		raw := make([]float64, len(candidates))
+		scored := make([]bool, len(candidates))
+		min, max := 0.0, 0.0
+		found := false
+		for ix, c := range candidates {
+			if raw[ix], scored[ix] = scorer(pref, c); !scored[ix] {
+				continue
+			} else if !found || raw[ix] < min {
+				min = raw[ix]
+			}
+			if !found || raw[ix] > max {
+				max = raw[ix]
+			}
+			found = true
+		}
+
+		// A preference that cant score any of the candidates doesnt change the ranking.
+		if !found {
+			continue
+		}
+		for ix, c := range candidates {
+			scaled := 1.0
+			if !scored[ix] {
+				scaled = -1
+			} else if max != min {
+				scaled = (raw[ix] - min) / (max - min)
+			}
+			c.score += pref.GetWeight() * scaled
+		}
+	}
+
+	sort.Stable(candidatesByScore(candidates))
+}
+
+// Returns true when the candidates of the policy have to be ranked or spread by the properties or the HA groups of the
+// nodes. A pattern search doesnt return the node's policies, so they are read from the exchange for each node that the
+// search finds.
+func usesNodeProperties(pol *policy.Policy) bool {
+	return pol.Placement.Uses(policy.PLACEMENT_PROPERTY) || pol.Placement.Uses(policy.PLACEMENT_PROXIMITY) || len(pol.Spread) != 0
+}
+
+// Rank the candidates by the placement preferences of the policy, best first.
+func (w *AgreementBotWorker) rankCandidates(pol *policy.Policy, candidates []*placementCandidate) []*placementCandidate {
+	if len(pol.Placement) == 0 || len(candidates) < 2 {
+		return candidates
+	}
+
+	if pol.Placement.Uses(policy.PLACEMENT_FAILURES) {
+		w.countRecentFailures(pol, candidates)
+	}
+	if pol.Placement.Uses(policy.PLACEMENT_RETRIES) {
+		w.countRetries(pol, candidates)
+	}
+
+	scoreCandidates(pol.Placement, candidates)
+	glog.V(5).Infof(AWlogString(fmt.Sprintf("ranked nodes for policy %v: %v", pol.Header.Name, candidates)))
+	return candidates
+}
+
+// Fill in the number of agreements with each candidate on the policy that failed within the window of the failures
+// preference. When there is more than 1 failures preference, the longest window is used.
+func (w *AgreementBotWorker) countRecentFailures(pol *policy.Policy, candidates []*placementCandidate) {
+	windowS := 0
+	for _, pref := range pol.Placement {
+		if pref.Kind == policy.PLACEMENT_FAILURES && pref.GetWindowS() > windowS {
+			windowS = pref.GetWindowS()
+		}
+	}
+	since := uint64(time.Now().Unix() - int64(windowS))
+
+	failures := make(map[string]int)
+	recentFailure := func(a Agreement) bool {
+		return a.PolicyName == pol.Header.Name && a.AgreementInceptionTime >= since && w.failedTermination(a)
+	}
+	for _, agp := range policy.AllAgreementProtocols() {
+		if agreements, err := w.store.FindAgreements([]AFilter{ArchivedAFilter(), recentFailure}, agp); err != nil {
+			glog.Errorf(AWlogString(fmt.Sprintf("unable to read failed agreements for policy %v, error: %v", pol.Header.Name, err)))
+		} else {
+			for _, ag := range agreements {
+				failures[ag.DeviceId] += 1
+			}
+		}
+	}
+
+	for _, c := range candidates {
+		c.failures = failures[c.device.Id]
+	}
+}
+
+// Fill in the workload retry count of each candidate on the policy.
+func (w *AgreementBotWorker) countRetries(pol *policy.Policy, candidates []*placementCandidate) {
+	retries := make(map[string]int)
+	if usages, err := w.store.FindWorkloadUsages([]WUFilter{PWUFilter(pol.Header.Name)}); err != nil {
+		glog.Errorf(AWlogString(fmt.Sprintf("unable to read workload usages for policy %v, error: %v", pol.Header.Name, err)))
+	} else {
+		for _, wlu := range usages {
+			retries[wlu.DeviceId] = wlu.RetryCount
+		}
+	}
+
+	for _, c := range candidates {
+		c.retries = retries[c.device.Id]
+	}
+}
+
+// Drop the candidates that would take the policy over its max agreements. The agreements that the agbot already has,
+// or is making, on the policy count against the max.
+func (w *AgreementBotWorker) limitCandidates(pol *policy.Policy, candidates []*placementCandidate) []*placementCandidate {
+	if pol.MaxAgreements == 0 || len(candidates) == 0 {
+		return candidates
+	}
+
+	agreements, err := policyAgreements(w.store, pol.Header.Name)
+	if err != nil {
+		glog.Errorf(AWlogString(fmt.Sprintf("unable to read agreements for policy %v, error: %v", pol.Header.Name, err)))
+		return []*placementCandidate{}
+	}
+
+	if available := pol.MaxAgreements - len(agreements); available <= 0 {
+		glog.V(5).Infof(AWlogString(fmt.Sprintf("policy %v has reached its max agreements %v", pol.Header.Name, pol.MaxAgreements)))
+		return []*placementCandidate{}
+	} else if available < len(candidates) {
+		glog.V(5).Infof(AWlogString(fmt.Sprintf("policy %v has room for %v more agreements, skipping %v nodes", pol.Header.Name, available, len(candidates)-available)))
+		return candidates[:available]
+	}
+	return candidates
+}
@@ -0,0 +1,98 @@
+// +build unit
+
+package agreementbot
+
+import (
+	"github.com/open-horizon/anax/exchange"
+	"github.com/open-horizon/anax/policy"
+	"testing"
+)
+
+func Test_scoreCandidates(t *testing.T) {
+	newCandidate := func(id string, props map[string]interface{}, failures int) *placementCandidate {
+		pol := policy.Policy_Factory(id)
+		for name, value := range props {
+			pol.Properties = append(pol.Properties, *policy.Property_Factory(name, value))
+		}
+		return &placementCandidate{device: exchange.SearchResultDevice{Id: id}, nodePolicy: pol, failures: failures}
+	}
+	ids := func(candidates []*placementCandidate) []string {
+		res := make([]string, 0)
+		for _, c := range candidates {
+			res = append(res, c.device.Id)
+		}
+		return res
+	}
+
+	small := newCandidate("org/small", map[string]interface{}{"cpus": "1", "ram": "512", "lat": 41.0, "lon": -74.0}, 0)
+	big := newCandidate("org/big", map[string]interface{}{"cpus": "8", "ram": "4096", "lat": 34.0, "lon": -118.0}, 3)
+	medium := newCandidate("org/medium", map[string]interface{}{"cpus": "4", "ram": "2GiB"}, 1)
+	bare := newCandidate("org/bare", nil, 0)
+
+	// Without preferences the nodes stay in the order they were found in.
+	candidates := []*placementCandidate{bare, small, big, medium}
+	scoreCandidates(policy.Placement{}, candidates)
+	if got := ids(candidates); got[0] != "org/bare" || got[3] != "org/medium" {
+		t.Errorf("expected no change to the order, got %v", got)
+	}
+
+	// More cpus is better, and a node without the property is last.
+	scoreCandidates(policy.Placement{{Kind: policy.PLACEMENT_PROPERTY, Property: "cpus"}}, candidates)
+	if got := ids(candidates); got[0] != "org/big" || got[1] != "org/medium" || got[2] != "org/small" || got[3] != "org/bare" {
+		t.Errorf("expected the nodes with the most cpus first, got %v", got)
+	}
+
+	// Quantities are compared in their base unit.
+	scoreCandidates(policy.Placement{{Kind: policy.PLACEMENT_PROPERTY, Property: "ram", Order: policy.PLACEMENT_ORDER_LOWER}}, candidates)
+	if got := ids(candidates); got[0] != "org/small" || got[1] != "org/big" || got[2] != "org/medium" {
+		t.Errorf("expected the nodes with the least ram first, got %v", got)
+	}
+
+	// Closeness to New York and fewer failures outweigh the cpus.
+	placement := policy.Placement{
+		{Kind: policy.PLACEMENT_PROPERTY, Property: "cpus"},
+		{Kind: policy.PLACEMENT_PROXIMITY, Lat: 40.7, Lon: -74.0, Weight: 2},
+		{Kind: policy.PLACEMENT_FAILURES},
+	}
+	candidates = []*placementCandidate{bare, small, big, medium}
+	scoreCandidates(placement, candidates)
+	if got := ids(candidates); got[0] != "org/small" || got[3] != "org/bare" {
+		t.Errorf("expected the node near New York first, got %v %v", got, candidates)
+	}
+}
+
+func Test_placementScorers(t *testing.T) {
+	for _, kind := range policy.PlacementKinds() {
+		if _, ok := placementScorers[kind]; !ok {
+			t.Errorf("expected a scorer for placement kind %v", kind)
+		}
+	}
+
+	c := &placementCandidate{device: exchange.SearchResultDevice{Id: "org/d1"}, retries: 2}
+	if _, ok := scorePropertyPreference(policy.PlacementPreference{Kind: policy.PLACEMENT_PROPERTY, Property: "cpus"}, c); ok {
+		t.Errorf("expected a node without policies not to be scored")
+	} else if score, ok := scoreRetriesPreference(policy.PlacementPreference{Kind: policy.PLACEMENT_RETRIES}, c); !ok || score != -2 {
+		t.Errorf("expected fewer retries to score higher, got %v", score)
+	}
+}
+
+// The policies of the nodes found by a pattern search are only read when a preference ranks the nodes by their
+// properties.
+func Test_usesNodeProperties(t *testing.T) {
+	pol := policy.Policy_Factory("pol1")
+	if usesNodeProperties(pol) {
+		t.Errorf("expected a policy without preferences not to use the node properties")
+	}
+	pol.Placement = policy.Placement{{Kind: policy.PLACEMENT_FAILURES}, {Kind: policy.PLACEMENT_RETRIES}}
+	if usesNodeProperties(pol) {
+		t.Errorf("expected the failures and retries preferences not to use the node properties")
+	}
+	pol.Placement = append(pol.Placement, policy.PlacementPreference{Kind: policy.PLACEMENT_PROXIMITY, Lat: 41.0, Lon: -74.0})
+	if !usesNodeProperties(pol) {
+		t.Errorf("expected the proximity preference to use the node properties")
+	}
+	pol.Placement = policy.Placement{{Kind: policy.PLACEMENT_PROPERTY, Property: "cpus"}}
+	if !usesNodeProperties(pol) {
+		t.Errorf("expected the property preference to use the node properties")
+	}
+}
@@ -0,0 +1,382 @@
+package agreementbot
+
+import (
+	"errors"
+	"fmt"
+	"github.com/golang/glog"
+	"github.com/open-horizon/anax/policy"
+	"time"
+)
+
+// The health of a device being upgraded by a rollout, as judged from its workload usage and agreements.
+const deviceHealthUnknown = ""
+const deviceHealthy = "healthy"
+const deviceUnhealthy = "unhealthy"
+
+type deviceHealth struct {
+	state  string
+	reason string
+}
+
+// Split the devices of a rollout into batches. The canary devices that are in the rollout form the first batch, the rest
+// of the devices are split into batches of the given percentage of all the devices, with at least one device per batch.
+// A batch never takes down so many members of a group that fewer than its keepUp members are left, the surplus members
+// are moved to the next batch. At least one member of a group can always be upgraded, so that the rollout can finish.
+func planBatches(deviceIds []string, canary []string, batchPercent int, groups []rolloutGroup) [][]string {
+	batches := make([][]string, 0)
+
+	inRollout := make(map[string]bool)
+	for _, id := range deviceIds {
+		inRollout[id] = true
+	}
+
+	canaries := make([]string, 0)
+	isCanary := make(map[string]bool)
+	for _, id := range canary {
+		if inRollout[id] && !isCanary[id] {
+			canaries = append(canaries, id)
+			isCanary[id] = true
+		}
+	}
+	if len(canaries) != 0 {
+		batches = append(batches, canaries)
+	}
+
+	size := (len(deviceIds)*batchPercent + 99) / 100
+	if size < 1 {
+		size = 1
+	}
+
+	batch := make([]string, 0, size)
+	for _, id := range deviceIds {
+		if isCanary[id] {
+			continue
+		}
+		batch = append(batch, id)
+		if len(batch) == size {
+			batches = append(batches, batch)
+			batch = make([]string, 0, size)
+		}
+	}
+	if len(batch) != 0 {
+		batches = append(batches, batch)
+	}
+
+	for ix := 0; ix < len(batches); ix++ {
+		for _, group := range groups {
+			allowed := len(group.members) - group.keepUp
+			if allowed < 1 {
+				allowed = 1
+			}
+
+			inGroup := make(map[string]bool)
+			for _, id := range group.members {
+				inGroup[id] = true
+			}
+
+			kept := make([]string, 0, len(batches[ix]))
+			moved := make([]string, 0)
+			for _, id := range batches[ix] {
+				if inGroup[id] && allowed == 0 {
+					moved = append(moved, id)
+					continue
+				} else if inGroup[id] {
+					allowed -= 1
+				}
+				kept = append(kept, id)
+			}
+
+			if len(moved) != 0 {
+				glog.V(5).Infof(logString(fmt.Sprintf("moving devices %v to rollout batch %v to keep %v up", moved, ix+1, group)))
+				batches[ix] = kept
+				if ix+1 == len(batches) {
+					batches = append(batches, []string{})
+				}
+				batches[ix+1] = append(moved, batches[ix+1]...)
+			}
+		}
+	}
+	return batches
+}
+
+// Judge the health of a device since it was upgraded. The device is unhealthy when the workload rollback feature moved it
+// off the target priority, or when an agreement made since the upgrade was terminated because of missing data or a failed
+// node health check. It is healthy once an agreement made since the upgrade is finalized and data has been verified, or
+// when the agreement does not verify data.
+func evaluateDevice(dev RolloutDevice, targetPriority int, wlu *WorkloadUsage, agreements []Agreement, failedTermination func(Agreement) bool) deviceHealth {
+	if wlu != nil && wlu.Priority != targetPriority {
+		return deviceHealth{state: deviceUnhealthy, reason: fmt.Sprintf("device moved to workload priority %v", wlu.Priority)}
+	}
+
+	health := deviceHealth{state: deviceHealthUnknown}
+	for _, ag := range agreements {
+		if ag.AgreementInceptionTime < dev.UpgradeTime {
+			continue
+		} else if ag.Archived || ag.AgreementTimedout != 0 {
+			if failedTermination(ag) {
+				return deviceHealth{state: deviceUnhealthy, reason: fmt.Sprintf("agreement %v terminated: %v", ag.CurrentAgreementId, ag.TerminatedDescription)}
+			}
+		} else if ag.AgreementFinalizedTime != 0 && (ag.DisableDataVerificationChecks || ag.DataNotificationSent != 0) {
+			health.state = deviceHealthy
+		}
+	}
+
+	if health.state == deviceHealthUnknown && wlu == nil {
+		health.reason = "device has no workload usage"
+	}
+	return health
+}
+
+// Move a rollout forward given the health of the devices being upgraded. Returns the devices to upgrade, the devices
+// to roll back and whether the rollout changed. The caller persists the rollout before acting on the devices.
+func advanceRollout(r *Rollout, health map[string]deviceHealth, now uint64) ([]RolloutDevice, []RolloutDevice, bool) {
+	upgrade := make([]RolloutDevice, 0)
+	rollback := make([]RolloutDevice, 0)
+
+	if r.State == ROLLOUT_ROLLING_BACK {
+		for ix, dev := range r.Devices {
+			if dev.State != ROLLOUT_DEVICE_PENDING && dev.State != ROLLOUT_DEVICE_ROLLED_BACK {
+				r.Devices[ix].State = ROLLOUT_DEVICE_ROLLED_BACK
+				rollback = append(rollback, dev)
+			}
+		}
+		r.State = ROLLOUT_ROLLED_BACK
+		r.EndTime = now
+		return upgrade, rollback, true
+	} else if r.State != ROLLOUT_RUNNING {
+		return upgrade, rollback, false
+	}
+
+	// Settle the devices in the current batch. A device fails as soon as it is unhealthy, and it has to be healthy by the
+	// end of the soak time to succeed.
+	changed := false
+	soaked := r.CurrentBatch >= 0 && now >= r.BatchStartTime+uint64(r.Plan.SoakTimeS)
+	inBatch, failed, upgrading := 0, 0, 0
+	for ix, dev := range r.Devices {
+		if dev.Batch != r.CurrentBatch {
+			continue
+		}
+		inBatch += 1
+
+		if dev.State == ROLLOUT_DEVICE_UPGRADING {
+			h := health[dev.DeviceId]
+			if h.state == deviceUnhealthy {
+				r.Devices[ix].State = ROLLOUT_DEVICE_FAILED
+				r.Devices[ix].Reason = h.reason
+				changed = true
+			} else if soaked && h.state == deviceHealthy {
+				r.Devices[ix].State = ROLLOUT_DEVICE_SUCCEEDED
+				changed = true
+			} else if soaked {
+				r.Devices[ix].State = ROLLOUT_DEVICE_FAILED
+				r.Devices[ix].Reason = "not healthy at the end of the soak time"
+				if h.reason != "" {
+					r.Devices[ix].Reason += ", " + h.reason
+				}
+				changed = true
+			} else {
+				upgrading += 1
+			}
+		}
+
+		if r.Devices[ix].State == ROLLOUT_DEVICE_FAILED {
+			failed += 1
+		}
+	}
+
+	// Stop the rollout when too many devices in the batch failed, unless the batch was accepted when the rollout was resumed.
+	if inBatch != 0 && r.CurrentBatch > r.AcceptedBatch && float64(failed)/float64(inBatch) > r.Plan.MaxFailureRatio {
+		r.Reason = fmt.Sprintf("%v of %v devices failed in batch %v", failed, inBatch, r.CurrentBatch)
+		if r.Plan.OnFailure == ROLLOUT_ON_FAILURE_ROLLBACK {
+			r.State = ROLLOUT_ROLLING_BACK
+			return advanceRollout(r, health, now)
+		}
+		r.State = ROLLOUT_PAUSED
+		return upgrade, rollback, true
+	}
+
+	if upgrading != 0 || (r.CurrentBatch >= 0 && !soaked) {
+		return upgrade, rollback, changed
+	} else if r.CurrentBatch == r.Batches-1 {
+		r.State = ROLLOUT_COMPLETED
+		r.EndTime = now
+		return upgrade, rollback, true
+	}
+
+	// Start the next batch.
+	r.CurrentBatch += 1
+	r.BatchStartTime = now
+	for ix, dev := range r.Devices {
+		if dev.Batch == r.CurrentBatch && dev.State == ROLLOUT_DEVICE_PENDING {
+			r.Devices[ix].State = ROLLOUT_DEVICE_UPGRADING
+			r.Devices[ix].UpgradeTime = now
+			upgrade = append(upgrade, r.Devices[ix])
+		}
+	}
+	return upgrade, rollback, true
+}
+
+// Govern the rollouts, upgrading the devices in each rollout batch by batch and rolling them back when the rollout fails.
+func (w *AgreementBotWorker) GovernRollouts() int {
+
+	rollouts, err := FindRollouts(w.db, []RolloutFilter{ActiveRolloutFilter()})
+	if err != nil {
+		glog.Errorf(logString(fmt.Sprintf("unable to read rollouts from database, error: %v", err)))
+		return 0
+	}
+
+	for _, r := range rollouts {
+		if r.State == ROLLOUT_PAUSED {
+			continue
+		}
+
+		// The health of the devices is read before the rollout is updated because the update holds the database.
+		health := make(map[string]deviceHealth)
+		for _, dev := range r.Devices {
+			if dev.State == ROLLOUT_DEVICE_UPGRADING {
+				health[dev.DeviceId] = w.rolloutDeviceHealth(&r, dev)
+			}
+		}
+
+		var upgrade, rollback []RolloutDevice
+		updated, err := RolloutUpdate(w.db, r.Id, func(current *Rollout) bool {
+			var changed bool
+			upgrade, rollback, changed = advanceRollout(current, health, uint64(time.Now().Unix()))
+			return changed
+		})
+		if err != nil {
+			glog.Errorf(logString(fmt.Sprintf("unable to update rollout %v, error: %v", r.Id, err)))
+			continue
+		}
+
+		for _, dev := range upgrade {
+			w.rolloutUpgradeDevice(updated, dev)
+		}
+		for _, dev := range rollback {
+			w.rolloutRollbackDevice(updated, dev)
+		}
+		if updated.State != r.State {
+			glog.V(3).Infof(logString(fmt.Sprintf("rollout %v of policy %v is %v. %v", r.Id, r.PolicyName, updated.State, updated.Reason)))
+		}
+	}
+	return 0
+}
+
+func (w *AgreementBotWorker) rolloutDeviceHealth(r *Rollout, dev RolloutDevice) deviceHealth {
+	wlu, err := FindSingleWorkloadUsageByDeviceAndPolicyName(w.db, dev.DeviceId, r.PolicyName)
+	if err != nil {
+		glog.Errorf(logString(fmt.Sprintf("unable to find workload usage record for %v with policy %v, error: %v", dev.DeviceId, r.PolicyName, err)))
+		return deviceHealth{state: deviceHealthUnknown}
+	}
+
+	agreements := make([]Agreement, 0)
+	for _, agp := range policy.AllAgreementProtocols() {
+		if ags, err := w.store.FindAgreements([]AFilter{DevPolAFilter(dev.DeviceId, r.PolicyName)}, agp); err != nil {
+			glog.Errorf(logString(fmt.Sprintf("unable to read agreements for %v with policy %v, error: %v", dev.DeviceId, r.PolicyName, err)))
+			return deviceHealth{state: deviceHealthUnknown}
+		} else {
+			agreements = append(agreements, ags...)
+		}
+	}
+
+	return evaluateDevice(dev, r.TargetPriority, wlu, agreements, w.failedTermination)
+}
+
+// An agreement terminated because of missing data or failed node health checks counts against a rollout.
+func (w *AgreementBotWorker) failedTermination(ag Agreement) bool {
+	cph, ok := w.consumerPH[ag.AgreementProtocol]
+	if !ok {
+		return false
+	}
+	for _, reason := range []string{TERM_REASON_NO_DATA_RECEIVED, TERM_REASON_NOT_FINALIZED_TIMEOUT, TERM_REASON_NODE_HEARTBEAT, TERM_REASON_AG_MISSING} {
+		if ag.TerminatedReason == cph.GetTerminationCode(reason) {
+			return true
+		}
+	}
+	return false
+}
+
+// Upgrade a device by moving its workload usage to the target priority and cancelling its agreement, so that the next
+// agreement is made with the target workload.
+func (w *AgreementBotWorker) rolloutUpgradeDevice(r *Rollout, dev RolloutDevice) {
+	glog.V(3).Infof(logString(fmt.Sprintf("rollout %v upgrading %v to workload priority %v", r.Id, dev.DeviceId, r.TargetPriority)))
+	if w.rolloutSetPriority(r, dev.DeviceId, r.TargetPriority) {
+		w.rolloutCancelAgreements(r, dev.DeviceId)
+	}
+}
+
+// Roll back a device to its previous priority. Rollback retries are disabled so that the device stays on the previous
+// workload rather than being moved back up to the higher priority workloads.
+func (w *AgreementBotWorker) rolloutRollbackDevice(r *Rollout, dev RolloutDevice) {
+	glog.V(3).Infof(logString(fmt.Sprintf("rollout %v rolling back %v to workload priority %v", r.Id, dev.DeviceId, dev.PreviousPriority)))
+	if w.rolloutSetPriority(r, dev.DeviceId, dev.PreviousPriority) {
+		if _, err := DisableRollbackChecking(w.db, dev.DeviceId, r.PolicyName); err != nil {
+			glog.Errorf(logString(fmt.Sprintf("unable to disable workload rollback retries for %v, error: %v", dev.DeviceId, err)))
+		}
+	}
+	w.rolloutCancelAgreements(r, dev.DeviceId)
+}
+
+func (w *AgreementBotWorker) rolloutSetPriority(r *Rollout, deviceId string, priority int) bool {
+	pol := w.pm.GetPolicy(r.Org, r.PolicyName)
+	if pol == nil {
+		glog.Errorf(logString(fmt.Sprintf("rollout %v unable to find policy %v in org %v", r.Id, r.PolicyName, r.Org)))
+		return false
+	}
+
+	for _, wl := range pol.Workloads {
+		if wl.Priority.PriorityValue != priority {
+			continue
+		} else if _, err := UpdatePriority(w.db, deviceId, r.PolicyName, priority, wl.Priority.RetryDurationS, wl.Priority.VerifiedDurationS, ""); err != nil {
+			glog.Errorf(logString(fmt.Sprintf("rollout %v unable to update workload priority of %v, error: %v", r.Id, deviceId, err)))
+			return false
+		}
+		return true
+	}
+
+	glog.Errorf(logString(fmt.Sprintf("rollout %v found no workload with priority %v in policy %v", r.Id, priority, r.PolicyName)))
+	return false
+}
+
+func (w *AgreementBotWorker) rolloutCancelAgreements(r *Rollout, deviceId string) {
+	for _, agp := range policy.AllAgreementProtocols() {
+		if ags, err := w.store.FindAgreements([]AFilter{DevPolAFilter(deviceId, r.PolicyName), UnarchivedAFilter()}, agp); err != nil {
+			glog.Errorf(logString(fmt.Sprintf("unable to read agreements for %v with policy %v, error: %v", deviceId, r.PolicyName, err)))
+		} else {
+			for _, ag := range ags {
+				if ag.AgreementTimedout == 0 {
+					w.TerminateAgreement(&ag, w.consumerPH[agp].GetTerminationCode(TERM_REASON_CANCEL_FORCED_UPGRADE))
+				}
+			}
+		}
+	}
+}
+
+// Apply an action requested through the API to a rollout. Resuming a paused rollout accepts the failures of the current
+// batch, the rollout moves on to the next batch once the current batch has soaked.
+func applyRolloutAction(r *Rollout, action string) error {
+	switch action {
+	case ROLLOUT_ACTION_PAUSE:
+		if r.State != ROLLOUT_RUNNING {
+			return errors.New(fmt.Sprintf("rollout %v is %v, only a running rollout can be paused", r.Id, r.State))
+		}
+		r.State = ROLLOUT_PAUSED
+		r.Reason = "paused by user"
+	case ROLLOUT_ACTION_RESUME:
+		if r.State != ROLLOUT_PAUSED {
+			return errors.New(fmt.Sprintf("rollout %v is %v, only a paused rollout can be resumed", r.Id, r.State))
+		}
+		r.State = ROLLOUT_RUNNING
+		r.AcceptedBatch = r.CurrentBatch
+		r.Reason = ""
+	case ROLLOUT_ACTION_ROLLBACK:
+		if r.State != ROLLOUT_RUNNING && r.State != ROLLOUT_PAUSED {
+			return errors.New(fmt.Sprintf("rollout %v is %v, only a running or paused rollout can be rolled back", r.Id, r.State))
+		}
+		r.State = ROLLOUT_ROLLING_BACK
+		r.Reason = "rolled back by user"
+	default:
+		return errors.New(fmt.Sprintf("unknown rollout action %v", action))
+	}
+	return nil
+}
@@ -0,0 +1,268 @@
+package agreementbot
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/golang/glog"
+	"github.com/open-horizon/anax/persistence"
+	"strconv"
+	"time"
+)
+
+const ROLLOUTS = "rollouts"
+
+// The states of a rollout.
+const ROLLOUT_RUNNING = "running"
+const ROLLOUT_PAUSED = "paused"
+const ROLLOUT_ROLLING_BACK = "rolling_back"
+const ROLLOUT_ROLLED_BACK = "rolled_back"
+const ROLLOUT_COMPLETED = "completed"
+
+// The states of a device in a rollout.
+const ROLLOUT_DEVICE_PENDING = "pending"
+const ROLLOUT_DEVICE_UPGRADING = "upgrading"
+const ROLLOUT_DEVICE_SUCCEEDED = "succeeded"
+const ROLLOUT_DEVICE_FAILED = "failed"
+const ROLLOUT_DEVICE_ROLLED_BACK = "rolled_back"
+
+// What a rollout does when too many devices in a batch fail.
+const ROLLOUT_ON_FAILURE_PAUSE = "pause"
+const ROLLOUT_ON_FAILURE_ROLLBACK = "rollback"
+
+// The actions that can be taken on a rollout through the API.
+const ROLLOUT_ACTION_PAUSE = "pause"
+const ROLLOUT_ACTION_RESUME = "resume"
+const ROLLOUT_ACTION_ROLLBACK = "rollback"
+
+// The plan of a rollout. The canary devices are upgraded first, as a batch of their own, then the other devices are
+// upgraded in batches of a percentage of all the devices. Each batch has to stay healthy for the soak time before the
+// next batch starts.
+type RolloutPlan struct {
+	Canary          []string `json:"canary"`            // the device ids upgraded in the first batch
+	BatchPercent    int      `json:"batch_percent"`     // the percentage of the devices upgraded in each batch after the canaries
+	SoakTimeS       int      `json:"soak_time"`         // the seconds a batch must stay healthy before the next batch starts
+	MaxFailureRatio float64  `json:"max_failure_ratio"` // the ratio of the devices in a batch that can fail before the rollout stops
+	OnFailure       string   `json:"on_failure"`        // pause or rollback, when too many devices fail
+}
+
+func (p RolloutPlan) String() string {
+	return fmt.Sprintf("Canary: %v, BatchPercent: %v, SoakTimeS: %v, MaxFailureRatio: %v, OnFailure: %v",
+		p.Canary, p.BatchPercent, p.SoakTimeS, p.MaxFailureRatio, p.OnFailure)
+}
+
+func (p *RolloutPlan) IsValid() (bool, string) {
+	if p.BatchPercent <= 0 || p.BatchPercent > 100 {
+		return false, "batch_percent must be between 1 and 100"
+	} else if p.SoakTimeS < 0 {
+		return false, "soak_time must not be negative"
+	} else if p.MaxFailureRatio < 0 || p.MaxFailureRatio > 1 {
+		return false, "max_failure_ratio must be between 0 and 1"
+	} else if p.OnFailure != ROLLOUT_ON_FAILURE_PAUSE && p.OnFailure != ROLLOUT_ON_FAILURE_ROLLBACK {
+		return false, fmt.Sprintf("on_failure must be %v or %v", ROLLOUT_ON_FAILURE_PAUSE, ROLLOUT_ON_FAILURE_ROLLBACK)
+	}
+	return true, ""
+}
+
+// A device that is upgraded by a rollout.
+type RolloutDevice struct {
+	DeviceId         string `json:"device_id"`
+	Batch            int    `json:"batch"`             // the batch the device is upgraded in, the canaries are in batch 0 when there are canaries
+	PreviousPriority int    `json:"previous_priority"` // the workload priority the device is rolled back to
+	State            string `json:"state"`
+	UpgradeTime      uint64 `json:"upgrade_time"` // the time the device was told to upgrade
+	Reason           string `json:"reason,omitempty"`
+}
+
+func (d RolloutDevice) String() string {
+	return fmt.Sprintf("DeviceId: %v, Batch: %v, PreviousPriority: %v, State: %v, UpgradeTime: %v, Reason: %v",
+		d.DeviceId, d.Batch, d.PreviousPriority, d.State, d.UpgradeTime, d.Reason)
+}
+
+// A staged rollout of a workload priority to the devices that have agreements from a policy.
+type Rollout struct {
+	Id             uint64          `json:"record_id"` // unique primary key for records
+	Org            string          `json:"org"`
+	PolicyName     string          `json:"policy_name"`
+	TargetPriority int             `json:"target_priority"` // the priority of the workload the devices are upgraded to
+	Plan           RolloutPlan     `json:"plan"`
+	State          string          `json:"state"`
+	Batches        int             `json:"batches"`          // the number of batches
+	CurrentBatch   int             `json:"current_batch"`    // the batch being upgraded
+	AcceptedBatch  int             `json:"accepted_batch"`   // the last batch whose failures were accepted by resuming the rollout
+	BatchStartTime uint64          `json:"batch_start_time"` // the time the current batch started
+	StartTime      uint64          `json:"start_time"`
+	EndTime        uint64          `json:"end_time"`
+	Reason         string          `json:"reason,omitempty"` // why the rollout was paused or rolled back
+	Devices        []RolloutDevice `json:"devices"`
+}
+
+func (r Rollout) String() string {
+	return fmt.Sprintf("Id: %v, Org: %v, PolicyName: %v, TargetPriority: %v, Plan: %v, State: %v, Batches: %v, CurrentBatch: %v, AcceptedBatch: %v, BatchStartTime: %v, StartTime: %v, EndTime: %v, Reason: %v, Devices: %v",
+		r.Id, r.Org, r.PolicyName, r.TargetPriority, r.Plan, r.State, r.Batches, r.CurrentBatch, r.AcceptedBatch, r.BatchStartTime, r.StartTime, r.EndTime, r.Reason, r.Devices)
+}
+
+// The rollout is still upgrading devices, or can be resumed.
+func (r Rollout) IsActive() bool {
+	return r.State == ROLLOUT_RUNNING || r.State == ROLLOUT_PAUSED || r.State == ROLLOUT_ROLLING_BACK
+}
+
+// Create a rollout of the target priority to the given devices. The devices and their current priorities come from
+// their workload usage records. The batches keep some members of each group up, see planBatches.
+func NewRollout(db persistence.Store, org string, policyName string, targetPriority int, plan RolloutPlan, usages []WorkloadUsage, groups []rolloutGroup) (*Rollout, error) {
+	if existing, err := FindRollouts(db, []RolloutFilter{ActiveRolloutFilter(), PolicyRolloutFilter(org, policyName)}); err != nil {
+		return nil, err
+	} else if len(existing) != 0 {
+		return nil, errors.New(fmt.Sprintf("rollout %v of policy %v is still %v", existing[0].Id, policyName, existing[0].State))
+	}
+
+	deviceIds := make([]string, 0, len(usages))
+	previous := make(map[string]int)
+	for _, wlu := range usages {
+		if wlu.Priority != targetPriority {
+			deviceIds = append(deviceIds, wlu.DeviceId)
+			previous[wlu.DeviceId] = wlu.Priority
+		}
+	}
+	if len(deviceIds) == 0 {
+		return nil, errors.New(fmt.Sprintf("no devices with policy %v need to be upgraded to priority %v", policyName, targetPriority))
+	}
+
+	batches := planBatches(deviceIds, plan.Canary, plan.BatchPercent, groups)
+	r := &Rollout{
+		Org:            org,
+		PolicyName:     policyName,
+		TargetPriority: targetPriority,
+		Plan:           plan,
+		State:          ROLLOUT_RUNNING,
+		Batches:        len(batches),
+		CurrentBatch:   -1,
+		AcceptedBatch:  -1,
+		StartTime:      uint64(time.Now().Unix()),
+		Devices:        make([]RolloutDevice, 0, len(deviceIds)),
+	}
+	for ix, batch := range batches {
+		for _, deviceId := range batch {
+			r.Devices = append(r.Devices, RolloutDevice{
+				DeviceId:         deviceId,
+				Batch:            ix,
+				PreviousPriority: previous[deviceId],
+				State:            ROLLOUT_DEVICE_PENDING,
+			})
+		}
+	}
+
+	if err := rolloutPersistNew(db, r); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// Update a rollout in a single transaction. The update function returns false when it decides not to change the
+// rollout, e.g. because its state was changed through the API since it was read.
+func RolloutUpdate(db persistence.Store, id uint64, fn func(r *Rollout) bool) (*Rollout, error) {
+	var updated *Rollout
+	err := db.Update(func(tx persistence.Tx) error {
+		b, err := tx.CreateBucketIfNotExists([]byte(ROLLOUTS))
+		if err != nil {
+			return err
+		}
+
+		pKey := strconv.FormatUint(id, 10)
+		current := b.Get([]byte(pKey))
+		if current == nil {
+			return errors.New(fmt.Sprintf("no rollout with id %v", id))
+		}
+
+		var r Rollout
+		if err := json.Unmarshal(current, &r); err != nil {
+			return errors.New(fmt.Sprintf("failed to unmarshal rollout DB data: %v", string(current)))
+		} else if !fn(&r) {
+			updated = &r
+			return nil
+		} else if serialized, err := json.Marshal(r); err != nil {
+			return errors.New(fmt.Sprintf("failed to serialize rollout record: %v", r))
+		} else if err := b.Put([]byte(pKey), serialized); err != nil {
+			return errors.New(fmt.Sprintf("failed to write rollout record with key: %v", pKey))
+		}
+
+		glog.V(5).Infof("Succeeded updating rollout record to %v", r)
+		updated = &r
+		return nil
+	})
+	return updated, err
+}
+
+func FindSingleRollout(db persistence.Store, id uint64) (*Rollout, error) {
+	if rollouts, err := FindRollouts(db, []RolloutFilter{IdRolloutFilter(id)}); err != nil {
+		return nil, err
+	} else if len(rollouts) == 0 {
+		return nil, nil
+	} else {
+		return &rollouts[0], nil
+	}
+}
+
+type RolloutFilter func(Rollout) bool
+
+func IdRolloutFilter(id uint64) RolloutFilter {
+	return func(r Rollout) bool { return r.Id == id }
+}
+
+func ActiveRolloutFilter() RolloutFilter {
+	return func(r Rollout) bool { return r.IsActive() }
+}
+
+func PolicyRolloutFilter(org string, policyName string) RolloutFilter {
+	return func(r Rollout) bool { return r.Org == org && r.PolicyName == policyName }
+}
+
+func FindRollouts(db persistence.Store, filters []RolloutFilter) ([]Rollout, error) {
+	rollouts := make([]Rollout, 0)
+
+	readErr := db.View(func(tx persistence.Tx) error {
+		if b := tx.Bucket([]byte(ROLLOUTS)); b != nil {
+			b.ForEach(func(k, v []byte) error {
+				var r Rollout
+				if err := json.Unmarshal(v, &r); err != nil {
+					glog.Errorf("Unable to deserialize rollout db record: %v", v)
+					return nil
+				}
+				for _, filterFn := range filters {
+					if !filterFn(r) {
+						return nil
+					}
+				}
+				rollouts = append(rollouts, r)
+				return nil
+			})
+		}
+		return nil // end the transaction
+	})
+
+	if readErr != nil {
+		return nil, readErr
+	}
+	return rollouts, nil
+}
+
+// The primary key of a new rollout comes from the sequence counter of the bucket.
+func rolloutPersistNew(db persistence.Store, r *Rollout) error {
+	return db.Update(func(tx persistence.Tx) error {
+		if b, err := tx.CreateBucketIfNotExists([]byte(ROLLOUTS)); err != nil {
+			return err
+		} else if nextKey, err := b.NextSequence(); err != nil {
+			return errors.New(fmt.Sprintf("unable to get sequence key for new rollout %v. Error: %v", r, err))
+		} else {
+			r.Id = nextKey
+			strKey := strconv.FormatUint(nextKey, 10)
+			if bytes, err := json.Marshal(r); err != nil {
+				return errors.New(fmt.Sprintf("unable to serialize rollout %v. Error: %v", r, err))
+			} else if err := b.Put([]byte(strKey), bytes); err != nil {
+				return errors.New(fmt.Sprintf("unable to write rollout to bucket %v. Primary key of record: %v", ROLLOUTS, strKey))
+			}
+			glog.V(2).Infof("Succeeded writing rollout record identified by key %v, record %v", strKey, *r)
+			return nil
+		}
+	})
+}
@@ -0,0 +1,140 @@
+// +build unit
+
+package agreementbot
+
+import (
+	"testing"
+)
+
+func Test_planBatches(t *testing.T) {
+	devices := []string{"org/d1", "org/d2", "org/d3", "org/d4", "org/d5", "org/d6", "org/d7"}
+
+	// Canaries that are not in the rollout are ignored, the rest of the devices go in batches of 30% of all the devices.
+	batches := planBatches(devices, []string{"org/d4", "org/other", "org/d4"}, 30, nil)
+	if len(batches) != 3 {
+		t.Fatalf("expected 3 batches, got %v", batches)
+	} else if len(batches[0]) != 1 || batches[0][0] != "org/d4" {
+		t.Errorf("expected the canary batch to be org/d4, got %v", batches[0])
+	} else if len(batches[1]) != 3 || batches[1][0] != "org/d1" || batches[1][2] != "org/d3" {
+		t.Errorf("expected the second batch to be org/d1 to org/d3, got %v", batches[1])
+	} else if len(batches[2]) != 3 || batches[2][0] != "org/d5" {
+		t.Errorf("expected the last batch to be org/d5 to org/d7, got %v", batches[2])
+	}
+
+	// Every batch has at least one device.
+	if batches := planBatches(devices[:3], nil, 1, nil); len(batches) != 3 {
+		t.Errorf("expected a batch per device, got %v", batches)
+	} else if batches := planBatches(devices, nil, 100, nil); len(batches) != 1 || len(batches[0]) != 7 {
+		t.Errorf("expected a single batch, got %v", batches)
+	}
+}
+
+func Test_evaluateDevice(t *testing.T) {
+	dev := RolloutDevice{DeviceId: "org/d1", State: ROLLOUT_DEVICE_UPGRADING, UpgradeTime: 100}
+	wlu := &WorkloadUsage{DeviceId: "org/d1", Priority: 2}
+	noData := func(ag Agreement) bool { return ag.TerminatedReason == 1 }
+
+	old := Agreement{CurrentAgreementId: "a0", AgreementInceptionTime: 50, Archived: true, TerminatedReason: 1}
+	pending := Agreement{CurrentAgreementId: "a1", AgreementInceptionTime: 110, AgreementFinalizedTime: 120}
+	verified := Agreement{CurrentAgreementId: "a2", AgreementInceptionTime: 110, AgreementFinalizedTime: 120, DataNotificationSent: 130}
+	failed := Agreement{CurrentAgreementId: "a3", AgreementInceptionTime: 110, Archived: true, TerminatedReason: 1}
+	cancelled := Agreement{CurrentAgreementId: "a4", AgreementInceptionTime: 110, Archived: true, TerminatedReason: 2}
+
+	if h := evaluateDevice(dev, 2, wlu, []Agreement{old, pending}, noData); h.state != deviceHealthUnknown {
+		t.Errorf("expected the health to be unknown before data is verified, got %v", h)
+	} else if h := evaluateDevice(dev, 2, wlu, []Agreement{old, cancelled, verified}, noData); h.state != deviceHealthy {
+		t.Errorf("expected the device to be healthy once data is verified, got %v", h)
+	} else if h := evaluateDevice(dev, 2, wlu, []Agreement{failed, verified}, noData); h.state != deviceUnhealthy {
+		t.Errorf("expected the device to be unhealthy after an agreement failed, got %v", h)
+	} else if h := evaluateDevice(dev, 3, wlu, []Agreement{verified}, noData); h.state != deviceUnhealthy {
+		t.Errorf("expected the device to be unhealthy when it moved off the target priority, got %v", h)
+	}
+
+	pending.DisableDataVerificationChecks = true
+	if h := evaluateDevice(dev, 2, nil, []Agreement{pending}, noData); h.state != deviceHealthy {
+		t.Errorf("expected the device to be healthy without data verification, got %v", h)
+	}
+}
+
+func Test_advanceRollout(t *testing.T) {
+	newRollout := func(onFailure string) *Rollout {
+		r := &Rollout{
+			Id:             1,
+			TargetPriority: 1,
+			Plan:           RolloutPlan{BatchPercent: 50, SoakTimeS: 60, MaxFailureRatio: 0, OnFailure: onFailure},
+			State:          ROLLOUT_RUNNING,
+			CurrentBatch:   -1,
+			AcceptedBatch:  -1,
+		}
+		for ix, batch := range planBatches([]string{"d1", "d2", "d3", "d4"}, []string{"d3"}, 50, nil) {
+			for _, id := range batch {
+				r.Devices = append(r.Devices, RolloutDevice{DeviceId: id, Batch: ix, PreviousPriority: 2, State: ROLLOUT_DEVICE_PENDING})
+			}
+			r.Batches += 1
+		}
+		return r
+	}
+	healthy := map[string]deviceHealth{"d1": {state: deviceHealthy}, "d2": {state: deviceHealthy}, "d3": {state: deviceHealthy}, "d4": {state: deviceHealthy}}
+
+	// The canary is upgraded first and the next batch waits for the soak time.
+	r := newRollout(ROLLOUT_ON_FAILURE_PAUSE)
+	if upgrade, _, changed := advanceRollout(r, healthy, 1000); !changed || len(upgrade) != 1 || upgrade[0].DeviceId != "d3" {
+		t.Fatalf("expected the canary to be upgraded, got %v", upgrade)
+	} else if upgrade, _, changed := advanceRollout(r, healthy, 1030); changed || len(upgrade) != 0 {
+		t.Errorf("expected the canary batch to soak, got %v", upgrade)
+	} else if upgrade, _, _ := advanceRollout(r, healthy, 1060); len(upgrade) != 2 || r.Devices[0].State != ROLLOUT_DEVICE_SUCCEEDED {
+		t.Errorf("expected the canary to succeed and the next batch to be upgraded, got %v", r)
+	} else if upgrade, _, _ := advanceRollout(r, healthy, 1120); len(upgrade) != 1 || upgrade[0].DeviceId != "d4" {
+		t.Errorf("expected the last batch to be upgraded, got %v", upgrade)
+	} else if advanceRollout(r, healthy, 1180); r.State != ROLLOUT_COMPLETED {
+		t.Errorf("expected the rollout to complete, got %v", r)
+	}
+
+	// A failed canary pauses the rollout until it is resumed, which accepts the failure.
+	r = newRollout(ROLLOUT_ON_FAILURE_PAUSE)
+	advanceRollout(r, healthy, 1000)
+	if advanceRollout(r, map[string]deviceHealth{"d3": {state: deviceUnhealthy, reason: "no data"}}, 1010); r.State != ROLLOUT_PAUSED || r.Devices[0].State != ROLLOUT_DEVICE_FAILED {
+		t.Fatalf("expected the rollout to pause, got %v", r)
+	} else if err := applyRolloutAction(r, ROLLOUT_ACTION_PAUSE); err == nil {
+		t.Errorf("expected a paused rollout not to be paused again")
+	} else if err := applyRolloutAction(r, ROLLOUT_ACTION_RESUME); err != nil {
+		t.Fatal(err)
+	} else if upgrade, _, _ := advanceRollout(r, healthy, 1060); r.State != ROLLOUT_RUNNING || len(upgrade) != 2 {
+		t.Errorf("expected the resumed rollout to move to the next batch, got %v", r)
+	}
+
+	// A device that is not healthy by the end of the soak time rolls back every upgraded device.
+	r = newRollout(ROLLOUT_ON_FAILURE_ROLLBACK)
+	advanceRollout(r, healthy, 1000)
+	advanceRollout(r, healthy, 1060)
+	if _, rollback, _ := advanceRollout(r, map[string]deviceHealth{"d1": {state: deviceHealthy}}, 1120); r.State != ROLLOUT_ROLLED_BACK || len(rollback) != 3 {
+		t.Errorf("expected the rollout to roll back 3 devices, got %v", r)
+	} else if r.Devices[3].State != ROLLOUT_DEVICE_PENDING {
+		t.Errorf("expected the last batch not to be touched, got %v", r.Devices[3])
+	}
+}
+
+func Test_planBatches_groups(t *testing.T) {
+	devices := []string{"org/d1", "org/d2", "org/d3", "org/d4", "org/d5", "org/d6"}
+	groups := []rolloutGroup{
+		{members: []string{"org/d1", "org/d2", "org/d3"}, keepUp: 1},
+		{members: []string{"org/d4", "org/d5"}, keepUp: 1},
+		{members: []string{"org/d6"}, keepUp: 1},
+	}
+
+	// The group members beyond what a batch may take down move to the next batch, and a group of 1 is still upgraded.
+	batches := planBatches(devices, nil, 100, groups)
+	if len(batches) != 2 {
+		t.Fatalf("expected 2 batches, got %v", batches)
+	} else if len(batches[0]) != 4 || batches[0][2] != "org/d4" || batches[0][3] != "org/d6" {
+		t.Errorf("expected the first batch to be org/d1, org/d2, org/d4 and org/d6, got %v", batches[0])
+	} else if len(batches[1]) != 2 || batches[1][0] != "org/d5" || batches[1][1] != "org/d3" {
+		t.Errorf("expected the second batch to be org/d5 and org/d3, got %v", batches[1])
+	}
+
+	// Moved devices can push a later batch over its limit too.
+	batches = planBatches(devices[:3], nil, 100, []rolloutGroup{{members: devices[:3], keepUp: 2}})
+	if len(batches) != 3 || len(batches[0]) != 1 || len(batches[1]) != 1 || len(batches[2]) != 1 {
+		t.Errorf("expected a batch per device, got %v", batches)
+	}
+}
@@ -0,0 +1,252 @@
+package agreementbot
+
+import (
+	"fmt"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// The Search scheduler decides when the agbot searches the exchange for the nodes of each of its policies. Instead of
+// asking for every matching node on each pass through the main loop, the agbot searches each policy in passes that
+// read the matching nodes a page at a time, and remembers where it is in the search with a cursor. The pages of a pass
+// are read one after the other on a goroutine of their own, so that a policy with a lot of nodes doesnt hold up the
+// main loop, and a policy has at most one pass in progress. When a pass through all the pages is done, the next pass
+// of the policy is scheduled one search interval later, plus a random jitter so that the policies of the agbot (and
+// the agbots serving the same patterns) dont all search at the same moment. When a page cant be read, the pass stops
+// and carries on from the cursor one search interval later.
+//
+// The exchange returns the nodes in id order, and the cursor is the id of the last node of the previous page. The
+// nodes that the agbot makes agreements with drop out of the search results while a pass is in progress, so a cursor
+// that counted the nodes already read would skip over nodes that have not been read yet.
+//
+// The compatible nodes found on the pages of a pass are kept until the pass is done, and then ranked and proposed to
+// together, so that the placement preferences, the spread constraints and the max agreements of a policy pick from
+// all the nodes of the search rather than from each page on its own.
+//
+// Most passes only ask the exchange for nodes that registered or came back to life since the previous pass started.
+// Every full search interval, a pass asks for all the matching nodes again, which picks up any node that an earlier
+// pass missed. A node whose agreement ended keeps heartbeating, so it is not a changed node, and the next pass of its
+// policy after an agreement ends is a full pass.
+//
+// An exchange that is older than the paging support ignores the cursor and the changed since time, and returns the
+// same first nodes for every page. Until the agbot learns that the exchange supports paging, each pass is a single
+// search for all the nodes, the same as before paging. A pass also ends when a full page has no node after the
+// cursor, so that an exchange that ignores the cursor cannot keep a pass going forever.
+
+// The jitter added to the search interval, as a percentage of the interval.
+const SEARCH_JITTER_PERCENT = 20
+
+// The page of nodes to read from the exchange for a policy.
+type SearchPage struct {
+	StartAfter   string        // Only return nodes whose id sorts after this id, empty for the first page
+	NumEntries   int           // The maximum number of nodes to return
+	ChangedSince int64         // Only return nodes that changed since this time, zero for all the nodes
+	key          string        // The key of the search that the page belongs to
+	search       *policySearch // The search that the page belongs to
+}
+
+func (p SearchPage) String() string {
+	return fmt.Sprintf("StartAfter: %v, NumEntries: %v, ChangedSince: %v", p.StartAfter, p.NumEntries, p.ChangedSince)
+}
+
+type policySearch struct {
+	nextSearch   int64                 // The time when the next page of this policy is due
+	passStart    int64                 // The time when the current pass started, zero when there is no pass in progress
+	cursor       string                // The id of the last node read in the current pass
+	changedSince int64                 // The changed since time of the current pass, zero for a full pass
+	lastPass     int64                 // The start time of the last completed pass
+	lastFullPass int64                 // The start time of the last completed full pass
+	fullPassDue  bool                  // True when an agreement ended, so the next pass is a full pass
+	running      bool                  // True while the pages of the current pass are being read
+	candidates   []*placementCandidate // The compatible nodes found so far in the current pass
+}
+
+func (s *policySearch) String() string {
+	return fmt.Sprintf("NextSearch: %v, PassStart: %v, Cursor: %v, ChangedSince: %v, LastPass: %v, LastFullPass: %v, FullPassDue: %v, Running: %v, Candidates: %v",
+		s.nextSearch, s.passStart, s.cursor, s.changedSince, s.lastPass, s.lastFullPass, s.fullPassDue, s.running, len(s.candidates))
+}
+
+type SearchScheduler struct {
+	lock          sync.Mutex
+	intervalS     int                      // The number of seconds between passes of a policy
+	fullIntervalS int                      // The number of seconds between full passes of a policy
+	pageSize      int                      // The number of nodes in a page
+	paging        bool                     // True when the exchange can page through the searches
+	random        *rand.Rand               // Source of the jitter
+	searches      map[string]*policySearch // The searches, keyed by org and policy name
+}
+
+func NewSearchScheduler(intervalS int, fullIntervalS int, pageSize int) *SearchScheduler {
+	s := &SearchScheduler{
+		intervalS:     intervalS,
+		fullIntervalS: fullIntervalS,
+		pageSize:      pageSize,
+		random:        rand.New(rand.NewSource(time.Now().UnixNano())),
+		searches:      make(map[string]*policySearch),
+	}
+	return s
+}
+
+func (s *SearchScheduler) String() string {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return fmt.Sprintf("Interval: %v, Full Interval: %v, Page Size: %v, Paging: %v, Searches: %v", s.intervalS, s.fullIntervalS, s.pageSize, s.paging, s.searches)
+}
+
+// Set whether the exchange can page through the searches. Returns true when the setting changed.
+func (s *SearchScheduler) SetPaging(paging bool) bool {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if s.paging == paging {
+		return false
+	}
+	s.paging = paging
+	return true
+}
+
+// Return the first page to read for the policy, and true when a pass of the policy is due. The rest of the pages of
+// the pass are returned by PageDone. A new policy is first searched within the jitter of the interval.
+func (s *SearchScheduler) Next(org string, policyName string, now int64) (*SearchPage, bool) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	key := searchKey(org, policyName)
+	search, ok := s.searches[key]
+	if !ok {
+		search = &policySearch{nextSearch: now + s.jitter()}
+		s.searches[key] = search
+	}
+
+	if search.running || search.nextSearch > now {
+		return nil, false
+	}
+
+	// Start a new pass. It is a full pass when there hasnt been one for the full search interval, or when an
+	// agreement of the policy ended.
+	if search.passStart == 0 {
+		search.passStart = now
+		search.cursor = ""
+		if search.lastFullPass == 0 || search.fullPassDue || now-search.lastFullPass >= int64(s.fullIntervalS) {
+			search.changedSince = 0
+		} else {
+			search.changedSince = search.lastPass
+		}
+		search.fullPassDue = false
+	}
+
+	search.running = true
+	return s.page(key, search), true
+}
+
+// The caller must hold the lock.
+func (s *SearchScheduler) page(key string, search *policySearch) *SearchPage {
+
+	// Without paging, the whole pass is one search for all the nodes.
+	if !s.paging {
+		search.cursor = ""
+		search.changedSince = 0
+		return &SearchPage{key: key, search: search}
+	}
+
+	return &SearchPage{StartAfter: search.cursor, NumEntries: s.pageSize, ChangedSince: search.changedSince, key: key, search: search}
+}
+
+// Returns true when the page belongs to the pass that is in progress. The caller must hold the lock.
+func (s *SearchScheduler) current(page *SearchPage) bool {
+	return page != nil && s.searches[page.key] == page.search && page.search.running
+}
+
+// Record that a page returned the nodes with the given ids, of which the candidates are compatible with the policy. A
+// full page with nodes after the cursor means that there might be more nodes, so the next page, after the last of
+// these nodes, is returned to be read right away. Otherwise the pass is done, the next one is scheduled and the
+// candidates of all the pages of the pass are returned. Nothing is returned when the policy was reset or forgotten
+// while the page was read.
+func (s *SearchScheduler) PageDone(page *SearchPage, ids []string, candidates []*placementCandidate, now int64) (*SearchPage, []*placementCandidate) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if !s.current(page) {
+		return nil, nil
+	}
+	search := page.search
+
+	search.candidates = append(search.candidates, candidates...)
+	if s.paging && len(ids) >= s.pageSize {
+		cursor := search.cursor
+		for _, id := range ids {
+			if id > search.cursor {
+				search.cursor = id
+			}
+		}
+		if search.cursor != cursor {
+			return s.page(page.key, search), nil
+		}
+	}
+
+	found := search.candidates
+	search.candidates = nil
+
+	search.lastPass = search.passStart
+	if search.changedSince == 0 {
+		search.lastFullPass = search.passStart
+	}
+	search.passStart = 0
+	search.cursor = ""
+	search.running = false
+	search.nextSearch = now + int64(s.intervalS) + s.jitter()
+	return nil, found
+}
+
+// Record that a page could not be read. The pass stops, and the same page is tried again after the search interval.
+func (s *SearchScheduler) PageFailed(page *SearchPage, now int64) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if s.current(page) {
+		page.search.running = false
+		page.search.nextSearch = now + int64(s.intervalS) + s.jitter()
+	}
+}
+
+// Record that an agreement of the policy ended, so that the next pass of the policy is a full pass that finds the
+// node of the agreement again.
+func (s *SearchScheduler) AgreementEnded(org string, policyName string) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if search, ok := s.searches[searchKey(org, policyName)]; ok {
+		search.fullPassDue = true
+	}
+}
+
+// Forget the search of the policy, so that it starts over with a full pass. Used when the policy changes.
+func (s *SearchScheduler) Reset(org string, policyName string) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	delete(s.searches, searchKey(org, policyName))
+}
+
+// Forget the searches of policies that the agbot no longer has. The input is the set of keys of the current policies.
+func (s *SearchScheduler) Retain(keys map[string]bool) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	for key, _ := range s.searches {
+		if !keys[key] {
+			delete(s.searches, key)
+		}
+	}
+}
+
+// The caller must hold the lock.
+func (s *SearchScheduler) jitter() int64 {
+	if maxJitter := s.intervalS * SEARCH_JITTER_PERCENT / 100; maxJitter > 0 {
+		return s.random.Int63n(int64(maxJitter) + 1)
+	}
+	return 0
+}
+
+func searchKey(org string, policyName string) string {
+	return org + "/" + policyName
+}
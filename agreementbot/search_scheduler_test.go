@@ -0,0 +1,244 @@
+// +build unit
+
+package agreementbot
+
+import (
+	"fmt"
+	"github.com/open-horizon/anax/exchange"
+	"github.com/open-horizon/anax/policy"
+	"testing"
+)
+
+// The ids of the given number of nodes, starting at the given node, in the order the exchange returns them.
+func nodeIds(first int, count int) []string {
+	ids := make([]string, 0, count)
+	for i := first; i < first+count; i++ {
+		ids = append(ids, fmt.Sprintf("myorg/node%04d", i))
+	}
+	return ids
+}
+
+func Test_SearchScheduler_paging(t *testing.T) {
+	s := NewSearchScheduler(10, 100, 50)
+	s.SetPaging(true)
+
+	// A new policy is searched within the jitter of the interval.
+	s.Next("myorg", "pol0", 1000)
+	if next := s.searches[searchKey("myorg", "pol0")].nextSearch; next < 1000 || next > 1002 {
+		t.Errorf("expected the first search within the jitter, got %v", next)
+	}
+
+	s.searches[searchKey("myorg", "pol1")] = &policySearch{nextSearch: 1002}
+	page, due := s.Next("myorg", "pol1", 1002)
+	if !due {
+		t.Fatalf("expected a new policy to be searched within the jitter")
+	} else if page.StartAfter != "" || page.NumEntries != 50 || page.ChangedSince != 0 {
+		t.Errorf("expected the first page of a full pass, got %v", page)
+	}
+
+	// While the pages of a pass are read, no other pass of the policy starts.
+	if _, due := s.Next("myorg", "pol1", 1002); due {
+		t.Errorf("expected no second pass while the pass is in progress")
+	}
+
+	// Full pages move the cursor past their last node, and the next page is read right away.
+	if page, _ = s.PageDone(page, nodeIds(0, 50), nil, 1002); page == nil || page.StartAfter != "myorg/node0049" || page.ChangedSince != 0 {
+		t.Errorf("expected the second page of the full pass, got %v", page)
+	}
+
+	// A short page ends the pass and the next one waits for the interval.
+	if page, _ = s.PageDone(page, nodeIds(50, 20), nil, 1003); page != nil {
+		t.Errorf("expected the pass to be done, got %v", page)
+	} else if _, due := s.Next("myorg", "pol1", 1012); due {
+		t.Errorf("expected the policy to wait for the search interval")
+	}
+
+	// The passes in between full passes only look for nodes that changed since the last pass started.
+	if page, due = s.Next("myorg", "pol1", 1015); !due || page.StartAfter != "" || page.ChangedSince != 1002 {
+		t.Errorf("expected a changed since pass, got %v %v", page, due)
+	}
+	s.PageDone(page, nil, nil, 1015)
+	if page, due = s.Next("myorg", "pol1", 1030); !due || page.ChangedSince != 1015 {
+		t.Errorf("expected a changed since pass, got %v %v", page, due)
+	}
+	s.PageDone(page, nil, nil, 1030)
+
+	// Once the full search interval has passed, all the nodes are searched again.
+	if page, due := s.Next("myorg", "pol1", 1110); !due || page.ChangedSince != 0 {
+		t.Errorf("expected a full pass, got %v %v", page, due)
+	}
+}
+
+// The nodes that get agreements drop out of the search results during a pass, the pages that follow must not skip the
+// nodes that moved up in the results.
+func Test_SearchScheduler_shrinking(t *testing.T) {
+	s := NewSearchScheduler(10, 100, 50)
+	s.SetPaging(true)
+	s.searches[searchKey("myorg", "pol1")] = &policySearch{nextSearch: 1000}
+
+	nodes := nodeIds(0, 120)
+	read := make(map[string]bool)
+	page, _ := s.Next("myorg", "pol1", 1000)
+	for pages := 0; page != nil && pages < 10; pages++ {
+
+		// The exchange returns the nodes after the cursor that dont have an agreement yet.
+		results := make([]string, 0, page.NumEntries)
+		for _, id := range nodes {
+			if id > page.StartAfter && !read[id] && len(results) < page.NumEntries {
+				results = append(results, id)
+			}
+		}
+		for _, id := range results {
+			read[id] = true
+		}
+		page, _ = s.PageDone(page, results, nil, 1000)
+	}
+
+	if len(read) != len(nodes) {
+		t.Errorf("expected all %v nodes to be read in one pass, read %v", len(nodes), len(read))
+	}
+}
+
+// The candidates of a pass are handed back together when the pass is done, so that the best node of a later page is
+// ranked ahead of the nodes of the first page.
+func Test_SearchScheduler_candidates(t *testing.T) {
+	s := NewSearchScheduler(10, 100, 2)
+	s.SetPaging(true)
+	s.searches[searchKey("myorg", "pol1")] = &policySearch{nextSearch: 1000}
+
+	candidate := func(id string, cpus string) *placementCandidate {
+		pol := policy.Policy_Factory(id)
+		pol.Properties = append(pol.Properties, *policy.Property_Factory("cpus", cpus))
+		return &placementCandidate{device: exchange.SearchResultDevice{Id: id}, nodePolicy: pol}
+	}
+
+	page, _ := s.Next("myorg", "pol1", 1000)
+	page, found := s.PageDone(page, []string{"myorg/node1", "myorg/node2"}, []*placementCandidate{candidate("myorg/node1", "1"), candidate("myorg/node2", "2")}, 1000)
+	if page == nil || found != nil {
+		t.Fatalf("expected no candidates before the pass is done, got %v %v", page, found)
+	}
+
+	// A failed page keeps the candidates that were found already.
+	s.PageFailed(page, 1001)
+	page, _ = s.Next("myorg", "pol1", 1015)
+	page, found = s.PageDone(page, []string{"myorg/node3"}, []*placementCandidate{candidate("myorg/node3", "8")}, 1015)
+	if page != nil || len(found) != 3 {
+		t.Fatalf("expected the candidates of all the pages at the end of the pass, got %v %v", page, found)
+	}
+
+	scoreCandidates(policy.Placement{{Kind: policy.PLACEMENT_PROPERTY, Property: "cpus"}}, found)
+	if found[0].device.Id != "myorg/node3" {
+		t.Errorf("expected the best node of the pass first, got %v", found)
+	}
+
+	// The next pass starts without candidates.
+	page, _ = s.Next("myorg", "pol1", 1040)
+	if page, found := s.PageDone(page, nil, nil, 1040); page != nil || len(found) != 0 {
+		t.Errorf("expected no candidates in an empty pass, got %v %v", page, found)
+	}
+}
+
+func Test_SearchScheduler_failures(t *testing.T) {
+	s := NewSearchScheduler(10, 100, 50)
+	s.SetPaging(true)
+	s.Next("myorg", "pol1", 1000)
+	page, _ := s.Next("myorg", "pol1", 1002)
+	page, _ = s.PageDone(page, nodeIds(0, 50), nil, 1002)
+
+	// A failed page is tried again after the interval.
+	s.PageFailed(page, 1003)
+	if _, due := s.Next("myorg", "pol1", 1005); due {
+		t.Errorf("expected the failed page to wait for the search interval")
+	} else if page, due = s.Next("myorg", "pol1", 1015); !due || page.StartAfter != "myorg/node0049" {
+		t.Errorf("expected the failed page to be tried again, got %v %v", page, due)
+	}
+
+	// A reset policy starts over with a full pass, and the pages of the pass that was in progress are ignored.
+	s.Reset("myorg", "pol1")
+	if next, due := s.Next("myorg", "pol1", 1020); due && next.StartAfter != "" {
+		t.Errorf("expected a reset policy to start over, got %v", next)
+	}
+	if next, found := s.PageDone(page, nodeIds(50, 50), nil, 1020); next != nil || found != nil {
+		t.Errorf("expected the page of the old pass to be ignored, got %v %v", next, found)
+	}
+
+	// Policies that are not retained are forgotten.
+	s.Next("myorg", "pol2", 1020)
+	s.Retain(map[string]bool{searchKey("myorg", "pol2"): true})
+	if _, ok := s.searches[searchKey("myorg", "pol1")]; ok {
+		t.Errorf("expected pol1 to be forgotten")
+	} else if _, ok := s.searches[searchKey("myorg", "pol2")]; !ok {
+		t.Errorf("expected pol2 to be retained")
+	}
+}
+
+// Until the exchange is known to page through the searches, each pass is one search for all the nodes.
+func Test_SearchScheduler_noPaging(t *testing.T) {
+	s := NewSearchScheduler(10, 100, 50)
+	s.searches[searchKey("myorg", "pol1")] = &policySearch{nextSearch: 1000}
+
+	page, due := s.Next("myorg", "pol1", 1000)
+	if !due || page.NumEntries != 0 || page.StartAfter != "" || page.ChangedSince != 0 {
+		t.Fatalf("expected a search without paging, got %v %v", page, due)
+	} else if page, _ = s.PageDone(page, nodeIds(0, 120), nil, 1000); page != nil {
+		t.Errorf("expected the pass to be done after one search, got %v", page)
+	}
+	if page, due := s.Next("myorg", "pol1", 1015); !due || page.NumEntries != 0 || page.ChangedSince != 0 {
+		t.Errorf("expected another search for all the nodes, got %v %v", page, due)
+	}
+
+	if !s.SetPaging(true) || s.SetPaging(true) {
+		t.Errorf("expected only the first change of the setting to be reported")
+	}
+}
+
+// An exchange that ignores the cursor returns the same full page again, which ends the pass.
+func Test_SearchScheduler_ignoredCursor(t *testing.T) {
+	s := NewSearchScheduler(10, 100, 50)
+	s.SetPaging(true)
+	s.searches[searchKey("myorg", "pol1")] = &policySearch{nextSearch: 1000}
+
+	page, _ := s.Next("myorg", "pol1", 1000)
+	if page, _ = s.PageDone(page, nodeIds(0, 50), nil, 1000); page == nil {
+		t.Fatalf("expected a full page to continue the pass")
+	} else if page, _ = s.PageDone(page, nodeIds(0, 50), nil, 1001); page != nil {
+		t.Errorf("expected a page without nodes after the cursor to end the pass, got %v", page)
+	}
+}
+
+// The pass after an agreement of the policy ended is a full pass, so that the node of the agreement is found again.
+func Test_SearchScheduler_agreementEnded(t *testing.T) {
+	s := NewSearchScheduler(10, 100, 50)
+	s.SetPaging(true)
+	s.searches[searchKey("myorg", "pol1")] = &policySearch{nextSearch: 1000}
+
+	page, _ := s.Next("myorg", "pol1", 1000)
+	s.PageDone(page, nil, nil, 1000)
+	s.AgreementEnded("myorg", "pol1")
+	page, due := s.Next("myorg", "pol1", 1015)
+	if !due || page.ChangedSince != 0 {
+		t.Fatalf("expected a full pass after an agreement ended, got %v %v", page, due)
+	}
+	s.PageDone(page, nil, nil, 1015)
+	if page, due := s.Next("myorg", "pol1", 1030); !due || page.ChangedSince != 1015 {
+		t.Errorf("expected a changed since pass after the full pass, got %v %v", page, due)
+	}
+
+	// An agreement of a policy that isnt searched is ignored.
+	s.AgreementEnded("myorg", "pol2")
+	if _, ok := s.searches[searchKey("myorg", "pol2")]; ok {
+		t.Errorf("expected pol2 not to be searched")
+	}
+}
+
+func Test_SearchScheduler_jitter(t *testing.T) {
+	s := NewSearchScheduler(100, 1000, 50)
+	for i := 0; i < 100; i++ {
+		if j := s.jitter(); j < 0 || j > 20 {
+			t.Errorf("expected the jitter to be within 20%% of the interval, got %v", j)
+		}
+	}
+	if j := NewSearchScheduler(1, 1000, 50).jitter(); j != 0 {
+		t.Errorf("expected no jitter for a short interval, got %v", j)
+	}
+}
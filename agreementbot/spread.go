@@ -0,0 +1,227 @@
+package agreementbot
+
+import (
+	"fmt"
+	"github.com/golang/glog"
+	"github.com/open-horizon/anax/policy"
+	"sort"
+)
+
+// The agbot applies the spread constraints of a consumer policy (see policy/spread.go) to the compatible nodes that a
+// search finds, on all the pages of the search, after they are ranked and before they are limited to the policy's max
+// agreements. The agreements that the agbot already has on the policy are counted per value of each constrained
+// property. Nodes that bring a value up to its minPerValue are moved to the front, and nodes whose value has reached
+// its maxPerValue are dropped. A value that is only found on a later page of the search still gets its minPerValue
+// ahead of the values found first. The same constraints, and the HA groups of the devices, keep the batches of a
+// rollout from taking down too many devices that share a value at once.
+//
+// The values of a node come from the node's own properties, the producer policy of a candidate and the node
+// properties recorded with an agreement, never from the consumer policy. The nodes without the property share an
+// unknown value, which counts toward maxPerValue but never gets the minPerValue head start. Each agbot only counts
+// its own agreements, so when the agbots split the nodes of a policy between them (see partition_manager.go), the
+// limits apply to each agbot separately.
+
+// Returns the value of a node for a spread constraint, and false when the node does not have the property, in which
+// case the value is the unknown value. The HA group of a node is keyed the same way as its partition.
+func spreadValue(c policy.SpreadConstraint, deviceId string, props policy.PropertyList, haPartners []string) (string, bool) {
+	if c.Property == policy.SPREAD_HA_GROUP {
+		return partitionKey(deviceId, haPartners), true
+	}
+	return c.ValueOf(props)
+}
+
+// Count the agreements per value of each spread constraint.
+func countSpread(spread policy.Spread, agreements []Agreement) []map[string]int {
+	counts := make([]map[string]int, len(spread))
+	for ix := range spread {
+		counts[ix] = make(map[string]int)
+	}
+
+	for _, ag := range agreements {
+		for ix, c := range spread {
+			value, _ := spreadValue(c, ag.DeviceId, ag.NodeProperties, ag.HAPartners)
+			counts[ix][value] += 1
+		}
+	}
+	return counts
+}
+
+// Apply the spread constraints to the ranked candidates, given the current agreement counts per value. The candidates
+// that fill a known value below its minPerValue go first, in their ranked order, followed by the rest of the
+// candidates. Candidates that would take a value over its maxPerValue are dropped. Candidates that already have an
+// agreement on the policy are counted already, so they are passed through as is.
+func applySpread(spread policy.Spread, counts []map[string]int, agreed map[string]bool, candidates []*placementCandidate) []*placementCandidate {
+	values := make([][]string, len(candidates))
+	known := make([][]bool, len(candidates))
+	constrained := make([]bool, len(candidates))
+	for i, cand := range candidates {
+		values[i] = make([]string, len(spread))
+		known[i] = make([]bool, len(spread))
+		if agreed[cand.device.Id] {
+			continue
+		}
+
+		constrained[i] = true
+		var props policy.PropertyList
+		var haPartners []string
+		if cand.nodePolicy != nil {
+			props = cand.nodePolicy.Properties
+			haPartners = cand.nodePolicy.HAGroup.Partners
+		}
+		for ix, c := range spread {
+			values[i][ix], known[i][ix] = spreadValue(c, cand.device.Id, props, haPartners)
+		}
+	}
+
+	fits := func(i int) bool {
+		for ix, c := range spread {
+			if constrained[i] && c.MaxPerValue != 0 && counts[ix][values[i][ix]] >= c.MaxPerValue {
+				return false
+			}
+		}
+		return true
+	}
+	fills := func(i int) bool {
+		for ix, c := range spread {
+			if constrained[i] && known[i][ix] && counts[ix][values[i][ix]] < c.MinPerValue {
+				return true
+			}
+		}
+		return false
+	}
+
+	res := make([]*placementCandidate, 0, len(candidates))
+	taken := make([]bool, len(candidates))
+	take := func(i int) {
+		taken[i] = true
+		res = append(res, candidates[i])
+		if constrained[i] {
+			for ix := range spread {
+				counts[ix][values[i][ix]] += 1
+			}
+		}
+	}
+
+	for i := range candidates {
+		if fills(i) && fits(i) {
+			take(i)
+		}
+	}
+	for i := range candidates {
+		if taken[i] {
+			continue
+		} else if fits(i) {
+			take(i)
+		} else {
+			glog.V(5).Infof(AWlogString(fmt.Sprintf("skipping node %v, it would exceed the spread constraints", candidates[i].device.Id)))
+		}
+	}
+	return res
+}
+
+// Order and filter the candidates by the spread constraints of the policy.
+func (w *AgreementBotWorker) spreadCandidates(pol *policy.Policy, candidates []*placementCandidate) []*placementCandidate {
+	if len(pol.Spread) == 0 || len(candidates) == 0 {
+		return candidates
+	}
+
+	agreements, err := policyAgreements(w.store, pol.Header.Name)
+	if err != nil {
+		glog.Errorf(AWlogString(fmt.Sprintf("unable to read agreements for policy %v, error: %v", pol.Header.Name, err)))
+		return []*placementCandidate{}
+	}
+
+	agreed := make(map[string]bool)
+	for _, ag := range agreements {
+		agreed[ag.DeviceId] = true
+	}
+
+	candidates = applySpread(pol.Spread, countSpread(pol.Spread, agreements), agreed, candidates)
+	glog.V(5).Infof(AWlogString(fmt.Sprintf("spread nodes for policy %v: %v", pol.Header.Name, candidates)))
+	return candidates
+}
+
+// Return the unarchived agreements on the policy, across all agreement protocols.
+func policyAgreements(store AgbotStore, policyName string) ([]Agreement, error) {
+	res := make([]Agreement, 0)
+	onPolicy := func(a Agreement) bool { return a.PolicyName == policyName }
+	for _, agp := range policy.AllAgreementProtocols() {
+		if agreements, err := store.FindAgreements([]AFilter{UnarchivedAFilter(), onPolicy}, agp); err != nil {
+			return nil, err
+		} else {
+			res = append(res, agreements...)
+		}
+	}
+	return res, nil
+}
+
+// A set of devices of which a rollout has to keep some up while the others are upgraded.
+type rolloutGroup struct {
+	members []string
+	keepUp  int
+}
+
+func (g rolloutGroup) String() string {
+	return fmt.Sprintf("Members: %v, KeepUp: %v", g.members, g.keepUp)
+}
+
+// Return the groups of devices that a rollout must not take down all at once. Every HA group keeps one member up, and
+// the devices with agreements that share a value of a spread constraint keep minPerValue of them up.
+func rolloutGroups(spread policy.Spread, usages []WorkloadUsage, agreements []Agreement) []rolloutGroup {
+	groups := make([]rolloutGroup, 0)
+
+	haGroups := make(map[string]map[string]bool)
+	for _, wlu := range usages {
+		if len(wlu.HAPartners) == 0 {
+			continue
+		}
+		key := partitionKey(wlu.DeviceId, wlu.HAPartners)
+		if _, ok := haGroups[key]; !ok {
+			haGroups[key] = make(map[string]bool)
+		}
+		haGroups[key][wlu.DeviceId] = true
+		for _, partner := range wlu.HAPartners {
+			if partner != "" {
+				haGroups[key][partner] = true
+			}
+		}
+	}
+	groups = append(groups, sortedGroups(haGroups, 1)...)
+
+	for _, c := range spread {
+		if c.MinPerValue == 0 {
+			continue
+		}
+		byValue := make(map[string]map[string]bool)
+		for _, ag := range agreements {
+			if value, ok := spreadValue(c, ag.DeviceId, ag.NodeProperties, ag.HAPartners); ok {
+				if _, ok := byValue[value]; !ok {
+					byValue[value] = make(map[string]bool)
+				}
+				byValue[value][ag.DeviceId] = true
+			}
+		}
+		groups = append(groups, sortedGroups(byValue, c.MinPerValue)...)
+	}
+	return groups
+}
+
+// Turn sets of devices into groups, in the order of their keys so that the rollout plan is repeatable.
+func sortedGroups(sets map[string]map[string]bool, keepUp int) []rolloutGroup {
+	keys := make([]string, 0, len(sets))
+	for key := range sets {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	groups := make([]rolloutGroup, 0, len(keys))
+	for _, key := range keys {
+		members := make([]string, 0, len(sets[key]))
+		for id := range sets[key] {
+			members = append(members, id)
+		}
+		sort.Strings(members)
+		groups = append(groups, rolloutGroup{members: members, keepUp: keepUp})
+	}
+	return groups
+}
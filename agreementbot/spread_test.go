@@ -0,0 +1,132 @@
+// +build unit
+
+package agreementbot
+
+import (
+	"github.com/open-horizon/anax/exchange"
+	"github.com/open-horizon/anax/policy"
+	"testing"
+)
+
+func Test_applySpread(t *testing.T) {
+	newCandidate := func(id string, region string, partners []string) *placementCandidate {
+		pol := policy.Policy_Factory(id)
+		if region != "" {
+			pol.Properties = append(pol.Properties, *policy.Property_Factory("region", region))
+		}
+		pol.HAGroup.Partners = partners
+		return &placementCandidate{device: exchange.SearchResultDevice{Id: id}, nodePolicy: pol}
+	}
+	ids := func(candidates []*placementCandidate) []string {
+		res := make([]string, 0)
+		for _, c := range candidates {
+			res = append(res, c.device.Id)
+		}
+		return res
+	}
+	newAgreement := func(id string, region string) Agreement {
+		return Agreement{CurrentAgreementId: "a-" + id, DeviceId: id, NodeProperties: policy.PropertyList{*policy.Property_Factory("region", region)}}
+	}
+
+	spread := policy.Spread{{Property: "region", MaxPerValue: 2, MinPerValue: 1}}
+	agreements := []Agreement{newAgreement("org/e1", "east"), newAgreement("org/e2", "east")}
+	counts := countSpread(spread, agreements)
+	if counts[0]["east"] != 2 {
+		t.Fatalf("expected 2 agreements in the east, got %v", counts)
+	}
+
+	// East is full, west is moved to the front to get its first agreement, and the node without a region doesnt need
+	// to be moved to the front.
+	candidates := []*placementCandidate{newCandidate("org/e3", "east", nil), newCandidate("org/n1", "", nil), newCandidate("org/w1", "west", nil), newCandidate("org/w2", "west", nil), newCandidate("org/w3", "west", nil)}
+	if got := ids(applySpread(spread, counts, map[string]bool{}, candidates)); len(got) != 3 || got[0] != "org/w1" || got[1] != "org/n1" || got[2] != "org/w2" {
+		t.Errorf("expected org/w1, org/n1 and org/w2, got %v", got)
+	}
+
+	// A node that already has an agreement is passed through.
+	if got := ids(applySpread(spread, countSpread(spread, agreements), map[string]bool{"org/e3": true}, candidates[:1])); len(got) != 1 {
+		t.Errorf("expected the node with an agreement to be kept, got %v", got)
+	}
+
+	// At most 1 agreement per HA group.
+	haSpread := policy.Spread{{Property: policy.SPREAD_HA_GROUP, MaxPerValue: 1}}
+	candidates = []*placementCandidate{newCandidate("org/h2", "", []string{"org/h1"}), newCandidate("org/h1", "", []string{"org/h2"}), newCandidate("org/s1", "", nil)}
+	if got := ids(applySpread(haSpread, countSpread(haSpread, nil), map[string]bool{}, candidates)); len(got) != 2 || got[0] != "org/h2" || got[1] != "org/s1" {
+		t.Errorf("expected org/h2 and org/s1, got %v", got)
+	}
+}
+
+// The spread constraints apply to the nodes of a whole search, a value that is only on a later page gets its
+// minPerValue before the values of the first page fill up the max agreements.
+func Test_applySpread_pages(t *testing.T) {
+	newCandidate := func(id string, region string) *placementCandidate {
+		pol := policy.Policy_Factory(id)
+		pol.Properties = append(pol.Properties, *policy.Property_Factory("region", region))
+		return &placementCandidate{device: exchange.SearchResultDevice{Id: id}, nodePolicy: pol}
+	}
+
+	s := NewSearchScheduler(10, 100, 2)
+	s.SetPaging(true)
+	s.searches[searchKey("myorg", "pol1")] = &policySearch{nextSearch: 1000}
+	page, _ := s.Next("myorg", "pol1", 1000)
+	page, _ = s.PageDone(page, []string{"org/e1", "org/e2"}, []*placementCandidate{newCandidate("org/e1", "east"), newCandidate("org/e2", "east")}, 1000)
+	page, candidates := s.PageDone(page, []string{"org/w1"}, []*placementCandidate{newCandidate("org/w1", "west")}, 1001)
+	if page != nil {
+		t.Fatalf("expected the pass to be done")
+	}
+
+	spread := policy.Spread{{Property: "region", MinPerValue: 1}}
+	candidates = applySpread(spread, countSpread(spread, nil), map[string]bool{}, candidates)
+	if len(candidates) != 3 || candidates[0].device.Id != "org/e1" || candidates[1].device.Id != "org/w1" {
+		t.Errorf("expected the first east and west nodes ahead of the second east node, got %v", candidates)
+	}
+}
+
+// The value of a node comes from the node's properties, and the nodes without the property share an unknown value that
+// is limited by maxPerValue.
+func Test_applySpread_unknown(t *testing.T) {
+	spread := policy.Spread{{Property: "region", MaxPerValue: 1}}
+
+	// The consumer policy of an agreement has no say in the value of its node.
+	consumer := policy.Policy_Factory("consumer")
+	consumer.Properties = append(consumer.Properties, *policy.Property_Factory("region", "west"))
+	tsandcs := policy.Policy_Factory("merged")
+	tsandcs.Properties = append(tsandcs.Properties, *policy.Property_Factory("region", "west"), *policy.Property_Factory("zone", "a"))
+	if props := nodeProperties(tsandcs, consumer); len(props) != 1 || props[0].Name != "zone" {
+		t.Errorf("expected only the zone to be a node property, got %v", props)
+	}
+	agreements := []Agreement{{DeviceId: "org/n1", NodeProperties: nodeProperties(tsandcs, consumer)}}
+	counts := countSpread(spread, agreements)
+	if counts[0]["west"] != 0 || counts[0][""] != 1 {
+		t.Fatalf("expected the agreement to count toward the unknown value, got %v", counts)
+	}
+
+	// A node whose value is unknown doesnt get around the maximum, a node with a known value still fits.
+	bare := &placementCandidate{device: exchange.SearchResultDevice{Id: "org/n2"}, nodePolicy: policy.Policy_Factory("org/n2")}
+	pattern := &placementCandidate{device: exchange.SearchResultDevice{Id: "org/n3"}}
+	west := policy.Policy_Factory("org/w1")
+	west.Properties = append(west.Properties, *policy.Property_Factory("region", "west"))
+	known := &placementCandidate{device: exchange.SearchResultDevice{Id: "org/w1"}, nodePolicy: west}
+	if got := applySpread(spread, counts, map[string]bool{}, []*placementCandidate{bare, pattern, known}); len(got) != 1 || got[0].device.Id != "org/w1" {
+		t.Errorf("expected only org/w1, got %v", got)
+	}
+}
+
+func Test_rolloutGroups(t *testing.T) {
+	usages := []WorkloadUsage{
+		{DeviceId: "org/h2", HAPartners: []string{"org/h1"}},
+		{DeviceId: "org/h1", HAPartners: []string{"org/h2"}},
+		{DeviceId: "org/s1"},
+	}
+	east := policy.PropertyList{*policy.Property_Factory("region", "east")}
+	agreements := []Agreement{{DeviceId: "org/e1", NodeProperties: east}, {DeviceId: "org/e2", NodeProperties: east}, {DeviceId: "org/s1"}}
+
+	spread := policy.Spread{{Property: "region", MinPerValue: 1}, {Property: "zone", MaxPerValue: 1}}
+	groups := rolloutGroups(spread, usages, agreements)
+	if len(groups) != 2 {
+		t.Fatalf("expected an HA group and a region group, got %v", groups)
+	} else if len(groups[0].members) != 2 || groups[0].members[0] != "org/h1" || groups[0].keepUp != 1 {
+		t.Errorf("expected the HA group of org/h1 and org/h2, got %v", groups[0])
+	} else if len(groups[1].members) != 2 || groups[1].members[1] != "org/e2" || groups[1].keepUp != 1 {
+		t.Errorf("expected the east group of org/e1 and org/e2, got %v", groups[1])
+	}
+}
@@ -4,8 +4,8 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
-	"github.com/boltdb/bolt"
 	"github.com/golang/glog"
+	"github.com/open-horizon/anax/persistence"
 	"strconv"
 	"time"
 )
@@ -75,7 +75,7 @@ func workloadUsage(deviceId string, hapartners []string, policy string, policyNa
 	}
 }
 
-func NewWorkloadUsage(db *bolt.DB, deviceId string, hapartners []string, policy string, policyName string, priority int, retryDurationS int, verifiedDurationS int, reqsNotMet bool, agid string) error {
+func NewWorkloadUsage(db persistence.Store, deviceId string, hapartners []string, policy string, policyName string, priority int, retryDurationS int, verifiedDurationS int, reqsNotMet bool, agid string) error {
 	if wlUsage, err := workloadUsage(deviceId, hapartners, policy, policyName, priority, retryDurationS, verifiedDurationS, reqsNotMet, agid); err != nil {
 		return err
 	} else if existing, err := FindSingleWorkloadUsageByDeviceAndPolicyName(db, deviceId, policyName); err != nil {
@@ -89,7 +89,7 @@ func NewWorkloadUsage(db *bolt.DB, deviceId string, hapartners []string, policy
 	}
 }
 
-func UpdateRetryCount(db *bolt.DB, deviceid string, policyName string, retryCount int, agid string) (*WorkloadUsage, error) {
+func UpdateRetryCount(db persistence.Store, deviceid string, policyName string, retryCount int, agid string) (*WorkloadUsage, error) {
 	if wlUsage, err := singleWorkloadUsageUpdate(db, deviceid, policyName, func(w WorkloadUsage) *WorkloadUsage {
 		w.CurrentAgreementId = agid
 		w.RetryCount = retryCount
@@ -112,7 +112,7 @@ func UpdateRetryCount(db *bolt.DB, deviceid string, policyName string, retryCoun
 	}
 }
 
-func UpdatePriority(db *bolt.DB, deviceid string, policyName string, priority int, retryDurationS int, verifiedDurationS int, agid string) (*WorkloadUsage, error) {
+func UpdatePriority(db persistence.Store, deviceid string, policyName string, priority int, retryDurationS int, verifiedDurationS int, agid string) (*WorkloadUsage, error) {
 	if wlUsage, err := singleWorkloadUsageUpdate(db, deviceid, policyName, func(w WorkloadUsage) *WorkloadUsage {
 		w.CurrentAgreementId = agid
 		w.Priority = priority
@@ -128,7 +128,7 @@ func UpdatePriority(db *bolt.DB, deviceid string, policyName string, priority in
 	}
 }
 
-func UpdatePendingUpgrade(db *bolt.DB, deviceid string, policyName string) (*WorkloadUsage, error) {
+func UpdatePendingUpgrade(db persistence.Store, deviceid string, policyName string) (*WorkloadUsage, error) {
 	if wlUsage, err := singleWorkloadUsageUpdate(db, deviceid, policyName, func(w WorkloadUsage) *WorkloadUsage {
 		w.PendingUpgradeTime = uint64(time.Now().Unix())
 		return &w
@@ -139,7 +139,7 @@ func UpdatePendingUpgrade(db *bolt.DB, deviceid string, policyName string) (*Wor
 	}
 }
 
-func UpdateWUAgreementId(db *bolt.DB, deviceid string, policyName string, agid string) (*WorkloadUsage, error) {
+func UpdateWUAgreementId(db persistence.Store, deviceid string, policyName string, agid string) (*WorkloadUsage, error) {
 	if wlUsage, err := singleWorkloadUsageUpdate(db, deviceid, policyName, func(w WorkloadUsage) *WorkloadUsage {
 		w.CurrentAgreementId = agid
 		return &w
@@ -150,7 +150,7 @@ func UpdateWUAgreementId(db *bolt.DB, deviceid string, policyName string, agid s
 	}
 }
 
-func DisableRollbackChecking(db *bolt.DB, deviceid string, policyName string) (*WorkloadUsage, error) {
+func DisableRollbackChecking(db persistence.Store, deviceid string, policyName string) (*WorkloadUsage, error) {
 	if wlUsage, err := singleWorkloadUsageUpdate(db, deviceid, policyName, func(w WorkloadUsage) *WorkloadUsage {
 		w.DisableRetry = true
 		w.RetryCount = 0
@@ -162,7 +162,7 @@ func DisableRollbackChecking(db *bolt.DB, deviceid string, policyName string) (*
 	}
 }
 
-func UpdatePolicy(db *bolt.DB, deviceid string, policyName string, pol string) (*WorkloadUsage, error) {
+func UpdatePolicy(db persistence.Store, deviceid string, policyName string, pol string) (*WorkloadUsage, error) {
 	if wlUsage, err := singleWorkloadUsageUpdate(db, deviceid, policyName, func(w WorkloadUsage) *WorkloadUsage {
 		w.Policy = pol
 		return &w
@@ -173,7 +173,7 @@ func UpdatePolicy(db *bolt.DB, deviceid string, policyName string, pol string) (
 	}
 }
 
-func FindSingleWorkloadUsageByDeviceAndPolicyName(db *bolt.DB, deviceid string, policyName string) (*WorkloadUsage, error) {
+func FindSingleWorkloadUsageByDeviceAndPolicyName(db persistence.Store, deviceid string, policyName string) (*WorkloadUsage, error) {
 	filters := make([]WUFilter, 0)
 	filters = append(filters, DaPWUFilter(deviceid, policyName))
 
@@ -188,7 +188,7 @@ func FindSingleWorkloadUsageByDeviceAndPolicyName(db *bolt.DB, deviceid string,
 	}
 }
 
-func singleWorkloadUsageUpdate(db *bolt.DB, deviceid string, policyName string, fn func(WorkloadUsage) *WorkloadUsage) (*WorkloadUsage, error) {
+func singleWorkloadUsageUpdate(db persistence.Store, deviceid string, policyName string, fn func(WorkloadUsage) *WorkloadUsage) (*WorkloadUsage, error) {
 	if wlUsage, err := FindSingleWorkloadUsageByDeviceAndPolicyName(db, deviceid, policyName); err != nil {
 		return nil, err
 	} else if wlUsage == nil {
@@ -200,8 +200,8 @@ func singleWorkloadUsageUpdate(db *bolt.DB, deviceid string, policyName string,
 }
 
 // does whole-member replacements of values that are legal to change during the course of a workload usage
-func persistUpdatedWorkloadUsage(db *bolt.DB, id uint64, update *WorkloadUsage) error {
-	return db.Update(func(tx *bolt.Tx) error {
+func persistUpdatedWorkloadUsage(db persistence.Store, id uint64, update *WorkloadUsage) error {
+	return db.Update(func(tx persistence.Tx) error {
 		if b, err := tx.CreateBucketIfNotExists([]byte(wuBucketName())); err != nil {
 			return err
 		} else {
@@ -256,7 +256,7 @@ func persistUpdatedWorkloadUsage(db *bolt.DB, id uint64, update *WorkloadUsage)
 	})
 }
 
-func DeleteWorkloadUsage(db *bolt.DB, deviceid string, policyName string) error {
+func DeleteWorkloadUsage(db persistence.Store, deviceid string, policyName string) error {
 	if deviceid == "" || policyName == "" {
 		return fmt.Errorf("Missing required arg deviceid or policyName")
 	} else {
@@ -268,7 +268,7 @@ func DeleteWorkloadUsage(db *bolt.DB, deviceid string, policyName string) error
 		} else {
 
 			pk := wlUsage.Id
-			return db.Update(func(tx *bolt.Tx) error {
+			return db.Update(func(tx persistence.Tx) error {
 				b := tx.Bucket([]byte(wuBucketName()))
 				if b == nil {
 					return fmt.Errorf("Unknown bucket: %v", wuBucketName())
@@ -304,10 +304,10 @@ func PWUFilter(policyName string) WUFilter {
 
 type WUFilter func(WorkloadUsage) bool
 
-func FindWorkloadUsages(db *bolt.DB, filters []WUFilter) ([]WorkloadUsage, error) {
+func FindWorkloadUsages(db persistence.Store, filters []WUFilter) ([]WorkloadUsage, error) {
 	wlUsages := make([]WorkloadUsage, 0)
 
-	readErr := db.View(func(tx *bolt.Tx) error {
+	readErr := db.View(func(tx persistence.Tx) error {
 
 		if b := tx.Bucket([]byte(wuBucketName())); b != nil {
 			b.ForEach(func(k, v []byte) error {
@@ -345,11 +345,11 @@ func FindWorkloadUsages(db *bolt.DB, filters []WUFilter) ([]WorkloadUsage, error
 // This function allocates the record's primary key from the DB's internal sequence counter. The record
 // being created is updated with this key right before it is written. This function assumes that duplicate
 // record checks have already occurred before it is called.
-func WUPersistNew(db *bolt.DB, bucket string, record *WorkloadUsage) error {
+func WUPersistNew(db persistence.Store, bucket string, record *WorkloadUsage) error {
 	if bucket == "" {
 		return fmt.Errorf("Missing required arg bucket")
 	} else {
-		writeErr := db.Update(func(tx *bolt.Tx) error {
+		writeErr := db.Update(func(tx persistence.Tx) error {
 
 			if b, err := tx.CreateBucketIfNotExists([]byte(bucket)); err != nil {
 				return err
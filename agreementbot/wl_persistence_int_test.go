@@ -4,13 +4,14 @@ package agreementbot
 
 import (
 	"github.com/boltdb/bolt"
+	"github.com/open-horizon/anax/persistence"
 	"io/ioutil"
 	"os"
 	"testing"
 	"time"
 )
 
-var testDb *bolt.DB
+var testDb persistence.Store
 
 func TestMain(m *testing.M) {
 	testDbFile, err := ioutil.TempFile("", "agreementbot_test.db")
@@ -19,11 +20,11 @@ func TestMain(m *testing.M) {
 	}
 	defer os.Remove(testDbFile.Name())
 
-	var dbErr error
-	testDb, dbErr = bolt.Open(testDbFile.Name(), 0600, &bolt.Options{Timeout: 10 * time.Second})
+	boltDb, dbErr := bolt.Open(testDbFile.Name(), 0600, &bolt.Options{Timeout: 10 * time.Second})
 	if dbErr != nil {
 		panic(err)
 	}
+	testDb = persistence.NewBoltStore(boltDb)
 
 	m.Run()
 }
@@ -6,7 +6,6 @@ import (
 	"net/http"
 	"sync"
 
-	"github.com/boltdb/bolt"
 	"github.com/golang/glog"
 	"github.com/gorilla/mux"
 	"github.com/open-horizon/anax/apicommon"
@@ -21,13 +20,16 @@ import (
 type API struct {
 	worker.Manager // embedded field
 	name           string
-	db             *bolt.DB
+	db             persistence.Store
 	pm             *policy.PolicyManager
 	em             *events.EventStateManager
 	bcState        map[string]map[string]apicommon.BlockchainState
 	bcStateLock    sync.Mutex
 	shutdownError  string
 	exchHandlers   *exchange.ExchangeApiHandlers
+	containerLogs  ContainerLogs
+	imageProgress  ImageProgress
+	deviceBroker   DeviceClaims
 }
 
 type BlockchainState struct {
@@ -37,7 +39,7 @@ type BlockchainState struct {
 	servicePort string // the network port of the container
 }
 
-func NewAPIListener(name string, config *config.HorizonConfig, db *bolt.DB, pm *policy.PolicyManager) *API {
+func NewAPIListener(name string, config *config.HorizonConfig, db persistence.Store, pm *policy.PolicyManager, containerLogs ContainerLogs, imageProgress ImageProgress, deviceBroker DeviceClaims) *API {
 	messages := make(chan events.Message)
 
 	listener := &API{
@@ -46,13 +48,16 @@ func NewAPIListener(name string, config *config.HorizonConfig, db *bolt.DB, pm *
 			Messages: messages,
 		},
 
-		name:         name,
-		db:           db,
-		pm:           pm,
-		em:           events.NewEventStateManager(),
-		bcState:      make(map[string]map[string]apicommon.BlockchainState),
-		bcStateLock:  sync.Mutex{},
-		exchHandlers: exchange.NewExchangeApiHandlers(config),
+		name:          name,
+		db:            db,
+		pm:            pm,
+		em:            events.NewEventStateManager(),
+		bcState:       make(map[string]map[string]apicommon.BlockchainState),
+		bcStateLock:   sync.Mutex{},
+		exchHandlers:  exchange.NewExchangeApiHandlers(config),
+		containerLogs: containerLogs,
+		imageProgress: imageProgress,
+		deviceBroker:  deviceBroker,
 	}
 
 	listener.listen(config.Edge.APIListen)
@@ -74,10 +79,17 @@ func (a *API) router(includeStaticRedirects bool) *mux.Router {
 	router.HandleFunc("/microservice", a.microservice).Methods("GET", "OPTIONS")
 	router.HandleFunc("/microservice/config", a.microserviceconfig).Methods("GET", "POST", "OPTIONS")
 	router.HandleFunc("/microservice/policy", a.microservicepolicy).Methods("GET", "OPTIONS")
+	router.HandleFunc("/microservice/logs", a.microserviceLogs).Methods("GET", "OPTIONS")
+
+	// For reading the journal of events that have flowed between the workers
+	router.HandleFunc("/eventlog", a.eventlog).Methods("GET", "OPTIONS")
 
 	// Connectivity and blockchain status info
 	router.HandleFunc("/status", a.status).Methods("GET", "OPTIONS")
 
+	// Counters and gauges about the node, in the Prometheus text format
+	router.HandleFunc("/metrics", a.metrics).Methods("GET", "OPTIONS")
+
 	// Used by the Registration UI to obtain a random token string
 	router.HandleFunc("/token/random", tokenRandom).Methods("GET", "OPTIONS")
 
@@ -88,6 +100,7 @@ func (a *API) router(includeStaticRedirects bool) *mux.Router {
 	// Used to configure workload userInputs for workloads that are expected to be run on this node.
 	router.HandleFunc("/workload", a.workload).Methods("GET", "OPTIONS")
 	router.HandleFunc("/workload/config", a.workloadConfig).Methods("GET", "POST", "DELETE", "OPTIONS")
+	router.HandleFunc("/workload/logs", a.workloadLogs).Methods("GET", "OPTIONS")
 
 	// For importing workload public signing keys (RSA-PSS key pair public key)
 	router.HandleFunc("/{p:(publickey|trust)}", a.publickey).Methods("GET", "OPTIONS")
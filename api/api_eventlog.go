@@ -0,0 +1,31 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/golang/glog"
+)
+
+func (a *API) eventlog(w http.ResponseWriter, r *http.Request) {
+
+	resource := "eventlog"
+	errorhandler := GetHTTPErrorHandler(w)
+
+	switch r.Method {
+	case "GET":
+		glog.V(5).Infof(apiLogString(fmt.Sprintf("Handling %v on resource %v", r.Method, resource)))
+
+		// Gather the journaled events that match the query parameters from the local database.
+		q := r.URL.Query()
+		if out, errHandled := FindEventLogForOutput(errorhandler, a.db, q.Get("event_id"), q.Get("agreement_id"), q.Get("since"), q.Get("until")); !errHandled {
+			writeResponse(w, out, http.StatusOK)
+		}
+
+	case "OPTIONS":
+		w.Header().Set("Allow", "GET, OPTIONS")
+		w.WriteHeader(http.StatusOK)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
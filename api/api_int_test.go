@@ -12,13 +12,10 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"net/url"
-	"path"
 	"sync"
 	"testing"
-	"time"
 
 	"github.com/adams-sarah/test2doc/test"
-	"github.com/boltdb/bolt"
 	"github.com/golang/glog"
 	"github.com/gorilla/mux"
 	"github.com/open-horizon/anax/apicommon"
@@ -73,13 +70,13 @@ func serial(t *testing.T, attrInput []byte) []byte {
 	return serialized
 }
 
-func setup() (string, *bolt.DB, error) {
+func setup() (string, persistence.Store, error) {
 	dir, err := ioutil.TempDir("", "api-attribute-")
 	if err != nil {
 		return "", nil, err
 	}
 
-	db, err := bolt.Open(path.Join(dir, "anax-int.db"), 0600, &bolt.Options{Timeout: 10 * time.Second})
+	db, err := persistence.OpenBoltStore(dir, "anax-int.db")
 	if err != nil {
 		return dir, nil, err
 	}
@@ -0,0 +1,112 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+
+	dockerclient "github.com/fsouza/go-dockerclient"
+	"github.com/golang/glog"
+)
+
+// The container worker reads the logs of workload and microservice containers through its docker client.
+type ContainerLogs interface {
+	MatchingContainers(match func(*dockerclient.APIContainers) bool) ([]dockerclient.APIContainers, error)
+	StreamLogs(ctx context.Context, containers []dockerclient.APIContainers, tail string, follow bool, out io.Writer) error
+}
+
+// The id query parameter of the workload logs is an agreement id or the name of a workload service.
+func (a *API) workloadLogs(w http.ResponseWriter, r *http.Request) {
+	a.logs(w, r, "workload/logs", WorkloadContainerFilter)
+}
+
+// The id query parameter of the microservice logs is a microservice URL, a microservice instance key or the name
+// of a microservice service.
+func (a *API) microserviceLogs(w http.ResponseWriter, r *http.Request) {
+	a.logs(w, r, "microservice/logs", MicroserviceContainerFilter)
+}
+
+func (a *API) logs(w http.ResponseWriter, r *http.Request, resource string, filter func(id string) func(*dockerclient.APIContainers) bool) {
+
+	errorhandler := GetHTTPErrorHandler(w)
+
+	switch r.Method {
+	case "GET":
+		glog.V(5).Infof(apiLogString(fmt.Sprintf("Handling %v on resource %v", r.Method, resource)))
+
+		q := r.URL.Query()
+		id := q.Get("id")
+		if id == "" {
+			errorhandler(NewAPIUserInputError("is required", "id"))
+			return
+		}
+
+		tail := "all"
+		if q.Get("tail") != "" {
+			tail = q.Get("tail")
+			if n, err := strconv.Atoi(tail); err != nil || n < 0 {
+				errorhandler(NewAPIUserInputError("must be a number of lines", "tail"))
+				return
+			}
+		}
+
+		follow := false
+		if q.Get("follow") != "" {
+			if f, err := strconv.ParseBool(q.Get("follow")); err != nil {
+				errorhandler(NewAPIUserInputError("must be true or false", "follow"))
+				return
+			} else {
+				follow = f
+			}
+		}
+
+		if a.containerLogs == nil {
+			errorhandler(NewSystemError("container logs are not available"))
+			return
+		}
+
+		containers, err := a.containerLogs.MatchingContainers(filter(id))
+		if err != nil {
+			errorhandler(NewSystemError(err.Error()))
+			return
+		} else if len(containers) == 0 {
+			errorhandler(NewNotFoundError(fmt.Sprintf("no containers found for %v", id), "id"))
+			return
+		}
+
+		// The logs are streamed until they end, or until the client goes away when following them.
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.WriteHeader(http.StatusOK)
+		if f, ok := w.(http.Flusher); ok {
+			f.Flush()
+		}
+
+		if err := a.containerLogs.StreamLogs(r.Context(), containers, tail, follow, flushWriter{w}); err != nil {
+			glog.Errorf(apiLogString(err.Error()))
+			fmt.Fprintf(w, "error: %v\n", err)
+		}
+
+	case "OPTIONS":
+		w.Header().Set("Allow", "GET, OPTIONS")
+		w.WriteHeader(http.StatusOK)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+// Flushes the response after each write, so that followed logs reach the client as they are written.
+type flushWriter struct {
+	w http.ResponseWriter
+}
+
+func (f flushWriter) Write(p []byte) (int, error) {
+	return f.w.Write(p)
+}
+
+func (f flushWriter) Flush() {
+	if fl, ok := f.w.(http.Flusher); ok {
+		fl.Flush()
+	}
+}
@@ -0,0 +1,31 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/golang/glog"
+	"github.com/open-horizon/anax/metrics"
+)
+
+func (a *API) metrics(w http.ResponseWriter, r *http.Request) {
+
+	switch r.Method {
+	case "GET":
+		if err := UpdateAgreementMetrics(a.db); err != nil {
+			glog.Errorf(apiLogString(fmt.Sprintf("Unable to update agreement metrics: %v", err)))
+		}
+
+		w.Header().Set("Content-Type", metrics.CONTENT_TYPE)
+		w.WriteHeader(http.StatusOK)
+		if err := metrics.NodeRegistry.Write(w); err != nil {
+			glog.Error(apiLogString(err))
+		}
+
+	case "OPTIONS":
+		w.Header().Set("Allow", "GET, OPTIONS")
+		w.WriteHeader(http.StatusOK)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
@@ -38,6 +38,7 @@ func (a *API) microservice(w http.ResponseWriter, r *http.Request) {
 		if out, err := FindServicesForOutput(a.pm, a.db, a.Config); err != nil {
 			errorhandler(NewSystemError(fmt.Sprintf("Error getting %v for output, error %v", resource, err)))
 		} else {
+			out.Devices = a.deviceClaims(true)
 			writeResponse(w, *out, http.StatusOK)
 		}
 
@@ -19,6 +19,12 @@ func (a *API) status(w http.ResponseWriter, r *http.Request) {
 			glog.Errorf(apiLogString(fmt.Sprintf("Unable to get connectivity status: %v", err)))
 		}
 
+		if disk, err := apicommon.GetDiskState(&a.Config.Edge); err != nil {
+			glog.Errorf(apiLogString(fmt.Sprintf("Unable to get disk status: %v", err)))
+		} else {
+			info.Disk = disk
+		}
+
 		a.bcStateLock.Lock()
 		defer a.bcStateLock.Unlock()
 
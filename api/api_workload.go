@@ -8,8 +8,34 @@ import (
 	"net/http"
 
 	"github.com/golang/glog"
+	"github.com/open-horizon/anax/container"
+	"github.com/open-horizon/anax/torrent"
 )
 
+// The torrent worker keeps the progress of the images it fetches.
+type ImageProgress interface {
+	ImageProgress() []torrent.ImageProgress
+}
+
+// The container worker brokers the host devices that are given to the workload and microservice containers.
+type DeviceClaims interface {
+	DeviceClaims() []container.DeviceClaim
+}
+
+// Return the device claims of the workload containers, or of the microservice containers.
+func (a *API) deviceClaims(infrastructure bool) []container.DeviceClaim {
+	if a.deviceBroker == nil {
+		return nil
+	}
+	claims := make([]container.DeviceClaim, 0, 5)
+	for _, c := range a.deviceBroker.DeviceClaims() {
+		if c.Infrastructure == infrastructure {
+			claims = append(claims, c)
+		}
+	}
+	return claims
+}
+
 func (a *API) workload(w http.ResponseWriter, r *http.Request) {
 
 	resource := "workload"
@@ -29,6 +55,10 @@ func (a *API) workload(w http.ResponseWriter, r *http.Request) {
 		if out, err := FindWorkloadForOutput(a.db, a.Config); err != nil {
 			errorhandler(NewSystemError(fmt.Sprintf("Error getting %v for output, error %v", resource, err)))
 		} else {
+			if a.imageProgress != nil {
+				out.ImageFetches = a.imageProgress.ImageProgress()
+			}
+			out.Devices = a.deviceClaims(false)
 			writeResponse(w, out, http.StatusOK)
 		}
 
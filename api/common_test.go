@@ -2,14 +2,12 @@ package api
 
 import (
 	"fmt"
-	"github.com/boltdb/bolt"
 	"github.com/open-horizon/anax/config"
 	"github.com/open-horizon/anax/exchange"
+	"github.com/open-horizon/anax/persistence"
 	"github.com/open-horizon/anax/policy"
 	"io/ioutil"
 	"os"
-	"path"
-	"time"
 )
 
 // ========================================================================================
@@ -157,18 +155,13 @@ func getVariableWorkload(mUrl, mOrg, mVersion, mArch string, ui []exchange.UserI
 	}
 }
 
-func utsetup() (string, *bolt.DB, error) {
+func utsetup() (string, persistence.Store, error) {
 	dir, err := ioutil.TempDir("", "utdb-")
 	if err != nil {
 		return "", nil, err
 	}
 
-	db, err := bolt.Open(path.Join(dir, "anax-int.db"), 0600, &bolt.Options{Timeout: 10 * time.Second})
-	if err != nil {
-		return dir, nil, err
-	}
-
-	return dir, db, nil
+	return dir, persistence.NewMemoryStore(), nil
 }
 
 // Make a deferred call to this function after calling setup(), passing the output dirpath of the setup() function.
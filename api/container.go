@@ -71,3 +71,25 @@ func getMangledName(url string) string {
 	}
 	return strings.Replace(s, "/", "-", -1)
 }
+
+// Select the workload containers of an agreement, or the workload containers of a service, by agreement id or
+// service name.
+func WorkloadContainerFilter(id string) func(*dockerclient.APIContainers) bool {
+	return func(c *dockerclient.APIContainers) bool {
+		if _, exists := c.Labels["network.bluehorizon.colonus.infrastructure"]; exists {
+			return false
+		}
+		return c.Labels["network.bluehorizon.colonus.agreement_id"] == id || c.Labels["network.bluehorizon.colonus.service_name"] == id
+	}
+}
+
+// Select the containers of a microservice, by microservice URL, microservice instance key or service name.
+func MicroserviceContainerFilter(id string) func(*dockerclient.APIContainers) bool {
+	return func(c *dockerclient.APIContainers) bool {
+		if _, exists := c.Labels["network.bluehorizon.colonus.infrastructure"]; !exists {
+			return false
+		}
+		agid := c.Labels["network.bluehorizon.colonus.agreement_id"]
+		return agid == id || (agid != "" && strings.Contains(agid, getMangledName(id))) || c.Labels["network.bluehorizon.colonus.service_name"] == id
+	}
+}
@@ -2,8 +2,10 @@ package api
 
 import (
 	dockerclient "github.com/fsouza/go-dockerclient"
+	"github.com/open-horizon/anax/container"
 	"github.com/open-horizon/anax/persistence"
 	"github.com/open-horizon/anax/policy"
+	"github.com/open-horizon/anax/torrent"
 	"strings"
 )
 
@@ -36,9 +38,10 @@ func NewMicroserviceConfig(url string, org string, version string) *Microservice
 
 // The output format for GET microservice
 type AllMicroservices struct {
-	Config      []MicroserviceConfig     `json:"config"`      // the microservice configurations
-	Instances   map[string][]interface{} `json:"instances"`   // the microservice instances that are running
-	Definitions map[string][]interface{} `json:"definitions"` // the definitions of microservices from the exchange
+	Config      []MicroserviceConfig     `json:"config"`            // the microservice configurations
+	Instances   map[string][]interface{} `json:"instances"`         // the microservice instances that are running
+	Definitions map[string][]interface{} `json:"definitions"`       // the definitions of microservices from the exchange
+	Devices     []container.DeviceClaim  `json:"devices,omitempty"` // the host devices given to the microservice containers
 }
 
 func NewMicroserviceOutput() *AllMicroservices {
@@ -64,8 +67,11 @@ func NewMicroserviceInstanceOutput(mi persistence.MicroserviceInstance, containe
 
 // The output format for GET workload
 type AllWorkloads struct {
-	Config     []persistence.WorkloadConfig  `json:"config"`     // the workload configurations
-	Containers *[]dockerclient.APIContainers `json:"containers"` // the docker info for a running container
+	Config       []persistence.WorkloadConfig                     `json:"config"`                  // the workload configurations
+	Containers   *[]dockerclient.APIContainers                    `json:"containers"`              // the docker info for a running container
+	Limits       map[string]map[string]persistence.EnforcedLimits `json:"limits,omitempty"`        // the resource limits enforced on each service, by agreement id
+	ImageFetches []torrent.ImageProgress                          `json:"image_fetches,omitempty"` // the progress of the image fetches that are in progress or recently finished
+	Devices      []container.DeviceClaim                          `json:"devices,omitempty"`       // the host devices given to the workload containers
 }
 
 func NewWorkloadOutput() *AllWorkloads {
@@ -7,8 +7,8 @@ import (
 	"io"
 	"io/ioutil"
 	"reflect"
+	"time"
 
-	"github.com/boltdb/bolt"
 	"github.com/golang/glog"
 	"github.com/open-horizon/anax/cutil"
 	"github.com/open-horizon/anax/persistence"
@@ -155,6 +155,24 @@ func parseUserInput(errorhandler ErrorHandler, permitEmpty bool, given *Attribut
 	}, false, nil
 }
 
+func parseSecurity(errorhandler ErrorHandler, permitEmpty bool, given *Attribute) (*persistence.SecurityAttributes, bool, error) {
+	if permitEmpty {
+		return nil, errorhandler(NewAPIUserInputError("partial update unsupported", "security.mappings")), nil
+	}
+
+	rp, exists := (*given.Mappings)["refusePrivileged"]
+	if !exists {
+		return nil, errorhandler(NewAPIUserInputError("missing key", "security.mappings.refusePrivileged")), nil
+	} else if refusePrivileged, ok := rp.(bool); !ok {
+		return nil, errorhandler(NewAPIUserInputError(fmt.Sprintf("expected bool received %T", rp), "security.mappings.refusePrivileged")), nil
+	} else {
+		return &persistence.SecurityAttributes{
+			Meta:             generateAttributeMetadata(*given, reflect.TypeOf(persistence.SecurityAttributes{}).Name()),
+			RefusePrivileged: refusePrivileged,
+		}, false, nil
+	}
+}
+
 func parseHTTPSBasicAuth(errorhandler ErrorHandler, permitEmpty bool, given *Attribute) (*persistence.HTTPSBasicAuthAttributes, bool, error) {
 	var ok bool
 
@@ -296,6 +314,13 @@ func parseProperty(errorhandler ErrorHandler, permitEmpty bool, given *Attribute
 		return nil, errorhandler(NewAPIUserInputError("partial update unsupported", "property.mappings")), nil
 	}
 
+	// Typed properties have to have a value of their declared type.
+	for name, mapping := range *given.Mappings {
+		if _, err := policy.PropertyFromMapping(name, mapping); err != nil {
+			return nil, errorhandler(NewAPIUserInputError(err.Error(), fmt.Sprintf("property.mappings.%v", name))), nil
+		}
+	}
+
 	return &persistence.PropertyAttributes{
 		Meta:     generateAttributeMetadata(*given, reflect.TypeOf(persistence.PropertyAttributes{}).Name()),
 		Mappings: (*given.Mappings)}, false, nil
@@ -327,6 +352,30 @@ func parseCounterPartyProperty(errorhandler ErrorHandler, permitEmpty bool, give
 	}
 }
 
+func parseAvailability(errorhandler ErrorHandler, permitEmpty bool, given *Attribute) (*persistence.AvailabilityAttributes, bool, error) {
+	if permitEmpty {
+		return nil, errorhandler(NewAPIUserInputError("partial update unsupported", "availability.mappings")), nil
+	}
+
+	s, exists := (*given.Mappings)["schedules"]
+	if !exists {
+		return nil, errorhandler(NewAPIUserInputError("missing key", "availability.mappings.schedules")), nil
+	} else if _, ok := s.([]interface{}); !ok {
+		return nil, errorhandler(NewAPIUserInputError(fmt.Sprintf("expected []interface{} received %T", s), "availability.mappings.schedules")), nil
+	} else if availability, err := policy.ConvertToAvailability(s); err != nil {
+		return nil, errorhandler(NewAPIUserInputError(err.Error(), "availability.mappings.schedules")), nil
+	} else if err := availability.IsValid(); err != nil {
+		return nil, errorhandler(NewAPIUserInputError(fmt.Sprintf("not a valid schedule: %v", err), "availability.mappings.schedules")), nil
+	} else if !availability.HasOpening(time.Now()) {
+		return nil, errorhandler(NewAPIUserInputError("the schedules are never open at the same time", "availability.mappings.schedules")), nil
+	} else {
+		return &persistence.AvailabilityAttributes{
+			Meta:      generateAttributeMetadata(*given, reflect.TypeOf(persistence.AvailabilityAttributes{}).Name()),
+			Schedules: s,
+		}, false, nil
+	}
+}
+
 func parseAgreementProtocol(errorhandler ErrorHandler, permitEmpty bool, given *Attribute) (*persistence.AgreementProtocolAttributes, bool, error) {
 	if permitEmpty {
 		return nil, errorhandler(NewAPIUserInputError("partial update unsupported", "agreementprotocol.mappings")), nil
@@ -530,6 +579,20 @@ func ValidateAndConvertAPIAttribute(errorhandler ErrorHandler, permitEmpty bool,
 			}
 			attribute = attr
 
+		case reflect.TypeOf(persistence.AvailabilityAttributes{}).Name():
+			attr, inputErr, err := parseAvailability(errorhandler, permitEmpty, &given)
+			if err != nil || inputErr {
+				return attribute, inputErr, err
+			}
+			attribute = attr
+
+		case reflect.TypeOf(persistence.SecurityAttributes{}).Name():
+			attr, inputErr, err := parseSecurity(errorhandler, permitEmpty, &given)
+			if err != nil || inputErr {
+				return attribute, inputErr, err
+			}
+			attribute = attr
+
 		case reflect.TypeOf(persistence.HTTPSBasicAuthAttributes{}).Name():
 			attr, inputErr, err := parseHTTPSBasicAuth(errorhandler, permitEmpty, &given)
 			if err != nil || inputErr {
@@ -695,7 +758,7 @@ func payloadToAttributes(errorhandler ErrorHandler, body io.Reader, permitPartia
 // serializeAttributeForOutput retrieves attributes by url from the DB and then
 // serializes then as JSON, returning a byte array for convenient writing to an
 // HTTP response.
-func FindAndWrapAttributesForOutput(db *bolt.DB, id string) (map[string][]Attribute, error) {
+func FindAndWrapAttributesForOutput(db persistence.Store, id string) (map[string][]Attribute, error) {
 
 	attributes, err := persistence.FindApplicableAttributes(db, "")
 	if err != nil {
@@ -0,0 +1,24 @@
+package api
+
+import (
+	"fmt"
+	"github.com/open-horizon/anax/eventlog"
+	"github.com/open-horizon/anax/persistence"
+)
+
+// Return the journaled events that match all of the non-empty query parameters, oldest first. The since
+// and until parameters are in seconds since 1970.
+func FindEventLogForOutput(errorhandler ErrorHandler, db persistence.Store, eventId string, agreementId string, since string, until string) ([]eventlog.EventRecord, bool) {
+
+	filters, input, err := eventlog.QueryFilters(eventId, agreementId, since, until)
+	if err != nil {
+		return nil, errorhandler(NewAPIUserInputError(err.Error(), input))
+	}
+
+	records, err := eventlog.FindEventRecords(db, filters)
+	if err != nil {
+		return nil, errorhandler(NewSystemError(fmt.Sprintf("unable to read event log, error %v", err)))
+	}
+
+	return records, false
+}
@@ -0,0 +1,63 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"github.com/open-horizon/anax/metrics"
+	"github.com/open-horizon/anax/persistence"
+	"github.com/open-horizon/anax/policy"
+)
+
+// The states that an agreement on the node can be in, from the metrics point of view.
+const (
+	AG_STATE_CREATED     = "created"
+	AG_STATE_ACCEPTED    = "accepted"
+	AG_STATE_FINALIZED   = "finalized"
+	AG_STATE_EXECUTING   = "executing"
+	AG_STATE_TERMINATING = "terminating"
+	AG_STATE_ARCHIVED    = "archived"
+)
+
+var agreementsByState = metrics.NodeRegistry.NewGaugeVec("anax_agreements", "The number of agreements on the node, by state.", "state")
+
+// Returns the most advanced state that the agreement has reached.
+func agreementState(ag *persistence.EstablishedAgreement) string {
+	if ag.Archived {
+		return AG_STATE_ARCHIVED
+	} else if ag.AgreementTerminatedTime != 0 {
+		return AG_STATE_TERMINATING
+	} else if ag.AgreementExecutionStartTime != 0 {
+		return AG_STATE_EXECUTING
+	} else if ag.AgreementFinalizedTime != 0 {
+		return AG_STATE_FINALIZED
+	} else if ag.AgreementAcceptedTime != 0 {
+		return AG_STATE_ACCEPTED
+	}
+	return AG_STATE_CREATED
+}
+
+// Refresh the metrics that are computed from the local database.
+func UpdateAgreementMetrics(db persistence.Store) error {
+
+	agreements, err := persistence.FindEstablishedAgreementsAllProtocols(db, policy.AllAgreementProtocols(), []persistence.EAFilter{})
+	if err != nil {
+		return errors.New(fmt.Sprintf("unable to read agreement objects, error %v", err))
+	}
+
+	counts := map[string]int{
+		AG_STATE_CREATED:     0,
+		AG_STATE_ACCEPTED:    0,
+		AG_STATE_FINALIZED:   0,
+		AG_STATE_EXECUTING:   0,
+		AG_STATE_TERMINATING: 0,
+		AG_STATE_ARCHIVED:    0,
+	}
+	for ix := range agreements {
+		counts[agreementState(&agreements[ix])] += 1
+	}
+	for state, count := range counts {
+		agreementsByState.Set(float64(count), state)
+	}
+
+	return nil
+}
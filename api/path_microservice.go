@@ -3,7 +3,6 @@ package api
 import (
 	"errors"
 	"fmt"
-	"github.com/boltdb/bolt"
 	"github.com/open-horizon/anax/config"
 	"github.com/open-horizon/anax/persistence"
 	"github.com/open-horizon/anax/policy"
@@ -15,7 +14,7 @@ import (
 // userInput variable config for each microservice, running containers for each microservice,
 // and the state of each microservice as it is being managed by anax.
 func FindServicesForOutput(pm *policy.PolicyManager,
-	db *bolt.DB,
+	db persistence.Store,
 	config *config.HorizonConfig) (*AllMicroservices, error) {
 
 	// Get all the ms instances that we know about.
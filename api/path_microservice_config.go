@@ -3,7 +3,6 @@ package api
 import (
 	"errors"
 	"fmt"
-	"github.com/boltdb/bolt"
 	"github.com/golang/glog"
 	"github.com/open-horizon/anax/config"
 	"github.com/open-horizon/anax/cutil"
@@ -16,7 +15,7 @@ import (
 	"strconv"
 )
 
-func FindServiceConfigForOutput(pm *policy.PolicyManager, db *bolt.DB) (map[string][]MicroserviceConfig, error) {
+func FindServiceConfigForOutput(pm *policy.PolicyManager, db persistence.Store) (map[string][]MicroserviceConfig, error) {
 
 	outConfig := make([]MicroserviceConfig, 0, 10)
 
@@ -70,7 +69,7 @@ func CreateService(service *Service,
 	getPatterns exchange.PatternHandler,
 	resolveWorkload exchange.WorkloadResolverHandler,
 	getMicroservice exchange.MicroserviceHandler,
-	db *bolt.DB,
+	db persistence.Store,
 	config *config.HorizonConfig, from_user bool) (bool, *Service, *events.PolicyCreatedMessage) {
 
 	// Check for the device in the local database. If there are errors, they will be written
@@ -227,7 +226,7 @@ func CreateService(service *Service,
 
 		// If the device declared itself to be using a pattern, then it CANNOT specify any attributes that generate policy settings.
 		if pDevice.Pattern != "" {
-			if attr.GetMeta().Type == "MeteringAttributes" || attr.GetMeta().Type == "PropertyAttributes" || attr.GetMeta().Type == "CounterPartyPropertyAttributes" || attr.GetMeta().Type == "AgreementProtocolAttributes" {
+			if attr.GetMeta().Type == "MeteringAttributes" || attr.GetMeta().Type == "PropertyAttributes" || attr.GetMeta().Type == "CounterPartyPropertyAttributes" || attr.GetMeta().Type == "AgreementProtocolAttributes" || attr.GetMeta().Type == "AvailabilityAttributes" {
 				return errorhandler(NewAPIUserInputError(fmt.Sprintf("device is using a pattern %v, policy attributes are not supported.", pDevice.Pattern), "service.[attribute].type")), nil
 			}
 		}
@@ -256,6 +255,8 @@ func CreateService(service *Service,
 	var counterPartyProperties policy.RequiredProperty
 	var properties map[string]interface{}
 	var globalAgreementProtocols []interface{}
+	var availability interface{}
+	var refusePrivileged bool
 
 	props := make(map[string]interface{})
 
@@ -274,6 +275,12 @@ func CreateService(service *Service,
 			glog.V(5).Infof(apiLogString(fmt.Sprintf("Found default global HA attribute %v", attr)))
 		}
 
+		// Extract the security attribute. It protects the node, so it applies to devices that are using a pattern too.
+		if attr.GetMeta().Type == "SecurityAttributes" && len(attr.GetMeta().SensorUrls) == 0 {
+			refusePrivileged = attr.(persistence.SecurityAttributes).RefusePrivileged
+			glog.V(5).Infof(apiLogString(fmt.Sprintf("Found default global security attribute %v", attr)))
+		}
+
 		// Global policy attributes are ignored for devices that are using a pattern. All policy is controlled
 		// by the pattern definition.
 		if pDevice.Pattern == "" {
@@ -307,6 +314,12 @@ func CreateService(service *Service,
 				globalAgreementProtocols = agpl.([]interface{})
 				glog.V(5).Infof(apiLogString(fmt.Sprintf("Found default global agreement protocol attribute %v", globalAgreementProtocols)))
 			}
+
+			// Extract global availability attribute
+			if attr.GetMeta().Type == "AvailabilityAttributes" && len(attr.GetMeta().SensorUrls) == 0 {
+				availability = attr.(persistence.AvailabilityAttributes).Schedules
+				glog.V(5).Infof(apiLogString(fmt.Sprintf("Found default global availability attribute %v", availability)))
+			}
 		}
 	}
 
@@ -365,6 +378,12 @@ func CreateService(service *Service,
 			agpl := attr.(*persistence.AgreementProtocolAttributes).Protocols
 			serviceAgreementProtocols = agpl.([]policy.AgreementProtocol)
 
+		case *persistence.AvailabilityAttributes:
+			availability = attr.(*persistence.AvailabilityAttributes).Schedules
+
+		case *persistence.SecurityAttributes:
+			refusePrivileged = attr.(*persistence.SecurityAttributes).RefusePrivileged
+
 		default:
 			glog.V(4).Infof(apiLogString(fmt.Sprintf("Unhandled attr type (%T): %v", attr, attr)))
 		}
@@ -391,6 +410,12 @@ func CreateService(service *Service,
 		agpList = list
 	}
 
+	// Convert the availability schedules into the policy form.
+	policyAvailability, err := policy.ConvertToAvailability(availability)
+	if err != nil {
+		return errorhandler(NewSystemError(fmt.Sprintf("Error converting availability attribute %v to availability schedules, error: %v", availability, err))), nil, nil
+	}
+
 	// Save the microservice definition in the local database.
 	if err := persistence.SaveOrUpdateMicroserviceDef(db, msdef); err != nil {
 		return errorhandler(NewSystemError(fmt.Sprintf("Error saving microservice definition %v into db: %v", *msdef, err))), nil, nil
@@ -409,7 +434,7 @@ func CreateService(service *Service,
 	glog.V(5).Infof(apiLogString(fmt.Sprintf("Create service: %v", service)))
 
 	// Generate a policy based on all the attributes and the service definition.
-	if msg, genErr := policy.GeneratePolicy(*service.SensorUrl, *service.SensorOrg, *service.SensorName, *service.SensorVersion, *service.SensorArch, &props, haPartner, meterPolicy, counterPartyProperties, *agpList, maxAgreements, config.Edge.PolicyPath, pDevice.Org); genErr != nil {
+	if msg, genErr := policy.GeneratePolicy(*service.SensorUrl, *service.SensorOrg, *service.SensorName, *service.SensorVersion, *service.SensorArch, &props, haPartner, meterPolicy, counterPartyProperties, *agpList, *policyAvailability, refusePrivileged, maxAgreements, config.Edge.PolicyPath, pDevice.Org); genErr != nil {
 		return errorhandler(NewSystemError(fmt.Sprintf("Error generating policy, error: %v", genErr))), nil, nil
 	} else {
 		return false, service, msg
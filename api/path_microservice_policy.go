@@ -2,13 +2,12 @@ package api
 
 import (
 	"fmt"
-	"github.com/boltdb/bolt"
 	"github.com/golang/glog"
 	"github.com/open-horizon/anax/persistence"
 	"github.com/open-horizon/anax/policy"
 )
 
-func FindPoliciesForOutput(pm *policy.PolicyManager, db *bolt.DB) (map[string]policy.Policy, error) {
+func FindPoliciesForOutput(pm *policy.PolicyManager, db persistence.Store) (map[string]policy.Policy, error) {
 
 	out := make(map[string]policy.Policy)
 
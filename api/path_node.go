@@ -3,7 +3,6 @@ package api
 import (
 	"errors"
 	"fmt"
-	"github.com/boltdb/bolt"
 	"github.com/golang/glog"
 	"github.com/open-horizon/anax/events"
 	"github.com/open-horizon/anax/exchange"
@@ -16,7 +15,7 @@ import (
 // object because it eventually gets deleted at the end of unconfiguration.
 var Unconfiguring bool
 
-func FindHorizonDeviceForOutput(db *bolt.DB) (*HorizonDevice, error) {
+func FindHorizonDeviceForOutput(db persistence.Store) (*HorizonDevice, error) {
 
 	var device *HorizonDevice
 
@@ -51,7 +50,7 @@ func CreateHorizonDevice(device *HorizonDevice,
 	getOrg exchange.OrgHandler,
 	getPatterns exchange.PatternHandler,
 	em *events.EventStateManager,
-	db *bolt.DB) (bool, *HorizonDevice, *HorizonDevice) {
+	db persistence.Store) (bool, *HorizonDevice, *HorizonDevice) {
 
 	// Reject the call if the node is restarting.
 	se := events.NewNodeShutdownCompleteMessage(events.UNCONFIGURE_COMPLETE, "")
@@ -145,7 +144,7 @@ func CreateHorizonDevice(device *HorizonDevice,
 // Handles the PATCH verb on this resource. Only the exchange token is updateable.
 func UpdateHorizonDevice(device *HorizonDevice,
 	errorhandler ErrorHandler,
-	db *bolt.DB) (bool, *HorizonDevice, *HorizonDevice) {
+	db persistence.Store) (bool, *HorizonDevice, *HorizonDevice) {
 
 	// Check for the device in the local database. If there are errors, they will be written
 	// to the HTTP response.
@@ -188,7 +187,7 @@ func DeleteHorizonDevice(removeNode string,
 	em *events.EventStateManager,
 	msgQueue chan events.Message,
 	errorhandler ErrorHandler,
-	db *bolt.DB) bool {
+	db persistence.Store) bool {
 
 	// Check for the device in the local database. If there are errors, they will be written
 	// to the HTTP response.
@@ -3,7 +3,6 @@ package api
 import (
 	"errors"
 	"fmt"
-	"github.com/boltdb/bolt"
 	"github.com/golang/glog"
 	"github.com/open-horizon/anax/config"
 	"github.com/open-horizon/anax/cutil"
@@ -33,7 +32,7 @@ func ValidStateChange(from string, to string) bool {
 	return false
 }
 
-func FindConfigstateForOutput(db *bolt.DB) (*Configstate, error) {
+func FindConfigstateForOutput(db persistence.Store) (*Configstate, error) {
 
 	var device *HorizonDevice
 
@@ -64,7 +63,7 @@ func UpdateConfigstate(cfg *Configstate,
 	getMicroservice exchange.MicroserviceHandler,
 	getPatterns exchange.PatternHandler,
 	resolveWorkload exchange.WorkloadResolverHandler,
-	db *bolt.DB,
+	db persistence.Store,
 	config *config.HorizonConfig) (bool, *Configstate, []*events.PolicyCreatedMessage) {
 
 	// Check for the device in the local database. If there are errors, they will be written
@@ -155,7 +154,7 @@ func UpdateConfigstate(cfg *Configstate,
 
 // This function verifies that if the given workload needs variable configuration, that there is a workloadconfig
 // object holding that config.
-func workloadConfigPresent(workloadDef *exchange.WorkloadDefinition, wUrl string, wVersion string, db *bolt.DB) (bool, error) {
+func workloadConfigPresent(workloadDef *exchange.WorkloadDefinition, wUrl string, wVersion string, db persistence.Store) (bool, error) {
 
 	// If the workload needs no config, exit early.
 	if !workloadDef.NeedsUserInput() {
@@ -198,7 +197,7 @@ func getSpecRefsForPattern(patName string,
 	devToken string,
 	getPatterns exchange.PatternHandler,
 	resolveWorkload exchange.WorkloadResolverHandler,
-	db *bolt.DB,
+	db persistence.Store,
 	config *config.HorizonConfig, checkWorkloadConfig bool) (*policy.APISpecList, error) {
 
 	glog.V(5).Infof(apiLogString(fmt.Sprintf("getSpecRefsForPattern %v org %v. Check workload config: %v", patName, patOrg, checkWorkloadConfig)))
@@ -3,11 +3,12 @@ package api
 import (
 	"errors"
 	"fmt"
-	"github.com/boltdb/bolt"
 	"github.com/open-horizon/anax/config"
+	"github.com/open-horizon/anax/persistence"
+	"github.com/open-horizon/anax/policy"
 )
 
-func FindWorkloadForOutput(db *bolt.DB, config *config.HorizonConfig) (*AllWorkloads, error) {
+func FindWorkloadForOutput(db persistence.Store, config *config.HorizonConfig) (*AllWorkloads, error) {
 
 	work := NewWorkloadOutput()
 
@@ -25,6 +26,44 @@ func FindWorkloadForOutput(db *bolt.DB, config *config.HorizonConfig) (*AllWorkl
 
 	work.Containers = &containers
 
+	limits, err := FindEnforcedLimitsForOutput(db)
+	if err != nil {
+		return nil, errors.New(fmt.Sprintf("unable to get workload resource limits, error %v", err))
+	}
+
+	work.Limits = limits
+
 	return work, nil
 
 }
+
+// Returns the resource limits enforced on the services of each active agreement, keyed by agreement id and then
+// by service name. Agreements without limits are omitted.
+func FindEnforcedLimitsForOutput(db persistence.Store) (map[string]map[string]persistence.EnforcedLimits, error) {
+
+	activeFilter := func() persistence.EAFilter {
+		return func(a persistence.EstablishedAgreement) bool {
+			return a.AgreementExecutionStartTime != 0 && a.AgreementTerminatedTime == 0
+		}
+	}
+
+	agreements, err := persistence.FindEstablishedAgreementsAllProtocols(db, policy.AllAgreementProtocols(), []persistence.EAFilter{persistence.UnarchivedEAFilter(), activeFilter()})
+	if err != nil {
+		return nil, err
+	}
+
+	limits := make(map[string]map[string]persistence.EnforcedLimits)
+	for _, ag := range agreements {
+		for serviceName, serviceConfig := range ag.CurrentDeployment {
+			if serviceConfig.Limits == nil {
+				continue
+			}
+			if _, ok := limits[ag.CurrentAgreementId]; !ok {
+				limits[ag.CurrentAgreementId] = make(map[string]persistence.EnforcedLimits)
+			}
+			limits[ag.CurrentAgreementId][serviceName] = *serviceConfig.Limits
+		}
+	}
+
+	return limits, nil
+}
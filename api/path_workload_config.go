@@ -3,7 +3,6 @@ package api
 import (
 	"errors"
 	"fmt"
-	"github.com/boltdb/bolt"
 	"github.com/golang/glog"
 	"github.com/open-horizon/anax/cutil"
 	"github.com/open-horizon/anax/exchange"
@@ -12,7 +11,7 @@ import (
 	"sort"
 )
 
-func FindWorkloadConfigForOutput(db *bolt.DB) (map[string][]persistence.WorkloadConfig, error) {
+func FindWorkloadConfigForOutput(db persistence.Store) (map[string][]persistence.WorkloadConfig, error) {
 
 	// Only "get all" is supported
 	wrap := make(map[string][]persistence.WorkloadConfig)
@@ -37,7 +36,7 @@ func CreateWorkloadconfig(cfg *WorkloadConfig,
 	existingDevice *persistence.ExchangeDevice,
 	errorhandler ErrorHandler,
 	getWorkload exchange.WorkloadHandler,
-	db *bolt.DB) (bool, *persistence.WorkloadConfig) {
+	db persistence.Store) (bool, *persistence.WorkloadConfig) {
 
 	glog.V(5).Infof(apiLogString(fmt.Sprintf("WorkloadConfig POST input: %v", cfg)))
 
@@ -151,7 +150,7 @@ func CreateWorkloadconfig(cfg *WorkloadConfig,
 // Delete a workloadconfig object.
 func DeleteWorkloadconfig(cfg *WorkloadConfig,
 	errorhandler ErrorHandler,
-	db *bolt.DB) bool {
+	db persistence.Store) bool {
 
 	glog.V(5).Infof(apiLogString(fmt.Sprintf("WorkloadConfig DELETE: %v", &cfg)))
 
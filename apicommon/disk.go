@@ -0,0 +1,89 @@
+package apicommon
+
+import (
+	"errors"
+	"fmt"
+	"syscall"
+
+	"github.com/open-horizon/anax/config"
+)
+
+// Defaults for the image garbage collection settings that are not set in the config file.
+const DEFAULT_IMAGE_GC_DISK_PATH = "/var/lib/docker"
+const DEFAULT_IMAGE_GC_HIGH_WATERMARK = 85
+const DEFAULT_IMAGE_GC_LOW_WATERMARK = 75
+
+// DiskState is an external type exposing the usage of the filesystem that docker keeps its images on.
+type DiskState struct {
+	Path          string `json:"path"`
+	TotalMB       uint64 `json:"total_mb"`
+	FreeMB        uint64 `json:"free_mb"`
+	UsedPercent   int    `json:"used_percent"`
+	HighWatermark int    `json:"gc_high_watermark"` // unused images are removed when the used percent reaches this
+	LowWatermark  int    `json:"gc_low_watermark"`  // and until the used percent is below this
+	MinFreeMB     uint64 `json:"min_free_mb"`
+	BelowFloor    bool   `json:"below_floor"` // when true, the node refuses new agreements
+}
+
+func (d DiskState) String() string {
+	return fmt.Sprintf("Path: %v, TotalMB: %v, FreeMB: %v, UsedPercent: %v, HighWatermark: %v, LowWatermark: %v, MinFreeMB: %v, BelowFloor: %v", d.Path, d.TotalMB, d.FreeMB, d.UsedPercent, d.HighWatermark, d.LowWatermark, d.MinFreeMB, d.BelowFloor)
+}
+
+// True when images that are no longer used should be removed.
+func (d *DiskState) OverHighWatermark() bool {
+	return d.UsedPercent >= d.HighWatermark && d.HighWatermark < 100
+}
+
+// True when enough images have been removed.
+func (d *DiskState) UnderLowWatermark() bool {
+	return d.UsedPercent < d.LowWatermark
+}
+
+// Read the usage of the image filesystem, and compare it to the watermarks and the floor in the config.
+func GetDiskState(cfg *config.Config) (*DiskState, error) {
+	path := cfg.ImageGCDiskPath
+	if path == "" {
+		path = DEFAULT_IMAGE_GC_DISK_PATH
+	}
+
+	var fs syscall.Statfs_t
+	if err := syscall.Statfs(path, &fs); err != nil {
+		return nil, errors.New(fmt.Sprintf("unable to read the disk usage of %v, error %v", path, err))
+	}
+
+	bsize := uint64(fs.Bsize)
+	return newDiskState(cfg, path, fs.Blocks*bsize, fs.Bfree*bsize, fs.Bavail*bsize), nil
+}
+
+// The used percent is computed the same way as df does, against the space that is available to non-root users.
+func newDiskState(cfg *config.Config, path string, total uint64, free uint64, avail uint64) *DiskState {
+	high, low := cfg.ImageGCHighWatermark, cfg.ImageGCLowWatermark
+	if high <= 0 {
+		high = DEFAULT_IMAGE_GC_HIGH_WATERMARK
+	}
+	if low <= 0 || low > high {
+		low = DEFAULT_IMAGE_GC_LOW_WATERMARK
+		if low > high {
+			low = high
+		}
+	}
+
+	used := total - free
+	usedPercent := 0
+	if used+avail != 0 {
+		// Round up, as df does.
+		usedPercent = int((used*100 + used + avail - 1) / (used + avail))
+	}
+
+	const mb = 1024 * 1024
+	return &DiskState{
+		Path:          path,
+		TotalMB:       total / mb,
+		FreeMB:        avail / mb,
+		UsedPercent:   usedPercent,
+		HighWatermark: high,
+		LowWatermark:  low,
+		MinFreeMB:     cfg.MinFreeDiskMB,
+		BelowFloor:    cfg.MinFreeDiskMB != 0 && avail/mb < cfg.MinFreeDiskMB,
+	}
+}
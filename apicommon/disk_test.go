@@ -0,0 +1,42 @@
+// +build unit
+
+package apicommon
+
+import (
+	"github.com/open-horizon/anax/config"
+	"testing"
+)
+
+func Test_newDiskState(t *testing.T) {
+	const mb = 1024 * 1024
+
+	// 1000MB filesystem with 200MB free, of which 150MB is available to non-root users.
+	d := newDiskState(&config.Config{}, "/var/lib/docker", 1000*mb, 200*mb, 150*mb)
+	if d.TotalMB != 1000 || d.FreeMB != 150 || d.UsedPercent != 85 {
+		t.Errorf("unexpected disk usage %v", d)
+	} else if d.HighWatermark != DEFAULT_IMAGE_GC_HIGH_WATERMARK || d.LowWatermark != DEFAULT_IMAGE_GC_LOW_WATERMARK {
+		t.Errorf("expected the default watermarks, got %v", d)
+	} else if !d.OverHighWatermark() || d.UnderLowWatermark() {
+		t.Errorf("expected the disk to be over the high watermark, got %v", d)
+	} else if d.BelowFloor {
+		t.Errorf("expected no floor by default, got %v", d)
+	}
+
+	d = newDiskState(&config.Config{ImageGCHighWatermark: 90, ImageGCLowWatermark: 50, MinFreeDiskMB: 200}, "/", 1000*mb, 200*mb, 150*mb)
+	if d.OverHighWatermark() || d.HighWatermark != 90 || d.LowWatermark != 50 {
+		t.Errorf("expected the configured watermarks, got %v", d)
+	} else if !d.BelowFloor {
+		t.Errorf("expected the disk to be below the floor, got %v", d)
+	}
+
+	// A low watermark above the high watermark is not used, and 100 turns garbage collection off.
+	d = newDiskState(&config.Config{ImageGCHighWatermark: 100, ImageGCLowWatermark: 101}, "/", 1000*mb, 0, 0)
+	if d.UsedPercent != 100 || d.OverHighWatermark() || d.LowWatermark != DEFAULT_IMAGE_GC_LOW_WATERMARK {
+		t.Errorf("expected a full disk to not be collected, got %v", d)
+	}
+
+	// Rounded up, as df does.
+	if d = newDiskState(&config.Config{}, "/", 1000*mb, 999*mb, 999*mb); d.UsedPercent != 1 {
+		t.Errorf("expected 1%% used, got %v", d)
+	}
+}
@@ -29,6 +29,7 @@ type Info struct {
 	Geths         []Geth          `json:"geth"`
 	Configuration *Configuration  `json:"configuration"`
 	Connectivity  map[string]bool `json:"connectivity"`
+	Disk          *DiskState      `json:"disk,omitempty"`
 }
 
 func NewInfo(httpClientFactory *config.HTTPClientFactory, exchangeUrl string) *Info {
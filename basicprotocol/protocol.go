@@ -19,6 +19,8 @@ const PROTOCOL_CURRENT_VERSION = 1
 // Extended message types
 const MsgTypeVerifyAgreement = "basicagreementverification"
 const MsgTypeVerifyAgreementReply = "basicagreementverificationreply"
+const MsgTypeHandoffAgreement = "basicagreementhandoff"
+const MsgTypeHandoffAgreementReply = "basicagreementhandoffreply"
 
 // This message enables a producer to ask the consumer to verify that a specific agreement still exists. If the
 // consumer replies with NO (false), the producer can cancel the agreement.
@@ -69,6 +71,63 @@ func NewBAgreementVerifyReply(bp *abstractprotocol.BaseProtocolMessage, exists b
 	}
 }
 
+// This message enables a consumer to move an agreement to another consumer, when the agbots split the nodes between
+// them. It is sent by the consumer that has the agreement, or by the new consumer when the consumer that had the
+// agreement has stopped heartbeating.
+type BAgreementHandoff struct {
+	*abstractprotocol.BaseProtocolMessage
+	NewConsumer string `json:"newConsumer"` // the exchange id of the consumer taking over the agreement
+}
+
+func (b *BAgreementHandoff) String() string {
+	return b.BaseProtocolMessage.String() + fmt.Sprintf(", NewConsumer: %v", b.NewConsumer)
+}
+
+func (b *BAgreementHandoff) ShortString() string {
+	return b.BaseProtocolMessage.ShortString() + fmt.Sprintf(", NewConsumer: %v", b.NewConsumer)
+}
+
+func (b *BAgreementHandoff) IsValid() bool {
+	return b.BaseProtocolMessage.IsValid() && b.MsgType == MsgTypeHandoffAgreement && b.NewConsumer != ""
+}
+
+func NewBAgreementHandoff(bp *abstractprotocol.BaseProtocolMessage, newConsumer string) *BAgreementHandoff {
+	return &BAgreementHandoff{
+		BaseProtocolMessage: bp,
+		NewConsumer:         newConsumer,
+	}
+}
+
+// This message is sent by the producer to the new consumer of a handed off agreement. It carries the proposal of the
+// agreement so that the new consumer can take over governing the agreement.
+type BAgreementHandoffReply struct {
+	*abstractprotocol.BaseProtocolMessage
+	FormerConsumer string `json:"formerConsumer"` // the exchange id of the consumer that had the agreement
+	Proposal       string `json:"proposal"`       // JSON serialization of the proposal of the agreement
+	ProposalSig    string `json:"proposalSig"`    // the producer's signature of the proposal
+}
+
+func (b *BAgreementHandoffReply) String() string {
+	return b.BaseProtocolMessage.String() + fmt.Sprintf(", FormerConsumer: %v, Proposal: %v, ProposalSig: %v", b.FormerConsumer, b.Proposal, b.ProposalSig)
+}
+
+func (b *BAgreementHandoffReply) ShortString() string {
+	return b.BaseProtocolMessage.ShortString() + fmt.Sprintf(", FormerConsumer: %v", b.FormerConsumer)
+}
+
+func (b *BAgreementHandoffReply) IsValid() bool {
+	return b.BaseProtocolMessage.IsValid() && b.MsgType == MsgTypeHandoffAgreementReply && b.Proposal != ""
+}
+
+func NewBAgreementHandoffReply(bp *abstractprotocol.BaseProtocolMessage, formerConsumer string, proposal string, proposalSig string) *BAgreementHandoffReply {
+	return &BAgreementHandoffReply{
+		BaseProtocolMessage: bp,
+		FormerConsumer:      formerConsumer,
+		Proposal:            proposal,
+		ProposalSig:         proposalSig,
+	}
+}
+
 // This is the object which users of the agreement protocol use to get access to the protocol functions. It MUST
 // implement all the functions in the abstract ProtocolHandler interface.
 type ProtocolHandler struct {
@@ -173,6 +232,52 @@ func (p *ProtocolHandler) SendAgreementVerificationReply(
 
 }
 
+func (p *ProtocolHandler) SendAgreementHandoff(
+	agreementId string,
+	newConsumer string,
+	messageTarget interface{},
+	sendMessage func(mt interface{}, pay []byte) error) error {
+
+	handoff := NewBAgreementHandoff(&abstractprotocol.BaseProtocolMessage{
+		MsgType:   MsgTypeHandoffAgreement,
+		AProtocol: p.Name(),
+		AVersion:  PROTOCOL_CURRENT_VERSION,
+		AgreeId:   agreementId,
+	},
+		newConsumer)
+
+	// Send the message
+	if err := abstractprotocol.SendProtocolMessage(messageTarget, handoff, sendMessage); err != nil {
+		return errors.New(fmt.Sprintf("Protocol %v error sending agreement handoff %v, %v", p.Name(), handoff, err))
+	}
+	return nil
+
+}
+
+func (p *ProtocolHandler) SendAgreementHandoffReply(
+	agreementId string,
+	formerConsumer string,
+	proposal string,
+	proposalSig string,
+	messageTarget interface{},
+	sendMessage func(mt interface{}, pay []byte) error) error {
+
+	reply := NewBAgreementHandoffReply(&abstractprotocol.BaseProtocolMessage{
+		MsgType:   MsgTypeHandoffAgreementReply,
+		AProtocol: p.Name(),
+		AVersion:  PROTOCOL_CURRENT_VERSION,
+		AgreeId:   agreementId,
+	},
+		formerConsumer, proposal, proposalSig)
+
+	// Send the message
+	if err := abstractprotocol.SendProtocolMessage(messageTarget, reply, sendMessage); err != nil {
+		return errors.New(fmt.Sprintf("Protocol %v error sending agreement handoff reply %v, %v", p.Name(), reply.ShortString(), err))
+	}
+	return nil
+
+}
+
 // The following methods dont implement any extensions to the base agreement protocol.
 func (p *ProtocolHandler) Confirm(replyValid bool,
 	agreementId string,
@@ -261,6 +366,36 @@ func (p *ProtocolHandler) ValidateAgreementVerifyReply(verify string) (*BAgreeme
 
 }
 
+func (p *ProtocolHandler) ValidateAgreementHandoff(handoff string) (*BAgreementHandoff, error) {
+
+	// attempt deserialization of message
+	hObj := new(BAgreementHandoff)
+
+	if err := json.Unmarshal([]byte(handoff), hObj); err != nil {
+		return nil, errors.New(fmt.Sprintf("Error deserializing agreement handoff: %s, error: %v", handoff, err))
+	} else if !hObj.IsValid() {
+		return nil, errors.New(fmt.Sprintf("Message is not an agreement handoff."))
+	} else {
+		return hObj, nil
+	}
+
+}
+
+func (p *ProtocolHandler) ValidateAgreementHandoffReply(reply string) (*BAgreementHandoffReply, error) {
+
+	// attempt deserialization of message
+	hObj := new(BAgreementHandoffReply)
+
+	if err := json.Unmarshal([]byte(reply), hObj); err != nil {
+		return nil, errors.New(fmt.Sprintf("Error deserializing agreement handoff reply: %s, error: %v", reply, err))
+	} else if !hObj.IsValid() {
+		return nil, errors.New(fmt.Sprintf("Message is not an agreement handoff reply."))
+	} else {
+		return hObj, nil
+	}
+
+}
+
 func (p *ProtocolHandler) DemarshalProposal(proposal string) (abstractprotocol.Proposal, error) {
 	return abstractprotocol.DemarshalProposal(proposal)
 }
@@ -347,6 +482,8 @@ const CANCEL_IMAGE_SIG_VERIF_FAILURE = 115
 const CANCEL_NODE_SHUTDOWN = 116 // x74
 const CANCEL_MS_IMAGE_FETCH_FAILURE = 117
 const CANCEL_MS_DOWNGRADE_REQUIRED = 118
+const CANCEL_AVAILABILITY_CLOSED = 119
+const CANCEL_CONTAINER_UNHEALTHY = 120
 
 // These constants represent consumer cancellation reason codes
 // const AB_CANCEL_NOT_FINALIZED_TIMEOUT = 200  // xc8
@@ -359,6 +496,7 @@ const AB_USER_REQUESTED = 206
 const AB_CANCEL_FORCED_UPGRADE = 207
 const AB_CANCEL_NODE_HEARTBEAT = 208
 const AB_CANCEL_AG_MISSING = 209
+const AB_CANCEL_PARTITION_HANDOFF = 210
 
 // const AB_CANCEL_BC_WRITE_FAILED       = 208  // xd0
 
@@ -382,6 +520,8 @@ func DecodeReasonCode(code uint64) string {
 		CANCEL_IMAGE_FETCH_AUTH_FAILURE: "authorization failed for image fetching",
 		CANCEL_IMAGE_SIG_VERIF_FAILURE:  "image signature verification failed",
 		CANCEL_NODE_SHUTDOWN:            "node was unconfigured",
+		CANCEL_AVAILABILITY_CLOSED:      "policy availability window closed",
+		CANCEL_CONTAINER_UNHEALTHY:      "workload container unhealthy",
 		// AB_CANCEL_NOT_FINALIZED_TIMEOUT: "agreement bot never detected agreement on the blockchain",
 		AB_CANCEL_NO_REPLY:         "agreement bot never received reply to proposal",
 		AB_CANCEL_NEGATIVE_REPLY:   "agreement bot received negative reply",
@@ -391,8 +531,9 @@ func DecodeReasonCode(code uint64) string {
 		AB_USER_REQUESTED:          "agreement bot user requested",
 		AB_CANCEL_FORCED_UPGRADE:   "agreement bot user requested workload upgrade",
 		// AB_CANCEL_BC_WRITE_FAILED:   "agreement bot agreement write failed"}
-		AB_CANCEL_NODE_HEARTBEAT: "agreement bot detected node heartbeat stopped",
-		AB_CANCEL_AG_MISSING:     "agreement bot detected agreement missing from node"}
+		AB_CANCEL_NODE_HEARTBEAT:    "agreement bot detected node heartbeat stopped",
+		AB_CANCEL_AG_MISSING:        "agreement bot detected agreement missing from node",
+		AB_CANCEL_PARTITION_HANDOFF: "agreement bot handed the node off to another agreement bot"}
 
 	if reasonString, ok := codeMeanings[code]; !ok {
 		return "unknown reason code, device might be downlevel"
@@ -783,6 +783,8 @@ const CANCEL_IMAGE_SIG_VERIF_FAILURE = 115
 const CANCEL_NODE_SHUTDOWN = 116 // x74
 const CANCEL_MS_IMAGE_FETCH_FAILURE = 117
 const CANCEL_MS_DOWNGRADE_REQUIRED = 118
+const CANCEL_AVAILABILITY_CLOSED = 119
+const CANCEL_CONTAINER_UNHEALTHY = 120
 
 // These constants represent consumer cancellation reason codes
 const AB_CANCEL_NOT_FINALIZED_TIMEOUT = 200 // xc8
@@ -818,6 +820,8 @@ func DecodeReasonCode(code uint64) string {
 		CANCEL_IMAGE_FETCH_AUTH_FAILURE: "authorization failed for image fetching",
 		CANCEL_IMAGE_SIG_VERIF_FAILURE:  "image signature verification failed",
 		CANCEL_NODE_SHUTDOWN:            "node was unconfigured",
+		CANCEL_AVAILABILITY_CLOSED:      "policy availability window closed",
+		CANCEL_CONTAINER_UNHEALTHY:      "workload container unhealthy",
 		AB_CANCEL_NOT_FINALIZED_TIMEOUT: "agreement bot never detected agreement on the blockchain",
 		AB_CANCEL_NO_REPLY:              "agreement bot never received reply to proposal",
 		AB_CANCEL_NEGATIVE_REPLY:        "agreement bot received negative reply",
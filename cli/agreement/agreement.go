@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"github.com/open-horizon/anax/cli/cliutils"
 	"github.com/open-horizon/anax/persistence"
+	"github.com/open-horizon/anax/torrent"
 )
 
 type ActiveAgreement struct {
@@ -18,6 +19,19 @@ type ActiveAgreement struct {
 	AgreementDataReceivedTime   string                   `json:"agreement_data_received_time"`
 	AgreementProtocol           string                   `json:"agreement_protocol"` // the agreement protocol being used. It is also in the proposal.
 	Workload                    persistence.WorkloadInfo `json:"workload_to_run"`
+	ImageFetches                []ImageFetch             `json:"image_fetches,omitempty"` // the images that are being, or were recently, fetched for the agreement
+}
+
+// The progress of fetching one of the images of an agreement
+type ImageFetch struct {
+	Image      string `json:"image"`
+	State      string `json:"state"`
+	BytesDone  int64  `json:"bytes_done"`
+	BytesTotal int64  `json:"bytes_total"`
+	LayersDone int    `json:"layers_done"`
+	Layers     int    `json:"layers"`
+	ETASeconds int64  `json:"eta_seconds"` // -1 when the remaining time is not known yet
+	Error      string `json:"error,omitempty"`
 }
 
 // CopyAgreementInto copies the agreement info into our output struct
@@ -92,6 +106,32 @@ func getAgreements(archivedAgreements bool) (apiAgreements []persistence.Establi
 	return
 }
 
+// getImageFetches returns the progress of the image fetches that anax reports in the workload output, by agreement id
+func getImageFetches() map[string][]ImageFetch {
+	var apiOutput struct {
+		ImageFetches []torrent.ImageProgress `json:"image_fetches"`
+	}
+	cliutils.HorizonGet("workload", []int{200}, &apiOutput)
+
+	fetches := make(map[string][]ImageFetch)
+	for _, p := range apiOutput.ImageFetches {
+		if p.Reference == "" {
+			continue
+		}
+		fetches[p.Reference] = append(fetches[p.Reference], ImageFetch{
+			Image:      p.Image,
+			State:      p.State,
+			BytesDone:  p.BytesDone,
+			BytesTotal: p.BytesTotal,
+			LayersDone: p.LayersDone,
+			Layers:     p.Layers,
+			ETASeconds: p.ETASeconds,
+			Error:      p.Error,
+		})
+	}
+	return fetches
+}
+
 func List(archivedAgreements bool, agreementId string) {
 	apiAgreements := getAgreements(archivedAgreements)
 
@@ -114,8 +154,13 @@ func List(archivedAgreements bool, agreementId string) {
 		// Listing all active or archived agreements. Go thru apiAgreements and convert into our output struct and then print
 		if !archivedAgreements {
 			agreements := make([]ActiveAgreement, len(apiAgreements))
+			var fetches map[string][]ImageFetch
+			if len(apiAgreements) > 0 {
+				fetches = getImageFetches()
+			}
 			for i := range apiAgreements {
 				agreements[i].CopyAgreementInto(apiAgreements[i])
+				agreements[i].ImageFetches = fetches[apiAgreements[i].CurrentAgreementId]
 			}
 			jsonBytes, err := json.MarshalIndent(agreements, "", cliutils.JSON_INDENT)
 			if err != nil {
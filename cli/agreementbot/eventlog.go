@@ -0,0 +1,15 @@
+package agreementbot
+
+import (
+	"github.com/open-horizon/anax/cli/cliutils"
+	"github.com/open-horizon/anax/cli/eventlog"
+	"os"
+)
+
+// EventLogList displays the events journaled by the agbot.
+func EventLogList(eventId string, agreementId string, since string, until string) {
+	// set env to call agbot url
+	os.Setenv("HORIZON_URL", cliutils.AGBOT_HZN_API)
+
+	eventlog.List(eventId, agreementId, since, until)
+}
@@ -0,0 +1,31 @@
+package agreementbot
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/open-horizon/anax/agreementbot"
+	"github.com/open-horizon/anax/cli/cliutils"
+	"net/url"
+	"os"
+)
+
+// PolicyExplain shows, clause by clause, why the given node is or is not compatible with the policies this agbot is serving.
+func PolicyExplain(node string, policyName string) {
+	// set env to call agbot url
+	os.Setenv("HORIZON_URL", cliutils.AGBOT_HZN_API)
+
+	params := url.Values{}
+	params.Set("node", node)
+	if policyName != "" {
+		params.Set("policy", policyName)
+	}
+
+	explanation := agreementbot.NodePolicyExplanation{}
+	cliutils.HorizonGet("policy/explain?"+params.Encode(), []int{200}, &explanation)
+
+	jsonBytes, err := json.MarshalIndent(explanation, "", cliutils.JSON_INDENT)
+	if err != nil {
+		cliutils.Fatal(cliutils.JSON_PARSING_ERROR, "failed to marshal 'hzn agbot policy explain' output: %v", err)
+	}
+	fmt.Printf("%s\n", jsonBytes)
+}
@@ -0,0 +1,72 @@
+package agreementbot
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/open-horizon/anax/agreementbot"
+	"github.com/open-horizon/anax/cli/cliutils"
+	"net/http"
+	"os"
+)
+
+// RolloutList shows all of the rollouts of this agbot, or just the one given.
+func RolloutList(id string) {
+	// set env to call agbot url
+	os.Setenv("HORIZON_URL", cliutils.AGBOT_HZN_API)
+
+	var output interface{}
+	if id != "" {
+		rollout := agreementbot.Rollout{}
+		cliutils.HorizonGet("rollout/"+id, []int{200}, &rollout)
+		output = rollout
+	} else {
+		rollouts := make([]agreementbot.Rollout, 0)
+		cliutils.HorizonGet("rollout", []int{200}, &rollouts)
+		output = rollouts
+	}
+
+	jsonBytes, err := json.MarshalIndent(output, "", cliutils.JSON_INDENT)
+	if err != nil {
+		cliutils.Fatal(cliutils.JSON_PARSING_ERROR, "failed to marshal 'hzn agbot rollout list' output: %v", err)
+	}
+	fmt.Printf("%s\n", jsonBytes)
+}
+
+// RolloutStart starts a staged rollout of the workload with the given priority, or version, to the devices that have
+// agreements from the given policy.
+func RolloutStart(org string, policyName string, priority int, version string, canary []string, batchPercent int, soakTimeS int, maxFailureRatio float64, onFailure string) {
+	if priority == 0 && version == "" {
+		cliutils.Fatal(cliutils.CLI_INPUT_ERROR, "either --priority or --version must be specified.")
+	}
+
+	// set env to call agbot url
+	os.Setenv("HORIZON_URL", cliutils.AGBOT_HZN_API)
+
+	request := agreementbot.RolloutRequest{
+		Org:      org,
+		Policy:   policyName,
+		Priority: priority,
+		Version:  version,
+		Plan: agreementbot.RolloutPlan{
+			Canary:          canary,
+			BatchPercent:    batchPercent,
+			SoakTimeS:       soakTimeS,
+			MaxFailureRatio: maxFailureRatio,
+			OnFailure:       onFailure,
+		},
+	}
+	if ok, msg := request.IsValid(); !ok {
+		cliutils.Fatal(cliutils.CLI_INPUT_ERROR, msg)
+	}
+	cliutils.HorizonPutPost(http.MethodPost, "rollout", []int{201}, request)
+	fmt.Printf("Rollout of policy %v started. Use 'hzn agbot rollout list' to follow it.\n", policyName)
+}
+
+// RolloutAction pauses, resumes or rolls back the given rollout.
+func RolloutAction(id string, action string) {
+	// set env to call agbot url
+	os.Setenv("HORIZON_URL", cliutils.AGBOT_HZN_API)
+
+	cliutils.HorizonPutPost(http.MethodPost, "rollout/"+id+"/"+action, []int{200}, nil)
+	fmt.Printf("Rollout %v: %v requested.\n", id, action)
+}
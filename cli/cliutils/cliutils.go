@@ -285,6 +285,28 @@ func HorizonGet(urlSuffix string, goodHttpCodes []int, structure interface{}) (h
 	return
 }
 
+// HorizonStream runs a GET on the anax api and copies the response body to the writer as it arrives, for responses
+// that are streamed, e.g. followed container logs. It exits with an error when the http code is not 200.
+func HorizonStream(urlSuffix string, out io.Writer) {
+	url := GetHorizonUrlBase() + "/" + urlSuffix
+	apiMsg := http.MethodGet + " " + url
+	Verbose(apiMsg)
+	resp, err := http.Get(url)
+	if err != nil {
+		printHorizonRestError(apiMsg, err)
+	}
+	defer resp.Body.Close()
+	Verbose("HTTP code: %d", resp.StatusCode)
+	if resp.StatusCode == ANAX_NOT_CONFIGURED_YET {
+		Fatal(HTTP_ERROR, MUST_REGISTER_FIRST)
+	} else if resp.StatusCode != http.StatusOK {
+		Fatal(HTTP_ERROR, "bad HTTP code from %s: %d, %s", apiMsg, resp.StatusCode, strings.TrimSpace(GetRespBodyAsString(resp.Body)))
+	}
+	if _, err := io.Copy(out, resp.Body); err != nil {
+		Fatal(HTTP_ERROR, "failed to read body response from %s: %v", apiMsg, err)
+	}
+}
+
 // HorizonDelete runs a DELETE on the anax api.
 // If the list of goodHttpCodes is not empty and none match the actual http code, it will exit with an error. Otherwise the actual code is returned.
 func HorizonDelete(urlSuffix string, goodHttpCodes []int) (httpCode int) {
@@ -389,7 +389,7 @@ func startMicroservice(deployment *containermessage.DeploymentDescription,
 	fmt.Printf("Start microservice: %v with instance id prefix %v\n", dc.CLIString(), msId)
 
 	// Start the microservice container.
-	_, startErr := cw.ResourcesCreate(msId, nil, deployment, []byte(""), environmentAdditions, map[string]docker.ContainerNetwork{})
+	_, startErr := cw.ResourcesCreate(msId, nil, deployment, []byte(""), environmentAdditions, map[string]docker.ContainerNetwork{}, nil)
 	if startErr != nil {
 		return nil, errors.New(fmt.Sprintf("unable to start container using %v, error: %v", dc.CLIString(), startErr))
 	}
@@ -0,0 +1,57 @@
+package eventlog
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/open-horizon/anax/cli/cliutils"
+	"github.com/open-horizon/anax/eventlog"
+	"net/url"
+)
+
+type EventRecord struct {
+	Timestamp   string `json:"timestamp"`
+	EventId     string `json:"event_id"`
+	AgreementId string `json:"agreement_id,omitempty"`
+	Source      string `json:"source"`
+	Description string `json:"description"`
+}
+
+// CopyEventRecordInto copies the journaled event into our output struct
+func (e *EventRecord) CopyEventRecordInto(record eventlog.EventRecord) {
+	e.Timestamp = cliutils.ConvertTime(record.Timestamp)
+	e.EventId = record.EventId
+	e.AgreementId = record.AgreementId
+	e.Source = record.Source
+	e.Description = record.Description
+}
+
+// List displays the journaled events that match all of the non-empty arguments. The since and until arguments are in seconds since 1970.
+func List(eventId string, agreementId string, since string, until string) {
+	params := url.Values{}
+	if eventId != "" {
+		params.Set("event_id", eventId)
+	}
+	if agreementId != "" {
+		params.Set("agreement_id", agreementId)
+	}
+	if since != "" {
+		params.Set("since", since)
+	}
+	if until != "" {
+		params.Set("until", until)
+	}
+
+	apiOutput := make([]eventlog.EventRecord, 0)
+	cliutils.HorizonGet("eventlog?"+params.Encode(), []int{200}, &apiOutput)
+
+	// Go thru the records and convert into our output struct and then print
+	records := make([]EventRecord, len(apiOutput))
+	for i := range apiOutput {
+		records[i].CopyEventRecordInto(apiOutput[i])
+	}
+	jsonBytes, err := json.MarshalIndent(records, "", cliutils.JSON_INDENT)
+	if err != nil {
+		cliutils.Fatal(cliutils.JSON_PARSING_ERROR, "failed to marshal 'hzn eventlog list' output: %v", err)
+	}
+	fmt.Printf("%s\n", jsonBytes)
+}
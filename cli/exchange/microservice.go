@@ -29,6 +29,18 @@ func (dc DeploymentConfig) CLIString() string {
 	return fmt.Sprintf("service(s) %v", servs)
 }
 
+// Check the deployment config the way the node checks it before it starts the containers, context is workload or
+// infrastructure.
+func (dc DeploymentConfig) Validate(context string) error {
+	dd := containermessage.DeploymentDescription{Services: dc.Services}
+	if err := dd.ValidateSecurity(); err != nil {
+		return err
+	} else if !dd.IsValidFor(context) {
+		return errors.New(fmt.Sprintf("deployment config contains a setting that is not supported for a %v", context))
+	}
+	return nil
+}
+
 func (dc DeploymentConfig) String() string {
 
 	res := ""
@@ -125,6 +137,11 @@ func ConvertToDeploymentConfig(deployment interface{}) *DeploymentConfig {
 func (mf *MicroserviceFile) ConvertToDeploymentDescription() (*DeploymentConfig, *containermessage.DeploymentDescription, error) {
 	for _, wl := range mf.Workloads {
 		depConfig := ConvertToDeploymentConfig(wl.Deployment)
+		if depConfig != nil {
+			if err := depConfig.Validate("infrastructure"); err != nil {
+				return nil, nil, err
+			}
+		}
 		return depConfig, &containermessage.DeploymentDescription{
 			Services: depConfig.Services,
 			ServicePattern: containermessage.Pattern{
@@ -286,6 +303,9 @@ func (mf *MicroserviceFile) SignAndPublish(org, userPw, keyFilePath string) (exc
 			microInput.Workloads[i].Deployment = ""
 			microInput.Workloads[i].DeploymentSignature = ""
 		} else {
+			if err := depConfig.Validate("infrastructure"); err != nil {
+				cliutils.Fatal(cliutils.CLI_INPUT_ERROR, "deployment string %d is not valid: %v", i+1, err)
+			}
 			cliutils.Verbose("signing deployment string %d", i+1)
 			deployment, err = json.Marshal(depConfig)
 			if err != nil {
@@ -45,6 +45,11 @@ func (wf *WorkloadFile) DefinesVariable(name string) string {
 func (wf *WorkloadFile) ConvertToDeploymentDescription() (*DeploymentConfig, *containermessage.DeploymentDescription, error) {
 	for _, wl := range wf.Workloads {
 		depConfig := ConvertToDeploymentConfig(wl.Deployment)
+		if depConfig != nil {
+			if err := depConfig.Validate("workload"); err != nil {
+				return nil, nil, err
+			}
+		}
 		return depConfig, &containermessage.DeploymentDescription{
 			Services: depConfig.Services,
 			ServicePattern: containermessage.Pattern{
@@ -165,6 +170,9 @@ func (wf *WorkloadFile) SignAndPublish(org, userPw, keyFilePath string) (exchId
 			workInput.Workloads[i].Deployment = ""
 			workInput.Workloads[i].DeploymentSignature = ""
 		} else {
+			if err := depConfig.Validate("workload"); err != nil {
+				cliutils.Fatal(cliutils.CLI_INPUT_ERROR, "deployment string %d is not valid: %v", i+1, err)
+			}
 			cliutils.Verbose("signing deployment string %d", i+1)
 			deployment, err = json.Marshal(depConfig)
 			if err != nil {
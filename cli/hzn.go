@@ -7,10 +7,12 @@ import (
 	"github.com/open-horizon/anax/cli/attribute"
 	"github.com/open-horizon/anax/cli/cliutils"
 	"github.com/open-horizon/anax/cli/dev"
+	"github.com/open-horizon/anax/cli/eventlog"
 	"github.com/open-horizon/anax/cli/exchange"
 	"github.com/open-horizon/anax/cli/key"
 	"github.com/open-horizon/anax/cli/metering"
 	"github.com/open-horizon/anax/cli/node"
+	"github.com/open-horizon/anax/cli/policy"
 	"github.com/open-horizon/anax/cli/register"
 	"github.com/open-horizon/anax/cli/service"
 	"github.com/open-horizon/anax/cli/unregister"
@@ -242,9 +244,24 @@ Environment Variables:
 	serviceCmd := app.Command("service", "List or manage the microservices that are currently registered on this Horizon edge node.")
 	serviceListCmd := serviceCmd.Command("list", "List the microservices variable configuration that has been done on this Horizon edge node.")
 	serviceRegisteredCmd := serviceCmd.Command("registered", "List the microservices that are currently registered on this Horizon edge node.")
+	serviceLogsCmd := serviceCmd.Command("logs", "Display the logs of the containers of a microservice running on this Horizon edge node. The containers must use the json-file, local or journald log driver.")
+	serviceLogsId := serviceLogsCmd.Arg("microservice", "The URL of the microservice, the key of a microservice instance, or the name of a service in the microservice.").Required().String()
+	serviceLogsTail := serviceLogsCmd.Flag("tail", "Display only this number of lines from the end of each log.").Short('t').String()
+	serviceLogsFollow := serviceLogsCmd.Flag("follow", "Keep displaying the logs as they are written, until interrupted.").Short('f').Bool()
 
 	workloadCmd := app.Command("workload", "List or manage the workloads that are currently registered on this Horizon edge node.")
 	workloadListCmd := workloadCmd.Command("list", "List the workloads that are currently registered on this Horizon edge node.")
+	workloadLogsCmd := workloadCmd.Command("logs", "Display the logs of the workload containers running on this Horizon edge node. The containers must use the json-file, local or journald log driver.")
+	workloadLogsId := workloadLogsCmd.Arg("agreement|service", "The agreement id of the workload, or the name of a service in the workload.").Required().String()
+	workloadLogsTail := workloadLogsCmd.Flag("tail", "Display only this number of lines from the end of each log.").Short('t').String()
+	workloadLogsFollow := workloadLogsCmd.Flag("follow", "Keep displaying the logs as they are written, until interrupted.").Short('f').Bool()
+
+	eventlogCmd := app.Command("eventlog", "List the events that the Horizon agent has journaled.")
+	eventlogListCmd := eventlogCmd.Command("list", "List the journaled events, oldest first. The agent journals events only when EventLogRetentionHours is set in its config.")
+	eventlogEventId := eventlogListCmd.Flag("event", "List only the events with this event id, e.g. AGREEMENT_ENDED.").Short('e').String()
+	eventlogAgreementId := eventlogListCmd.Flag("agreement", "List only the events about this agreement.").Short('a').String()
+	eventlogSince := eventlogListCmd.Flag("since", "List only the events journaled at or after this time, in seconds since 1970.").String()
+	eventlogUntil := eventlogListCmd.Flag("until", "List only the events journaled at or before this time, in seconds since 1970.").String()
 
 	unregisterCmd := app.Command("unregister", "Unregister and reset this Horizon edge node so that it is ready to be registered again. Warning: this will stop all the Horizon workloads running on this edge node, and restart the Horizon agent.")
 	forceUnregister := unregisterCmd.Flag("force", "Skip the 'are you sure?' prompt.").Short('f').Bool()
@@ -302,6 +319,44 @@ Environment Variables:
 
 	agbotListCmd := agbotCmd.Command("list", "Display general information about this Horizon agbot node.")
 
+	agbotPolicyCmd := agbotCmd.Command("policy", "Inspect the policies this Horizon agreement bot is serving.")
+	agbotPolicyExplainCmd := agbotPolicyCmd.Command("explain", "Explain, clause by clause, why an edge node is or is not compatible with the policies this Horizon agreement bot is serving.")
+	agbotPolicyExplainNode := agbotPolicyExplainCmd.Flag("node", "The edge node to explain, in the form org/id.").Short('n').Required().String()
+	agbotPolicyExplainPolicy := agbotPolicyExplainCmd.Flag("policy", "Explain only this one policy.").Short('p').String()
+
+	agbotRolloutCmd := agbotCmd.Command("rollout", "Roll out a workload upgrade to the edge nodes of a policy in stages, canary nodes first and then batches of nodes.")
+	agbotRolloutListCmd := agbotRolloutCmd.Command("list", "List the rollouts of this Horizon agreement bot.")
+	agbotRolloutListId := agbotRolloutListCmd.Arg("rollout", "List just this one rollout.").String()
+	agbotRolloutStartCmd := agbotRolloutCmd.Command("start", "Start a rollout of a workload upgrade to the edge nodes that have agreements from a policy. Each batch of nodes must stay healthy for the soak time before the next batch is upgraded.")
+	agbotRolloutStartOrg := agbotRolloutStartCmd.Arg("org", "The organization of the policy.").Required().String()
+	agbotRolloutStartPolicy := agbotRolloutStartCmd.Arg("policy", "The name of the policy.").Required().String()
+	agbotRolloutStartPriority := agbotRolloutStartCmd.Flag("priority", "The priority of the workload in the policy to upgrade to.").Short('p').Int()
+	agbotRolloutStartVersion := agbotRolloutStartCmd.Flag("version", "The version of the workload in the policy to upgrade to, when --priority is not given.").Short('V').String()
+	agbotRolloutStartCanary := agbotRolloutStartCmd.Flag("canary", "An edge node, in the form org/id, to upgrade in the first batch. This flag can be repeated.").Short('c').Strings()
+	agbotRolloutStartBatch := agbotRolloutStartCmd.Flag("batch", "The percentage of the edge nodes to upgrade in each batch after the canary nodes.").Short('b').Default("25").Int()
+	agbotRolloutStartSoak := agbotRolloutStartCmd.Flag("soak", "The number of seconds each batch must stay healthy before the next batch is upgraded.").Short('s').Default("600").Int()
+	agbotRolloutStartMaxFailure := agbotRolloutStartCmd.Flag("max-failure", "The ratio, from 0 to 1, of the edge nodes in a batch that can fail before the rollout stops.").Short('f').Default("0").Float64()
+	agbotRolloutStartOnFailure := agbotRolloutStartCmd.Flag("on-failure", "What to do when too many edge nodes in a batch fail: pause or rollback.").Default("pause").Enum("pause", "rollback")
+	agbotRolloutPauseCmd := agbotRolloutCmd.Command("pause", "Pause a running rollout.")
+	agbotRolloutPauseId := agbotRolloutPauseCmd.Arg("rollout", "The rollout to pause.").Required().String()
+	agbotRolloutResumeCmd := agbotRolloutCmd.Command("resume", "Resume a paused rollout, accepting the failures in its current batch.")
+	agbotRolloutResumeId := agbotRolloutResumeCmd.Arg("rollout", "The rollout to resume.").Required().String()
+	agbotRolloutRollbackCmd := agbotRolloutCmd.Command("rollback", "Roll back the edge nodes upgraded by a running or paused rollout to the workloads they had before.")
+	agbotRolloutRollbackId := agbotRolloutRollbackCmd.Arg("rollout", "The rollout to roll back.").Required().String()
+
+	agbotEventlogCmd := agbotCmd.Command("eventlog", "List the events that this Horizon agreement bot has journaled.")
+	agbotEventlogListCmd := agbotEventlogCmd.Command("list", "List the journaled events, oldest first. The agbot journals events only when EventLogRetentionHours is set in its config.")
+	agbotEventlogEventId := agbotEventlogListCmd.Flag("event", "List only the events with this event id, e.g. AGREEMENT_ENDED.").Short('e').String()
+	agbotEventlogAgreementId := agbotEventlogListCmd.Flag("agreement", "List only the events about this agreement.").Short('a').String()
+	agbotEventlogSince := agbotEventlogListCmd.Flag("since", "List only the events journaled at or after this time, in seconds since 1970.").String()
+	agbotEventlogUntil := agbotEventlogListCmd.Flag("until", "List only the events journaled at or before this time, in seconds since 1970.").String()
+
+	policyCmd := app.Command("policy", "Check policy files before they are deployed.")
+	policyLintCmd := policyCmd.Command("lint", "Statically check a policy file, a pattern file, or a directory of them, and report all of the problems found with their JSON pointer locations.")
+	policyLintPath := policyLintCmd.Arg("path", "The policy or pattern file, or a directory containing .policy and .json files, to check.").Required().String()
+	policyLintOrg := policyLintCmd.Flag("org", "The Horizon exchange organization ID, used to resolve the workloads the policies refer to.").Short('o').String()
+	policyLintUserPw := policyLintCmd.Flag("user-pw", "Horizon exchange user credentials. When specified, the workloads the policies refer to are resolved in the exchange.").Short('u').PlaceHolder("USER:PW").String()
+
 	app.Version("Run 'hzn version' to see the Horizon version.")
 	/* trying to override the base --version behavior does not work....
 	fmt.Printf("version: %v\n", *version)
@@ -325,6 +380,10 @@ Environment Variables:
 	if strings.HasPrefix(fullCmd, "register") {
 		userPw = cliutils.WithDefaultEnvVar(userPw, "HZN_EXCHANGE_USER_AUTH")
 	}
+	if strings.HasPrefix(fullCmd, "policy") {
+		policyLintOrg = cliutils.WithDefaultEnvVar(policyLintOrg, "HZN_ORG_ID")
+		policyLintUserPw = cliutils.WithDefaultEnvVar(policyLintUserPw, "HZN_EXCHANGE_USER_AUTH")
+	}
 
 	// Decide which command to run
 	switch fullCmd {
@@ -434,8 +493,14 @@ Environment Variables:
 		service.List()
 	case serviceRegisteredCmd.FullCommand():
 		service.Registered()
+	case serviceLogsCmd.FullCommand():
+		service.Logs(*serviceLogsId, *serviceLogsTail, *serviceLogsFollow)
 	case workloadListCmd.FullCommand():
 		workload.List()
+	case workloadLogsCmd.FullCommand():
+		workload.Logs(*workloadLogsId, *workloadLogsTail, *workloadLogsFollow)
+	case eventlogListCmd.FullCommand():
+		eventlog.List(*eventlogEventId, *eventlogAgreementId, *eventlogSince, *eventlogUntil)
 	case unregisterCmd.FullCommand():
 		unregister.DoIt(*forceUnregister, *removeNodeUnregister)
 	case devWorkloadNewCmd.FullCommand():
@@ -470,5 +535,21 @@ Environment Variables:
 		agreementbot.AgreementCancel(*agbotCancelAgreementId, *agbotCancelAllAgreements)
 	case agbotListCmd.FullCommand():
 		agreementbot.List()
+	case agbotPolicyExplainCmd.FullCommand():
+		agreementbot.PolicyExplain(*agbotPolicyExplainNode, *agbotPolicyExplainPolicy)
+	case policyLintCmd.FullCommand():
+		policy.Lint(*policyLintPath, *policyLintOrg, *policyLintUserPw)
+	case agbotEventlogListCmd.FullCommand():
+		agreementbot.EventLogList(*agbotEventlogEventId, *agbotEventlogAgreementId, *agbotEventlogSince, *agbotEventlogUntil)
+	case agbotRolloutListCmd.FullCommand():
+		agreementbot.RolloutList(*agbotRolloutListId)
+	case agbotRolloutStartCmd.FullCommand():
+		agreementbot.RolloutStart(*agbotRolloutStartOrg, *agbotRolloutStartPolicy, *agbotRolloutStartPriority, *agbotRolloutStartVersion, *agbotRolloutStartCanary, *agbotRolloutStartBatch, *agbotRolloutStartSoak, *agbotRolloutStartMaxFailure, *agbotRolloutStartOnFailure)
+	case agbotRolloutPauseCmd.FullCommand():
+		agreementbot.RolloutAction(*agbotRolloutPauseId, "pause")
+	case agbotRolloutResumeCmd.FullCommand():
+		agreementbot.RolloutAction(*agbotRolloutResumeId, "resume")
+	case agbotRolloutRollbackCmd.FullCommand():
+		agreementbot.RolloutAction(*agbotRolloutRollbackId, "rollback")
 	}
 }
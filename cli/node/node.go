@@ -29,6 +29,7 @@ type NodeAndStatus struct {
 	Geths         []apicommon.Geth         `json:"geth"`
 	Configuration *apicommon.Configuration `json:"configuration"`
 	Connectivity  map[string]bool          `json:"connectivity"`
+	Disk          *apicommon.DiskState     `json:"disk,omitempty"`
 }
 
 // CopyNodeInto copies the node info into our output struct and converts times in the process
@@ -56,6 +57,7 @@ func (n *NodeAndStatus) CopyStatusInto(status *apicommon.Info) {
 	n.Geths = status.Geths
 	n.Configuration = status.Configuration
 	n.Connectivity = status.Connectivity
+	n.Disk = status.Disk
 }
 
 func List() {
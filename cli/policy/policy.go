@@ -0,0 +1,149 @@
+package policy
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/open-horizon/anax/cli/cliutils"
+	cliexchange "github.com/open-horizon/anax/cli/exchange"
+	"github.com/open-horizon/anax/config"
+	"github.com/open-horizon/anax/exchange"
+	"github.com/open-horizon/anax/policy"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Lint statically checks the policy files or pattern files at the given path, which is a file or a directory of files. When exchange
+// credentials are given, the workloads that the policies reference are resolved in the exchange.
+func Lint(path string, org string, userPw string) {
+	files := make([]string, 0, 10)
+	if fi, err := os.Stat(path); err != nil {
+		cliutils.Fatal(cliutils.CLI_INPUT_ERROR, "unable to access %v: %v", path, err)
+	} else if !fi.IsDir() {
+		files = append(files, path)
+	} else if infos, err := ioutil.ReadDir(path); err != nil {
+		cliutils.Fatal(cliutils.CLI_INPUT_ERROR, "unable to read directory %v: %v", path, err)
+	} else {
+		// Anax only loads policy files with the .policy suffix from a policy directory, pattern files are usually .json files
+		for _, info := range infos {
+			if !info.IsDir() && (strings.HasSuffix(info.Name(), ".policy") || strings.HasSuffix(info.Name(), ".json")) {
+				files = append(files, filepath.Join(path, info.Name()))
+			}
+		}
+	}
+
+	var resolver func(wURL string, wOrg string, wVersion string, wArch string) (*policy.APISpecList, error)
+	if userPw != "" {
+		resolver = workloadResolver(org, userPw)
+	}
+
+	// Policy files are linted together so that conflicts between them are found, pattern files are linted on their own
+	policyFiles := make([]string, 0, 10)
+	issues := make([]policy.LintIssue, 0, 10)
+	for _, file := range files {
+		if isPatternFile(file) {
+			issues = append(issues, lintPatternFile(file)...)
+		} else {
+			policyFiles = append(policyFiles, file)
+		}
+	}
+	issues = append(issues, policy.LintPolicyFiles(policyFiles, resolver)...)
+
+	jsonBytes, err := json.MarshalIndent(issues, "", cliutils.JSON_INDENT)
+	if err != nil {
+		cliutils.Fatal(cliutils.JSON_PARSING_ERROR, "failed to marshal 'hzn policy lint' output: %v", err)
+	}
+	fmt.Printf("%s\n", jsonBytes)
+
+	if len(issues) != 0 {
+		cliutils.Fatal(cliutils.CLI_GENERAL_ERROR, "found %v problems in %v", len(issues), path)
+	}
+}
+
+// A pattern file is a pattern definition as used by 'hzn exchange pattern publish'. Unlike a policy it has no header.
+func isPatternFile(file string) bool {
+	var generic map[string]interface{}
+	if doc, err := ioutil.ReadFile(file); err != nil {
+		return false
+	} else if err := json.Unmarshal(doc, &generic); err != nil {
+		return false
+	} else {
+		_, hasHeader := generic["header"]
+		_, hasWorkloads := generic["workloads"]
+		return !hasHeader && hasWorkloads
+	}
+}
+
+// Lint a pattern file. The checks that apply to the workloads of a policy also apply to the workloads of a pattern.
+func lintPatternFile(file string) []policy.LintIssue {
+	issues := make([]policy.LintIssue, 0, 10)
+
+	doc, err := ioutil.ReadFile(file)
+	if err != nil {
+		return append(issues, policy.LintIssue{File: file, Message: fmt.Sprintf("unable to read file, error: %v", err)})
+	}
+
+	var generic map[string]interface{}
+	pattern := new(cliexchange.PatternFile)
+	if err := json.Unmarshal(doc, &generic); err != nil {
+		return append(issues, policy.LintIssue{File: file, Message: fmt.Sprintf("not a JSON object, error: %v", err)})
+	} else if err := json.Unmarshal(doc, pattern); err != nil {
+		return append(issues, policy.LintIssue{File: file, Message: fmt.Sprintf("not a pattern, error: %v", err)})
+	}
+
+	issues = append(issues, policy.LintUnknownFields(generic, pattern)...)
+
+	for ix, wl := range pattern.Workloads {
+		if wl.WorkloadURL == "" {
+			issues = append(issues, policy.LintIssue{Location: policy.JSONPointer("workloads", ix, "workloadUrl"), Message: "the workload has no workloadUrl"})
+		}
+		if wl.WorkloadOrg == "" {
+			issues = append(issues, policy.LintIssue{Location: policy.JSONPointer("workloads", ix, "workloadOrgid"), Message: fmt.Sprintf("workload %v has no organization", wl.WorkloadURL)})
+		}
+		if wl.WorkloadArch == "" {
+			issues = append(issues, policy.LintIssue{Location: policy.JSONPointer("workloads", ix, "workloadArch"), Message: fmt.Sprintf("workload %v has no architecture", wl.WorkloadURL)})
+		}
+
+		priorities := make(map[int]int)
+		for vx, choice := range wl.WorkloadVersions {
+			if !policy.IsVersionString(choice.Version) {
+				issues = append(issues, policy.LintIssue{Location: policy.JSONPointer("workloads", ix, "workloadVersions", vx, "version"), Message: fmt.Sprintf("%v is not a valid version string", choice.Version)})
+			}
+			if len(wl.WorkloadVersions) > 1 {
+				pointer := policy.JSONPointer("workloads", ix, "workloadVersions", vx, "priority", "priority_value")
+				if choice.Priority.PriorityValue == 0 {
+					issues = append(issues, policy.LintIssue{Location: pointer, Message: "a priority is required when there is more than 1 workload version"})
+				} else if first, ok := priorities[choice.Priority.PriorityValue]; ok {
+					issues = append(issues, policy.LintIssue{Location: pointer, Message: fmt.Sprintf("priority %v is already used by %v", choice.Priority.PriorityValue, policy.JSONPointer("workloads", ix, "workloadVersions", first))})
+				} else {
+					priorities[choice.Priority.PriorityValue] = vx
+				}
+			}
+		}
+
+		dv := policy.DataVerification{Enabled: wl.DataVerify.Enabled, Interval: wl.DataVerify.Interval, CheckRate: wl.DataVerify.CheckRate,
+			Metering: policy.Meter{Tokens: wl.DataVerify.Metering.Tokens, PerTimeUnit: wl.DataVerify.Metering.PerTimeUnit, NotificationIntervalS: wl.DataVerify.Metering.NotificationIntervalS}}
+		nh := policy.NodeHealth_Factory(wl.NodeH.MissingHBInterval, wl.NodeH.CheckAgreementStatus)
+		issues = append(issues, policy.LintDataVerification(dv, *nh, policy.JSONPointer("workloads", ix, "dataVerification"))...)
+	}
+
+	policy.SortLintIssues(issues)
+	for ix := range issues {
+		issues[ix].File = file
+	}
+	return issues
+}
+
+// Returns a function that resolves workload references in the exchange, using the given exchange user credentials.
+func workloadResolver(org string, userPw string) func(wURL string, wOrg string, wVersion string, wArch string) (*policy.APISpecList, error) {
+	id, token := cliutils.SplitIdToken(cliutils.OrgAndCreds(org, userPw))
+	httpClientFactory := &config.HTTPClientFactory{NewHTTPClient: func(overrideTimeoutS *uint) *http.Client { return &http.Client{} }}
+	exchUrl := cliutils.GetExchangeUrl() + "/"
+
+	return func(wURL string, wOrg string, wVersion string, wArch string) (*policy.APISpecList, error) {
+		apiSpecs, _, err := exchange.WorkloadResolver(httpClientFactory, wURL, wOrg, wVersion, wArch, exchUrl, id, token)
+		return apiSpecs, err
+	}
+}
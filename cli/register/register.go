@@ -2,6 +2,7 @@ package register
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"github.com/open-horizon/anax/api"
 	"github.com/open-horizon/anax/cli/cliutils"
@@ -48,6 +49,32 @@ func ReadInputFile(filePath string, inputFileStruct *InputFile) {
 	if err != nil {
 		cliutils.Fatal(cliutils.JSON_PARSING_ERROR, "failed to unmarshal json input file %s: %v", filePath, err)
 	}
+
+	// Verify the counter party property expressions now, so that a mistake in one is reported before any of the input file is applied
+	for _, g := range inputFileStruct.Global {
+		if g.Type == "CounterPartyPropertyAttributes" {
+			if err := verifyCounterPartyExpression(g.Variables); err != nil {
+				cliutils.Fatal(cliutils.CLI_INPUT_ERROR, "invalid counter party property expression in input file %s: %v", filePath, err)
+			}
+		}
+	}
+}
+
+// Verify that the expression variable of a CounterPartyPropertyAttributes global set is a valid RequiredProperty expression.
+func verifyCounterPartyExpression(variables map[string]interface{}) error {
+	rawExpression, ok := variables["expression"]
+	if !ok {
+		return errors.New("missing the expression variable")
+	}
+	exp, ok := rawExpression.(map[string]interface{})
+	if !ok {
+		return errors.New(fmt.Sprintf("expression is %T, it should be a json object", rawExpression))
+	}
+	rp := policy.RequiredProperty_Factory()
+	if err := rp.Initialize(&exp); err != nil {
+		return err
+	}
+	return rp.IsValid()
 }
 
 // DoIt registers this node to Horizon with a pattern
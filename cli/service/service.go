@@ -8,6 +8,8 @@ import (
 	"github.com/open-horizon/anax/cutil"
 	"github.com/open-horizon/anax/persistence"
 	"github.com/open-horizon/anax/policy"
+	"net/url"
+	"os"
 )
 
 type APIMicroservices struct {
@@ -92,3 +94,17 @@ func Registered() {
 	}
 	fmt.Printf("%s\n", jsonBytes)
 }
+
+// Logs writes the logs of the containers of a microservice to stdout. The microservice is identified by its URL,
+// the key of one of its instances, or the name of one of its services.
+func Logs(id string, tail string, follow bool) {
+	query := url.Values{}
+	query.Set("id", id)
+	if tail != "" {
+		query.Set("tail", tail)
+	}
+	if follow {
+		query.Set("follow", "true")
+	}
+	cliutils.HorizonStream("microservice/logs?"+query.Encode(), os.Stdout)
+}
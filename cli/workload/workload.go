@@ -5,6 +5,8 @@ import (
 	"fmt"
 	dockerclient "github.com/fsouza/go-dockerclient"
 	"github.com/open-horizon/anax/cli/cliutils"
+	"net/url"
+	"os"
 )
 
 // Can't use the api and persistence structs because the Attributes type isn't detailed enough to drill down into it
@@ -63,3 +65,16 @@ func List() {
 	}
 	fmt.Printf("%s\n", jsonBytes)
 }
+
+// Logs writes the logs of the workload containers of an agreement, or of a workload service, to stdout.
+func Logs(id string, tail string, follow bool) {
+	query := url.Values{}
+	query.Set("id", id)
+	if tail != "" {
+		query.Set("tail", tail)
+	}
+	if follow {
+		query.Set("follow", "true")
+	}
+	cliutils.HorizonStream("workload/logs?"+query.Encode(), os.Stdout)
+}
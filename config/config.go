@@ -43,6 +43,34 @@ type Config struct {
 	UserPublicKeyPath             string // The location to store user keys uploaded through the REST API
 	ReportDeviceStatus            bool   // whether to report the device status to the exchange or not.
 	TrustCertUpdatesFromOrg       bool   // whether to trust the certs provided by the orgnization on the exchange or not. The default is true.
+	EventLogRetentionHours        int    // Number of hours to keep records in the event journal. Zero means the event journal is turned off.
+	EventLogMaxRecords            int    // The maximum number of records kept in the event journal, default 10000
+	RequireImageDigestOrgs        string // A comma separated list of orgs whose docker images must be referenced by digest instead of by tag, "*" means all orgs. The default is no orgs.
+	ContainerLogDriver            string // The docker log driver of workload and microservice containers: json-file (the default), local, journald, syslog or fluentd. Container logs can be read through the API only with json-file, local or journald.
+	ContainerLogMaxSizeMB         int    // For the json-file and local log drivers, the size of a container log before it is rotated, default 10
+	ContainerLogMaxFiles          int    // For the json-file and local log drivers, the number of rotated logs kept for each container, default 3
+	ContainerLogFluentdAddress    string // For the fluentd log driver, the address of the local fluentd, default unix:///var/run/fluentd/fluentd.sock
+	ImageGCDiskPath               string // A directory on the filesystem where docker keeps its images, default /var/lib/docker
+	ImageGCHighWatermark          int    // The disk usage percent at which images that are no longer used by agreements or microservices are removed, default 85. 100 turns image removal off.
+	ImageGCLowWatermark           int    // Images are removed until the disk usage percent is below this, default 75
+	ImageGCIntervalS              int    // The number of seconds between checks of the disk usage, default 300
+	MinFreeDiskMB                 uint64 // New agreements are refused while less than this number of MB is free on the image filesystem. Zero, the default, means never.
+	ImagePrefetch                 bool   // Fetch the images of the pattern's workloads and microservices in the background when the node is configured
+	ImagePrefetchMaxKBps          int    // The bandwidth limit of the image pre-fetch in KB per second, default 0 means unlimited
+	ImageFetchMaxAttempts         int    // The number of times an image fetch is tried before the agreement is cancelled, default 5
+	ImageFetchBackoffS            int    // The number of seconds before the first retry of a registry, doubled after each failure, default 10
+	ImageFetchMaxBackoffS         int    // The longest number of seconds between retries of a registry, default 300
+	ImageFetchDeadlineS           int    // The number of seconds an image fetch is retried for, default 300. It is cut to half of MAX_CONTRACT_PRELAUNCH_TIME_M or AgreementTimeoutS when it is not under them.
+	RegistryMirror                string // The host:port of a site-local docker registry mirror that images are pulled from before their own registry. Images are pulled from it by digest, the digest of a tag is resolved in the image's own registry.
+	PeerCacheListen               string // The address to serve the package files that this node fetched to other nodes of the site on, e.g. ":8510". Empty, the default, turns the peer cache off.
+	PeerCacheNodes                string // A comma separated list of host:port of the nodes of the site to ask for package files before the origin
+	InboundPermitOnly             string // A comma separated list of the addresses and CIDRs that may reach the host ports published by service containers. Empty, the default, permits all sources.
+	InterAgreementTraffic         string // Whether the containers of different agreements can reach each other: none (the default), org for agreements whose workloads are in the same org, or all
+	SeccompProfileDir             string // The directory of the seccomp profiles that services can name in their deployment description, each profile is in <name>.json, default /etc/horizon/seccomp
+
+	// The seccomp and AppArmor profiles that the services of each org may name in their deployment description, keyed by
+	// org. The "*" entry applies to the orgs that have no entry of their own. By default no profiles may be named.
+	SecurityAllowLists map[string]SecurityAllowList
 
 	// these Ids could be provided in config or discovered after startup by the system
 	BlockchainAccountId        string
@@ -76,6 +104,14 @@ type AGConfig struct {
 	APIListen                    string // Host and port for the API to listen on
 	PurgeArchivedAgreementHours  int    // Number of hours to leave an archived agreement in the database before automatically deleting it
 	CheckUpdatedPolicyS          int    // The number of seconds to wait between checks for an updated policy file. Zero means auto checking is turned off.
+	EventLogRetentionHours       int    // Number of hours to keep records in the event journal. Zero means the event journal is turned off.
+	EventLogMaxRecords           int    // The maximum number of records kept in the event journal, default 10000
+	PartitionAgbots              bool   // When true, the agbots in this agbot's org and the orgs of its patterns that serve the same patterns split the nodes between them.
+	PartitionMemberTimeoutS      int    // The number of seconds an agbot can go without heartbeating and still own its share of the nodes, default 3 heartbeats
+	PartitionStableS             int    // The number of seconds the agbots sharing the nodes must be unchanged before agreements with nodes that moved to another agbot are handed off, default twice PartitionMemberTimeoutS
+	SearchIntervalS              int    // The number of seconds between searches of the exchange for the nodes of a policy, default 10
+	FullSearchIntervalS          int    // The number of seconds between searches for all the nodes of a policy, the searches in between only look for changed nodes, default 300
+	SearchPageSize               int    // The number of nodes read from the exchange in one search request, default 100
 }
 
 func (c *HorizonConfig) UserPublicKeyPath() string {
@@ -8,6 +8,9 @@ const USERKEYDIR = "/userkeys"
 // container start execution timeout for a microservice upgrade
 const MICROSERVICE_EXEC_TIMEOUT = 180
 
+// the max time an agreement can take to launch its workload after it is accepted, including the image fetch
+const MAX_CONTRACT_PRELAUNCH_TIME_M = 10
+
 // MaxHTTPIdleConnections see https://golang.org/pkg/net/http/
 const MaxHTTPIdleConnections = 20
 
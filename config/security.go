@@ -0,0 +1,36 @@
+package config
+
+// The security profiles that the services of an org may name in the security_opt of their deployment description.
+// Profiles that tighten a container and profiles that loosen it, e.g. "unconfined", are both named here.
+type SecurityAllowList struct {
+	SeccompProfiles  []string // Names of the seccomp profiles in the SeccompProfileDir
+	AppArmorProfiles []string // Names of the AppArmor profiles loaded on the host
+}
+
+// Return the allow-list of the given org, or the allow-list for all orgs when the org has none of its own. An org
+// without an allow-list gets an empty one.
+func (c *Config) SecurityAllowListFor(org string) *SecurityAllowList {
+	if al, ok := c.SecurityAllowLists[org]; ok {
+		return &al
+	} else if al, ok := c.SecurityAllowLists["*"]; ok {
+		return &al
+	}
+	return &SecurityAllowList{}
+}
+
+func (s *SecurityAllowList) AllowsSeccomp(profile string) bool {
+	return contains(s.SeccompProfiles, profile)
+}
+
+func (s *SecurityAllowList) AllowsAppArmor(profile string) bool {
+	return contains(s.AppArmorProfiles, profile)
+}
+
+func contains(list []string, s string) bool {
+	for _, e := range list {
+		if e == s {
+			return true
+		}
+	}
+	return false
+}
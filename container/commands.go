@@ -73,6 +73,29 @@ func (b *ContainerWorker) NewContainerMaintenanceCommand(protocol string, agreem
 	}
 }
 
+// ==============================================================================================================
+type ContainerRestartCommand struct {
+	AgreementProtocol string
+	AgreementId       string
+	ServiceNames      []string
+}
+
+func (c ContainerRestartCommand) String() string {
+	return fmt.Sprintf("AgreementProtocol: %v, AgreementId: %v, ServiceNames: %v", c.AgreementProtocol, c.AgreementId, c.ServiceNames)
+}
+
+func (c ContainerRestartCommand) ShortString() string {
+	return c.String()
+}
+
+func (b *ContainerWorker) NewContainerRestartCommand(protocol string, agreementId string, serviceNames []string) *ContainerRestartCommand {
+	return &ContainerRestartCommand{
+		AgreementProtocol: protocol,
+		AgreementId:       agreementId,
+		ServiceNames:      serviceNames,
+	}
+}
+
 // ==============================================================================================================
 type WorkloadShutdownCommand struct {
 	AgreementProtocol  string
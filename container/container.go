@@ -7,13 +7,13 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
-	"github.com/boltdb/bolt"
 	"github.com/coreos/go-iptables/iptables"
 	docker "github.com/fsouza/go-dockerclient"
 	"github.com/golang/glog"
 	"github.com/open-horizon/anax/config"
 	"github.com/open-horizon/anax/containermessage"
 	"github.com/open-horizon/anax/events"
+	"github.com/open-horizon/anax/metrics"
 	"github.com/open-horizon/anax/persistence"
 	"github.com/open-horizon/anax/policy"
 	"github.com/open-horizon/anax/worker"
@@ -31,6 +31,9 @@ import (
 const LABEL_PREFIX = "network.bluehorizon.colonus"
 const IPT_COLONUS_ISOLATED_CHAIN = "COLONUS-ISOLATION"
 
+// The number of times docker has restarted the containers managed by this worker, by service name.
+var containerRestarts = metrics.NodeRegistry.NewCounterVec("anax_container_restarts_total", "The number of times docker has restarted a service container, by service name.", "service")
+
 /*
  *
  * The external representations of the config; once processed, the data about the pattern is stored in a persistence.ServiceConfig object
@@ -142,7 +145,7 @@ func removeDuplicateVariable(existingArray *[]string, newVar string) {
 
 }
 
-func finalizeDeployment(agreementId string, deployment *containermessage.DeploymentDescription, environmentAdditions map[string]string, workloadROStorageDir string, cpuSet string) (map[string]servicePair, error) {
+func finalizeDeployment(agreementId string, deployment *containermessage.DeploymentDescription, environmentAdditions map[string]string, workloadROStorageDir string, cpuSet string, limits *persistence.ResourceLimits, edgeConfig *config.Config) (map[string]servicePair, error) {
 
 	// final structure
 	services := make(map[string]servicePair, 0)
@@ -186,28 +189,30 @@ func finalizeDeployment(agreementId string, deployment *containermessage.Deploym
 		labels[LABEL_PREFIX+".variation"] = service.VariationLabel
 		labels[LABEL_PREFIX+".deployment_description_hash"] = deploymentHash
 
-		var logConfig docker.LogConfig
+		// The sources that may reach the published ports of the container, in addition to the limits of the node
+		if service.NetworkIsolation != nil && len(service.NetworkIsolation.InboundPermitOnly) != 0 {
+			if _, err := parsePermitList(service.NetworkIsolation.InboundPermitOnly); err != nil {
+				return nil, fmt.Errorf("Invalid inbound_permit_only for service %v: %v", serviceName, err)
+			}
+			labels[LABEL_PREFIX+".inbound_permit_only"] = strings.Join(service.NetworkIsolation.InboundPermitOnly, ",")
+		}
+
+		var logTag string
 
 		if !deployment.ServicePattern.IsShared("singleton", serviceName) {
 			labels[LABEL_PREFIX+".agreement_id"] = agreementId
-			logConfig = docker.LogConfig{
-				Type: "syslog",
-				Config: map[string]string{
-					"tag": fmt.Sprintf("workload-%v_%v", strings.ToLower(agreementId), serviceName),
-				},
-			}
+			logTag = fmt.Sprintf("workload-%v_%v", strings.ToLower(agreementId), serviceName)
 		} else {
 			logName := serviceName
 			if service.VariationLabel != "" {
 				logName = fmt.Sprintf("%v-%v", serviceName, service.VariationLabel)
 			}
+			logTag = fmt.Sprintf("workload-%v_%v", "singleton", logName)
+		}
 
-			logConfig = docker.LogConfig{
-				Type: "syslog",
-				Config: map[string]string{
-					"tag": fmt.Sprintf("workload-%v_%v", "singleton", logName),
-				},
-			}
+		logConfig, err := containerLogConfig(edgeConfig, logTag)
+		if err != nil {
+			return nil, err
 		}
 
 		serviceConfig := &persistence.ServiceConfig{
@@ -235,11 +240,31 @@ func finalizeDeployment(agreementId string, deployment *containermessage.Deploym
 			},
 		}
 
+		// Let docker probe the health of the container, if the service has a health check
+		if hc, err := healthConfig(service.HealthCheck); err != nil {
+			return nil, fmt.Errorf("Invalid health check for service %v: %v", serviceName, err)
+		} else {
+			serviceConfig.Config.Healthcheck = hc
+		}
+
+		// Tighten the container with the security settings of the service
+		if err := applySecurityOptions(serviceConfig, service, edgeConfig.SeccompProfileDir); err != nil {
+			return nil, fmt.Errorf("Invalid security settings for service %v: %v", serviceName, err)
+		}
+
+		// Apply this service's share of the resource limits from the agreement, if there are any
+		serviceConfig.Limits = applyResourceLimits(serviceConfig, limits, len(deployment.Services))
+
 		// Mark each container as infrastructure if the deployment description indicates infrastructure
 		if deployment.Infrastructure {
 			serviceConfig.Config.Labels[LABEL_PREFIX+".infrastructure"] = ""
 		}
 
+		// Remember which devices the container shares, so that the claims can be rebuilt when anax restarts
+		if len(service.SharedDevices) != 0 {
+			serviceConfig.Config.Labels[LABEL_PREFIX+".shared_devices"] = strings.Join(service.SharedDevices, ",")
+		}
+
 		// add environment additions to each service
 		for k, v := range environmentAdditions {
 			serviceConfig.Config.Env = append(serviceConfig.Config.Env, fmt.Sprintf("%s=%v", k, v))
@@ -353,10 +378,13 @@ func finalizeDeployment(agreementId string, deployment *containermessage.Deploym
 
 type ContainerWorker struct {
 	worker.BaseWorker // embedded field
-	db                *bolt.DB
+	db                persistence.DomainStore
 	client            *docker.Client
 	iptables          *iptables.IPTables
 	inAgbot           bool
+	restartCounts     map[string]int  // the docker restart count of each container when it was last maintained, keyed by container id
+	unhealthy         map[string]bool // the agreements that were reported to have unhealthy services, keyed by agreement id
+	devices           *DeviceBroker   // the host devices given to the containers
 }
 
 func (cw *ContainerWorker) GetClient() *docker.Client {
@@ -370,15 +398,18 @@ func CreateCLIContainerWorker(config *config.HorizonConfig) (*ContainerWorker, e
 	}
 
 	return &ContainerWorker{
-		BaseWorker: worker.NewBaseWorker("mock", config),
-		db:         nil,
-		client:     client,
-		iptables:   nil,
-		inAgbot:    true,
+		BaseWorker:    worker.NewBaseWorker("mock", config),
+		db:            persistence.NewMemoryDomainStore(),
+		client:        client,
+		iptables:      nil,
+		inAgbot:       true,
+		restartCounts: make(map[string]int),
+		unhealthy:     make(map[string]bool),
+		devices:       NewDeviceBroker(""),
 	}, nil
 }
 
-func NewContainerWorker(name string, config *config.HorizonConfig, db *bolt.DB) *ContainerWorker {
+func NewContainerWorker(name string, config *config.HorizonConfig, db persistence.Store) *ContainerWorker {
 
 	inAgbot := false
 	if config.Edge.WorkloadROStorage == "" && config.Edge.DBPath == "" {
@@ -398,11 +429,14 @@ func NewContainerWorker(name string, config *config.HorizonConfig, db *bolt.DB)
 		panic("Unable to instantiate docker Client")
 	} else {
 		worker := &ContainerWorker{
-			BaseWorker: worker.NewBaseWorker(name, config),
-			db:         db,
-			client:     client,
-			iptables:   ipt,
-			inAgbot:    inAgbot,
+			BaseWorker:    worker.NewBaseWorker(name, config),
+			db:            persistence.NewBoltDomainStore(db),
+			client:        client,
+			iptables:      ipt,
+			inAgbot:       inAgbot,
+			restartCounts: make(map[string]int),
+			unhealthy:     make(map[string]bool),
+			devices:       NewDeviceBroker(""),
 		}
 		worker.SetDeferredDelay(15)
 
@@ -445,6 +479,15 @@ func (w *ContainerWorker) NewEvent(incoming events.Message) {
 			w.Commands <- containerCmd
 		}
 
+	case *events.ContainerHealthMessage:
+		msg, _ := incoming.(*events.ContainerHealthMessage)
+
+		switch msg.Event().Id {
+		case events.CONTAINER_RESTART:
+			containerCmd := w.NewContainerRestartCommand(msg.AgreementProtocol, msg.AgreementId, msg.ServiceNames)
+			w.Commands <- containerCmd
+		}
+
 	case *events.GovernanceWorkloadCancelationMessage:
 		msg, _ := incoming.(*events.GovernanceWorkloadCancelationMessage)
 
@@ -723,53 +766,7 @@ func generatePermittedString(isolation *containermessage.NetworkIsolation, netwo
 func processPostCreate(ipt *iptables.IPTables, client *docker.Client, agreementId string, deployment containermessage.DeploymentDescription, configureRaw []byte, hasSpecifiedEthAccount bool, containers []interface{}, fail func(container *docker.Container, name string, err error) error) error {
 
 	if ipt != nil {
-		rules, err := ipt.List("filter", IPT_COLONUS_ISOLATED_CHAIN)
-		if err != nil {
-			// could be that it just isn't created, try that
-
-			err := ipt.NewChain("filter", IPT_COLONUS_ISOLATED_CHAIN)
-			if err != nil {
-				return fail(nil, "<unknown>", fmt.Errorf("Unable to manipulate IPTables rules in container post-creation step: Error: %v", err))
-			}
-
-			rules, err = ipt.List("filter", IPT_COLONUS_ISOLATED_CHAIN)
-			if err != nil {
-				return fail(nil, "<unknown>", fmt.Errorf("Unable to manipulate IPTables rules in container post-creation step: Error: %v", err))
-			}
-		}
-
-		foundReturn := false
-		for _, rule := range rules {
-			if rule == fmt.Sprintf("-A %v -j RETURN", IPT_COLONUS_ISOLATED_CHAIN) {
-				foundReturn = true
-			}
-		}
-
-		if !foundReturn {
-			err = ipt.Insert("filter", IPT_COLONUS_ISOLATED_CHAIN, 1, "-j", "RETURN")
-			if err != nil {
-				return fail(nil, "<unknown>", fmt.Errorf("Unable to manipulate IPTables rules in container post-creation step: Error: %v", err))
-			}
-		}
-
-		rules, err = ipt.List("filter", "FORWARD")
-
-		if err != nil {
-			return fail(nil, "<unknown>", fmt.Errorf("Unable to manipulate IPTables rules in container post-creation step: Error: %v", err))
-		}
-		for _, rule := range rules {
-			if rule == fmt.Sprintf("-A FORWARD -j %v", IPT_COLONUS_ISOLATED_CHAIN) {
-				glog.Infof("rule: %v", rule)
-				err := ipt.Delete("filter", "FORWARD", "-j", IPT_COLONUS_ISOLATED_CHAIN)
-				if err != nil {
-					return fail(nil, "<unknown>", fmt.Errorf("Unable to manipulate IPTables rules in container post-creation step: Error: %v", err))
-				}
-			}
-		}
-
-		// need to always insert this at the head of the chain; if this fails, there will be no isolation security but normal container traffic will be allowed
-		err = ipt.Insert("filter", "FORWARD", 1, "-j", IPT_COLONUS_ISOLATED_CHAIN)
-		if err != nil {
+		if err := ensureIsolationChain(ipt); err != nil {
 			return fail(nil, "<unknown>", fmt.Errorf("Unable to manipulate IPTables rules in container post-creation step: Error: %v", err))
 		}
 	}
@@ -867,7 +864,7 @@ func (b *ContainerWorker) workloadStorageDir(agreementId string) string {
 	return path.Join(b.Config.Edge.WorkloadROStorage, agreementId)
 }
 
-func (b *ContainerWorker) ResourcesCreate(agreementId string, configure *events.ContainerConfig, deployment *containermessage.DeploymentDescription, configureRaw []byte, environmentAdditions map[string]string, ms_networks map[string]docker.ContainerNetwork) (*map[string]persistence.ServiceConfig, error) {
+func (b *ContainerWorker) ResourcesCreate(agreementId string, configure *events.ContainerConfig, deployment *containermessage.DeploymentDescription, configureRaw []byte, environmentAdditions map[string]string, ms_networks map[string]docker.ContainerNetwork, limits *persistence.ResourceLimits) (*map[string]persistence.ServiceConfig, error) {
 
 	// local helpers
 	fail := func(container *docker.Container, name string, err error) error {
@@ -935,11 +932,47 @@ func (b *ContainerWorker) ResourcesCreate(agreementId string, configure *events.
 		return nil, err
 	}
 
-	servicePairs, err := finalizeDeployment(agreementId, deployment, environmentAdditions, workloadROStorageDir, b.Config.Edge.DefaultCPUSet)
+	// The agreement protocol only checks the workloads of an agreement, a node that refuses privileged workloads
+	// refuses privileged microservice and infrastructure containers here too.
+	if refuse, err := refusesPrivileged(b.db); err != nil {
+		return nil, err
+	} else if refuse && deployment.RequestsPrivileged() {
+		return nil, fmt.Errorf("Node refuses privileged containers, deployment for %v requests a privileged container", agreementId)
+	}
+
+	// Claim the host devices of the services before creating the containers, another agreement might hold them.
+	var hardware *persistence.HardwareMatch
+	if configure != nil {
+		hardware = configure.HardwareMatch
+	}
+	claims, err := b.devices.Claim(agreementId, deployment, hardware)
+	if err != nil {
+		return nil, err
+	}
+
+	// The devices claimed here are released when any of the steps below fails. Removing the resources of the agreement
+	// leaves the devices of shared singleton containers to the containers, which might not have been created.
+	created := false
+	defer func() {
+		if !created {
+			b.devices.Release(claims)
+		}
+	}()
+
+	servicePairs, err := finalizeDeployment(agreementId, deployment, environmentAdditions, workloadROStorageDir, b.Config.Edge.DefaultCPUSet, limits, &b.Config.Edge)
 	if err != nil {
 		return nil, err
 	}
 
+	// The org of the containers decides which other agreements they can talk to. The hzn dev commands dont have one.
+	org := ""
+	if configure != nil {
+		org = configure.Org
+	}
+	for _, servicePair := range servicePairs {
+		servicePair.serviceConfig.Config.Labels[LABEL_PREFIX+".org"] = org
+	}
+
 	// process services that are "shared" first, then others
 	shared := make(map[string]servicePair, 0)
 	private := make(map[string]servicePair, 0)
@@ -1056,6 +1089,21 @@ func (b *ContainerWorker) ResourcesCreate(agreementId string, configure *events.
 		}
 	}
 
+	// Limit the network bandwidth of the containers on the agreement bridge. Shared containers are not on this bridge.
+	if limits != nil && (limits.NetworkUploadKbps > 0 || limits.NetworkDownloadKbps > 0) {
+		device := bridgeDevice(agBridge)
+		if err := shapeBridge(device, limits.NetworkUploadKbps, limits.NetworkDownloadKbps); err != nil {
+			return nil, fail(nil, agreementId, err)
+		}
+		for serviceName, _ := range private {
+			if enforced := ret[serviceName].Limits; enforced != nil {
+				enforced.NetworkUploadKbps = limits.NetworkUploadKbps
+				enforced.NetworkDownloadKbps = limits.NetworkDownloadKbps
+				enforced.NetworkDevice = device
+			}
+		}
+	}
+
 	// add ms endpoints to the sharedEndpoints
 	if ms_sharedendpoints != nil {
 		recordEndpoints(sharedEndpoints, ms_sharedendpoints)
@@ -1078,9 +1126,28 @@ func (b *ContainerWorker) ResourcesCreate(agreementId string, configure *events.
 		return nil, err
 	}
 
+	// Limit the sources that can reach the published ports of the new containers, and let the agreement bridge talk to
+	// the bridges of other agreements when the node permits it.
+	for _, con := range postCreateContainers {
+		if container, ok := con.(*docker.Container); ok {
+			if conDetail, err := b.client.InspectContainer(container.ID); err != nil {
+				return nil, fail(nil, container.Name, fmt.Errorf("Unable to find container detail for container during post-creation step: Error: %v", err))
+			} else if err := b.permitInbound(conDetail); err != nil {
+				return nil, fail(nil, container.Name, fmt.Errorf("Unable to create inbound rules for service. Error: %v", err))
+			}
+		}
+	}
+
+	if !deployment.Infrastructure {
+		if err := b.permitAgreementBridges(agreementId, org, nil); err != nil {
+			return nil, fail(nil, agreementId, fmt.Errorf("Unable to create rules between agreement bridges. Error: %v", err))
+		}
+	}
+
 	for name, _ := range ret {
 		glog.V(1).Infof("Created service %v in agreement %v", name, agreementId)
 	}
+	created = true
 	return &ret, nil
 }
 
@@ -1099,7 +1166,7 @@ func (b *ContainerWorker) CommandHandler(command worker.Command) bool {
 
 		agreementId := cmd.AgreementLaunchContext.AgreementId
 
-		if ags, err := persistence.FindEstablishedAgreements(b.db, cmd.AgreementLaunchContext.AgreementProtocol, []persistence.EAFilter{persistence.UnarchivedEAFilter(), persistence.IdEAFilter(agreementId)}); err != nil {
+		if ags, err := b.db.FindEstablishedAgreements(cmd.AgreementLaunchContext.AgreementProtocol, []persistence.EAFilter{persistence.UnarchivedEAFilter(), persistence.IdEAFilter(agreementId)}); err != nil {
 			glog.Errorf("Unable to retrieve agreement %v from database, error %v", agreementId, err)
 		} else if len(ags) != 1 {
 			glog.Infof("Ignoring the configure event for agreement %v, the agreement is archived.", agreementId)
@@ -1133,6 +1200,11 @@ func (b *ContainerWorker) CommandHandler(command worker.Command) bool {
 			if valid := deploymentDesc.IsValidFor("workload"); !valid {
 				glog.Errorf("Deployment config %v contains unsupported capability for a workload", cmd.AgreementLaunchContext.Configure.Deployment)
 				b.Messages() <- events.NewWorkloadMessage(events.EXECUTION_FAILED, cmd.AgreementLaunchContext.AgreementProtocol, agreementId, nil)
+				return true
+			} else if err := validateDeploymentSecurity(deploymentDesc, b.Config.Edge.SecurityAllowListFor(cmd.AgreementLaunchContext.Configure.Org)); err != nil {
+				glog.Errorf("Deployment config %v contains unsupported security settings for a workload, error: %v", cmd.AgreementLaunchContext.Configure.Deployment, err)
+				b.Messages() <- events.NewWorkloadMessage(events.EXECUTION_FAILED, cmd.AgreementLaunchContext.AgreementProtocol, agreementId, nil)
+				return true
 			}
 
 			// Add the deployment overrides to the deployment description, if there are any
@@ -1158,7 +1230,7 @@ func (b *ContainerWorker) CommandHandler(command worker.Command) bool {
 			}
 
 			// Create the docker configuration and launch the containers.
-			if deployment, err := b.ResourcesCreate(agreementId, &cmd.AgreementLaunchContext.Configure, deploymentDesc, cmd.AgreementLaunchContext.ConfigureRaw, *cmd.AgreementLaunchContext.EnvironmentAdditions, ms_networks); err != nil {
+			if deployment, err := b.ResourcesCreate(agreementId, &cmd.AgreementLaunchContext.Configure, deploymentDesc, cmd.AgreementLaunchContext.ConfigureRaw, *cmd.AgreementLaunchContext.EnvironmentAdditions, ms_networks, cmd.AgreementLaunchContext.ResourceLimits); err != nil {
 				glog.Errorf("Error starting containers: %v", err)
 				var dep map[string]persistence.ServiceConfig
 				if deployment != nil {
@@ -1191,6 +1263,10 @@ func (b *ContainerWorker) CommandHandler(command worker.Command) bool {
 			glog.Errorf("Deployment config %v contains unsupported capability for infrastructure container", cmd.ContainerLaunchContext.Configure.Deployment)
 			b.Messages() <- events.NewContainerMessage(events.EXECUTION_FAILED, *cmd.ContainerLaunchContext, "", "")
 			return true
+		} else if err := validateDeploymentSecurity(deploymentDesc, b.Config.Edge.SecurityAllowListFor(cmd.ContainerLaunchContext.Configure.Org)); err != nil {
+			glog.Errorf("Deployment config %v contains unsupported security settings for infrastructure container, error: %v", cmd.ContainerLaunchContext.Configure.Deployment, err)
+			b.Messages() <- events.NewContainerMessage(events.EXECUTION_FAILED, *cmd.ContainerLaunchContext, "", "")
+			return true
 		}
 
 		serviceNames := deploymentDesc.ServiceNames()
@@ -1227,7 +1303,7 @@ func (b *ContainerWorker) CommandHandler(command worker.Command) bool {
 		deploymentDesc.Infrastructure = true
 
 		// Get the container started.
-		if deployment, err := b.ResourcesCreate(cmd.ContainerLaunchContext.Name, &cmd.ContainerLaunchContext.Configure, deploymentDesc, []byte(""), *cmd.ContainerLaunchContext.EnvironmentAdditions, nil); err != nil {
+		if deployment, err := b.ResourcesCreate(cmd.ContainerLaunchContext.Name, &cmd.ContainerLaunchContext.Configure, deploymentDesc, []byte(""), *cmd.ContainerLaunchContext.EnvironmentAdditions, nil, nil); err != nil {
 			glog.Errorf("Error starting containers: %v", err)
 			b.Messages() <- events.NewContainerMessage(events.EXECUTION_FAILED, *cmd.ContainerLaunchContext, "", "")
 
@@ -1262,9 +1338,20 @@ func (b *ContainerWorker) CommandHandler(command worker.Command) bool {
 		}
 
 		b.ContainersMatchingAgreement([]string{cmd.AgreementId}, true, report)
+		unhealthy, healthy := b.inspectMaintained(cMatches)
 
 		if len(serviceNames) == len(cMatches) {
 			glog.V(4).Infof("Found expected count of running containers for agreement %v: %v", cmd.AgreementId, len(cMatches))
+
+			// ask governer to deal with the unhealthy services, and let it know when they have recovered
+			if len(unhealthy) != 0 {
+				b.unhealthy[cmd.AgreementId] = true
+				b.Messages() <- events.NewContainerHealthMessage(events.CONTAINER_UNHEALTHY, cmd.AgreementProtocol, cmd.AgreementId, cmd.Deployment, unhealthy)
+			} else if healthy && b.unhealthy[cmd.AgreementId] {
+				glog.Infof("Services of agreement %v are healthy again", cmd.AgreementId)
+				delete(b.unhealthy, cmd.AgreementId)
+				b.Messages() <- events.NewContainerHealthMessage(events.CONTAINER_HEALTHY, cmd.AgreementProtocol, cmd.AgreementId, cmd.Deployment, serviceNames)
+			}
 		} else {
 			glog.Errorf("Insufficient running containers found for agreement %v. Found: %v", cmd.AgreementId, cMatches)
 
@@ -1272,6 +1359,24 @@ func (b *ContainerWorker) CommandHandler(command worker.Command) bool {
 			b.Messages() <- events.NewWorkloadMessage(events.EXECUTION_FAILED, cmd.AgreementProtocol, cmd.AgreementId, cmd.Deployment)
 		}
 
+	case *ContainerRestartCommand:
+		cmd := command.(*ContainerRestartCommand)
+		glog.V(3).Infof("ContainerWorker received container restart command: %v", cmd)
+
+		restart := func(container *docker.APIContainers, agreementId string) error {
+			for _, name := range cmd.ServiceNames {
+				if container.Labels[LABEL_PREFIX+".service_name"] == name {
+					glog.Infof("Restarting unhealthy service %v container %v for agreement %v", name, container.ID, agreementId)
+					if err := b.client.RestartContainer(container.ID, HEALTH_RESTART_TIMEOUT_S); err != nil {
+						return fmt.Errorf("unable to restart service %v container %v, error: %v", name, container.ID, err)
+					}
+				}
+			}
+			return nil
+		}
+
+		b.ContainersMatchingAgreement([]string{cmd.AgreementId}, true, restart)
+
 	case *WorkloadShutdownCommand:
 		cmd := command.(*WorkloadShutdownCommand)
 
@@ -1306,7 +1411,7 @@ func (b *ContainerWorker) CommandHandler(command worker.Command) bool {
 
 		cMatches := make([]docker.APIContainers, 0)
 
-		if msinst, err := persistence.FindMicroserviceInstanceWithKey(b.db, cmd.MsInstKey); err != nil {
+		if msinst, err := b.db.FindMicroserviceInstanceWithKey(cmd.MsInstKey); err != nil {
 			glog.Errorf("Error retrieving microservice instance from database for %v, error: %v", cmd.MsInstKey, err)
 		} else if msinst == nil {
 			glog.Errorf("Cannot find microservice instance record from database for %v.", cmd.MsInstKey)
@@ -1326,11 +1431,16 @@ func (b *ContainerWorker) CommandHandler(command worker.Command) bool {
 			}
 
 			b.ContainersMatchingAgreement([]string{cmd.MsInstKey}, true, report)
+			unhealthy, _ := b.inspectMaintained(cMatches)
 
-			if len(serviceNames) == len(cMatches) {
+			if len(serviceNames) == len(cMatches) && len(unhealthy) == 0 {
 				glog.V(4).Infof("Found expected count of running containers for microservice instance %v: %v", cmd.MsInstKey, len(cMatches))
 			} else {
-				glog.Errorf("Insufficient running containers found for miceroservice instance %v. Found: %v", cmd.MsInstKey, cMatches)
+				if len(unhealthy) != 0 {
+					glog.Errorf("Unhealthy services %v found for microservice instance %v", unhealthy, cmd.MsInstKey)
+				} else {
+					glog.Errorf("Insufficient running containers found for miceroservice instance %v. Found: %v", cmd.MsInstKey, cMatches)
+				}
 
 				// ask governer to record it into the db
 				u, _ := url.Parse("")
@@ -1400,7 +1510,7 @@ func (b *ContainerWorker) syncupResources() {
 	glog.V(3).Infof("ContainerWorker beginning sync up of docker resources.")
 
 	// First get all the agreements from the DB.
-	if agreements, err := persistence.FindEstablishedAgreementsAllProtocols(b.db, policy.AllAgreementProtocols(), []persistence.EAFilter{persistence.UnarchivedEAFilter()}); err != nil {
+	if agreements, err := b.db.FindEstablishedAgreementsAllProtocols(policy.AllAgreementProtocols(), []persistence.EAFilter{persistence.UnarchivedEAFilter()}); err != nil {
 		fail(fmt.Sprintf("ContainerWorker unable to retrieve agreements from database, error %v", err))
 	} else {
 
@@ -1464,6 +1574,16 @@ func (b *ContainerWorker) syncupResources() {
 			}
 		}
 
+		// Re-create the inbound and bridge rules of the running containers, which do not survive a reboot.
+		if err := b.restoreFirewall(); err != nil {
+			fail(fmt.Sprintf("ContainerWorker unable to restore the inbound and bridge rules. Error: %v", err))
+		}
+
+		// Claim the devices of the running containers again.
+		if err := b.restoreDevices(); err != nil {
+			fail(fmt.Sprintf("ContainerWorker unable to restore the device claims. Error: %v", err))
+		}
+
 		// Fourth, run through IP routing table rules, looking for rules that are leftover from old agreements. Be aware that there
 		// could be other non-Horizon rules on this host, so we have to be careful to NOT terminate them.
 		if exists, err := b.iptables.Exists("filter", IPT_COLONUS_ISOLATED_CHAIN, "-j", "RETURN"); err != nil {
@@ -1505,6 +1625,7 @@ func (b *ContainerWorker) ResourcesRemove(agreements []string) error {
 
 	// remove old workspaceROStorage dir
 	for _, agreementId := range agreements {
+		delete(b.unhealthy, agreementId)
 		workloadROStorageDir := b.workloadStorageDir(agreementId)
 		if err := os.RemoveAll(workloadROStorageDir); err != nil {
 			glog.Errorf("Failed to remove workloadROStorageDir: %v. Error: %v", workloadROStorageDir, err)
@@ -1591,6 +1712,13 @@ func (b *ContainerWorker) ResourcesRemove(agreements []string) error {
 		if destroyed, err := serviceDestroy(b.client, agreementId, container.ID); err != nil {
 			glog.Errorf("Service %v in agreement %v could not be removed. Error: %v", serviceName, agreementId, err)
 		} else if destroyed {
+			delete(b.restartCounts, container.ID)
+			for _, name := range container.Names {
+				b.devices.ReleaseContainer(strings.TrimLeft(name, "/"))
+			}
+			if err := b.removeInbound(container.ID); err != nil {
+				glog.Errorf("Unable to remove the inbound rules of service %v in agreement %v. Error: %v", serviceName, agreementId, err)
+			}
 			glog.V(1).Infof("Service %v in agreement %v stopped and removed", serviceName, agreementId)
 		} else {
 			glog.V(5).Infof("Service %v in agreement %v already removed", serviceName, agreementId)
@@ -1601,6 +1729,11 @@ func (b *ContainerWorker) ResourcesRemove(agreements []string) error {
 
 	b.ContainersMatchingAgreement(agreements, true, destroy)
 
+	// release the devices of the containers that were not created
+	for _, agreementId := range agreements {
+		b.devices.ReleaseAgreement(agreementId)
+	}
+
 	// gather agreement networks to free
 	for _, net := range networks {
 		for _, agreementId := range agreements {
@@ -1647,25 +1780,11 @@ func (b *ContainerWorker) ResourcesRemove(agreements []string) error {
 		} else if !exists {
 			glog.V(3).Infof("Primary redirect rule missing from %v chain. Skipping agreement rule deletion", IPT_COLONUS_ISOLATED_CHAIN)
 		} else {
-			// free iptables rules for this agreement (will hose access to shared too)
-			rules, err := b.iptables.List("filter", IPT_COLONUS_ISOLATED_CHAIN)
-			if err != nil {
-				return fmt.Errorf("Unable to list rules in %v. Error: %v", IPT_COLONUS_ISOLATED_CHAIN, err)
-			}
-
-			for _, agreementId := range agreements {
-				glog.V(4).Infof("Removing iptables isolation rules for agreement %v", agreementId)
-
-				// count backwards so we don't have to adjust the indices b/c they change w/ each ipt delete
-				for ix := len(rules) - 1; ix >= 0; ix-- {
-					if strings.Contains(rules[ix], fmt.Sprintf("agreement_id=%v", agreementId)) {
-
-						glog.V(3).Infof("Deleting isolation rule: %v", rules[ix])
-						if err := b.iptables.Delete("filter", IPT_COLONUS_ISOLATED_CHAIN, strconv.Itoa(ix)); err != nil {
-							return err
-						}
-					}
-				}
+			// free iptables rules for these agreements (will hose access to shared too). The bridge rules name two
+			// agreements, so the rules of all the agreements are deleted in one pass over the chain.
+			glog.V(4).Infof("Removing iptables isolation rules for agreements %v", agreements)
+			if err := deleteRules(b.iptables, func(rule string) bool { return agreementRule(rule, agreements) }); err != nil {
+				return fmt.Errorf("Unable to delete the rules of agreements %v from %v. Error: %v", agreements, IPT_COLONUS_ISOLATED_CHAIN, err)
 			}
 		}
 	}
@@ -1705,7 +1824,7 @@ func (b *ContainerWorker) findMicroserviceDefContainerNames(api_spec string, ver
 
 	container_names := make([]string, 0)
 	// find the ms from the local db, it is okay if the ms def is not found. this is old behavious befor the ms split.
-	if msdef, err := persistence.FindMicroserviceDefWithKey(b.db, msdef_key); err != nil {
+	if msdef, err := b.db.FindMicroserviceDefWithKey(msdef_key); err != nil {
 		return nil, fmt.Errorf("Error finding microservice definition from the local db for %v version %v key %v. %v", api_spec, version, msdef_key, err)
 	} else if msdef != nil && msdef.Workloads != nil && len(msdef.Workloads) > 0 {
 		// get the service name from the ms def
@@ -1735,7 +1854,7 @@ func (b *ContainerWorker) findMsContainersAndUpdateMsInstance(agreementId string
 			// find the ms from the local db,
 			if msc_names, err := b.findMicroserviceDefContainerNames(api_spec.SpecRef, api_spec.Version, api_spec.MsdefId); err != nil {
 				return nil, fmt.Errorf("Error finding microservice definition from the local db for %v. %v", api_spec, err)
-			} else if msinsts, err := persistence.FindMicroserviceInstances(b.db, []persistence.MIFilter{persistence.AllInstancesMIFilter(api_spec.SpecRef, api_spec.Version), persistence.UnarchivedMIFilter()}); err != nil {
+			} else if msinsts, err := b.db.FindMicroserviceInstances([]persistence.MIFilter{persistence.AllInstancesMIFilter(api_spec.SpecRef, api_spec.Version), persistence.UnarchivedMIFilter()}); err != nil {
 				return nil, fmt.Errorf("Error retrieving microservice instances for %v version %v from database, error: %v", api_spec.SpecRef, api_spec.Version, err)
 			} else if msinsts == nil || len(msinsts) == 0 {
 				return nil, fmt.Errorf("Microservice instance has not be initiated for microservice  %v yet.", api_spec)
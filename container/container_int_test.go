@@ -7,7 +7,6 @@ import (
 	"bytes"
 	"flag"
 	"fmt"
-	"github.com/boltdb/bolt"
 	"github.com/fsouza/go-dockerclient"
 	"github.com/open-horizon/anax/config"
 	"github.com/open-horizon/anax/events"
@@ -69,7 +68,7 @@ func tConfig() *config.HorizonConfig {
 	}
 }
 
-func tWorker(config *config.HorizonConfig, db *bolt.DB) *ContainerWorker {
+func tWorker(config *config.HorizonConfig, db persistence.Store) *ContainerWorker {
 	cw := NewContainerWorker("cworker", config, db)
 	cw.inAgbot = true
 	return cw
@@ -219,7 +218,7 @@ func pickImage() string {
 	}
 }
 
-func commonPatterned(t *testing.T, db *bolt.DB, agreementId string, tFn func(worker *ContainerWorker, env map[string]string, agreementId string), deployment string) {
+func commonPatterned(t *testing.T, db persistence.Store, agreementId string, tFn func(worker *ContainerWorker, env map[string]string, agreementId string), deployment string) {
 
 	// used to name stuff for easy teardown
 	namePrefix := "container-int-test"
@@ -363,8 +362,8 @@ func Test_resourcesCreate_patterned(t *testing.T) {
 					return fmt.Errorf("Wrong CPUSet on running container: %v. Entire HostConfig: %v", containerDetail.HostConfig.CPUSetCPUs, containerDetail.HostConfig)
 				}
 
-				if containerDetail.HostConfig.LogConfig.Type != "syslog" || !strings.HasPrefix(containerDetail.HostConfig.LogConfig.Config["tag"], "workload-") {
-					return fmt.Errorf("missing tagged syslog logging config")
+				if containerDetail.HostConfig.LogConfig.Type != "json-file" || !strings.HasPrefix(containerDetail.HostConfig.LogConfig.Config["tag"], "workload-") {
+					return fmt.Errorf("missing tagged json-file logging config")
 				}
 
 				if containerDetail.HostConfig.RestartPolicy != docker.AlwaysRestart() {
@@ -558,13 +557,13 @@ func Test_resourcesCreate_shared(t *testing.T) {
 	}
 }
 
-func setup() (string, *bolt.DB, error) {
+func setup() (string, persistence.Store, error) {
 	dir, err := ioutil.TempDir("", "container-")
 	if err != nil {
 		return "", nil, err
 	}
 
-	db, err := bolt.Open(path.Join(dir, "anax-int.db"), 0600, &bolt.Options{Timeout: 10 * time.Second})
+	db, err := persistence.OpenBoltStore(dir, "anax-int.db")
 	if err != nil {
 		return dir, nil, err
 	}
@@ -0,0 +1,489 @@
+package container
+
+import (
+	"errors"
+	"fmt"
+	docker "github.com/fsouza/go-dockerclient"
+	"github.com/golang/glog"
+	"github.com/open-horizon/anax/containermessage"
+	"github.com/open-horizon/anax/persistence"
+	"io/ioutil"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// The root of the sysfs tree that host devices are discovered from.
+const DEFAULT_SYSFS_ROOT = "/sys"
+
+// A device file on the host, and the USB device behind it when there is one.
+type HostDevice struct {
+	Path  string `json:"path"`             // The device file, e.g. /dev/ttyUSB0
+	USBId string `json:"usb_id,omitempty"` // The vendor:product id of the USB device, e.g. 1546:01a7
+}
+
+// A host device that has been given to the container of a service. A device that is claimed exclusively cannot be
+// given to another container, a shared device can be given to the other containers that share it.
+type DeviceClaim struct {
+	Device         string `json:"device"`           // The device file on the host
+	USBId          string `json:"usb_id,omitempty"` // The vendor:product id of the USB device
+	Container      string `json:"container"`        // The name of the container that holds the device
+	Service        string `json:"service"`          // The name of the service in the deployment description
+	AgreementId    string `json:"agreement_id"`     // The agreement id, or the microservice instance key
+	Shared         bool   `json:"shared"`
+	Infrastructure bool   `json:"infrastructure"` // The device is held by a microservice
+}
+
+func (c DeviceClaim) String() string {
+	return fmt.Sprintf("Device: %v, USBId: %v, Container: %v, Service: %v, AgreementId: %v, Shared: %v, Infrastructure: %v",
+		c.Device, c.USBId, c.Container, c.Service, c.AgreementId, c.Shared, c.Infrastructure)
+}
+
+// The device broker decides which containers get which host devices, so that two services cannot both be given a
+// device that only one of them can use. The claims are held in memory, they are rebuilt from the running containers
+// when anax restarts.
+type DeviceBroker struct {
+	lock      sync.Mutex
+	sysfsRoot string
+	claims    []DeviceClaim
+}
+
+func NewDeviceBroker(sysfsRoot string) *DeviceBroker {
+	if sysfsRoot == "" {
+		sysfsRoot = DEFAULT_SYSFS_ROOT
+	}
+	return &DeviceBroker{
+		sysfsRoot: sysfsRoot,
+		claims:    make([]DeviceClaim, 0, 10),
+	}
+}
+
+// Find the device files on the host from the devices in sysfs, as udev does. A device has a device file when its
+// uevent names one, and it is a USB device when it or one of its parents has a USB vendor and product id.
+func discoverDevices(sysfsRoot string) ([]HostDevice, error) {
+	classDirs, err := filepath.Glob(path.Join(sysfsRoot, "class", "*", "*"))
+	if err != nil {
+		return nil, err
+	}
+	usbDirs, err := filepath.Glob(path.Join(sysfsRoot, "bus", "usb", "devices", "*"))
+	if err != nil {
+		return nil, err
+	}
+
+	found := make(map[string]HostDevice)
+	for _, dir := range append(classDirs, usbDirs...) {
+		devName := ueventDevName(dir)
+		if devName == "" {
+			continue
+		}
+
+		realDir, err := filepath.EvalSymlinks(dir)
+		if err != nil {
+			glog.V(5).Infof("Unable to resolve sysfs device %v, error: %v", dir, err)
+			continue
+		}
+
+		dev := HostDevice{Path: path.Join("/dev", devName), USBId: usbId(sysfsRoot, realDir)}
+		if existing, ok := found[dev.Path]; !ok || existing.USBId == "" {
+			found[dev.Path] = dev
+		}
+	}
+
+	devices := make([]HostDevice, 0, len(found))
+	for _, dev := range found {
+		devices = append(devices, dev)
+	}
+	sort.Stable(hostDevicesByPath(devices))
+	return devices, nil
+}
+
+// Return the name of the device file of a sysfs device, relative to /dev.
+func ueventDevName(dir string) string {
+	uevent, err := ioutil.ReadFile(path.Join(dir, "uevent"))
+	if err != nil {
+		return ""
+	}
+	for _, line := range strings.Split(string(uevent), "\n") {
+		if strings.HasPrefix(line, "DEVNAME=") {
+			return strings.TrimPrefix(line, "DEVNAME=")
+		}
+	}
+	return ""
+}
+
+// Return the vendor:product id of the USB device that a sysfs device belongs to, by walking up the device tree.
+func usbId(sysfsRoot string, dir string) string {
+	for d := dir; strings.HasPrefix(d, sysfsRoot) && d != sysfsRoot; d = path.Dir(d) {
+		vendor, vErr := ioutil.ReadFile(path.Join(d, "idVendor"))
+		product, pErr := ioutil.ReadFile(path.Join(d, "idProduct"))
+		if vErr == nil && pErr == nil {
+			return strings.TrimSpace(string(vendor)) + ":" + strings.TrimSpace(string(product))
+		}
+	}
+	return ""
+}
+
+// Split a comma separated list from a hardware match.
+func splitList(list string) []string {
+	items := make([]string, 0, 5)
+	for _, item := range strings.Split(list, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// Return the host devices that match a device pattern from a deployment description and the hardware match of the
+// microservice, if there is one. The hardware match narrows the devices to the listed USB ids and device files.
+func matchDevices(pattern string, hardware *persistence.HardwareMatch, devices []HostDevice) []HostDevice {
+	var usbIds, devFiles []string
+	if hardware != nil {
+		usbIds = splitList(hardware.USBDeviceIds)
+		devFiles = splitList(hardware.Devfiles)
+	}
+
+	matches := make([]HostDevice, 0, 5)
+	for _, dev := range devices {
+		if ok, _ := filepath.Match(pattern, dev.Path); !ok {
+			continue
+		} else if len(usbIds) != 0 && !contains(usbIds, dev.USBId) {
+			continue
+		} else if len(devFiles) != 0 && !matchesAny(devFiles, dev.Path) {
+			continue
+		}
+		matches = append(matches, dev)
+	}
+	return matches
+}
+
+func matchesAny(patterns []string, s string) bool {
+	for _, p := range patterns {
+		if ok, _ := filepath.Match(p, s); ok {
+			return true
+		}
+	}
+	return false
+}
+
+func contains(list []string, s string) bool {
+	for _, e := range list {
+		if e == s {
+			return true
+		}
+	}
+	return false
+}
+
+// The name that the container of a service gets when it is started.
+func deviceContainerName(agreementId string, serviceName string, service *containermessage.Service, deployment *containermessage.DeploymentDescription) string {
+	if deployment.ServicePattern.IsShared("singleton", serviceName) {
+		if service.VariationLabel != "" {
+			return fmt.Sprintf("%v-%v-%v", "singleton", serviceName, service.VariationLabel)
+		}
+		return fmt.Sprintf("%v-%v", "singleton", serviceName)
+	}
+	return fmt.Sprintf("%v-%v", agreementId, serviceName)
+}
+
+// Check whether a device can be claimed by a container, given the claims that are already held.
+func claimable(claims []DeviceClaim, device string, container string, shared bool) (bool, string) {
+	for _, c := range claims {
+		if c.Device != device || c.Container == container {
+			continue
+		} else if !c.Shared || !shared {
+			return false, c.Container
+		}
+	}
+	return true, ""
+}
+
+// Claim the host devices of the services in a deployment description. The host device of a devices entry can be a
+// pattern, e.g. /dev/ttyUSB*, the first device that matches it and the hardware match and that can be claimed is
+// given to the service, and the entry is rewritten to name that device. The devices of a deployment are claimed all
+// together or not at all. Returns the claims that were added, a container that already holds a device keeps its claim.
+func (d *DeviceBroker) Claim(agreementId string, deployment *containermessage.DeploymentDescription, hardware *persistence.HardwareMatch) ([]DeviceClaim, error) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	var discovered []HostDevice
+	discover := func() ([]HostDevice, error) {
+		if discovered == nil {
+			devices, err := discoverDevices(d.sysfsRoot)
+			if err != nil {
+				return nil, errors.New(fmt.Sprintf("unable to discover host devices, error: %v", err))
+			}
+			discovered = devices
+		}
+		return discovered, nil
+	}
+
+	type rewrite struct {
+		service *containermessage.Service
+		index   int
+		entry   string
+		shared  string
+	}
+
+	pending := make([]DeviceClaim, 0, 5)
+	rewrites := make([]rewrite, 0, 5)
+
+	// Claim the devices in a stable order, so that the same services get the same devices on every node.
+	serviceNames := make([]string, 0, len(deployment.Services))
+	for serviceName, _ := range deployment.Services {
+		serviceNames = append(serviceNames, serviceName)
+	}
+	sort.Strings(serviceNames)
+
+	for _, serviceName := range serviceNames {
+		service := deployment.Services[serviceName]
+		containerName := deviceContainerName(agreementId, serviceName, service, deployment)
+
+		for ix, entry := range service.Devices {
+			sp := strings.SplitN(entry, ":", 2)
+			hostDevice := sp[0]
+			shared := contains(service.SharedDevices, hostDevice)
+
+			candidates := []HostDevice{{Path: hostDevice}}
+			if strings.ContainsAny(hostDevice, "*?[") {
+				devices, err := discover()
+				if err != nil {
+					return nil, err
+				}
+				if candidates = matchDevices(hostDevice, hardware, devices); len(candidates) == 0 {
+					return nil, errors.New(fmt.Sprintf("no host device matches %v for service %v", hostDevice, serviceName))
+				}
+			}
+
+			// A container that already holds one of the devices keeps it, e.g. a shared singleton used by another agreement.
+			for ix, candidate := range candidates {
+				if d.holds(containerName, candidate.Path) {
+					candidates[0], candidates[ix] = candidates[ix], candidates[0]
+					break
+				}
+			}
+
+			holder := ""
+			var claimed *HostDevice
+			for _, candidate := range candidates {
+				if ok, h := claimable(append(d.claims, pending...), candidate.Path, containerName, shared); ok {
+					c := candidate
+					claimed = &c
+					break
+				} else {
+					holder = h
+				}
+			}
+			if claimed == nil {
+				return nil, errors.New(fmt.Sprintf("device %v for service %v is not available, it is held by %v", hostDevice, serviceName, holder))
+			}
+
+			if claimed.USBId == "" {
+				if devices, err := discover(); err == nil {
+					for _, dev := range devices {
+						if dev.Path == claimed.Path {
+							claimed.USBId = dev.USBId
+						}
+					}
+				}
+			}
+
+			pending = append(pending, DeviceClaim{
+				Device:         claimed.Path,
+				USBId:          claimed.USBId,
+				Container:      containerName,
+				Service:        serviceName,
+				AgreementId:    agreementId,
+				Shared:         shared,
+				Infrastructure: deployment.Infrastructure,
+			})
+
+			if claimed.Path != hostDevice {
+				rw := rewrite{service: service, index: ix, entry: claimed.Path}
+				if len(sp) == 2 {
+					rw.entry = claimed.Path + ":" + sp[1]
+				}
+				if shared {
+					rw.shared = claimed.Path
+				}
+				rewrites = append(rewrites, rw)
+			}
+		}
+	}
+
+	for _, rw := range rewrites {
+		rw.service.Devices[rw.index] = rw.entry
+		if rw.shared != "" {
+			rw.service.SharedDevices = append(rw.service.SharedDevices, rw.shared)
+		}
+	}
+
+	added := make([]DeviceClaim, 0, len(pending))
+	for _, p := range pending {
+		if d.holds(p.Container, p.Device) {
+			continue
+		}
+		glog.V(3).Infof("Claimed device %v for service %v in %v", p.Device, p.Service, agreementId)
+		d.claims = append(d.claims, p)
+		added = append(added, p)
+	}
+	return added, nil
+}
+
+func (d *DeviceBroker) holds(container string, device string) bool {
+	for _, c := range d.claims {
+		if c.Container == container && c.Device == device {
+			return true
+		}
+	}
+	return false
+}
+
+// Release the devices claimed by the services of an agreement or microservice instance. The devices of a shared
+// singleton container are released when the container is removed.
+func (d *DeviceBroker) ReleaseAgreement(agreementId string) {
+	d.release(func(c DeviceClaim) bool {
+		return c.AgreementId == agreementId && !strings.HasPrefix(c.Container, "singleton-")
+	})
+}
+
+// Release the given claims, e.g. the claims of a deployment that failed to start.
+func (d *DeviceBroker) Release(claims []DeviceClaim) {
+	d.release(func(c DeviceClaim) bool {
+		for _, r := range claims {
+			if c.Container == r.Container && c.Device == r.Device {
+				return true
+			}
+		}
+		return false
+	})
+}
+
+// Release the devices claimed by a container.
+func (d *DeviceBroker) ReleaseContainer(containerName string) {
+	d.release(func(c DeviceClaim) bool {
+		return c.Container == containerName
+	})
+}
+
+func (d *DeviceBroker) release(match func(c DeviceClaim) bool) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	kept := make([]DeviceClaim, 0, len(d.claims))
+	for _, c := range d.claims {
+		if match(c) {
+			glog.V(3).Infof("Released device %v of container %v", c.Device, c.Container)
+		} else {
+			kept = append(kept, c)
+		}
+	}
+	d.claims = kept
+}
+
+// Return the devices that are claimed, by device and container.
+func (d *DeviceBroker) Claims() []DeviceClaim {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	out := make([]DeviceClaim, len(d.claims))
+	copy(out, d.claims)
+	sort.Stable(deviceClaimsByDevice(out))
+	return out
+}
+
+type hostDevicesByPath []HostDevice
+
+func (s hostDevicesByPath) Len() int {
+	return len(s)
+}
+
+func (s hostDevicesByPath) Swap(i, j int) {
+	s[i], s[j] = s[j], s[i]
+}
+
+func (s hostDevicesByPath) Less(i, j int) bool {
+	return s[i].Path < s[j].Path
+}
+
+type deviceClaimsByDevice []DeviceClaim
+
+func (s deviceClaimsByDevice) Len() int {
+	return len(s)
+}
+
+func (s deviceClaimsByDevice) Swap(i, j int) {
+	s[i], s[j] = s[j], s[i]
+}
+
+func (s deviceClaimsByDevice) Less(i, j int) bool {
+	if s[i].Device != s[j].Device {
+		return s[i].Device < s[j].Device
+	}
+	return s[i].Container < s[j].Container
+}
+
+// Replace the claims with the devices of the containers that are running, after anax restarts.
+func (d *DeviceBroker) restore(claims []DeviceClaim) {
+	devices, err := discoverDevices(d.sysfsRoot)
+	if err != nil {
+		glog.Warningf("Unable to discover host devices, error: %v", err)
+	}
+	for ix, c := range claims {
+		for _, dev := range devices {
+			if dev.Path == c.Device {
+				claims[ix].USBId = dev.USBId
+			}
+		}
+	}
+
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	d.claims = claims
+}
+
+// Return the host devices that are given to the containers.
+func (b *ContainerWorker) DeviceClaims() []DeviceClaim {
+	return b.devices.Claims()
+}
+
+// Rebuild the device claims from the devices of the running containers.
+func (b *ContainerWorker) restoreDevices() error {
+	containers, err := b.client.ListContainers(docker.ListContainersOptions{})
+	if err != nil {
+		return err
+	}
+
+	claims := make([]DeviceClaim, 0, 10)
+	for _, con := range containers {
+		serviceName, there := con.Labels[LABEL_PREFIX+".service_name"]
+		if !there || len(con.Names) == 0 {
+			continue
+		}
+
+		conDetail, err := b.client.InspectContainer(con.ID)
+		if err != nil {
+			return err
+		} else if conDetail.HostConfig == nil {
+			continue
+		}
+
+		_, infra := con.Labels[LABEL_PREFIX+".infrastructure"]
+		shared := splitList(con.Labels[LABEL_PREFIX+".shared_devices"])
+		for _, dev := range conDetail.HostConfig.Devices {
+			claims = append(claims, DeviceClaim{
+				Device:         dev.PathOnHost,
+				Container:      strings.TrimLeft(con.Names[0], "/"),
+				Service:        serviceName,
+				AgreementId:    con.Labels[LABEL_PREFIX+".agreement_id"],
+				Shared:         contains(shared, dev.PathOnHost),
+				Infrastructure: infra,
+			})
+		}
+	}
+
+	b.devices.restore(claims)
+	return nil
+}
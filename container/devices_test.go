@@ -0,0 +1,200 @@
+// +build unit
+
+package container
+
+import (
+	"github.com/open-horizon/anax/containermessage"
+	"github.com/open-horizon/anax/persistence"
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+)
+
+// Build a sysfs tree with two USB serial adapters and a device that is not on USB.
+func fakeSysfs(t *testing.T) string {
+	root, err := ioutil.TempDir("", "sysfs")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	write := func(file string, content string) {
+		if err := os.MkdirAll(path.Dir(path.Join(root, file)), 0755); err != nil {
+			t.Fatal(err)
+		} else if err := ioutil.WriteFile(path.Join(root, file), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	link := func(target string, name string) {
+		if err := os.MkdirAll(path.Dir(path.Join(root, name)), 0755); err != nil {
+			t.Fatal(err)
+		} else if err := os.Symlink(path.Join(root, target), path.Join(root, name)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, usb := range []struct{ port, bus, vendor, product, tty string }{
+		{"1-1", "001/002", "1546", "01a7", "ttyUSB0"},
+		{"1-2", "001/003", "0403", "6001", "ttyUSB1"},
+	} {
+		dev := "devices/pci0000:00/usb1/" + usb.port
+		write(dev+"/idVendor", usb.vendor+"\n")
+		write(dev+"/idProduct", usb.product+"\n")
+		write(dev+"/uevent", "MAJOR=189\nDEVNAME=bus/usb/"+usb.bus+"\nDEVTYPE=usb_device\n")
+		write(dev+"/"+usb.port+":1.0/"+usb.tty+"/tty/"+usb.tty+"/uevent", "MAJOR=188\nDEVNAME="+usb.tty+"\n")
+		link(dev, "bus/usb/devices/"+usb.port)
+		link(dev+"/"+usb.port+":1.0/"+usb.tty+"/tty/"+usb.tty, "class/tty/"+usb.tty)
+	}
+
+	write("devices/virtual/misc/fuse/uevent", "MAJOR=10\nDEVNAME=fuse\n")
+	link("devices/virtual/misc/fuse", "class/misc/fuse")
+	return root
+}
+
+func Test_discoverDevices(t *testing.T) {
+	root := fakeSysfs(t)
+	defer os.RemoveAll(root)
+
+	devices, err := discoverDevices(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []HostDevice{
+		{Path: "/dev/bus/usb/001/002", USBId: "1546:01a7"},
+		{Path: "/dev/bus/usb/001/003", USBId: "0403:6001"},
+		{Path: "/dev/fuse"},
+		{Path: "/dev/ttyUSB0", USBId: "1546:01a7"},
+		{Path: "/dev/ttyUSB1", USBId: "0403:6001"},
+	}
+	if len(devices) != len(expected) {
+		t.Fatalf("expected %v, got %v", expected, devices)
+	}
+	for ix, dev := range expected {
+		if devices[ix] != dev {
+			t.Errorf("expected %v, got %v", dev, devices[ix])
+		}
+	}
+
+	gps := &persistence.HardwareMatch{USBDeviceIds: "1546:01a7", Devfiles: "/dev/ttyUSB*,/dev/ttyACM*"}
+	if matches := matchDevices("/dev/tty*", gps, devices); len(matches) != 1 || matches[0].Path != "/dev/ttyUSB0" {
+		t.Errorf("expected the hardware match to narrow the devices to /dev/ttyUSB0, got %v", matches)
+	} else if matches := matchDevices("/dev/ttyUSB*", nil, devices); len(matches) != 2 {
+		t.Errorf("expected both serial adapters to match, got %v", matches)
+	}
+}
+
+func Test_DeviceBroker_Claim(t *testing.T) {
+	root := fakeSysfs(t)
+	defer os.RemoveAll(root)
+
+	broker := NewDeviceBroker(root)
+
+	deployment := func(devices []string, shared []string) *containermessage.DeploymentDescription {
+		return &containermessage.DeploymentDescription{
+			Services: map[string]*containermessage.Service{
+				"serial": {Image: "serial:1.0", Devices: devices, SharedDevices: shared},
+			},
+		}
+	}
+
+	// A pattern is resolved to the first free device and the entry names it.
+	first := deployment([]string{"/dev/ttyUSB*:/dev/serial"}, nil)
+	if _, err := broker.Claim("ag1", first, nil); err != nil {
+		t.Fatal(err)
+	} else if first.Services["serial"].Devices[0] != "/dev/ttyUSB0:/dev/serial" {
+		t.Errorf("expected /dev/ttyUSB0 to be given to the first agreement, got %v", first.Services["serial"].Devices)
+	}
+
+	second := deployment([]string{"/dev/ttyUSB*:/dev/serial"}, nil)
+	if _, err := broker.Claim("ag2", second, nil); err != nil {
+		t.Fatal(err)
+	} else if second.Services["serial"].Devices[0] != "/dev/ttyUSB1:/dev/serial" {
+		t.Errorf("expected /dev/ttyUSB1 to be given to the second agreement, got %v", second.Services["serial"].Devices)
+	}
+
+	// Both adapters are held exclusively, a third agreement cannot get one.
+	if _, err := broker.Claim("ag3", deployment([]string{"/dev/ttyUSB*:/dev/serial"}, nil), nil); err == nil {
+		t.Errorf("expected no serial adapter to be available")
+	} else if _, err := broker.Claim("ag3", deployment([]string{"/dev/ttyUSB0:/dev/ttyUSB0"}, nil), nil); err == nil {
+		t.Errorf("expected /dev/ttyUSB0 to be held by the first agreement")
+	}
+
+	// Shared devices can be given to every container that shares them.
+	if _, err := broker.Claim("ag3", deployment([]string{"/dev/fuse:/dev/fuse"}, []string{"/dev/fuse"}), nil); err != nil {
+		t.Fatal(err)
+	} else if _, err := broker.Claim("ag4", deployment([]string{"/dev/fuse:/dev/fuse"}, []string{"/dev/fuse"}), nil); err != nil {
+		t.Errorf("expected /dev/fuse to be shared, got %v", err)
+	} else if _, err := broker.Claim("ag5", deployment([]string{"/dev/fuse:/dev/fuse"}, nil), nil); err == nil {
+		t.Errorf("expected /dev/fuse to be refused to an exclusive claim")
+	}
+
+	// The devices of a deployment are claimed all together or not at all.
+	if _, err := broker.Claim("ag5", deployment([]string{"/dev/bus/usb/001/002:/dev/gps", "/dev/ttyUSB1:/dev/serial"}, nil), nil); err == nil {
+		t.Errorf("expected /dev/ttyUSB1 to be held by the second agreement")
+	}
+	for _, c := range broker.Claims() {
+		if c.AgreementId == "ag5" {
+			t.Errorf("expected no devices to be claimed for ag5, got %v", c)
+		}
+	}
+
+	// Released devices can be claimed again.
+	broker.ReleaseAgreement("ag1")
+	if _, err := broker.Claim("ag5", deployment([]string{"/dev/ttyUSB*:/dev/serial"}, nil), &persistence.HardwareMatch{USBDeviceIds: "1546:01a7"}); err != nil {
+		t.Errorf("expected /dev/ttyUSB0 to be free again, got %v", err)
+	}
+
+	claims := broker.Claims()
+	if len(claims) != 4 || claims[0].Device != "/dev/fuse" || claims[2].Device != "/dev/ttyUSB0" || claims[2].AgreementId != "ag5" || claims[2].USBId != "1546:01a7" {
+		t.Errorf("unexpected claims %v", claims)
+	}
+}
+
+func Test_DeviceBroker_Release(t *testing.T) {
+	root := fakeSysfs(t)
+	defer os.RemoveAll(root)
+
+	broker := NewDeviceBroker(root)
+
+	// A deployment with a shared singleton service and a service of its own.
+	deployment := &containermessage.DeploymentDescription{
+		Services: map[string]*containermessage.Service{
+			"gps":    {Image: "gps:1.0", Devices: []string{"/dev/bus/usb/001/002:/dev/gps"}},
+			"serial": {Image: "serial:1.0", Devices: []string{"/dev/ttyUSB*:/dev/serial"}},
+		},
+		ServicePattern: containermessage.Pattern{Shared: map[string][]string{"singleton": {"gps"}}},
+	}
+
+	// The claims of a deployment that failed to start are all released, the singleton one too.
+	claims, err := broker.Claim("ag1", deployment, nil)
+	if err != nil {
+		t.Fatal(err)
+	} else if len(claims) != 2 {
+		t.Fatalf("expected 2 new claims, got %v", claims)
+	}
+	broker.ReleaseAgreement("ag1")
+	if remaining := broker.Claims(); len(remaining) != 1 || remaining[0].Container != "singleton-gps" {
+		t.Errorf("expected the singleton claim to be left to its container, got %v", remaining)
+	}
+	broker.Release(claims)
+	if remaining := broker.Claims(); len(remaining) != 0 {
+		t.Errorf("expected no claims after releasing the deployment, got %v", remaining)
+	}
+
+	// A singleton that is already running keeps its claim when another agreement fails to start.
+	if _, err := broker.Claim("ag1", deployment, nil); err != nil {
+		t.Fatal(err)
+	}
+	second := &containermessage.DeploymentDescription{
+		Services:       map[string]*containermessage.Service{"gps": {Image: "gps:1.0", Devices: []string{"/dev/bus/usb/001/002:/dev/gps"}}},
+		ServicePattern: containermessage.Pattern{Shared: map[string][]string{"singleton": {"gps"}}},
+	}
+	if claims, err := broker.Claim("ag2", second, nil); err != nil {
+		t.Fatal(err)
+	} else if len(claims) != 0 {
+		t.Errorf("expected the singleton to keep its claim, got %v", claims)
+	} else if broker.Release(claims); len(broker.Claims()) != 2 {
+		t.Errorf("expected the claims of the first agreement to be kept, got %v", broker.Claims())
+	}
+}
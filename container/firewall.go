@@ -0,0 +1,435 @@
+package container
+
+import (
+	"errors"
+	"fmt"
+	"github.com/coreos/go-iptables/iptables"
+	docker "github.com/fsouza/go-dockerclient"
+	"github.com/golang/glog"
+	"net"
+	"strconv"
+	"strings"
+)
+
+// Inbound traffic to the host ports that a service container publishes is limited to the source CIDRs that both the
+// node, in the InboundPermitOnly config, and the service, in the inbound_permit_only of its network isolation,
+// permit. The rules are in the isolation chain and are marked with the id of the container, so that they can be
+// removed with the container even when the container is shared by several agreements.
+//
+// Docker keeps the containers of different agreements on different bridges that cannot reach each other. The node
+// can permit the bridges of agreements to talk to each other, for agreements of the same org or for all agreements.
+// The rules are marked with both agreement ids, so that they are removed with either agreement.
+
+// The marker in the comment of the inbound rules.
+const IPT_INBOUND_MARKER = "inbound"
+
+// The marker in the comment of the rules that permit agreement bridges to talk to each other.
+const IPT_BRIDGE_MARKER = "bridge"
+
+// The values of the InterAgreementTraffic config.
+const INTER_AGREEMENT_NONE = "none"
+const INTER_AGREEMENT_ORG = "org"
+const INTER_AGREEMENT_ALL = "all"
+
+// Make sure that the isolation chain exists, ends with a RETURN rule, and is jumped to from the head of the FORWARD
+// chain.
+func ensureIsolationChain(ipt *iptables.IPTables) error {
+	rules, err := ipt.List("filter", IPT_COLONUS_ISOLATED_CHAIN)
+	if err != nil {
+		// could be that it just isn't created, try that
+		if err := ipt.NewChain("filter", IPT_COLONUS_ISOLATED_CHAIN); err != nil {
+			return err
+		} else if rules, err = ipt.List("filter", IPT_COLONUS_ISOLATED_CHAIN); err != nil {
+			return err
+		}
+	}
+
+	foundReturn := false
+	for _, rule := range rules {
+		if rule == fmt.Sprintf("-A %v -j RETURN", IPT_COLONUS_ISOLATED_CHAIN) {
+			foundReturn = true
+		}
+	}
+
+	if !foundReturn {
+		if err := ipt.Insert("filter", IPT_COLONUS_ISOLATED_CHAIN, 1, "-j", "RETURN"); err != nil {
+			return err
+		}
+	}
+
+	rules, err = ipt.List("filter", "FORWARD")
+	if err != nil {
+		return err
+	}
+	for _, rule := range rules {
+		if rule == fmt.Sprintf("-A FORWARD -j %v", IPT_COLONUS_ISOLATED_CHAIN) {
+			glog.Infof("rule: %v", rule)
+			if err := ipt.Delete("filter", "FORWARD", "-j", IPT_COLONUS_ISOLATED_CHAIN); err != nil {
+				return err
+			}
+		}
+	}
+
+	// need to always insert this at the head of the chain; if this fails, there will be no isolation security but normal container traffic will be allowed
+	return ipt.Insert("filter", "FORWARD", 1, "-j", IPT_COLONUS_ISOLATED_CHAIN)
+}
+
+// Convert a list of IPv4 addresses and CIDRs into CIDRs. An address is a CIDR of one address.
+func parsePermitList(list []string) ([]*net.IPNet, error) {
+	cidrs := make([]*net.IPNet, 0, len(list))
+	for _, entry := range list {
+		entry = strings.TrimSpace(entry)
+		cidrString := entry
+		if entry == "" {
+			continue
+		} else if !strings.Contains(entry, "/") {
+			cidrString += "/32"
+		}
+
+		if ip, cidr, err := net.ParseCIDR(cidrString); err != nil {
+			return nil, errors.New(fmt.Sprintf("%v is not an IP address or CIDR", entry))
+		} else if ip.To4() == nil {
+			return nil, errors.New(fmt.Sprintf("%v is not an IPv4 address or CIDR", entry))
+		} else {
+			cidrs = append(cidrs, cidr)
+		}
+	}
+	return cidrs, nil
+}
+
+// Return the CIDRs that are in both lists. Two CIDRs are either disjoint or one of them contains the other, so the
+// intersection is made of the smaller CIDR of each pair that overlaps.
+func intersectCIDRs(a []*net.IPNet, b []*net.IPNet) []*net.IPNet {
+	seen := make(map[string]bool)
+	res := make([]*net.IPNet, 0)
+	add := func(c *net.IPNet) {
+		if !seen[c.String()] {
+			seen[c.String()] = true
+			res = append(res, c)
+		}
+	}
+
+	for _, x := range a {
+		xOnes, _ := x.Mask.Size()
+		for _, y := range b {
+			yOnes, _ := y.Mask.Size()
+			if xOnes <= yOnes && x.Contains(y.IP) {
+				add(y)
+			} else if yOnes <= xOnes && y.Contains(x.IP) {
+				add(x)
+			}
+		}
+	}
+	return res
+}
+
+// Return the source CIDRs that may reach the published ports of a service container, from the comma separated list
+// of the node and the list of the service. When neither of them limits the sources, restricted is false.
+func inboundPermitted(nodePermit string, servicePermit []string) ([]string, bool, error) {
+	var nodeList []string
+	if nodePermit != "" {
+		nodeList = strings.Split(nodePermit, ",")
+	}
+
+	nodeCIDRs, err := parsePermitList(nodeList)
+	if err != nil {
+		return nil, false, errors.New(fmt.Sprintf("inbound permit list of the node has error: %v", err))
+	}
+	serviceCIDRs, err := parsePermitList(servicePermit)
+	if err != nil {
+		return nil, false, errors.New(fmt.Sprintf("inbound permit list of the service has error: %v", err))
+	}
+
+	var permitted []*net.IPNet
+	if len(nodeCIDRs) == 0 && len(serviceCIDRs) == 0 {
+		return nil, false, nil
+	} else if len(nodeCIDRs) == 0 {
+		permitted = serviceCIDRs
+	} else if len(serviceCIDRs) == 0 {
+		permitted = nodeCIDRs
+	} else {
+		permitted = intersectCIDRs(nodeCIDRs, serviceCIDRs)
+	}
+
+	res := make([]string, 0, len(permitted))
+	for _, c := range permitted {
+		res = append(res, c.String())
+	}
+	return res, true, nil
+}
+
+// The comment of the inbound rules of a container.
+func inboundComment(containerId string) string {
+	if len(containerId) > 12 {
+		containerId = containerId[:12]
+	}
+	return fmt.Sprintf("container_id=%v,%v", containerId, IPT_INBOUND_MARKER)
+}
+
+// Returns the position of the RETURN rule at the end of the isolation chain. A rule inserted at this position is
+// below the rules that isolate the bridges of agreements from each other.
+func returnPosition(ipt *iptables.IPTables) (int, error) {
+	rules, err := ipt.List("filter", IPT_COLONUS_ISOLATED_CHAIN)
+	if err != nil {
+		return 0, err
+	}
+
+	pos := 0
+	for ix, rule := range rules {
+		if rule == fmt.Sprintf("-A %v -j RETURN", IPT_COLONUS_ISOLATED_CHAIN) {
+			pos = ix
+		}
+	}
+	if pos == 0 {
+		return 0, errors.New(fmt.Sprintf("RETURN rule missing from %v chain", IPT_COLONUS_ISOLATED_CHAIN))
+	}
+	return pos, nil
+}
+
+// Create the rules that reject traffic to the published ports of a container unless it comes from a permitted CIDR.
+// The rules are inserted above the RETURN rule, below the rules that isolate containers, so that network isolation
+// still applies to the traffic that is permitted.
+func createInboundRules(ipt *iptables.IPTables, container *docker.Container, permitted []string) error {
+	if container.HostConfig == nil || container.NetworkSettings == nil {
+		return nil
+	}
+
+	comment := inboundComment(container.ID)
+	for port, _ := range container.HostConfig.PortBindings {
+		for name, network := range container.NetworkSettings.Networks {
+			if network.IPAddress == "" {
+				continue
+			}
+
+			glog.V(3).Infof("Creating inbound rules for port %v of container %v on network %v, permitted: %v", port, container.Name, name, permitted)
+
+			pos, err := returnPosition(ipt)
+			if err != nil {
+				return err
+			}
+
+			// the permit rules are inserted above the reject rule
+			if err := ipt.Insert("filter", IPT_COLONUS_ISOLATED_CHAIN, pos, "-d", network.IPAddress, "-p", port.Proto(), "--dport", port.Port(), "-j", "REJECT", "-m", "comment", "--comment", comment); err != nil {
+				return err
+			}
+			for _, cidr := range permitted {
+				if err := ipt.Insert("filter", IPT_COLONUS_ISOLATED_CHAIN, pos, "-s", cidr, "-d", network.IPAddress, "-p", port.Proto(), "--dport", port.Port(), "-j", "ACCEPT", "-m", "comment", "--comment", comment); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// Returns true when the InterAgreementTraffic config permits the bridges of agreements of the given orgs to talk.
+func bridgesMayTalk(traffic string, org string, peerOrg string) bool {
+	switch traffic {
+	case INTER_AGREEMENT_ALL:
+		return true
+	case INTER_AGREEMENT_ORG:
+		return org != "" && org == peerOrg
+	default:
+		return false
+	}
+}
+
+// Create the rules that permit the bridges of two agreements to talk to each other. The rules are inserted above the
+// RETURN rule, below the rules that isolate containers, so that network isolation still applies.
+func createBridgeRules(ipt *iptables.IPTables, agreementId string, device string, peerId string, peerDevice string) error {
+	pos, err := returnPosition(ipt)
+	if err != nil {
+		return err
+	}
+
+	comment := fmt.Sprintf("agreement_id=%v,peer_agreement_id=%v,%v", agreementId, peerId, IPT_BRIDGE_MARKER)
+	glog.V(3).Infof("Permitting bridges of agreements %v and %v to talk to each other", agreementId, peerId)
+	if err := ipt.Insert("filter", IPT_COLONUS_ISOLATED_CHAIN, pos, "-i", device, "-o", peerDevice, "-j", "ACCEPT", "-m", "comment", "--comment", comment); err != nil {
+		return err
+	}
+	return ipt.Insert("filter", IPT_COLONUS_ISOLATED_CHAIN, pos, "-i", peerDevice, "-o", device, "-j", "ACCEPT", "-m", "comment", "--comment", comment)
+}
+
+// Returns true when the rule belongs to one of the agreements, either as the agreement of the rule or, for a bridge
+// rule, as the peer agreement. The agreement ids are matched in full, the comment of a rule is a comma separated list.
+func agreementRule(rule string, agreements []string) bool {
+	for _, field := range strings.FieldsFunc(rule, func(r rune) bool { return r == ',' || r == '"' || r == ' ' }) {
+		for _, agreementId := range agreements {
+			if field == "agreement_id="+agreementId || field == "peer_agreement_id="+agreementId {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Delete the rules of the isolation chain that match.
+func deleteRules(ipt *iptables.IPTables, match func(rule string) bool) error {
+	rules, err := ipt.List("filter", IPT_COLONUS_ISOLATED_CHAIN)
+	if err != nil {
+		return err
+	}
+
+	// count backwards so we don't have to adjust the indices b/c they change w/ each ipt delete
+	for ix := len(rules) - 1; ix >= 0; ix-- {
+		if match(rules[ix]) {
+			glog.V(3).Infof("Deleting isolation rule: %v", rules[ix])
+			if err := ipt.Delete("filter", IPT_COLONUS_ISOLATED_CHAIN, strconv.Itoa(ix)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Create the inbound rules of a new service container.
+func (b *ContainerWorker) permitInbound(container *docker.Container) error {
+	if b.iptables == nil || container.HostConfig == nil || len(container.HostConfig.PortBindings) == 0 {
+		return nil
+	}
+
+	var servicePermit []string
+	if p := container.Config.Labels[LABEL_PREFIX+".inbound_permit_only"]; p != "" {
+		servicePermit = strings.Split(p, ",")
+	}
+
+	if permitted, restricted, err := inboundPermitted(b.Config.Edge.InboundPermitOnly, servicePermit); err != nil {
+		return err
+	} else if restricted {
+		return createInboundRules(b.iptables, container, permitted)
+	}
+	return nil
+}
+
+// Remove the inbound rules of a container that is removed.
+func (b *ContainerWorker) removeInbound(containerId string) error {
+	if b.iptables == nil {
+		return nil
+	} else if exists, err := b.iptables.Exists("filter", IPT_COLONUS_ISOLATED_CHAIN, "-j", "RETURN"); err != nil || !exists {
+		return err
+	}
+	comment := inboundComment(containerId)
+	return deleteRules(b.iptables, func(rule string) bool { return strings.Contains(rule, comment) })
+}
+
+// Returns true when the InterAgreementTraffic config permits the bridges of some agreements to talk to each other.
+func (b *ContainerWorker) bridgesPermitted() bool {
+	return b.iptables != nil && b.Config.Edge.InterAgreementTraffic != "" && b.Config.Edge.InterAgreementTraffic != INTER_AGREEMENT_NONE
+}
+
+// Returns the docker networks by name, the bridge of an agreement is the network named after the agreement.
+func (b *ContainerWorker) listBridges() (map[string]docker.Network, error) {
+	networks, err := b.client.ListNetworks()
+	if err != nil {
+		return nil, err
+	}
+	bridges := make(map[string]docker.Network)
+	for _, net := range networks {
+		bridges[net.Name] = net
+	}
+	return bridges, nil
+}
+
+// Permit the bridge of an agreement to talk to the bridges of the other agreements, as far as the InterAgreementTraffic
+// config allows. The agreements in skip are left alone.
+func (b *ContainerWorker) permitAgreementBridges(agreementId string, org string, skip map[string]bool) error {
+	if !b.bridgesPermitted() {
+		return nil
+	}
+
+	bridges, err := b.listBridges()
+	if err != nil {
+		return err
+	}
+	containers, err := b.client.ListContainers(docker.ListContainersOptions{})
+	if err != nil {
+		return err
+	}
+	return b.permitBridges(agreementId, org, skip, bridges, containers)
+}
+
+// Permit the bridge of an agreement to talk to the bridges of the other agreements, given the networks by name and
+// the running containers.
+func (b *ContainerWorker) permitBridges(agreementId string, org string, skip map[string]bool, bridges map[string]docker.Network, containers []docker.APIContainers) error {
+	bridge, ok := bridges[agreementId]
+	if !ok {
+		return nil
+	}
+
+	// The org of each of the other agreements, from the labels of its containers.
+	peers := make(map[string]string)
+	for _, con := range containers {
+		peerId := con.Labels[LABEL_PREFIX+".agreement_id"]
+		if _, infra := con.Labels[LABEL_PREFIX+".infrastructure"]; infra || peerId == "" || peerId == agreementId || skip[peerId] {
+			continue
+		}
+		peers[peerId] = con.Labels[LABEL_PREFIX+".org"]
+	}
+
+	for peerId, peerOrg := range peers {
+		if peerBridge, ok := bridges[peerId]; !ok || !bridgesMayTalk(b.Config.Edge.InterAgreementTraffic, org, peerOrg) {
+			continue
+		} else if err := createBridgeRules(b.iptables, agreementId, bridgeDevice(&bridge), peerId, bridgeDevice(&peerBridge)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Re-create the inbound and bridge rules of the running service containers. The rules do not survive a reboot of the
+// host, while docker restarts the containers, possibly with different addresses.
+func (b *ContainerWorker) restoreFirewall() error {
+	if b.iptables == nil {
+		return nil
+	}
+
+	if err := ensureIsolationChain(b.iptables); err != nil {
+		return err
+	} else if err := deleteRules(b.iptables, func(rule string) bool {
+		return strings.Contains(rule, ","+IPT_INBOUND_MARKER) || strings.Contains(rule, ","+IPT_BRIDGE_MARKER)
+	}); err != nil {
+		return err
+	}
+
+	containers, err := b.client.ListContainers(docker.ListContainersOptions{})
+	if err != nil {
+		return err
+	}
+
+	agreements := make(map[string]string)
+	for _, con := range containers {
+		if _, there := con.Labels[LABEL_PREFIX+".service_name"]; !there {
+			continue
+		}
+
+		if conDetail, err := b.client.InspectContainer(con.ID); err != nil {
+			return err
+		} else if err := b.permitInbound(conDetail); err != nil {
+			return err
+		}
+
+		if _, infra := con.Labels[LABEL_PREFIX+".infrastructure"]; !infra && con.Labels[LABEL_PREFIX+".agreement_id"] != "" {
+			agreements[con.Labels[LABEL_PREFIX+".agreement_id"]] = con.Labels[LABEL_PREFIX+".org"]
+		}
+	}
+
+	if !b.bridgesPermitted() {
+		return nil
+	}
+
+	// The networks and containers are listed once for all the agreements.
+	bridges, err := b.listBridges()
+	if err != nil {
+		return err
+	}
+
+	// each pair of agreements is permitted once
+	done := make(map[string]bool)
+	for agreementId, org := range agreements {
+		done[agreementId] = true
+		if err := b.permitBridges(agreementId, org, done, bridges, containers); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,95 @@
+// +build unit
+
+package container
+
+import (
+	"encoding/json"
+	"github.com/open-horizon/anax/containermessage"
+	"reflect"
+	"testing"
+)
+
+func Test_inboundPermitted(t *testing.T) {
+	if _, restricted, err := inboundPermitted("", nil); err != nil || restricted {
+		t.Errorf("expected no restriction, got %v %v", restricted, err)
+	}
+
+	if permitted, restricted, err := inboundPermitted("10.0.0.0/8, 192.168.1.5", nil); err != nil || !restricted {
+		t.Errorf("expected a restriction, got %v %v", restricted, err)
+	} else if !reflect.DeepEqual(permitted, []string{"10.0.0.0/8", "192.168.1.5/32"}) {
+		t.Errorf("expected the node list, got %v", permitted)
+	}
+
+	if permitted, _, err := inboundPermitted("", []string{"172.16.0.0/12"}); err != nil || !reflect.DeepEqual(permitted, []string{"172.16.0.0/12"}) {
+		t.Errorf("expected the service list, got %v %v", permitted, err)
+	}
+
+	// Only the sources that both the node and the service permit are permitted.
+	if permitted, _, err := inboundPermitted("10.0.0.0/8,192.168.0.0/16", []string{"10.1.0.0/16", "192.0.0.0/8", "172.16.0.1"}); err != nil {
+		t.Error(err)
+	} else if !reflect.DeepEqual(permitted, []string{"10.1.0.0/16", "192.168.0.0/16"}) {
+		t.Errorf("expected the intersection, got %v", permitted)
+	}
+
+	// Nothing in common permits no sources at all.
+	if permitted, restricted, err := inboundPermitted("10.0.0.0/8", []string{"172.16.0.0/12"}); err != nil || !restricted || len(permitted) != 0 {
+		t.Errorf("expected no sources to be permitted, got %v %v %v", permitted, restricted, err)
+	}
+
+	for _, bad := range []string{"10.0.0.0/33", "host.example.com", "fe80::1"} {
+		if _, _, err := inboundPermitted(bad, nil); err == nil {
+			t.Errorf("expected %v to be refused", bad)
+		}
+	}
+}
+
+func Test_bridgesMayTalk(t *testing.T) {
+	if bridgesMayTalk("", "org1", "org1") || bridgesMayTalk(INTER_AGREEMENT_NONE, "org1", "org1") {
+		t.Errorf("expected bridges to be isolated by default")
+	} else if !bridgesMayTalk(INTER_AGREEMENT_ORG, "org1", "org1") || bridgesMayTalk(INTER_AGREEMENT_ORG, "org1", "org2") || bridgesMayTalk(INTER_AGREEMENT_ORG, "", "") {
+		t.Errorf("expected only bridges of the same org to talk")
+	} else if !bridgesMayTalk(INTER_AGREEMENT_ALL, "org1", "org2") {
+		t.Errorf("expected all bridges to talk")
+	}
+}
+
+func Test_agreementRule(t *testing.T) {
+	rules := []string{
+		"-N COLONUS-ISOLATED",
+		`-A COLONUS-ISOLATED -s 172.17.0.2/32 -d 172.17.0.3/32 -m comment --comment "agreement_id=a1" -j ACCEPT`,
+		`-A COLONUS-ISOLATED -i br-a2 -o br-a1 -m comment --comment "agreement_id=a2,peer_agreement_id=a1,bridge" -j ACCEPT`,
+		`-A COLONUS-ISOLATED -i br-a2 -o br-a3 -m comment --comment "agreement_id=a2,peer_agreement_id=a3,bridge" -j ACCEPT`,
+		`-A COLONUS-ISOLATED -s 172.17.0.4/32 -d 172.17.0.5/32 -m comment --comment "agreement_id=a11" -j ACCEPT`,
+		"-A COLONUS-ISOLATED -j RETURN",
+	}
+
+	// The rules of an agreement include the bridge rules of its peers, and each rule is matched once.
+	matched := []int{}
+	for ix, rule := range rules {
+		if agreementRule(rule, []string{"a1", "a2"}) {
+			matched = append(matched, ix)
+		}
+	}
+	if len(matched) != 3 || matched[0] != 1 || matched[1] != 2 || matched[2] != 3 {
+		t.Errorf("expected the rules of a1 and a2 to match, got %v", matched)
+	}
+
+	if agreementRule(rules[4], []string{"a1"}) {
+		t.Errorf("expected agreement ids to be matched in full")
+	} else if !agreementRule(rules[2], []string{"a1"}) {
+		t.Errorf("expected a bridge rule to match its peer agreement")
+	}
+}
+
+func Test_UnmarshalInboundPermitOnly(t *testing.T) {
+	var n containermessage.NetworkIsolation
+	if err := json.Unmarshal([]byte(`{"outbound_permit_only": ["4.2.2.2"], "inbound_permit_only": ["10.0.0.0/8"]}`), &n); err != nil {
+		t.Error(err)
+	} else if len(n.InboundPermitOnly) != 1 || n.InboundPermitOnly[0] != "10.0.0.0/8" {
+		t.Errorf("expected the inbound permit list, got %v", n.InboundPermitOnly)
+	}
+
+	if c := inboundComment("0123456789abcdef"); c != "container_id=0123456789ab,inbound" {
+		t.Errorf("expected the short container id in the comment, got %v", c)
+	}
+}
@@ -0,0 +1,82 @@
+package container
+
+import (
+	"fmt"
+	docker "github.com/fsouza/go-dockerclient"
+	"github.com/golang/glog"
+	"github.com/open-horizon/anax/containermessage"
+	"time"
+)
+
+// The docker health status of a container that has failed its health check the configured number of times in a row.
+const HEALTH_UNHEALTHY = "unhealthy"
+
+// The docker health status of a container whose last health check passed.
+const HEALTH_HEALTHY = "healthy"
+
+// The number of seconds docker waits for an unhealthy container to stop before killing it, when the container is restarted.
+const HEALTH_RESTART_TIMEOUT_S = 10
+
+// Map the health check of a service onto a docker healthcheck. The HTTP and TCP probes run in a shell in the
+// container, so the image must provide wget or nc respectively. Zero values are left to the docker defaults.
+func healthConfig(hc *containermessage.HealthCheck) (*docker.HealthConfig, error) {
+	if hc == nil {
+		return nil, nil
+	} else if err := hc.Validate(); err != nil {
+		return nil, err
+	}
+
+	var test []string
+	if len(hc.Exec) != 0 {
+		test = append([]string{"CMD"}, hc.Exec...)
+	} else if hc.HTTPPort != 0 {
+		path := hc.HTTPPath
+		if path == "" {
+			path = "/"
+		}
+		test = []string{"CMD-SHELL", fmt.Sprintf("wget -q -O /dev/null http://127.0.0.1:%v%v || exit 1", hc.HTTPPort, path)}
+	} else {
+		test = []string{"CMD-SHELL", fmt.Sprintf("nc -z 127.0.0.1 %v || exit 1", hc.TCPPort)}
+	}
+
+	return &docker.HealthConfig{
+		Test:        test,
+		Interval:    time.Duration(hc.IntervalS) * time.Second,
+		Timeout:     time.Duration(hc.TimeoutS) * time.Second,
+		StartPeriod: time.Duration(hc.StartS) * time.Second,
+		Retries:     hc.Retries,
+	}, nil
+}
+
+// Docker restarts containers that exit because of their restart policy, so the container worker only finds out
+// about restarts by inspecting the containers. Count the restarts since the last time each container was maintained,
+// and return the names of the services whose containers docker reports as unhealthy. The containers are healthy when
+// each of them has either passed its last health check or has no health check.
+func (b *ContainerWorker) inspectMaintained(containers []docker.APIContainers) ([]string, bool) {
+	unhealthy := make([]string, 0)
+	healthy := true
+	for _, c := range containers {
+		if container, err := b.client.InspectContainer(c.ID); err != nil {
+			glog.V(3).Infof("Unable to inspect container %v for restarts and health, error: %v", c.ID, err)
+			healthy = false
+		} else {
+			serviceName := c.Labels[LABEL_PREFIX+".service_name"]
+			if last, ok := b.restartCounts[c.ID]; ok && container.RestartCount > last {
+				glog.Warningf("Service %v container %v has restarted %v times since it was last checked", serviceName, c.ID, container.RestartCount-last)
+				containerRestarts.Add(float64(container.RestartCount-last), serviceName)
+			} else if !ok && container.RestartCount != 0 {
+				containerRestarts.Add(float64(container.RestartCount), serviceName)
+			}
+			b.restartCounts[c.ID] = container.RestartCount
+
+			if container.State.Health.Status == HEALTH_UNHEALTHY {
+				glog.Warningf("Service %v container %v is unhealthy, failing streak %v", serviceName, c.ID, container.State.Health.FailingStreak)
+				unhealthy = append(unhealthy, serviceName)
+			}
+			if status := container.State.Health.Status; status != "" && status != HEALTH_HEALTHY {
+				healthy = false
+			}
+		}
+	}
+	return unhealthy, healthy
+}
@@ -0,0 +1,59 @@
+// +build unit
+
+package container
+
+import (
+	"github.com/open-horizon/anax/containermessage"
+	"strings"
+	"testing"
+	"time"
+)
+
+func Test_healthConfig(t *testing.T) {
+	if hc, err := healthConfig(nil); err != nil || hc != nil {
+		t.Errorf("expected no health check, got %v %v", hc, err)
+	}
+
+	hc, err := healthConfig(&containermessage.HealthCheck{Exec: []string{"/bin/check", "-q"}, IntervalS: 30, TimeoutS: 5, Retries: 3, StartS: 60})
+	if err != nil {
+		t.Errorf("unexpected error %v", err)
+	} else if len(hc.Test) != 3 || hc.Test[0] != "CMD" || hc.Test[1] != "/bin/check" || hc.Test[2] != "-q" {
+		t.Errorf("expected the exec command to be run directly, got %v", hc.Test)
+	} else if hc.Interval != 30*time.Second || hc.Timeout != 5*time.Second || hc.StartPeriod != time.Minute || hc.Retries != 3 {
+		t.Errorf("expected the probe timings to be converted, got %v", hc)
+	}
+
+	if hc, err := healthConfig(&containermessage.HealthCheck{HTTPPort: 8080}); err != nil {
+		t.Errorf("unexpected error %v", err)
+	} else if hc.Test[0] != "CMD-SHELL" || !strings.Contains(hc.Test[1], "http://127.0.0.1:8080/ ") {
+		t.Errorf("expected an HTTP probe of the root path, got %v", hc.Test)
+	} else if hc.Interval != 0 || hc.Retries != 0 {
+		t.Errorf("expected the docker defaults, got %v", hc)
+	}
+
+	if hc, err := healthConfig(&containermessage.HealthCheck{HTTPPort: 8080, HTTPPath: "/status"}); err != nil {
+		t.Errorf("unexpected error %v", err)
+	} else if !strings.Contains(hc.Test[1], "http://127.0.0.1:8080/status ") {
+		t.Errorf("expected an HTTP probe of the status path, got %v", hc.Test)
+	}
+
+	if hc, err := healthConfig(&containermessage.HealthCheck{TCPPort: 5432}); err != nil {
+		t.Errorf("unexpected error %v", err)
+	} else if hc.Test[0] != "CMD-SHELL" || !strings.Contains(hc.Test[1], "nc -z 127.0.0.1 5432") {
+		t.Errorf("expected a TCP probe, got %v", hc.Test)
+	}
+
+	// Invalid health checks.
+	for _, bad := range []containermessage.HealthCheck{
+		{},
+		{HTTPPort: 8080, TCPPort: 80},
+		{TCPPort: 70000},
+		{TCPPort: 80, HTTPPath: "/status"},
+		{HTTPPort: 8080, HTTPPath: "status"},
+		{Exec: []string{"true"}, Retries: -1},
+	} {
+		if _, err := healthConfig(&bad); err == nil {
+			t.Errorf("expected health check %v to be rejected", bad)
+		}
+	}
+}
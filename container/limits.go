@@ -0,0 +1,103 @@
+package container
+
+import (
+	"fmt"
+	docker "github.com/fsouza/go-dockerclient"
+	"github.com/golang/glog"
+	"github.com/open-horizon/anax/persistence"
+	"os/exec"
+	"strings"
+)
+
+// The length of the docker CPU scheduling period, in microseconds. The CPU quota is a number of CPUs worth of
+// this period.
+const CPU_PERIOD = 100000
+
+// The relative CPU weight that docker gives a container by default. A container limited to N CPUs is given
+// N times this weight.
+const CPU_SHARES_PER_CPU = 1024
+
+// Apply the memory and CPU limits from an agreement to the docker configuration of a service container and
+// return the limits that were applied. The limits are a budget for the whole agreement, so each of the given number
+// of service containers in the deployment gets an equal share of it. The memory limit never raises the memory that
+// the node allows a container to have.
+func applyResourceLimits(serviceConfig *persistence.ServiceConfig, limits *persistence.ResourceLimits, services int) *persistence.EnforcedLimits {
+	if limits == nil || limits.IsEmpty() {
+		return nil
+	} else if services < 1 {
+		services = 1
+	}
+
+	enforced := new(persistence.EnforcedLimits)
+
+	if limits.MemoryMB > 0 {
+		memBytes := limits.MemoryMB * 1024 * 1024 / int64(services)
+		if serviceConfig.HostConfig.Memory == 0 || memBytes < serviceConfig.HostConfig.Memory {
+			serviceConfig.HostConfig.Memory = memBytes
+		}
+		enforced.Memory = serviceConfig.HostConfig.Memory
+	}
+
+	if limits.CPUs > 0 {
+		serviceConfig.HostConfig.CPUPeriod = CPU_PERIOD
+		serviceConfig.HostConfig.CPUQuota = int64(limits.CPUs) * CPU_PERIOD / int64(services)
+		serviceConfig.HostConfig.CPUShares = int64(limits.CPUs) * CPU_SHARES_PER_CPU / int64(services)
+		enforced.CPUPeriod = serviceConfig.HostConfig.CPUPeriod
+		enforced.CPUQuota = serviceConfig.HostConfig.CPUQuota
+		enforced.CPUShares = serviceConfig.HostConfig.CPUShares
+	}
+
+	// The network limits are recorded once the agreement bridge has been shaped.
+	return enforced
+}
+
+// Docker names the device of a bridge network after the network id, unless the network was created with a
+// bridge name option, which mkBridge does not use.
+func bridgeDevice(network *docker.Network) string {
+	id := network.ID
+	if len(id) > 12 {
+		id = id[:12]
+	}
+	return "br-" + id
+}
+
+// Return the tc commands that limit the bandwidth of a bridge device. Traffic sent by the containers is received
+// by the bridge device, so uploads are policed on the ingress of the device. Traffic to the containers is
+// transmitted by the bridge device, so downloads are shaped on the egress of the device.
+func shapingCommands(device string, uploadKbps int, downloadKbps int) [][]string {
+	cmds := make([][]string, 0, 3)
+
+	if downloadKbps > 0 {
+		cmds = append(cmds, []string{"qdisc", "replace", "dev", device, "root", "tbf",
+			"rate", fmt.Sprintf("%vkbit", downloadKbps), "burst", fmt.Sprintf("%vkbit", burstKbit(downloadKbps)), "latency", "400ms"})
+	}
+
+	if uploadKbps > 0 {
+		cmds = append(cmds, []string{"qdisc", "replace", "dev", device, "handle", "ffff:", "ingress"})
+		cmds = append(cmds, []string{"filter", "replace", "dev", device, "parent", "ffff:", "protocol", "all", "prio", "1", "u32",
+			"match", "u32", "0", "0", "police", "rate", fmt.Sprintf("%vkbit", uploadKbps), "burst", fmt.Sprintf("%vkbit", burstKbit(uploadKbps)), "drop", "flowid", ":1"})
+	}
+
+	return cmds
+}
+
+// The bucket size has to hold at least one full sized packet, and should hold roughly 100ms of traffic at the
+// given rate.
+func burstKbit(rateKbps int) int {
+	burst := rateKbps / 10
+	if burst < 32 {
+		burst = 32
+	}
+	return burst
+}
+
+// Limit the bandwidth of the given bridge device. The shaping rules disappear when the bridge is removed.
+func shapeBridge(device string, uploadKbps int, downloadKbps int) error {
+	for _, args := range shapingCommands(device, uploadKbps, downloadKbps) {
+		glog.V(5).Infof("Shaping traffic on %v: tc %v", device, strings.Join(args, " "))
+		if out, err := exec.Command("tc", args...).CombinedOutput(); err != nil {
+			return fmt.Errorf("Failed to shape traffic on bridge %v, tc %v returned %v, output: %v", device, strings.Join(args, " "), err, string(out))
+		}
+	}
+	return nil
+}
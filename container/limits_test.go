@@ -0,0 +1,64 @@
+// +build unit
+
+package container
+
+import (
+	docker "github.com/fsouza/go-dockerclient"
+	"github.com/open-horizon/anax/persistence"
+	"strings"
+	"testing"
+)
+
+func Test_applyResourceLimits(t *testing.T) {
+	sc := &persistence.ServiceConfig{HostConfig: docker.HostConfig{Memory: 256 * 1024 * 1024}}
+
+	if enforced := applyResourceLimits(sc, nil, 1); enforced != nil {
+		t.Errorf("expected no limits to be enforced, got %v", enforced)
+	}
+
+	enforced := applyResourceLimits(sc, &persistence.ResourceLimits{MemoryMB: 128, CPUs: 2}, 1)
+	if enforced == nil {
+		t.Errorf("expected limits to be enforced")
+	} else if sc.HostConfig.Memory != 128*1024*1024 || enforced.Memory != sc.HostConfig.Memory {
+		t.Errorf("expected memory limit of 128MB, got %v and %v", sc.HostConfig.Memory, enforced.Memory)
+	} else if sc.HostConfig.CPUQuota != 2*CPU_PERIOD || sc.HostConfig.CPUPeriod != CPU_PERIOD || sc.HostConfig.CPUShares != 2*CPU_SHARES_PER_CPU {
+		t.Errorf("expected a CPU quota of 2 CPUs, got %v", sc.HostConfig)
+	} else if enforced.CPUQuota != sc.HostConfig.CPUQuota || enforced.CPUShares != sc.HostConfig.CPUShares {
+		t.Errorf("expected the enforced CPU limits to be recorded, got %v", enforced)
+	}
+
+	// The agreement cannot raise the memory that the node allows.
+	sc = &persistence.ServiceConfig{HostConfig: docker.HostConfig{Memory: 64 * 1024 * 1024}}
+	if enforced := applyResourceLimits(sc, &persistence.ResourceLimits{MemoryMB: 128}, 1); sc.HostConfig.Memory != 64*1024*1024 || enforced.Memory != 64*1024*1024 {
+		t.Errorf("expected memory limit to stay at 64MB, got %v", sc.HostConfig.Memory)
+	}
+
+	// The services of a deployment share the limits of the agreement.
+	sc = &persistence.ServiceConfig{HostConfig: docker.HostConfig{Memory: 256 * 1024 * 1024}}
+	if enforced := applyResourceLimits(sc, &persistence.ResourceLimits{MemoryMB: 128, CPUs: 1}, 4); sc.HostConfig.Memory != 32*1024*1024 || enforced.Memory != 32*1024*1024 {
+		t.Errorf("expected a quarter of the memory limit, got %v", sc.HostConfig.Memory)
+	} else if sc.HostConfig.CPUQuota != CPU_PERIOD/4 || sc.HostConfig.CPUShares != CPU_SHARES_PER_CPU/4 {
+		t.Errorf("expected a quarter of a CPU, got %v", sc.HostConfig)
+	}
+}
+
+func Test_shapingCommands(t *testing.T) {
+	if cmds := shapingCommands("br-0123456789ab", 0, 0); len(cmds) != 0 {
+		t.Errorf("expected no commands, got %v", cmds)
+	}
+
+	cmds := shapingCommands("br-0123456789ab", 512, 2048)
+	if len(cmds) != 3 {
+		t.Errorf("expected 3 commands, got %v", cmds)
+	} else if c := strings.Join(cmds[0], " "); c != "qdisc replace dev br-0123456789ab root tbf rate 2048kbit burst 204kbit latency 400ms" {
+		t.Errorf("unexpected download command %v", c)
+	} else if c := strings.Join(cmds[2], " "); !strings.Contains(c, "police rate 512kbit burst 51kbit drop") {
+		t.Errorf("unexpected upload command %v", c)
+	}
+}
+
+func Test_bridgeDevice(t *testing.T) {
+	if d := bridgeDevice(&docker.Network{ID: "0123456789abcdef0123"}); d != "br-0123456789ab" {
+		t.Errorf("unexpected bridge device name %v", d)
+	}
+}
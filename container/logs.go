@@ -0,0 +1,205 @@
+package container
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	docker "github.com/fsouza/go-dockerclient"
+	"github.com/golang/glog"
+	"github.com/open-horizon/anax/config"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// The docker log drivers that service containers can be configured to use. Docker can only read the logs of a
+// container back for the logs API when the container uses the json-file, local or journald driver, which is why
+// json-file is the default.
+const (
+	LOG_DRIVER_SYSLOG    = "syslog"
+	LOG_DRIVER_JSON_FILE = "json-file"
+	LOG_DRIVER_LOCAL     = "local"
+	LOG_DRIVER_JOURNALD  = "journald"
+	LOG_DRIVER_FLUENTD   = "fluentd"
+)
+
+// Defaults for the log driver options that are not set in the config file.
+const DEFAULT_LOG_MAX_SIZE_MB = 10
+const DEFAULT_LOG_MAX_FILES = 3
+const DEFAULT_FLUENTD_ADDRESS = "unix:///var/run/fluentd/fluentd.sock"
+
+// Returns the docker log configuration of a service container, for the log driver in the config. The tag
+// identifies the container in the logs that are shared by all the containers, e.g. syslog.
+func containerLogConfig(cfg *config.Config, tag string) (docker.LogConfig, error) {
+
+	driver := LOG_DRIVER_JSON_FILE
+	if cfg != nil && cfg.ContainerLogDriver != "" {
+		driver = cfg.ContainerLogDriver
+	}
+
+	logConfig := docker.LogConfig{
+		Type: driver,
+		Config: map[string]string{
+			"tag": tag,
+		},
+	}
+
+	switch driver {
+	case LOG_DRIVER_SYSLOG, LOG_DRIVER_JOURNALD:
+		// The tag is all they need.
+
+	case LOG_DRIVER_JSON_FILE, LOG_DRIVER_LOCAL:
+		maxSize := DEFAULT_LOG_MAX_SIZE_MB
+		if cfg != nil && cfg.ContainerLogMaxSizeMB > 0 {
+			maxSize = cfg.ContainerLogMaxSizeMB
+		}
+		maxFiles := DEFAULT_LOG_MAX_FILES
+		if cfg != nil && cfg.ContainerLogMaxFiles > 0 {
+			maxFiles = cfg.ContainerLogMaxFiles
+		}
+		logConfig.Config["max-size"] = fmt.Sprintf("%vm", maxSize)
+		logConfig.Config["max-file"] = strconv.Itoa(maxFiles)
+
+	case LOG_DRIVER_FLUENTD:
+		address := DEFAULT_FLUENTD_ADDRESS
+		if cfg.ContainerLogFluentdAddress != "" {
+			address = cfg.ContainerLogFluentdAddress
+		}
+		logConfig.Config["fluentd-address"] = address
+		// Do not fail to start the container when the local fluentd is not running yet.
+		logConfig.Config["fluentd-async-connect"] = "true"
+
+	default:
+		return logConfig, errors.New(fmt.Sprintf("container log driver %v is not supported, use one of %v, %v, %v, %v or %v", driver, LOG_DRIVER_JSON_FILE, LOG_DRIVER_LOCAL, LOG_DRIVER_JOURNALD, LOG_DRIVER_SYSLOG, LOG_DRIVER_FLUENTD))
+	}
+
+	return logConfig, nil
+}
+
+// Returns the workload and microservice containers, running or not, that the match function selects.
+func (b *ContainerWorker) MatchingContainers(match func(*docker.APIContainers) bool) ([]docker.APIContainers, error) {
+	containers, err := b.client.ListContainers(docker.ListContainersOptions{All: true})
+	if err != nil {
+		return nil, errors.New(fmt.Sprintf("unable to list docker containers, error %v", err))
+	}
+
+	matches := make([]docker.APIContainers, 0)
+	for _, c := range containers {
+		if _, ok := c.Labels[LABEL_PREFIX+".service_name"]; ok && match(&c) {
+			matches = append(matches, c)
+		}
+	}
+	return matches, nil
+}
+
+// Write the logs of the containers to the output, stdout and stderr together. The tail is the number of lines to
+// write from the end of each log, or "all". When following, the logs are written as they grow until the context
+// is done. When there is more than one container, each line is prefixed with the name of its container.
+func (b *ContainerWorker) StreamLogs(ctx context.Context, containers []docker.APIContainers, tail string, follow bool, out io.Writer) error {
+
+	if tail != "all" {
+		if n, err := strconv.Atoi(tail); err != nil || n < 0 {
+			return errors.New(fmt.Sprintf("tail %v must be a number of lines or all", tail))
+		}
+	}
+
+	shared := &syncWriter{out: out}
+	errs := make(chan error, len(containers))
+	var wg sync.WaitGroup
+
+	for _, c := range containers {
+		var w io.Writer = shared
+		if len(containers) > 1 {
+			w = &prefixWriter{out: shared, prefix: []byte(containerName(&c) + " | ")}
+		}
+
+		opts := docker.LogsOptions{
+			Context:      ctx,
+			Container:    c.ID,
+			OutputStream: w,
+			ErrorStream:  w,
+			Tail:         tail,
+			Follow:       follow,
+			Stdout:       true,
+			Stderr:       true,
+		}
+
+		wg.Add(1)
+		go func(opts docker.LogsOptions, w io.Writer) {
+			defer wg.Done()
+			glog.V(5).Infof("Streaming logs of container %v, tail %v, follow %v", opts.Container, opts.Tail, opts.Follow)
+			if err := b.client.Logs(opts); err != nil && ctx.Err() == nil {
+				errs <- errors.New(fmt.Sprintf("unable to read the logs of container %v, error %v", opts.Container, err))
+			}
+			if pw, ok := w.(*prefixWriter); ok {
+				pw.Flush()
+			}
+		}(opts, w)
+	}
+
+	wg.Wait()
+	close(errs)
+	return <-errs
+}
+
+func containerName(c *docker.APIContainers) string {
+	if len(c.Names) != 0 {
+		return strings.TrimPrefix(c.Names[0], "/")
+	}
+	return c.ID
+}
+
+// Serializes the writes of several log streams, and flushes each write when the output can be flushed so that a
+// follower sees the lines as they are logged.
+type syncWriter struct {
+	lock sync.Mutex
+	out  io.Writer
+}
+
+func (s *syncWriter) Write(p []byte) (int, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	n, err := s.out.Write(p)
+	if f, ok := s.out.(interface {
+		Flush()
+	}); ok {
+		f.Flush()
+	}
+	return n, err
+}
+
+// Prefixes each complete line with the prefix. A partial line is held until it is completed or flushed.
+type prefixWriter struct {
+	out     io.Writer
+	prefix  []byte
+	partial []byte
+}
+
+func (p *prefixWriter) Write(b []byte) (int, error) {
+	p.partial = append(p.partial, b...)
+	var lines []byte
+	for {
+		ix := bytes.IndexByte(p.partial, '\n')
+		if ix == -1 {
+			break
+		}
+		lines = append(lines, p.prefix...)
+		lines = append(lines, p.partial[:ix+1]...)
+		p.partial = p.partial[ix+1:]
+	}
+	if len(lines) != 0 {
+		if _, err := p.out.Write(lines); err != nil {
+			return 0, err
+		}
+	}
+	return len(b), nil
+}
+
+func (p *prefixWriter) Flush() {
+	if len(p.partial) != 0 {
+		p.out.Write(append(append(append([]byte{}, p.prefix...), p.partial...), '\n'))
+		p.partial = nil
+	}
+}
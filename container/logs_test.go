@@ -0,0 +1,57 @@
+// +build unit
+
+package container
+
+import (
+	"bytes"
+	"github.com/open-horizon/anax/config"
+	"testing"
+)
+
+func Test_containerLogConfig(t *testing.T) {
+	if lc, err := containerLogConfig(&config.Config{}, "workload-netspeed5"); err != nil {
+		t.Errorf("unexpected error %v", err)
+	} else if lc.Type != LOG_DRIVER_JSON_FILE || lc.Config["tag"] != "workload-netspeed5" {
+		t.Errorf("expected json-file to be the default log driver, got %v", lc)
+	} else if lc.Config["max-size"] != "10m" || lc.Config["max-file"] != "3" {
+		t.Errorf("expected the default log rotation, got %v", lc.Config)
+	}
+
+	if lc, err := containerLogConfig(&config.Config{ContainerLogDriver: LOG_DRIVER_SYSLOG}, "tag"); err != nil {
+		t.Errorf("unexpected error %v", err)
+	} else if lc.Type != LOG_DRIVER_SYSLOG || len(lc.Config) != 1 {
+		t.Errorf("expected only a tag for syslog, got %v", lc)
+	}
+
+	if lc, err := containerLogConfig(&config.Config{ContainerLogDriver: LOG_DRIVER_LOCAL, ContainerLogMaxSizeMB: 50, ContainerLogMaxFiles: 5}, "tag"); err != nil {
+		t.Errorf("unexpected error %v", err)
+	} else if lc.Config["max-size"] != "50m" || lc.Config["max-file"] != "5" {
+		t.Errorf("expected the configured log rotation, got %v", lc.Config)
+	}
+
+	if lc, err := containerLogConfig(&config.Config{ContainerLogDriver: LOG_DRIVER_FLUENTD}, "tag"); err != nil {
+		t.Errorf("unexpected error %v", err)
+	} else if lc.Config["fluentd-address"] != DEFAULT_FLUENTD_ADDRESS || lc.Config["fluentd-async-connect"] != "true" {
+		t.Errorf("expected the local fluentd socket, got %v", lc.Config)
+	}
+
+	if _, err := containerLogConfig(&config.Config{ContainerLogDriver: "gelf"}, "tag"); err == nil {
+		t.Errorf("expected an unsupported log driver to be rejected")
+	}
+}
+
+func Test_prefixWriter(t *testing.T) {
+	var out bytes.Buffer
+	pw := &prefixWriter{out: &out, prefix: []byte("gps | ")}
+
+	pw.Write([]byte("first line\nsecond "))
+	if out.String() != "gps | first line\n" {
+		t.Errorf("expected only the complete line to be written, got %q", out.String())
+	}
+
+	pw.Write([]byte("line\nthird"))
+	pw.Flush()
+	if out.String() != "gps | first line\ngps | second line\ngps | third\n" {
+		t.Errorf("expected every line to be prefixed, got %q", out.String())
+	}
+}
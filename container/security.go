@@ -0,0 +1,133 @@
+package container
+
+import (
+	"errors"
+	"fmt"
+	"github.com/open-horizon/anax/config"
+	"github.com/open-horizon/anax/containermessage"
+	"github.com/open-horizon/anax/persistence"
+	"io/ioutil"
+	"path"
+	"strings"
+)
+
+// The directory of the seccomp profiles that services can name in their deployment description, when it is not
+// configured.
+const DEFAULT_SECCOMP_PROFILE_DIR = "/etc/horizon/seccomp"
+
+// Check the security settings of the services of a deployment. Their form is checked by the deployment description
+// itself, see IsValidFor. The security profiles they name must also be in the allow-list that the node's config has
+// for the org of the deployment, a nil allow-list allows none.
+func validateDeploymentSecurity(deployment *containermessage.DeploymentDescription, allowed *config.SecurityAllowList) error {
+	for serviceName, service := range deployment.Services {
+		if err := validateSecurity(service, allowed); err != nil {
+			return errors.New(fmt.Sprintf("service %v: %v", serviceName, err))
+		}
+	}
+	return nil
+}
+
+func validateSecurity(service *containermessage.Service, allowed *config.SecurityAllowList) error {
+	if allowed == nil {
+		allowed = &config.SecurityAllowList{}
+	}
+
+	if err := service.ValidateSecurity(); err != nil {
+		return err
+	}
+
+	for _, opt := range service.SecurityOpt {
+		kv := strings.SplitN(opt, "=", 2)
+		switch kv[0] {
+		case "seccomp":
+			if !allowed.AllowsSeccomp(kv[1]) {
+				return errors.New(fmt.Sprintf("seccomp profile %v is not allowed", kv[1]))
+			}
+		case "apparmor":
+			if !allowed.AllowsAppArmor(kv[1]) {
+				return errors.New(fmt.Sprintf("AppArmor profile %v is not allowed", kv[1]))
+			}
+		}
+	}
+	return nil
+}
+
+// Returns true when the node refuses privileged containers. The security attribute of the node, the one that is not
+// given for specific services, applies to every deployment on the node: workloads, microservices and infrastructure
+// containers alike.
+func refusesPrivileged(db persistence.AttributeStore) (bool, error) {
+	attrs, err := db.FindApplicableAttributes("")
+	if err != nil {
+		return false, err
+	}
+	for _, attr := range attrs {
+		if len(attr.GetMeta().SensorUrls) != 0 {
+			continue
+		}
+		switch sa := attr.(type) {
+		case persistence.SecurityAttributes:
+			if sa.RefusePrivileged {
+				return true, nil
+			}
+		case *persistence.SecurityAttributes:
+			if sa.RefusePrivileged {
+				return true, nil
+			}
+		}
+	}
+	return false, nil
+}
+
+// Apply the security settings of a service to the docker configuration of its container. The form of the settings
+// has been checked by IsValidFor. When the container worker starts a deployment for an agreement, the profiles have
+// also been checked against the node's allow-list for the org of the deployment, so the profiles are only looked up
+// here. Docker takes a seccomp profile as its content rather than a file name, the profile is read from the profile
+// directory.
+func applySecurityOptions(serviceConfig *persistence.ServiceConfig, service *containermessage.Service, seccompProfileDir string) error {
+	if seccompProfileDir == "" {
+		seccompProfileDir = DEFAULT_SECCOMP_PROFILE_DIR
+	}
+
+	serviceConfig.HostConfig.CapDrop = service.CapDrop
+	serviceConfig.HostConfig.ReadonlyRootfs = service.ReadOnlyRootfs
+	serviceConfig.Config.User = service.User
+
+	if len(service.Tmpfs) != 0 {
+		serviceConfig.HostConfig.Tmpfs = make(map[string]string)
+		for p, opts := range service.Tmpfs {
+			serviceConfig.HostConfig.Tmpfs[p] = opts
+		}
+	}
+
+	opts := make([]string, 0, len(service.SecurityOpt)+1)
+	for _, opt := range service.SecurityOpt {
+		kv := strings.SplitN(opt, "=", 2)
+		if len(kv) != 2 {
+			return errors.New(fmt.Sprintf("security_opt %v must be seccomp=<profile> or apparmor=<profile>", opt))
+		}
+
+		switch kv[0] {
+		case "seccomp":
+			if kv[1] == "unconfined" {
+				opts = append(opts, opt)
+			} else if profile, err := ioutil.ReadFile(path.Join(seccompProfileDir, kv[1]+".json")); err != nil {
+				return errors.New(fmt.Sprintf("unable to read seccomp profile %v, error: %v", kv[1], err))
+			} else {
+				opts = append(opts, "seccomp="+string(profile))
+			}
+		case "apparmor":
+			opts = append(opts, opt)
+		default:
+			return errors.New(fmt.Sprintf("security_opt %v is not supported", opt))
+		}
+	}
+
+	if service.NoNewPrivileges {
+		opts = append(opts, "no-new-privileges")
+	}
+
+	if len(opts) != 0 {
+		serviceConfig.HostConfig.SecurityOpt = opts
+	}
+	return nil
+}
@@ -0,0 +1,151 @@
+// +build unit
+
+package container
+
+import (
+	"github.com/open-horizon/anax/config"
+	"github.com/open-horizon/anax/containermessage"
+	"github.com/open-horizon/anax/persistence"
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+)
+
+func Test_applySecurityOptions(t *testing.T) {
+	dir, err := ioutil.TempDir("", "seccomp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	profile := `{"defaultAction":"SCMP_ACT_ERRNO"}`
+	if err := ioutil.WriteFile(path.Join(dir, "strict.json"), []byte(profile), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	service := &containermessage.Service{
+		Image:           "gps:1.0",
+		CapDrop:         []string{"ALL"},
+		ReadOnlyRootfs:  true,
+		User:            "1000:1000",
+		SecurityOpt:     []string{"seccomp=strict", "apparmor=horizon-gps"},
+		Tmpfs:           map[string]string{"/tmp": "rw,size=64m"},
+		NoNewPrivileges: true,
+	}
+
+	sc := &persistence.ServiceConfig{}
+	if err := applySecurityOptions(sc, service, dir); err != nil {
+		t.Fatal(err)
+	} else if len(sc.HostConfig.CapDrop) != 1 || !sc.HostConfig.ReadonlyRootfs || sc.Config.User != "1000:1000" {
+		t.Errorf("expected the capabilities, root filesystem and user to be set, got %v %v", sc.HostConfig, sc.Config.User)
+	} else if sc.HostConfig.Tmpfs["/tmp"] != "rw,size=64m" {
+		t.Errorf("expected a tmpfs mount on /tmp, got %v", sc.HostConfig.Tmpfs)
+	} else if len(sc.HostConfig.SecurityOpt) != 3 || sc.HostConfig.SecurityOpt[0] != "seccomp="+profile || sc.HostConfig.SecurityOpt[1] != "apparmor=horizon-gps" || sc.HostConfig.SecurityOpt[2] != "no-new-privileges" {
+		t.Errorf("expected the profiles and no-new-privileges, got %v", sc.HostConfig.SecurityOpt)
+	}
+
+	// A profile that is not on the node cannot be applied.
+	service.SecurityOpt = []string{"seccomp=missing"}
+	if err := applySecurityOptions(&persistence.ServiceConfig{}, service, dir); err == nil {
+		t.Errorf("expected an error for a missing seccomp profile")
+	}
+}
+
+// The form of the security settings is checked by the deployment description, wherever it is used.
+func Test_IsValidFor_security(t *testing.T) {
+	invalid := []containermessage.Service{
+		{Tmpfs: map[string]string{"tmp": ""}},
+		{Tmpfs: map[string]string{"/tmp": "exec"}},
+		{Tmpfs: map[string]string{"/tmp": "rw,suid"}},
+		{Tmpfs: map[string]string{"/tmp": "size=64q"}},
+		{Tmpfs: map[string]string{"/tmp": "mode=0999"}},
+		{Tmpfs: map[string]string{"/tmp": "uid=root"}},
+		{CapDrop: []string{""}},
+		{CapDrop: []string{"NET RAW"}},
+		{SecurityOpt: []string{"seccomp=/etc/strict.json"}},
+		{SecurityOpt: []string{"label=disable"}},
+		{User: "1000:1000:1000"},
+	}
+	for _, s := range invalid {
+		desc := containermessage.DeploymentDescription{Services: map[string]*containermessage.Service{"a": &s}}
+		if desc.IsValidFor("workload") || desc.IsValidFor("infrastructure") {
+			t.Errorf("expected %v to be invalid", s)
+		}
+	}
+
+	service := containermessage.Service{
+		CapDrop:     []string{"ALL", "CAP_NET_RAW"},
+		User:        "1000:1000",
+		SecurityOpt: []string{"seccomp=unconfined", "apparmor=horizon-gps"},
+		Tmpfs:       map[string]string{"/run": "", "/tmp": "ro,noexec,nosuid,nodev,size=10%,mode=1777,uid=1000,gid=1000"},
+	}
+	desc := containermessage.DeploymentDescription{Services: map[string]*containermessage.Service{"a": &service}}
+	if !desc.IsValidFor("workload") {
+		t.Errorf("expected %v to be valid, got %v", service, desc.ValidateSecurity())
+	}
+}
+
+func Test_validateSecurity(t *testing.T) {
+	allowed := &config.SecurityAllowList{SeccompProfiles: []string{"strict"}, AppArmorProfiles: []string{"horizon-gps"}}
+
+	valid := []containermessage.Service{
+		{CapDrop: []string{"NET_RAW"}, ReadOnlyRootfs: true, NoNewPrivileges: true},
+		{SecurityOpt: []string{"seccomp=strict", "apparmor=horizon-gps"}},
+		{User: "nobody"},
+	}
+	for _, s := range valid {
+		if err := validateSecurity(&s, allowed); err != nil {
+			t.Errorf("expected %v to be valid, got %v", s, err)
+		}
+	}
+
+	invalid := []containermessage.Service{
+		{SecurityOpt: []string{"seccomp=unconfined"}},
+		{SecurityOpt: []string{"apparmor=docker-default"}},
+		{SecurityOpt: []string{"seccomp=../strict"}},
+		{SecurityOpt: []string{"label=disable"}},
+		{User: "1000:"},
+	}
+	for _, s := range invalid {
+		if err := validateSecurity(&s, allowed); err == nil {
+			t.Errorf("expected %v to be invalid", s)
+		}
+	}
+
+	// Without an allow-list no profiles can be named.
+	desc := &containermessage.DeploymentDescription{Services: map[string]*containermessage.Service{"a": {SecurityOpt: []string{"seccomp=strict"}}}}
+	if err := validateDeploymentSecurity(desc, nil); err == nil {
+		t.Errorf("expected the profile to be refused without an allow-list")
+	}
+
+	// The allow-list for all orgs applies to orgs without their own.
+	cfg := &config.Config{SecurityAllowLists: map[string]config.SecurityAllowList{"*": *allowed, "other": {}}}
+	if !cfg.SecurityAllowListFor("myorg").AllowsSeccomp("strict") || cfg.SecurityAllowListFor("other").AllowsSeccomp("strict") {
+		t.Errorf("expected the org allow-lists to be looked up by org")
+	}
+
+}
+
+func Test_refusesPrivileged(t *testing.T) {
+	desc := containermessage.DeploymentDescription{Services: map[string]*containermessage.Service{"a": {}, "b": {Privileged: true}}}
+	if !desc.RequestsPrivileged() {
+		t.Errorf("expected the deployment to request privileged mode")
+	}
+
+	// Only the security attribute of the node applies to every deployment, not the ones given for specific services.
+	db := persistence.NewMemoryDomainStore()
+	service := &persistence.SecurityAttributes{Meta: &persistence.AttributeMeta{Type: "SecurityAttributes", SensorUrls: []string{"http://ms1"}}, RefusePrivileged: true}
+	if _, err := db.SaveOrUpdateAttribute(service, "", false); err != nil {
+		t.Fatal(err)
+	} else if refuse, err := refusesPrivileged(db); err != nil || refuse {
+		t.Errorf("expected a service security attribute not to apply to the node, got %v %v", refuse, err)
+	}
+
+	node := &persistence.SecurityAttributes{Meta: &persistence.AttributeMeta{Type: "SecurityAttributes", SensorUrls: []string{}}, RefusePrivileged: true}
+	if _, err := db.SaveOrUpdateAttribute(node, "", false); err != nil {
+		t.Fatal(err)
+	} else if refuse, err := refusesPrivileged(db); err != nil || !refuse {
+		t.Errorf("expected the node to refuse privileged containers, got %v %v", refuse, err)
+	}
+}
@@ -3,9 +3,11 @@ package containermessage
 import (
 	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
 	docker "github.com/fsouza/go-dockerclient"
 	"reflect"
+	"regexp"
 	"strings"
 )
 
@@ -59,6 +61,9 @@ var invalidDeploymentOptions = map[string][]string{
 }
 
 func (d DeploymentDescription) IsValidFor(context string) bool {
+	if err := d.ValidateSecurity(); err != nil {
+		return false
+	}
 	for _, service := range d.Services {
 		for _, invalidField := range invalidDeploymentOptions[context] {
 			v := reflect.ValueOf(*service)
@@ -82,6 +87,27 @@ func (d DeploymentDescription) IsValidFor(context string) bool {
 	return true
 }
 
+// Check the form of the security settings of the services. Whether a node allows the security profiles that are
+// named depends on the node, so that is left to the node.
+func (d DeploymentDescription) ValidateSecurity() error {
+	for serviceName, service := range d.Services {
+		if err := service.ValidateSecurity(); err != nil {
+			return errors.New(fmt.Sprintf("service %v: %v", serviceName, err))
+		}
+	}
+	return nil
+}
+
+// Returns true when any of the services runs in a privileged container.
+func (d DeploymentDescription) RequestsPrivileged() bool {
+	for _, service := range d.Services {
+		if service.Privileged {
+			return true
+		}
+	}
+	return false
+}
+
 func (d DeploymentDescription) ServiceNames() []string {
 	names := []string{}
 
@@ -130,6 +156,130 @@ type Service struct {
 	NetworkIsolation *NetworkIsolation    `json:"network_isolation,omitempty"` // Changed to pointer so that the hzn dev CLI doesnt generate this struct into the deployment config skeleton
 	Binds            []string             `json:"binds,omitempty"`             // Only used by infrastructure containers
 	SpecificPorts    []docker.PortBinding `json:"specific_ports,omitempty"`    // Only used by infrastructure containers
+	HealthCheck      *HealthCheck         `json:"health_check,omitempty"`
+	CapDrop          []string             `json:"cap_drop,omitempty"`
+	ReadOnlyRootfs   bool                 `json:"read_only_rootfs,omitempty"`
+	User             string               `json:"user,omitempty"`              // The user[:group] that the container runs as
+	SecurityOpt      []string             `json:"security_opt,omitempty"`      // seccomp=<profile> or apparmor=<profile>, the profiles must be allowed for the org
+	Tmpfs            map[string]string    `json:"tmpfs,omitempty"`             // Container path to the mount options of a tmpfs mount
+	NoNewPrivileges  bool                 `json:"no_new_privileges,omitempty"` // The processes in the container cannot gain privileges, e.g. through setuid
+	SharedDevices    []string             `json:"shared_devices,omitempty"`    // Host devices in Devices that other services can be given too, the others are exclusive
+}
+
+// The tmpfs mount options that a service may set, options that loosen a tmpfs mount, e.g. exec or suid, are not
+// allowed. The options that take a value are matched against the pattern of the value.
+var tmpfsFlags = []string{"rw", "ro", "noexec", "nosuid", "nodev"}
+var tmpfsValues = map[string]*regexp.Regexp{
+	"size":      regexp.MustCompile(`^[0-9]+[kmg%]?$`),
+	"nr_inodes": regexp.MustCompile(`^[0-9]+[kmg]?$`),
+	"mode":      regexp.MustCompile(`^[0-7]{3,4}$`),
+	"uid":       regexp.MustCompile(`^[0-9]+$`),
+	"gid":       regexp.MustCompile(`^[0-9]+$`),
+}
+
+// A capability is named with or without its CAP_ prefix, ALL means all of them.
+var capabilityName = regexp.MustCompile(`^[A-Za-z_]+$`)
+
+func (s *Service) ValidateSecurity() error {
+	for _, opt := range s.SecurityOpt {
+		kv := strings.SplitN(opt, "=", 2)
+		if len(kv) != 2 || kv[1] == "" || strings.ContainsAny(kv[1], "/\\") {
+			return errors.New(fmt.Sprintf("security_opt %v must be seccomp=<profile> or apparmor=<profile>", opt))
+		} else if kv[0] != "seccomp" && kv[0] != "apparmor" {
+			return errors.New(fmt.Sprintf("security_opt %v is not supported, only seccomp and apparmor profiles can be named", opt))
+		}
+	}
+
+	for _, c := range s.CapDrop {
+		if !capabilityName.MatchString(c) {
+			return errors.New(fmt.Sprintf("cap_drop %v is not a capability name", c))
+		}
+	}
+
+	if strings.HasPrefix(s.User, ":") || strings.HasSuffix(s.User, ":") || strings.Count(s.User, ":") > 1 {
+		return errors.New(fmt.Sprintf("user %v must be user or user:group", s.User))
+	}
+
+	for mountPoint, options := range s.Tmpfs {
+		if err := validateTmpfs(mountPoint, options); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Check a tmpfs mount of a service. The mount point must be an absolute path and the options must be in the tmpfs
+// options that a service may set.
+func validateTmpfs(mountPoint string, options string) error {
+	if !strings.HasPrefix(mountPoint, "/") {
+		return errors.New(fmt.Sprintf("tmpfs mount point %v must be an absolute path", mountPoint))
+	} else if options == "" {
+		return nil
+	}
+
+	for _, opt := range strings.Split(options, ",") {
+		kv := strings.SplitN(opt, "=", 2)
+		if len(kv) == 1 {
+			supported := false
+			for _, flag := range tmpfsFlags {
+				if opt == flag {
+					supported = true
+				}
+			}
+			if !supported {
+				return errors.New(fmt.Sprintf("tmpfs option %v of mount point %v is not supported", opt, mountPoint))
+			}
+		} else if pattern, ok := tmpfsValues[kv[0]]; !ok {
+			return errors.New(fmt.Sprintf("tmpfs option %v of mount point %v is not supported", opt, mountPoint))
+		} else if !pattern.MatchString(kv[1]) {
+			return errors.New(fmt.Sprintf("tmpfs option %v of mount point %v has an invalid value", opt, mountPoint))
+		}
+	}
+	return nil
+}
+
+// A probe that docker runs inside a service container to decide whether the container is healthy. Exactly one
+// of the exec command, the HTTP port or the TCP port is set. The container is unhealthy after the probe fails
+// the given number of times in a row.
+type HealthCheck struct {
+	Exec      []string `json:"exec,omitempty"`         // Command run in the container, it succeeds when it exits with 0
+	HTTPPort  int      `json:"http_port,omitempty"`    // Container port that answers an HTTP GET with a 2xx or 3xx status
+	HTTPPath  string   `json:"http_path,omitempty"`    // Path of the HTTP GET, defaults to /
+	TCPPort   int      `json:"tcp_port,omitempty"`     // Container port that accepts TCP connections
+	IntervalS int      `json:"interval,omitempty"`     // Seconds between probes
+	TimeoutS  int      `json:"timeout,omitempty"`      // Seconds before a probe is considered failed
+	Retries   int      `json:"retries,omitempty"`      // Consecutive failures before the container is unhealthy
+	StartS    int      `json:"start_period,omitempty"` // Seconds after start during which failures are not counted
+}
+
+func (h HealthCheck) String() string {
+	return fmt.Sprintf("Exec: %v, HTTPPort: %v, HTTPPath: %v, TCPPort: %v, Interval: %v, Timeout: %v, Retries: %v, StartPeriod: %v", h.Exec, h.HTTPPort, h.HTTPPath, h.TCPPort, h.IntervalS, h.TimeoutS, h.Retries, h.StartS)
+}
+
+func (h *HealthCheck) Validate() error {
+	probes := 0
+	if len(h.Exec) != 0 {
+		probes += 1
+	}
+	if h.HTTPPort != 0 {
+		probes += 1
+	}
+	if h.TCPPort != 0 {
+		probes += 1
+	}
+
+	if probes != 1 {
+		return errors.New(fmt.Sprintf("health check must have exactly one of exec, http_port or tcp_port: %v", h))
+	} else if h.HTTPPort < 0 || h.HTTPPort > 65535 || h.TCPPort < 0 || h.TCPPort > 65535 {
+		return errors.New(fmt.Sprintf("health check port is not a valid port number: %v", h))
+	} else if h.HTTPPath != "" && h.HTTPPort == 0 {
+		return errors.New(fmt.Sprintf("health check http_path requires http_port: %v", h))
+	} else if h.HTTPPath != "" && !strings.HasPrefix(h.HTTPPath, "/") {
+		return errors.New(fmt.Sprintf("health check http_path must start with /: %v", h))
+	} else if h.IntervalS < 0 || h.TimeoutS < 0 || h.Retries < 0 || h.StartS < 0 {
+		return errors.New(fmt.Sprintf("health check interval, timeout, retries and start_period must not be negative: %v", h))
+	}
+	return nil
 }
 
 func (s *Service) AddFilesystemBinding(bind string) {
@@ -223,12 +373,14 @@ type OutboundPermitValue interface{}
 type NetworkIsolation struct {
 	OutboundPermitOnlyIgnore OutboundPermitOnlyIgnore `json:"outbound_permit_only_ignore"`
 	OutboundPermitOnly       []OutboundPermitValue    `json:"outbound_permit_only"`
+	InboundPermitOnly        []string                 `json:"inbound_permit_only,omitempty"` // The addresses and CIDRs that may reach the published ports
 }
 
 func (n *NetworkIsolation) UnmarshalJSON(data []byte) error {
 	type polyNType struct {
 		OutboundPermitOnlyIgnore OutboundPermitOnlyIgnore `json:"outbound_permit_only_ignore,omitempty"`
 		OutboundPermitOnly       []json.RawMessage        `json:"outbound_permit_only"`
+		InboundPermitOnly        []string                 `json:"inbound_permit_only,omitempty"`
 	}
 
 	var polyN polyNType
@@ -239,6 +391,7 @@ func (n *NetworkIsolation) UnmarshalJSON(data []byte) error {
 	}
 
 	n.OutboundPermitOnlyIgnore = polyN.OutboundPermitOnlyIgnore
+	n.InboundPermitOnly = polyN.InboundPermitOnly
 
 	// dumb way you have to handle polymorphic types in golang
 	for _, permit := range polyN.OutboundPermitOnly {
@@ -0,0 +1,326 @@
+package eventlog
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/golang/glog"
+	"github.com/open-horizon/anax/events"
+	"github.com/open-horizon/anax/persistence"
+	"strconv"
+	"time"
+)
+
+const EVENTLOG = "eventlog"
+
+// The number of records kept in the journal when the config does not specify a maximum.
+const DEFAULT_MAX_RECORDS = 10000
+
+// This struct is for persisting the events that flow through the message dispatcher.
+type EventRecord struct {
+	RecordId    uint64 `json:"record_id"`              // monotonically increasing, assigned when the record is written
+	Timestamp   uint64 `json:"timestamp"`              // the time the event was seen by the dispatcher, in seconds since 1970
+	EventId     string `json:"event_id"`               // the events.EventId of the message
+	MessageType string `json:"message_type"`           // the go type of the message
+	AgreementId string `json:"agreement_id,omitempty"` // the agreement the event is about, if any
+	Source      string `json:"source"`                 // the name of the worker that emitted the event
+	Description string `json:"description"`            // the ShortString of the message
+}
+
+func (e EventRecord) String() string {
+	return fmt.Sprintf("RecordId: %v, "+
+		"Timestamp: %v, "+
+		"EventId: %v, "+
+		"MessageType: %v, "+
+		"AgreementId: %v, "+
+		"Source: %v, "+
+		"Description: %v",
+		e.RecordId, e.Timestamp, e.EventId, e.MessageType, e.AgreementId, e.Source, e.Description)
+}
+
+func NewEventRecord(source string, msg events.Message) *EventRecord {
+	return &EventRecord{
+		Timestamp:   uint64(time.Now().Unix()),
+		EventId:     string(msg.Event().Id),
+		MessageType: fmt.Sprintf("%T", msg),
+		AgreementId: AgreementIdOf(msg),
+		Source:      source,
+		Description: msg.ShortString(),
+	}
+}
+
+// Returns the id of the agreement that the message is about, or the empty string if the message is not
+// about an agreement.
+func AgreementIdOf(msg events.Message) string {
+	switch msg.(type) {
+	case *events.AgreementReachedMessage:
+		m, _ := msg.(*events.AgreementReachedMessage)
+		if m.LaunchContext() != nil {
+			return m.LaunchContext().AgreementId
+		}
+	case *events.TorrentMessage:
+		m, _ := msg.(*events.TorrentMessage)
+		if lc, ok := m.LaunchContext.(*events.AgreementLaunchContext); ok && lc != nil {
+			return lc.AgreementId
+		}
+	case *events.GovernanceMaintenanceMessage:
+		m, _ := msg.(*events.GovernanceMaintenanceMessage)
+		return m.AgreementId
+	case *events.GovernanceWorkloadCancelationMessage:
+		m, _ := msg.(*events.GovernanceWorkloadCancelationMessage)
+		return m.AgreementId
+	case *events.WorkloadMessage:
+		m, _ := msg.(*events.WorkloadMessage)
+		return m.AgreementId
+	case *events.ApiAgreementCancelationMessage:
+		m, _ := msg.(*events.ApiAgreementCancelationMessage)
+		return m.AgreementId
+	case *events.ABApiAgreementCancelationMessage:
+		m, _ := msg.(*events.ABApiAgreementCancelationMessage)
+		return m.AgreementId
+	case *events.ABApiWorkloadUpgradeMessage:
+		m, _ := msg.(*events.ABApiWorkloadUpgradeMessage)
+		return m.AgreementId
+	case *events.InitAgreementCancelationMessage:
+		m, _ := msg.(*events.InitAgreementCancelationMessage)
+		return m.AgreementId
+	}
+	return ""
+}
+
+// The number of records that can wait to be written before new records are dropped.
+const JOURNAL_BUFFER_SIZE = 1000
+
+// The journal is a sink for the message dispatcher. The dispatcher must not wait on the database, so records are
+// buffered and appended to the event log bucket by a writer goroutine, in batches of the records that are waiting. When
+// a batch is written, records that are older than the retention period or beyond the maximum record count are pruned.
+type Journal struct {
+	db         persistence.Store
+	retentionS uint64
+	maxRecords uint64
+	accepts    func(source string) bool
+	records    chan *EventRecord
+	flush      chan chan bool
+}
+
+// Create a journal and start its writer. The journal only records the events from the workers that the accepts
+// function returns true for, or all events when it is nil.
+func NewJournal(db persistence.Store, retentionHours int, maxRecords int, accepts func(source string) bool) *Journal {
+	if maxRecords <= 0 {
+		maxRecords = DEFAULT_MAX_RECORDS
+	}
+	j := &Journal{
+		db:         db,
+		retentionS: uint64(retentionHours) * 3600,
+		maxRecords: uint64(maxRecords),
+		accepts:    accepts,
+		records:    make(chan *EventRecord, JOURNAL_BUFFER_SIZE),
+		flush:      make(chan chan bool),
+	}
+	go j.writer()
+	return j
+}
+
+func (j *Journal) Record(source string, msg events.Message) {
+	if j.accepts != nil && !j.accepts(source) {
+		return
+	}
+
+	select {
+	case j.records <- NewEventRecord(source, msg):
+	default:
+		glog.Warningf("Event journal is full, dropping event %v from %v", msg.ShortString(), source)
+	}
+}
+
+// Wait until the records given to the journal so far have been written.
+func (j *Journal) Flush() {
+	done := make(chan bool)
+	j.flush <- done
+	<-done
+}
+
+func (j *Journal) writer() {
+	for {
+		select {
+		case record := <-j.records:
+			j.write(append([]*EventRecord{record}, j.pending()...))
+		case done := <-j.flush:
+			j.write(j.pending())
+			done <- true
+		}
+	}
+}
+
+// Take the records that are waiting to be written, without blocking.
+func (j *Journal) pending() []*EventRecord {
+	batch := make([]*EventRecord, 0)
+	for {
+		select {
+		case record := <-j.records:
+			batch = append(batch, record)
+		default:
+			return batch
+		}
+	}
+}
+
+func (j *Journal) write(batch []*EventRecord) {
+	if len(batch) == 0 {
+		return
+	} else if err := PersistEventRecords(j.db, batch, j.retentionS, j.maxRecords); err != nil {
+		glog.Errorf("Unable to journal %v events, error: %v", len(batch), err)
+	}
+}
+
+// Append a record to the event log, see PersistEventRecords.
+func PersistEventRecord(db persistence.Store, record *EventRecord, retentionS uint64, maxRecords uint64) error {
+	return PersistEventRecords(db, []*EventRecord{record}, retentionS, maxRecords)
+}
+
+// Append records to the event log. In the same transaction, remove records that were written more than retentionS
+// seconds before the newest record, and the oldest records if there are more than maxRecords.
+func PersistEventRecords(db persistence.Store, records []*EventRecord, retentionS uint64, maxRecords uint64) error {
+	if len(records) == 0 {
+		return nil
+	}
+	return db.Update(func(tx persistence.Tx) error {
+
+		b, err := tx.CreateBucketIfNotExists([]byte(EVENTLOG))
+		if err != nil {
+			return err
+		}
+
+		var seq uint64
+		for _, record := range records {
+			if seq, err = b.NextSequence(); err != nil {
+				return err
+			}
+			record.RecordId = seq
+
+			if serial, err := json.Marshal(record); err != nil {
+				return errors.New(fmt.Sprintf("Unable to serialize event record %v, error: %v", record, err))
+			} else if err := b.Put(recordKey(seq), serial); err != nil {
+				return errors.New(fmt.Sprintf("Unable to write event record %v, error: %v", record.RecordId, err))
+			}
+		}
+		newest := records[len(records)-1].Timestamp
+
+		// Records are keyed by sequence number, so they are visited oldest first. The visit stops at the
+		// first record that is kept, records cannot be deleted until the visit is over.
+		expired := make([][]byte, 0, 1)
+		b.ForEach(func(k, v []byte) error {
+			var old EventRecord
+			if err := json.Unmarshal(v, &old); err != nil {
+				glog.Errorf("Unable to deserialize event record %v, removing it", v)
+			} else if old.RecordId+maxRecords > seq && (retentionS == 0 || old.Timestamp+retentionS >= newest) {
+				return errKeepRecord
+			}
+			expired = append(expired, k)
+			return nil
+		})
+
+		for _, k := range expired {
+			if err := b.Delete(k); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// Stops the visit of the event records when the oldest record that is kept is found.
+var errKeepRecord = errors.New("keep record")
+
+func recordKey(seq uint64) []byte {
+	k := make([]byte, 8)
+	binary.BigEndian.PutUint64(k, seq)
+	return k
+}
+
+// Filters used to select event records.
+type EFilter func(EventRecord) bool
+
+func EventIdEFilter(id string) EFilter {
+	return func(e EventRecord) bool { return e.EventId == id }
+}
+
+func AgreementIdEFilter(id string) EFilter {
+	return func(e EventRecord) bool { return e.AgreementId == id }
+}
+
+func SinceEFilter(since uint64) EFilter {
+	return func(e EventRecord) bool { return e.Timestamp >= since }
+}
+
+func UntilEFilter(until uint64) EFilter {
+	return func(e EventRecord) bool { return e.Timestamp <= until }
+}
+
+// Return the event records that pass all the filters, oldest first.
+func FindEventRecords(db persistence.Store, filters []EFilter) ([]EventRecord, error) {
+	records := make([]EventRecord, 0)
+
+	readErr := db.View(func(tx persistence.Tx) error {
+
+		if b := tx.Bucket([]byte(EVENTLOG)); b != nil {
+			b.ForEach(func(k, v []byte) error {
+
+				var e EventRecord
+
+				if err := json.Unmarshal(v, &e); err != nil {
+					glog.Errorf("Unable to deserialize event record: %v", v)
+				} else {
+					exclude := false
+					for _, filterFn := range filters {
+						if !filterFn(e) {
+							exclude = true
+						}
+					}
+					if !exclude {
+						records = append(records, e)
+					}
+				}
+				return nil
+			})
+		}
+
+		return nil // end the transaction
+	})
+
+	if readErr != nil {
+		return nil, readErr
+	} else {
+		return records, nil
+	}
+}
+
+// Convert the query parameters of the event log APIs into filters. When one of the parameters is invalid,
+// the name of the parameter is returned along with the error.
+func QueryFilters(eventId string, agreementId string, since string, until string) ([]EFilter, string, error) {
+	filters := make([]EFilter, 0, 4)
+
+	if eventId != "" {
+		filters = append(filters, EventIdEFilter(eventId))
+	}
+	if agreementId != "" {
+		filters = append(filters, AgreementIdEFilter(agreementId))
+	}
+	if since != "" {
+		if s, err := strconv.ParseUint(since, 10, 64); err != nil {
+			return nil, "since", errors.New(fmt.Sprintf("since %v must be a number of seconds since 1970, error: %v", since, err))
+		} else {
+			filters = append(filters, SinceEFilter(s))
+		}
+	}
+	if until != "" {
+		if u, err := strconv.ParseUint(until, 10, 64); err != nil {
+			return nil, "until", errors.New(fmt.Sprintf("until %v must be a number of seconds since 1970, error: %v", until, err))
+		} else {
+			filters = append(filters, UntilEFilter(u))
+		}
+	}
+
+	return filters, "", nil
+}
@@ -0,0 +1,157 @@
+// +build unit
+
+package eventlog
+
+import (
+	"github.com/open-horizon/anax/events"
+	"github.com/open-horizon/anax/persistence"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+)
+
+func Test_Journal_Record(t *testing.T) {
+	dir, db, err := setupDB()
+	if err != nil {
+		t.Error(err)
+	}
+	defer cleanupDB(dir)
+
+	j := NewJournal(db, 1, 0, nil)
+	j.Record("Governance", events.NewGovernanceMaintenanceMessage(events.CONTAINER_MAINTAIN, "Basic", "ag1", nil))
+	j.Record("Agreement", events.NewABApiAgreementCancelationMessage(events.AGREEMENT_ENDED, "Basic", "ag2"))
+	j.Record("Container", events.NewContainerStopMessage(events.CONTAINER_STOPPING, "c1", "myorg"))
+	j.Flush()
+
+	records, err := FindEventRecords(db, []EFilter{})
+	assert.Nil(t, err)
+	assert.Equal(t, 3, len(records))
+	assert.Equal(t, uint64(1), records[0].RecordId)
+	assert.Equal(t, "ag1", records[0].AgreementId)
+	assert.Equal(t, "Governance", records[0].Source)
+	assert.Equal(t, string(events.CONTAINER_MAINTAIN), records[0].EventId)
+	assert.Equal(t, "", records[2].AgreementId)
+
+	records, err = FindEventRecords(db, []EFilter{AgreementIdEFilter("ag2")})
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(records))
+	assert.Equal(t, string(events.AGREEMENT_ENDED), records[0].EventId)
+
+	records, err = FindEventRecords(db, []EFilter{EventIdEFilter(string(events.CONTAINER_STOPPING))})
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(records))
+	assert.Equal(t, "Container", records[0].Source)
+}
+
+func Test_Journal_MaxRecords(t *testing.T) {
+	dir, db, err := setupDB()
+	if err != nil {
+		t.Error(err)
+	}
+	defer cleanupDB(dir)
+
+	j := NewJournal(db, 1, 3, nil)
+	for i := 0; i < 5; i++ {
+		j.Record("Container", events.NewContainerStopMessage(events.CONTAINER_STOPPING, "c1", "myorg"))
+	}
+	j.Flush()
+
+	records, err := FindEventRecords(db, []EFilter{})
+	assert.Nil(t, err)
+	assert.Equal(t, 3, len(records))
+	assert.Equal(t, uint64(3), records[0].RecordId)
+	assert.Equal(t, uint64(5), records[2].RecordId)
+}
+
+func Test_Journal_Retention(t *testing.T) {
+	dir, db, err := setupDB()
+	if err != nil {
+		t.Error(err)
+	}
+	defer cleanupDB(dir)
+
+	now := uint64(time.Now().Unix())
+	old := &EventRecord{Timestamp: now - 7200, EventId: string(events.AGREEMENT_ENDED)}
+	assert.Nil(t, PersistEventRecord(db, old, 0, DEFAULT_MAX_RECORDS))
+
+	// A record older than the retention period is pruned when the next record is written.
+	newer := &EventRecord{Timestamp: now, EventId: string(events.AGREEMENT_REACHED)}
+	assert.Nil(t, PersistEventRecord(db, newer, 3600, DEFAULT_MAX_RECORDS))
+
+	records, err := FindEventRecords(db, []EFilter{})
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(records))
+	assert.Equal(t, string(events.AGREEMENT_REACHED), records[0].EventId)
+}
+
+func Test_Journal_Sources(t *testing.T) {
+	dir, db, err := setupDB()
+	if err != nil {
+		t.Error(err)
+	}
+	defer cleanupDB(dir)
+
+	j := NewJournal(db, 1, 0, func(source string) bool { return source == "AgBot" })
+	j.Record("Container", events.NewContainerStopMessage(events.CONTAINER_STOPPING, "c1", "myorg"))
+	j.Record("AgBot", events.NewABApiAgreementCancelationMessage(events.AGREEMENT_ENDED, "Basic", "ag2"))
+	j.Flush()
+
+	records, err := FindEventRecords(db, []EFilter{})
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(records))
+	assert.Equal(t, "AgBot", records[0].Source)
+}
+
+func Test_Journal_Batch(t *testing.T) {
+	dir, db, err := setupDB()
+	if err != nil {
+		t.Error(err)
+	}
+	defer cleanupDB(dir)
+
+	// A batch is pruned against the last record in it.
+	now := uint64(time.Now().Unix())
+	batch := []*EventRecord{{Timestamp: now - 7200}, {Timestamp: now - 60}, {Timestamp: now}}
+	assert.Nil(t, PersistEventRecords(db, batch, 3600, 2))
+
+	records, err := FindEventRecords(db, []EFilter{})
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(records))
+	assert.Equal(t, uint64(2), records[0].RecordId)
+}
+
+func Test_QueryFilters(t *testing.T) {
+	if filters, _, err := QueryFilters("AGREEMENT_ENDED", "ag1", "100", "200"); err != nil {
+		t.Errorf("unexpected error %v", err)
+	} else if len(filters) != 4 {
+		t.Errorf("expected 4 filters, got %v", len(filters))
+	} else {
+		r := EventRecord{Timestamp: 150, EventId: "AGREEMENT_ENDED", AgreementId: "ag1"}
+		for _, f := range filters {
+			assert.True(t, f(r))
+		}
+		r.Timestamp = 250
+		assert.False(t, filters[3](r))
+	}
+
+	if _, input, err := QueryFilters("", "", "yesterday", ""); err == nil {
+		t.Errorf("expected an error for an invalid since parameter")
+	} else {
+		assert.Equal(t, "since", input)
+	}
+}
+
+func setupDB() (string, persistence.Store, error) {
+	dir, err := ioutil.TempDir("", "eventlog-")
+	if err != nil {
+		return "", nil, err
+	}
+
+	return dir, persistence.NewMemoryStore(), nil
+}
+
+func cleanupDB(dir string) error {
+	return os.RemoveAll(dir)
+}
@@ -55,6 +55,9 @@ const (
 	CANCEL_MICROSERVICE EventId = "CANCEL_MICROSERVICE"
 	NEW_BC_CLIENT       EventId = "NEW_BC_CONTAINER"
 	IMAGE_LOAD_FAILED   EventId = "IMAGE_LOAD_FAILED"
+	CONTAINER_UNHEALTHY EventId = "CONTAINER_UNHEALTHY"
+	CONTAINER_HEALTHY   EventId = "CONTAINER_HEALTHY"
+	CONTAINER_RESTART   EventId = "CONTAINER_RESTART"
 
 	// policy-related
 	NEW_POLICY     EventId = "NEW_POLICY"
@@ -71,6 +74,7 @@ const (
 	DEVICE_AGREEMENTS_SYNCED EventId = "DEVICE_AGREEMENTS_SYNCED"
 	DEVICE_CONTAINERS_SYNCED EventId = "DEVICE_CONTAINERS_SYNCED"
 	WORKLOAD_UPGRADE         EventId = "WORKLOAD_UPGRADE"
+	AGBOT_AGREEMENT_ENDED    EventId = "AGBOT_AGREEMENT_ENDED"
 
 	// Node related
 	START_UNCONFIGURE    EventId = "UNCONFIGURE_NODE"
@@ -107,12 +111,13 @@ type AgreementLaunchContext struct {
 	AgreementId          string
 	Configure            ContainerConfig
 	ConfigureRaw         []byte
-	EnvironmentAdditions *map[string]string // provided by platform, not but user
-	Microservices        []MicroserviceSpec // for ms split.
+	EnvironmentAdditions *map[string]string          // provided by platform, not but user
+	Microservices        []MicroserviceSpec          // for ms split.
+	ResourceLimits       *persistence.ResourceLimits // from the terms and conditions, nil when there are no limits
 }
 
 func (c AgreementLaunchContext) String() string {
-	return fmt.Sprintf("AgreementProtocol: %v, AgreementId: %v, Configure: %v, EnvironmentAdditions: %v, Microservices: %v", c.AgreementProtocol, c.AgreementId, c.Configure, c.EnvironmentAdditions, c.Microservices)
+	return fmt.Sprintf("AgreementProtocol: %v, AgreementId: %v, Configure: %v, EnvironmentAdditions: %v, Microservices: %v, ResourceLimits: %v", c.AgreementProtocol, c.AgreementId, c.Configure, c.EnvironmentAdditions, c.Microservices, c.ResourceLimits)
 }
 
 func (c AgreementLaunchContext) ShortString() string {
@@ -124,16 +129,18 @@ func (c AgreementLaunchContext) ContainerConfig() ContainerConfig {
 }
 
 type ContainerConfig struct {
-	TorrentURL          url.URL `json:"torrent_url"`
-	TorrentSignature    string  `json:"torrent_signature"`
-	Deployment          string  `json:"deployment"` // JSON docker-compose like
-	DeploymentSignature string  `json:"deployment_signature"`
-	DeploymentUserInfo  string  `json:"deployment_user_info"`
-	Overrides           string  `json:"overrides"`
+	TorrentURL          url.URL                    `json:"torrent_url"`
+	TorrentSignature    string                     `json:"torrent_signature"`
+	Deployment          string                     `json:"deployment"` // JSON docker-compose like
+	DeploymentSignature string                     `json:"deployment_signature"`
+	DeploymentUserInfo  string                     `json:"deployment_user_info"`
+	Overrides           string                     `json:"overrides"`
+	Org                 string                     `json:"org"`                      // The org of the workload or microservice, it decides whether images must be referenced by digest
+	HardwareMatch       *persistence.HardwareMatch `json:"hardware_match,omitempty"` // The host devices that a microservice can be given
 }
 
 func (c ContainerConfig) String() string {
-	return fmt.Sprintf("TorrentURL: %v, TorrentSignature: %v, Deployment: %v, DeploymentSignature: %v, DeploymentUserInfo: %v, Overrides: %v", c.TorrentURL.String(), c.TorrentSignature, c.Deployment, c.DeploymentSignature, c.DeploymentUserInfo, c.Overrides)
+	return fmt.Sprintf("TorrentURL: %v, TorrentSignature: %v, Deployment: %v, DeploymentSignature: %v, DeploymentUserInfo: %v, Overrides: %v, Org: %v, HardwareMatch: %v", c.TorrentURL.String(), c.TorrentSignature, c.Deployment, c.DeploymentSignature, c.DeploymentUserInfo, c.Overrides, c.Org, c.HardwareMatch)
 }
 
 func NewContainerConfig(torrentURL url.URL, torrentSignature string, deployment string, deploymentSignature string, deploymentUserInfo string, overrides string) *ContainerConfig {
@@ -579,6 +586,40 @@ func NewWorkloadMessage(id EventId, protocol string, agreementId string, deploym
 	}
 }
 
+// Container health messages, about the services of an agreement whose containers are unhealthy or have recovered
+type ContainerHealthMessage struct {
+	event             Event
+	AgreementProtocol string
+	AgreementId       string
+	Deployment        map[string]persistence.ServiceConfig
+	ServiceNames      []string
+}
+
+func (m ContainerHealthMessage) String() string {
+	return fmt.Sprintf("event: %v, AgreementProtocol: %v, AgreementId: %v, Deployment: %v, ServiceNames: %v", m.event.Id, m.AgreementProtocol, m.AgreementId, persistence.ServiceConfigNames(&m.Deployment), m.ServiceNames)
+}
+
+func (m ContainerHealthMessage) ShortString() string {
+	return m.String()
+}
+
+func (m ContainerHealthMessage) Event() Event {
+	return m.event
+}
+
+func NewContainerHealthMessage(id EventId, protocol string, agreementId string, deployment map[string]persistence.ServiceConfig, serviceNames []string) *ContainerHealthMessage {
+
+	return &ContainerHealthMessage{
+		event: Event{
+			Id: id,
+		},
+		AgreementProtocol: protocol,
+		AgreementId:       agreementId,
+		Deployment:        deployment,
+		ServiceNames:      serviceNames,
+	}
+}
+
 //Container messages
 type ContainerMessage struct {
 	event         Event
@@ -733,6 +774,38 @@ func NewABApiAgreementCancelationMessage(id EventId, protocol string, agreementI
 	}
 }
 
+// This message is sent by the agbot's agreement workers when an agreement has ended and its node is free for a new
+// agreement with the policy.
+type AgbotAgreementEndedMessage struct {
+	event       Event
+	AgreementId string
+	Org         string
+	PolicyName  string
+}
+
+func (m *AgbotAgreementEndedMessage) Event() Event {
+	return m.event
+}
+
+func (m AgbotAgreementEndedMessage) String() string {
+	return fmt.Sprintf("Event: %v, AgreementId: %v, Org: %v, PolicyName: %v", m.event, m.AgreementId, m.Org, m.PolicyName)
+}
+
+func (m AgbotAgreementEndedMessage) ShortString() string {
+	return m.String()
+}
+
+func NewAgbotAgreementEndedMessage(id EventId, agreementId string, org string, policyName string) *AgbotAgreementEndedMessage {
+	return &AgbotAgreementEndedMessage{
+		event: Event{
+			Id: id,
+		},
+		AgreementId: agreementId,
+		Org:         org,
+		PolicyName:  policyName,
+	}
+}
+
 type ABApiWorkloadUpgradeMessage struct {
 	event             Event
 	AgreementProtocol string
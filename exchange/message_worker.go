@@ -4,7 +4,6 @@ import (
 	"bytes"
 	"encoding/json"
 	"fmt"
-	"github.com/boltdb/bolt"
 	"github.com/golang/glog"
 	"github.com/open-horizon/anax/config"
 	"github.com/open-horizon/anax/events"
@@ -16,14 +15,14 @@ import (
 
 type ExchangeMessageWorker struct {
 	worker.BaseWorker // embedded field
-	db                *bolt.DB
+	db                persistence.Store
 	httpClient        *http.Client
 	id                string // device id
 	token             string // device token
 	pattern           string // device pattern
 }
 
-func NewExchangeMessageWorker(name string, cfg *config.HorizonConfig, db *bolt.DB) *ExchangeMessageWorker {
+func NewExchangeMessageWorker(name string, cfg *config.HorizonConfig, db persistence.Store) *ExchangeMessageWorker {
 
 	id := ""
 	token := ""
@@ -9,6 +9,7 @@ import (
 	"fmt"
 	"github.com/golang/glog"
 	"github.com/open-horizon/anax/config"
+	"github.com/open-horizon/anax/metrics"
 	"github.com/open-horizon/anax/policy"
 	"io/ioutil"
 	"net/http"
@@ -78,10 +79,12 @@ type SearchExchangeMSRequest struct {
 	PropertiesToReturn   []string       `json:"propertiesToReturn"`
 	StartIndex           int            `json:"startIndex"`
 	NumEntries           int            `json:"numEntries"`
+	ChangedSince         string         `json:"changedSince,omitempty"` // Only nodes that registered or heartbeated again after being stale since this time
+	StartAfterId         string         `json:"startAfterId,omitempty"` // Only nodes whose id sorts after this id, the nodes are returned in id order
 }
 
 func (a SearchExchangeMSRequest) String() string {
-	return fmt.Sprintf("Microservices: %v, SecondsStale: %v, PropertiesToReturn: %v, StartIndex: %v, NumEntries: %v", a.DesiredMicroservices, a.SecondsStale, a.PropertiesToReturn, a.StartIndex, a.NumEntries)
+	return fmt.Sprintf("Microservices: %v, SecondsStale: %v, PropertiesToReturn: %v, StartIndex: %v, NumEntries: %v, ChangedSince: %v, StartAfterId: %v", a.DesiredMicroservices, a.SecondsStale, a.PropertiesToReturn, a.StartIndex, a.NumEntries, a.ChangedSince, a.StartAfterId)
 }
 
 type SearchResultDevice struct {
@@ -119,10 +122,12 @@ type SearchExchangePatternRequest struct {
 	SecondsStale int    `json:"secondsStale"`
 	StartIndex   int    `json:"startIndex"`
 	NumEntries   int    `json:"numEntries"`
+	ChangedSince string `json:"changedSince,omitempty"` // Only nodes that registered or heartbeated again after being stale since this time
+	StartAfterId string `json:"startAfterId,omitempty"` // Only nodes whose id sorts after this id, the nodes are returned in id order
 }
 
 func (a SearchExchangePatternRequest) String() string {
-	return fmt.Sprintf("WorkloadURL: %v, SecondsStale: %v, StartIndex: %v, NumEntries: %v", a.WorkloadURL, a.SecondsStale, a.StartIndex, a.NumEntries)
+	return fmt.Sprintf("WorkloadURL: %v, SecondsStale: %v, StartIndex: %v, NumEntries: %v, ChangedSince: %v, StartAfterId: %v", a.WorkloadURL, a.SecondsStale, a.StartIndex, a.NumEntries, a.ChangedSince, a.StartAfterId)
 }
 
 type SearchExchangePatternResponse struct {
@@ -597,7 +602,7 @@ func ConvertPropertyToExchangeFormat(prop *policy.Property) (*MSProp, error) {
 	var pType, pValue, pCompare string
 
 	// version is a special property, it has a special type.
-	if prop.Name == "version" {
+	if prop.Name == "version" || prop.Type == policy.PROPERTY_TYPE_VERSION {
 		newProp := &MSProp{
 			Name:     prop.Name,
 			Value:    prop.Value.(string),
@@ -607,6 +612,23 @@ func ConvertPropertyToExchangeFormat(prop *policy.Property) (*MSProp, error) {
 		return newProp, nil
 	}
 
+	// The exchange does not know about units, so quantities are searched on as integers in their base unit.
+	if prop.Type == policy.PROPERTY_TYPE_QUANTITY {
+		if qString, ok := prop.Value.(string); !ok {
+			return nil, errors.New(fmt.Sprintf("Quantity property %v has value %v that is not a string.", prop.Name, prop.Value))
+		} else if base, _, err := policy.ParseQuantity(qString); err != nil {
+			return nil, err
+		} else {
+			newProp := &MSProp{
+				Name:     prop.Name,
+				Value:    strconv.FormatInt(int64(base), 10),
+				PropType: "int",
+				Op:       ">=",
+			}
+			return newProp, nil
+		}
+	}
+
 	switch prop.Value.(type) {
 	case string:
 		pType = "string"
@@ -624,6 +646,14 @@ func ConvertPropertyToExchangeFormat(prop *policy.Property) (*MSProp, error) {
 		pType = "list"
 		pValue = ConvertToString(prop.Value.([]string))
 		pCompare = "in"
+	case []interface{}:
+		if list, ok := policy.ConvertToStringList(prop.Value); !ok {
+			return nil, errors.New(fmt.Sprintf("Encountered list property %v with an element that is not a string converting to exchange format.", prop.Name))
+		} else {
+			pType = "list"
+			pValue = ConvertToString(list)
+			pCompare = "in"
+		}
 	case float64:
 		pType = "int"
 		pValue = strconv.Itoa(int(prop.Value.(float64)))
@@ -1339,9 +1369,27 @@ func GetNodeHealthStatus(httpClientFactory *config.HTTPClientFactory, pattern st
 
 }
 
+// Metrics about the calls made to the exchange.
+var exchangeRequestDuration = metrics.NewSummaryVec("anax_exchange_request_duration_seconds", "The time taken by exchange API invocations, by HTTP method.", "method")
+var exchangeRequestErrors = metrics.NewCounterVec("anax_exchange_request_errors_total", "The number of failed exchange API invocations, by HTTP method and kind of error (transport or invocation).", "method", "kind")
+
 // This function is used to invoke an exchange API
 func InvokeExchange(httpClient *http.Client, method string, url string, user string, pw string, params interface{}, resp *interface{}) (error, error) {
 
+	start := time.Now()
+	err, tpErr := invokeExchange(httpClient, method, url, user, pw, params, resp)
+	exchangeRequestDuration.Observe(time.Since(start).Seconds(), method)
+
+	if tpErr != nil {
+		exchangeRequestErrors.Inc(method, "transport")
+	} else if err != nil {
+		exchangeRequestErrors.Inc(method, "invocation")
+	}
+	return err, tpErr
+}
+
+func invokeExchange(httpClient *http.Client, method string, url string, user string, pw string, params interface{}, resp *interface{}) (error, error) {
+
 	if len(method) == 0 {
 		return errors.New(fmt.Sprintf("Error invoking exchange, method name must be specified")), nil
 	} else if len(url) == 0 {
@@ -5,6 +5,7 @@ package exchange
 import (
 	"encoding/json"
 	"fmt"
+	"github.com/open-horizon/anax/policy"
 	"testing"
 )
 
@@ -284,6 +285,29 @@ func Test_IsTraportError(t *testing.T) {
 
 }
 
+func Test_ConvertPropertyToExchangeFormat(t *testing.T) {
+	quantity := policy.Property{Name: "memory", Value: "2KiB", Type: policy.PROPERTY_TYPE_QUANTITY}
+	if p, err := ConvertPropertyToExchangeFormat(&quantity); err != nil {
+		t.Errorf("Error: unexpected error %v", err)
+	} else if p.PropType != "int" || p.Value != "2048" || p.Op != ">=" {
+		t.Errorf("Error: expected the quantity in bytes, got %v", p)
+	}
+
+	firmware := policy.Property{Name: "firmware", Value: "1.2.3", Type: policy.PROPERTY_TYPE_VERSION}
+	if p, err := ConvertPropertyToExchangeFormat(&firmware); err != nil {
+		t.Errorf("Error: unexpected error %v", err)
+	} else if p.PropType != "version" || p.Value != "1.2.3" {
+		t.Errorf("Error: expected a version property, got %v", p)
+	}
+
+	tags := policy.Property{Name: "tags", Value: []interface{}{"a", "b"}}
+	if p, err := ConvertPropertyToExchangeFormat(&tags); err != nil {
+		t.Errorf("Error: unexpected error %v", err)
+	} else if p.PropType != "list" || p.Value != "a,b" {
+		t.Errorf("Error: expected a list property, got %v", p)
+	}
+}
+
 // Create a Pattern object from a JSON serialization. The JSON serialization
 // does not have to be a valid pattern serialization, just has to be a valid
 // JSON serialization.
@@ -55,6 +55,46 @@ func (w *GovernanceWorker) NewCleanupExecutionCommand(protocol string, agreement
 	}
 }
 
+// ==============================================================================================================
+type UnhealthyContainerCommand struct {
+	AgreementProtocol string
+	AgreementId       string
+	Deployment        map[string]persistence.ServiceConfig
+	ServiceNames      []string
+}
+
+func (c UnhealthyContainerCommand) ShortString() string {
+
+	return fmt.Sprintf("UnhealthyContainerCommand: AgreementId %v, AgreementProtocol %v, Unhealthy Services %v", c.AgreementId, c.AgreementProtocol, c.ServiceNames)
+}
+
+func (w *GovernanceWorker) NewUnhealthyContainerCommand(protocol string, agreementId string, deployment map[string]persistence.ServiceConfig, serviceNames []string) *UnhealthyContainerCommand {
+	return &UnhealthyContainerCommand{
+		AgreementProtocol: protocol,
+		AgreementId:       agreementId,
+		Deployment:        deployment,
+		ServiceNames:      serviceNames,
+	}
+}
+
+// ==============================================================================================================
+type HealthyContainerCommand struct {
+	AgreementProtocol string
+	AgreementId       string
+}
+
+func (c HealthyContainerCommand) ShortString() string {
+
+	return fmt.Sprintf("HealthyContainerCommand: AgreementId %v, AgreementProtocol %v", c.AgreementId, c.AgreementProtocol)
+}
+
+func (w *GovernanceWorker) NewHealthyContainerCommand(protocol string, agreementId string) *HealthyContainerCommand {
+	return &HealthyContainerCommand{
+		AgreementProtocol: protocol,
+		AgreementId:       agreementId,
+	}
+}
+
 // ==============================================================================================================
 type CleanupStatusCommand struct {
 	AgreementProtocol string
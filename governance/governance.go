@@ -4,7 +4,6 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
-	"github.com/boltdb/bolt"
 	"github.com/golang/glog"
 	"github.com/open-horizon/anax/abstractprotocol"
 	"github.com/open-horizon/anax/config"
@@ -29,13 +28,16 @@ import (
 // the max time we'll let a contract remain unconfigured by the provider
 const MAX_CONTRACT_UNCONFIGURED_TIME_M = 20
 
-const MAX_CONTRACT_PRELAUNCH_TIME_M = 10
+const MAX_CONTRACT_PRELAUNCH_TIME_M = config.MAX_CONTRACT_PRELAUNCH_TIME_M
 
 const MAX_MICROPAYMENT_UNPAID_RUN_DURATION_M = 60
 
 // enforced only after the workloads are running
 const MAX_AGREEMENT_ACCEPTANCE_WAIT_TIME_M = 20
 
+// the number of times the unhealthy services of an agreement are restarted before the agreement is cancelled
+const MAX_UNHEALTHY_RESTARTS = 1
+
 // related to agreement cleanup status
 const STATUS_WORKLOAD_DESTROYED = 500
 const STATUS_AG_PROTOCOL_TERMINATED = 501
@@ -47,7 +49,8 @@ const BC_GOVERNOR = "BlockchainGovernor"
 
 type GovernanceWorker struct {
 	worker.BaseWorker // embedded field
-	db                *bolt.DB
+	db                persistence.Store
+	store             persistence.DomainStore
 	bc                *ethblockchain.BaseContracts
 	deviceId          string
 	deviceToken       string
@@ -57,9 +60,10 @@ type GovernanceWorker struct {
 	deviceStatus      *DeviceStatus
 	ShuttingDownCmd   *NodeShutdownCommand
 	exchHandlers      *exchange.ExchangeApiHandlers
+	unhealthyRestarts map[string]int // the number of times unhealthy services were restarted, keyed by agreement id
 }
 
-func NewGovernanceWorker(name string, cfg *config.HorizonConfig, db *bolt.DB, pm *policy.PolicyManager) *GovernanceWorker {
+func NewGovernanceWorker(name string, cfg *config.HorizonConfig, db persistence.Store, pm *policy.PolicyManager) *GovernanceWorker {
 
 	id := ""
 	token := ""
@@ -71,16 +75,18 @@ func NewGovernanceWorker(name string, cfg *config.HorizonConfig, db *bolt.DB, pm
 	}
 
 	worker := &GovernanceWorker{
-		BaseWorker:      worker.NewBaseWorker(name, cfg),
-		db:              db,
-		pm:              pm,
-		deviceId:        id,
-		deviceToken:     token,
-		devicePattern:   pattern,
-		producerPH:      make(map[string]producer.ProducerProtocolHandler),
-		deviceStatus:    NewDeviceStatus(),
-		ShuttingDownCmd: nil,
-		exchHandlers:    exchange.NewExchangeApiHandlers(cfg),
+		BaseWorker:        worker.NewBaseWorker(name, cfg),
+		db:                db,
+		store:             persistence.NewBoltDomainStore(db),
+		pm:                pm,
+		deviceId:          id,
+		deviceToken:       token,
+		devicePattern:     pattern,
+		producerPH:        make(map[string]producer.ProducerProtocolHandler),
+		deviceStatus:      NewDeviceStatus(),
+		ShuttingDownCmd:   nil,
+		exchHandlers:      exchange.NewExchangeApiHandlers(cfg),
+		unhealthyRestarts: make(map[string]int),
 	}
 
 	worker.Start(worker, 10)
@@ -123,6 +129,18 @@ func (w *GovernanceWorker) NewEvent(incoming events.Message) {
 		cmd := w.NewReportDeviceStatusCommand()
 		w.Commands <- cmd
 
+	case *events.ContainerHealthMessage:
+		msg, _ := incoming.(*events.ContainerHealthMessage)
+
+		switch msg.Event().Id {
+		case events.CONTAINER_UNHEALTHY:
+			cmd := w.NewUnhealthyContainerCommand(msg.AgreementProtocol, msg.AgreementId, msg.Deployment, msg.ServiceNames)
+			w.Commands <- cmd
+		case events.CONTAINER_HEALTHY:
+			cmd := w.NewHealthyContainerCommand(msg.AgreementProtocol, msg.AgreementId)
+			w.Commands <- cmd
+		}
+
 	case *events.TorrentMessage:
 		msg, _ := incoming.(*events.TorrentMessage)
 
@@ -275,6 +293,22 @@ func (w *GovernanceWorker) governAgreements() {
 		for _, ag := range establishedAgreements {
 			bcType, bcName, bcOrg := w.producerPH[ag.AgreementProtocol].GetKnownBlockchain(&ag)
 			protocolHandler := w.producerPH[ag.AgreementProtocol].AgreementProtocolHandler(bcType, bcName, bcOrg)
+
+			// Cancel the agreement if the availability schedule in its terms and conditions has closed. New proposals are
+			// rejected until the schedule opens again, at which time the agbot will make a new agreement.
+			if closed, err := w.availabilityClosed(&ag, protocolHandler); err != nil {
+				glog.Errorf(logString(err.Error()))
+			} else if closed {
+				glog.Infof(logString(fmt.Sprintf("terminating agreement %v because its policy availability window has closed.", ag.CurrentAgreementId)))
+				reason := w.producerPH[ag.AgreementProtocol].GetTerminationCode(producer.TERM_REASON_AVAILABILITY_CLOSED)
+				w.cancelAgreement(ag.CurrentAgreementId, ag.AgreementProtocol, reason, w.producerPH[ag.AgreementProtocol].GetTerminationReason(reason))
+				// cleanup workloads
+				w.Messages() <- events.NewGovernanceWorkloadCancelationMessage(events.AGREEMENT_ENDED, events.AG_TERMINATED, ag.AgreementProtocol, ag.CurrentAgreementId, ag.CurrentDeployment)
+				// clean up microservice instances if needed
+				w.handleMicroserviceInstForAgEnded(ag.CurrentAgreementId, false)
+				continue
+			}
+
 			if ag.AgreementFinalizedTime == 0 { // TODO: might need to change this to be a protocol specific check
 
 				// Cancel the agreement if finalization doesn't occur before the timeout
@@ -414,6 +448,9 @@ func (w *GovernanceWorker) reportBlockchains() int {
 // same agreement id.
 func (w *GovernanceWorker) cancelAgreement(agreementId string, agreementProtocol string, reason uint, desc string) {
 
+	// The agreement no longer needs its unhealthy services to be tracked
+	delete(w.unhealthyRestarts, agreementId)
+
 	// Update the database
 	var ag *persistence.EstablishedAgreement
 	if agreement, err := persistence.AgreementStateTerminated(w.db, agreementId, uint64(reason), desc, agreementProtocol); err != nil {
@@ -549,6 +586,29 @@ func (w *GovernanceWorker) CommandHandler(command worker.Command) bool {
 			w.handleMicroserviceInstForAgEnded(agreementId, false)
 		}
 
+	case *UnhealthyContainerCommand:
+		cmd, _ := command.(*UnhealthyContainerCommand)
+
+		// Docker has already seen the health check fail several times in a row. Restart the unhealthy services to
+		// give them a chance to recover, if they are still unhealthy after that then the agreement is cancelled.
+		if restarts := w.unhealthyRestarts[cmd.AgreementId]; restarts < MAX_UNHEALTHY_RESTARTS {
+			glog.Warningf(logString(fmt.Sprintf("restarting unhealthy services %v for agreement %v", cmd.ServiceNames, cmd.AgreementId)))
+			w.unhealthyRestarts[cmd.AgreementId] = restarts + 1
+			w.Messages() <- events.NewContainerHealthMessage(events.CONTAINER_RESTART, cmd.AgreementProtocol, cmd.AgreementId, cmd.Deployment, cmd.ServiceNames)
+		} else {
+			glog.Errorf(logString(fmt.Sprintf("terminating agreement %v because services %v are still unhealthy after %v restarts", cmd.AgreementId, cmd.ServiceNames, restarts)))
+			w.Commands <- w.NewCleanupExecutionCommand(cmd.AgreementProtocol, cmd.AgreementId, w.producerPH[cmd.AgreementProtocol].GetTerminationCode(producer.TERM_REASON_CONTAINER_UNHEALTHY), cmd.Deployment)
+		}
+
+	case *HealthyContainerCommand:
+		cmd, _ := command.(*HealthyContainerCommand)
+
+		// The services have recovered, so they get restarted again the next time they become unhealthy.
+		if _, ok := w.unhealthyRestarts[cmd.AgreementId]; ok {
+			glog.V(3).Infof(logString(fmt.Sprintf("services of agreement %v are healthy again", cmd.AgreementId)))
+			delete(w.unhealthyRestarts, cmd.AgreementId)
+		}
+
 	case *producer.ExchangeMessageCommand:
 		cmd, _ := command.(*producer.ExchangeMessageCommand)
 
@@ -911,6 +971,17 @@ func (w *GovernanceWorker) NoWorkHandler() {
 
 }
 
+// Returns true if the availability schedule in the terms and conditions of the agreement is closed.
+func (w *GovernanceWorker) availabilityClosed(ag *persistence.EstablishedAgreement, protocolHandler abstractprotocol.ProtocolHandler) (bool, error) {
+	if proposal, err := protocolHandler.DemarshalProposal(ag.Proposal); err != nil {
+		return false, errors.New(fmt.Sprintf("unable to demarshal proposal for agreement %v from database, error %v", ag.CurrentAgreementId, err))
+	} else if tcPolicy, err := policy.DemarshalPolicy(proposal.TsAndCs()); err != nil {
+		return false, errors.New(fmt.Sprintf("error demarshalling TsAndCs policy for agreement %v, error %v", ag.CurrentAgreementId, err))
+	} else {
+		return !tcPolicy.Availability.IsOpenAt(time.Now()), nil
+	}
+}
+
 // This function encapsulates finalization of an agreement for re-use
 func (w *GovernanceWorker) finalizeAgreement(agreement persistence.EstablishedAgreement, protocolHandler abstractprotocol.ProtocolHandler) error {
 
@@ -962,6 +1033,7 @@ func (w *GovernanceWorker) RecordReply(proposal abstractprotocol.Proposal, proto
 			return errors.New(fmt.Sprintf("Ill-formed URL: %v", workload.Torrent.Url))
 		} else {
 			cc := events.NewContainerConfig(*url, workload.Torrent.Signature, workload.Deployment, workload.DeploymentSignature, workload.DeploymentUserInfo, workload.DeploymentOverrides)
+			cc.Org = workload.Org
 
 			lc := new(events.AgreementLaunchContext)
 			lc.Configure = *cc
@@ -1005,6 +1077,17 @@ func (w *GovernanceWorker) RecordReply(proposal abstractprotocol.Proposal, proto
 			lc.EnvironmentAdditions = &envAdds
 			lc.AgreementProtocol = protocol
 
+			// The container worker enforces the resource limits from the terms and conditions on the workload containers.
+			limits := persistence.ResourceLimits{
+				MemoryMB:            int64(tcPolicy.ResourceLimits.Memory),
+				CPUs:                tcPolicy.ResourceLimits.CPUs,
+				NetworkUploadKbps:   tcPolicy.ResourceLimits.NetworkUpload,
+				NetworkDownloadKbps: tcPolicy.ResourceLimits.NetworkDownload,
+			}
+			if !limits.IsEmpty() {
+				lc.ResourceLimits = &limits
+			}
+
 			// get a list of microservices associated with this agreement and store them in the AgreementLaunchContext
 			ms_specs := []events.MicroserviceSpec{}
 			for _, as := range tcPolicy.APISpecs {
@@ -1083,7 +1166,7 @@ func (w *GovernanceWorker) GetWorkloadConfig(url string, version string) (map[st
 	}
 
 	// Find the eligible workload config objects
-	cfgs, err := persistence.FindWorkloadConfigs(w.db, []persistence.WCFilter{OlderWorkloadWCFilter(url, version)})
+	cfgs, err := w.store.FindWorkloadConfigs([]persistence.WCFilter{OlderWorkloadWCFilter(url, version)})
 	if err != nil {
 		return nil, fmt.Errorf("Unable to fetch post split workload preferences. Err: %v", err)
 	} else if len(cfgs) == 0 {
@@ -1101,7 +1184,7 @@ func (w *GovernanceWorker) GetWorkloadConfig(url string, version string) (map[st
 // Grab configured userInput variables for the workload and pass them into the
 // workload container. The namespace of these env vars is defined by the workload
 // so there is no need for us to prefix them with the HZN prefix.
-func (w *GovernanceWorker) ConfigToEnvvarMap(db *bolt.DB, cfg *persistence.WorkloadConfig, prefix string) (map[string]string, error) {
+func (w *GovernanceWorker) ConfigToEnvvarMap(db persistence.Store, cfg *persistence.WorkloadConfig, prefix string) (map[string]string, error) {
 
 	envvars := map[string]string{}
 
@@ -131,6 +131,8 @@ func (w *GovernanceWorker) StartMicroservice(ms_key string) (*persistence.Micros
 				} else {
 					// Fire an event to the torrent worker so that it will download the container
 					cc := events.NewContainerConfig(*url, ms_workload.Torrent.Signature, ms_workload.Deployment, ms_workload.DeploymentSignature, ms_workload.DeploymentUserInfo, "")
+					cc.Org = msdef.Org
+					cc.HardwareMatch = &msdef.MatchHardware
 
 					// convert the user input from the service attributes to env variables
 					if attrs, err := persistence.FindApplicableAttributes(w.db, msdef.SpecRef); err != nil {
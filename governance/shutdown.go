@@ -276,7 +276,7 @@ func (w *GovernanceWorker) patchNodeKey() error {
 
 // Remove all workload config records from the DB.
 func (w *GovernanceWorker) deleteWorkloadconfig() error {
-	wcs, err := persistence.FindWorkloadConfigs(w.db, []persistence.WCFilter{})
+	wcs, err := w.store.FindWorkloadConfigs([]persistence.WCFilter{})
 	if err != nil {
 		return errors.New(fmt.Sprintf("unable to retrieve workload config objects from database, error: %v", err))
 	} else if wcs == nil {
@@ -284,7 +284,7 @@ func (w *GovernanceWorker) deleteWorkloadconfig() error {
 	}
 
 	for _, wc := range wcs {
-		if err := persistence.DeleteWorkloadConfig(w.db, wc.WorkloadURL, wc.Org, wc.VersionExpression); err != nil {
+		if err := w.store.DeleteWorkloadConfig(wc.WorkloadURL, wc.Org, wc.VersionExpression); err != nil {
 			glog.Errorf(logString(fmt.Sprintf("error deleting workload config object %v, error: %v", wc, err)))
 		}
 	}
@@ -11,6 +11,7 @@ import (
 	"github.com/open-horizon/anax/exchange"
 	"github.com/open-horizon/anax/persistence"
 	"github.com/open-horizon/anax/policy"
+	"strings"
 	"time"
 )
 
@@ -21,14 +22,16 @@ type ContainerStatus struct {
 	Image   string `json:"image"`
 	Created int64  `json:"created"`
 	State   string `json:"state"`
+	Health  string `json:"health,omitempty"` // The docker health of a container that has a health check
 }
 
 func (w ContainerStatus) String() string {
 	return fmt.Sprintf("Name: %v, "+
 		"Image: %v, "+
 		"Created: %v, "+
-		"State: %v",
-		w.Name, w.Image, w.Created, w.State)
+		"State: %v, "+
+		"Health: %v",
+		w.Name, w.Image, w.Created, w.State, w.Health)
 }
 
 type MicroserviceStatus struct {
@@ -270,6 +273,7 @@ func GetContainerStatus(deployment string, key string, infrastructure bool, cont
 						container_status.Image = container.Image
 						container_status.Created = container.Created
 						container_status.State = container.State
+						container_status.Health = containerHealth(container.Status)
 						break
 					}
 				}
@@ -281,6 +285,19 @@ func GetContainerStatus(deployment string, key string, infrastructure bool, cont
 	return status, nil
 }
 
+// Docker appends the health of a container that has a health check to its status, e.g. "Up 2 minutes (healthy)"
+// or "Up 5 seconds (health: starting)".
+func containerHealth(status string) string {
+	if strings.HasSuffix(status, "(healthy)") {
+		return "healthy"
+	} else if strings.HasSuffix(status, "(unhealthy)") {
+		return "unhealthy"
+	} else if strings.HasSuffix(status, "(health: starting)") {
+		return "starting"
+	}
+	return ""
+}
+
 // write to the exchange
 func (w *GovernanceWorker) writeStatusToExchange(device_status *DeviceStatus) error {
 	var resp interface{}
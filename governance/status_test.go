@@ -109,6 +109,19 @@ func Test_GetContainerStatus(t *testing.T) {
 
 	assert.Nil(t, err)
 	assert.True(t, statusArrayIsSame(exp_status, status), "The elements should be the same.")
+
+	// test the health of containers that have a health check
+	c1.Status = "Up 2 minutes (unhealthy)"
+	c2.Status = "Up 5 seconds (health: starting)"
+	containers = []docker.APIContainers{c1, c2, c3, c4}
+	deployment = "{\"services\":{\"netspeed5\":{\"image\":\"mycompany/x86/netspeed5:v2.5\",\"health_check\":{\"http_port\":8080}}, \"test\":{\"image\":\"mycompany/x86/test:v1.0\",\"health_check\":{\"tcp_port\":80}}}}"
+	exp_status = []ContainerStatus{ContainerStatus{Name: "/aaaa-netspeed5", Image: "mycompany/x86/netspeed5:v2.5", Created: 1507728202, State: "running", Health: "unhealthy"},
+		{Name: "/aaaa-test", Image: "mycompany/x86/test:v1.0", Created: 1507728356, State: "running", Health: "starting"}}
+
+	status, err = GetContainerStatus(deployment, agreementId, false, containers)
+
+	assert.Nil(t, err)
+	assert.True(t, statusArrayIsSame(exp_status, status), "The elements should be the same.")
 }
 
 // Compare 2 ContainerStatus array contents without considering the order
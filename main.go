@@ -2,7 +2,6 @@ package main
 
 import (
 	"flag"
-	"github.com/boltdb/bolt"
 	"github.com/golang/glog"
 	"github.com/open-horizon/anax/agreement"
 	"github.com/open-horizon/anax/agreementbot"
@@ -10,18 +9,18 @@ import (
 	"github.com/open-horizon/anax/config"
 	"github.com/open-horizon/anax/container"
 	"github.com/open-horizon/anax/ethblockchain"
+	"github.com/open-horizon/anax/eventlog"
 	"github.com/open-horizon/anax/exchange"
 	"github.com/open-horizon/anax/governance"
+	"github.com/open-horizon/anax/persistence"
 	"github.com/open-horizon/anax/policy"
 	"github.com/open-horizon/anax/torrent"
 	"github.com/open-horizon/anax/worker"
 	"os"
 	"os/signal"
-	"path"
 	"runtime"
 	"runtime/pprof"
 	"syscall"
-	"time"
 )
 
 // The core of anax is an event handling system that distributes events to workers, where the workers
@@ -52,32 +51,34 @@ func main() {
 	glog.V(2).Infof("GOMAXPROCS: %v", runtime.GOMAXPROCS(-1))
 
 	// open edge DB if necessary
-	var db *bolt.DB
+	var db persistence.Store
 	if len(cfg.Edge.DBPath) != 0 {
-		if err := os.MkdirAll(cfg.Edge.DBPath, 0700); err != nil {
-			panic(err)
-		}
-
-		edgeDB, err := bolt.Open(path.Join(cfg.Edge.DBPath, "anax.db"), 0600, &bolt.Options{Timeout: 10 * time.Second})
+		edgeDB, err := persistence.OpenBoltStore(cfg.Edge.DBPath, "anax.db")
 		if err != nil {
 			panic(err)
 		}
 		db = edgeDB
 
+		// Upgrade the records in the DB before any worker reads them
+		if err := persistence.EdgeMigrations.Run(db); err != nil {
+			glog.Errorf("Unable to migrate the anax database, terminating.")
+			panic(err)
+		}
 	}
 
 	// open Agreement Bot DB if necessary
-	var agbotdb *bolt.DB
+	var agbotdb persistence.Store
 	if len(cfg.AgreementBot.DBPath) != 0 {
-		if err := os.MkdirAll(cfg.AgreementBot.DBPath, 0700); err != nil {
+		agdb, err := persistence.OpenBoltStore(cfg.AgreementBot.DBPath, "agreementbot.db")
+		if err != nil {
 			panic(err)
 		}
+		agbotdb = agdb
 
-		agdb, err := bolt.Open(path.Join(cfg.AgreementBot.DBPath, "agreementbot.db"), 0600, &bolt.Options{Timeout: 10 * time.Second})
-		if err != nil {
+		if err := agreementbot.Migrations.Run(agbotdb); err != nil {
+			glog.Errorf("Unable to migrate the agreement bot database, terminating.")
 			panic(err)
 		}
-		agbotdb = agdb
 	}
 
 	// start control signal handler
@@ -120,6 +121,25 @@ func main() {
 	// start workers
 	workers := worker.NewMessageHandlerRegistry()
 
+	// Journal the events flowing between the workers if configured to do so. When both the node and the agbot are
+	// running, the events of the agbot's workers go in the agbot's journal and the rest go in the node's journal, so that
+	// each event is only recorded once.
+	journals := make([]*eventlog.Journal, 0, 2)
+	isAgbotWorker := func(source string) bool { return source == "AgBot" || source == "AgBot API" }
+	if db != nil && cfg.Edge.EventLogRetentionHours != 0 {
+		journals = append(journals, eventlog.NewJournal(db, cfg.Edge.EventLogRetentionHours, cfg.Edge.EventLogMaxRecords, func(source string) bool { return !isAgbotWorker(source) }))
+	}
+	if agbotdb != nil && cfg.AgreementBot.EventLogRetentionHours != 0 {
+		var accepts func(string) bool
+		if db != nil {
+			accepts = isAgbotWorker
+		}
+		journals = append(journals, eventlog.NewJournal(agbotdb, cfg.AgreementBot.EventLogRetentionHours, cfg.AgreementBot.EventLogMaxRecords, accepts))
+	}
+	for _, j := range journals {
+		workers.AddEventSink(j)
+	}
+
 	workers.Add(agreementbot.NewAgreementBotWorker("AgBot", cfg, agbotdb))
 	if cfg.AgreementBot.APIListen != "" {
 		workers.Add(agreementbot.NewAPIListener("AgBot API", cfg, agbotdb))
@@ -127,12 +147,16 @@ func main() {
 	workers.Add(ethblockchain.NewEthBlockchainWorker("Blockchain", cfg))
 
 	if db != nil {
-		workers.Add(api.NewAPIListener("API", cfg, db, pm))
+		// The API reads container logs through the container worker's docker client, and the progress of image
+		// fetches from the torrent worker.
+		containerWorker := container.NewContainerWorker("Container", cfg, db)
+		torrentWorker := torrent.NewTorrentWorker("Torrent", cfg, db)
+		workers.Add(api.NewAPIListener("API", cfg, db, pm, containerWorker, torrentWorker, containerWorker))
 		workers.Add(agreement.NewAgreementWorker("Agreement", cfg, db, pm))
 		workers.Add(governance.NewGovernanceWorker("Governance", cfg, db, pm))
 		workers.Add(exchange.NewExchangeMessageWorker("Exchange", cfg, db))
-		workers.Add(container.NewContainerWorker("Container", cfg, db))
-		workers.Add(torrent.NewTorrentWorker("Torrent", cfg, db))
+		workers.Add(containerWorker)
+		workers.Add(torrentWorker)
 	} else {
 		workers.Add(container.NewContainerWorker("Container", cfg, agbotdb))
 		workers.Add(torrent.NewTorrentWorker("Torrent", cfg, agbotdb))
@@ -141,6 +165,10 @@ func main() {
 	// Get into the event processing loop until anax shuts itself down.
 	workers.ProcessEventMessages()
 
+	for _, j := range journals {
+		j.Flush()
+	}
+
 	if db != nil {
 		db.Close()
 	}
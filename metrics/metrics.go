@@ -0,0 +1,410 @@
+package metrics
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// This package is a small implementation of counters, gauges and summaries that can be written in the
+// Prometheus text exposition format (version 0.0.4), so that the anax APIs can be scraped by Prometheus
+// without pulling in the Prometheus client library.
+
+const CONTENT_TYPE = "text/plain; version=0.0.4"
+
+const (
+	COUNTER = "counter"
+	GAUGE   = "gauge"
+	SUMMARY = "summary"
+)
+
+// Each metric family in the registry implements this interface.
+type family interface {
+	Name() string
+	write(w io.Writer) error
+}
+
+// A registry holds its own metric families and writes them together with the families of the
+// registries it includes.
+type Registry struct {
+	lock     sync.Mutex
+	families map[string]family
+	includes []*Registry
+}
+
+func NewRegistry(includes ...*Registry) *Registry {
+	return &Registry{
+		families: make(map[string]family),
+		includes: includes,
+	}
+}
+
+// The node and the agbot are served by different APIs, so each has its own registry. The metrics of the
+// parts of anax that both of them use, like the workers and the exchange client, are in the common registry
+// which is included in the other 2.
+var CommonRegistry = NewRegistry()
+var NodeRegistry = NewRegistry(CommonRegistry)
+var AgbotRegistry = NewRegistry(CommonRegistry)
+
+// Metric names must be unique. Registering the same name twice is a programming error.
+func (r *Registry) Register(f family) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if _, ok := r.families[f.Name()]; ok {
+		panic(fmt.Sprintf("metric %v is already registered", f.Name()))
+	}
+	r.families[f.Name()] = f
+}
+
+// Collect the families of the registry and of the registries it includes.
+func (r *Registry) collect(fams map[string]family) {
+	r.lock.Lock()
+	for name, f := range r.families {
+		fams[name] = f
+	}
+	r.lock.Unlock()
+
+	for _, inc := range r.includes {
+		inc.collect(fams)
+	}
+}
+
+// Write all the metrics in the registry, including the metrics of the included registries, sorted by name.
+func (r *Registry) Write(w io.Writer) error {
+	all := make(map[string]family)
+	r.collect(all)
+
+	names := make([]string, 0, len(all))
+	for name, _ := range all {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		if err := all[name].write(w); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// The common parts of every metric family.
+type desc struct {
+	name       string
+	help       string
+	metricType string
+	labelNames []string
+}
+
+func (d *desc) Name() string {
+	return d.name
+}
+
+func (d *desc) header() string {
+	return fmt.Sprintf("# HELP %v %v\n# TYPE %v %v\n", d.name, escapeHelp(d.help), d.name, d.metricType)
+}
+
+func (d *desc) key(labelValues []string) (string, error) {
+	if len(labelValues) != len(d.labelNames) {
+		return "", errors.New(fmt.Sprintf("metric %v expects %v label values, was given %v", d.name, len(d.labelNames), len(labelValues)))
+	}
+	return strings.Join(labelValues, "\xff"), nil
+}
+
+// Returns the label set in the form {a="1",b="2"}, or the empty string when there are no labels.
+func (d *desc) labels(labelValues []string) string {
+	if len(d.labelNames) == 0 {
+		return ""
+	}
+	buf := bytes.Buffer{}
+	buf.WriteString("{")
+	for ix, name := range d.labelNames {
+		if ix != 0 {
+			buf.WriteString(",")
+		}
+		buf.WriteString(fmt.Sprintf("%v=\"%v\"", name, escapeLabelValue(labelValues[ix])))
+	}
+	buf.WriteString("}")
+	return buf.String()
+}
+
+type sample struct {
+	labelValues []string
+	value       float64
+	count       uint64 // only used by summaries
+}
+
+// A set of counters or gauges with the same name, distinguished by their label values.
+type vec struct {
+	desc
+	lock    sync.Mutex
+	samples map[string]*sample
+}
+
+func newVec(name string, help string, metricType string, labelNames []string) *vec {
+	return &vec{
+		desc: desc{
+			name:       name,
+			help:       help,
+			metricType: metricType,
+			labelNames: labelNames,
+		},
+		samples: make(map[string]*sample),
+	}
+}
+
+func (v *vec) update(labelValues []string, fn func(s *sample)) {
+	key, err := v.key(labelValues)
+	if err != nil {
+		panic(err.Error())
+	}
+
+	v.lock.Lock()
+	defer v.lock.Unlock()
+	s, ok := v.samples[key]
+	if !ok {
+		s = &sample{labelValues: append([]string{}, labelValues...)}
+		v.samples[key] = s
+	}
+	fn(s)
+}
+
+func (v *vec) get(labelValues []string) float64 {
+	key, _ := v.key(labelValues)
+	v.lock.Lock()
+	defer v.lock.Unlock()
+	if s, ok := v.samples[key]; ok {
+		return s.value
+	}
+	return 0
+}
+
+// Remove the sample with the given label values, so that it is no longer written.
+func (v *vec) Delete(labelValues ...string) {
+	key, _ := v.key(labelValues)
+	v.lock.Lock()
+	defer v.lock.Unlock()
+	delete(v.samples, key)
+}
+
+// Remove all the samples.
+func (v *vec) Reset() {
+	v.lock.Lock()
+	defer v.lock.Unlock()
+	v.samples = make(map[string]*sample)
+}
+
+func (v *vec) sorted() []*sample {
+	v.lock.Lock()
+	defer v.lock.Unlock()
+	keys := make([]string, 0, len(v.samples))
+	for key, _ := range v.samples {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	res := make([]*sample, 0, len(keys))
+	for _, key := range keys {
+		s := *v.samples[key]
+		res = append(res, &s)
+	}
+	return res
+}
+
+func (v *vec) write(w io.Writer) error {
+	buf := bytes.Buffer{}
+	buf.WriteString(v.header())
+	for _, s := range v.sorted() {
+		if v.metricType == SUMMARY {
+			buf.WriteString(fmt.Sprintf("%v_sum%v %v\n", v.name, v.labels(s.labelValues), formatFloat(s.value)))
+			buf.WriteString(fmt.Sprintf("%v_count%v %v\n", v.name, v.labels(s.labelValues), s.count))
+		} else {
+			buf.WriteString(fmt.Sprintf("%v%v %v\n", v.name, v.labels(s.labelValues), formatFloat(s.value)))
+		}
+	}
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+// A counter only goes up.
+type CounterVec struct {
+	*vec
+}
+
+// Create a CounterVec in the common registry.
+func NewCounterVec(name string, help string, labelNames ...string) *CounterVec {
+	return CommonRegistry.NewCounterVec(name, help, labelNames...)
+}
+
+func (r *Registry) NewCounterVec(name string, help string, labelNames ...string) *CounterVec {
+	c := &CounterVec{newVec(name, help, COUNTER, labelNames)}
+	r.Register(c)
+	return c
+}
+
+func (c *CounterVec) Inc(labelValues ...string) {
+	c.Add(1, labelValues...)
+}
+
+func (c *CounterVec) Add(v float64, labelValues ...string) {
+	if v < 0 {
+		return
+	}
+	c.update(labelValues, func(s *sample) { s.value += v })
+}
+
+func (c *CounterVec) Get(labelValues ...string) float64 {
+	return c.get(labelValues)
+}
+
+// A gauge can go up and down.
+type GaugeVec struct {
+	*vec
+}
+
+// Create a GaugeVec in the common registry.
+func NewGaugeVec(name string, help string, labelNames ...string) *GaugeVec {
+	return CommonRegistry.NewGaugeVec(name, help, labelNames...)
+}
+
+func (r *Registry) NewGaugeVec(name string, help string, labelNames ...string) *GaugeVec {
+	g := &GaugeVec{newVec(name, help, GAUGE, labelNames)}
+	r.Register(g)
+	return g
+}
+
+func (g *GaugeVec) Set(v float64, labelValues ...string) {
+	g.update(labelValues, func(s *sample) { s.value = v })
+}
+
+func (g *GaugeVec) Get(labelValues ...string) float64 {
+	return g.get(labelValues)
+}
+
+// A summary keeps the sum and count of the observations, which is enough to compute averages and rates.
+type SummaryVec struct {
+	*vec
+}
+
+// Create a SummaryVec in the common registry.
+func NewSummaryVec(name string, help string, labelNames ...string) *SummaryVec {
+	return CommonRegistry.NewSummaryVec(name, help, labelNames...)
+}
+
+func (r *Registry) NewSummaryVec(name string, help string, labelNames ...string) *SummaryVec {
+	s := &SummaryVec{newVec(name, help, SUMMARY, labelNames)}
+	r.Register(s)
+	return s
+}
+
+func (sv *SummaryVec) Observe(v float64, labelValues ...string) {
+	sv.update(labelValues, func(s *sample) {
+		s.value += v
+		s.count += 1
+	})
+}
+
+func (sv *SummaryVec) Count(labelValues ...string) uint64 {
+	key, _ := sv.key(labelValues)
+	sv.lock.Lock()
+	defer sv.lock.Unlock()
+	if s, ok := sv.samples[key]; ok {
+		return s.count
+	}
+	return 0
+}
+
+// A gauge whose values are obtained by calling a function each time the metrics are written.
+type GaugeFuncVec struct {
+	desc
+	lock  sync.Mutex
+	funcs map[string]gaugeFunc
+}
+
+type gaugeFunc struct {
+	labelValues []string
+	fn          func() float64
+}
+
+// Create a GaugeFuncVec in the common registry.
+func NewGaugeFuncVec(name string, help string, labelNames ...string) *GaugeFuncVec {
+	return CommonRegistry.NewGaugeFuncVec(name, help, labelNames...)
+}
+
+func (r *Registry) NewGaugeFuncVec(name string, help string, labelNames ...string) *GaugeFuncVec {
+	g := &GaugeFuncVec{
+		desc: desc{
+			name:       name,
+			help:       help,
+			metricType: GAUGE,
+			labelNames: labelNames,
+		},
+		funcs: make(map[string]gaugeFunc),
+	}
+	r.Register(g)
+	return g
+}
+
+func (g *GaugeFuncVec) Set(fn func() float64, labelValues ...string) {
+	key, err := g.key(labelValues)
+	if err != nil {
+		panic(err.Error())
+	}
+	g.lock.Lock()
+	defer g.lock.Unlock()
+	g.funcs[key] = gaugeFunc{labelValues: append([]string{}, labelValues...), fn: fn}
+}
+
+func (g *GaugeFuncVec) Delete(labelValues ...string) {
+	key, _ := g.key(labelValues)
+	g.lock.Lock()
+	defer g.lock.Unlock()
+	delete(g.funcs, key)
+}
+
+func (g *GaugeFuncVec) write(w io.Writer) error {
+	g.lock.Lock()
+	keys := make([]string, 0, len(g.funcs))
+	for key, _ := range g.funcs {
+		keys = append(keys, key)
+	}
+	funcs := make([]gaugeFunc, 0, len(keys))
+	sort.Strings(keys)
+	for _, key := range keys {
+		funcs = append(funcs, g.funcs[key])
+	}
+	g.lock.Unlock()
+
+	buf := bytes.Buffer{}
+	buf.WriteString(g.header())
+	for _, gf := range funcs {
+		buf.WriteString(fmt.Sprintf("%v%v %v\n", g.name, g.labels(gf.labelValues), formatFloat(gf.fn())))
+	}
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+func escapeHelp(s string) string {
+	return strings.NewReplacer("\\", "\\\\", "\n", "\\n").Replace(s)
+}
+
+func escapeLabelValue(s string) string {
+	return strings.NewReplacer("\\", "\\\\", "\n", "\\n", "\"", "\\\"").Replace(s)
+}
@@ -0,0 +1,135 @@
+// +build unit
+
+package metrics
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func Test_Counter(t *testing.T) {
+	c := NewCounterVec("test_counter_total", "A test counter.", "event_id")
+	c.Inc("AGREEMENT_REACHED")
+	c.Inc("AGREEMENT_REACHED")
+	c.Add(3, "AGREEMENT_ENDED")
+	c.Add(-1, "AGREEMENT_ENDED")
+
+	if v := c.Get("AGREEMENT_REACHED"); v != 2 {
+		t.Errorf("expected 2, got %v", v)
+	} else if v := c.Get("AGREEMENT_ENDED"); v != 3 {
+		t.Errorf("expected counter to ignore negative additions, got %v", v)
+	}
+
+	buf := bytes.Buffer{}
+	if err := c.write(&buf); err != nil {
+		t.Errorf("unexpected error %v", err)
+	}
+
+	expected := "# HELP test_counter_total A test counter.\n" +
+		"# TYPE test_counter_total counter\n" +
+		"test_counter_total{event_id=\"AGREEMENT_ENDED\"} 3\n" +
+		"test_counter_total{event_id=\"AGREEMENT_REACHED\"} 2\n"
+	if buf.String() != expected {
+		t.Errorf("expected output:\n%v\ngot:\n%v", expected, buf.String())
+	}
+}
+
+func Test_Gauge(t *testing.T) {
+	g := NewGaugeVec("test_gauge", "A test gauge.", "state")
+	g.Set(4, "active")
+	g.Set(1.5, "active")
+	g.Set(2, "archived")
+	g.Delete("archived")
+
+	buf := bytes.Buffer{}
+	g.write(&buf)
+	if !strings.Contains(buf.String(), "test_gauge{state=\"active\"} 1.5\n") {
+		t.Errorf("expected active gauge in output, got:\n%v", buf.String())
+	} else if strings.Contains(buf.String(), "archived") {
+		t.Errorf("expected archived gauge to be deleted, got:\n%v", buf.String())
+	}
+}
+
+func Test_Summary(t *testing.T) {
+	s := NewSummaryVec("test_duration_seconds", "A test summary.", "method")
+	s.Observe(0.5, "GET")
+	s.Observe(1.5, "GET")
+
+	if c := s.Count("GET"); c != 2 {
+		t.Errorf("expected 2 observations, got %v", c)
+	}
+
+	buf := bytes.Buffer{}
+	s.write(&buf)
+	if !strings.Contains(buf.String(), "test_duration_seconds_sum{method=\"GET\"} 2\n") {
+		t.Errorf("expected sum in output, got:\n%v", buf.String())
+	} else if !strings.Contains(buf.String(), "test_duration_seconds_count{method=\"GET\"} 2\n") {
+		t.Errorf("expected count in output, got:\n%v", buf.String())
+	}
+}
+
+func Test_GaugeFunc(t *testing.T) {
+	depth := 0
+	g := NewGaugeFuncVec("test_queue_depth", "A test gauge func.", "worker")
+	g.Set(func() float64 { return float64(depth) }, "Agreement")
+
+	depth = 7
+	buf := bytes.Buffer{}
+	g.write(&buf)
+	if !strings.Contains(buf.String(), "test_queue_depth{worker=\"Agreement\"} 7\n") {
+		t.Errorf("expected the current value of the function in output, got:\n%v", buf.String())
+	}
+}
+
+func Test_Registry(t *testing.T) {
+	r := NewRegistry()
+	r.Register(newVec("test_b", "b", GAUGE, []string{}))
+	r.Register(newVec("test_a", "a \"quoted\"\nhelp", COUNTER, []string{}))
+
+	buf := bytes.Buffer{}
+	if err := r.Write(&buf); err != nil {
+		t.Errorf("unexpected error %v", err)
+	} else if strings.Index(buf.String(), "test_a") > strings.Index(buf.String(), "test_b") {
+		t.Errorf("expected metrics to be sorted by name, got:\n%v", buf.String())
+	} else if !strings.Contains(buf.String(), "# HELP test_a a \"quoted\"\\nhelp\n") {
+		t.Errorf("expected escaped help text, got:\n%v", buf.String())
+	}
+
+	defer func() {
+		if rec := recover(); rec == nil {
+			t.Errorf("expected duplicate registration to panic")
+		}
+	}()
+	r.Register(newVec("test_a", "a", COUNTER, []string{}))
+}
+
+func Test_Registry_includes(t *testing.T) {
+	common := NewRegistry()
+	node := NewRegistry(common)
+	agbot := NewRegistry(common)
+
+	common.NewCounterVec("test_common_total", "common").Inc()
+	node.NewGaugeVec("test_node", "node").Set(1)
+	agbot.NewGaugeVec("test_agbot", "agbot").Set(2)
+
+	buf := bytes.Buffer{}
+	if err := node.Write(&buf); err != nil {
+		t.Errorf("unexpected error %v", err)
+	} else if !strings.Contains(buf.String(), "test_common_total 1\n") || !strings.Contains(buf.String(), "test_node 1\n") {
+		t.Errorf("expected common and node metrics, got:\n%v", buf.String())
+	} else if strings.Contains(buf.String(), "test_agbot") {
+		t.Errorf("expected no agbot metrics, got:\n%v", buf.String())
+	}
+}
+
+func Test_LabelEscaping(t *testing.T) {
+	g := NewGaugeVec("test_escaping", "A test gauge.", "name")
+	g.Set(1, "a\"b\\c\nd")
+
+	buf := bytes.Buffer{}
+	g.write(&buf)
+	if !strings.Contains(buf.String(), "test_escaping{name=\"a\\\"b\\\\c\\nd\"} 1\n") {
+		t.Errorf("expected escaped label value, got:\n%v", buf.String())
+	}
+}
@@ -4,7 +4,6 @@ import (
 	"bytes"
 	"encoding/json"
 	"fmt"
-	"github.com/boltdb/bolt"
 	"github.com/golang/glog"
 	"github.com/open-horizon/anax/events"
 	"github.com/open-horizon/anax/exchange"
@@ -118,7 +117,7 @@ func ConvertToPersistent(ems *exchange.MicroserviceDefinition, org string) (*per
 }
 
 // check if the given msdef is eligible for a upgrade
-func MicroserviceReadyForUpgrade(msdef *persistence.MicroserviceDefinition, db *bolt.DB) bool {
+func MicroserviceReadyForUpgrade(msdef *persistence.MicroserviceDefinition, db persistence.Store) bool {
 	glog.V(5).Infof("Check if microservice is available for a upgrade: %v.", msdef.SpecRef)
 
 	if msdef.Archived {
@@ -159,7 +158,7 @@ func MicroserviceReadyForUpgrade(msdef *persistence.MicroserviceDefinition, db *
 // This function gets the msdef with highest version within defined version range from the exchange and
 // compare the version and content with the current msdef and decide if it needs to upgrade.
 // It returns the new msdef if the old one needs to be upgraded, otherwide return nil.
-func GetUpgradeMicroserviceDef(getMicroservice exchange.MicroserviceHandler, msdef *persistence.MicroserviceDefinition, deviceId string, deviceToken string, db *bolt.DB) (*persistence.MicroserviceDefinition, error) {
+func GetUpgradeMicroserviceDef(getMicroservice exchange.MicroserviceHandler, msdef *persistence.MicroserviceDefinition, deviceId string, deviceToken string, db persistence.Store) (*persistence.MicroserviceDefinition, error) {
 	glog.V(3).Infof("Get new microservice def for upgrading microservice %v version %v key %v", msdef.SpecRef, msdef.Version, msdef.Id)
 
 	// convert the sensor version to a version expression
@@ -204,7 +203,7 @@ func GetUpgradeMicroserviceDef(getMicroservice exchange.MicroserviceHandler, msd
 }
 
 // Get a msdef with a lower version compared to the given msdef version and return the new microservice def.
-func GetRollbackMicroserviceDef(getMicroservice exchange.MicroserviceHandler, msdef *persistence.MicroserviceDefinition, deviceId string, deviceToken string, db *bolt.DB) (*persistence.MicroserviceDefinition, error) {
+func GetRollbackMicroserviceDef(getMicroservice exchange.MicroserviceHandler, msdef *persistence.MicroserviceDefinition, deviceId string, deviceToken string, db persistence.Store) (*persistence.MicroserviceDefinition, error) {
 	glog.V(3).Infof("Get next highest microservice def for rolling back microservice %v version %v key %v", msdef.SpecRef, msdef.Version, msdef.Id)
 
 	// convert the sensor version to a version expression
@@ -260,7 +259,7 @@ func RemoveMicroservicePolicy(spec_ref string, org string, version string, msdef
 }
 
 // Generate a new policy file for given ms and the register the microservice on the exchange.
-func GenMicroservicePolicy(msdef *persistence.MicroserviceDefinition, policyPath string, db *bolt.DB, e chan events.Message, deviceOrg string) error {
+func GenMicroservicePolicy(msdef *persistence.MicroserviceDefinition, policyPath string, db persistence.Store, e chan events.Message, deviceOrg string) error {
 	glog.V(3).Infof("Genarate policy for the given microservice %v version %v key %v", msdef.SpecRef, msdef.Version, msdef.Id)
 
 	var policyArch string
@@ -269,6 +268,8 @@ func GenMicroservicePolicy(msdef *persistence.MicroserviceDefinition, policyPath
 	var counterPartyProperties policy.RequiredProperty
 	var properties map[string]interface{}
 	var serviceAgreementProtocols []interface{}
+	var availability interface{}
+	var refusePrivileged bool
 
 	props := make(map[string]interface{})
 
@@ -304,6 +305,12 @@ func GenMicroservicePolicy(msdef *persistence.MicroserviceDefinition, policyPath
 				agpl := attr.(persistence.AgreementProtocolAttributes).Protocols
 				serviceAgreementProtocols = agpl.([]interface{})
 
+			case persistence.AvailabilityAttributes:
+				availability = attr.(persistence.AvailabilityAttributes).Schedules
+
+			case persistence.SecurityAttributes:
+				refusePrivileged = attr.(persistence.SecurityAttributes).RefusePrivileged
+
 			default:
 				glog.V(4).Infof("Unhandled attr type (%T): %v", attr, attr)
 			}
@@ -344,13 +351,18 @@ func GenMicroservicePolicy(msdef *persistence.MicroserviceDefinition, policyPath
 			return fmt.Errorf("Error converting agreement protocol list attribute %v to agreement protocol list, error: %v", serviceAgreementProtocols, err)
 		}
 
+		policyAvailability, err := policy.ConvertToAvailability(availability)
+		if err != nil {
+			return fmt.Errorf("Error converting availability attribute %v to availability schedules, error: %v", availability, err)
+		}
+
 		//Generate a policy based on all the attributes and the service definition
 		maxAgreements := 1
 		if msdef.Sharable == exchange.MS_SHARING_MODE_SINGLE || msdef.Sharable == exchange.MS_SHARING_MODE_MULTIPLE {
 			maxAgreements = 2 // hard coded 2 for now, will change to 0 later
 		}
 
-		if msg, err := policy.GeneratePolicy(msdef.SpecRef, msdef.Org, msdef.Name, msdef.Version, msdef.RequestedArch, &props, haPartner, meterPolicy, counterPartyProperties, *list, maxAgreements, policyPath, deviceOrg); err != nil {
+		if msg, err := policy.GeneratePolicy(msdef.SpecRef, msdef.Org, msdef.Name, msdef.Version, msdef.RequestedArch, &props, haPartner, meterPolicy, counterPartyProperties, *list, *policyAvailability, refusePrivileged, maxAgreements, policyPath, deviceOrg); err != nil {
 			return fmt.Errorf("Failed to generate policy for %v version %v. Error: %v", msdef.SpecRef, msdef.Version, err)
 		} else {
 			e <- msg
@@ -363,7 +375,7 @@ func GenMicroservicePolicy(msdef *persistence.MicroserviceDefinition, policyPath
 // Unregisters the given microservice from the exchange
 func UnregisterMicroserviceExchange(getExchangeDevice exchange.DeviceHandler,
 	putExchangeDevice exchange.PutDeviceHandler,
-	spec_ref string, device_id string, device_token string, db *bolt.DB) error {
+	spec_ref string, device_id string, device_token string, db persistence.Store) error {
 
 	glog.V(3).Infof("Unregister microservice %v from exchange for %v.", spec_ref, device_id)
 
@@ -4,16 +4,13 @@ package microservice
 
 import (
 	"fmt"
-	"github.com/boltdb/bolt"
 	"github.com/open-horizon/anax/cutil"
 	"github.com/open-horizon/anax/exchange"
 	"github.com/open-horizon/anax/persistence"
 	"github.com/stretchr/testify/assert"
 	"io/ioutil"
 	"os"
-	"path"
 	"testing"
-	"time"
 )
 
 func TestConvertToPersistent(t *testing.T) {
@@ -304,18 +301,13 @@ func getVariableDeviceHandler(mss []exchange.Microservice) exchange.DeviceHandle
 	}
 }
 
-func setupDB() (string, *bolt.DB, error) {
+func setupDB() (string, persistence.Store, error) {
 	dir, err := ioutil.TempDir("", "container-")
 	if err != nil {
 		return "", nil, err
 	}
 
-	db, err := bolt.Open(path.Join(dir, "anax-int.db"), 0600, &bolt.Options{Timeout: 10 * time.Second})
-	if err != nil {
-		return dir, nil, err
-	}
-
-	return dir, db, nil
+	return dir, persistence.NewMemoryStore(), nil
 }
 
 func cleanupDB(dir string) error {
@@ -260,6 +260,54 @@ func (a AgreementProtocolAttributes) String() string {
 	return fmt.Sprintf("Meta: %v, Protocols: %v", a.Meta, a.Protocols)
 }
 
+type AvailabilityAttributes struct {
+	Meta      *AttributeMeta `json:"meta"`
+	Schedules interface{}    `json:"schedules"`
+}
+
+func (a AvailabilityAttributes) GetMeta() *AttributeMeta {
+	return a.Meta
+}
+
+func (a AvailabilityAttributes) GetGenericMappings() map[string]interface{} {
+	return map[string]interface{}{
+		"schedules": a.Schedules,
+	}
+}
+
+// TODO: duplicate this for the others too
+func (a AvailabilityAttributes) Update(other Attribute) error {
+	return fmt.Errorf("Update not implemented for type: %T", a)
+}
+
+func (a AvailabilityAttributes) String() string {
+	return fmt.Sprintf("Meta: %v, Schedules: %v", a.Meta, a.Schedules)
+}
+
+type SecurityAttributes struct {
+	Meta             *AttributeMeta `json:"meta"`
+	RefusePrivileged bool           `json:"refuse_privileged"`
+}
+
+func (a SecurityAttributes) GetMeta() *AttributeMeta {
+	return a.Meta
+}
+
+func (a SecurityAttributes) GetGenericMappings() map[string]interface{} {
+	return map[string]interface{}{
+		"refusePrivileged": a.RefusePrivileged,
+	}
+}
+
+// TODO: duplicate this for the others too
+func (a SecurityAttributes) Update(other Attribute) error {
+	return fmt.Errorf("Update not implemented for type: %T", a)
+}
+
+func (a SecurityAttributes) String() string {
+	return fmt.Sprintf("Meta: %v, RefusePrivileged: %v", a.Meta, a.RefusePrivileged)
+}
+
 type HTTPSBasicAuthAttributes struct {
 	Meta     *AttributeMeta `json:"meta"`
 	Username string         `json:"username"`
@@ -3,7 +3,6 @@ package persistence
 import (
 	"encoding/json"
 	"fmt"
-	"github.com/boltdb/bolt"
 	"github.com/golang/glog"
 	"github.com/open-horizon/anax/cutil"
 	"github.com/satori/go.uuid"
@@ -183,6 +182,20 @@ func HydrateConcreteAttribute(v []byte) (Attribute, error) {
 		}
 		attr = agp
 
+	case "AvailabilityAttributes":
+		var aa AvailabilityAttributes
+		if err := json.Unmarshal(v, &aa); err != nil {
+			return nil, err
+		}
+		attr = aa
+
+	case "SecurityAttributes":
+		var sa SecurityAttributes
+		if err := json.Unmarshal(v, &sa); err != nil {
+			return nil, err
+		}
+		attr = sa
+
 	case "HTTPSBasicAuthAttributes":
 		var hba HTTPSBasicAuthAttributes
 		if err := json.Unmarshal(v, &hba); err != nil {
@@ -206,11 +219,11 @@ func HydrateConcreteAttribute(v []byte) (Attribute, error) {
 }
 
 // FindAttributeByKey is used to fetch a single attribute by its primary key
-func FindAttributeByKey(db *bolt.DB, id string) (*Attribute, error) {
+func FindAttributeByKey(db Store, id string) (*Attribute, error) {
 	var attr Attribute
-	var bucket *bolt.Bucket
+	var bucket Bucket
 
-	readErr := db.View(func(tx *bolt.Tx) error {
+	readErr := db.View(func(tx Tx) error {
 		bucket = tx.Bucket([]byte(ATTRIBUTES))
 		if bucket != nil {
 
@@ -239,11 +252,11 @@ func FindAttributeByKey(db *bolt.DB, id string) (*Attribute, error) {
 	return &attr, nil
 }
 
-func FindApplicableAttributes(db *bolt.DB, serviceUrl string) ([]Attribute, error) {
+func FindApplicableAttributes(db Store, serviceUrl string) ([]Attribute, error) {
 
-	filteredAttrs := []Attribute{}
+	allAttrs := []Attribute{}
 
-	return filteredAttrs, db.View(func(tx *bolt.Tx) error {
+	readErr := db.View(func(tx Tx) error {
 		bucket := tx.Bucket([]byte(ATTRIBUTES))
 
 		if bucket == nil {
@@ -256,27 +269,36 @@ func FindApplicableAttributes(db *bolt.DB, serviceUrl string) ([]Attribute, erro
 			if err != nil {
 				return err
 			}
+			allAttrs = append(allAttrs, attr)
+			return nil
+		})
+	})
+
+	return applicableAttributes(allAttrs, serviceUrl), readErr
+}
 
-			if serviceUrl == "" {
-				// no need to discriminate
+// Pick out the attributes that apply to the service, all of them when the service url is empty.
+func applicableAttributes(allAttrs []Attribute, serviceUrl string) []Attribute {
+	filteredAttrs := []Attribute{}
+	for _, attr := range allAttrs {
+		if serviceUrl == "" {
+			// no need to discriminate
+			filteredAttrs = append(filteredAttrs, attr)
+		} else {
+			sensorUrls := attr.GetMeta().SensorUrls
+			if sensorUrls == nil || len(sensorUrls) == 0 {
 				filteredAttrs = append(filteredAttrs, attr)
 			} else {
-				sensorUrls := attr.GetMeta().SensorUrls
-				if sensorUrls == nil || len(sensorUrls) == 0 {
-					filteredAttrs = append(filteredAttrs, attr)
-				} else {
-					// O(2)
-					for _, url := range sensorUrls {
-						if url == "" || url == serviceUrl {
-							filteredAttrs = append(filteredAttrs, attr)
-						}
+				// O(2)
+				for _, url := range sensorUrls {
+					if url == "" || url == serviceUrl {
+						filteredAttrs = append(filteredAttrs, attr)
 					}
 				}
 			}
-
-			return nil
-		})
-	})
+		}
+	}
+	return filteredAttrs
 }
 
 // Workloads dont see the same system level env vars that microservices see. This function picks out just
@@ -399,6 +421,12 @@ func AttributesToEnvvarMap(attributes []Attribute, envvars map[string]string, pr
 		case AgreementProtocolAttributes:
 			// Nothing to do
 
+		case AvailabilityAttributes:
+			// Nothing to do
+
+		case SecurityAttributes:
+			// Nothing to do
+
 		default:
 			return nil, fmt.Errorf("Unhandled service attribute: %v", serv)
 		}
@@ -407,19 +435,23 @@ func AttributesToEnvvarMap(attributes []Attribute, envvars map[string]string, pr
 	return envvars, nil
 }
 
-func FindConflictingAttributes(db *bolt.DB, attribute *Attribute) (*Attribute, error) {
+func FindConflictingAttributes(db Store, attribute *Attribute) (*Attribute, error) {
+	return findConflictingAttributes(func(url string) ([]Attribute, error) { return FindApplicableAttributes(db, url) }, attribute)
+}
+
+func findConflictingAttributes(findApplicable func(serviceUrl string) ([]Attribute, error), attribute *Attribute) (*Attribute, error) {
 	var err error
 	var common []Attribute
 	urls := (*attribute).GetMeta().SensorUrls
 
 	if len(urls) == 0 {
-		common, err = FindApplicableAttributes(db, "")
+		common, err = findApplicable("")
 		if err != nil {
 			return nil, err
 		}
 	} else {
 		for _, url := range urls {
-			common, err = FindApplicableAttributes(db, url)
+			common, err = findApplicable(url)
 			if err != nil {
 				return nil, err
 			}
@@ -453,13 +485,34 @@ type ConflictingAttributeFound struct {
 func (e ConflictingAttributeFound) Error() string { return e.msg }
 
 // N.B. It's the caller's responsibility to ensure the attr.SensorUrls are deduplicated; use the Attribute.AddSensorUrl() function to keep the slice clean
-func SaveOrUpdateAttribute(db *bolt.DB, attr Attribute, id string, permitPartialOverwrite bool) (*Attribute, error) {
+func SaveOrUpdateAttribute(db Store, attr Attribute, id string, permitPartialOverwrite bool) (*Attribute, error) {
+	return saveOrUpdateAttribute(
+		func(id string) (*Attribute, error) { return FindAttributeByKey(db, id) },
+		func(url string) ([]Attribute, error) { return FindApplicableAttributes(db, url) },
+		func(id string, attr *Attribute) error {
+			return db.Update(func(tx Tx) error {
+				bucket, err := tx.CreateBucketIfNotExists([]byte(ATTRIBUTES))
+				if err != nil {
+					return err
+				}
+				serial, err := json.Marshal(attr)
+				if err != nil {
+					return fmt.Errorf("Failed to serialize attribute: %v. Error: %v", attr, err)
+				}
+				return bucket.Put([]byte(id), serial)
+			})
+		},
+		attr, id, permitPartialOverwrite)
+}
+
+// The logic of saving an attribute, independent of where the attributes are kept.
+func saveOrUpdateAttribute(find func(id string) (*Attribute, error), findApplicable func(serviceUrl string) ([]Attribute, error), put func(id string, attr *Attribute) error, attr Attribute, id string, permitPartialOverwrite bool) (*Attribute, error) {
 	var ret *Attribute
 
 	if id == "" {
 		// an empty id means this is a new record and we'll generate a unique id before saving
 
-		if possiblyConflicting, err := FindConflictingAttributes(db, &attr); err != nil {
+		if possiblyConflicting, err := findConflictingAttributes(findApplicable, &attr); err != nil {
 			return nil, err
 		} else if possiblyConflicting != nil {
 			glog.Infof("Found conflicting attribute during save of new one. Existing: %v. New: %v", *possiblyConflicting, attr)
@@ -471,12 +524,12 @@ func SaveOrUpdateAttribute(db *bolt.DB, attr Attribute, id string, permitPartial
 	} else {
 		// updating and existing must be found; may be a partial overwrite
 
-		existing, err := FindAttributeByKey(db, id)
+		existing, err := find(id)
 		if err != nil {
 			return nil, fmt.Errorf("Failed to search for existing attribute: %v", err)
 		}
 
-		if *existing == nil {
+		if existing == nil || *existing == nil {
 			return nil, &OverwriteCandidateNotFound{}
 		} else {
 
@@ -508,22 +561,10 @@ func SaveOrUpdateAttribute(db *bolt.DB, attr Attribute, id string, permitPartial
 		(*ret).GetMeta().Publishable = &pT
 	}
 
-	writeErr := db.Update(func(tx *bolt.Tx) error {
-		bucket, err := tx.CreateBucketIfNotExists([]byte(ATTRIBUTES))
-		if err != nil {
-			return err
-		}
-		serial, err := json.Marshal(ret)
-		if err != nil {
-			return fmt.Errorf("Failed to serialize attribute: %v. Error: %v", ret, err)
-		}
-		return bucket.Put([]byte(id), serial)
-	})
-
-	return ret, writeErr
+	return ret, put(id, ret)
 }
 
-func DeleteAttribute(db *bolt.DB, id string) (*Attribute, error) {
+func DeleteAttribute(db Store, id string) (*Attribute, error) {
 
 	existing, err := FindAttributeByKey(db, id)
 	if err != nil {
@@ -534,7 +575,7 @@ func DeleteAttribute(db *bolt.DB, id string) (*Attribute, error) {
 		return nil, nil
 	}
 
-	delError := db.Update(func(tx *bolt.Tx) error {
+	delError := db.Update(func(tx Tx) error {
 		bucket, err := tx.CreateBucketIfNotExists([]byte(ATTRIBUTES))
 		if err != nil {
 			return err
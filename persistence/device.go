@@ -4,7 +4,6 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
-	"github.com/boltdb/bolt"
 	"github.com/golang/glog"
 	"time"
 )
@@ -71,7 +70,7 @@ func newExchangeDevice(id string, token string, name string, tokenLastValidTime
 }
 
 // a convenience function b/c we know there is really only one device
-func (e *ExchangeDevice) InvalidateExchangeToken(db *bolt.DB) (*ExchangeDevice, error) {
+func (e *ExchangeDevice) InvalidateExchangeToken(db Store) (*ExchangeDevice, error) {
 	exchDev, err := FindExchangeDevice(db)
 	if err != nil {
 		return nil, err
@@ -83,7 +82,7 @@ func (e *ExchangeDevice) InvalidateExchangeToken(db *bolt.DB) (*ExchangeDevice,
 	})
 }
 
-func (e *ExchangeDevice) SetExchangeDeviceToken(db *bolt.DB, deviceId string, token string) (*ExchangeDevice, error) {
+func (e *ExchangeDevice) SetExchangeDeviceToken(db Store, deviceId string, token string) (*ExchangeDevice, error) {
 	if deviceId == "" || token == "" {
 		return nil, errors.New("Argument null and mustn't be")
 	}
@@ -94,7 +93,7 @@ func (e *ExchangeDevice) SetExchangeDeviceToken(db *bolt.DB, deviceId string, to
 	})
 }
 
-func (e *ExchangeDevice) SetConfigstate(db *bolt.DB, deviceId string, state string) (*ExchangeDevice, error) {
+func (e *ExchangeDevice) SetConfigstate(db Store, deviceId string, state string) (*ExchangeDevice, error) {
 	if deviceId == "" || state == "" {
 		return nil, errors.New("Argument null and mustn't be")
 	}
@@ -106,7 +105,7 @@ func (e *ExchangeDevice) SetConfigstate(db *bolt.DB, deviceId string, state stri
 	})
 }
 
-func (e *ExchangeDevice) SetDeviceState(db *bolt.DB, state string) (*ExchangeDevice, error) {
+func (e *ExchangeDevice) SetDeviceState(db Store, state string) (*ExchangeDevice, error) {
 	return updateExchangeDevice(db, e, e.Id, false, func(d ExchangeDevice) *ExchangeDevice {
 		d.Config.State = state
 		d.Config.LastUpdateTime = uint64(time.Now().Unix())
@@ -118,7 +117,7 @@ func (e *ExchangeDevice) IsState(state string) bool {
 	return e.Config.State == state
 }
 
-func updateExchangeDevice(db *bolt.DB, self *ExchangeDevice, deviceId string, invalidateToken bool, fn func(d ExchangeDevice) *ExchangeDevice) (*ExchangeDevice, error) {
+func updateExchangeDevice(db Store, self *ExchangeDevice, deviceId string, invalidateToken bool, fn func(d ExchangeDevice) *ExchangeDevice) (*ExchangeDevice, error) {
 	if deviceId == "" {
 		return nil, fmt.Errorf("Illegal arguments specified.")
 	}
@@ -127,7 +126,7 @@ func updateExchangeDevice(db *bolt.DB, self *ExchangeDevice, deviceId string, in
 
 	var mod ExchangeDevice
 
-	return &mod, db.Update(func(tx *bolt.Tx) error {
+	return &mod, db.Update(func(tx Tx) error {
 		b, err := tx.CreateBucketIfNotExists([]byte(DEVICES))
 		if err != nil {
 			return err
@@ -180,7 +179,7 @@ func updateExchangeDevice(db *bolt.DB, self *ExchangeDevice, deviceId string, in
 }
 
 // always assumed the given token is valid at the time of call
-func SaveNewExchangeDevice(db *bolt.DB, id string, token string, name string, ha bool, organization string, pattern string, configstate string) (*ExchangeDevice, error) {
+func SaveNewExchangeDevice(db Store, id string, token string, name string, ha bool, organization string, pattern string, configstate string) (*ExchangeDevice, error) {
 
 	if id == "" || token == "" || name == "" || organization == "" || configstate == "" {
 		return nil, errors.New("Argument null and must not be")
@@ -188,7 +187,7 @@ func SaveNewExchangeDevice(db *bolt.DB, id string, token string, name string, ha
 
 	duplicate := false
 
-	dErr := db.View(func(tx *bolt.Tx) error {
+	dErr := db.View(func(tx Tx) error {
 		bd := tx.Bucket([]byte(DEVICES))
 		if bd != nil {
 			duplicate = (bd.Get([]byte(name)) != nil)
@@ -210,7 +209,7 @@ func SaveNewExchangeDevice(db *bolt.DB, id string, token string, name string, ha
 		return nil, err
 	}
 
-	writeErr := db.Update(func(tx *bolt.Tx) error {
+	writeErr := db.Update(func(tx Tx) error {
 		b, err := tx.CreateBucketIfNotExists([]byte(DEVICES))
 		if err != nil {
 			return err
@@ -228,11 +227,11 @@ func SaveNewExchangeDevice(db *bolt.DB, id string, token string, name string, ha
 	return exDevice, writeErr
 }
 
-func FindExchangeDevice(db *bolt.DB) (*ExchangeDevice, error) {
+func FindExchangeDevice(db Store) (*ExchangeDevice, error) {
 
 	devices := make([]ExchangeDevice, 0)
 
-	readErr := db.View(func(tx *bolt.Tx) error {
+	readErr := db.View(func(tx Tx) error {
 		if b := tx.Bucket([]byte(DEVICES)); b != nil {
 			return b.ForEach(func(k, v []byte) error {
 				var dev ExchangeDevice
@@ -262,7 +261,7 @@ func FindExchangeDevice(db *bolt.DB) (*ExchangeDevice, error) {
 	}
 }
 
-func DeleteExchangeDevice(db *bolt.DB) error {
+func DeleteExchangeDevice(db Store) error {
 
 	if dev, err := FindExchangeDevice(db); err != nil {
 		return err
@@ -270,7 +269,7 @@ func DeleteExchangeDevice(db *bolt.DB) error {
 		return fmt.Errorf("could not find record for device")
 	} else {
 
-		return db.Update(func(tx *bolt.Tx) error {
+		return db.Update(func(tx Tx) error {
 
 			if b, err := tx.CreateBucketIfNotExists([]byte(DEVICES)); err != nil {
 				return err
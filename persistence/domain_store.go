@@ -0,0 +1,154 @@
+package persistence
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// The DomainStore is the storage interface of anax in terms of the records it keeps: agreements, microservice
+// definitions and instances, attributes and workload configs. BoltDomainStore keeps the records as JSON in the buckets of a Store,
+// which is how anax keeps them in its BoltDB database. MemoryDomainStore keeps the records in maps, for tools
+// like hzn dev that run the workers without a node database, and for unit tests. The records of the agbot are
+// kept behind the AgbotStore of the agreementbot package.
+
+type AgreementStore interface {
+	FindEstablishedAgreements(protocol string, filters []EAFilter) ([]EstablishedAgreement, error)
+	FindEstablishedAgreementsAllProtocols(protocols []string, filters []EAFilter) ([]EstablishedAgreement, error)
+	SaveEstablishedAgreement(ag *EstablishedAgreement) error // Insert or replace the agreement
+	DeleteEstablishedAgreement(agreementId string, protocol string) error
+}
+
+type MicroserviceStore interface {
+	FindMicroserviceDefs(filters []MSFilter) ([]MicroserviceDefinition, error)
+	FindMicroserviceDefWithKey(key string) (*MicroserviceDefinition, error)
+	SaveOrUpdateMicroserviceDef(msdef *MicroserviceDefinition) error // Save a new definition and set its Id
+	FindMicroserviceInstances(filters []MIFilter) ([]MicroserviceInstance, error)
+	FindMicroserviceInstanceWithKey(key string) (*MicroserviceInstance, error)
+	SaveMicroserviceInstance(msinst *MicroserviceInstance) error // Insert or replace the instance
+	DeleteMicroserviceInstance(key string) (*MicroserviceInstance, error)
+}
+
+type AttributeStore interface {
+	FindAttributeByKey(id string) (*Attribute, error)
+	FindApplicableAttributes(serviceUrl string) ([]Attribute, error)
+	SaveOrUpdateAttribute(attr Attribute, id string, permitPartialOverwrite bool) (*Attribute, error)
+	DeleteAttribute(id string) (*Attribute, error)
+}
+
+type WorkloadConfigStore interface {
+	FindWorkloadConfigs(filters []WCFilter) ([]WorkloadConfig, error)
+	FindWorkloadConfig(url string, org string, version string) (*WorkloadConfig, error) // nil when there is no such config
+	SaveWorkloadConfig(cfg *WorkloadConfig) error                                       // Insert or replace the config
+	DeleteWorkloadConfig(url string, org string, version string) error
+}
+
+type DomainStore interface {
+	AgreementStore
+	MicroserviceStore
+	AttributeStore
+	WorkloadConfigStore
+}
+
+// The domain records kept in the buckets of a Store.
+type BoltDomainStore struct {
+	db Store
+}
+
+func NewBoltDomainStore(db Store) *BoltDomainStore {
+	return &BoltDomainStore{
+		db: db,
+	}
+}
+
+func (s *BoltDomainStore) FindEstablishedAgreements(protocol string, filters []EAFilter) ([]EstablishedAgreement, error) {
+	return FindEstablishedAgreements(s.db, protocol, filters)
+}
+
+func (s *BoltDomainStore) FindEstablishedAgreementsAllProtocols(protocols []string, filters []EAFilter) ([]EstablishedAgreement, error) {
+	return FindEstablishedAgreementsAllProtocols(s.db, protocols, filters)
+}
+
+func (s *BoltDomainStore) SaveEstablishedAgreement(ag *EstablishedAgreement) error {
+	return putRecord(s.db, E_AGREEMENTS+"-"+ag.AgreementProtocol, ag.CurrentAgreementId, ag)
+}
+
+func (s *BoltDomainStore) DeleteEstablishedAgreement(agreementId string, protocol string) error {
+	return DeleteEstablishedAgreement(s.db, agreementId, protocol)
+}
+
+func (s *BoltDomainStore) FindMicroserviceDefs(filters []MSFilter) ([]MicroserviceDefinition, error) {
+	return FindMicroserviceDefs(s.db, filters)
+}
+
+func (s *BoltDomainStore) FindMicroserviceDefWithKey(key string) (*MicroserviceDefinition, error) {
+	return FindMicroserviceDefWithKey(s.db, key)
+}
+
+func (s *BoltDomainStore) SaveOrUpdateMicroserviceDef(msdef *MicroserviceDefinition) error {
+	return SaveOrUpdateMicroserviceDef(s.db, msdef)
+}
+
+func (s *BoltDomainStore) FindMicroserviceInstances(filters []MIFilter) ([]MicroserviceInstance, error) {
+	return FindMicroserviceInstances(s.db, filters)
+}
+
+func (s *BoltDomainStore) FindMicroserviceInstanceWithKey(key string) (*MicroserviceInstance, error) {
+	return FindMicroserviceInstanceWithKey(s.db, key)
+}
+
+func (s *BoltDomainStore) SaveMicroserviceInstance(msinst *MicroserviceInstance) error {
+	return putRecord(s.db, MICROSERVICE_INSTANCES, msinst.GetKey(), msinst)
+}
+
+func (s *BoltDomainStore) DeleteMicroserviceInstance(key string) (*MicroserviceInstance, error) {
+	return DeleteMicroserviceInstance(s.db, key)
+}
+
+func (s *BoltDomainStore) FindAttributeByKey(id string) (*Attribute, error) {
+	return FindAttributeByKey(s.db, id)
+}
+
+func (s *BoltDomainStore) FindApplicableAttributes(serviceUrl string) ([]Attribute, error) {
+	return FindApplicableAttributes(s.db, serviceUrl)
+}
+
+func (s *BoltDomainStore) SaveOrUpdateAttribute(attr Attribute, id string, permitPartialOverwrite bool) (*Attribute, error) {
+	return SaveOrUpdateAttribute(s.db, attr, id, permitPartialOverwrite)
+}
+
+func (s *BoltDomainStore) DeleteAttribute(id string) (*Attribute, error) {
+	return DeleteAttribute(s.db, id)
+}
+
+func (s *BoltDomainStore) FindWorkloadConfigs(filters []WCFilter) ([]WorkloadConfig, error) {
+	return FindWorkloadConfigs(s.db, filters)
+}
+
+func (s *BoltDomainStore) FindWorkloadConfig(url string, org string, version string) (*WorkloadConfig, error) {
+	return FindWorkloadConfig(s.db, url, org, version)
+}
+
+func (s *BoltDomainStore) SaveWorkloadConfig(cfg *WorkloadConfig) error {
+	if cfg.WorkloadURL == "" || cfg.Org == "" || cfg.VersionExpression == "" {
+		return errors.New("WorkloadConfig, workload URL, organization, or version is empty, cannot persist")
+	}
+	return putRecord(s.db, WORKLOAD_CONFIG, cfg.GetKey(), cfg)
+}
+
+func (s *BoltDomainStore) DeleteWorkloadConfig(url string, org string, version string) error {
+	return DeleteWorkloadConfig(s.db, url, org, version)
+}
+
+// Write a record to a bucket as JSON, replacing the record with the same key.
+func putRecord(db Store, bucket string, key string, record interface{}) error {
+	return db.Update(func(tx Tx) error {
+		if b, err := tx.CreateBucketIfNotExists([]byte(bucket)); err != nil {
+			return err
+		} else if serial, err := json.Marshal(record); err != nil {
+			return fmt.Errorf("Failed to serialize %v record: %v. Error: %v", bucket, record, err)
+		} else {
+			return b.Put([]byte(key), serial)
+		}
+	})
+}
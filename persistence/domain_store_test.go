@@ -0,0 +1,113 @@
+// +build unit
+
+package persistence
+
+import (
+	"testing"
+)
+
+// Both domain store implementations must behave the same way, so the same checks are run against each of them.
+func Test_MemoryDomainStore(t *testing.T) {
+	checkDomainStore(t, NewMemoryDomainStore())
+}
+
+func Test_BoltDomainStore(t *testing.T) {
+	checkDomainStore(t, NewBoltDomainStore(NewMemoryStore()))
+}
+
+func checkDomainStore(t *testing.T, store DomainStore) {
+
+	// Agreements are kept per protocol and can be replaced.
+	for _, ag := range []EstablishedAgreement{
+		{CurrentAgreementId: "ag2", AgreementProtocol: "Basic"},
+		{CurrentAgreementId: "ag1", AgreementProtocol: "Basic"},
+		{CurrentAgreementId: "ag3", AgreementProtocol: "Citizen Scientist"},
+	} {
+		if err := store.SaveEstablishedAgreement(&ag); err != nil {
+			t.Fatalf("unable to save agreement %v, error: %v", ag.CurrentAgreementId, err)
+		}
+	}
+	archived := EstablishedAgreement{CurrentAgreementId: "ag2", AgreementProtocol: "Basic", Archived: true}
+	if err := store.SaveEstablishedAgreement(&archived); err != nil {
+		t.Fatalf("unable to replace agreement, error: %v", err)
+	}
+
+	if ags, err := store.FindEstablishedAgreements("Basic", []EAFilter{}); err != nil || len(ags) != 2 || ags[0].CurrentAgreementId != "ag1" {
+		t.Errorf("expected ag1 and ag2 in key order, got %v %v", ags, err)
+	} else if ags, err := store.FindEstablishedAgreementsAllProtocols([]string{"Basic", "Citizen Scientist"}, []EAFilter{UnarchivedEAFilter()}); err != nil || len(ags) != 2 {
+		t.Errorf("expected 2 unarchived agreements, got %v %v", ags, err)
+	} else if err := store.DeleteEstablishedAgreement("ag2", "Basic"); err == nil {
+		t.Errorf("expected an archived agreement not to be deleted")
+	} else if err := store.DeleteEstablishedAgreement("ag1", "Basic"); err != nil {
+		t.Errorf("unexpected error %v", err)
+	} else if ags, _ := store.FindEstablishedAgreements("Basic", []EAFilter{UnarchivedEAFilter()}); len(ags) != 0 {
+		t.Errorf("expected no unarchived agreements, got %v", ags)
+	}
+
+	// Microservice definitions are given ids, instances are keyed by their url, version and instance id.
+	msdef := &MicroserviceDefinition{SpecRef: "http://ms1", Version: "1.0.0"}
+	if err := store.SaveOrUpdateMicroserviceDef(msdef); err != nil || msdef.Id == "" {
+		t.Errorf("expected the definition to be given an id, got %v %v", msdef.Id, err)
+	} else if found, err := store.FindMicroserviceDefWithKey(msdef.Id); err != nil || found.SpecRef != "http://ms1" {
+		t.Errorf("expected to find the definition, got %v %v", found, err)
+	} else if defs, err := store.FindMicroserviceDefs([]MSFilter{UrlMSFilter("http://ms1")}); err != nil || len(defs) != 1 {
+		t.Errorf("expected 1 definition, got %v %v", defs, err)
+	}
+
+	msinst := &MicroserviceInstance{SpecRef: "http://ms1", Version: "1.0.0", InstanceId: "i1", MicroserviceDefId: msdef.Id}
+	if err := store.SaveMicroserviceInstance(msinst); err != nil {
+		t.Errorf("unexpected error %v", err)
+	} else if found, err := store.FindMicroserviceInstanceWithKey(msinst.GetKey()); err != nil || found.InstanceId != "i1" {
+		t.Errorf("expected to find the instance, got %v %v", found, err)
+	} else if insts, err := store.FindMicroserviceInstances([]MIFilter{AllInstancesMIFilter("http://ms1", "1.0.0"), UnarchivedMIFilter()}); err != nil || len(insts) != 1 {
+		t.Errorf("expected 1 instance, got %v %v", insts, err)
+	} else if deleted, err := store.DeleteMicroserviceInstance(msinst.GetKey()); err != nil || deleted == nil {
+		t.Errorf("expected the instance to be deleted, got %v %v", deleted, err)
+	} else if insts, _ := store.FindMicroserviceInstances([]MIFilter{}); len(insts) != 0 {
+		t.Errorf("expected no instances, got %v", insts)
+	}
+
+	// Attributes get an id, and the same attribute cannot be saved twice.
+	attr := &ComputeAttributes{Meta: &AttributeMeta{Type: "ComputeAttributes", SensorUrls: []string{}}, CPUs: 2, RAM: 1024}
+	saved, err := store.SaveOrUpdateAttribute(attr, "", false)
+	if err != nil {
+		t.Fatalf("unable to save attribute, error: %v", err)
+	}
+	id := (*saved).GetMeta().Id
+	if id == "" {
+		t.Errorf("expected the attribute to be given an id")
+	} else if _, err := store.SaveOrUpdateAttribute(attr, "", false); err == nil {
+		t.Errorf("expected a conflicting attribute to be refused")
+	} else if found, err := store.FindAttributeByKey(id); err != nil || *found == nil {
+		t.Errorf("expected to find the attribute, got %v", err)
+	} else if attrs, err := store.FindApplicableAttributes("http://ms1"); err != nil || len(attrs) != 1 {
+		t.Errorf("expected the attribute to apply to every service, got %v %v", attrs, err)
+	} else if _, err := store.SaveOrUpdateAttribute(attr, "missing", false); err == nil {
+		t.Errorf("expected an update of a missing attribute to fail")
+	} else if deleted, err := store.DeleteAttribute(id); err != nil || deleted == nil {
+		t.Errorf("expected the attribute to be deleted, got %v", err)
+	} else if attrs, _ := store.FindApplicableAttributes(""); len(attrs) != 0 {
+		t.Errorf("expected no attributes, got %v", attrs)
+	}
+
+	// Workload configs are keyed by url, org and version range, and can be replaced.
+	varAttr := &UserInputAttributes{Meta: &AttributeMeta{Type: "UserInputAttributes", SensorUrls: []string{}}, Mappings: map[string]interface{}{"a": "1"}}
+	cfg := &WorkloadConfig{WorkloadURL: "http://wl1", Org: "myorg", VersionExpression: "[1.0.0,INFINITY)", Attributes: []Attribute{varAttr}}
+	if err := store.SaveWorkloadConfig(&WorkloadConfig{WorkloadURL: "http://wl1"}); err == nil {
+		t.Errorf("expected a config without org and version to be refused")
+	} else if err := store.SaveWorkloadConfig(cfg); err != nil {
+		t.Errorf("unexpected error %v", err)
+	} else if err := store.SaveWorkloadConfig(cfg); err != nil {
+		t.Errorf("expected the config to be replaced, got %v", err)
+	} else if found, err := store.FindWorkloadConfig("http://wl1", "myorg", "[1.0.0,INFINITY)"); err != nil || found == nil || len(found.Attributes) != 1 {
+		t.Errorf("expected to find the config, got %v %v", found, err)
+	} else if found, err := store.FindWorkloadConfig("http://wl1", "other", "[1.0.0,INFINITY)"); err != nil || found != nil {
+		t.Errorf("expected no config in another org, got %v %v", found, err)
+	} else if cfgs, err := store.FindWorkloadConfigs([]WCFilter{AllWorkloadWCFilter("http://wl1", "myorg")}); err != nil || len(cfgs) != 1 {
+		t.Errorf("expected 1 config, got %v %v", cfgs, err)
+	} else if err := store.DeleteWorkloadConfig("http://wl1", "myorg", "[1.0.0,INFINITY)"); err != nil {
+		t.Errorf("unexpected error %v", err)
+	} else if cfgs, _ := store.FindWorkloadConfigs([]WCFilter{AllWCFilter()}); len(cfgs) != 0 {
+		t.Errorf("expected no configs, got %v", cfgs)
+	}
+}
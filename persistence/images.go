@@ -0,0 +1,107 @@
+package persistence
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/golang/glog"
+	"sort"
+	"time"
+)
+
+// image usage table name
+const IMAGES = "images"
+
+// A docker image that anax has pulled or loaded for a deployment. The references are the agreement ids and the
+// microservice instance keys whose deployments use the image, so that images which are no longer used can be
+// found and removed when the node runs short of disk space.
+type ImageRecord struct {
+	Name       string   `json:"name"`       // the image as it is named in the deployment, repository:tag or repository@digest
+	References []string `json:"references"` // agreement ids and microservice instance keys
+	LastUsed   uint64   `json:"last_used"`  // the last time the image was fetched for a deployment
+}
+
+func (i ImageRecord) String() string {
+	return fmt.Sprintf("Name: %v, References: %v, LastUsed: %v", i.Name, i.References, i.LastUsed)
+}
+
+// Record that the deployment of an agreement or microservice instance uses the image.
+func RecordImageUse(db Store, name string, reference string) (*ImageRecord, error) {
+	if name == "" {
+		return nil, errors.New("image name is empty, cannot persist")
+	}
+
+	var record ImageRecord
+	return &record, db.Update(func(tx Tx) error {
+		b, err := tx.CreateBucketIfNotExists([]byte(IMAGES))
+		if err != nil {
+			return err
+		}
+
+		if current := b.Get([]byte(name)); current == nil {
+			record = ImageRecord{Name: name, References: []string{}}
+		} else if err := json.Unmarshal(current, &record); err != nil {
+			return errors.New(fmt.Sprintf("Unable to demarshal image record %v, error %v", string(current), err))
+		}
+
+		found := false
+		for _, ref := range record.References {
+			if ref == reference {
+				found = true
+			}
+		}
+		if !found && reference != "" {
+			record.References = append(record.References, reference)
+		}
+		record.LastUsed = uint64(time.Now().Unix())
+
+		if serial, err := json.Marshal(record); err != nil {
+			return errors.New(fmt.Sprintf("Unable to marshal image record %v, error %v", record, err))
+		} else if err := b.Put([]byte(name), serial); err != nil {
+			return errors.New(fmt.Sprintf("Unable to persist image record %v, error %v", record, err))
+		}
+		glog.V(5).Infof("Recorded use of image %v by %v", name, reference)
+		return nil
+	})
+}
+
+// Return all the image records, least recently used first.
+func FindImageRecords(db Store) ([]ImageRecord, error) {
+	records := make([]ImageRecord, 0)
+
+	readErr := db.View(func(tx Tx) error {
+		if b := tx.Bucket([]byte(IMAGES)); b != nil {
+			return b.ForEach(func(k, v []byte) error {
+				var record ImageRecord
+				if err := json.Unmarshal(v, &record); err != nil {
+					glog.Errorf("Unable to deserialize image record %v, error %v", string(v), err)
+				} else {
+					records = append(records, record)
+				}
+				return nil
+			})
+		}
+		return nil
+	})
+
+	if readErr != nil {
+		return nil, readErr
+	}
+	sort.Stable(imageRecordsByLastUsed(records))
+	return records, nil
+}
+
+type imageRecordsByLastUsed []ImageRecord
+
+func (s imageRecordsByLastUsed) Len() int           { return len(s) }
+func (s imageRecordsByLastUsed) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+func (s imageRecordsByLastUsed) Less(i, j int) bool { return s[i].LastUsed < s[j].LastUsed }
+
+func DeleteImageRecord(db Store, name string) error {
+	return db.Update(func(tx Tx) error {
+		if b := tx.Bucket([]byte(IMAGES)); b != nil {
+			return b.Delete([]byte(name))
+		}
+		return nil
+	})
+}
@@ -0,0 +1,328 @@
+package persistence
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"sync"
+)
+
+// A DomainStore that keeps its records in maps. Agreements and microservice records are copied in and out by value,
+// so callers cannot change a stored record without saving it again. Attributes, also those of workload configs, are
+// kept as they are given. Records are returned in key order, like the buckets of a Store.
+type MemoryDomainStore struct {
+	lock          sync.Mutex
+	agreements    map[string]map[string]EstablishedAgreement // keyed by protocol, then agreement id
+	msdefs        map[string]MicroserviceDefinition
+	msdefSequence uint64
+	msinsts       map[string]MicroserviceInstance
+	attributes    map[string]Attribute
+	wconfigs      map[string]WorkloadConfig
+}
+
+func NewMemoryDomainStore() *MemoryDomainStore {
+	return &MemoryDomainStore{
+		agreements: make(map[string]map[string]EstablishedAgreement),
+		msdefs:     make(map[string]MicroserviceDefinition),
+		msinsts:    make(map[string]MicroserviceInstance),
+		attributes: make(map[string]Attribute),
+		wconfigs:   make(map[string]WorkloadConfig),
+	}
+}
+
+func sortedKeys(keys []string) []string {
+	sort.Strings(keys)
+	return keys
+}
+
+func (s *MemoryDomainStore) FindEstablishedAgreements(protocol string, filters []EAFilter) ([]EstablishedAgreement, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	agreements := make([]EstablishedAgreement, 0)
+	byId := s.agreements[protocol]
+	keys := make([]string, 0, len(byId))
+	for id := range byId {
+		keys = append(keys, id)
+	}
+	for _, id := range sortedKeys(keys) {
+		ag := byId[id]
+		exclude := false
+		for _, filterFn := range filters {
+			if !filterFn(ag) {
+				exclude = true
+			}
+		}
+		if !exclude {
+			agreements = append(agreements, ag)
+		}
+	}
+	return agreements, nil
+}
+
+func (s *MemoryDomainStore) FindEstablishedAgreementsAllProtocols(protocols []string, filters []EAFilter) ([]EstablishedAgreement, error) {
+	agreements := make([]EstablishedAgreement, 0)
+	for _, protocol := range protocols {
+		if ags, err := s.FindEstablishedAgreements(protocol, filters); err != nil {
+			return nil, err
+		} else {
+			agreements = append(agreements, ags...)
+		}
+	}
+	return agreements, nil
+}
+
+func (s *MemoryDomainStore) SaveEstablishedAgreement(ag *EstablishedAgreement) error {
+	if ag.CurrentAgreementId == "" {
+		return errors.New("Agreement id empty, cannot save")
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if _, ok := s.agreements[ag.AgreementProtocol]; !ok {
+		s.agreements[ag.AgreementProtocol] = make(map[string]EstablishedAgreement)
+	}
+	s.agreements[ag.AgreementProtocol][ag.CurrentAgreementId] = *ag
+	return nil
+}
+
+func (s *MemoryDomainStore) DeleteEstablishedAgreement(agreementId string, protocol string) error {
+	if agreementId == "" {
+		return errors.New("Agreement id empty, cannot remove")
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if ag, ok := s.agreements[protocol][agreementId]; !ok || ag.Archived {
+		return fmt.Errorf("Expecting 1 records with id: %v, found none", agreementId)
+	}
+	delete(s.agreements[protocol], agreementId)
+	return nil
+}
+
+func (s *MemoryDomainStore) FindMicroserviceDefs(filters []MSFilter) ([]MicroserviceDefinition, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	msdefs := make([]MicroserviceDefinition, 0)
+	keys := make([]string, 0, len(s.msdefs))
+	for key := range s.msdefs {
+		keys = append(keys, key)
+	}
+	for _, key := range sortedKeys(keys) {
+		msdef := s.msdefs[key]
+		exclude := false
+		for _, filterFn := range filters {
+			if !filterFn(msdef) {
+				exclude = true
+			}
+		}
+		if !exclude {
+			msdefs = append(msdefs, msdef)
+		}
+	}
+	return msdefs, nil
+}
+
+func (s *MemoryDomainStore) FindMicroserviceDefWithKey(key string) (*MicroserviceDefinition, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if msdef, ok := s.msdefs[key]; !ok {
+		return nil, fmt.Errorf("No microservice definition with key %v", key)
+	} else {
+		return &msdef, nil
+	}
+}
+
+func (s *MemoryDomainStore) SaveOrUpdateMicroserviceDef(msdef *MicroserviceDefinition) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.msdefSequence += 1
+	msdef.Id = strconv.FormatUint(s.msdefSequence, 10)
+	s.msdefs[msdef.Id] = *msdef
+	return nil
+}
+
+func (s *MemoryDomainStore) FindMicroserviceInstances(filters []MIFilter) ([]MicroserviceInstance, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	msinsts := make([]MicroserviceInstance, 0)
+	keys := make([]string, 0, len(s.msinsts))
+	for key := range s.msinsts {
+		keys = append(keys, key)
+	}
+	for _, key := range sortedKeys(keys) {
+		msinst := s.msinsts[key]
+		exclude := false
+		for _, filterFn := range filters {
+			if !filterFn(msinst) {
+				exclude = true
+			}
+		}
+		if !exclude {
+			msinsts = append(msinsts, msinst)
+		}
+	}
+	return msinsts, nil
+}
+
+func (s *MemoryDomainStore) FindMicroserviceInstanceWithKey(key string) (*MicroserviceInstance, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if msinst, ok := s.msinsts[key]; !ok {
+		return nil, fmt.Errorf("No microservice instance with key %v", key)
+	} else {
+		return &msinst, nil
+	}
+}
+
+func (s *MemoryDomainStore) SaveMicroserviceInstance(msinst *MicroserviceInstance) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.msinsts[msinst.GetKey()] = *msinst
+	return nil
+}
+
+func (s *MemoryDomainStore) DeleteMicroserviceInstance(key string) (*MicroserviceInstance, error) {
+	if key == "" {
+		return nil, errors.New("key is empty, cannot remove")
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if msinst, ok := s.msinsts[key]; !ok {
+		return nil, nil
+	} else {
+		delete(s.msinsts, key)
+		return &msinst, nil
+	}
+}
+
+func (s *MemoryDomainStore) FindAttributeByKey(id string) (*Attribute, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	attr := s.attributes[id]
+	return &attr, nil
+}
+
+func (s *MemoryDomainStore) FindApplicableAttributes(serviceUrl string) ([]Attribute, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	keys := make([]string, 0, len(s.attributes))
+	for id := range s.attributes {
+		keys = append(keys, id)
+	}
+	allAttrs := make([]Attribute, 0, len(keys))
+	for _, id := range sortedKeys(keys) {
+		allAttrs = append(allAttrs, s.attributes[id])
+	}
+	return applicableAttributes(allAttrs, serviceUrl), nil
+}
+
+func (s *MemoryDomainStore) SaveOrUpdateAttribute(attr Attribute, id string, permitPartialOverwrite bool) (*Attribute, error) {
+	return saveOrUpdateAttribute(s.FindAttributeByKey, s.FindApplicableAttributes,
+		func(id string, attr *Attribute) error {
+			s.lock.Lock()
+			defer s.lock.Unlock()
+			s.attributes[id] = *attr
+			return nil
+		},
+		attr, id, permitPartialOverwrite)
+}
+
+func (s *MemoryDomainStore) DeleteAttribute(id string) (*Attribute, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if attr, ok := s.attributes[id]; !ok {
+		return nil, nil
+	} else {
+		delete(s.attributes, id)
+		return &attr, nil
+	}
+}
+
+func (s *MemoryDomainStore) FindWorkloadConfigs(filters []WCFilter) ([]WorkloadConfig, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	cfgs := make([]WorkloadConfig, 0)
+	keys := make([]string, 0, len(s.wconfigs))
+	for key := range s.wconfigs {
+		keys = append(keys, key)
+	}
+	for _, key := range sortedKeys(keys) {
+		cfg := s.wconfigs[key]
+
+		// The filters work on the serialized form of the config, the same form they are given by the bucket store.
+		var cfgOnly WorkloadConfigOnly
+		if serial, err := json.Marshal(cfg); err != nil {
+			return nil, fmt.Errorf("Failed to serialize workload config: %v. Error: %v", cfg, err)
+		} else if err := json.Unmarshal(serial, &cfgOnly); err != nil {
+			return nil, fmt.Errorf("Failed to deserialize workload config: %v. Error: %v", string(serial), err)
+		}
+
+		exclude := false
+		for _, filterFn := range filters {
+			if !filterFn(cfgOnly) {
+				exclude = true
+			}
+		}
+		if !exclude {
+			cfgs = append(cfgs, cfg)
+		}
+	}
+	return cfgs, nil
+}
+
+func (s *MemoryDomainStore) FindWorkloadConfig(url string, org string, version string) (*WorkloadConfig, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	key := (&WorkloadConfig{WorkloadURL: url, Org: org, VersionExpression: version}).GetKey()
+	if cfg, ok := s.wconfigs[key]; !ok {
+		return nil, nil
+	} else {
+		return &cfg, nil
+	}
+}
+
+func (s *MemoryDomainStore) SaveWorkloadConfig(cfg *WorkloadConfig) error {
+	if cfg.WorkloadURL == "" || cfg.Org == "" || cfg.VersionExpression == "" {
+		return errors.New("WorkloadConfig, workload URL, organization, or version is empty, cannot persist")
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.wconfigs[cfg.GetKey()] = *cfg
+	return nil
+}
+
+func (s *MemoryDomainStore) DeleteWorkloadConfig(url string, org string, version string) error {
+	if url == "" || version == "" {
+		return errors.New("workload URL or version is empty, cannot delete")
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	key := (&WorkloadConfig{WorkloadURL: url, Org: org, VersionExpression: version}).GetKey()
+	if _, ok := s.wconfigs[key]; !ok {
+		return fmt.Errorf("could not find record for %v and %v", url, version)
+	}
+	delete(s.wconfigs, key)
+	return nil
+}
@@ -0,0 +1,193 @@
+package persistence
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// A Store that keeps its buckets in memory. Transactions are serialized. An Update writes to the buckets in place
+// and keeps an undo log of its changes, which is replayed backwards to roll the update back when it fails.
+type MemoryStore struct {
+	lock    sync.RWMutex
+	buckets map[string]*bucketData
+	closed  bool
+}
+
+// The records and the sequence counter of a bucket.
+type bucketData struct {
+	records  map[string][]byte
+	sequence uint64
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		buckets: make(map[string]*bucketData),
+	}
+}
+
+func (s *MemoryStore) View(fn func(Tx) error) error {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	if s.closed {
+		return errors.New("store is closed")
+	}
+	return fn(&memoryTx{store: s, writable: false})
+}
+
+func (s *MemoryStore) Update(fn func(Tx) error) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if s.closed {
+		return errors.New("store is closed")
+	}
+
+	tx := &memoryTx{store: s, writable: true}
+	if err := fn(tx); err != nil {
+		for ix := len(tx.undo) - 1; ix >= 0; ix-- {
+			tx.undo[ix]()
+		}
+		return err
+	}
+	return nil
+}
+
+func (s *MemoryStore) Close() error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.closed = true
+	return nil
+}
+
+type memoryTx struct {
+	store    *MemoryStore
+	writable bool
+	undo     []func()
+}
+
+func (t *memoryTx) Bucket(name []byte) Bucket {
+	if data, ok := t.store.buckets[string(name)]; !ok {
+		return nil
+	} else {
+		return &memoryBucket{data: data, tx: t}
+	}
+}
+
+func (t *memoryTx) CreateBucketIfNotExists(name []byte) (Bucket, error) {
+	if _, ok := t.store.buckets[string(name)]; ok {
+		return t.Bucket(name), nil
+	} else if !t.writable {
+		return nil, errors.New(fmt.Sprintf("unable to create bucket %v in a read-only transaction", string(name)))
+	} else if len(name) == 0 {
+		return nil, errors.New("bucket name is required")
+	}
+
+	key := string(name)
+	t.store.buckets[key] = &bucketData{records: make(map[string][]byte)}
+	t.undo = append(t.undo, func() { delete(t.store.buckets, key) })
+	return t.Bucket(name), nil
+}
+
+func (t *memoryTx) DeleteBucket(name []byte) error {
+	key := string(name)
+	if !t.writable {
+		return errors.New(fmt.Sprintf("unable to delete bucket %v in a read-only transaction", key))
+	}
+	data, ok := t.store.buckets[key]
+	if !ok {
+		return errors.New(fmt.Sprintf("bucket %v not found", key))
+	}
+	delete(t.store.buckets, key)
+	t.undo = append(t.undo, func() { t.store.buckets[key] = data })
+	return nil
+}
+
+func (t *memoryTx) ForEach(fn func(name []byte, b Bucket) error) error {
+	names := make([]string, 0, len(t.store.buckets))
+	for name := range t.store.buckets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		if err := fn([]byte(name), t.Bucket([]byte(name))); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// A bucket as seen by a transaction. Writes are only allowed in a read-write transaction, and each write adds
+// the change that reverses it to the undo log of the transaction. The records themselves are never modified in
+// place, so a record returned by Get stays the same after the transaction.
+type memoryBucket struct {
+	data *bucketData
+	tx   *memoryTx
+}
+
+func (b *memoryBucket) Get(key []byte) []byte {
+	return b.data.records[string(key)]
+}
+
+func (b *memoryBucket) Put(key []byte, value []byte) error {
+	if !b.tx.writable {
+		return errors.New("unable to write a record in a read-only transaction")
+	} else if len(key) == 0 {
+		return errors.New("key is required")
+	}
+
+	v := make([]byte, len(value))
+	copy(v, value)
+	b.logRecord(string(key))
+	b.data.records[string(key)] = v
+	return nil
+}
+
+func (b *memoryBucket) Delete(key []byte) error {
+	if !b.tx.writable {
+		return errors.New("unable to delete a record in a read-only transaction")
+	}
+	b.logRecord(string(key))
+	delete(b.data.records, string(key))
+	return nil
+}
+
+// Add the change that restores the current state of a record to the undo log.
+func (b *memoryBucket) logRecord(key string) {
+	data := b.data
+	if old, ok := data.records[key]; ok {
+		b.tx.undo = append(b.tx.undo, func() { data.records[key] = old })
+	} else {
+		b.tx.undo = append(b.tx.undo, func() { delete(data.records, key) })
+	}
+}
+
+func (b *memoryBucket) ForEach(fn func(k []byte, v []byte) error) error {
+	keys := make([]string, 0, len(b.data.records))
+	for k := range b.data.records {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		if v, ok := b.data.records[k]; ok {
+			if err := fn([]byte(k), v); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (b *memoryBucket) NextSequence() (uint64, error) {
+	if !b.tx.writable {
+		return 0, errors.New("unable to change the sequence in a read-only transaction")
+	}
+	data, old := b.data, b.data.sequence
+	b.tx.undo = append(b.tx.undo, func() { data.sequence = old })
+	b.data.sequence += 1
+	return b.data.sequence, nil
+}
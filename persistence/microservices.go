@@ -4,7 +4,6 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
-	"github.com/boltdb/bolt"
 	"github.com/golang/glog"
 	"github.com/open-horizon/anax/cutil"
 	"github.com/satori/go.uuid"
@@ -160,8 +159,8 @@ func (w MicroserviceDefinition) ShortString() string {
 }
 
 // save the microservice record. update if it already exists in the db
-func SaveOrUpdateMicroserviceDef(db *bolt.DB, msdef *MicroserviceDefinition) error {
-	writeErr := db.Update(func(tx *bolt.Tx) error {
+func SaveOrUpdateMicroserviceDef(db Store, msdef *MicroserviceDefinition) error {
+	writeErr := db.Update(func(tx Tx) error {
 		if bucket, err := tx.CreateBucketIfNotExists([]byte(MICROSERVICE_DEFINITIONS)); err != nil {
 			return err
 		} else if nextKey, err := bucket.NextSequence(); err != nil {
@@ -184,17 +183,17 @@ func SaveOrUpdateMicroserviceDef(db *bolt.DB, msdef *MicroserviceDefinition) err
 }
 
 // find the unarchived microservice definitions for the given url
-func FindUnarchivedMicroserviceDefs(db *bolt.DB, url string) ([]MicroserviceDefinition, error) {
+func FindUnarchivedMicroserviceDefs(db Store, url string) ([]MicroserviceDefinition, error) {
 	return FindMicroserviceDefs(db, []MSFilter{UnarchivedMSFilter(), UrlMSFilter(url)})
 }
 
 // find the microservice definition from the db
-func FindMicroserviceDefWithKey(db *bolt.DB, key string) (*MicroserviceDefinition, error) {
+func FindMicroserviceDefWithKey(db Store, key string) (*MicroserviceDefinition, error) {
 	var pms *MicroserviceDefinition
 	pms = nil
 
 	// fetch microservice definitions
-	readErr := db.View(func(tx *bolt.Tx) error {
+	readErr := db.View(func(tx Tx) error {
 
 		if b := tx.Bucket([]byte(MICROSERVICE_DEFINITIONS)); b != nil {
 			v := b.Get([]byte(key))
@@ -265,11 +264,11 @@ func UrlMSFilter(spec_url string) MSFilter {
 }
 
 // find the microservice instance from the db
-func FindMicroserviceDefs(db *bolt.DB, filters []MSFilter) ([]MicroserviceDefinition, error) {
+func FindMicroserviceDefs(db Store, filters []MSFilter) ([]MicroserviceDefinition, error) {
 	ms_defs := make([]MicroserviceDefinition, 0)
 
 	// fetch contracts
-	readErr := db.View(func(tx *bolt.Tx) error {
+	readErr := db.View(func(tx Tx) error {
 
 		if b := tx.Bucket([]byte(MICROSERVICE_DEFINITIONS)); b != nil {
 			b.ForEach(func(k, v []byte) error {
@@ -305,7 +304,7 @@ func FindMicroserviceDefs(db *bolt.DB, filters []MSFilter) ([]MicroserviceDefini
 }
 
 // set the msdef to archived
-func MsDefArchived(db *bolt.DB, key string) (*MicroserviceDefinition, error) {
+func MsDefArchived(db Store, key string) (*MicroserviceDefinition, error) {
 	return microserviceDefStateUpdate(db, key, func(c MicroserviceDefinition) *MicroserviceDefinition {
 		c.Archived = true
 		return &c
@@ -313,49 +312,49 @@ func MsDefArchived(db *bolt.DB, key string) (*MicroserviceDefinition, error) {
 }
 
 // set the msdef to un-archived
-func MsDefUnarchived(db *bolt.DB, key string) (*MicroserviceDefinition, error) {
+func MsDefUnarchived(db Store, key string) (*MicroserviceDefinition, error) {
 	return microserviceDefStateUpdate(db, key, func(c MicroserviceDefinition) *MicroserviceDefinition {
 		c.Archived = false
 		return &c
 	})
 }
 
-func MSDefUpgradeStarted(db *bolt.DB, key string) (*MicroserviceDefinition, error) {
+func MSDefUpgradeStarted(db Store, key string) (*MicroserviceDefinition, error) {
 	return microserviceDefStateUpdate(db, key, func(c MicroserviceDefinition) *MicroserviceDefinition {
 		c.UpgradeStartTime = uint64(time.Now().Unix())
 		return &c
 	})
 }
 
-func MSDefUpgradeMsUnregistered(db *bolt.DB, key string) (*MicroserviceDefinition, error) {
+func MSDefUpgradeMsUnregistered(db Store, key string) (*MicroserviceDefinition, error) {
 	return microserviceDefStateUpdate(db, key, func(c MicroserviceDefinition) *MicroserviceDefinition {
 		c.UpgradeMsUnregisteredTime = uint64(time.Now().Unix())
 		return &c
 	})
 }
 
-func MsDefUpgradeAgreementsCleared(db *bolt.DB, key string) (*MicroserviceDefinition, error) {
+func MsDefUpgradeAgreementsCleared(db Store, key string) (*MicroserviceDefinition, error) {
 	return microserviceDefStateUpdate(db, key, func(c MicroserviceDefinition) *MicroserviceDefinition {
 		c.UpgradeAgreementsClearedTime = uint64(time.Now().Unix())
 		return &c
 	})
 }
 
-func MSDefUpgradeExecutionStarted(db *bolt.DB, key string) (*MicroserviceDefinition, error) {
+func MSDefUpgradeExecutionStarted(db Store, key string) (*MicroserviceDefinition, error) {
 	return microserviceDefStateUpdate(db, key, func(c MicroserviceDefinition) *MicroserviceDefinition {
 		c.UpgradeExecutionStartTime = uint64(time.Now().Unix())
 		return &c
 	})
 }
 
-func MSDefUpgradeMsReregistered(db *bolt.DB, key string) (*MicroserviceDefinition, error) {
+func MSDefUpgradeMsReregistered(db Store, key string) (*MicroserviceDefinition, error) {
 	return microserviceDefStateUpdate(db, key, func(c MicroserviceDefinition) *MicroserviceDefinition {
 		c.UpgradeMsReregisteredTime = uint64(time.Now().Unix())
 		return &c
 	})
 }
 
-func MSDefUpgradeFailed(db *bolt.DB, key string, reason uint64, reasonString string) (*MicroserviceDefinition, error) {
+func MSDefUpgradeFailed(db Store, key string, reason uint64, reasonString string) (*MicroserviceDefinition, error) {
 	return microserviceDefStateUpdate(db, key, func(c MicroserviceDefinition) *MicroserviceDefinition {
 		c.UpgradeFailedTime = uint64(time.Now().Unix())
 		c.UngradeFailureReason = reason
@@ -364,14 +363,14 @@ func MSDefUpgradeFailed(db *bolt.DB, key string, reason uint64, reasonString str
 	})
 }
 
-func MSDefUpgradeNewMsId(db *bolt.DB, key string, new_id string) (*MicroserviceDefinition, error) {
+func MSDefUpgradeNewMsId(db Store, key string, new_id string) (*MicroserviceDefinition, error) {
 	return microserviceDefStateUpdate(db, key, func(c MicroserviceDefinition) *MicroserviceDefinition {
 		c.UpgradeNewMsId = new_id
 		return &c
 	})
 }
 
-func MSDefNewUpgradeVersionRange(db *bolt.DB, key string, version_range string) (*MicroserviceDefinition, error) {
+func MSDefNewUpgradeVersionRange(db Store, key string, version_range string) (*MicroserviceDefinition, error) {
 	return microserviceDefStateUpdate(db, key, func(c MicroserviceDefinition) *MicroserviceDefinition {
 		c.UpgradeVersionRange = version_range
 		return &c
@@ -379,7 +378,7 @@ func MSDefNewUpgradeVersionRange(db *bolt.DB, key string, version_range string)
 }
 
 // update the micorserive definition
-func microserviceDefStateUpdate(db *bolt.DB, key string, fn func(MicroserviceDefinition) *MicroserviceDefinition) (*MicroserviceDefinition, error) {
+func microserviceDefStateUpdate(db Store, key string, fn func(MicroserviceDefinition) *MicroserviceDefinition) (*MicroserviceDefinition, error) {
 
 	if ms, err := FindMicroserviceDefWithKey(db, key); err != nil {
 		return nil, err
@@ -393,8 +392,8 @@ func microserviceDefStateUpdate(db *bolt.DB, key string, fn func(MicroserviceDef
 }
 
 // does whole-member replacements of values that are legal to change
-func persistUpdatedMicroserviceDef(db *bolt.DB, key string, update *MicroserviceDefinition) error {
-	return db.Update(func(tx *bolt.Tx) error {
+func persistUpdatedMicroserviceDef(db Store, key string, update *MicroserviceDefinition) error {
+	return db.Update(func(tx Tx) error {
 		if b, err := tx.CreateBucketIfNotExists([]byte(MICROSERVICE_DEFINITIONS)); err != nil {
 			return err
 		} else {
@@ -502,7 +501,7 @@ func (m MicroserviceInstance) GetKey() string {
 
 // Check if this microservice instance has workload or not.
 // If it does not have workload, then there is no need to do the execution
-func (m MicroserviceInstance) HasWorkload(db *bolt.DB) (bool, error) {
+func (m MicroserviceInstance) HasWorkload(db Store) (bool, error) {
 	if msdef, err := FindMicroserviceDefWithKey(db, m.MicroserviceDefId); err != nil {
 		return false, err
 	} else if msdef.Workloads != nil && len(msdef.Workloads) > 0 {
@@ -513,7 +512,7 @@ func (m MicroserviceInstance) HasWorkload(db *bolt.DB) (bool, error) {
 }
 
 // create a new microservice instance and save it to db.
-func NewMicroserviceInstance(db *bolt.DB, ref_url string, version string, msdef_id string) (*MicroserviceInstance, error) {
+func NewMicroserviceInstance(db Store, ref_url string, version string, msdef_id string) (*MicroserviceInstance, error) {
 
 	if ref_url == "" || version == "" {
 		return nil, errors.New("Microservice ref url id or version is empty, cannot persist")
@@ -542,7 +541,7 @@ func NewMicroserviceInstance(db *bolt.DB, ref_url string, version string, msdef_
 		MicroserviceDefId:    msdef_id,
 	}
 
-	return new_inst, db.Update(func(tx *bolt.Tx) error {
+	return new_inst, db.Update(func(tx Tx) error {
 		if b, err := tx.CreateBucketIfNotExists([]byte(MICROSERVICE_INSTANCES)); err != nil {
 			return err
 		} else if bytes, err := json.Marshal(new_inst); err != nil {
@@ -556,12 +555,12 @@ func NewMicroserviceInstance(db *bolt.DB, ref_url string, version string, msdef_
 }
 
 // find the microservice instance from the db
-func FindMicroserviceInstance(db *bolt.DB, url string, version string, instance_id string) (*MicroserviceInstance, error) {
+func FindMicroserviceInstance(db Store, url string, version string, instance_id string) (*MicroserviceInstance, error) {
 	var pms *MicroserviceInstance
 	pms = nil
 
 	// fetch microservice instances
-	readErr := db.View(func(tx *bolt.Tx) error {
+	readErr := db.View(func(tx Tx) error {
 
 		if b := tx.Bucket([]byte(MICROSERVICE_INSTANCES)); b != nil {
 			b.ForEach(func(k, v []byte) error {
@@ -589,12 +588,12 @@ func FindMicroserviceInstance(db *bolt.DB, url string, version string, instance_
 }
 
 // find the microservice instance from the db
-func FindMicroserviceInstanceWithKey(db *bolt.DB, key string) (*MicroserviceInstance, error) {
+func FindMicroserviceInstanceWithKey(db Store, key string) (*MicroserviceInstance, error) {
 	var pms *MicroserviceInstance
 	pms = nil
 
 	// fetch microservice instances
-	readErr := db.View(func(tx *bolt.Tx) error {
+	readErr := db.View(func(tx Tx) error {
 
 		if b := tx.Bucket([]byte(MICROSERVICE_INSTANCES)); b != nil {
 			v := b.Get([]byte(key))
@@ -648,11 +647,11 @@ func NotCleanedUpMIFilter() MIFilter {
 }
 
 // find the microservice instance from the db
-func FindMicroserviceInstances(db *bolt.DB, filters []MIFilter) ([]MicroserviceInstance, error) {
+func FindMicroserviceInstances(db Store, filters []MIFilter) ([]MicroserviceInstance, error) {
 	ms_instances := make([]MicroserviceInstance, 0)
 
 	// fetch contracts
-	readErr := db.View(func(tx *bolt.Tx) error {
+	readErr := db.View(func(tx Tx) error {
 
 		if b := tx.Bucket([]byte(MICROSERVICE_INSTANCES)); b != nil {
 			b.ForEach(func(k, v []byte) error {
@@ -688,7 +687,7 @@ func FindMicroserviceInstances(db *bolt.DB, filters []MIFilter) ([]MicroserviceI
 }
 
 // set microservice instance state to execution started or failed
-func UpdateMSInstanceExecutionState(db *bolt.DB, key string, started bool, failure_code uint, failure_desc string) (*MicroserviceInstance, error) {
+func UpdateMSInstanceExecutionState(db Store, key string, started bool, failure_code uint, failure_desc string) (*MicroserviceInstance, error) {
 	if started {
 		return microserviceInstanceStateUpdate(db, key, func(c MicroserviceInstance) *MicroserviceInstance {
 			c.ExecutionStartTime = uint64(time.Now().Unix())
@@ -705,7 +704,7 @@ func UpdateMSInstanceExecutionState(db *bolt.DB, key string, started bool, failu
 }
 
 // add or delete an associated agreement id to/from the microservice instance in the db
-func UpdateMSInstanceAssociatedAgreements(db *bolt.DB, key string, add bool, agreement_id string) (*MicroserviceInstance, error) {
+func UpdateMSInstanceAssociatedAgreements(db Store, key string, add bool, agreement_id string) (*MicroserviceInstance, error) {
 	return microserviceInstanceStateUpdate(db, key, func(c MicroserviceInstance) *MicroserviceInstance {
 		if c.AssociatedAgreements == nil {
 			c.AssociatedAgreements = make([]string, 0)
@@ -729,14 +728,14 @@ func UpdateMSInstanceAssociatedAgreements(db *bolt.DB, key string, add bool, agr
 	})
 }
 
-func ArchiveMicroserviceInstance(db *bolt.DB, key string) (*MicroserviceInstance, error) {
+func ArchiveMicroserviceInstance(db Store, key string) (*MicroserviceInstance, error) {
 	return microserviceInstanceStateUpdate(db, key, func(c MicroserviceInstance) *MicroserviceInstance {
 		c.Archived = true
 		return &c
 	})
 }
 
-func MicroserviceInstanceCleanupStarted(db *bolt.DB, key string) (*MicroserviceInstance, error) {
+func MicroserviceInstanceCleanupStarted(db Store, key string) (*MicroserviceInstance, error) {
 	return microserviceInstanceStateUpdate(db, key, func(c MicroserviceInstance) *MicroserviceInstance {
 		c.CleanupStartTime = uint64(time.Now().Unix())
 		return &c
@@ -744,7 +743,7 @@ func MicroserviceInstanceCleanupStarted(db *bolt.DB, key string) (*MicroserviceI
 }
 
 // update the micorserive instance
-func microserviceInstanceStateUpdate(db *bolt.DB, key string, fn func(MicroserviceInstance) *MicroserviceInstance) (*MicroserviceInstance, error) {
+func microserviceInstanceStateUpdate(db Store, key string, fn func(MicroserviceInstance) *MicroserviceInstance) (*MicroserviceInstance, error) {
 
 	if ms, err := FindMicroserviceInstanceWithKey(db, key); err != nil {
 		return nil, err
@@ -758,8 +757,8 @@ func microserviceInstanceStateUpdate(db *bolt.DB, key string, fn func(Microservi
 }
 
 // does whole-member replacements of values that are legal to change
-func persistUpdatedMicroserviceInstance(db *bolt.DB, key string, update *MicroserviceInstance) error {
-	return db.Update(func(tx *bolt.Tx) error {
+func persistUpdatedMicroserviceInstance(db Store, key string, update *MicroserviceInstance) error {
+	return db.Update(func(tx Tx) error {
 		if b, err := tx.CreateBucketIfNotExists([]byte(MICROSERVICE_INSTANCES)); err != nil {
 			return err
 		} else {
@@ -810,7 +809,7 @@ func persistUpdatedMicroserviceInstance(db *bolt.DB, key string, update *Microse
 }
 
 // delete associated agreement id from all the microservice instances
-func DeleteAsscAgmtsFromMSInstances(db *bolt.DB, agreement_id string) error {
+func DeleteAsscAgmtsFromMSInstances(db Store, agreement_id string) error {
 	if ms_instances, err := FindMicroserviceInstances(db, []MIFilter{UnarchivedMIFilter()}); err != nil {
 		return fmt.Errorf("Error retrieving all microservice instances from database, error: %v", err)
 	} else if ms_instances != nil {
@@ -831,7 +830,7 @@ func DeleteAsscAgmtsFromMSInstances(db *bolt.DB, agreement_id string) error {
 }
 
 // delete a microservice instance from db. It will NOT return error if it does not exist in the db
-func DeleteMicroserviceInstance(db *bolt.DB, key string) (*MicroserviceInstance, error) {
+func DeleteMicroserviceInstance(db Store, key string) (*MicroserviceInstance, error) {
 
 	if key == "" {
 		return nil, errors.New("key is empty, cannot remove")
@@ -841,7 +840,7 @@ func DeleteMicroserviceInstance(db *bolt.DB, key string) (*MicroserviceInstance,
 		} else if ms == nil {
 			return nil, nil
 		} else {
-			return ms, db.Update(func(tx *bolt.Tx) error {
+			return ms, db.Update(func(tx Tx) error {
 
 				if b, err := tx.CreateBucketIfNotExists([]byte(MICROSERVICE_INSTANCES)); err != nil {
 					return err
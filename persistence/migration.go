@@ -0,0 +1,199 @@
+package persistence
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/golang/glog"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// The records in the anax and agbot databases are JSON serializations of structs that grow over time. The
+// schema version of a database is recorded in its metadata bucket. When anax starts, the migrations that are
+// registered for versions newer than the recorded version are run, in version order, each in its own
+// transaction that also records the new version. Anax refuses to start on a database with a schema version
+// that is newer than the newest migration it knows about.
+
+const METADATA = "metadata"
+const SCHEMA_VERSION = "schema_version"
+
+type Migration struct {
+	Version     int               // The schema version that the migration upgrades the database to
+	Description string            // What the migration does
+	Migrate     func(tx Tx) error // Upgrades the records of the database in place
+}
+
+func (m Migration) String() string {
+	return fmt.Sprintf("Version: %v, Description: %v", m.Version, m.Description)
+}
+
+// The migrations of one database, e.g. the anax database or the agbot database.
+type Migrations struct {
+	name       string
+	migrations []Migration
+}
+
+func NewMigrations(name string) *Migrations {
+	return &Migrations{
+		name:       name,
+		migrations: make([]Migration, 0, 5),
+	}
+}
+
+// Register a migration. Migrations are usually registered from an init function of the package that owns the
+// records being migrated.
+func (m *Migrations) Register(version int, description string, fn func(tx Tx) error) {
+	m.migrations = append(m.migrations, Migration{Version: version, Description: description, Migrate: fn})
+	sort.Sort(migrationsByVersion(m.migrations))
+}
+
+// The schema version of the database that this binary writes.
+func (m *Migrations) Latest() int {
+	if len(m.migrations) == 0 {
+		return 0
+	}
+	return m.migrations[len(m.migrations)-1].Version
+}
+
+// Bring the schema of the database up to the latest version. A database that has no buckets yet is new, it is
+// stamped with the latest version. Otherwise, a store that can be backed up is backed up before the first
+// migration is run.
+func (m *Migrations) Run(db Store) error {
+
+	for ix := 1; ix < len(m.migrations); ix++ {
+		if m.migrations[ix].Version == m.migrations[ix-1].Version {
+			return errors.New(fmt.Sprintf("%v database has 2 migrations to schema version %v", m.name, m.migrations[ix].Version))
+		}
+	}
+
+	current, err := SchemaVersion(db)
+	if err != nil {
+		return err
+	} else if current > m.Latest() {
+		return errors.New(fmt.Sprintf("%v database has schema version %v, which is newer than schema version %v supported by this version of anax", m.name, current, m.Latest()))
+	} else if current == m.Latest() {
+		glog.V(3).Infof("%v database is at schema version %v", m.name, current)
+		return nil
+	}
+
+	empty := true
+	if err := db.View(func(tx Tx) error {
+		return tx.ForEach(func(name []byte, b Bucket) error {
+			empty = false
+			return nil
+		})
+	}); err != nil {
+		return err
+	} else if empty {
+		glog.V(3).Infof("%v database is new, setting schema version %v", m.name, m.Latest())
+		return db.Update(func(tx Tx) error {
+			return setSchemaVersion(tx, m.Latest())
+		})
+	}
+
+	if b, ok := db.(interface {
+		Backup(suffix string) (string, error)
+	}); ok {
+		if name, err := b.Backup(fmt.Sprintf("v%v.%v", current, time.Now().Unix())); err != nil {
+			return errors.New(fmt.Sprintf("unable to back up %v database before migrating it, error: %v", m.name, err))
+		} else {
+			glog.Infof("Backed up %v database at schema version %v to %v", m.name, current, name)
+		}
+	}
+
+	for _, migration := range m.migrations {
+		if migration.Version <= current {
+			continue
+		}
+
+		glog.Infof("Migrating %v database to schema version %v: %v", m.name, migration.Version, migration.Description)
+		if err := db.Update(func(tx Tx) error {
+			if err := migration.Migrate(tx); err != nil {
+				return err
+			}
+			return setSchemaVersion(tx, migration.Version)
+		}); err != nil {
+			return errors.New(fmt.Sprintf("unable to migrate %v database to schema version %v, error: %v", m.name, migration.Version, err))
+		}
+	}
+	return nil
+}
+
+// Returns the schema version recorded in the database. A database without a recorded version is at version 0.
+func SchemaVersion(db Store) (int, error) {
+	version := 0
+	readErr := db.View(func(tx Tx) error {
+		if b := tx.Bucket([]byte(METADATA)); b == nil {
+			return nil
+		} else if v := b.Get([]byte(SCHEMA_VERSION)); v == nil {
+			return nil
+		} else if i, err := strconv.Atoi(string(v)); err != nil {
+			return errors.New(fmt.Sprintf("schema version %v is not a number, error: %v", string(v), err))
+		} else {
+			version = i
+			return nil
+		}
+	})
+	return version, readErr
+}
+
+func setSchemaVersion(tx Tx, version int) error {
+	if b, err := tx.CreateBucketIfNotExists([]byte(METADATA)); err != nil {
+		return err
+	} else {
+		return b.Put([]byte(SCHEMA_VERSION), []byte(strconv.Itoa(version)))
+	}
+}
+
+// Upgrade each of the JSON records in a bucket in place. The upgrade function is given a generic form of the record
+// that it can change, the changed record is written back. A missing bucket has nothing to upgrade.
+func UpgradeRecords(tx Tx, bucket string, fn func(key string, record map[string]interface{}) error) error {
+	b := tx.Bucket([]byte(bucket))
+	if b == nil {
+		return nil
+	}
+
+	upgraded := make(map[string][]byte)
+	if err := b.ForEach(func(k, v []byte) error {
+		// Numbers are kept as they are written, instead of being converted to float64.
+		record := make(map[string]interface{})
+		decoder := json.NewDecoder(bytes.NewReader(v))
+		decoder.UseNumber()
+		if err := decoder.Decode(&record); err != nil {
+			return errors.New(fmt.Sprintf("unable to demarshal record %v in bucket %v, error: %v", string(k), bucket, err))
+		} else if err := fn(string(k), record); err != nil {
+			return err
+		} else if serial, err := json.Marshal(record); err != nil {
+			return errors.New(fmt.Sprintf("unable to serialize record %v in bucket %v, error: %v", string(k), bucket, err))
+		} else {
+			upgraded[string(k)] = serial
+			return nil
+		}
+	}); err != nil {
+		return err
+	}
+
+	for k, v := range upgraded {
+		if err := b.Put([]byte(k), v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// The migrations of the anax database.
+var EdgeMigrations = NewMigrations("anax")
+
+func init() {
+	// Version 1 is the schema of the anax database when schema versions were first recorded.
+	EdgeMigrations.Register(1, "record the schema version", func(tx Tx) error { return nil })
+}
+
+type migrationsByVersion []Migration
+
+func (m migrationsByVersion) Len() int           { return len(m) }
+func (m migrationsByVersion) Swap(i, j int)      { m[i], m[j] = m[j], m[i] }
+func (m migrationsByVersion) Less(i, j int) bool { return m[i].Version < m[j].Version }
@@ -0,0 +1,110 @@
+// +build unit
+
+package persistence
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+)
+
+func testMigrations(ran *[]int) *Migrations {
+	m := NewMigrations("test")
+	m.Register(2, "rename the name field", func(tx Tx) error {
+		*ran = append(*ran, 2)
+		return UpgradeRecords(tx, "records", func(key string, record map[string]interface{}) error {
+			record["full_name"] = record["name"]
+			delete(record, "name")
+			return nil
+		})
+	})
+	m.Register(1, "first", func(tx Tx) error {
+		*ran = append(*ran, 1)
+		return nil
+	})
+	return m
+}
+
+func Test_Migrations_new_db(t *testing.T) {
+	db := NewMemoryStore()
+	ran := make([]int, 0)
+
+	if err := testMigrations(&ran).Run(db); err != nil {
+		t.Errorf("unexpected error %v", err)
+	} else if len(ran) != 0 {
+		t.Errorf("expected no migrations to run on a new database, ran %v", ran)
+	} else if v, err := SchemaVersion(db); err != nil || v != 2 {
+		t.Errorf("expected schema version 2, got %v %v", v, err)
+	}
+}
+
+func Test_Migrations_upgrade(t *testing.T) {
+	db := NewMemoryStore()
+	db.Update(func(tx Tx) error {
+		b, _ := tx.CreateBucketIfNotExists([]byte("records"))
+		return b.Put([]byte("r1"), []byte(`{"name":"n1","time":1510000000123456789}`))
+	})
+
+	ran := make([]int, 0)
+	if err := testMigrations(&ran).Run(db); err != nil {
+		t.Errorf("unexpected error %v", err)
+	} else if len(ran) != 2 || ran[0] != 1 || ran[1] != 2 {
+		t.Errorf("expected migrations 1 and 2 to run in order, ran %v", ran)
+	} else if v, _ := SchemaVersion(db); v != 2 {
+		t.Errorf("expected schema version 2, got %v", v)
+	}
+
+	db.View(func(tx Tx) error {
+		var record struct {
+			FullName string `json:"full_name"`
+			Name     string `json:"name"`
+			Time     uint64 `json:"time"`
+		}
+		if err := json.Unmarshal(tx.Bucket([]byte("records")).Get([]byte("r1")), &record); err != nil {
+			t.Errorf("unexpected error %v", err)
+		} else if record.FullName != "n1" || record.Name != "" || record.Time != 1510000000123456789 {
+			t.Errorf("record was not upgraded correctly: %v", record)
+		}
+		return nil
+	})
+
+	// Running the migrations again does nothing.
+	ran = ran[:0]
+	if err := testMigrations(&ran).Run(db); err != nil || len(ran) != 0 {
+		t.Errorf("expected nothing to run, ran %v, error %v", ran, err)
+	}
+}
+
+func Test_Migrations_failure(t *testing.T) {
+	db := NewMemoryStore()
+	db.Update(func(tx Tx) error {
+		_, err := tx.CreateBucketIfNotExists([]byte("records"))
+		return err
+	})
+
+	ran := make([]int, 0)
+	m := testMigrations(&ran)
+	m.Register(3, "fails", func(tx Tx) error { return errors.New("failed") })
+
+	if err := m.Run(db); err == nil {
+		t.Errorf("expected the migration to fail")
+	} else if v, _ := SchemaVersion(db); v != 2 {
+		t.Errorf("expected the database to stay at schema version 2, got %v", v)
+	}
+}
+
+func Test_Migrations_newer_db(t *testing.T) {
+	db := NewMemoryStore()
+	db.Update(func(tx Tx) error { return setSchemaVersion(tx, 5) })
+
+	ran := make([]int, 0)
+	if err := testMigrations(&ran).Run(db); err == nil {
+		t.Errorf("expected a database with a newer schema to be refused")
+	}
+
+	m := testMigrations(&ran)
+	m.Register(2, "duplicate", func(tx Tx) error { return nil })
+	if err := m.Run(NewMemoryStore()); err == nil {
+		t.Errorf("expected duplicate schema versions to be refused")
+	}
+}
@@ -4,7 +4,6 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
-	"github.com/boltdb/bolt"
 	docker "github.com/fsouza/go-dockerclient"
 	"github.com/golang/glog"
 	"github.com/open-horizon/anax/cutil"
@@ -49,6 +48,7 @@ type EstablishedAgreement struct {
 	Archived                        bool                     `json:"archived"`
 	CurrentAgreementId              string                   `json:"current_agreement_id"`
 	ConsumerId                      string                   `json:"consumer_id"`
+	ConsumerChangedTime             uint64                   `json:"consumer_changed_time,omitempty"` // the time the agreement was last handed off to another consumer
 	CounterPartyAddress             string                   `json:"counterparty_address"`
 	AgreementCreationTime           uint64                   `json:"agreement_creation_time"`
 	AgreementAcceptedTime           uint64                   `json:"agreement_accepted_time"`
@@ -81,6 +81,7 @@ func (c EstablishedAgreement) String() string {
 		"Archived: %v, "+
 		"CurrentAgreementId: %v, "+
 		"ConsumerId: %v, "+
+		"ConsumerChangedTime: %v, "+
 		"CounterPartyAddress: %v, "+
 		"CurrentDeployment (service names): %v, "+
 		"Proposal Signature: %v, "+
@@ -102,7 +103,7 @@ func (c EstablishedAgreement) String() string {
 		"BlockchainType: %v, "+
 		"BlockchainName: %v, "+
 		"BlockchainOrg: %v",
-		c.Name, c.SensorUrl, c.Archived, c.CurrentAgreementId, c.ConsumerId, c.CounterPartyAddress, ServiceConfigNames(&c.CurrentDeployment),
+		c.Name, c.SensorUrl, c.Archived, c.CurrentAgreementId, c.ConsumerId, c.ConsumerChangedTime, c.CounterPartyAddress, ServiceConfigNames(&c.CurrentDeployment),
 		c.ProposalSig,
 		c.AgreementCreationTime, c.AgreementExecutionStartTime, c.AgreementAcceptedTime, c.AgreementBCUpdateAckTime, c.AgreementFinalizedTime,
 		c.AgreementDataReceivedTime, c.AgreementTerminatedTime, c.AgreementForceTerminatedTime, c.TerminatedReason, c.TerminatedDescription,
@@ -115,6 +116,39 @@ func (c EstablishedAgreement) String() string {
 type ServiceConfig struct {
 	Config     docker.Config     `json:"config"`
 	HostConfig docker.HostConfig `json:"host_config"`
+	Limits     *EnforcedLimits   `json:"limits,omitempty"` // the resource limits applied to the container, if any
+}
+
+// The resource limits agreed to in the terms and conditions of an agreement. Zero means no limit.
+type ResourceLimits struct {
+	MemoryMB            int64 `json:"memory_mb,omitempty"`
+	CPUs                int   `json:"cpus,omitempty"`
+	NetworkUploadKbps   int   `json:"network_upload_kbps,omitempty"`
+	NetworkDownloadKbps int   `json:"network_download_kbps,omitempty"`
+}
+
+func (r ResourceLimits) String() string {
+	return fmt.Sprintf("MemoryMB: %v, CPUs: %v, NetworkUploadKbps: %v, NetworkDownloadKbps: %v", r.MemoryMB, r.CPUs, r.NetworkUploadKbps, r.NetworkDownloadKbps)
+}
+
+func (r ResourceLimits) IsEmpty() bool {
+	return r.MemoryMB == 0 && r.CPUs == 0 && r.NetworkUploadKbps == 0 && r.NetworkDownloadKbps == 0
+}
+
+// The resource limits that were actually applied to a service container. The memory and CPU limits are docker settings,
+// the network limits are traffic shaping rules on the agreement bridge device.
+type EnforcedLimits struct {
+	Memory              int64  `json:"memory,omitempty"`                // bytes
+	CPUPeriod           int64  `json:"cpu_period,omitempty"`            // microseconds
+	CPUQuota            int64  `json:"cpu_quota,omitempty"`             // microseconds of CPU time in each period
+	CPUShares           int64  `json:"cpu_shares,omitempty"`            // relative weight
+	NetworkUploadKbps   int    `json:"network_upload_kbps,omitempty"`   // traffic from the containers
+	NetworkDownloadKbps int    `json:"network_download_kbps,omitempty"` // traffic to the containers
+	NetworkDevice       string `json:"network_device,omitempty"`        // the bridge device that is shaped
+}
+
+func (e EnforcedLimits) String() string {
+	return fmt.Sprintf("Memory: %v, CPUPeriod: %v, CPUQuota: %v, CPUShares: %v, NetworkUploadKbps: %v, NetworkDownloadKbps: %v, NetworkDevice: %v", e.Memory, e.CPUPeriod, e.CPUQuota, e.CPUShares, e.NetworkUploadKbps, e.NetworkDownloadKbps, e.NetworkDevice)
 }
 
 func ServiceConfigNames(serviceConfigs *map[string]ServiceConfig) []string {
@@ -130,10 +164,10 @@ func ServiceConfigNames(serviceConfigs *map[string]ServiceConfig) []string {
 }
 
 func (c ServiceConfig) String() string {
-	return fmt.Sprintf("Config: %v, HostConfig: %v", c.Config, c.HostConfig)
+	return fmt.Sprintf("Config: %v, HostConfig: %v, Limits: %v", c.Config, c.HostConfig, c.Limits)
 }
 
-func NewEstablishedAgreement(db *bolt.DB, name string, agreementId string, consumerId string, proposal string, protocol string, protocolVersion int, sensorUrl []string, signature string, address string, bcType string, bcName string, bcOrg string, wi *WorkloadInfo) (*EstablishedAgreement, error) {
+func NewEstablishedAgreement(db Store, name string, agreementId string, consumerId string, proposal string, protocol string, protocolVersion int, sensorUrl []string, signature string, address string, bcType string, bcName string, bcOrg string, wi *WorkloadInfo) (*EstablishedAgreement, error) {
 
 	if name == "" || agreementId == "" || consumerId == "" || proposal == "" || protocol == "" || protocolVersion == 0 {
 		return nil, errors.New("Agreement id, consumer id, proposal, protocol, or protocol version are empty, cannot persist")
@@ -180,7 +214,7 @@ func NewEstablishedAgreement(db *bolt.DB, name string, agreementId string, consu
 		RunningWorkload:                 *wi,
 	}
 
-	return newAg, db.Update(func(tx *bolt.Tx) error {
+	return newAg, db.Update(func(tx Tx) error {
 
 		if b, err := tx.CreateBucketIfNotExists([]byte(E_AGREEMENTS + "-" + protocol)); err != nil {
 			return err
@@ -195,7 +229,7 @@ func NewEstablishedAgreement(db *bolt.DB, name string, agreementId string, consu
 	})
 }
 
-func ArchiveEstablishedAgreement(db *bolt.DB, agreementId string, protocol string) (*EstablishedAgreement, error) {
+func ArchiveEstablishedAgreement(db Store, agreementId string, protocol string) (*EstablishedAgreement, error) {
 	return agreementStateUpdate(db, agreementId, protocol, func(c EstablishedAgreement) *EstablishedAgreement {
 		c.Archived = true
 		c.CurrentDeployment = map[string]ServiceConfig{}
@@ -203,8 +237,17 @@ func ArchiveEstablishedAgreement(db *bolt.DB, agreementId string, protocol strin
 	})
 }
 
+// set the consumer of the agreement to the agbot that the agreement was handed off to
+func AgreementStateConsumerChanged(db Store, dbAgreementId string, protocol string, consumerId string) (*EstablishedAgreement, error) {
+	return agreementStateUpdate(db, dbAgreementId, protocol, func(c EstablishedAgreement) *EstablishedAgreement {
+		c.ConsumerId = consumerId
+		c.ConsumerChangedTime = uint64(time.Now().Unix())
+		return &c
+	})
+}
+
 // set agreement state to execution started
-func AgreementStateExecutionStarted(db *bolt.DB, dbAgreementId string, protocol string, deployment *map[string]ServiceConfig) (*EstablishedAgreement, error) {
+func AgreementStateExecutionStarted(db Store, dbAgreementId string, protocol string, deployment *map[string]ServiceConfig) (*EstablishedAgreement, error) {
 	return agreementStateUpdate(db, dbAgreementId, protocol, func(c EstablishedAgreement) *EstablishedAgreement {
 		c.AgreementExecutionStartTime = uint64(time.Now().Unix())
 		c.CurrentDeployment = *deployment
@@ -213,7 +256,7 @@ func AgreementStateExecutionStarted(db *bolt.DB, dbAgreementId string, protocol
 }
 
 // set agreement state to accepted, a positive reply is being sent
-func AgreementStateAccepted(db *bolt.DB, dbAgreementId string, protocol string) (*EstablishedAgreement, error) {
+func AgreementStateAccepted(db Store, dbAgreementId string, protocol string) (*EstablishedAgreement, error) {
 	return agreementStateUpdate(db, dbAgreementId, protocol, func(c EstablishedAgreement) *EstablishedAgreement {
 		c.AgreementAcceptedTime = uint64(time.Now().Unix())
 		return &c
@@ -221,7 +264,7 @@ func AgreementStateAccepted(db *bolt.DB, dbAgreementId string, protocol string)
 }
 
 // set the eth signature of the proposal
-func AgreementStateProposalSigned(db *bolt.DB, dbAgreementId string, protocol string, sig string) (*EstablishedAgreement, error) {
+func AgreementStateProposalSigned(db Store, dbAgreementId string, protocol string, sig string) (*EstablishedAgreement, error) {
 	return agreementStateUpdate(db, dbAgreementId, protocol, func(c EstablishedAgreement) *EstablishedAgreement {
 		c.ProposalSig = sig
 		return &c
@@ -229,7 +272,7 @@ func AgreementStateProposalSigned(db *bolt.DB, dbAgreementId string, protocol st
 }
 
 // set the eth counterparty address when it is received from the consumer
-func AgreementStateBCDataReceived(db *bolt.DB, dbAgreementId string, protocol string, address string) (*EstablishedAgreement, error) {
+func AgreementStateBCDataReceived(db Store, dbAgreementId string, protocol string, address string) (*EstablishedAgreement, error) {
 	return agreementStateUpdate(db, dbAgreementId, protocol, func(c EstablishedAgreement) *EstablishedAgreement {
 		c.CounterPartyAddress = address
 		return &c
@@ -237,7 +280,7 @@ func AgreementStateBCDataReceived(db *bolt.DB, dbAgreementId string, protocol st
 }
 
 // set the time when out agreement blockchain update message was Ack'd.
-func AgreementStateBCUpdateAcked(db *bolt.DB, dbAgreementId string, protocol string) (*EstablishedAgreement, error) {
+func AgreementStateBCUpdateAcked(db Store, dbAgreementId string, protocol string) (*EstablishedAgreement, error) {
 	return agreementStateUpdate(db, dbAgreementId, protocol, func(c EstablishedAgreement) *EstablishedAgreement {
 		c.AgreementBCUpdateAckTime = uint64(time.Now().Unix())
 		return &c
@@ -245,7 +288,7 @@ func AgreementStateBCUpdateAcked(db *bolt.DB, dbAgreementId string, protocol str
 }
 
 // set agreement state to finalized
-func AgreementStateFinalized(db *bolt.DB, dbAgreementId string, protocol string) (*EstablishedAgreement, error) {
+func AgreementStateFinalized(db Store, dbAgreementId string, protocol string) (*EstablishedAgreement, error) {
 	return agreementStateUpdate(db, dbAgreementId, protocol, func(c EstablishedAgreement) *EstablishedAgreement {
 		c.AgreementFinalizedTime = uint64(time.Now().Unix())
 		return &c
@@ -253,7 +296,7 @@ func AgreementStateFinalized(db *bolt.DB, dbAgreementId string, protocol string)
 }
 
 // set agreement state to terminated
-func AgreementStateTerminated(db *bolt.DB, dbAgreementId string, reason uint64, reasonString string, protocol string) (*EstablishedAgreement, error) {
+func AgreementStateTerminated(db Store, dbAgreementId string, reason uint64, reasonString string, protocol string) (*EstablishedAgreement, error) {
 	return agreementStateUpdate(db, dbAgreementId, protocol, func(c EstablishedAgreement) *EstablishedAgreement {
 		c.AgreementTerminatedTime = uint64(time.Now().Unix())
 		c.TerminatedReason = reason
@@ -263,7 +306,7 @@ func AgreementStateTerminated(db *bolt.DB, dbAgreementId string, reason uint64,
 }
 
 // reset agreement state to not-terminated so that we can retry the termination
-func AgreementStateForceTerminated(db *bolt.DB, dbAgreementId string, protocol string) (*EstablishedAgreement, error) {
+func AgreementStateForceTerminated(db Store, dbAgreementId string, protocol string) (*EstablishedAgreement, error) {
 	return agreementStateUpdate(db, dbAgreementId, protocol, func(c EstablishedAgreement) *EstablishedAgreement {
 		c.AgreementForceTerminatedTime = uint64(time.Now().Unix())
 		return &c
@@ -271,7 +314,7 @@ func AgreementStateForceTerminated(db *bolt.DB, dbAgreementId string, protocol s
 }
 
 // set agreement state to data received
-func AgreementStateDataReceived(db *bolt.DB, dbAgreementId string, protocol string) (*EstablishedAgreement, error) {
+func AgreementStateDataReceived(db Store, dbAgreementId string, protocol string) (*EstablishedAgreement, error) {
 	return agreementStateUpdate(db, dbAgreementId, protocol, func(c EstablishedAgreement) *EstablishedAgreement {
 		c.AgreementDataReceivedTime = uint64(time.Now().Unix())
 		return &c
@@ -279,7 +322,7 @@ func AgreementStateDataReceived(db *bolt.DB, dbAgreementId string, protocol stri
 }
 
 // set agreement state to agreement protocol terminated
-func AgreementStateAgreementProtocolTerminated(db *bolt.DB, dbAgreementId string, protocol string) (*EstablishedAgreement, error) {
+func AgreementStateAgreementProtocolTerminated(db Store, dbAgreementId string, protocol string) (*EstablishedAgreement, error) {
 	return agreementStateUpdate(db, dbAgreementId, protocol, func(c EstablishedAgreement) *EstablishedAgreement {
 		c.AgreementProtocolTerminatedTime = uint64(time.Now().Unix())
 		return &c
@@ -287,7 +330,7 @@ func AgreementStateAgreementProtocolTerminated(db *bolt.DB, dbAgreementId string
 }
 
 // set agreement state to workload terminated
-func AgreementStateWorkloadTerminated(db *bolt.DB, dbAgreementId string, protocol string) (*EstablishedAgreement, error) {
+func AgreementStateWorkloadTerminated(db Store, dbAgreementId string, protocol string) (*EstablishedAgreement, error) {
 	return agreementStateUpdate(db, dbAgreementId, protocol, func(c EstablishedAgreement) *EstablishedAgreement {
 		c.WorkloadTerminatedTime = uint64(time.Now().Unix())
 		return &c
@@ -295,14 +338,14 @@ func AgreementStateWorkloadTerminated(db *bolt.DB, dbAgreementId string, protoco
 }
 
 // set agreement state to workload terminated
-func MeteringNotificationReceived(db *bolt.DB, dbAgreementId string, mn MeteringNotification, protocol string) (*EstablishedAgreement, error) {
+func MeteringNotificationReceived(db Store, dbAgreementId string, mn MeteringNotification, protocol string) (*EstablishedAgreement, error) {
 	return agreementStateUpdate(db, dbAgreementId, protocol, func(c EstablishedAgreement) *EstablishedAgreement {
 		c.MeteringNotificationMsg = mn
 		return &c
 	})
 }
 
-func DeleteEstablishedAgreement(db *bolt.DB, agreementId string, protocol string) error {
+func DeleteEstablishedAgreement(db Store, agreementId string, protocol string) error {
 
 	if agreementId == "" {
 		return errors.New("Agreement id empty, cannot remove")
@@ -318,7 +361,7 @@ func DeleteEstablishedAgreement(db *bolt.DB, agreementId string, protocol string
 			return fmt.Errorf("Expecting 1 records with id: %v, found %v", agreementId, agreements)
 		} else {
 
-			return db.Update(func(tx *bolt.Tx) error {
+			return db.Update(func(tx Tx) error {
 
 				if b, err := tx.CreateBucketIfNotExists([]byte(E_AGREEMENTS + "-" + protocol)); err != nil {
 					return err
@@ -332,7 +375,7 @@ func DeleteEstablishedAgreement(db *bolt.DB, agreementId string, protocol string
 	}
 }
 
-func agreementStateUpdate(db *bolt.DB, dbAgreementId string, protocol string, fn func(EstablishedAgreement) *EstablishedAgreement) (*EstablishedAgreement, error) {
+func agreementStateUpdate(db Store, dbAgreementId string, protocol string, fn func(EstablishedAgreement) *EstablishedAgreement) (*EstablishedAgreement, error) {
 	filters := make([]EAFilter, 0)
 	filters = append(filters, UnarchivedEAFilter())
 	filters = append(filters, IdEAFilter(dbAgreementId))
@@ -351,8 +394,8 @@ func agreementStateUpdate(db *bolt.DB, dbAgreementId string, protocol string, fn
 }
 
 // does whole-member replacements of values that are legal to change during the course of a contract's life
-func persistUpdatedAgreement(db *bolt.DB, dbAgreementId string, protocol string, update *EstablishedAgreement) error {
-	return db.Update(func(tx *bolt.Tx) error {
+func persistUpdatedAgreement(db Store, dbAgreementId string, protocol string, update *EstablishedAgreement) error {
+	return db.Update(func(tx Tx) error {
 		if b, err := tx.CreateBucketIfNotExists([]byte(E_AGREEMENTS + "-" + protocol)); err != nil {
 			return err
 		} else {
@@ -371,6 +414,10 @@ func persistUpdatedAgreement(db *bolt.DB, dbAgreementId string, protocol string,
 				if !mod.Archived { // 1 transition from false to true
 					mod.Archived = update.Archived
 				}
+				if mod.ConsumerChangedTime < update.ConsumerChangedTime { // changes only when the agreement is handed off
+					mod.ConsumerId = update.ConsumerId
+					mod.ConsumerChangedTime = update.ConsumerChangedTime
+				}
 				if len(mod.CounterPartyAddress) == 0 { // 1 transition from empty to non-empty
 					mod.CounterPartyAddress = update.CounterPartyAddress
 				}
@@ -451,11 +498,11 @@ func IdEAFilter(id string) EAFilter {
 // filter on EstablishedAgreements
 type EAFilter func(EstablishedAgreement) bool
 
-func FindEstablishedAgreements(db *bolt.DB, protocol string, filters []EAFilter) ([]EstablishedAgreement, error) {
+func FindEstablishedAgreements(db Store, protocol string, filters []EAFilter) ([]EstablishedAgreement, error) {
 	agreements := make([]EstablishedAgreement, 0)
 
 	// fetch contracts
-	readErr := db.View(func(tx *bolt.Tx) error {
+	readErr := db.View(func(tx Tx) error {
 
 		if b := tx.Bucket([]byte(E_AGREEMENTS + "-" + protocol)); b != nil {
 			b.ForEach(func(k, v []byte) error {
@@ -492,7 +539,7 @@ func FindEstablishedAgreements(db *bolt.DB, protocol string, filters []EAFilter)
 	}
 }
 
-func FindEstablishedAgreementsAllProtocols(db *bolt.DB, protocols []string, filters []EAFilter) ([]EstablishedAgreement, error) {
+func FindEstablishedAgreementsAllProtocols(db Store, protocols []string, filters []EAFilter) ([]EstablishedAgreement, error) {
 	agreements := make([]EstablishedAgreement, 0)
 	for _, protocol := range protocols {
 		if ags, err := FindEstablishedAgreements(db, protocol, filters); err != nil {
@@ -12,7 +12,7 @@ import (
 	"time"
 )
 
-var testDb *bolt.DB
+var testDb Store
 
 func TestMain(m *testing.M) {
 	testDbFile, err := ioutil.TempFile("", "anax_persistence_int_test.db")
@@ -21,11 +21,11 @@ func TestMain(m *testing.M) {
 	}
 	defer os.Remove(testDbFile.Name())
 
-	var dbErr error
-	testDb, dbErr = bolt.Open(testDbFile.Name(), 0600, &bolt.Options{Timeout: 10 * time.Second})
+	boltDb, dbErr := bolt.Open(testDbFile.Name(), 0600, &bolt.Options{Timeout: 10 * time.Second})
 	if dbErr != nil {
 		panic(err)
 	}
+	testDb = NewBoltStore(boltDb)
 
 	m.Run()
 }
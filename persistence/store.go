@@ -0,0 +1,119 @@
+package persistence
+
+import (
+	"github.com/boltdb/bolt"
+	"os"
+	"path"
+	"time"
+)
+
+// The persistence functions of anax and the agbot do not depend on a particular database. They read and write
+// JSON records in named buckets through the Store interface, within transactions. BoltDB is the default
+// implementation, an in-memory implementation is available for unit tests and tools that do not need their
+// state to survive a restart. The DomainStore in domain_store.go is the interface to the records themselves.
+
+// A Store holds buckets of records. View runs a read-only transaction, Update runs a read-write transaction
+// that is rolled back if the function returns an error.
+type Store interface {
+	View(fn func(Tx) error) error
+	Update(fn func(Tx) error) error
+	Close() error
+}
+
+// A transaction on a Store. Bucket returns nil when the bucket does not exist. ForEach visits the buckets
+// in name order.
+type Tx interface {
+	Bucket(name []byte) Bucket
+	CreateBucketIfNotExists(name []byte) (Bucket, error)
+	DeleteBucket(name []byte) error
+	ForEach(fn func(name []byte, b Bucket) error) error
+}
+
+// A bucket of records, keyed by byte strings. ForEach visits the records in key order, the records
+// must not be changed by the function passed to ForEach. NextSequence returns the next value of a
+// counter that is kept with the bucket.
+type Bucket interface {
+	Get(key []byte) []byte
+	Put(key []byte, value []byte) error
+	Delete(key []byte) error
+	ForEach(fn func(k []byte, v []byte) error) error
+	NextSequence() (uint64, error)
+}
+
+// A Store backed by a BoltDB database file.
+type BoltStore struct {
+	db *bolt.DB
+}
+
+func NewBoltStore(db *bolt.DB) *BoltStore {
+	return &BoltStore{
+		db: db,
+	}
+}
+
+// Open or create the BoltDB database file with the given name in the given directory.
+func OpenBoltStore(dir string, name string) (*BoltStore, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+
+	db, err := bolt.Open(path.Join(dir, name), 0600, &bolt.Options{Timeout: 10 * time.Second})
+	if err != nil {
+		return nil, err
+	}
+	return NewBoltStore(db), nil
+}
+
+func (s *BoltStore) View(fn func(Tx) error) error {
+	return s.db.View(func(tx *bolt.Tx) error {
+		return fn(boltTx{tx})
+	})
+}
+
+func (s *BoltStore) Update(fn func(Tx) error) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return fn(boltTx{tx})
+	})
+}
+
+func (s *BoltStore) Close() error {
+	return s.db.Close()
+}
+
+// Copy the database file to a file next to it, with the given suffix. Returns the name of the copy.
+func (s *BoltStore) Backup(suffix string) (string, error) {
+	name := s.db.Path() + "." + suffix
+	return name, s.db.View(func(tx *bolt.Tx) error {
+		return tx.CopyFile(name, 0600)
+	})
+}
+
+type boltTx struct {
+	tx *bolt.Tx
+}
+
+func (t boltTx) Bucket(name []byte) Bucket {
+	// A nil *bolt.Bucket has to be returned as a nil interface, so that callers can check for a missing bucket.
+	if b := t.tx.Bucket(name); b != nil {
+		return b
+	}
+	return nil
+}
+
+func (t boltTx) CreateBucketIfNotExists(name []byte) (Bucket, error) {
+	if b, err := t.tx.CreateBucketIfNotExists(name); err != nil {
+		return nil, err
+	} else {
+		return b, nil
+	}
+}
+
+func (t boltTx) DeleteBucket(name []byte) error {
+	return t.tx.DeleteBucket(name)
+}
+
+func (t boltTx) ForEach(fn func(name []byte, b Bucket) error) error {
+	return t.tx.ForEach(func(name []byte, b *bolt.Bucket) error {
+		return fn(name, b)
+	})
+}
@@ -0,0 +1,119 @@
+// +build unit
+
+package persistence
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+// Both store implementations must behave the same way, so the same checks are run against each of them.
+func Test_MemoryStore(t *testing.T) {
+	checkStore(t, NewMemoryStore())
+}
+
+func Test_BoltStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "store-")
+	if err != nil {
+		t.Fatalf("unable to create temp dir, error: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	store, err := OpenBoltStore(dir, "anax-store.db")
+	if err != nil {
+		t.Fatalf("unable to open bolt store, error: %v", err)
+	}
+	defer store.Close()
+
+	checkStore(t, store)
+
+	if name, err := store.Backup("v1"); err != nil {
+		t.Errorf("unexpected error %v", err)
+	} else if _, err := os.Stat(name); err != nil {
+		t.Errorf("expected backup %v to exist, error: %v", name, err)
+	}
+}
+
+func checkStore(t *testing.T, store Store) {
+
+	// A missing bucket is a nil bucket.
+	store.View(func(tx Tx) error {
+		if b := tx.Bucket([]byte("records")); b != nil {
+			t.Errorf("expected no bucket, got %v", b)
+		}
+		return nil
+	})
+
+	if err := store.Update(func(tx Tx) error {
+		b, err := tx.CreateBucketIfNotExists([]byte("records"))
+		if err != nil {
+			return err
+		}
+		for _, k := range []string{"c", "a", "b"} {
+			if err := b.Put([]byte(k), []byte("value-"+k)); err != nil {
+				return err
+			}
+		}
+		if seq, err := b.NextSequence(); err != nil || seq != 1 {
+			t.Errorf("expected sequence 1, got %v %v", seq, err)
+		}
+		return nil
+	}); err != nil {
+		t.Errorf("unexpected error %v", err)
+	}
+
+	// A failed update leaves the store as it was.
+	failure := errors.New("failed")
+	if err := store.Update(func(tx Tx) error {
+		b := tx.Bucket([]byte("records"))
+		b.Delete([]byte("a"))
+		b.Put([]byte("d"), []byte("value-d"))
+		tx.CreateBucketIfNotExists([]byte("other"))
+		return failure
+	}); err != failure {
+		t.Errorf("expected the update to fail, got %v", err)
+	}
+
+	store.View(func(tx Tx) error {
+		if tx.Bucket([]byte("other")) != nil {
+			t.Errorf("expected the other bucket to be rolled back")
+		}
+
+		b := tx.Bucket([]byte("records"))
+		if b == nil {
+			t.Errorf("expected the records bucket")
+			return nil
+		} else if v := b.Get([]byte("a")); string(v) != "value-a" {
+			t.Errorf("expected value-a, got %v", string(v))
+		} else if err := b.Put([]byte("e"), []byte("value-e")); err == nil {
+			t.Errorf("expected a write to fail in a read-only transaction")
+		}
+
+		keys := ""
+		b.ForEach(func(k, v []byte) error {
+			keys += string(k)
+			return nil
+		})
+		if keys != "abc" {
+			t.Errorf("expected the records in key order, got %v", keys)
+		}
+		return nil
+	})
+
+	store.Update(func(tx Tx) error {
+		b := tx.Bucket([]byte("records"))
+		if seq, err := b.NextSequence(); err != nil || seq != 2 {
+			t.Errorf("expected sequence 2, got %v %v", seq, err)
+		}
+		return tx.DeleteBucket([]byte("records"))
+	})
+
+	store.View(func(tx Tx) error {
+		if tx.Bucket([]byte("records")) != nil {
+			t.Errorf("expected the records bucket to be deleted")
+		}
+		return nil
+	})
+}
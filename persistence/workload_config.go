@@ -5,7 +5,6 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
-	"github.com/boltdb/bolt"
 	"github.com/golang/glog"
 )
 
@@ -41,7 +40,7 @@ func (w *WorkloadConfig) GetKey() string {
 }
 
 // create a new workload config object and save it to db.
-func NewWorkloadConfig(db *bolt.DB, workloadURL string, org string, version string, variables []Attribute) (*WorkloadConfig, error) {
+func NewWorkloadConfig(db Store, workloadURL string, org string, version string, variables []Attribute) (*WorkloadConfig, error) {
 
 	if workloadURL == "" || org == "" || version == "" {
 		return nil, errors.New("WorkloadConfig, workload URL, organization, or version is empty, cannot persist")
@@ -60,7 +59,7 @@ func NewWorkloadConfig(db *bolt.DB, workloadURL string, org string, version stri
 		Attributes:        variables,
 	}
 
-	return new_cfg, db.Update(func(tx *bolt.Tx) error {
+	return new_cfg, db.Update(func(tx Tx) error {
 		if b, err := tx.CreateBucketIfNotExists([]byte(WORKLOAD_CONFIG)); err != nil {
 			return err
 		} else if bytes, err := json.Marshal(new_cfg); err != nil {
@@ -109,11 +108,11 @@ func hydrateWorkloadConfig(cfgOnly *WorkloadConfigOnly) (*WorkloadConfig, error)
 }
 
 // find the workload config variables in the db
-func FindWorkloadConfig(db *bolt.DB, url string, org string, version string) (*WorkloadConfig, error) {
+func FindWorkloadConfig(db Store, url string, org string, version string) (*WorkloadConfig, error) {
 	var cfg *WorkloadConfig
 
 	// fetch workload config objects
-	readErr := db.View(func(tx *bolt.Tx) error {
+	readErr := db.View(func(tx Tx) error {
 
 		var cfgOnly *WorkloadConfigOnly
 
@@ -170,11 +169,11 @@ func AllWorkloadWCFilter(workload_url string, org string) WCFilter {
 }
 
 // find the microservice instance from the db
-func FindWorkloadConfigs(db *bolt.DB, filters []WCFilter) ([]WorkloadConfig, error) {
+func FindWorkloadConfigs(db Store, filters []WCFilter) ([]WorkloadConfig, error) {
 	cfg_instances := make([]WorkloadConfig, 0)
 
 	// fetch contracts
-	readErr := db.View(func(tx *bolt.Tx) error {
+	readErr := db.View(func(tx Tx) error {
 
 		cfgOnly_instances := make([]WorkloadConfigOnly, 0)
 
@@ -224,7 +223,7 @@ func FindWorkloadConfigs(db *bolt.DB, filters []WCFilter) ([]WorkloadConfig, err
 	}
 }
 
-func DeleteWorkloadConfig(db *bolt.DB, url string, org string, version string) error {
+func DeleteWorkloadConfig(db Store, url string, org string, version string) error {
 
 	if url == "" || version == "" {
 		return errors.New("workload URL or version is empty, cannot delete")
@@ -236,7 +235,7 @@ func DeleteWorkloadConfig(db *bolt.DB, url string, org string, version string) e
 			return fmt.Errorf("could not find record for %v and %v", url, version)
 		} else {
 
-			return db.Update(func(tx *bolt.Tx) error {
+			return db.Update(func(tx Tx) error {
 
 				if b, err := tx.CreateBucketIfNotExists([]byte(WORKLOAD_CONFIG)); err != nil {
 					return err
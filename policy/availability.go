@@ -0,0 +1,420 @@
+package policy
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// The purpose of this file is to abstract the operations on the Availability type. An availability
+// section describes the times of day (and days of the week) during which agreements on the policy
+// are allowed to exist. A policy without an availability section is always available.
+//
+// An availability section is a list of schedules. Each schedule has a timezone and a list of windows.
+// A schedule is open when any one of its windows is open. The availability section is open when all
+// of its schedules are open, which makes merging 2 availability sections (an intersection of the time
+// during which both are open) a matter of concatenating their schedules.
+
+// The number of minutes in a week. Schedules repeat every week so looking ahead this far is enough to
+// find an opening if there is one.
+const minutesPerWeek = 7 * 24 * 60
+
+// Loading a timezone reads the zone database, so the locations are loaded once and kept.
+var locations = struct {
+	sync.Mutex
+	byName map[string]*time.Location
+}{byName: make(map[string]*time.Location)}
+
+func loadLocation(name string) (*time.Location, error) {
+	locations.Lock()
+	defer locations.Unlock()
+	if loc, ok := locations.byName[name]; ok {
+		return loc, nil
+	} else if loc, err := time.LoadLocation(name); err != nil {
+		return nil, err
+	} else {
+		locations.byName[name] = loc
+		return loc, nil
+	}
+}
+
+var weekdays = map[string]time.Weekday{
+	"sun": time.Sunday,
+	"mon": time.Monday,
+	"tue": time.Tuesday,
+	"wed": time.Wednesday,
+	"thu": time.Thursday,
+	"fri": time.Friday,
+	"sat": time.Saturday,
+}
+
+type AvailabilityWindow struct {
+	Days  []string `json:"days,omitempty"` // Day names (sun, mon, ...) or ranges (mon-fri), the window opens on these days. Empty means every day.
+	Start string   `json:"start"`          // HH:MM, the time the window opens
+	End   string   `json:"end"`            // HH:MM, the time the window closes. When it is not after Start the window closes on the following day.
+}
+
+func (w AvailabilityWindow) String() string {
+	days := "every day"
+	if len(w.Days) != 0 {
+		days = strings.Join(w.Days, ",")
+	}
+	return fmt.Sprintf("%v %v-%v", days, w.Start, w.End)
+}
+
+func (w AvailabilityWindow) IsSame(other AvailabilityWindow) bool {
+	if w.Start != other.Start || w.End != other.End || len(w.Days) != len(other.Days) {
+		return false
+	}
+	for ix, day := range w.Days {
+		if other.Days[ix] != day {
+			return false
+		}
+	}
+	return true
+}
+
+func (w AvailabilityWindow) IsValid() error {
+	if _, err := w.days(); err != nil {
+		return err
+	} else if _, err := parseMinuteOfDay(w.Start); err != nil {
+		return errors.New(fmt.Sprintf("start %v", err))
+	} else if _, err := parseMinuteOfDay(w.End); err != nil {
+		return errors.New(fmt.Sprintf("end %v", err))
+	}
+	return nil
+}
+
+// Returns the set of days on which the window opens.
+func (w AvailabilityWindow) days() (map[time.Weekday]bool, error) {
+	res := make(map[time.Weekday]bool)
+	if len(w.Days) == 0 {
+		for _, d := range weekdays {
+			res[d] = true
+		}
+		return res, nil
+	}
+
+	for _, day := range w.Days {
+		bounds := strings.Split(strings.ToLower(strings.TrimSpace(day)), "-")
+		if len(bounds) > 2 {
+			return nil, errors.New(fmt.Sprintf("day %v is not a day name or a range of day names", day))
+		}
+		first, ok := weekdays[bounds[0]]
+		if !ok {
+			return nil, errors.New(fmt.Sprintf("day %v is not one of sun, mon, tue, wed, thu, fri or sat", day))
+		}
+		last := first
+		if len(bounds) == 2 {
+			if last, ok = weekdays[bounds[1]]; !ok {
+				return nil, errors.New(fmt.Sprintf("day %v is not one of sun, mon, tue, wed, thu, fri or sat", day))
+			}
+		}
+		// Ranges can wrap around the end of the week, e.g. fri-mon.
+		for d := first; ; d = (d + 1) % 7 {
+			res[d] = true
+			if d == last {
+				break
+			}
+		}
+	}
+	return res, nil
+}
+
+// A window with its days and times parsed, see AvailabilityWindow.
+type compiledWindow struct {
+	days  map[time.Weekday]bool
+	start int // minute of the day
+	end   int // minute of the day
+}
+
+func (w AvailabilityWindow) compile() (*compiledWindow, error) {
+	days, err := w.days()
+	if err != nil {
+		return nil, err
+	}
+	start, err := parseMinuteOfDay(w.Start)
+	if err != nil {
+		return nil, err
+	}
+	end, err := parseMinuteOfDay(w.End)
+	if err != nil {
+		return nil, err
+	}
+	return &compiledWindow{days: days, start: start, end: end}, nil
+}
+
+// Returns true if the window is open at the given time. The time must already be in the timezone of
+// the schedule that holds the window.
+func (w *compiledWindow) isOpenAt(t time.Time) bool {
+	minute := t.Hour()*60 + t.Minute()
+	if w.start < w.end {
+		return w.days[t.Weekday()] && minute >= w.start && minute < w.end
+	}
+
+	// The window closes on the day after it opens.
+	yesterday := (t.Weekday() + 6) % 7
+	return (w.days[t.Weekday()] && minute >= w.start) || (w.days[yesterday] && minute < w.end)
+}
+
+// Convert HH:MM into the number of minutes since midnight.
+func parseMinuteOfDay(hhmm string) (int, error) {
+	parts := strings.Split(strings.TrimSpace(hhmm), ":")
+	if len(parts) != 2 {
+		return 0, errors.New(fmt.Sprintf("time %v is not in HH:MM form", hhmm))
+	}
+	hours, err := strconv.Atoi(parts[0])
+	if err != nil || hours < 0 || hours > 23 {
+		return 0, errors.New(fmt.Sprintf("time %v has an hour that is not between 00 and 23", hhmm))
+	}
+	minutes, err := strconv.Atoi(parts[1])
+	if err != nil || minutes < 0 || minutes > 59 {
+		return 0, errors.New(fmt.Sprintf("time %v has a minute that is not between 00 and 59", hhmm))
+	}
+	return hours*60 + minutes, nil
+}
+
+type AvailabilitySchedule struct {
+	Timezone string               `json:"timezone,omitempty"` // An IANA timezone name such as America/New_York. Empty means UTC.
+	Windows  []AvailabilityWindow `json:"windows"`
+}
+
+func (s AvailabilitySchedule) String() string {
+	tz := s.Timezone
+	if tz == "" {
+		tz = "UTC"
+	}
+	return fmt.Sprintf("Timezone: %v, Windows: %v", tz, s.Windows)
+}
+
+func (s AvailabilitySchedule) IsSame(other AvailabilitySchedule) bool {
+	if s.Timezone != other.Timezone || len(s.Windows) != len(other.Windows) {
+		return false
+	}
+	for ix, w := range s.Windows {
+		if !w.IsSame(other.Windows[ix]) {
+			return false
+		}
+	}
+	return true
+}
+
+func (s AvailabilitySchedule) IsValid() error {
+	if _, err := s.location(); err != nil {
+		return err
+	} else if len(s.Windows) == 0 {
+		return errors.New(fmt.Sprintf("schedule for timezone %v has no windows", s.Timezone))
+	}
+	for _, w := range s.Windows {
+		if err := w.IsValid(); err != nil {
+			return errors.New(fmt.Sprintf("window %v is not valid, error: %v", w, err))
+		}
+	}
+	return nil
+}
+
+func (s AvailabilitySchedule) location() (*time.Location, error) {
+	if s.Timezone == "" {
+		return time.UTC, nil
+	} else if loc, err := loadLocation(s.Timezone); err != nil {
+		return nil, errors.New(fmt.Sprintf("timezone %v is not valid, error: %v", s.Timezone, err))
+	} else {
+		return loc, nil
+	}
+}
+
+// A schedule is open when any of its windows is open.
+func (s AvailabilitySchedule) IsOpenAt(t time.Time) bool {
+	if c, err := s.compile(); err != nil {
+		return false
+	} else {
+		return c.isOpenAt(t)
+	}
+}
+
+// A schedule with its location loaded and its windows parsed, so that it can be evaluated at many times.
+type compiledSchedule struct {
+	loc     *time.Location
+	windows []*compiledWindow
+}
+
+func (s AvailabilitySchedule) compile() (*compiledSchedule, error) {
+	loc, err := s.location()
+	if err != nil {
+		return nil, err
+	}
+	c := &compiledSchedule{loc: loc, windows: make([]*compiledWindow, 0, len(s.Windows))}
+	for _, w := range s.Windows {
+		if cw, err := w.compile(); err != nil {
+			return nil, err
+		} else {
+			c.windows = append(c.windows, cw)
+		}
+	}
+	return c, nil
+}
+
+func (c *compiledSchedule) isOpenAt(t time.Time) bool {
+	local := t.In(c.loc)
+	for _, w := range c.windows {
+		if w.isOpenAt(local) {
+			return true
+		}
+	}
+	return false
+}
+
+type Availability []AvailabilitySchedule
+
+// This function creates Availability objects
+func Availability_Factory(schedules []AvailabilitySchedule) *Availability {
+	a := new(Availability)
+	*a = append(*a, schedules...)
+
+	return a
+}
+
+func (a Availability) String() string {
+	if len(a) == 0 {
+		return "Availability: always"
+	}
+	return fmt.Sprintf("Availability: %v", []AvailabilitySchedule(a))
+}
+
+// Return true if both availability sections contain the same schedules. The schedules dont have to be
+// in the same order.
+func (a *Availability) IsSame(other *Availability) bool {
+	if len(*a) != len(*other) {
+		return false
+	}
+	for _, s := range *a {
+		if !other.contains(s) {
+			return false
+		}
+	}
+	return true
+}
+
+func (a *Availability) contains(schedule AvailabilitySchedule) bool {
+	for _, s := range *a {
+		if s.IsSame(schedule) {
+			return true
+		}
+	}
+	return false
+}
+
+func (a *Availability) IsValid() error {
+	for _, s := range *a {
+		if err := s.IsValid(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Compile the schedules of the availability section. A section with an invalid schedule is never open.
+func (a *Availability) compile() ([]*compiledSchedule, error) {
+	res := make([]*compiledSchedule, 0, len(*a))
+	for _, s := range *a {
+		if c, err := s.compile(); err != nil {
+			return nil, err
+		} else {
+			res = append(res, c)
+		}
+	}
+	return res, nil
+}
+
+func allOpenAt(schedules []*compiledSchedule, t time.Time) bool {
+	for _, s := range schedules {
+		if !s.isOpenAt(t) {
+			return false
+		}
+	}
+	return true
+}
+
+// The availability section is open when all of its schedules are open. An empty section is always open.
+func (a *Availability) IsOpenAt(t time.Time) bool {
+	schedules, err := a.compile()
+	if err != nil {
+		return false
+	}
+	return allOpenAt(schedules, t)
+}
+
+// Returns the first time in the week starting at the given time at which the availability section is open,
+// and false if it is not open during that week. The section can only go from closed to open when one of its
+// windows opens, so only the opening times of the windows have to be checked.
+func (a *Availability) NextOpening(from time.Time) (time.Time, bool) {
+	schedules, err := a.compile()
+	if err != nil {
+		return time.Time{}, false
+	} else if allOpenAt(schedules, from) {
+		return from, true
+	}
+
+	until := from.Add(minutesPerWeek * time.Minute)
+	next, found := time.Time{}, false
+	for _, s := range schedules {
+		// Start the day before, a window that opens then can only matter if it is still open, and go one day past
+		// the week for timezones that are ahead of the given time.
+		local := from.In(s.loc)
+		for d := -1; d <= 7; d++ {
+			day := time.Date(local.Year(), local.Month(), local.Day()+d, 0, 0, 0, 0, s.loc)
+			for _, w := range s.windows {
+				if !w.days[day.Weekday()] {
+					continue
+				}
+				t := time.Date(day.Year(), day.Month(), day.Day(), w.start/60, w.start%60, 0, 0, s.loc)
+				if t.After(from) && t.Before(until) && (!found || t.Before(next)) && allOpenAt(schedules, t) {
+					next, found = t, true
+				}
+			}
+		}
+	}
+	return next, found
+}
+
+// Returns true if the availability section will be open at some time in the week starting at the
+// given time.
+func (a *Availability) HasOpening(from time.Time) bool {
+	_, found := a.NextOpening(from)
+	return found
+}
+
+// Two availability sections are compatible when there is a time at which both are open.
+func (a *Availability) Compatible_With(other *Availability) bool {
+	return a.Merge(other).HasOpening(time.Now())
+}
+
+// Merge 2 availability sections. The merged section is open only when both of the input sections
+// are open.
+func (a *Availability) Merge(other *Availability) *Availability {
+	merged := Availability_Factory(*a)
+	for _, s := range *other {
+		if !merged.contains(s) {
+			*merged = append(*merged, s)
+		}
+	}
+	return merged
+}
+
+// Availability attributes are stored as generic JSON, so they are converted to an Availability object
+// by round tripping them through JSON.
+func ConvertToAvailability(schedules interface{}) (*Availability, error) {
+	a := new(Availability)
+	if schedules == nil {
+		return a, nil
+	} else if serial, err := json.Marshal(schedules); err != nil {
+		return nil, errors.New(fmt.Sprintf("could not serialize availability schedules %v, error: %v", schedules, err))
+	} else if err := json.Unmarshal(serial, a); err != nil {
+		return nil, errors.New(fmt.Sprintf("could not convert %v to availability schedules, error: %v", schedules, err))
+	}
+	return a, nil
+}
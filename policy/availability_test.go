@@ -0,0 +1,148 @@
+// +build unit
+
+package policy
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+// A monday.
+var monday = time.Date(2017, time.October, 2, 0, 0, 0, 0, time.UTC)
+
+func at(day int, hour int, minute int) time.Time {
+	return monday.Add(time.Duration(day*24*60+hour*60+minute) * time.Minute)
+}
+
+func Test_Availability_Window(t *testing.T) {
+	a := Availability_Factory([]AvailabilitySchedule{{Windows: []AvailabilityWindow{{Days: []string{"mon-fri"}, Start: "09:00", End: "17:00"}}}})
+
+	if err := a.IsValid(); err != nil {
+		t.Errorf("Error: %v should be valid, error: %v", a, err)
+	} else if !a.IsOpenAt(at(0, 9, 0)) {
+		t.Errorf("Error: %v should be open monday at 09:00", a)
+	} else if a.IsOpenAt(at(0, 17, 0)) {
+		t.Errorf("Error: %v should be closed monday at 17:00", a)
+	} else if !a.IsOpenAt(at(4, 12, 30)) {
+		t.Errorf("Error: %v should be open friday at 12:30", a)
+	} else if a.IsOpenAt(at(5, 12, 30)) {
+		t.Errorf("Error: %v should be closed saturday at 12:30", a)
+	}
+}
+
+func Test_Availability_Overnight(t *testing.T) {
+	a := Availability_Factory([]AvailabilitySchedule{{Windows: []AvailabilityWindow{{Days: []string{"fri"}, Start: "22:00", End: "02:00"}}}})
+
+	if !a.IsOpenAt(at(4, 23, 0)) {
+		t.Errorf("Error: %v should be open friday at 23:00", a)
+	} else if !a.IsOpenAt(at(5, 1, 59)) {
+		t.Errorf("Error: %v should be open saturday at 01:59", a)
+	} else if a.IsOpenAt(at(5, 2, 0)) {
+		t.Errorf("Error: %v should be closed saturday at 02:00", a)
+	} else if a.IsOpenAt(at(4, 1, 0)) {
+		t.Errorf("Error: %v should be closed friday at 01:00", a)
+	}
+
+	// A window that starts and ends at the same time is open all day.
+	allDay := Availability_Factory([]AvailabilitySchedule{{Windows: []AvailabilityWindow{{Days: []string{"sat", "sun"}, Start: "00:00", End: "00:00"}}}})
+	if !allDay.IsOpenAt(at(6, 23, 59)) {
+		t.Errorf("Error: %v should be open sunday at 23:59", allDay)
+	} else if allDay.IsOpenAt(at(7, 0, 0)) {
+		t.Errorf("Error: %v should be closed monday at 00:00", allDay)
+	}
+}
+
+func Test_Availability_Timezone(t *testing.T) {
+	a := Availability_Factory([]AvailabilitySchedule{{Timezone: "America/New_York", Windows: []AvailabilityWindow{{Start: "09:00", End: "10:00"}}}})
+
+	// New York is 4 hours behind UTC in October.
+	if err := a.IsValid(); err != nil {
+		t.Errorf("Error: %v should be valid, error: %v", a, err)
+	} else if !a.IsOpenAt(at(0, 13, 30)) {
+		t.Errorf("Error: %v should be open at 13:30 UTC", a)
+	} else if a.IsOpenAt(at(0, 9, 30)) {
+		t.Errorf("Error: %v should be closed at 09:30 UTC", a)
+	}
+}
+
+func Test_Availability_Invalid(t *testing.T) {
+	invalid := []AvailabilitySchedule{
+		{Windows: []AvailabilityWindow{{Days: []string{"funday"}, Start: "09:00", End: "10:00"}}},
+		{Windows: []AvailabilityWindow{{Start: "9", End: "10:00"}}},
+		{Windows: []AvailabilityWindow{{Start: "09:00", End: "24:00"}}},
+		{Timezone: "Not/AZone", Windows: []AvailabilityWindow{{Start: "09:00", End: "10:00"}}},
+		{Timezone: "UTC"},
+	}
+
+	for _, s := range invalid {
+		if err := Availability_Factory([]AvailabilitySchedule{s}).IsValid(); err == nil {
+			t.Errorf("Error: %v should not be valid", s)
+		}
+	}
+}
+
+func Test_Availability_Merge(t *testing.T) {
+	mornings := Availability_Factory([]AvailabilitySchedule{{Windows: []AvailabilityWindow{{Start: "06:00", End: "12:00"}}}})
+	weekdays := Availability_Factory([]AvailabilitySchedule{{Windows: []AvailabilityWindow{{Days: []string{"mon-fri"}, Start: "10:00", End: "18:00"}}}})
+	evenings := Availability_Factory([]AvailabilitySchedule{{Windows: []AvailabilityWindow{{Start: "18:00", End: "22:00"}}}})
+	always := new(Availability)
+
+	merged := mornings.Merge(weekdays)
+	if len(*merged) != 2 {
+		t.Errorf("Error: %v should have 2 schedules", merged)
+	} else if !merged.IsOpenAt(at(1, 11, 0)) {
+		t.Errorf("Error: %v should be open tuesday at 11:00", merged)
+	} else if merged.IsOpenAt(at(1, 9, 0)) || merged.IsOpenAt(at(5, 11, 0)) {
+		t.Errorf("Error: %v should only be open when both schedules are open", merged)
+	} else if !mornings.Compatible_With(weekdays) {
+		t.Errorf("Error: %v should be compatible with %v", mornings, weekdays)
+	} else if mornings.Compatible_With(evenings) {
+		t.Errorf("Error: %v should not be compatible with %v", mornings, evenings)
+	} else if !always.Compatible_With(evenings) || !always.IsOpenAt(at(3, 3, 0)) {
+		t.Errorf("Error: an empty availability should always be open")
+	} else if m := mornings.Merge(mornings); !m.IsSame(mornings) {
+		t.Errorf("Error: merging %v with itself should not change it, got %v", mornings, m)
+	}
+}
+
+func Test_Availability_NextOpening(t *testing.T) {
+	weekdays := Availability_Factory([]AvailabilitySchedule{{Windows: []AvailabilityWindow{{Days: []string{"mon-fri"}, Start: "10:00", End: "18:00"}}}})
+	nights := Availability_Factory([]AvailabilitySchedule{{Timezone: "America/New_York", Windows: []AvailabilityWindow{{Days: []string{"fri"}, Start: "22:00", End: "02:00"}}}})
+	mornings := Availability_Factory([]AvailabilitySchedule{{Windows: []AvailabilityWindow{{Start: "06:00", End: "12:00"}}}})
+	evenings := Availability_Factory([]AvailabilitySchedule{{Windows: []AvailabilityWindow{{Start: "18:00", End: "22:00"}}}})
+
+	if next, ok := weekdays.NextOpening(at(0, 12, 0)); !ok || !next.Equal(at(0, 12, 0)) {
+		t.Errorf("Error: %v is open monday at 12:00, got %v", weekdays, next)
+	} else if next, ok := weekdays.NextOpening(at(4, 18, 0)); !ok || !next.Equal(at(7, 10, 0)) {
+		t.Errorf("Error: %v should next open the following monday at 10:00, got %v", weekdays, next)
+	} else if next, ok := nights.NextOpening(at(0, 0, 0)); !ok || !next.Equal(at(5, 2, 0)) {
+		t.Errorf("Error: %v should open saturday at 02:00 UTC, got %v", nights, next)
+	} else if merged := nights.Merge(weekdays); merged.HasOpening(at(0, 0, 0)) {
+		t.Errorf("Error: %v should never be open", merged)
+	} else if merged := mornings.Merge(weekdays); !merged.HasOpening(at(5, 0, 0)) {
+		t.Errorf("Error: %v should open on monday", merged)
+	} else if merged := mornings.Merge(evenings); merged.HasOpening(at(0, 0, 0)) {
+		t.Errorf("Error: %v should never be open", merged)
+	}
+
+	bad := Availability_Factory([]AvailabilitySchedule{{Timezone: "Nowhere/Special", Windows: []AvailabilityWindow{{Start: "06:00", End: "12:00"}}}})
+	if bad.HasOpening(at(0, 0, 0)) || bad.IsOpenAt(at(0, 7, 0)) {
+		t.Errorf("Error: %v with an invalid timezone should never be open", bad)
+	}
+}
+
+func Test_ConvertToAvailability(t *testing.T) {
+	var schedules interface{}
+	if err := json.Unmarshal([]byte(`[{"timezone":"UTC","windows":[{"days":["mon"],"start":"08:00","end":"09:00"}]}]`), &schedules); err != nil {
+		t.Errorf("Error: unable to unmarshal schedules, error: %v", err)
+	} else if a, err := ConvertToAvailability(schedules); err != nil {
+		t.Errorf("Error: unable to convert %v, error: %v", schedules, err)
+	} else if len(*a) != 1 || !a.IsOpenAt(at(0, 8, 30)) {
+		t.Errorf("Error: converted availability %v is not correct", a)
+	}
+
+	if a, err := ConvertToAvailability(nil); err != nil || len(*a) != 0 {
+		t.Errorf("Error: converting nil should produce an empty availability, got %v, error: %v", a, err)
+	}
+}
@@ -3,6 +3,7 @@ package policy
 import (
 	"errors"
 	"fmt"
+	"regexp"
 )
 
 // The purpose this file is to abstract the CounterPartyProperties field in the Policy struct
@@ -20,10 +21,24 @@ import (
 // _control_operator_    = {"and", "or", "not"}
 // _expression_          = _control_operator_: [_expression_] || property
 // _property_            = "name": _property_name_, "value": _property_value, "op": _comparison_operator_
-// _comparison_operator_ = {"<", "=", ">", "<=", ">=", "!="}
+// _comparison_operator_ = {"<", "=", ">", "<=", ">=", "!=", "in", "matches", "version", "exists", "between"}
 // The "=" and "!=" comparison operators can be applied to strings and integers.
 // If the "op" key is missing, then equal is assumed.
 //
+// The remaining operators are:
+// "in"      - the value is a list, the property's value has to be equal to one of the elements in the list.
+//             When the property's value is itself a list, one of its elements has to be in the list.
+// "matches" - the value is a regular expression that the property's string value has to match.
+// "version" - the value is a version range (see version.go), the property's value has to be a version
+//             string within the range.
+// "exists"  - the property has to be present, whatever its value. The value key can be omitted, when it is
+//             set to false the property has to be absent instead.
+// "between" - the value is a list of 2 numbers, the property's numeric value has to be greater than or equal
+//             to the first and less than or equal to the second.
+//
+// Properties that declare a type of quantity or version are compared according to their type, see property_types.go.
+// For example, a quantity property with value "1GiB" satisfies {"name":"memory","value":"512MiB","op":">="}.
+//
 // See the unit tests for examples of valid and invalid syntax
 //
 
@@ -48,6 +63,11 @@ const equalto = "="
 const lessthaneq = "<="
 const greaterthaneq = ">="
 const notequalto = "!="
+const inlist = "in"
+const matches = "matches"
+const inversion = "version"
+const exists = "exists"
+const between = "between"
 
 // This struct represents property value expressions to be satisfied
 type PropertyExpression struct {
@@ -194,7 +214,9 @@ func (self *RequiredProperty) verify(cop *map[string]interface{}) error {
 	propArray := (*cop)[controlOp].([]interface{})
 	for _, p := range propArray {
 		if prop := isPropertyExpression(p); prop != nil {
-			continue
+			if err := prop.verifyValue(); err != nil {
+				return errors.New(fmt.Sprintf("RequiredProperty Object not valid, property %v has an invalid value for operator %v, error: %v", prop.Name, prop.Op, err))
+			}
 		} else if cop := isControlOp(p); cop != nil {
 			if err := self.verify(cop); err != nil {
 				return err
@@ -258,7 +280,8 @@ func controlOperators() map[string]int {
 // of the supported comparison operators.
 func comparisonOperators() map[string]int {
 	// return map[string]int {and:0, or:0, not:0}
-	return map[string]int{lessthan: 0, greaterthan: 0, equalto: 0, lessthaneq: 0, greaterthaneq: 0, notequalto: 0}
+	return map[string]int{lessthan: 0, greaterthan: 0, equalto: 0, lessthaneq: 0, greaterthaneq: 0, notequalto: 0,
+		inlist: 0, matches: 0, inversion: 0, exists: 0, between: 0}
 }
 
 // Return a map of comparison operators that only work on strings
@@ -266,6 +289,11 @@ func stringOperators() map[string]int {
 	return map[string]int{equalto: 0, notequalto: 0}
 }
 
+// Return a map of comparison operators that have a special form of value, e.g. a list or a regular expression.
+func valueOperators() map[string]int {
+	return map[string]int{inlist: 0, matches: 0, inversion: 0, between: 0}
+}
+
 // This function checks the type of the input interface object to see if it's a map of string to
 // interface. Control operators and Properties are both of this type when deserialized by the
 // JSON library.
@@ -288,7 +316,7 @@ func isPropertyExpression(x interface{}) *PropertyExpression {
 		asMap := x.(map[string]interface{})
 		if _, ok := asMap["name"]; !ok {
 			return nil
-		} else if _, ok := asMap["value"]; !ok {
+		} else if _, ok := asMap["value"]; !ok && asMap["op"] != exists {
 			return nil
 		} else {
 			p := new(PropertyExpression)
@@ -372,13 +400,145 @@ func getKeys(m map[string]interface{}) []string {
 	return keys
 }
 
+// This function checks that the value of a PropertyExpression has the form that its operator
+// requires. The simple comparison operators accept any value.
+func (self *PropertyExpression) verifyValue() error {
+	switch self.Op {
+	case inlist:
+		if !isArray(self.Value) {
+			return errors.New(fmt.Sprintf("value %v is not a list", self.Value))
+		}
+	case matches:
+		if !isString(self.Value) {
+			return errors.New(fmt.Sprintf("value %v is not a string", self.Value))
+		} else if _, err := regexp.Compile(self.Value.(string)); err != nil {
+			return errors.New(fmt.Sprintf("value %v is not a regular expression, error: %v", self.Value, err))
+		}
+	case inversion:
+		if !isString(self.Value) {
+			return errors.New(fmt.Sprintf("value %v is not a string", self.Value))
+		} else if _, err := Version_Expression_Factory(self.Value.(string)); err != nil {
+			return err
+		}
+	case exists:
+		if self.Value != nil && !isBoolean(self.Value) {
+			return errors.New(fmt.Sprintf("value %v is not a boolean", self.Value))
+		}
+	case between:
+		if low, high, ok := numericRange(self.Value); !ok {
+			return errors.New(fmt.Sprintf("value %v is not a list of 2 numbers or 2 quantities", self.Value))
+		} else if low > high {
+			return errors.New(fmt.Sprintf("value %v has a lower bound that is greater than its upper bound", self.Value))
+		}
+	}
+	return nil
+}
+
+// This function extracts the bounds of the numeric range used by the between operator. It returns false
+// if the input is not a list of 2 numbers, or of 2 quantities with the same dimension.
+func numericRange(x interface{}) (float64, float64, bool) {
+	if !isArray(x) {
+		return 0, 0, false
+	}
+	bounds := x.([]interface{})
+	if len(bounds) != 2 {
+		return 0, 0, false
+	} else if isFloat64(bounds[0]) && isFloat64(bounds[1]) {
+		return bounds[0].(float64), bounds[1].(float64), true
+	} else if !isString(bounds[0]) || !isString(bounds[1]) {
+		return 0, 0, false
+	}
+
+	low, d1, err1 := ParseQuantity(bounds[0].(string))
+	high, d2, err2 := ParseQuantity(bounds[1].(string))
+	if err1 != nil || err2 != nil || d1 != d2 {
+		return 0, 0, false
+	}
+	return low, high, true
+}
+
+// This function returns true if the input value is equal to one of the elements in the input list. If the
+// value is itself a list, then one of its elements has to be in the input list.
+func valueInList(value interface{}, list []interface{}) bool {
+	if isArray(value) {
+		for _, v := range value.([]interface{}) {
+			if valueInList(v, list) {
+				return true
+			}
+		}
+		return false
+	}
+
+	for _, l := range list {
+		if (isFloat64(value) && isFloat64(l)) || (isString(value) && isString(l)) || (isBoolean(value) && isBoolean(l)) {
+			if value == l {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// This function compares a PropertyExpression that uses one of the operators which are not simple comparisons
+// against the value of a Property.
+func valueSatisfies(propexp *PropertyExpression, value interface{}) bool {
+	switch propexp.Op {
+	case inlist:
+		return isArray(propexp.Value) && valueInList(value, propexp.Value.([]interface{}))
+	case matches:
+		if !isString(value) || !isString(propexp.Value) {
+			return false
+		} else if re, err := regexp.Compile(propexp.Value.(string)); err != nil {
+			return false
+		} else {
+			return re.MatchString(value.(string))
+		}
+	case inversion:
+		if !isString(value) || !isString(propexp.Value) {
+			return false
+		} else if ve, err := Version_Expression_Factory(propexp.Value.(string)); err != nil {
+			return false
+		} else if inRange, err := ve.Is_within_range(value.(string)); err != nil {
+			return false
+		} else {
+			return inRange
+		}
+	case between:
+		if low, high, ok := numericRange(propexp.Value); !ok || !isFloat64(value) {
+			return false
+		} else {
+			return value.(float64) >= low && value.(float64) <= high
+		}
+	}
+	return false
+}
+
 // This function compares a Property object with an array of Property objects to see if it's
 // in the array with an appropriate value.
 func propertyInArray(propexp *PropertyExpression, props *[]Property) bool {
+
+	// The exists operator is only concerned with whether or not the property is present.
+	if propexp.Op == exists {
+		want := true
+		if isBoolean(propexp.Value) {
+			want = propexp.Value.(bool)
+		}
+		for _, p := range *props {
+			if p.Name == propexp.Name {
+				return want
+			}
+		}
+		return !want
+	}
+
 	for _, p := range *props {
 		if p.Name != propexp.Name {
 			// These are not the droids we're looking for
 			continue
+		} else if p.Type == PROPERTY_TYPE_QUANTITY || p.Type == PROPERTY_TYPE_VERSION {
+			return typedPropertySatisfies(p, propexp)
+		} else if _, ok := valueOperators()[propexp.Op]; ok {
+			return valueSatisfies(propexp, p.Value)
 		} else {
 			if isFloat64(p.Value) && isFloat64(propexp.Value) {
 				if propexp.Op == lessthan {
@@ -686,6 +686,119 @@ func Test_merge4(t *testing.T) {
 	}
 }
 
+// Test that expressions using the list, regex, version, existence and range operators are validated.
+func Test_valid_operators1(t *testing.T) {
+
+	valid := []string{
+		`{"and":[{"name":"prop1", "value":["val1","val2"], "op":"in"}]}`,
+		`{"and":[{"name":"prop1", "value":"^val[0-9]+$", "op":"matches"}]}`,
+		`{"and":[{"name":"prop1", "value":"[1.0.0,2.0.0)", "op":"version"}]}`,
+		`{"and":[{"name":"prop1", "value":"1.2", "op":"version"}]}`,
+		`{"and":[{"name":"prop1", "op":"exists"}]}`,
+		`{"or":[{"name":"prop1", "value":false, "op":"exists"}]}`,
+		`{"and":[{"name":"prop1", "value":[1,5.5], "op":"between"}]}`,
+	}
+
+	for _, exp := range valid {
+		if rp := create_RP(exp, t); rp != nil {
+			if err := rp.IsValid(); err != nil {
+				t.Errorf("Error: %v should be valid, error: %v\n", exp, err)
+			}
+		}
+	}
+
+	invalid := []string{
+		`{"and":[{"name":"prop1", "value":"val1", "op":"in"}]}`,
+		`{"and":[{"name":"prop1", "value":"val[", "op":"matches"}]}`,
+		`{"and":[{"name":"prop1", "value":5, "op":"matches"}]}`,
+		`{"and":[{"name":"prop1", "value":"[1.0.0,", "op":"version"}]}`,
+		`{"and":[{"name":"prop1", "value":"yes", "op":"exists"}]}`,
+		`{"and":[{"name":"prop1", "op":"="}]}`,
+		`{"and":[{"name":"prop1", "value":[1], "op":"between"}]}`,
+		`{"and":[{"name":"prop1", "value":[5,1], "op":"between"}]}`,
+		`{"and":[{"name":"prop1", "value":["1","5"], "op":"between"}]}`,
+	}
+
+	for _, exp := range invalid {
+		if rp := create_RP(exp, t); rp != nil {
+			if err := rp.IsValid(); err == nil {
+				t.Errorf("Error: %v is an invalid RequiredProperty value, but it was not detected as invalid.\n", exp)
+			}
+		}
+	}
+}
+
+// Test that the list, regex, version, existence and range operators are evaluated correctly.
+func Test_satisfy_operators1(t *testing.T) {
+
+	prop_list := `[{"name":"region", "value":"us-east"}, {"name":"version", "value":"1.4.2"}, {"name":"cpus", "value":4},
+		{"name":"tags", "value":["gpu","ssd"]}, {"name":"secure", "value":true}]`
+
+	satisfied := []string{
+		`{"and":[{"name":"region", "value":["us-east","us-west"], "op":"in"}]}`,
+		`{"and":[{"name":"cpus", "value":[2,4,8], "op":"in"}]}`,
+		`{"and":[{"name":"tags", "value":["ssd"], "op":"in"}]}`,
+		`{"and":[{"name":"region", "value":"^us-", "op":"matches"}]}`,
+		`{"and":[{"name":"version", "value":"[1.0.0,2.0.0)", "op":"version"}]}`,
+		`{"and":[{"name":"version", "value":"1.4", "op":"version"}]}`,
+		`{"and":[{"name":"secure", "op":"exists"}]}`,
+		`{"and":[{"name":"missing", "value":false, "op":"exists"}]}`,
+		`{"and":[{"name":"cpus", "value":[4,16], "op":"between"}]}`,
+		`{"or":[{"name":"region", "value":"eu-.*", "op":"matches"},{"name":"cpus", "value":[1,4], "op":"between"}]}`,
+	}
+
+	not_satisfied := []string{
+		`{"and":[{"name":"region", "value":["eu-west"], "op":"in"}]}`,
+		`{"and":[{"name":"cpus", "value":["4"], "op":"in"}]}`,
+		`{"and":[{"name":"tags", "value":["arm"], "op":"in"}]}`,
+		`{"and":[{"name":"region", "value":"^eu-", "op":"matches"}]}`,
+		`{"and":[{"name":"cpus", "value":"4", "op":"matches"}]}`,
+		`{"and":[{"name":"version", "value":"[2.0.0,3.0.0)", "op":"version"}]}`,
+		`{"and":[{"name":"region", "value":"1.0.0", "op":"version"}]}`,
+		`{"and":[{"name":"missing", "op":"exists"}]}`,
+		`{"and":[{"name":"secure", "value":false, "op":"exists"}]}`,
+		`{"and":[{"name":"cpus", "value":[5,16], "op":"between"}]}`,
+		`{"and":[{"name":"region", "value":[1,16], "op":"between"}]}`,
+	}
+
+	if pa := create_property_list(prop_list, t); pa != nil {
+		for _, exp := range satisfied {
+			if rp := create_RP(exp, t); rp != nil {
+				if err := rp.IsSatisfiedBy(*pa); err != nil {
+					t.Errorf("Error: %v should be satisfied by %v, error: %v\n", exp, *pa, err)
+				}
+			}
+		}
+
+		for _, exp := range not_satisfied {
+			if rp := create_RP(exp, t); rp != nil {
+				if err := rp.IsSatisfiedBy(*pa); err == nil {
+					t.Errorf("Error: %v should not be satisfied by %v\n", exp, *pa)
+				}
+			}
+		}
+	}
+}
+
+// Test that expressions using the new operators can still be merged.
+func Test_merge_operators1(t *testing.T) {
+
+	simple1 := `{"and":[{"name":"region", "value":["us-east","us-west"], "op":"in"}]}`
+	simple2 := `{"or":[{"name":"version", "value":"[1.0.0,2.0.0)", "op":"version"},{"name":"legacy", "op":"exists"}]}`
+	if rp1 := create_RP(simple1, t); rp1 != nil {
+		if rp2 := create_RP(simple2, t); rp2 != nil {
+			rp3 := rp1.Merge(rp2)
+			if err := rp3.IsValid(); err != nil {
+				t.Errorf("Error: Merged RequiredProperty %v should be valid, error: %v\n", *rp3, err)
+			} else if pa := create_property_list(`[{"name":"region", "value":"us-west"}, {"name":"version", "value":"1.0.0"}]`, t); pa != nil {
+				if err := rp3.IsSatisfiedBy(*pa); err != nil {
+					t.Error(err)
+				}
+			}
+		}
+	}
+}
+
 // ================================================================================================================
 // Helper functions used by all tests
 //
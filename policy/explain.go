@@ -0,0 +1,207 @@
+package policy
+
+import (
+	"fmt"
+)
+
+// The purpose of this file is to provide APIs that explain why 2 policies are (or are not) compatible
+// with each other. The compatibility APIs in policy_file.go stop at the first clause that fails and
+// return a single error. The functions in this file evaluate every clause and return a structured
+// result so that the caller (usually an operator) can see exactly which clause blocked an agreement.
+
+// These are the names of the policy clauses that are evaluated.
+const EXPLAIN_VERSION = "schemaVersion"
+const EXPLAIN_API_SPECS = "apiSpecs"
+const EXPLAIN_AGREEMENT_PROTOCOLS = "agreementProtocols"
+const EXPLAIN_BLOCKCHAINS = "blockchains"
+const EXPLAIN_CONSUMER_PROPERTIES = "consumerCounterPartyProperties"
+const EXPLAIN_PRODUCER_PROPERTIES = "producerCounterPartyProperties"
+const EXPLAIN_PROPERTIES = "properties"
+const EXPLAIN_RESOURCE_LIMITS = "resourceLimits"
+const EXPLAIN_DATA_VERIFICATION = "dataVerification"
+const EXPLAIN_HA_GROUP = "haGroup"
+const EXPLAIN_AVAILABILITY = "availability"
+const EXPLAIN_PATTERN = "pattern"
+
+// The result of evaluating a single policy clause.
+type ClauseResult struct {
+	Clause     string `json:"clause"`           // The name of the clause, one of the EXPLAIN_ constants
+	Compatible bool   `json:"compatible"`       // True if the clause does not block a match
+	Reason     string `json:"reason,omitempty"` // Why the clause failed, empty when the clause is compatible
+}
+
+func (c ClauseResult) String() string {
+	if c.Compatible {
+		return fmt.Sprintf("%v: compatible", c.Clause)
+	}
+	return fmt.Sprintf("%v: incompatible, %v", c.Clause, c.Reason)
+}
+
+// The result of evaluating all the clauses of 2 policies.
+type CompatibilityExplanation struct {
+	Policy1    string         `json:"policy1"`    // The name of the first policy, usually the producer
+	Policy2    string         `json:"policy2"`    // The name of the second policy, usually the consumer
+	Compatible bool           `json:"compatible"` // True if all clauses are compatible
+	Clauses    []ClauseResult `json:"clauses"`
+}
+
+func (c CompatibilityExplanation) String() string {
+	res := fmt.Sprintf("Policy1: %v, Policy2: %v, Compatible: %v", c.Policy1, c.Policy2, c.Compatible)
+	for _, cr := range c.Clauses {
+		res += ", " + cr.String()
+	}
+	return res
+}
+
+func NewCompatibilityExplanation(name1 string, name2 string) *CompatibilityExplanation {
+	return &CompatibilityExplanation{
+		Policy1:    name1,
+		Policy2:    name2,
+		Compatible: true,
+		Clauses:    make([]ClauseResult, 0, 10),
+	}
+}
+
+// Record the result of a clause evaluation. A nil error means the clause is compatible.
+func (c *CompatibilityExplanation) Add(clause string, err error) {
+	cr := ClauseResult{Clause: clause, Compatible: err == nil}
+	if err != nil {
+		cr.Reason = err.Error()
+		c.Compatible = false
+	}
+	c.Clauses = append(c.Clauses, cr)
+}
+
+// Return the clause results that are incompatible.
+func (c *CompatibilityExplanation) Failures() []ClauseResult {
+	res := make([]ClauseResult, 0, 5)
+	for _, cr := range c.Clauses {
+		if !cr.Compatible {
+			res = append(res, cr)
+		}
+	}
+	return res
+}
+
+// This function evaluates the same clauses as Are_Compatible, in the same order, but it evaluates all
+// of them. The order of parameters is the same as Are_Compatible; the producer policy first and then
+// the consumer policy.
+func Explain_Compatibility(producer_policy *Policy, consumer_policy *Policy) *CompatibilityExplanation {
+
+	ex := NewCompatibilityExplanation(producer_policy.Header.Name, consumer_policy.Header.Name)
+
+	if !consumer_policy.Is_Version(producer_policy.Header.Version) {
+		ex.Add(EXPLAIN_VERSION, fmt.Errorf("schema versions are not the same, consumer policy: %v, producer policy %v", consumer_policy.Header.Version, producer_policy.Header.Version))
+	} else {
+		ex.Add(EXPLAIN_VERSION, nil)
+	}
+
+	if err := producer_policy.APISpecs.Supports(consumer_policy.APISpecs); err != nil {
+		ex.Add(EXPLAIN_API_SPECS, fmt.Errorf("producer policy APISpecs %v do not support consumer APISpec requirements %v, error: %v", producer_policy.APISpecs, consumer_policy.APISpecs, err))
+	} else {
+		ex.Add(EXPLAIN_API_SPECS, nil)
+	}
+
+	if err := (&consumer_policy.CounterPartyProperties).IsSatisfiedBy(producer_policy.Properties); err != nil {
+		ex.Add(EXPLAIN_CONSUMER_PROPERTIES, fmt.Errorf("producer properties %v do not satisfy consumer property requirements %v, error: %v", producer_policy.Properties, consumer_policy.CounterPartyProperties, err))
+	} else {
+		ex.Add(EXPLAIN_CONSUMER_PROPERTIES, nil)
+	}
+
+	if err := (&producer_policy.CounterPartyProperties).IsSatisfiedBy(consumer_policy.Properties); err != nil {
+		ex.Add(EXPLAIN_PRODUCER_PROPERTIES, fmt.Errorf("consumer properties %v do not satisfy producer property requirements %v, error: %v", consumer_policy.Properties, producer_policy.CounterPartyProperties, err))
+	} else {
+		ex.Add(EXPLAIN_PRODUCER_PROPERTIES, nil)
+	}
+
+	explainAgreementProtocols(ex, &producer_policy.AgreementProtocols, &consumer_policy.AgreementProtocols)
+
+	if err := (&consumer_policy.ResourceLimits).CheckSatisfiedBy(&producer_policy.ResourceLimits); err != nil {
+		ex.Add(EXPLAIN_RESOURCE_LIMITS, fmt.Errorf("producer resource limits %v do not satisfy consumer resource requirements %v, error: %v", producer_policy.ResourceLimits, consumer_policy.ResourceLimits, err))
+	} else {
+		ex.Add(EXPLAIN_RESOURCE_LIMITS, nil)
+	}
+
+	if !producer_policy.DataVerify.IsCompatibleWith(consumer_policy.DataVerify) {
+		ex.Add(EXPLAIN_DATA_VERIFICATION, fmt.Errorf("producer has %v and consumer has %v", producer_policy.DataVerify, consumer_policy.DataVerify))
+	} else {
+		ex.Add(EXPLAIN_DATA_VERIFICATION, nil)
+	}
+
+	if !(&producer_policy.Availability).Compatible_With(&consumer_policy.Availability) {
+		ex.Add(EXPLAIN_AVAILABILITY, fmt.Errorf("producer %v and consumer %v are never open at the same time", producer_policy.Availability, consumer_policy.Availability))
+	} else {
+		ex.Add(EXPLAIN_AVAILABILITY, nil)
+	}
+
+	return ex
+}
+
+// This function evaluates the same clauses as Are_Compatible_Producers, but it evaluates all of them and
+// does not produce a merged policy.
+func Explain_Compatible_Producers(producer_policy1 *Policy, producer_policy2 *Policy) *CompatibilityExplanation {
+
+	ex := NewCompatibilityExplanation(producer_policy1.Header.Name, producer_policy2.Header.Name)
+
+	if !producer_policy1.Is_Version(producer_policy2.Header.Version) {
+		ex.Add(EXPLAIN_VERSION, fmt.Errorf("schema versions are not the same, policy1: %v, policy2 %v", producer_policy1.Header.Version, producer_policy2.Header.Version))
+	} else {
+		ex.Add(EXPLAIN_VERSION, nil)
+	}
+
+	explainAgreementProtocols(ex, &producer_policy1.AgreementProtocols, &producer_policy2.AgreementProtocols)
+
+	if err := (&producer_policy1.Properties).Compatible_With(&producer_policy2.Properties); err != nil {
+		ex.Add(EXPLAIN_PROPERTIES, fmt.Errorf("common properties between %v and %v are not compatible, error: %v", producer_policy1.Properties, producer_policy2.Properties, err))
+	} else {
+		ex.Add(EXPLAIN_PROPERTIES, nil)
+	}
+
+	if !producer_policy1.DataVerify.IsProducerCompatible(producer_policy2.DataVerify) {
+		ex.Add(EXPLAIN_DATA_VERIFICATION, fmt.Errorf("data verification must be compatible between %v and %v", producer_policy1.DataVerify, producer_policy2.DataVerify))
+	} else {
+		ex.Add(EXPLAIN_DATA_VERIFICATION, nil)
+	}
+
+	if !producer_policy1.HAGroup.Compatible_With(&producer_policy2.HAGroup) {
+		ex.Add(EXPLAIN_HA_GROUP, fmt.Errorf("HA groups must be compatible between %v and %v", producer_policy1.HAGroup, producer_policy2.HAGroup))
+	} else {
+		ex.Add(EXPLAIN_HA_GROUP, nil)
+	}
+
+	if !(&producer_policy1.Availability).Compatible_With(&producer_policy2.Availability) {
+		ex.Add(EXPLAIN_AVAILABILITY, fmt.Errorf("%v and %v are never open at the same time", producer_policy1.Availability, producer_policy2.Availability))
+	} else {
+		ex.Add(EXPLAIN_AVAILABILITY, nil)
+	}
+
+	return ex
+}
+
+// The agreement protocol intersection API reports a single error when either the protocol names don't
+// intersect or when the blockchains of a commonly named protocol don't intersect. Split these 2 cases into
+// separate clauses so that the caller can tell them apart.
+func explainAgreementProtocols(ex *CompatibilityExplanation, agps1 *AgreementProtocolList, agps2 *AgreementProtocolList) {
+
+	if _, err := agps1.Intersects_With(agps2); err == nil {
+		ex.Add(EXPLAIN_AGREEMENT_PROTOCOLS, nil)
+		ex.Add(EXPLAIN_BLOCKCHAINS, nil)
+		return
+	}
+
+	// Find the protocols that are common by name. If there aren't any, then the blockchains dont matter.
+	commonNames := make([]string, 0, 5)
+	for _, agp1 := range *agps1 {
+		if agps2.FindByName(agp1.Name) != nil {
+			commonNames = append(commonNames, agp1.Name)
+		}
+	}
+
+	if len(commonNames) == 0 {
+		ex.Add(EXPLAIN_AGREEMENT_PROTOCOLS, fmt.Errorf("no common agreement protocols between %v and %v", agps1.As_String_Array(), agps2.As_String_Array()))
+		ex.Add(EXPLAIN_BLOCKCHAINS, nil)
+	} else {
+		ex.Add(EXPLAIN_AGREEMENT_PROTOCOLS, nil)
+		ex.Add(EXPLAIN_BLOCKCHAINS, fmt.Errorf("no common blockchains for agreement protocols %v between %v and %v", commonNames, *agps1, *agps2))
+	}
+}
@@ -0,0 +1,77 @@
+// +build unit
+
+package policy
+
+import (
+	"testing"
+)
+
+// A compatible producer and consumer should have every clause compatible.
+func Test_Explain_Compatible(t *testing.T) {
+
+	if pf_prod, err := ReadPolicyFile("./test/pfcompat1/testorg/device.policy", make(map[string]string)); err != nil {
+		t.Error(err)
+	} else if pf_con, err := ReadPolicyFile("./test/pfcompat1/testorg/agbot.policy", make(map[string]string)); err != nil {
+		t.Error(err)
+	} else if ex := Explain_Compatibility(pf_prod, pf_con); !ex.Compatible {
+		t.Errorf("Error: %v should be compatible", ex)
+	} else if len(ex.Failures()) != 0 {
+		t.Errorf("Error: %v should have no failed clauses", ex)
+	} else if len(ex.Clauses) != 9 {
+		t.Errorf("Error: %v should have 9 clauses, has %v", ex, len(ex.Clauses))
+	}
+}
+
+// An incompatible producer and consumer should report all the failed clauses, not just the first one.
+func Test_Explain_Incompatible(t *testing.T) {
+
+	if pf_prod, err := ReadPolicyFile("./test/pfincompat1/device.policy", make(map[string]string)); err != nil {
+		t.Error(err)
+	} else if pf_con, err := ReadPolicyFile("./test/pfincompat1/agbot.policy", make(map[string]string)); err != nil {
+		t.Error(err)
+	} else if ex := Explain_Compatibility(pf_prod, pf_con); ex.Compatible {
+		t.Errorf("Error: %v should not be compatible", ex)
+	} else if failures := ex.Failures(); len(failures) != 2 {
+		t.Errorf("Error: %v should have 2 failed clauses, has %v", ex, failures)
+	} else if failures[0].Clause != EXPLAIN_API_SPECS || failures[0].Reason == "" {
+		t.Errorf("Error: first failure should be %v, is %v", EXPLAIN_API_SPECS, failures[0])
+	} else if failures[1].Clause != EXPLAIN_AGREEMENT_PROTOCOLS || failures[1].Reason == "" {
+		t.Errorf("Error: second failure should be %v, is %v", EXPLAIN_AGREEMENT_PROTOCOLS, failures[1])
+	}
+}
+
+// Agreement protocols with the same name but different blockchains should be reported as a blockchain failure.
+func Test_Explain_Blockchains(t *testing.T) {
+
+	pol1 := Policy_Factory("pol1")
+	agp1 := AgreementProtocol_Factory(CitizenScientist)
+	agp1.Blockchains.Add_Blockchain(Blockchain_Factory(Ethereum_bc, "bc1", "myorg"))
+	pol1.Add_Agreement_Protocol(agp1)
+
+	pol2 := Policy_Factory("pol2")
+	agp2 := AgreementProtocol_Factory(CitizenScientist)
+	agp2.Blockchains.Add_Blockchain(Blockchain_Factory(Ethereum_bc, "bc2", "myorg"))
+	pol2.Add_Agreement_Protocol(agp2)
+
+	if ex := Explain_Compatible_Producers(pol1, pol2); ex.Compatible {
+		t.Errorf("Error: %v should not be compatible", ex)
+	} else if failures := ex.Failures(); len(failures) != 1 || failures[0].Clause != EXPLAIN_BLOCKCHAINS {
+		t.Errorf("Error: %v should have only a blockchain failure", ex)
+	}
+}
+
+// Resource limits should identify the limit that is not satisfied.
+func Test_Explain_ResourceLimits(t *testing.T) {
+
+	pol1 := Policy_Factory("producer")
+	pol1.ResourceLimits = ResourceLimit{Memory: 1024}
+
+	pol2 := Policy_Factory("consumer")
+	pol2.ResourceLimits = ResourceLimit{Memory: 2048}
+
+	if ex := Explain_Compatibility(pol1, pol2); ex.Compatible {
+		t.Errorf("Error: %v should not be compatible", ex)
+	} else if failures := ex.Failures(); len(failures) != 1 || failures[0].Clause != EXPLAIN_RESOURCE_LIMITS {
+		t.Errorf("Error: %v should have only a resource limit failure", ex)
+	}
+}
@@ -0,0 +1,342 @@
+package policy
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// The purpose of this file is to statically check policy documents before they are deployed. Is_Self_Consistent
+// stops at the first problem in a policy that anax has already loaded, the linter reports all of the problems
+// it can find in a serialized policy document. Each problem is located by a JSON pointer (RFC 6901) into the
+// document.
+
+type LintIssue struct {
+	File     string `json:"file,omitempty"` // The file holding the document, when the document was read from a file
+	Location string `json:"location"`       // A JSON pointer to the part of the document that has the problem
+	Message  string `json:"message"`
+}
+
+func (i LintIssue) String() string {
+	location := i.Location
+	if location == "" {
+		location = "/"
+	}
+	if i.File != "" {
+		return fmt.Sprintf("%v: %v: %v", i.File, location, i.Message)
+	}
+	return fmt.Sprintf("%v: %v", location, i.Message)
+}
+
+// These are the sections of a policy document that were added in schema version 2.0.
+var version2Sections = []string{"properties", "counterPartyProperties", "requiredWorkload", "ha_group", "nodeHealth", "availability", "placement", "spread"}
+
+// Lint a serialized policy document. The workloadResolver is optional, when it is nil the workload references
+// are checked for completeness but not resolved.
+func LintPolicy(doc []byte, workloadResolver func(wURL string, wOrg string, wVersion string, wArch string) (*APISpecList, error)) []LintIssue {
+	issues := make([]LintIssue, 0, 10)
+
+	var generic map[string]interface{}
+	if err := json.Unmarshal(doc, &generic); err != nil {
+		return append(issues, LintIssue{Message: fmt.Sprintf("not a JSON object, error: %v", err)})
+	}
+
+	pol := new(Policy)
+	if err := json.Unmarshal(doc, pol); err != nil {
+		return append(issues, LintIssue{Message: fmt.Sprintf("not a policy document, error: %v", err)})
+	}
+
+	issues = append(issues, LintUnknownFields(generic, pol)...)
+	issues = append(issues, pol.lintHeader(generic)...)
+	issues = append(issues, pol.lintProperties()...)
+	issues = append(issues, pol.lintHAGroup()...)
+	issues = append(issues, LintDataVerification(pol.DataVerify, pol.NodeH, JSONPointer("dataVerification"))...)
+	issues = append(issues, pol.lintWorkloads(workloadResolver)...)
+
+	for ix, agp := range pol.AgreementProtocols {
+		if err := agp.IsValid(); err != nil {
+			issues = append(issues, LintIssue{Location: JSONPointer("agreementProtocols", ix), Message: err.Error()})
+		}
+	}
+
+	if err := pol.Availability.IsValid(); err != nil {
+		issues = append(issues, LintIssue{Location: JSONPointer("availability"), Message: err.Error()})
+	}
+
+	for ix, pref := range pol.Placement {
+		if err := pref.IsValid(); err != nil {
+			issues = append(issues, LintIssue{Location: JSONPointer("placement", ix), Message: err.Error()})
+		}
+	}
+
+	for ix, c := range pol.Spread {
+		if err := c.IsValid(); err != nil {
+			issues = append(issues, LintIssue{Location: JSONPointer("spread", ix), Message: err.Error()})
+		}
+	}
+
+	SortLintIssues(issues)
+	return issues
+}
+
+// Lint a set of policy files. Policy files that are deployed together are also checked for conflicts with
+// each other, e.g. the policies on a node have to agree on the node's HA group.
+func LintPolicyFiles(names []string, workloadResolver func(wURL string, wOrg string, wVersion string, wArch string) (*APISpecList, error)) []LintIssue {
+	issues := make([]LintIssue, 0, 10)
+
+	haFile := ""
+	var haGroup *HighAvailabilityGroup
+
+	for _, name := range names {
+		doc, err := ioutil.ReadFile(name)
+		if err != nil {
+			issues = append(issues, LintIssue{File: name, Message: fmt.Sprintf("unable to read file, error: %v", err)})
+			continue
+		}
+
+		for _, issue := range LintPolicy(doc, workloadResolver) {
+			issue.File = name
+			issues = append(issues, issue)
+		}
+
+		pol := new(Policy)
+		if err := json.Unmarshal(doc, pol); err != nil || len(pol.HAGroup.Partners) == 0 {
+			continue
+		} else if haGroup == nil {
+			haFile = name
+			haGroup = &pol.HAGroup
+		} else if !haGroup.IsSame(&pol.HAGroup) {
+			issues = append(issues, LintIssue{File: name, Location: JSONPointer("ha_group", "partners"),
+				Message: fmt.Sprintf("HA group partners %v conflict with partners %v in %v, a node can only be in 1 HA group", pol.HAGroup.Partners, haGroup.Partners, haFile)})
+		}
+	}
+
+	return issues
+}
+
+// Build a JSON pointer from a list of object keys and array indexes.
+func JSONPointer(tokens ...interface{}) string {
+	res := ""
+	for _, token := range tokens {
+		t := fmt.Sprintf("%v", token)
+		t = strings.Replace(t, "~", "~0", -1)
+		t = strings.Replace(t, "/", "~1", -1)
+		res += "/" + t
+	}
+	return res
+}
+
+// Report the keys in a generic JSON document that do not correspond to a field of the struct that the document
+// is demarshalled into. The JSON library silently ignores these keys, which usually hides a misspelling.
+func LintUnknownFields(doc interface{}, obj interface{}) []LintIssue {
+	issues := make([]LintIssue, 0, 5)
+	unknownFields(doc, reflect.TypeOf(obj), "", &issues)
+	return issues
+}
+
+func unknownFields(doc interface{}, t reflect.Type, pointer string, issues *[]LintIssue) {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	switch t.Kind() {
+	case reflect.Struct:
+		m, ok := doc.(map[string]interface{})
+		if !ok {
+			return
+		}
+		for key, val := range m {
+			if field, found := jsonField(t, key); !found {
+				*issues = append(*issues, LintIssue{Location: pointer + JSONPointer(key), Message: fmt.Sprintf("unknown field %v", key)})
+			} else {
+				unknownFields(val, field.Type, pointer+JSONPointer(key), issues)
+			}
+		}
+	case reflect.Slice, reflect.Array:
+		if a, ok := doc.([]interface{}); ok {
+			for ix, val := range a {
+				unknownFields(val, t.Elem(), pointer+JSONPointer(ix), issues)
+			}
+		}
+	case reflect.Map:
+		if m, ok := doc.(map[string]interface{}); ok {
+			for key, val := range m {
+				unknownFields(val, t.Elem(), pointer+JSONPointer(key), issues)
+			}
+		}
+	}
+}
+
+// Find the struct field that the JSON library would demarshal the given key into. Like the JSON library,
+// the match is not case sensitive.
+func jsonField(t reflect.Type, key string) (reflect.StructField, bool) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name := field.Name
+		if tag := field.Tag.Get("json"); tag == "-" {
+			continue
+		} else if tagName := strings.Split(tag, ",")[0]; tagName != "" {
+			name = tagName
+		}
+		if strings.EqualFold(name, key) {
+			return field, true
+		}
+	}
+	return reflect.StructField{}, false
+}
+
+func (self *Policy) lintHeader(generic map[string]interface{}) []LintIssue {
+	issues := make([]LintIssue, 0, 2)
+
+	if self.Header.Name == "" {
+		issues = append(issues, LintIssue{Location: JSONPointer("header", "name"), Message: "the policy has no name"})
+	}
+
+	if self.Header.Version != version1 && self.Header.Version != version2 {
+		issues = append(issues, LintIssue{Location: JSONPointer("header", "version"), Message: fmt.Sprintf("schema version %v is not one of %v or %v", self.Header.Version, version1, version2)})
+	} else if self.Header.Version == version1 {
+		for _, section := range version2Sections {
+			if _, ok := generic[section]; ok {
+				issues = append(issues, LintIssue{Location: JSONPointer(section), Message: fmt.Sprintf("section %v requires schema version %v", section, version2)})
+			}
+		}
+	}
+	return issues
+}
+
+func (self *Policy) lintProperties() []LintIssue {
+	issues := make([]LintIssue, 0, 2)
+
+	names := make(map[string]int)
+	for ix, prop := range self.Properties {
+		if err := prop.Validate(); err != nil {
+			issues = append(issues, LintIssue{Location: JSONPointer("properties", ix), Message: err.Error()})
+		}
+		if first, ok := names[prop.Name]; ok {
+			issues = append(issues, LintIssue{Location: JSONPointer("properties", ix, "name"), Message: fmt.Sprintf("property %v is already defined at %v", prop.Name, JSONPointer("properties", first))})
+		} else {
+			names[prop.Name] = ix
+		}
+	}
+
+	if err := self.CounterPartyProperties.IsValid(); err != nil {
+		issues = append(issues, LintIssue{Location: JSONPointer("counterPartyProperties"), Message: err.Error()})
+	}
+	return issues
+}
+
+func (self *Policy) lintHAGroup() []LintIssue {
+	issues := make([]LintIssue, 0, 2)
+
+	partners := make(map[string]bool)
+	for ix, partner := range self.HAGroup.Partners {
+		if partner == "" {
+			issues = append(issues, LintIssue{Location: JSONPointer("ha_group", "partners", ix), Message: "the HA partner id is empty"})
+		} else if partners[partner] {
+			issues = append(issues, LintIssue{Location: JSONPointer("ha_group", "partners", ix), Message: fmt.Sprintf("HA partner %v is listed more than once", partner)})
+		}
+		partners[partner] = true
+	}
+	return issues
+}
+
+// Lint the data verification section of a policy or of a workload in a pattern, relative to its node health
+// section. The location is a JSON pointer to the data verification section.
+func LintDataVerification(dv DataVerification, nh NodeHealth, location string) []LintIssue {
+	issues := make([]LintIssue, 0, 2)
+
+	if ok, err := dv.IsValid(); !ok {
+		issues = append(issues, LintIssue{Location: location, Message: err.Error()})
+	}
+
+	// The agbot only looks at an agreement as often as the node health policy says to check it, so data
+	// cannot be found missing sooner than that.
+	if dv.Interval != 0 && nh.CheckAgreementStatus != 0 && dv.Interval < nh.CheckAgreementStatus {
+		issues = append(issues, LintIssue{Location: location + JSONPointer("interval"),
+			Message: fmt.Sprintf("data verification interval %v seconds can never be met, agreements are only checked every %v seconds (nodeHealth check_agreement_status)", dv.Interval, nh.CheckAgreementStatus)})
+	}
+	return issues
+}
+
+func (self *Policy) lintWorkloads(workloadResolver func(wURL string, wOrg string, wVersion string, wArch string) (*APISpecList, error)) []LintIssue {
+	issues := make([]LintIssue, 0, 2)
+
+	priorities := make(map[int]int)
+	var firstAPISpecs *APISpecList
+	for ix, workload := range self.Workloads {
+		if len(self.Workloads) > 1 {
+			pointer := JSONPointer("workloads", ix, "priority", "priority_value")
+			if workload.Priority.PriorityValue == 0 {
+				issues = append(issues, LintIssue{Location: pointer, Message: "a priority is required when there is more than 1 workload"})
+			} else if first, ok := priorities[workload.Priority.PriorityValue]; ok {
+				issues = append(issues, LintIssue{Location: pointer, Message: fmt.Sprintf("priority %v is already used by %v", workload.Priority.PriorityValue, JSONPointer("workloads", first))})
+			} else {
+				priorities[workload.Priority.PriorityValue] = ix
+			}
+		}
+
+		// Workloads in the exchange are referenced by url, org, version range and architecture.
+		if workload.WorkloadURL == "" {
+			if workload.Deployment == "" {
+				issues = append(issues, LintIssue{Location: JSONPointer("workloads", ix), Message: "the workload has neither a workloadUrl nor a deployment"})
+			}
+			continue
+		} else if workload.Org == "" {
+			issues = append(issues, LintIssue{Location: JSONPointer("workloads", ix, "organization"), Message: fmt.Sprintf("workload %v has no organization", workload.WorkloadURL)})
+		}
+
+		if workload.Version != "" {
+			if _, err := Version_Expression_Factory(workload.Version); err != nil {
+				issues = append(issues, LintIssue{Location: JSONPointer("workloads", ix, "version"), Message: err.Error()})
+				continue
+			}
+		}
+
+		if workloadResolver != nil && workload.Org != "" {
+			if apiSpecs, err := workloadResolver(workload.WorkloadURL, workload.Org, workload.Version, workload.Arch); err != nil {
+				issues = append(issues, LintIssue{Location: JSONPointer("workloads", ix, "workloadUrl"), Message: fmt.Sprintf("workload %v does not resolve, error: %v", workload.WorkloadURL, err)})
+			} else if firstAPISpecs == nil {
+				firstAPISpecs = apiSpecs
+			} else if !firstAPISpecs.IsSame(*apiSpecs, false) {
+				issues = append(issues, LintIssue{Location: JSONPointer("workloads", ix, "workloadUrl"), Message: fmt.Sprintf("workload %v uses API specs %v, which are not the API specs %v of the other workloads", workload.WorkloadURL, *apiSpecs, *firstAPISpecs)})
+			}
+		}
+	}
+	return issues
+}
+
+// Lint issues are usually displayed in the order of their location.
+func SortLintIssues(issues []LintIssue) {
+	sort.Stable(lintIssuesByLocation(issues))
+}
+
+type lintIssuesByLocation []LintIssue
+
+func (l lintIssuesByLocation) Len() int           { return len(l) }
+func (l lintIssuesByLocation) Swap(i, j int)      { l[i], l[j] = l[j], l[i] }
+func (l lintIssuesByLocation) Less(i, j int) bool { return lintIssueLess(l[i], l[j]) }
+
+func lintIssueLess(a LintIssue, b LintIssue) bool {
+	if a.File != b.File {
+		return a.File < b.File
+	}
+	at := strings.Split(a.Location, "/")
+	bt := strings.Split(b.Location, "/")
+	for ix := 0; ix < len(at) && ix < len(bt); ix++ {
+		if at[ix] == bt[ix] {
+			continue
+		}
+		// Array indexes are compared as numbers so that /workloads/10 comes after /workloads/9.
+		ai, aErr := strconv.Atoi(at[ix])
+		bi, bErr := strconv.Atoi(bt[ix])
+		if aErr == nil && bErr == nil {
+			return ai < bi
+		}
+		return at[ix] < bt[ix]
+	}
+	return len(at) < len(bt)
+}
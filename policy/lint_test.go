@@ -0,0 +1,157 @@
+// +build unit
+
+package policy
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// Returns true if one of the issues is at the given location.
+func hasIssueAt(issues []LintIssue, location string) bool {
+	for _, issue := range issues {
+		if issue.Location == location {
+			return true
+		}
+	}
+	return false
+}
+
+func Test_LintPolicy_clean(t *testing.T) {
+	doc := `{"header":{"name":"clean","version":"2.0"},
+		"agreementProtocols":[{"name":"Basic"}],
+		"workloads":[{"workloadUrl":"https://bluehorizon.network/workloads/netspeed","organization":"myorg","version":"[1.0.0,2.0.0)","arch":"amd64"}],
+		"properties":[{"name":"memory","value":"512MiB","type":"quantity"}],
+		"counterPartyProperties":{"and":[{"name":"rpiprop1","value":"rpival1","op":"="}]},
+		"ha_group":{"partners":["node1"]},
+		"dataVerification":{"enabled":true,"URL":"","interval":240},
+		"nodeHealth":{"missing_heartbeat_interval":600,"check_agreement_status":120}}`
+
+	if issues := LintPolicy([]byte(doc), nil); len(issues) != 0 {
+		t.Errorf("Error: expected no issues, got %v", issues)
+	}
+}
+
+func Test_LintPolicy_header(t *testing.T) {
+	if issues := LintPolicy([]byte(`{"header":{"version":"3.0"}}`), nil); !hasIssueAt(issues, "/header/name") || !hasIssueAt(issues, "/header/version") {
+		t.Errorf("Error: expected name and version issues, got %v", issues)
+	}
+
+	if issues := LintPolicy([]byte(`{"header":{"name":"v1","version":"1.0"},"ha_group":{"partners":["node1"]}}`), nil); !hasIssueAt(issues, "/ha_group") {
+		t.Errorf("Error: expected a version 2.0 section issue, got %v", issues)
+	}
+
+	if issues := LintPolicy([]byte(`not json`), nil); len(issues) != 1 || issues[0].Location != "" {
+		t.Errorf("Error: expected 1 document issue, got %v", issues)
+	}
+}
+
+func Test_LintPolicy_unknown_fields(t *testing.T) {
+	doc := `{"header":{"name":"typo","version":"2.0","author":"me"},
+		"workloads":[{"workloadUrl":"https://bluehorizon.network/workloads/netspeed","organization":"myorg","priority":{"priority_vlaue":1}}],
+		"nodehealth":{"check_agreement_status":120}}`
+
+	issues := LintPolicy([]byte(doc), nil)
+	if !hasIssueAt(issues, "/header/author") {
+		t.Errorf("Error: expected an unknown field issue for the header, got %v", issues)
+	} else if !hasIssueAt(issues, "/workloads/0/priority/priority_vlaue") {
+		t.Errorf("Error: expected an unknown field issue for the workload priority, got %v", issues)
+	} else if hasIssueAt(issues, "/nodehealth") {
+		t.Errorf("Error: field names are not case sensitive, got %v", issues)
+	}
+}
+
+func Test_LintPolicy_properties(t *testing.T) {
+	doc := `{"header":{"name":"props","version":"2.0"},
+		"properties":[{"name":"memory","value":"lots","type":"quantity"},{"name":"memory","value":"512MiB"}],
+		"counterPartyProperties":{"and":[{"name":"rpiprop1","value":"rpival1","op":"~"}]}}`
+
+	issues := LintPolicy([]byte(doc), nil)
+	if !hasIssueAt(issues, "/properties/0") {
+		t.Errorf("Error: expected an invalid quantity issue, got %v", issues)
+	} else if !hasIssueAt(issues, "/properties/1/name") {
+		t.Errorf("Error: expected a duplicate property issue, got %v", issues)
+	} else if !hasIssueAt(issues, "/counterPartyProperties") {
+		t.Errorf("Error: expected a counterparty property syntax issue, got %v", issues)
+	}
+}
+
+func Test_LintPolicy_ha_group(t *testing.T) {
+	doc := `{"header":{"name":"ha","version":"2.0"},"ha_group":{"partners":["node1","","node1"]}}`
+
+	issues := LintPolicy([]byte(doc), nil)
+	if !hasIssueAt(issues, "/ha_group/partners/1") || !hasIssueAt(issues, "/ha_group/partners/2") {
+		t.Errorf("Error: expected empty and duplicate partner issues, got %v", issues)
+	}
+}
+
+func Test_LintPolicy_data_verification(t *testing.T) {
+	doc := `{"header":{"name":"dv","version":"2.0"},
+		"dataVerification":{"enabled":true,"interval":60},
+		"nodeHealth":{"check_agreement_status":120}}`
+
+	if issues := LintPolicy([]byte(doc), nil); !hasIssueAt(issues, "/dataVerification/interval") {
+		t.Errorf("Error: expected an interval that can never be met, got %v", issues)
+	}
+}
+
+func Test_LintPolicy_workloads(t *testing.T) {
+	doc := `{"header":{"name":"wl","version":"2.0"},
+		"workloads":[{"workloadUrl":"https://bluehorizon.network/workloads/netspeed","organization":"myorg","priority":{"priority_value":1}},
+			{"workloadUrl":"https://bluehorizon.network/workloads/netspeed","organization":"myorg","version":"[2.0.0,1.0.0","priority":{"priority_value":1}},
+			{"workloadUrl":"https://bluehorizon.network/workloads/gps","priority":{"priority_value":3}},
+			{"priority":{"priority_value":4}}]}`
+
+	issues := LintPolicy([]byte(doc), nil)
+	if !hasIssueAt(issues, "/workloads/1/priority/priority_value") {
+		t.Errorf("Error: expected a duplicate priority issue, got %v", issues)
+	} else if !hasIssueAt(issues, "/workloads/1/version") {
+		t.Errorf("Error: expected a version expression issue, got %v", issues)
+	} else if !hasIssueAt(issues, "/workloads/2/organization") {
+		t.Errorf("Error: expected a missing organization issue, got %v", issues)
+	} else if !hasIssueAt(issues, "/workloads/3") {
+		t.Errorf("Error: expected a missing workload reference issue, got %v", issues)
+	}
+
+	resolver := func(wURL string, wOrg string, wVersion string, wArch string) (*APISpecList, error) {
+		return nil, errors.New("not found")
+	}
+	if issues := LintPolicy([]byte(doc), resolver); !hasIssueAt(issues, "/workloads/0/workloadUrl") {
+		t.Errorf("Error: expected an unresolved workload issue, got %v", issues)
+	}
+}
+
+func Test_LintPolicyFiles_ha_conflict(t *testing.T) {
+	dir, err := ioutil.TempDir("", "lint")
+	if err != nil {
+		t.Fatalf("Error: unable to create temp dir, error: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	f1 := filepath.Join(dir, "a.policy")
+	f2 := filepath.Join(dir, "b.policy")
+	ioutil.WriteFile(f1, []byte(`{"header":{"name":"a","version":"2.0"},"ha_group":{"partners":["node1"]}}`), 0644)
+	ioutil.WriteFile(f2, []byte(`{"header":{"name":"b","version":"2.0"},"ha_group":{"partners":["node2"]}}`), 0644)
+
+	issues := LintPolicyFiles([]string{f1, f2}, nil)
+	if len(issues) != 1 || issues[0].File != f2 || issues[0].Location != "/ha_group/partners" {
+		t.Errorf("Error: expected an HA group conflict in %v, got %v", f2, issues)
+	}
+}
+
+func Test_JSONPointer(t *testing.T) {
+	if p := JSONPointer("workloads", 10, "a/b~c"); p != "/workloads/10/a~1b~0c" {
+		t.Errorf("Error: unexpected JSON pointer %v", p)
+	}
+}
+
+func Test_SortLintIssues(t *testing.T) {
+	issues := []LintIssue{{Location: "/workloads/10"}, {Location: "/header"}, {Location: "/workloads/9/version"}, {Location: "/workloads/9"}}
+	SortLintIssues(issues)
+	if issues[0].Location != "/header" || issues[1].Location != "/workloads/9" || issues[2].Location != "/workloads/9/version" || issues[3].Location != "/workloads/10" {
+		t.Errorf("Error: unexpected order %v", issues)
+	}
+}
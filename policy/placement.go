@@ -0,0 +1,152 @@
+package policy
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+)
+
+// The purpose of this file is to abstract the operations on the Placement type. A placement section is only
+// specified in a consumer policy. It is a list of the preferences that the agbot uses to rank the compatible nodes it
+// finds, so that when it cant make agreements with all of them (because of the policy's maxAgreements), the
+// agreements are made with the nodes that best match the preferences. A policy without a placement section
+// leaves the nodes in the order that the exchange returns them.
+//
+// Each preference scores the nodes on one criteria. The scores of a preference are scaled so that the best node
+// gets 1 and the worst node gets 0, and then the scaled scores of all the preferences are added up using the
+// weights of the preferences. A node that a preference cant score, e.g. because it doesnt have the property,
+// ranks below the nodes that the preference can score.
+
+// These are the kinds of placement preferences.
+const PLACEMENT_PROPERTY = "property"   // Prefer higher (or lower) values of a numeric node property
+const PLACEMENT_PROXIMITY = "proximity" // Prefer nodes that are closer to a location
+const PLACEMENT_FAILURES = "failures"   // Prefer nodes with fewer recently failed agreements
+const PLACEMENT_RETRIES = "retries"     // Prefer nodes that needed fewer workload retries
+
+func PlacementKinds() []string {
+	return []string{PLACEMENT_PROPERTY, PLACEMENT_PROXIMITY, PLACEMENT_FAILURES, PLACEMENT_RETRIES}
+}
+
+// The orders of a property preference.
+const PLACEMENT_ORDER_HIGHER = "higher"
+const PLACEMENT_ORDER_LOWER = "lower"
+
+// The node properties that hold the location of a node for a proximity preference.
+const PLACEMENT_LAT_PROPERTY = "lat"
+const PLACEMENT_LON_PROPERTY = "lon"
+
+// The default number of seconds in which a failed agreement is recent.
+const PLACEMENT_DEFAULT_FAILURE_WINDOW = 24 * 60 * 60
+
+type PlacementPreference struct {
+	Kind     string  `json:"kind"`               // One of the placement kinds
+	Property string  `json:"property,omitempty"` // The name of the node property, for a property preference
+	Order    string  `json:"order,omitempty"`    // Higher or lower, for a property preference. The default is higher.
+	Lat      float64 `json:"lat,omitempty"`      // The latitude of the location, for a proximity preference
+	Lon      float64 `json:"lon,omitempty"`      // The longitude of the location, for a proximity preference
+	WindowS  int     `json:"windowS,omitempty"`  // The number of seconds in which failed agreements count, for a failures preference. The default is 1 day.
+	Weight   float64 `json:"weight,omitempty"`   // The weight of the preference relative to the others. The default is 1.
+}
+
+func (p PlacementPreference) String() string {
+	switch p.Kind {
+	case PLACEMENT_PROPERTY:
+		return fmt.Sprintf("%v %v %v (weight %v)", p.Kind, p.GetOrder(), p.Property, p.GetWeight())
+	case PLACEMENT_PROXIMITY:
+		return fmt.Sprintf("%v to %v,%v (weight %v)", p.Kind, p.Lat, p.Lon, p.GetWeight())
+	case PLACEMENT_FAILURES:
+		return fmt.Sprintf("%v in %vs (weight %v)", p.Kind, p.GetWindowS(), p.GetWeight())
+	default:
+		return fmt.Sprintf("%v (weight %v)", p.Kind, p.GetWeight())
+	}
+}
+
+func (p PlacementPreference) GetOrder() string {
+	if p.Order == "" {
+		return PLACEMENT_ORDER_HIGHER
+	}
+	return p.Order
+}
+
+func (p PlacementPreference) GetWeight() float64 {
+	if p.Weight == 0 {
+		return 1
+	}
+	return p.Weight
+}
+
+func (p PlacementPreference) GetWindowS() int {
+	if p.WindowS == 0 {
+		return PLACEMENT_DEFAULT_FAILURE_WINDOW
+	}
+	return p.WindowS
+}
+
+func (p PlacementPreference) IsValid() error {
+	if p.Weight < 0 {
+		return errors.New(fmt.Sprintf("weight %v is negative", p.Weight))
+	} else if p.WindowS < 0 {
+		return errors.New(fmt.Sprintf("windowS %v is negative", p.WindowS))
+	}
+
+	switch p.Kind {
+	case PLACEMENT_PROPERTY:
+		if p.Property == "" {
+			return errors.New(fmt.Sprintf("a %v preference must name a property", p.Kind))
+		} else if order := p.GetOrder(); order != PLACEMENT_ORDER_HIGHER && order != PLACEMENT_ORDER_LOWER {
+			return errors.New(fmt.Sprintf("order %v is not %v or %v", p.Order, PLACEMENT_ORDER_HIGHER, PLACEMENT_ORDER_LOWER))
+		}
+	case PLACEMENT_PROXIMITY:
+		if p.Lat < -90 || p.Lat > 90 {
+			return errors.New(fmt.Sprintf("lat %v is not between -90 and 90", p.Lat))
+		} else if p.Lon < -180 || p.Lon > 180 {
+			return errors.New(fmt.Sprintf("lon %v is not between -180 and 180", p.Lon))
+		}
+	case PLACEMENT_FAILURES, PLACEMENT_RETRIES:
+	default:
+		return errors.New(fmt.Sprintf("kind %v is not one of %v", p.Kind, PlacementKinds()))
+	}
+	return nil
+}
+
+type Placement []PlacementPreference
+
+func (p Placement) String() string {
+	prefs := make([]string, 0, len(p))
+	for _, pref := range p {
+		prefs = append(prefs, pref.String())
+	}
+	return fmt.Sprintf("Placement preferences: %v", strings.Join(prefs, ", "))
+}
+
+func (p Placement) IsValid() error {
+	for ix, pref := range p {
+		if err := pref.IsValid(); err != nil {
+			return errors.New(fmt.Sprintf("preference %v %v", ix, err))
+		}
+	}
+	return nil
+}
+
+// Returns true when the placement has a preference of the kind, so that the agbot only reads the data that the
+// preferences use.
+func (p Placement) Uses(kind string) bool {
+	for _, pref := range p {
+		if pref.Kind == kind {
+			return true
+		}
+	}
+	return false
+}
+
+// Returns the great circle distance in kilometers between 2 locations.
+func GeoDistanceKM(lat1 float64, lon1 float64, lat2 float64, lon2 float64) float64 {
+	const earthRadiusKM = 6371.0
+	rad := func(deg float64) float64 { return deg * math.Pi / 180 }
+
+	dLat := rad(lat2 - lat1)
+	dLon := rad(lon2 - lon1)
+	a := math.Sin(dLat/2)*math.Sin(dLat/2) + math.Cos(rad(lat1))*math.Cos(rad(lat2))*math.Sin(dLon/2)*math.Sin(dLon/2)
+	return 2 * earthRadiusKM * math.Atan2(math.Sqrt(a), math.Sqrt(1-a))
+}
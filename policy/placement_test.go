@@ -0,0 +1,72 @@
+// +build unit
+
+package policy
+
+import (
+	"encoding/json"
+	"math"
+	"testing"
+)
+
+func Test_placement_isvalid(t *testing.T) {
+
+	valid := `[{"kind":"property","property":"cpus"},{"kind":"property","property":"ram","order":"lower","weight":0.5},` +
+		`{"kind":"proximity","lat":40.7,"lon":-74.0,"weight":2},{"kind":"failures","windowS":3600},{"kind":"retries"}]`
+
+	p := new(Placement)
+	if err := json.Unmarshal([]byte(valid), p); err != nil {
+		t.Fatalf("unable to demarshal placement, error %v", err)
+	} else if err := p.IsValid(); err != nil {
+		t.Errorf("expected placement %v to be valid, error %v", p, err)
+	} else if !p.Uses(PLACEMENT_FAILURES) || (Placement{}).Uses(PLACEMENT_FAILURES) {
+		t.Errorf("expected only the placement with a failures preference to use it")
+	} else if (*p)[0].GetWeight() != 1 || (*p)[0].GetOrder() != PLACEMENT_ORDER_HIGHER || (*p)[4].GetWindowS() != PLACEMENT_DEFAULT_FAILURE_WINDOW {
+		t.Errorf("expected the defaults to be filled in, got %v", p)
+	}
+
+	invalid := []PlacementPreference{
+		{Kind: "cheapest"},
+		{Kind: PLACEMENT_PROPERTY},
+		{Kind: PLACEMENT_PROPERTY, Property: "cpus", Order: "most"},
+		{Kind: PLACEMENT_PROXIMITY, Lat: 91},
+		{Kind: PLACEMENT_PROXIMITY, Lon: -181},
+		{Kind: PLACEMENT_FAILURES, WindowS: -1},
+		{Kind: PLACEMENT_RETRIES, Weight: -1},
+	}
+	for _, pref := range invalid {
+		if err := (Placement{pref}).IsValid(); err == nil {
+			t.Errorf("expected preference %v to be invalid", pref)
+		}
+	}
+}
+
+func Test_geo_distance(t *testing.T) {
+
+	// New York to Los Angeles is about 3940 km.
+	if d := GeoDistanceKM(40.7128, -74.0060, 34.0522, -118.2437); math.Abs(d-3940) > 10 {
+		t.Errorf("expected about 3940 km, got %v", d)
+	} else if d := GeoDistanceKM(10, 10, 10, 10); d != 0 {
+		t.Errorf("expected no distance, got %v", d)
+	}
+}
+
+func Test_property_numeric_value(t *testing.T) {
+
+	tests := []struct {
+		value    interface{}
+		expected float64
+		ok       bool
+	}{
+		{float64(2.5), 2.5, true},
+		{4, 4, true},
+		{"4096", 4096, true},
+		{"1KiB", 1024, true},
+		{"fast", 0, false},
+		{true, 0, false},
+	}
+	for _, test := range tests {
+		if v, ok := Property_Factory("p", test.value).NumericValue(); ok != test.ok || v != test.expected {
+			t.Errorf("expected %v to have numeric value %v %v, got %v %v", test.value, test.expected, test.ok, v, ok)
+		}
+	}
+}
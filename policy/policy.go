@@ -13,7 +13,7 @@ import (
 // can take any version.
 // maxAgreements: 0 means unlimited.
 
-func GeneratePolicy(sensorUrl string, sensorOrg string, sensorName string, sensorVersion string, arch string, props *map[string]interface{}, haPartners []string, meterPolicy Meter, counterPartyProperties RequiredProperty, agps []AgreementProtocol, maxAgreements int, filePath string, deviceOrg string) (*events.PolicyCreatedMessage, error) {
+func GeneratePolicy(sensorUrl string, sensorOrg string, sensorName string, sensorVersion string, arch string, props *map[string]interface{}, haPartners []string, meterPolicy Meter, counterPartyProperties RequiredProperty, agps []AgreementProtocol, availability Availability, refusePrivileged bool, maxAgreements int, filePath string, deviceOrg string) (*events.PolicyCreatedMessage, error) {
 
 	glog.V(5).Infof("Generating policy for %v", sensorUrl)
 
@@ -32,7 +32,11 @@ func GeneratePolicy(sensorUrl string, sensorOrg string, sensorName string, senso
 
 	// Add properties to the policy
 	for prop, val := range *props {
-		p.Add_Property(Property_Factory(prop, val))
+		if newProp, err := PropertyFromMapping(prop, val); err != nil {
+			return nil, err
+		} else {
+			p.Add_Property(newProp)
+		}
 	}
 
 	// Add HA configuration if there is any
@@ -50,6 +54,12 @@ func GeneratePolicy(sensorUrl string, sensorOrg string, sensorName string, senso
 		p.Add_CounterPartyProperties(&counterPartyProperties)
 	}
 
+	// Add the availability schedules if there are any
+	if len(availability) != 0 {
+		p.Add_Availability(&availability)
+	}
+
+	p.RefusePrivileged = refusePrivileged
 	p.MaxAgreements = maxAgreements
 
 	// Store the policy on the filesystem
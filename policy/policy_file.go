@@ -66,6 +66,10 @@ type Policy struct {
 	RequiredWorkload       string                `json:"requiredWorkload,omitempty"`       // Version 2.0
 	HAGroup                HighAvailabilityGroup `json:"ha_group,omitempty"`               // Version 2.0
 	NodeH                  NodeHealth            `json:"nodeHealth,omitempty"`             // Version 2.0
+	Availability           Availability          `json:"availability,omitempty"`           // Version 2.0
+	RefusePrivileged       bool                  `json:"refusePrivileged,omitempty"`       // Version 2.0, the node refuses workloads that run privileged containers
+	Placement              Placement             `json:"placement,omitempty"`              // Version 2.0, consumer only, the agbot's preferences for the nodes it makes agreements with
+	Spread                 Spread                `json:"spread,omitempty"`                 // Version 2.0, consumer only, how the agreements are spread over the values of a node property
 }
 
 // These functions are used to create Policy objects. You can create the base object
@@ -137,6 +141,15 @@ func (self *Policy) Add_Workload(w *Workload) error {
 	}
 }
 
+func (self *Policy) Add_Availability(a *Availability) error {
+	if a != nil {
+		self.Availability = *a
+		return nil
+	} else {
+		return errors.New(fmt.Sprintf("Add_Availability Error: input is nil."))
+	}
+}
+
 func (self *Policy) Add_NodeHealth(nh *NodeHealth) error {
 	if nh != nil {
 		self.NodeH = *nh
@@ -158,6 +171,7 @@ func (self *Policy) Add_NodeHealth(nh *NodeHealth) error {
 // 2) the Producer advertises all the properties that the Consumer requires, and when the Consumer
 //    advertises all the properties that the Producer requires.
 // 3) the Producer is offering enough resources for the Consumer's workload.
+// 4) there is a time at which the availability schedules of both the Producer and Consumer are open.
 //
 
 func Are_Compatible(producer_policy *Policy, consumer_policy *Policy) error {
@@ -176,6 +190,8 @@ func Are_Compatible(producer_policy *Policy, consumer_policy *Policy) error {
 		return errors.New(fmt.Sprintf("Compatibility Error: Producer resource limits %v do not satisfy consumer resource requirements %v", producer_policy.ResourceLimits, consumer_policy.ResourceLimits))
 	} else if !producer_policy.DataVerify.IsCompatibleWith(consumer_policy.DataVerify) {
 		return errors.New(fmt.Sprintf("Compatibility Error: Data verification must be compatible, producer has %v and consumer has %v.", producer_policy.DataVerify, consumer_policy.DataVerify))
+	} else if !(&producer_policy.Availability).Compatible_With(&consumer_policy.Availability) {
+		return errors.New(fmt.Sprintf("Compatibility Error: Producer %v and consumer %v are never open at the same time.", producer_policy.Availability, consumer_policy.Availability))
 	}
 
 	return nil
@@ -208,6 +224,8 @@ func Are_Compatible_Producers(producer_policy1 *Policy, producer_policy2 *Policy
 		return nil, errors.New(fmt.Sprintf("Compatibility Error: Data verification must be compatible between %v and %v.", producer_policy1.DataVerify, producer_policy2.DataVerify))
 	} else if !producer_policy1.HAGroup.Compatible_With(&producer_policy2.HAGroup) {
 		return nil, errors.New(fmt.Sprintf("Compatibility Error: HAGroups must be compatible between %v and %v.", producer_policy1.HAGroup, producer_policy2.HAGroup))
+	} else if !(&producer_policy1.Availability).Compatible_With(&producer_policy2.Availability) {
+		return nil, errors.New(fmt.Sprintf("Compatibility Error: %v and %v are never open at the same time.", producer_policy1.Availability, producer_policy2.Availability))
 	}
 
 	merged_pol := new(Policy)
@@ -229,6 +247,12 @@ func Are_Compatible_Producers(producer_policy1 *Policy, producer_policy2 *Policy
 	merged_pol.HAGroup = *((&producer_policy1.HAGroup).Merge(&producer_policy2.HAGroup))
 	merged_pol.MaxAgreements = cutil.Min(producer_policy1.MaxAgreements, producer_policy2.MaxAgreements)
 
+	// The merged policy is available only when both producers are available.
+	merged_pol.Availability = *((&producer_policy1.Availability).Merge(&producer_policy2.Availability))
+
+	// The merged policy refuses privileged workloads when either producer does.
+	merged_pol.RefusePrivileged = producer_policy1.RefusePrivileged || producer_policy2.RefusePrivileged
+
 	return merged_pol, nil
 }
 
@@ -268,6 +292,7 @@ func Create_Terms_And_Conditions(producer_policy *Policy, consumer_policy *Polic
 		merged_pol.RequiredWorkload = producer_policy.RequiredWorkload
 		merged_pol.HAGroup = producer_policy.HAGroup
 		merged_pol.NodeH = consumer_policy.NodeH
+		merged_pol.Availability = *((&producer_policy.Availability).Merge(&consumer_policy.Availability))
 
 		return merged_pol, nil
 	}
@@ -280,6 +305,28 @@ func (self *Policy) Is_Self_Consistent(keyFileNames []string, workloadResolver f
 		return errors.New(fmt.Sprintf("Data Verification section is not valid, error: %v", err))
 	}
 
+	// Check validity of the property values
+	for _, prop := range self.Properties {
+		if err := prop.Validate(); err != nil {
+			return errors.New(fmt.Sprintf("Properties section of %v has error %v", self.Header.Name, err))
+		}
+	}
+
+	// Check validity of the availability section
+	if err := self.Availability.IsValid(); err != nil {
+		return errors.New(fmt.Sprintf("Availability section of %v has error %v", self.Header.Name, err))
+	}
+
+	// Check validity of the placement section
+	if err := self.Placement.IsValid(); err != nil {
+		return errors.New(fmt.Sprintf("Placement section of %v has error %v", self.Header.Name, err))
+	}
+
+	// Check validity of the spread section
+	if err := self.Spread.IsValid(); err != nil {
+		return errors.New(fmt.Sprintf("Spread section of %v has error %v", self.Header.Name, err))
+	}
+
 	// Check validity of the agreement protocol list
 	for _, agp := range self.AgreementProtocols {
 		if err := agp.IsValid(); err != nil {
@@ -372,6 +419,10 @@ func (self *Policy) String() string {
 	res += fmt.Sprintf("CounterPartyProperties: %v\n", self.CounterPartyProperties)
 	res += fmt.Sprintf("Data Verification: %v\n", self.DataVerify)
 	res += fmt.Sprintf("Node Health: %v\n", self.NodeH)
+	res += fmt.Sprintf("%v\n", self.Availability)
+	res += fmt.Sprintf("Refuse Privileged: %v\n", self.RefusePrivileged)
+	res += fmt.Sprintf("%v\n", self.Placement)
+	res += fmt.Sprintf("%v\n", self.Spread)
 
 	return res
 }
@@ -27,12 +27,13 @@ func (p PropertyList) IsSame(compare PropertyList) bool {
 }
 
 type Property struct {
-	Name  string      `json:"name"`  // The Property name
-	Value interface{} `json:"value"` // The Property value
+	Name  string      `json:"name"`           // The Property name
+	Value interface{} `json:"value"`          // The Property value
+	Type  string      `json:"type,omitempty"` // The type of the Property value, see property_types.go. Empty when the type is inferred from the value.
 }
 
 func (p Property) IsSame(compare Property) bool {
-	return p.Name == compare.Name && p.Value == compare.Value
+	return p.Name == compare.Name && p.Type == compare.Type && p.sameValue(compare)
 }
 
 // This function creates Property objects
@@ -50,7 +51,7 @@ func (self *PropertyList) Compatible_With(other *PropertyList) error {
 
 	for _, self_ele := range *self {
 		for _, other_ele := range *other {
-			if self_ele.Name == other_ele.Name && self_ele.Value != other_ele.Value {
+			if self_ele.Name == other_ele.Name && !self_ele.sameValue(other_ele) {
 				return errors.New(fmt.Sprintf("Property %v has value %v and %v.", self_ele.Name, self_ele.Value, other_ele.Value))
 			}
 		}
@@ -0,0 +1,288 @@
+package policy
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// The purpose of this file is to handle the types of property values. A property can declare the type of
+// its value, which is checked when the property is created and which is used when the value is compared
+// with the value in a counterparty property expression. A property that does not declare a type has its
+// type inferred from its value.
+//
+// A quantity is a number with a unit, such as "512MiB" or "2GHz". Quantities are compared after they are
+// converted to the base unit of their dimension (bytes, hertz or bits per second), so "1GiB" is greater
+// than "512MiB". A plain number in an expression that is compared with a quantity is in the base unit.
+
+// These are the property types that can be declared.
+const PROPERTY_TYPE_INT = "int"
+const PROPERTY_TYPE_FLOAT = "float"
+const PROPERTY_TYPE_BOOLEAN = "boolean"
+const PROPERTY_TYPE_STRING = "string"
+const PROPERTY_TYPE_LIST = "list"
+const PROPERTY_TYPE_VERSION = "version"
+const PROPERTY_TYPE_QUANTITY = "quantity"
+
+func PropertyTypes() []string {
+	return []string{PROPERTY_TYPE_INT, PROPERTY_TYPE_FLOAT, PROPERTY_TYPE_BOOLEAN, PROPERTY_TYPE_STRING, PROPERTY_TYPE_LIST, PROPERTY_TYPE_VERSION, PROPERTY_TYPE_QUANTITY}
+}
+
+// The dimensions of the supported quantity units.
+const QUANTITY_BYTES = "bytes"
+const QUANTITY_HERTZ = "hertz"
+const QUANTITY_BITRATE = "bits per second"
+
+type quantityUnit struct {
+	dimension string
+	factor    float64
+}
+
+var quantityUnits = map[string]quantityUnit{
+	"B":    {QUANTITY_BYTES, 1},
+	"KB":   {QUANTITY_BYTES, 1e3},
+	"MB":   {QUANTITY_BYTES, 1e6},
+	"GB":   {QUANTITY_BYTES, 1e9},
+	"TB":   {QUANTITY_BYTES, 1e12},
+	"KiB":  {QUANTITY_BYTES, 1 << 10},
+	"MiB":  {QUANTITY_BYTES, 1 << 20},
+	"GiB":  {QUANTITY_BYTES, 1 << 30},
+	"TiB":  {QUANTITY_BYTES, 1 << 40},
+	"Hz":   {QUANTITY_HERTZ, 1},
+	"kHz":  {QUANTITY_HERTZ, 1e3},
+	"KHz":  {QUANTITY_HERTZ, 1e3},
+	"MHz":  {QUANTITY_HERTZ, 1e6},
+	"GHz":  {QUANTITY_HERTZ, 1e9},
+	"bps":  {QUANTITY_BITRATE, 1},
+	"kbps": {QUANTITY_BITRATE, 1e3},
+	"Kbps": {QUANTITY_BITRATE, 1e3},
+	"Mbps": {QUANTITY_BITRATE, 1e6},
+	"Gbps": {QUANTITY_BITRATE, 1e9},
+}
+
+// Parse a quantity string, e.g. "512MiB" or "2.5 GHz", into its value in the base unit of its dimension
+// and the name of the dimension.
+func ParseQuantity(q string) (float64, string, error) {
+	q = strings.TrimSpace(q)
+	ix := strings.IndexFunc(q, func(r rune) bool { return !strings.ContainsRune("0123456789.+-", r) })
+	if ix <= 0 {
+		return 0, "", errors.New(fmt.Sprintf("quantity %v does not start with a number followed by a unit", q))
+	}
+
+	num, err := strconv.ParseFloat(q[:ix], 64)
+	if err != nil {
+		return 0, "", errors.New(fmt.Sprintf("quantity %v does not start with a number, error: %v", q, err))
+	}
+	unit, ok := quantityUnits[strings.TrimSpace(q[ix:])]
+	if !ok {
+		return 0, "", errors.New(fmt.Sprintf("quantity %v does not have a supported unit", q))
+	}
+	return num * unit.factor, unit.dimension, nil
+}
+
+// This function creates a Property from one of the mappings of a PropertyAttributes attribute. A mapping
+// is either a plain value, or an object with a "value" and a "type" that declares the type of the value.
+func PropertyFromMapping(name string, mapping interface{}) (*Property, error) {
+	p := Property_Factory(name, mapping)
+	if m, ok := mapping.(map[string]interface{}); ok {
+		if t, ok := m["type"]; ok {
+			if tString, ok := t.(string); !ok {
+				return nil, errors.New(fmt.Sprintf("property %v has a type %v that is not a string", name, t))
+			} else {
+				p.Type = tString
+				p.Value = m["value"]
+			}
+		}
+	}
+	if err := p.Validate(); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// Verify that the value of a property has the type that the property declares.
+func (p Property) Validate() error {
+	ok := false
+	switch p.Type {
+	case "":
+		ok = true
+	case PROPERTY_TYPE_INT:
+		if f, isFloat := p.Value.(float64); isFloat {
+			ok = f == math.Trunc(f)
+		} else {
+			_, ok = p.Value.(int)
+		}
+	case PROPERTY_TYPE_FLOAT:
+		switch p.Value.(type) {
+		case float64, int:
+			ok = true
+		}
+	case PROPERTY_TYPE_BOOLEAN:
+		ok = isBoolean(p.Value)
+	case PROPERTY_TYPE_STRING:
+		ok = isString(p.Value)
+	case PROPERTY_TYPE_LIST:
+		_, ok = ConvertToStringList(p.Value)
+	case PROPERTY_TYPE_VERSION:
+		ok = isString(p.Value) && IsVersionString(p.Value.(string))
+	case PROPERTY_TYPE_QUANTITY:
+		if isString(p.Value) {
+			_, _, err := ParseQuantity(p.Value.(string))
+			ok = err == nil
+		}
+	default:
+		return errors.New(fmt.Sprintf("property %v has type %v, which is not one of %v", p.Name, p.Type, PropertyTypes()))
+	}
+
+	if !ok {
+		return errors.New(fmt.Sprintf("property %v has value %v, which is not a %v", p.Name, p.Value, p.Type))
+	}
+	return nil
+}
+
+// Returns true if the 2 properties have the same value. Quantities are the same when they have the same
+// value in the base unit, and lists are the same when they have the same elements in the same order.
+func (p Property) sameValue(other Property) bool {
+	if p.Type == PROPERTY_TYPE_QUANTITY && other.Type == PROPERTY_TYPE_QUANTITY && isString(p.Value) && isString(other.Value) {
+		v1, d1, err1 := ParseQuantity(p.Value.(string))
+		v2, d2, err2 := ParseQuantity(other.Value.(string))
+		if err1 == nil && err2 == nil {
+			return v1 == v2 && d1 == d2
+		}
+	}
+
+	l1, ok1 := ConvertToStringList(p.Value)
+	l2, ok2 := ConvertToStringList(other.Value)
+	if ok1 && ok2 {
+		if len(l1) != len(l2) {
+			return false
+		}
+		for ix, s := range l1 {
+			if l2[ix] != s {
+				return false
+			}
+		}
+		return true
+	} else if ok1 || ok2 || isArray(p.Value) || isArray(other.Value) {
+		return false
+	}
+
+	return p.Value == other.Value
+}
+
+// Convert a list of strings, which is a []interface{} when it has been demarshalled from JSON, into a []string.
+func ConvertToStringList(value interface{}) ([]string, bool) {
+	switch value.(type) {
+	case []string:
+		return value.([]string), true
+	case []interface{}:
+		res := make([]string, 0, len(value.([]interface{})))
+		for _, v := range value.([]interface{}) {
+			if s, ok := v.(string); !ok {
+				return nil, false
+			} else {
+				res = append(res, s)
+			}
+		}
+		return res, true
+	default:
+		return nil, false
+	}
+}
+
+// This function evaluates a property expression against a property whose declared type needs special
+// handling, a quantity or a version.
+func typedPropertySatisfies(p Property, propexp *PropertyExpression) bool {
+	if _, ok := valueOperators()[propexp.Op]; ok && (propexp.Op == matches || p.Type == PROPERTY_TYPE_VERSION) {
+		return valueSatisfies(propexp, p.Value)
+	}
+
+	switch p.Type {
+	case PROPERTY_TYPE_QUANTITY:
+		if !isString(p.Value) {
+			return false
+		}
+		base, dimension, err := ParseQuantity(p.Value.(string))
+		if err != nil {
+			return false
+		}
+		expValue, ok := baseQuantityValue(propexp.Value, dimension)
+		if !ok {
+			return false
+		}
+		// Both values are numbers in the base unit now, so the expression can be evaluated as usual.
+		return propertyInArray(PropertyExpression_Factory(propexp.Name, expValue, propexp.Op), &[]Property{*Property_Factory(p.Name, base)})
+
+	case PROPERTY_TYPE_VERSION:
+		if !isString(p.Value) || !isString(propexp.Value) {
+			return false
+		}
+		c, err := CompareVersions(p.Value.(string), propexp.Value.(string))
+		if err != nil {
+			return false
+		}
+		switch propexp.Op {
+		case lessthan:
+			return c < 0
+		case greaterthan:
+			return c > 0
+		case lessthaneq:
+			return c <= 0
+		case greaterthaneq:
+			return c >= 0
+		case notequalto:
+			return c != 0
+		default:
+			return c == 0
+		}
+	}
+	return false
+}
+
+// Convert the value of an expression that is compared with a quantity into the base unit of the quantity's
+// dimension. Lists, as used by the in and between operators, are converted element by element. The conversion
+// fails if a quantity in the expression has a different dimension.
+func baseQuantityValue(value interface{}, dimension string) (interface{}, bool) {
+	switch value.(type) {
+	case float64:
+		return value, true
+	case string:
+		if base, d, err := ParseQuantity(value.(string)); err != nil || d != dimension {
+			return nil, false
+		} else {
+			return base, true
+		}
+	case []interface{}:
+		res := make([]interface{}, 0, len(value.([]interface{})))
+		for _, v := range value.([]interface{}) {
+			if base, ok := baseQuantityValue(v, dimension); !ok {
+				return nil, false
+			} else {
+				res = append(res, base)
+			}
+		}
+		return res, true
+	default:
+		return nil, false
+	}
+}
+
+// Returns the value of a property as a number. Numbers, numeric strings and quantities (in their base unit) have a
+// numeric value, other values dont.
+func (p Property) NumericValue() (float64, bool) {
+	switch p.Value.(type) {
+	case float64:
+		return p.Value.(float64), true
+	case int:
+		return float64(p.Value.(int)), true
+	case string:
+		if f, err := strconv.ParseFloat(strings.TrimSpace(p.Value.(string)), 64); err == nil {
+			return f, true
+		} else if base, _, err := ParseQuantity(p.Value.(string)); err == nil {
+			return base, true
+		}
+	}
+	return 0, false
+}
@@ -0,0 +1,132 @@
+// +build unit
+
+package policy
+
+import (
+	"testing"
+)
+
+func Test_ParseQuantity(t *testing.T) {
+	if v, d, err := ParseQuantity("512MiB"); err != nil || v != 512*1024*1024 || d != QUANTITY_BYTES {
+		t.Errorf("Error: 512MiB should be %v bytes, got %v %v, error: %v", 512*1024*1024, v, d, err)
+	} else if v, d, err := ParseQuantity("2.5 GHz"); err != nil || v != 2.5e9 || d != QUANTITY_HERTZ {
+		t.Errorf("Error: 2.5 GHz should be 2.5e9 hertz, got %v %v, error: %v", v, d, err)
+	}
+
+	for _, q := range []string{"512", "MiB", "512XB", "1.2.3GB", ""} {
+		if _, _, err := ParseQuantity(q); err == nil {
+			t.Errorf("Error: %v should not be a valid quantity", q)
+		}
+	}
+}
+
+func Test_Property_Validate(t *testing.T) {
+	valid := []Property{
+		{Name: "p", Value: "anything"},
+		{Name: "p", Value: float64(4), Type: PROPERTY_TYPE_INT},
+		{Name: "p", Value: 4.5, Type: PROPERTY_TYPE_FLOAT},
+		{Name: "p", Value: true, Type: PROPERTY_TYPE_BOOLEAN},
+		{Name: "p", Value: "s", Type: PROPERTY_TYPE_STRING},
+		{Name: "p", Value: []interface{}{"a", "b"}, Type: PROPERTY_TYPE_LIST},
+		{Name: "p", Value: "1.2.3", Type: PROPERTY_TYPE_VERSION},
+		{Name: "p", Value: "2GHz", Type: PROPERTY_TYPE_QUANTITY},
+	}
+	for _, p := range valid {
+		if err := p.Validate(); err != nil {
+			t.Errorf("Error: %v should be valid, error: %v", p, err)
+		}
+	}
+
+	invalid := []Property{
+		{Name: "p", Value: 4.5, Type: PROPERTY_TYPE_INT},
+		{Name: "p", Value: "true", Type: PROPERTY_TYPE_BOOLEAN},
+		{Name: "p", Value: []interface{}{"a", 1.0}, Type: PROPERTY_TYPE_LIST},
+		{Name: "p", Value: "1.x", Type: PROPERTY_TYPE_VERSION},
+		{Name: "p", Value: "2 parsecs", Type: PROPERTY_TYPE_QUANTITY},
+		{Name: "p", Value: "s", Type: "complex"},
+	}
+	for _, p := range invalid {
+		if err := p.Validate(); err == nil {
+			t.Errorf("Error: %v should not be valid", p)
+		}
+	}
+}
+
+func Test_PropertyFromMapping(t *testing.T) {
+	if p, err := PropertyFromMapping("memory", map[string]interface{}{"value": "512MiB", "type": "quantity"}); err != nil {
+		t.Errorf("Error: unexpected error %v", err)
+	} else if p.Type != PROPERTY_TYPE_QUANTITY || p.Value != "512MiB" {
+		t.Errorf("Error: expected a quantity property, got %v", p)
+	}
+
+	if p, err := PropertyFromMapping("plain", "val1"); err != nil || p.Type != "" || p.Value != "val1" {
+		t.Errorf("Error: expected an untyped property, got %v, error: %v", p, err)
+	}
+
+	if _, err := PropertyFromMapping("memory", map[string]interface{}{"value": "lots", "type": "quantity"}); err == nil {
+		t.Errorf("Error: expected an error for a quantity without a unit")
+	}
+}
+
+func Test_Property_sameValue(t *testing.T) {
+	p1 := Property{Name: "memory", Value: "1GiB", Type: PROPERTY_TYPE_QUANTITY}
+	p2 := Property{Name: "memory", Value: "1024MiB", Type: PROPERTY_TYPE_QUANTITY}
+	l1 := Property{Name: "tags", Value: []interface{}{"a", "b"}}
+	l2 := Property{Name: "tags", Value: []string{"a", "b"}}
+
+	if !p1.IsSame(p2) {
+		t.Errorf("Error: %v should be the same as %v", p1, p2)
+	} else if !l1.sameValue(l2) {
+		t.Errorf("Error: %v should have the same value as %v", l1, l2)
+	} else if l1.sameValue(p1) {
+		t.Errorf("Error: %v should not have the same value as %v", l1, p1)
+	}
+
+	pl1 := PropertyList{l1}
+	pl2 := PropertyList{Property{Name: "tags", Value: []interface{}{"a", "c"}}}
+	if err := pl1.Compatible_With(&pl2); err == nil {
+		t.Errorf("Error: %v should not be compatible with %v", pl1, pl2)
+	}
+}
+
+func Test_typed_satisfied(t *testing.T) {
+	prop_list := `[{"name":"memory", "value":"1GiB", "type":"quantity"}, {"name":"cpu", "value":"2GHz", "type":"quantity"},
+		{"name":"firmware", "value":"1.10.0", "type":"version"}]`
+
+	satisfied := []string{
+		`{"and":[{"name":"memory", "value":"512MiB", "op":">="}]}`,
+		`{"and":[{"name":"memory", "value":"1024MiB"}]}`,
+		`{"and":[{"name":"memory", "value":1073741824, "op":"="}]}`,
+		`{"and":[{"name":"memory", "value":["512MiB","2GiB"], "op":"between"}]}`,
+		`{"and":[{"name":"memory", "value":"GiB$", "op":"matches"}]}`,
+		`{"and":[{"name":"cpu", "value":"1500MHz", "op":">"}]}`,
+		`{"and":[{"name":"firmware", "value":"1.9.0", "op":">"}]}`,
+		`{"and":[{"name":"firmware", "value":"[1.0.0,2.0.0)", "op":"version"}]}`,
+	}
+
+	not_satisfied := []string{
+		`{"and":[{"name":"memory", "value":"2GiB", "op":">="}]}`,
+		`{"and":[{"name":"memory", "value":"1GHz", "op":">="}]}`,
+		`{"and":[{"name":"memory", "value":["2GiB","4GiB"], "op":"between"}]}`,
+		`{"and":[{"name":"firmware", "value":"1.10.1", "op":">="}]}`,
+		`{"and":[{"name":"firmware", "value":"1.9.0", "op":"<"}]}`,
+	}
+
+	if pa := create_property_list(prop_list, t); pa != nil {
+		for _, exp := range satisfied {
+			if rp := create_RP(exp, t); rp != nil {
+				if err := rp.IsSatisfiedBy(*pa); err != nil {
+					t.Errorf("Error: %v should be satisfied by %v, error: %v", exp, *pa, err)
+				}
+			}
+		}
+
+		for _, exp := range not_satisfied {
+			if rp := create_RP(exp, t); rp != nil {
+				if err := rp.IsSatisfiedBy(*pa); err == nil {
+					t.Errorf("Error: %v should not be satisfied by %v", exp, *pa)
+				}
+			}
+		}
+	}
+}
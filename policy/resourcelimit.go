@@ -1,6 +1,7 @@
 package policy
 
 import (
+	"errors"
 	"fmt"
 )
 
@@ -16,19 +17,24 @@ func (r ResourceLimit) String() string {
 }
 
 func (self *ResourceLimit) IsSatisfiedBy(other *ResourceLimit) bool {
+	return self.CheckSatisfiedBy(other) == nil
+}
+
+// Same as IsSatisfiedBy, but returns an error that identifies the first limit that is not satisfied.
+func (self *ResourceLimit) CheckSatisfiedBy(other *ResourceLimit) error {
 
 	// If the producer doesn't care then it is easily satisfied
 	if other.NetworkUpload != 0 && self.NetworkUpload > other.NetworkUpload {
-		return false
+		return errors.New(fmt.Sprintf("networkUpload %v exceeds %v", self.NetworkUpload, other.NetworkUpload))
 	} else if other.NetworkDownload != 0 && self.NetworkDownload > other.NetworkDownload {
-		return false
+		return errors.New(fmt.Sprintf("networkDownload %v exceeds %v", self.NetworkDownload, other.NetworkDownload))
 	} else if other.Memory != 0 && self.Memory > other.Memory {
-		return false
+		return errors.New(fmt.Sprintf("memory %v exceeds %v", self.Memory, other.Memory))
 	} else if other.CPUs != 0 && self.CPUs > other.CPUs {
-		return false
+		return errors.New(fmt.Sprintf("cpus %v exceeds %v", self.CPUs, other.CPUs))
 	}
 
-	return true
+	return nil
 }
 
 func (self *ResourceLimit) MergeProducers(other *ResourceLimit) *ResourceLimit {
@@ -0,0 +1,86 @@
+package policy
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// The purpose of this file is to abstract the operations on the Spread type. A spread section is only specified in a
+// consumer policy. It is a list of constraints on how the agreements of the policy are spread over the values of a
+// node property, e.g. over the regions that the nodes are in. The agbot checks the constraints against the agreements
+// it already has before it proposes new agreements:
+//
+// - maxPerValue limits the number of agreements with nodes that have the same value, e.g. at most 2 agreements per
+//   region.
+// - minPerValue makes the agbot propose to nodes with a value that has fewer than this many agreements before the
+//   other nodes, e.g. at least 1 agreement per region. While the devices of the policy are upgraded by a rollout, this
+//   many devices of each value are kept out of the batch being upgraded.
+//
+// The special property name "ha_group" spreads the agreements over the HA groups of the nodes, a node that is not in
+// an HA group is a group of its own. The nodes that do not have the property share an unknown value, which is limited
+// by maxPerValue like any other value but is not made to reach minPerValue.
+//
+// The agreements are counted by each agbot on its own. When several agbots split the nodes of a policy between them,
+// each of them allows maxPerValue agreements per value.
+
+// The property name that stands for the HA group of a node.
+const SPREAD_HA_GROUP = "ha_group"
+
+type SpreadConstraint struct {
+	Property    string `json:"property"`              // The name of the node property whose values the agreements are spread over
+	MaxPerValue int    `json:"maxPerValue,omitempty"` // The maximum number of agreements with nodes that have the same value, zero for no maximum
+	MinPerValue int    `json:"minPerValue,omitempty"` // The number of agreements per value that are made first and kept up during rollouts
+}
+
+func (c SpreadConstraint) String() string {
+	return fmt.Sprintf("%v max %v min %v per value", c.Property, c.MaxPerValue, c.MinPerValue)
+}
+
+func (c SpreadConstraint) IsValid() error {
+	if c.Property == "" {
+		return errors.New(fmt.Sprintf("a spread constraint must name a property"))
+	} else if c.MaxPerValue < 0 {
+		return errors.New(fmt.Sprintf("maxPerValue %v is negative", c.MaxPerValue))
+	} else if c.MinPerValue < 0 {
+		return errors.New(fmt.Sprintf("minPerValue %v is negative", c.MinPerValue))
+	} else if c.MaxPerValue == 0 && c.MinPerValue == 0 {
+		return errors.New(fmt.Sprintf("spread constraint on %v must have a maxPerValue or a minPerValue", c.Property))
+	} else if c.MaxPerValue != 0 && c.MinPerValue > c.MaxPerValue {
+		return errors.New(fmt.Sprintf("minPerValue %v is greater than maxPerValue %v", c.MinPerValue, c.MaxPerValue))
+	}
+	return nil
+}
+
+// Returns the value of the constraint's property in the node properties, and false when the node does not have the
+// property. The value of the "ha_group" property comes from the HA group of the node, which only the agbot knows.
+func (c SpreadConstraint) ValueOf(props PropertyList) (string, bool) {
+	for _, prop := range props {
+		if prop.Name == c.Property {
+			if list, ok := ConvertToStringList(prop.Value); ok {
+				return strings.Join(list, ","), true
+			}
+			return fmt.Sprintf("%v", prop.Value), true
+		}
+	}
+	return "", false
+}
+
+type Spread []SpreadConstraint
+
+func (s Spread) String() string {
+	constraints := make([]string, 0, len(s))
+	for _, c := range s {
+		constraints = append(constraints, c.String())
+	}
+	return fmt.Sprintf("Spread: %v", strings.Join(constraints, ", "))
+}
+
+func (s Spread) IsValid() error {
+	for ix, c := range s {
+		if err := c.IsValid(); err != nil {
+			return errors.New(fmt.Sprintf("constraint %v %v", ix, err))
+		}
+	}
+	return nil
+}
@@ -0,0 +1,56 @@
+// +build unit
+
+package policy
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func Test_spread_isvalid(t *testing.T) {
+
+	valid := `[{"property":"region","maxPerValue":2,"minPerValue":1},{"property":"ha_group","minPerValue":1},{"property":"zone","maxPerValue":3}]`
+
+	s := new(Spread)
+	if err := json.Unmarshal([]byte(valid), s); err != nil {
+		t.Fatalf("unable to demarshal spread, error %v", err)
+	} else if err := s.IsValid(); err != nil {
+		t.Errorf("expected spread %v to be valid, error %v", s, err)
+	} else if (*s)[1].Property != SPREAD_HA_GROUP {
+		t.Errorf("expected the second constraint to be on the HA group, got %v", (*s)[1])
+	}
+
+	invalid := []SpreadConstraint{
+		{MaxPerValue: 1},
+		{Property: "region"},
+		{Property: "region", MaxPerValue: -1},
+		{Property: "region", MinPerValue: -1},
+		{Property: "region", MaxPerValue: 1, MinPerValue: 2},
+	}
+	for _, c := range invalid {
+		if err := (Spread{c}).IsValid(); err == nil {
+			t.Errorf("expected constraint %v to be invalid", c)
+		}
+	}
+}
+
+func Test_spread_value(t *testing.T) {
+
+	props := PropertyList{*Property_Factory("region", "us-east"), *Property_Factory("racks", []interface{}{"r1", "r2"}), *Property_Factory("floor", 3)}
+
+	tests := []struct {
+		property string
+		expected string
+		ok       bool
+	}{
+		{"region", "us-east", true},
+		{"racks", "r1,r2", true},
+		{"floor", "3", true},
+		{"zone", "", false},
+	}
+	for _, test := range tests {
+		if v, ok := (SpreadConstraint{Property: test.property, MaxPerValue: 1}).ValueOf(props); ok != test.ok || v != test.expected {
+			t.Errorf("expected %v to have value %v %v, got %v %v", test.property, test.expected, test.ok, v, ok)
+		}
+	}
+}
@@ -3,24 +3,30 @@ package producer
 import (
 	"errors"
 	"fmt"
-	"github.com/boltdb/bolt"
 	"github.com/golang/glog"
 	"github.com/open-horizon/anax/abstractprotocol"
 	"github.com/open-horizon/anax/basicprotocol"
 	"github.com/open-horizon/anax/config"
+	"github.com/open-horizon/anax/cutil"
 	"github.com/open-horizon/anax/events"
 	"github.com/open-horizon/anax/exchange"
 	"github.com/open-horizon/anax/persistence"
 	"github.com/open-horizon/anax/policy"
 	"github.com/open-horizon/anax/worker"
+	"strings"
+	"time"
 )
 
+// The number of seconds an agbot can go without heartbeating before another agbot can take over its agreements. It is
+// the time the agbots wait, by default, before they stop sharing the nodes with an agbot that stopped heartbeating.
+const AGBOT_DEPARTED_S = 180
+
 type BasicProtocolHandler struct {
 	*BaseProducerProtocolHandler
 	agreementPH *basicprotocol.ProtocolHandler
 }
 
-func NewBasicProtocolHandler(name string, cfg *config.HorizonConfig, db *bolt.DB, pm *policy.PolicyManager, deviceId string, token string) *BasicProtocolHandler {
+func NewBasicProtocolHandler(name string, cfg *config.HorizonConfig, db persistence.Store, pm *policy.PolicyManager, deviceId string, token string) *BasicProtocolHandler {
 	if name == basicprotocol.PROTOCOL_NAME {
 		return &BasicProtocolHandler{
 			BaseProducerProtocolHandler: &BaseProducerProtocolHandler{
@@ -113,9 +119,70 @@ func (c *BasicProtocolHandler) HandleExtensionMessages(msg *events.ExchangeDevic
 		return true, !verify.Exists, verify.AgreementId(), nil
 	}
 
+	// The agreement handoff moves the agreement to another agbot, when the agbots split the nodes between them.
+	if handoff, err := c.agreementPH.ValidateAgreementHandoff(msg.ProtocolMessage()); err != nil {
+		glog.V(5).Infof(BPHlogString(fmt.Sprintf("extension message handler ignoring non-agreement handoff message: %s due to %v", msg.ShortProtocolMessage(), err)))
+	} else if err := c.handOffAgreement(handoff, exchangeMsg.AgbotId); err != nil {
+		return false, false, handoff.AgreementId(), err
+	} else {
+		glog.V(5).Infof(BPHlogString(fmt.Sprintf("extension handler handled agreement handoff for %v", handoff.AgreementId())))
+		return true, false, handoff.AgreementId(), nil
+	}
+
 	return false, false, "", nil
 }
 
+// Move an agreement to the agbot named in the handoff and send that agbot the proposal of the agreement, so that it can
+// take over governing the agreement. The agbot that has the agreement can hand it to any agbot. Any other agbot can only
+// take the agreement for itself, once the agbot that has the agreement has stopped heartbeating. A handoff that is not
+// allowed is ignored, an error is returned when the handoff should be tried again.
+func (c *BasicProtocolHandler) handOffAgreement(handoff *basicprotocol.BAgreementHandoff, senderId string) error {
+
+	if ags, err := persistence.FindEstablishedAgreements(c.db, c.Name(), []persistence.EAFilter{persistence.UnarchivedEAFilter(), persistence.IdEAFilter(handoff.AgreementId())}); err != nil {
+		return errors.New(BPHlogString(fmt.Sprintf("unable to retrieve agreement %v from database, error %v", handoff.AgreementId(), err)))
+	} else if len(ags) != 1 {
+		glog.Warningf(BPHlogString(fmt.Sprintf("handoff ignored, unable to retrieve single agreement %v from database", handoff.AgreementId())))
+	} else if ags[0].AgreementTerminatedTime != 0 {
+		glog.V(5).Infof(BPHlogString(fmt.Sprintf("ignoring handoff, agreement %v is terminating", handoff.AgreementId())))
+	} else if ags[0].ConsumerId == handoff.NewConsumer {
+		glog.V(5).Infof(BPHlogString(fmt.Sprintf("ignoring handoff, agreement %v is already with %v", handoff.AgreementId(), handoff.NewConsumer)))
+	} else if senderId != ags[0].ConsumerId && senderId != handoff.NewConsumer {
+		glog.Warningf(BPHlogString(fmt.Sprintf("handoff ignored, handoff of %v to %v came from id %v but agreement is with %v", handoff.AgreementId(), handoff.NewConsumer, senderId, ags[0].ConsumerId)))
+	} else if departed, err := c.agbotDeparted(ags[0].ConsumerId); senderId != ags[0].ConsumerId && err != nil {
+		return err
+	} else if senderId != ags[0].ConsumerId && !departed {
+		glog.Warningf(BPHlogString(fmt.Sprintf("handoff ignored, agbot %v asked for agreement %v but agbot %v that has it is still heartbeating", senderId, handoff.AgreementId(), ags[0].ConsumerId)))
+	} else if _, pubkey, err := c.GetAgbotMessageEndpoint(handoff.NewConsumer); err != nil {
+		return errors.New(BPHlogString(fmt.Sprintf("error getting agbot %v message target: %v", handoff.NewConsumer, err)))
+	} else if mt, err := exchange.CreateMessageTarget(handoff.NewConsumer, nil, pubkey, ""); err != nil {
+		return errors.New(BPHlogString(fmt.Sprintf("error creating message target: %v", err)))
+	} else if err := c.agreementPH.SendAgreementHandoffReply(handoff.AgreementId(), ags[0].ConsumerId, ags[0].Proposal, ags[0].ProposalSig, mt, c.GetSendMessage()); err != nil {
+		return errors.New(BPHlogString(fmt.Sprintf("error sending handoff reply for %v to %v: %v", handoff.AgreementId(), handoff.NewConsumer, err)))
+
+		// The new agbot is only recorded once it has the proposal. If it never takes over the agreement, the agreement
+		// verification with the new agbot fails and the agreement is cancelled.
+	} else if _, err := persistence.AgreementStateConsumerChanged(c.db, handoff.AgreementId(), c.Name(), handoff.NewConsumer); err != nil {
+		glog.Errorf(BPHlogString(fmt.Sprintf("unable to record handoff of agreement %v to %v, error: %v", handoff.AgreementId(), handoff.NewConsumer, err)))
+	} else {
+		glog.V(3).Infof(BPHlogString(fmt.Sprintf("agreement %v handed off from agbot %v to agbot %v", handoff.AgreementId(), ags[0].ConsumerId, handoff.NewConsumer)))
+	}
+	return nil
+}
+
+// An agbot has departed when it has not heartbeated for longer than the time the agbots give each other before they
+// stop sharing the nodes with a silent agbot, or when it is no longer in the exchange.
+func (c *BasicProtocolHandler) agbotDeparted(agbotId string) (bool, error) {
+	if ag, err := c.getAgbot(agbotId, c.config.Edge.ExchangeURL, c.deviceId, c.token); err != nil && strings.Contains(err.Error(), "not in GET response") {
+		return true, nil
+	} else if err != nil {
+		return false, err
+	} else if ag.LastHeartbeat == "" {
+		return true, nil
+	} else {
+		return cutil.TimeInSeconds(ag.LastHeartbeat)+AGBOT_DEPARTED_S < time.Now().Unix(), nil
+	}
+}
+
 func (c *BasicProtocolHandler) GetTerminationCode(reason string) uint {
 	switch reason {
 	case TERM_REASON_POLICY_CHANGED:
@@ -156,6 +223,10 @@ func (c *BasicProtocolHandler) GetTerminationCode(reason string) uint {
 		return basicprotocol.CANCEL_IMAGE_SIG_VERIF_FAILURE
 	case TERM_REASON_NODE_SHUTDOWN:
 		return basicprotocol.CANCEL_NODE_SHUTDOWN
+	case TERM_REASON_AVAILABILITY_CLOSED:
+		return basicprotocol.CANCEL_AVAILABILITY_CLOSED
+	case TERM_REASON_CONTAINER_UNHEALTHY:
+		return basicprotocol.CANCEL_CONTAINER_UNHEALTHY
 	default:
 		return 999
 	}
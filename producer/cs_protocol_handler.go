@@ -3,7 +3,6 @@ package producer
 import (
 	"errors"
 	"fmt"
-	"github.com/boltdb/bolt"
 	"github.com/golang/glog"
 	"github.com/open-horizon/anax/abstractprotocol"
 	"github.com/open-horizon/anax/citizenscientist"
@@ -30,7 +29,7 @@ type CSProtocolHandler struct {
 	bcState            map[string]map[string]map[string]*BlockchainState
 }
 
-func NewCSProtocolHandler(name string, cfg *config.HorizonConfig, db *bolt.DB, pm *policy.PolicyManager, deviceId string, token string) *CSProtocolHandler {
+func NewCSProtocolHandler(name string, cfg *config.HorizonConfig, db persistence.Store, pm *policy.PolicyManager, deviceId string, token string) *CSProtocolHandler {
 	if name == citizenscientist.PROTOCOL_NAME {
 
 		return &CSProtocolHandler{
@@ -212,6 +211,10 @@ func (c *CSProtocolHandler) GetTerminationCode(reason string) uint {
 		return citizenscientist.CANCEL_IMAGE_SIG_VERIF_FAILURE
 	case TERM_REASON_NODE_SHUTDOWN:
 		return citizenscientist.CANCEL_NODE_SHUTDOWN
+	case TERM_REASON_AVAILABILITY_CLOSED:
+		return citizenscientist.CANCEL_AVAILABILITY_CLOSED
+	case TERM_REASON_CONTAINER_UNHEALTHY:
+		return citizenscientist.CANCEL_CONTAINER_UNHEALTHY
 	default:
 		return 999
 	}
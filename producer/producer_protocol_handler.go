@@ -4,10 +4,10 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
-	"github.com/boltdb/bolt"
 	"github.com/golang/glog"
 	"github.com/open-horizon/anax/abstractprotocol"
 	"github.com/open-horizon/anax/api"
+	"github.com/open-horizon/anax/apicommon"
 	"github.com/open-horizon/anax/config"
 	"github.com/open-horizon/anax/events"
 	"github.com/open-horizon/anax/exchange"
@@ -18,7 +18,7 @@ import (
 	"time"
 )
 
-func CreateProducerPH(name string, cfg *config.HorizonConfig, db *bolt.DB, pm *policy.PolicyManager, id string, token string) ProducerProtocolHandler {
+func CreateProducerPH(name string, cfg *config.HorizonConfig, db persistence.Store, pm *policy.PolicyManager, id string, token string) ProducerProtocolHandler {
 	if handler := NewCSProtocolHandler(name, cfg, db, pm, id, token); handler != nil {
 		return handler
 	} else if handler := NewBasicProtocolHandler(name, cfg, db, pm, id, token); handler != nil {
@@ -54,7 +54,7 @@ type ProducerProtocolHandler interface {
 type BaseProducerProtocolHandler struct {
 	name     string
 	pm       *policy.PolicyManager
-	db       *bolt.DB
+	db       persistence.Store
 	config   *config.HorizonConfig
 	deviceId string
 	token    string
@@ -170,6 +170,13 @@ func (w *BaseProducerProtocolHandler) HandleProposal(ph abstractprotocol.Protoco
 		handled = true
 	} else if messageTarget, err := exchange.CreateMessageTarget(exchangeMsg.AgbotId, nil, exchangeMsg.AgbotPubKey, ""); err != nil {
 		glog.Errorf(BPPHlogString(w.Name(), fmt.Sprintf("error creating message target: %v", err)))
+	} else if disk, err := apicommon.GetDiskState(&w.config.Edge); err == nil && disk.BelowFloor {
+		// Tell the agbot right away, so that it does not wait for a reply that never comes.
+		handled = true
+		reason := errors.New(fmt.Sprintf("only %vMB is free on %v, below the minimum of %vMB", disk.FreeMB, disk.Path, disk.MinFreeMB))
+		if err := abstractprotocol.RejectProposal(ph, proposal, w.deviceId, reason, messageTarget, w.sendMessage); err != nil {
+			glog.Errorf(BPPHlogString(w.Name(), fmt.Sprintf("unable to reject proposal, error: %v", err)))
+		}
 	} else {
 		handled = true
 		if r, err := ph.DecideOnProposal(proposal, w.deviceId, exchange.GetOrg(w.deviceId), runningBCs, messageTarget, w.sendMessage); err != nil {
@@ -396,6 +403,8 @@ const TERM_REASON_IMAGE_FETCH_FAILURE = "ImageFetchFailure"
 const TERM_REASON_IMAGE_FETCH_AUTH_FAILURE = "ImageFetchAuthorizationFailure"
 const TERM_REASON_IMAGE_SIG_VERIF_FAILURE = "ImageSignatureVerificationFailure"
 const TERM_REASON_NODE_SHUTDOWN = "NodeShutdown"
+const TERM_REASON_AVAILABILITY_CLOSED = "AvailabilityClosed"
+const TERM_REASON_CONTAINER_UNHEALTHY = "ContainerUnhealthy"
 
 // ==============================================================================================================
 type ExchangeMessageCommand struct {
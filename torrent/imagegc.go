@@ -0,0 +1,229 @@
+package torrent
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"time"
+
+	docker "github.com/fsouza/go-dockerclient"
+	"github.com/golang/glog"
+	"github.com/open-horizon/anax/apicommon"
+	"github.com/open-horizon/anax/containermessage"
+	"github.com/open-horizon/anax/events"
+	"github.com/open-horizon/anax/metrics"
+	"github.com/open-horizon/anax/persistence"
+	"github.com/open-horizon/anax/policy"
+)
+
+// The images pulled or loaded for deployments are recorded with the agreements and microservice instances that use
+// them. When the image filesystem fills past the high watermark, the images that are not used by an active agreement
+// or microservice instance are removed, least recently used first, until the usage is below the low watermark.
+// Images that anax did not fetch itself, and the images of blockchain containers, are never removed.
+
+const IMAGE_GC = "ImageGC"
+
+// The default number of seconds between checks of the image filesystem.
+const DEFAULT_IMAGE_GC_INTERVAL_S = 300
+
+// The number of hours after which the garbage collector removes a partial image part that was not resumed.
+const PARTIAL_EXPIRY_H = 24
+
+var imagesRemoved = metrics.NodeRegistry.NewCounterVec("anax_images_removed_total", "The number of unused images removed to free disk space.")
+
+// Record the images of a deployment as used by the agreement or microservice instance of the launch context.
+func recordImageUse(db persistence.Store, lc events.LaunchContext, deploymentDesc *containermessage.DeploymentDescription) {
+	if clc, ok := lc.(*events.ContainerLaunchContext); ok && clc.Blockchain.Name != "" {
+		return
+	}
+	recordDeploymentImages(db, deploymentDesc, launchReference(lc))
+}
+
+// Record the images of a deployment as used by the reference. Images that are recorded without a reference, like the
+// pre-fetched images, are not used by anything yet.
+func recordDeploymentImages(db persistence.Store, deploymentDesc *containermessage.DeploymentDescription, reference string) {
+	for _, service := range deploymentDesc.Services {
+		if _, err := persistence.RecordImageUse(db, service.Image, reference); err != nil {
+			glog.Errorf("Unable to record the use of image %v by %v, error: %v", service.Image, reference, err)
+		}
+	}
+}
+
+// Returns the agreement id or the microservice instance key of a launch context.
+func launchReference(lc events.LaunchContext) string {
+	switch lc.(type) {
+	case *events.AgreementLaunchContext:
+		return lc.(*events.AgreementLaunchContext).AgreementId
+	case *events.ContainerLaunchContext:
+		return lc.(*events.ContainerLaunchContext).Name
+	}
+	return ""
+}
+
+// Returns the agreement ids and microservice instance keys that can still run containers.
+func activeImageReferences(db persistence.Store) (map[string]bool, error) {
+	active := make(map[string]bool)
+
+	if ags, err := persistence.FindEstablishedAgreementsAllProtocols(db, policy.AllAgreementProtocols(), []persistence.EAFilter{persistence.UnarchivedEAFilter()}); err != nil {
+		return nil, fmt.Errorf("Unable to read agreements, error: %v", err)
+	} else {
+		for _, ag := range ags {
+			if ag.AgreementTerminatedTime == 0 {
+				active[ag.CurrentAgreementId] = true
+			}
+		}
+	}
+
+	if msis, err := persistence.FindMicroserviceInstances(db, []persistence.MIFilter{persistence.UnarchivedMIFilter(), persistence.NotCleanedUpMIFilter()}); err != nil {
+		return nil, fmt.Errorf("Unable to read microservice instances, error: %v", err)
+	} else {
+		for _, msi := range msis {
+			active[msi.GetKey()] = true
+		}
+	}
+
+	return active, nil
+}
+
+// Returns the images that can be removed, least recently used first. An image is unused when none of its
+// references is active and no container, running or not, was created from it.
+func unusedImages(records []persistence.ImageRecord, active map[string]bool, containerImages map[string]bool) []persistence.ImageRecord {
+	unused := make([]persistence.ImageRecord, 0)
+	for _, record := range records {
+		used := containerImages[record.Name]
+		for _, ref := range record.References {
+			if active[ref] {
+				used = true
+			}
+		}
+		if !used {
+			unused = append(unused, record)
+		}
+	}
+	return unused
+}
+
+// Remove the image parts that a failed fetch left behind in the torrent directory. Fetches for agreements run on the
+// torrent worker's command thread, so none is in progress when this runs, and the parts are left alone while a
+// pre-fetch is running. The peer cache is kept, it holds verified packages. The partial parts that are kept to resume
+// a download are kept too, unless they have not been written to for PARTIAL_EXPIRY_H hours.
+func removeImageParts(dir string) {
+	if dir == "" {
+		return
+	}
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		glog.V(3).Infof("Unable to read torrent directory %v, error: %v", dir, err)
+		return
+	}
+	for _, f := range files {
+		if f.Name() == PEER_CACHE_DIR {
+			continue
+		} else if f.Name() == PARTIAL_DIR {
+			removeStaleParts(path.Join(dir, f.Name()))
+			continue
+		}
+		glog.V(3).Infof("Removing image part %v left behind by a failed fetch", f.Name())
+		if err := os.RemoveAll(path.Join(dir, f.Name())); err != nil {
+			glog.Errorf("Unable to remove %v, error: %v", f.Name(), err)
+		}
+	}
+}
+
+// Remove the partial parts that are too old to be resumed.
+func removeStaleParts(dir string) {
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		glog.V(3).Infof("Unable to read partial directory %v, error: %v", dir, err)
+		return
+	}
+	expiry := time.Now().Add(-PARTIAL_EXPIRY_H * time.Hour)
+	for _, f := range files {
+		if f.ModTime().After(expiry) {
+			continue
+		}
+		glog.V(3).Infof("Removing partial image part %v, last written %v", f.Name(), f.ModTime())
+		if err := os.RemoveAll(path.Join(dir, f.Name())); err != nil {
+			glog.Errorf("Unable to remove %v, error: %v", f.Name(), err)
+		}
+	}
+}
+
+// Check the usage of the image filesystem, and remove unused images when it is over the high watermark.
+func (w *TorrentWorker) collectImages() {
+	disk, err := apicommon.GetDiskState(&w.Config.Edge)
+	if err != nil {
+		glog.V(3).Infof("Skipping image garbage collection: %v", err)
+		return
+	} else if disk.BelowFloor {
+		glog.Warningf("Only %vMB is free on %v, new agreements are refused until %vMB is free", disk.FreeMB, disk.Path, disk.MinFreeMB)
+	}
+
+	if !disk.OverHighWatermark() {
+		glog.V(5).Infof("Image filesystem %v is %v%% used, no images need to be removed", disk.Path, disk.UsedPercent)
+		return
+	}
+	glog.Infof("Image filesystem %v is %v%% used, removing unused images until it is below %v%%", disk.Path, disk.UsedPercent, disk.LowWatermark)
+
+	if !w.isPrefetching() {
+		removeImageParts(w.Config.Edge.TorrentDir)
+	}
+
+	active, err := activeImageReferences(w.db)
+	if err != nil {
+		glog.Errorf("Unable to garbage collect images: %v", err)
+		return
+	}
+
+	records, err := persistence.FindImageRecords(w.db)
+	if err != nil {
+		glog.Errorf("Unable to garbage collect images, error reading image records: %v", err)
+		return
+	}
+
+	containers, err := w.client.ListContainers(docker.ListContainersOptions{All: true})
+	if err != nil {
+		glog.Errorf("Unable to garbage collect images, error listing containers: %v", err)
+		return
+	}
+	containerImages := make(map[string]bool)
+	for _, c := range containers {
+		containerImages[c.Image] = true
+	}
+
+	for _, record := range unusedImages(records, active, containerImages) {
+		if disk, err = apicommon.GetDiskState(&w.Config.Edge); err != nil || disk.UnderLowWatermark() {
+			break
+		}
+
+		glog.Infof("Removing unused image %v, last used %v", record.Name, record.LastUsed)
+		if err := w.client.RemoveImage(record.Name); err == docker.ErrNoSuchImage {
+			glog.V(3).Infof("Image %v has already been removed", record.Name)
+		} else if err != nil {
+			// Docker refuses to remove an image that a container still uses, leave the record to try again later.
+			glog.Warningf("Unable to remove image %v, error: %v", record.Name, err)
+			continue
+		} else {
+			imagesRemoved.Inc()
+		}
+
+		if err := persistence.DeleteImageRecord(w.db, record.Name); err != nil {
+			glog.Errorf("Unable to delete the record of image %v, error: %v", record.Name, err)
+		}
+	}
+
+	if disk != nil && !disk.UnderLowWatermark() {
+		glog.Warningf("Image filesystem %v is still %v%% used, there are no more unused images to remove", disk.Path, disk.UsedPercent)
+	}
+}
+
+type ImageGCCommand struct{}
+
+func (i ImageGCCommand) ShortString() string {
+	return "ImageGCCommand"
+}
+
+func (w *TorrentWorker) NewImageGCCommand() *ImageGCCommand {
+	return &ImageGCCommand{}
+}
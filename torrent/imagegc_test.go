@@ -0,0 +1,60 @@
+// +build unit
+
+package torrent
+
+import (
+	"github.com/open-horizon/anax/persistence"
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+	"time"
+)
+
+func Test_unusedImages(t *testing.T) {
+	records := []persistence.ImageRecord{
+		{Name: "org/old:1.0", References: []string{"ag1"}, LastUsed: 100},
+		{Name: "org/running:1.0", References: []string{"ag2", "ag3"}, LastUsed: 200},
+		{Name: "org/stopped:1.0", References: []string{}, LastUsed: 300},
+		{Name: "org/ms:2.0", References: []string{"ms-key"}, LastUsed: 400},
+		{Name: "org/new:1.0", References: []string{"ag4"}, LastUsed: 500},
+	}
+	active := map[string]bool{"ag3": true, "ms-key": true}
+	containerImages := map[string]bool{"org/stopped:1.0": true}
+
+	unused := unusedImages(records, active, containerImages)
+	if len(unused) != 2 || unused[0].Name != "org/old:1.0" || unused[1].Name != "org/new:1.0" {
+		t.Errorf("expected the unreferenced images least recently used first, got %v", unused)
+	}
+}
+
+func Test_removeImageParts(t *testing.T) {
+	dir, err := ioutil.TempDir("", "imagegc")
+	if err != nil {
+		t.Fatalf("unable to create temp dir, error: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	old := time.Now().Add(-(PARTIAL_EXPIRY_H + 1) * time.Hour)
+	for _, d := range []string{PARTIAL_DIR, PEER_CACHE_DIR, "pkg-part"} {
+		os.MkdirAll(path.Join(dir, d), 0700)
+	}
+	for _, f := range []string{path.Join(PARTIAL_DIR, "fresh"), path.Join(PARTIAL_DIR, "stale"), path.Join(PEER_CACHE_DIR, "cached"), "pkg-part/image.tar"} {
+		ioutil.WriteFile(path.Join(dir, f), []byte("part"), 0600)
+	}
+	os.Chtimes(path.Join(dir, PARTIAL_DIR, "stale"), old, old)
+	os.Chtimes(path.Join(dir, PEER_CACHE_DIR, "cached"), old, old)
+
+	removeImageParts(dir)
+
+	for f, kept := range map[string]bool{
+		path.Join(PARTIAL_DIR, "fresh"):     true,
+		path.Join(PARTIAL_DIR, "stale"):     false,
+		path.Join(PEER_CACHE_DIR, "cached"): true,
+		"pkg-part":                          false,
+	} {
+		if _, err := os.Stat(path.Join(dir, f)); (err == nil) != kept {
+			t.Errorf("expected %v to be kept: %v, got error %v", f, kept, err)
+		}
+	}
+}
@@ -9,15 +9,100 @@ import (
 	"github.com/golang/glog"
 	"github.com/open-horizon/anax/config"
 	"github.com/open-horizon/anax/containermessage"
+	"net/http"
 	"os"
-	"time"
 )
 
-const (
-	pullAttemptDelayS = 15
+// The only kind of image content digest that docker registries use.
+const digestAlgorithm = "sha256:"
 
-	maxPullAttempts = 3
-)
+// An image reference from a deployment description, e.g. "registry:5000/org/image:1.0" or "org/image@sha256:<hex>".
+// An image that is referenced by digest is immutable, the content of an image that is referenced by a tag can change.
+type imageReference struct {
+	Repository string
+	Tag        string
+	Digest     string
+}
+
+func (r imageReference) String() string {
+	if r.Digest != "" {
+		return r.Repository + "@" + r.Digest
+	}
+	return r.Repository + ":" + r.Tag
+}
+
+func parseImageReference(image string) (*imageReference, error) {
+	ref := new(imageReference)
+
+	name := image
+	if ix := strings.Index(image, "@"); ix != -1 {
+		name = image[:ix]
+		ref.Digest = image[ix+1:]
+		if !strings.HasPrefix(ref.Digest, digestAlgorithm) || len(ref.Digest) != len(digestAlgorithm)+64 || strings.Trim(ref.Digest[len(digestAlgorithm):], "0123456789abcdef") != "" {
+			return nil, fmt.Errorf("image %v has an invalid digest, expected %v followed by 64 lowercase hex characters", image, digestAlgorithm)
+		}
+	}
+
+	// A colon after the last slash separates the tag, a colon before it is part of a registry host:port.
+	if ix := strings.LastIndex(name, ":"); ix != -1 && ix > strings.LastIndex(name, "/") {
+		ref.Repository = name[:ix]
+		ref.Tag = name[ix+1:]
+	} else {
+		ref.Repository = name
+	}
+
+	if ref.Repository == "" {
+		return nil, fmt.Errorf("image %v has no repository", image)
+	} else if ref.Tag == "" && ref.Digest == "" {
+		ref.Tag = "latest"
+	}
+	return ref, nil
+}
+
+// Docker drops the default registry and library prefixes from the repository names that it records.
+func normalizeRepository(repository string) string {
+	repository = strings.TrimPrefix(repository, "docker.io/")
+	return strings.TrimPrefix(repository, "library/")
+}
+
+// The error returned when a pulled image cannot be shown to be the image that was named in the signed deployment
+// description, or when an image is named by a mutable tag and the org requires digests.
+type ImageDigestError struct {
+	Msg string
+}
+
+func (e ImageDigestError) Error() string {
+	return e.Msg
+}
+
+// Returns true if the images of the given org must be referenced by digest. The orgs are a comma separated list,
+// "*" means all orgs.
+func digestRequired(requiredOrgs string, org string) bool {
+	for _, o := range strings.Split(requiredOrgs, ",") {
+		if o = strings.TrimSpace(o); o == "*" || (o != "" && o == org) {
+			return true
+		}
+	}
+	return false
+}
+
+// Check that the image docker has under the given reference has the digest that the deployment description named.
+// Docker addresses the content of the image by its digest, so this proves that the pulled image is the one that
+// is covered by the deployment signature.
+func verifyImageDigest(client *docker.Client, ref *imageReference) error {
+	image, err := client.InspectImage(ref.String())
+	if err != nil {
+		return ImageDigestError{Msg: fmt.Sprintf("unable to inspect pulled image %v, error: %v", ref, err)}
+	}
+
+	for _, repoDigest := range image.RepoDigests {
+		parts := strings.SplitN(repoDigest, "@", 2)
+		if len(parts) == 2 && parts[1] == ref.Digest && normalizeRepository(parts[0]) == normalizeRepository(ref.Repository) {
+			return nil
+		}
+	}
+	return ImageDigestError{Msg: fmt.Sprintf("pulled image %v has digests %v, none of them is the digest in the deployment description", ref, image.RepoDigests)}
+}
 
 func dockerCredsFromConfigFile(configFilePath string) (*docker.AuthConfigurations, error) {
 
@@ -35,7 +120,22 @@ func dockerCredsFromConfigFile(configFilePath string) (*docker.AuthConfiguration
 	return auths, nil
 }
 
-func pullImageFromRepos(config config.Config, authConfigs *docker.AuthConfigurations, client *docker.Client, skipPartFetchFn *func(repotag string) (bool, error), deploymentDesc *containermessage.DeploymentDescription) error {
+// Pull the images of the deployment. The progress of each image is kept in the progress tracker under the reference,
+// the pulls are paced to the rate of the limiter when there is one, and a pull that fails with an error that a retry
+// can fix is returned as a fetchRetryError.
+func pullImageFromRepos(config config.Config, httpClient *http.Client, authConfigs *docker.AuthConfigurations, client *docker.Client, skipPartFetchFn *func(repotag string) (bool, error), deploymentDesc *containermessage.DeploymentDescription, org string, progress *ProgressTracker, reference string, limiter *rateLimiter, retry *fetchRetry) error {
+
+	// Check all the image references before pulling anything
+	refs := make(map[string]*imageReference)
+	for name, service := range deploymentDesc.Services {
+		if ref, err := parseImageReference(service.Image); err != nil {
+			return ImageDigestError{Msg: fmt.Sprintf("service %v: %v", name, err)}
+		} else if ref.Digest == "" && digestRequired(config.RequireImageDigestOrgs, org) {
+			return ImageDigestError{Msg: fmt.Sprintf("service %v image %v is referenced by the mutable tag %v, org %v requires images to be referenced by digest", name, service.Image, ref.Tag, org)}
+		} else {
+			refs[name] = ref
+		}
+	}
 
 	// auth from creds file
 	file_name := ""
@@ -66,59 +166,97 @@ func pullImageFromRepos(config config.Config, authConfigs *docker.AuthConfigurat
 
 	// TODO: can we fetch in parallel with the docker client? If so, lift pattern from https://github.com/open-horizon/horizon-pkg-fetch/blob/master/fetch.go#L350
 	for name, service := range deploymentDesc.Services {
-		var pullAttempts int
-
 		glog.Infof("Pulling image %v for service %v", service.Image, name)
-		imageNameParts := strings.Split(service.Image, ":")
+		ref := refs[name]
 
-		// TODO: check the on-disk image to make sure it still verifies
-		// N.B. It's possible to specify an outputstream here which means we could fetch a docker image and hash it, check the sig like we used to
-		opts := docker.PullImageOptions{
-			Repository: imageNameParts[0],
-			Tag:        imageNameParts[1],
-		}
+		progress.begin(service.Image, reference)
 
-		var auth docker.AuthConfiguration
-		for domainName, creds := range authConfigs.Configs {
-			repName := strings.Split(imageNameParts[0], "/")
-			if repName[0] == domainName {
-				auth = creds
+		// An image that is referenced by digest keeps the reference of the mirror, see pullFromMirror.
+		var err error
+		pulled := false
+		image := service.Image
+		if config.RegistryMirror != "" {
+			if mirrored, err := pullFromMirror(httpClient, client, config.RegistryMirror, ref, authConfigs, image, progress, reference, limiter); err != nil {
+				glog.Warningf("Unable to pull image %v for service %v from mirror %v, pulling it from its registry. Error: %v", image, name, config.RegistryMirror, err)
+			} else {
+				glog.Infof("Succeeded fetching image %v for service %v from mirror %v", image, name, config.RegistryMirror)
+				service.Image = mirrored
+				pulled = true
 			}
 		}
 
-		for pullAttempts <= maxPullAttempts {
-			if err := client.PullImage(opts, auth); err == nil {
-				glog.Infof("Succeeded fetching image %v for service %v", service.Image, name)
-				break
-			} else {
-				glog.Errorf("Docker image pull(s) failed. Waiting %d seconds before retry. Error: %v", pullAttemptDelayS, err)
-				pullAttempts++
-
-				if pullAttempts != maxPullAttempts {
-					time.Sleep(pullAttemptDelayS * time.Second)
-				} else {
-					msg := fmt.Sprintf("Max pull attempts reached (%d). Aborting fetch of Docker image %v", pullAttempts, service.Image)
-
-					switch err.(type) {
-					case *docker.Error:
-						dErr := err.(*docker.Error)
-						if dErr.Status == 500 && strings.Contains(dErr.Message, "cred") {
-							return fetcherrors.PkgSourceFetchAuthError{Msg: msg, InternalError: dErr}
-						} else {
-							glog.Infof("Docker client error occurred %v", err)
-							return err
-						}
-
-					default:
-						glog.Errorf("(Unknown error type, %T) Internal error of unidentifiable type: %v. Original: %v", err, msg, err)
-						return err
-
-					}
-				}
-			}
+		if !pulled {
+			opts, auth := pullOptions(ref, authConfigs)
+			err = pullImage(client, opts, auth, ref, name, image, progress, reference, limiter, retry)
 		}
+		progress.end(image, reference, err)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
 
+// The options and the credentials to pull an image. An image that is referenced by digest is pulled by digest,
+// docker takes the digest in place of the tag.
+func pullOptions(ref *imageReference, authConfigs *docker.AuthConfigurations) (docker.PullImageOptions, docker.AuthConfiguration) {
+	opts := docker.PullImageOptions{
+		Repository: ref.Repository,
+		Tag:        ref.Tag,
+	}
+	if ref.Digest != "" {
+		opts.Tag = ref.Digest
 	}
 
+	var auth docker.AuthConfiguration
+	for domainName, creds := range authConfigs.Configs {
+		repName := strings.Split(ref.Repository, "/")
+		if repName[0] == domainName {
+			auth = creds
+		}
+	}
+	return opts, auth
+}
+
+// Pull an image once, reporting its progress, and pace the pull to the rate of the limiter.
+func pullOnce(client *docker.Client, opts docker.PullImageOptions, auth docker.AuthConfiguration, image string, progress *ProgressTracker, reference string, limiter *rateLimiter) error {
+	pw := newPullProgressWriter(progress, image, reference)
+	opts.OutputStream = pw
+	opts.RawJSONStream = true
+
+	err := client.PullImage(opts, auth)
+	if err == nil {
+		err = pw.err
+	}
+	if err != nil {
+		if pullAuthError(err) {
+			return fetcherrors.PkgSourceFetchAuthError{Msg: fmt.Sprintf("Unable to pull Docker image %v, the registry refused the credentials", image), InternalError: err}
+		}
+		return err
+	}
+
+	limiter.wait(pw.downloaded())
 	return nil
 }
+
+// Pull one image of a deployment, a failed pull is retried by the retry. Docker keeps the layers that it downloaded
+// completely, so a retry resumes the pull from the first incomplete layer. Docker downloads the layers itself, so a limiter can only
+// pace the pulls: after an image is pulled, the next one waits until the average rate is back under the limit.
+func pullImage(client *docker.Client, opts docker.PullImageOptions, auth docker.AuthConfiguration, ref *imageReference, name string, image string, progress *ProgressTracker, reference string, limiter *rateLimiter, retry *fetchRetry) error {
+
+	return retry.try(registryOf(ref.Repository), fmt.Sprintf("image %v for service %v", image, name), func() error {
+		if err := pullOnce(client, opts, auth, image, progress, reference, limiter); err != nil {
+			return err
+		}
+
+		glog.Infof("Succeeded fetching image %v for service %v", image, name)
+		if ref.Digest != "" {
+			if err := verifyImageDigest(client, ref); err != nil {
+				return err
+			}
+			glog.V(3).Infof("Verified digest of image %v for service %v", image, name)
+		}
+		return nil
+	})
+}
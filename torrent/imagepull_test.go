@@ -0,0 +1,58 @@
+// +build unit
+
+package torrent
+
+import (
+	"strings"
+	"testing"
+)
+
+func Test_parseImageReference(t *testing.T) {
+	digest := "sha256:" + strings.Repeat("0123456789abcdef", 4)
+
+	tests := []struct {
+		image    string
+		expected imageReference
+	}{
+		{"mycompany/x86/netspeed5:v2.5", imageReference{Repository: "mycompany/x86/netspeed5", Tag: "v2.5"}},
+		{"ubuntu", imageReference{Repository: "ubuntu", Tag: "latest"}},
+		{"registry.example.com:5000/org/image:1.0", imageReference{Repository: "registry.example.com:5000/org/image", Tag: "1.0"}},
+		{"registry.example.com:5000/org/image", imageReference{Repository: "registry.example.com:5000/org/image", Tag: "latest"}},
+		{"org/image@" + digest, imageReference{Repository: "org/image", Digest: digest}},
+		{"registry.example.com:5000/org/image:1.0@" + digest, imageReference{Repository: "registry.example.com:5000/org/image", Tag: "1.0", Digest: digest}},
+	}
+
+	for _, test := range tests {
+		if ref, err := parseImageReference(test.image); err != nil {
+			t.Errorf("unexpected error parsing %v: %v", test.image, err)
+		} else if *ref != test.expected {
+			t.Errorf("expected %v to parse as %v, got %v", test.image, test.expected, *ref)
+		}
+	}
+
+	if ref, _ := parseImageReference("org/image:1.0@" + digest); ref.String() != "org/image@"+digest {
+		t.Errorf("expected an image with a digest to be referenced by digest, got %v", ref)
+	}
+
+	for _, bad := range []string{"org/image@sha256:1234", "org/image@md5:" + strings.Repeat("0", 64), "org/image@" + strings.ToUpper(digest), ":1.0"} {
+		if _, err := parseImageReference(bad); err == nil {
+			t.Errorf("expected %v to be rejected", bad)
+		}
+	}
+}
+
+func Test_digestRequired(t *testing.T) {
+	if digestRequired("", "myorg") {
+		t.Errorf("expected no org to require digests")
+	} else if !digestRequired("other, myorg", "myorg") || digestRequired("other,myorg2", "myorg") {
+		t.Errorf("expected only the listed orgs to require digests")
+	} else if !digestRequired("*", "myorg") || !digestRequired("*", "") {
+		t.Errorf("expected all orgs to require digests")
+	} else if digestRequired("myorg", "") {
+		t.Errorf("expected an image without an org to require digests only for all orgs")
+	}
+
+	if normalizeRepository("docker.io/library/ubuntu") != "ubuntu" || normalizeRepository("org/image") != "org/image" {
+		t.Errorf("expected docker hub repositories to be normalized")
+	}
+}
@@ -0,0 +1,208 @@
+package torrent
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+
+	docker "github.com/fsouza/go-dockerclient"
+	"github.com/golang/glog"
+)
+
+// A site-local registry mirror holds copies of the images of the registries that the nodes of a site pull from, so
+// that an image crosses the site uplink once. The mirror keeps each image under the path it has in its own registry,
+// prefixed with the registry host when the image is not on docker hub, e.g. registry.example.com/org/gps:1.0 is
+// mirror:5000/registry.example.com/org/gps:1.0 and openhorizon/gps:1.0 is mirror:5000/openhorizon/gps:1.0. An image
+// is tried once on the mirror, and is pulled from its own registry when the mirror does not have it.
+//
+// The mirror is not trusted with the content of an image. An image is pulled from the mirror by its digest, which is
+// either in the deployment description or resolved from the tag in the image's own registry, and the pulled image is
+// checked against the digest. An image whose digest cannot be resolved is pulled from its own registry.
+
+// The manifest types that docker pulls, so that the registry returns the digest that docker records for a pull.
+var manifestMediaTypes = []string{
+	"application/vnd.docker.distribution.manifest.list.v2+json",
+	"application/vnd.docker.distribution.manifest.v2+json",
+	"application/vnd.oci.image.index.v1+json",
+	"application/vnd.oci.image.manifest.v1+json",
+}
+
+// The registry API host of docker hub.
+const DOCKER_HUB_REGISTRY = "registry-1.docker.io"
+
+// The repository of a docker hub image, the official images are kept in the library.
+func hubRepository(repository string) string {
+	if repository = normalizeRepository(repository); !strings.Contains(repository, "/") {
+		repository = "library/" + repository
+	}
+	return repository
+}
+
+// The reference of an image on the mirror.
+func mirrorReference(mirror string, ref *imageReference) *imageReference {
+	repository := ref.Repository
+	if registryOf(ref.Repository) == "docker.io" {
+		repository = hubRepository(ref.Repository)
+	}
+	return &imageReference{
+		Repository: mirror + "/" + repository,
+		Tag:        ref.Tag,
+		Digest:     ref.Digest,
+	}
+}
+
+// The host of the registry API and the name of the repository in it.
+func registryLocation(ref *imageReference) (string, string) {
+	if registry := registryOf(ref.Repository); registry == "docker.io" {
+		return DOCKER_HUB_REGISTRY, hubRepository(ref.Repository)
+	} else {
+		return registry, strings.TrimPrefix(ref.Repository, registry+"/")
+	}
+}
+
+// Returns the digest of the manifest that the tag of the image refers to in the image's own registry.
+func resolveDigest(httpClient *http.Client, ref *imageReference, authConfigs *docker.AuthConfigurations) (string, error) {
+	host, repository := registryLocation(ref)
+	manifestURL := fmt.Sprintf("https://%v/v2/%v/manifests/%v", host, repository, ref.Tag)
+
+	resp, err := headManifest(httpClient, manifestURL, "")
+	if err != nil {
+		return "", err
+	} else if resp.StatusCode == http.StatusUnauthorized {
+		_, auth := pullOptions(ref, authConfigs)
+		if authorization, err := registryAuthorization(httpClient, resp.Header.Get("WWW-Authenticate"), repository, auth); err != nil {
+			return "", err
+		} else if resp, err = headManifest(httpClient, manifestURL, authorization); err != nil {
+			return "", err
+		}
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("registry %v returned %v for the manifest of %v", host, resp.Status, ref)
+	}
+	digest := resp.Header.Get("Docker-Content-Digest")
+	if _, err := parseImageReference(ref.Repository + "@" + digest); err != nil {
+		return "", fmt.Errorf("registry %v returned an invalid digest %v for %v", host, digest, ref)
+	}
+	return digest, nil
+}
+
+func headManifest(httpClient *http.Client, manifestURL string, authorization string) (*http.Response, error) {
+	req, err := http.NewRequest(http.MethodHead, manifestURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", strings.Join(manifestMediaTypes, ", "))
+	if authorization != "" {
+		req.Header.Set("Authorization", authorization)
+	}
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	resp.Body.Close()
+	return resp, nil
+}
+
+var challengeParam = regexp.MustCompile(`(\w+)="([^"]*)"`)
+
+// Returns the Authorization header that answers the challenge of a registry for pulling from the repository. A bearer
+// token is requested from the realm of the challenge, with the credentials when there are any.
+func registryAuthorization(httpClient *http.Client, challenge string, repository string, auth docker.AuthConfiguration) (string, error) {
+	basic := "Basic " + base64.StdEncoding.EncodeToString([]byte(auth.Username+":"+auth.Password))
+
+	scheme := strings.ToLower(strings.SplitN(challenge, " ", 2)[0])
+	if scheme == "basic" {
+		if auth.Username == "" {
+			return "", fmt.Errorf("the registry requires credentials for %v", repository)
+		}
+		return basic, nil
+	} else if scheme != "bearer" {
+		return "", fmt.Errorf("the registry challenge %v is not supported", challenge)
+	}
+
+	params := make(map[string]string)
+	for _, m := range challengeParam.FindAllStringSubmatch(challenge, -1) {
+		params[m[1]] = m[2]
+	}
+	if params["realm"] == "" {
+		return "", fmt.Errorf("the registry challenge %v has no realm", challenge)
+	}
+
+	query := url.Values{}
+	query.Set("scope", fmt.Sprintf("repository:%v:pull", repository))
+	if params["service"] != "" {
+		query.Set("service", params["service"])
+	}
+	req, err := http.NewRequest(http.MethodGet, params["realm"]+"?"+query.Encode(), nil)
+	if err != nil {
+		return "", err
+	}
+	if auth.Username != "" {
+		req.Header.Set("Authorization", basic)
+	}
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("the registry token service returned %v for %v", resp.Status, repository)
+	}
+
+	var token struct {
+		Token       string `json:"token"`
+		AccessToken string `json:"access_token"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&token); err != nil {
+		return "", fmt.Errorf("unable to decode the registry token for %v, error: %v", repository, err)
+	} else if token.Token != "" {
+		return "Bearer " + token.Token, nil
+	} else if token.AccessToken != "" {
+		return "Bearer " + token.AccessToken, nil
+	}
+	return "", fmt.Errorf("the registry token service returned no token for %v", repository)
+}
+
+// Pull an image from the mirror by its digest and check the pulled image against the digest. An image that is
+// referenced by a tag is tagged with its name in the deployment, so that the containers are created from it as if it
+// came from its own registry, and the reference of the mirror is removed again, which leaves the image in place.
+// Docker cannot give an image a digest reference in another repository, so the containers of an image that is
+// referenced by digest are created from the reference of the mirror. Returns the image reference that the containers
+// are created from.
+func pullFromMirror(httpClient *http.Client, client *docker.Client, mirror string, ref *imageReference, authConfigs *docker.AuthConfigurations, image string, progress *ProgressTracker, reference string, limiter *rateLimiter) (string, error) {
+	digest := ref.Digest
+	if digest == "" {
+		var err error
+		if digest, err = resolveDigest(httpClient, ref, authConfigs); err != nil {
+			return "", fmt.Errorf("unable to resolve the digest of %v in its registry, error: %v", image, err)
+		}
+		glog.V(3).Infof("Image %v has digest %v in its registry", image, digest)
+	}
+
+	mref := mirrorReference(mirror, &imageReference{Repository: ref.Repository, Digest: digest})
+	opts, auth := pullOptions(mref, authConfigs)
+	if err := pullOnce(client, opts, auth, image, progress, reference, limiter); err != nil {
+		return "", err
+	} else if err := verifyImageDigest(client, mref); err != nil {
+		return "", err
+	}
+
+	if ref.Digest != "" {
+		return mref.String(), nil
+	}
+
+	if err := client.TagImage(mref.String(), docker.TagImageOptions{Repo: ref.Repository, Tag: ref.Tag, Force: true}); err != nil {
+		return "", err
+	}
+	if err := client.RemoveImage(mref.String()); err != nil {
+		glog.V(3).Infof("Unable to remove the mirror reference %v of image %v, error: %v", mref, image, err)
+	}
+	return image, nil
+}
@@ -0,0 +1,98 @@
+// +build unit
+
+package torrent
+
+import (
+	"fmt"
+	docker "github.com/fsouza/go-dockerclient"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func Test_mirrorReference(t *testing.T) {
+	tests := []struct {
+		ref      imageReference
+		expected string
+	}{
+		{imageReference{Repository: "registry.example.com:5000/org/gps", Tag: "1.0"}, "mirror:5000/registry.example.com:5000/org/gps:1.0"},
+		{imageReference{Repository: "openhorizon/gps", Tag: "1.0"}, "mirror:5000/openhorizon/gps:1.0"},
+		{imageReference{Repository: "docker.io/openhorizon/gps", Tag: "1.0"}, "mirror:5000/openhorizon/gps:1.0"},
+		{imageReference{Repository: "ubuntu", Tag: "latest"}, "mirror:5000/library/ubuntu:latest"},
+	}
+
+	for _, test := range tests {
+		if mref := mirrorReference("mirror:5000", &test.ref); mref.String() != test.expected {
+			t.Errorf("expected %v on the mirror to be %v, got %v", test.ref, test.expected, mref)
+		}
+	}
+}
+
+func Test_registryLocation(t *testing.T) {
+	tests := []struct {
+		repository string
+		host       string
+		path       string
+	}{
+		{"registry.example.com:5000/org/gps", "registry.example.com:5000", "org/gps"},
+		{"openhorizon/gps", DOCKER_HUB_REGISTRY, "openhorizon/gps"},
+		{"ubuntu", DOCKER_HUB_REGISTRY, "library/ubuntu"},
+	}
+
+	for _, test := range tests {
+		if host, path := registryLocation(&imageReference{Repository: test.repository, Tag: "1.0"}); host != test.host || path != test.path {
+			t.Errorf("expected %v to be %v in %v, got %v in %v", test.repository, test.path, test.host, path, host)
+		}
+	}
+}
+
+// A stand-in registry that hands out bearer tokens for the credentials user:secret, like docker hub does.
+func Test_resolveDigest(t *testing.T) {
+	digest := "sha256:" + strings.Repeat("ab", 32)
+
+	var registry *httptest.Server
+	registry = httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/token" {
+			if user, pw, ok := r.BasicAuth(); !ok || user != "user" || pw != "secret" {
+				w.WriteHeader(http.StatusUnauthorized)
+			} else if r.URL.Query().Get("service") != "test-registry" || !strings.HasPrefix(r.URL.Query().Get("scope"), "repository:org/") {
+				w.WriteHeader(http.StatusBadRequest)
+			} else {
+				w.Write([]byte(`{"token": "abc"}`))
+			}
+			return
+		}
+
+		if r.Header.Get("Authorization") != "Bearer abc" {
+			w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Bearer realm="%v/token",service="test-registry",scope="repository:org/gps:pull,push"`, registry.URL))
+			w.WriteHeader(http.StatusUnauthorized)
+		} else if r.Method != http.MethodHead || !strings.Contains(r.Header.Get("Accept"), "application/vnd.docker.distribution.manifest.list.v2+json") {
+			w.WriteHeader(http.StatusBadRequest)
+		} else if r.URL.Path == "/v2/org/gps/manifests/1.0" {
+			w.Header().Set("Docker-Content-Digest", digest)
+		} else if r.URL.Path == "/v2/org/bad/manifests/1.0" {
+			w.Header().Set("Docker-Content-Digest", "sha256:abc")
+		} else {
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer registry.Close()
+
+	host := strings.TrimPrefix(registry.URL, "https://")
+	auths := &docker.AuthConfigurations{Configs: map[string]docker.AuthConfiguration{host: {Username: "user", Password: "secret"}}}
+	noAuths := &docker.AuthConfigurations{Configs: map[string]docker.AuthConfiguration{}}
+
+	if d, err := resolveDigest(registry.Client(), &imageReference{Repository: host + "/org/gps", Tag: "1.0"}, auths); err != nil || d != digest {
+		t.Errorf("expected digest %v, got %v %v", digest, d, err)
+	}
+	if d, err := resolveDigest(registry.Client(), &imageReference{Repository: host + "/org/gps", Tag: "1.0"}, noAuths); err == nil {
+		t.Errorf("expected the token service to refuse a pull without credentials, got %v", d)
+	}
+	if d, err := resolveDigest(registry.Client(), &imageReference{Repository: host + "/org/gps", Tag: "2.0"}, auths); err == nil {
+		t.Errorf("expected an error for a tag the registry does not have, got %v", d)
+	}
+	if d, err := resolveDigest(registry.Client(), &imageReference{Repository: host + "/org/bad", Tag: "1.0"}, auths); err == nil {
+		t.Errorf("expected an invalid digest to be refused, got %v", d)
+	}
+}
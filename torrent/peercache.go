@@ -0,0 +1,277 @@
+package torrent
+
+import (
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/golang/glog"
+)
+
+// In peer cache mode, a node keeps the package files that it fetched and loaded, and serves them to the other nodes
+// of the site. A node with peers asks them for each file of a package before it asks the origin, by the URL of the
+// file at the origin. The files from peers go through the same signature check as the files from the origin, and
+// a package that cannot be fetched or verified through the peers is fetched from the origin. A node keeps only the
+// files of a package that was verified, and never keeps the files that were fetched with credentials.
+
+// The subdirectory of the torrent directory that keeps the package files that are served to peers.
+const PEER_CACHE_DIR = ".peercache"
+
+// The path that a node serves its package files on, the origin URL of a file is in the url query parameter.
+const PEER_CACHE_PATH = "/peercache"
+
+// The number of seconds to wait for a peer to connect and to start its response.
+const PEER_CACHE_TIMEOUT_S = 5
+
+// Returns the peers in the comma separated list of host:port.
+func peerCacheNodes(nodes string) []string {
+	peers := make([]string, 0)
+	for _, p := range strings.Split(nodes, ",") {
+		if p = strings.TrimSpace(p); p != "" {
+			peers = append(peers, p)
+		}
+	}
+	return peers
+}
+
+// The file that keeps the package file from the URL.
+func peerCacheFile(dir string, u string) string {
+	file, _ := partialFile(dir, u)
+	return file
+}
+
+// Asks the peers for a file before the origin.
+type peerTransport struct {
+	next  http.RoundTripper
+	peers []string
+	peer  http.RoundTripper
+}
+
+func newPeerTransport(next http.RoundTripper, peers []string) *peerTransport {
+	return &peerTransport{
+		next:  next,
+		peers: peers,
+		peer: &http.Transport{
+			DialContext:           (&net.Dialer{Timeout: PEER_CACHE_TIMEOUT_S * time.Second}).DialContext,
+			ResponseHeaderTimeout: PEER_CACHE_TIMEOUT_S * time.Second,
+		},
+	}
+}
+
+func (t *peerTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Method != http.MethodGet || req.Header.Get("Authorization") != "" {
+		return t.next.RoundTrip(req)
+	}
+
+	for _, peer := range t.peers {
+		peerURL := url.URL{Scheme: "http", Host: peer, Path: PEER_CACHE_PATH, RawQuery: url.Values{"url": {req.URL.String()}}.Encode()}
+		peerReq, err := http.NewRequest(http.MethodGet, peerURL.String(), nil)
+		if err != nil {
+			continue
+		}
+		for _, h := range []string{"Range", "If-Range"} {
+			if v := req.Header.Get(h); v != "" {
+				peerReq.Header.Set(h, v)
+			}
+		}
+
+		resp, err := t.peer.RoundTrip(peerReq)
+		if err != nil {
+			glog.V(5).Infof("Unable to get %v from peer %v, error: %v", req.URL, peer, err)
+			continue
+		} else if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusPartialContent {
+			resp.Body.Close()
+			glog.V(5).Infof("Peer %v does not have %v, status: %v", peer, req.URL, resp.Status)
+			continue
+		}
+		glog.V(3).Infof("Getting %v from peer %v", req.URL, peer)
+		resp.Request = req
+		return resp, nil
+	}
+
+	return t.next.RoundTrip(req)
+}
+
+// Wrap the clients of an HTTP client factory so that they ask the peers for each file before the origin.
+func peerClientFactory(newClient func(*uint) *http.Client, peers []string) func(*uint) *http.Client {
+	if len(peers) == 0 {
+		return newClient
+	}
+	return func(overrideTimeoutS *uint) *http.Client {
+		client := *newClient(overrideTimeoutS)
+		next := client.Transport
+		if next == nil {
+			next = http.DefaultTransport
+		}
+		client.Transport = newPeerTransport(next, peers)
+		return &client
+	}
+}
+
+// Keeps a copy of the files of one package fetch in a staging directory, and moves them into the peer cache when the
+// package has been verified and loaded.
+type peerCacheWriter struct {
+	dir     string
+	staging string
+}
+
+func newPeerCacheWriter(dir string) (*peerCacheWriter, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+	staging, err := ioutil.TempDir(dir, "staging-")
+	if err != nil {
+		return nil, err
+	}
+	return &peerCacheWriter{dir: dir, staging: staging}, nil
+}
+
+// Move the files of the package into the peer cache. A nil writer does nothing.
+func (c *peerCacheWriter) commit() {
+	if c == nil {
+		return
+	}
+	if files, err := ioutil.ReadDir(c.staging); err != nil {
+		glog.Errorf("Unable to read %v, error: %v", c.staging, err)
+	} else {
+		for _, f := range files {
+			if strings.HasSuffix(f.Name(), ".tmp") {
+				continue
+			} else if err := os.Rename(path.Join(c.staging, f.Name()), path.Join(c.dir, f.Name())); err != nil {
+				glog.Errorf("Unable to add %v to the peer cache, error: %v", f.Name(), err)
+			}
+		}
+	}
+	c.discard()
+}
+
+func (c *peerCacheWriter) discard() {
+	if c == nil {
+		return
+	}
+	if err := os.RemoveAll(c.staging); err != nil {
+		glog.Errorf("Unable to remove %v, error: %v", c.staging, err)
+	}
+}
+
+// Wrap the clients of an HTTP client factory so that the files they download are kept in the staging directory.
+func (c *peerCacheWriter) clientFactory(newClient func(*uint) *http.Client) func(*uint) *http.Client {
+	if c == nil {
+		return newClient
+	}
+	return func(overrideTimeoutS *uint) *http.Client {
+		client := *newClient(overrideTimeoutS)
+		next := client.Transport
+		if next == nil {
+			next = http.DefaultTransport
+		}
+		client.Transport = &peerCacheTransport{next: next, staging: c.staging}
+		return &client
+	}
+}
+
+type peerCacheTransport struct {
+	next    http.RoundTripper
+	staging string
+}
+
+func (t *peerCacheTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := t.next.RoundTrip(req)
+	if err != nil || req.Method != http.MethodGet || req.Header.Get("Authorization") != "" || resp.StatusCode != http.StatusOK || resp.Uncompressed {
+		return resp, err
+	}
+
+	file := peerCacheFile(t.staging, req.URL.String())
+	out, err := os.OpenFile(file+".tmp", os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		glog.Warningf("Unable to keep %v for peers, error: %v", req.URL, err)
+		return resp, nil
+	}
+	resp.Body = &peerCacheBody{Reader: io.TeeReader(resp.Body, out), body: resp.Body, out: out, file: file, length: resp.ContentLength}
+	return resp, nil
+}
+
+// The body of a file that is kept for peers. The file is kept only when it was read completely.
+type peerCacheBody struct {
+	io.Reader
+	body   io.Closer
+	out    *os.File
+	file   string
+	length int64
+	read   int64
+	eof    bool
+}
+
+func (b *peerCacheBody) Read(p []byte) (int, error) {
+	n, err := b.Reader.Read(p)
+	b.read += int64(n)
+	if err == io.EOF {
+		b.eof = true
+	}
+	return n, err
+}
+
+func (b *peerCacheBody) Close() error {
+	err := b.body.Close()
+	b.out.Close()
+	if b.eof && (b.length < 0 || b.read == b.length) {
+		if rerr := os.Rename(b.file+".tmp", b.file); rerr != nil {
+			glog.Warningf("Unable to keep %v for peers, error: %v", b.file, rerr)
+		}
+	} else {
+		os.Remove(b.file + ".tmp")
+	}
+	return err
+}
+
+// Serves the files of the peer cache to the other nodes of the site.
+func peerCacheHandler(dir string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+
+		u := r.URL.Query().Get("url")
+		if u == "" {
+			http.Error(w, "the url query parameter is required", http.StatusBadRequest)
+			return
+		}
+
+		f, err := os.Open(peerCacheFile(dir, u))
+		if err != nil {
+			http.NotFound(w, r)
+			return
+		}
+		defer f.Close()
+
+		fi, err := f.Stat()
+		if err != nil {
+			http.NotFound(w, r)
+			return
+		}
+		glog.V(5).Infof("Serving %v to peer %v", u, r.RemoteAddr)
+		http.ServeContent(w, r, "", fi.ModTime(), f)
+	})
+}
+
+// Serve the peer cache on the address until the server is closed.
+func servePeerCache(address string, dir string) *http.Server {
+	mux := http.NewServeMux()
+	mux.Handle(PEER_CACHE_PATH, peerCacheHandler(dir))
+	server := &http.Server{Addr: address, Handler: mux}
+
+	go func() {
+		glog.Infof("Serving the peer image cache on %v", address)
+		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			glog.Errorf("Unable to serve the peer image cache on %v, error: %v", address, err)
+		}
+	}()
+	return server
+}
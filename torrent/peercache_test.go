@@ -0,0 +1,81 @@
+// +build unit
+
+package torrent
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+)
+
+func Test_peerCacheNodes(t *testing.T) {
+	if peers := peerCacheNodes(" node1:8510, ,node2:8510"); len(peers) != 2 || peers[0] != "node1:8510" || peers[1] != "node2:8510" {
+		t.Errorf("unexpected peers %v", peers)
+	} else if peers := peerCacheNodes(""); len(peers) != 0 {
+		t.Errorf("expected no peers, got %v", peers)
+	}
+}
+
+func Test_peerCache(t *testing.T) {
+	originHits := 0
+	origin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		originHits++
+		w.Write([]byte("part " + r.URL.Path))
+	}))
+	defer origin.Close()
+
+	dir, err := ioutil.TempDir("", "peercache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	peer := httptest.NewServer(peerCacheHandler(dir))
+	defer peer.Close()
+	peers := []string{strings.TrimPrefix(peer.URL, "http://")}
+
+	get := func(newClient func(*uint) *http.Client, u string) string {
+		resp, err := newClient(nil).Get(u)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		body, _ := ioutil.ReadAll(resp.Body)
+		return string(body)
+	}
+	base := func(*uint) *http.Client { return &http.Client{} }
+
+	// The peer does not have the part yet, it comes from the origin and is kept once the package is committed.
+	writer, err := newPeerCacheWriter(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if body := get(writer.clientFactory(peerClientFactory(base, peers)), origin.URL+"/part1"); body != "part /part1" || originHits != 1 {
+		t.Errorf("expected the part from the origin, got %q after %v origin requests", body, originHits)
+	}
+	if _, err := os.Stat(peerCacheFile(dir, origin.URL+"/part1")); !os.IsNotExist(err) {
+		t.Errorf("expected the part to be kept out of the cache until the package is verified")
+	}
+	writer.commit()
+
+	// Now the peer has it.
+	if body := get(peerClientFactory(base, peers), origin.URL+"/part1"); body != "part /part1" || originHits != 1 {
+		t.Errorf("expected the part from the peer, got %q after %v origin requests", body, originHits)
+	}
+
+	// The parts of a package that was not verified are not kept.
+	writer, _ = newPeerCacheWriter(dir)
+	get(writer.clientFactory(base), origin.URL+"/part2")
+	writer.discard()
+	if _, err := os.Stat(peerCacheFile(dir, origin.URL+"/part2")); !os.IsNotExist(err) {
+		t.Errorf("expected the part of a discarded package not to be kept")
+	}
+
+	// A peer that cannot be reached is skipped.
+	if body := get(peerClientFactory(base, []string{"127.0.0.1:1"}), origin.URL+"/part3"); body != "part /part3" {
+		t.Errorf("expected the part from the origin, got %q", body)
+	}
+}
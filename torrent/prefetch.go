@@ -0,0 +1,210 @@
+package torrent
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"path"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/open-horizon/anax/containermessage"
+	"github.com/open-horizon/anax/cutil"
+	"github.com/open-horizon/anax/exchange"
+	"github.com/open-horizon/anax/persistence"
+	"github.com/open-horizon/anax/policy"
+)
+
+// When image pre-fetch is turned on in the config, the images of the node's pattern workloads and microservices are
+// fetched in the background as soon as the node is configured, so that they are already on the node when agreements
+// are made. The pre-fetch runs outside of the command thread so that it never delays the fetch for an agreement, and
+// it is limited to ImagePrefetchMaxKBps. The deployments are verified against their signatures before their images
+// are fetched, as they are when an agreement or microservice instance fetches them. Pre-fetched images are recorded
+// without a reference until an agreement or microservice instance uses them, so the image garbage collector removes
+// them first when the image filesystem fills up.
+
+// The subdirectory of the torrent directory that pre-fetched packages are written to, so that they never collide
+// with the package of an agreement that is fetched at the same time.
+const PREFETCH_DIR = "prefetch"
+
+// A deployment whose images are pre-fetched.
+type prefetchDeployment struct {
+	name                string
+	org                 string
+	deployment          string
+	deploymentSignature string
+	torrent             string
+}
+
+// Start pre-fetching unless a pre-fetch is already running.
+func (w *TorrentWorker) startPrefetch() {
+	w.prefetchLock.Lock()
+	defer w.prefetchLock.Unlock()
+
+	if w.prefetching {
+		glog.V(3).Infof("Image pre-fetch is already running")
+		return
+	}
+	w.prefetching = true
+
+	go func() {
+		w.prefetch()
+
+		w.prefetchLock.Lock()
+		defer w.prefetchLock.Unlock()
+		w.prefetching = false
+	}()
+}
+
+func (w *TorrentWorker) isPrefetching() bool {
+	w.prefetchLock.Lock()
+	defer w.prefetchLock.Unlock()
+	return w.prefetching
+}
+
+func (w *TorrentWorker) prefetch() {
+	deployments, err := w.prefetchDeployments()
+	if err != nil {
+		glog.Errorf("Unable to pre-fetch images: %v", err)
+		return
+	}
+	glog.Infof("Pre-fetching the images of %v deployments", len(deployments))
+
+	limiter := newRateLimiter(int64(w.Config.Edge.ImagePrefetchMaxKBps) * 1024)
+	dir := ""
+	if w.Config.Edge.TorrentDir != "" {
+		dir = path.Join(w.Config.Edge.TorrentDir, PREFETCH_DIR)
+	}
+
+	for _, dep := range deployments {
+		if w.IsWorkerShuttingDown() {
+			glog.Infof("Stopping image pre-fetch, the node is shutting down")
+			return
+		}
+
+		pemFiles, err := w.Config.Collaborators.KeyFileNamesFetcher.GetKeyFileNames(w.Config.Edge.PublicKeyPath, w.Config.Edge.UserPublicKeyPath)
+		if err != nil {
+			glog.Errorf("Unable to pre-fetch images, error reading pemFiles: %v", err)
+			return
+		}
+
+		// The images named in a deployment are only trusted when the deployment is signed.
+		wl := policy.Workload{Deployment: dep.deployment, DeploymentSignature: dep.deploymentSignature}
+		if err := wl.HasValidSignature(pemFiles); err != nil {
+			glog.Errorf("Unable to pre-fetch the images of %v: %v", dep.name, err)
+			continue
+		}
+
+		var deploymentDesc containermessage.DeploymentDescription
+		if err := json.Unmarshal([]byte(dep.deployment), &deploymentDesc); err != nil {
+			glog.Errorf("Unable to pre-fetch the images of %v, error unmarshalling deployment %v: %v", dep.name, dep.deployment, err)
+			continue
+		}
+
+		var torrent policy.Torrent
+		if dep.torrent != "" {
+			if err := json.Unmarshal([]byte(dep.torrent), &torrent); err != nil {
+				glog.Errorf("Unable to pre-fetch the images of %v, error unmarshalling torrent %v: %v", dep.name, dep.torrent, err)
+				continue
+			}
+		}
+		torrentUrl, err := url.Parse(torrent.Url)
+		if err != nil {
+			glog.Errorf("Unable to pre-fetch the images of %v, ill-formed torrent URL %v: %v", dep.name, torrent.Url, err)
+			continue
+		}
+
+		// The pre-fetch runs on its own goroutine, so it waits out the backoff of a failed fetch itself.
+		attempts := newFetchAttempts()
+		for {
+			var after time.Duration
+			err = processFetch(w.Config, w.client, w.db, pemFiles, &deploymentDesc, *torrentUrl, torrent.Signature, dep.org, dir, w.progress, "", limiter, w.retry)
+			if after, err = w.retry.retryAfter(attempts, err); after == 0 {
+				break
+			} else if w.IsWorkerShuttingDown() {
+				err = fmt.Errorf("the node is shutting down")
+				break
+			}
+			time.Sleep(after)
+		}
+
+		if err != nil {
+			glog.Warningf("Unable to pre-fetch the images of %v: %v", dep.name, err)
+		} else {
+			glog.V(3).Infof("Pre-fetched the images of %v", dep.name)
+			recordDeploymentImages(w.db, &deploymentDesc, "")
+		}
+	}
+	removeImageParts(dir)
+}
+
+// Returns the deployments of the workloads in the node's pattern that run on this architecture, at their highest
+// priority version, and the deployments of the node's microservices.
+func (w *TorrentWorker) prefetchDeployments() ([]prefetchDeployment, error) {
+	deployments := make([]prefetchDeployment, 0)
+
+	dev, err := persistence.FindExchangeDevice(w.db)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read the node, error %v", err)
+	} else if dev == nil || dev.Pattern == "" {
+		glog.V(3).Infof("The node does not use a pattern, there are no images to pre-fetch")
+		return deployments, nil
+	}
+	deviceId := fmt.Sprintf("%v/%v", dev.Org, dev.Id)
+
+	patterns, err := exchange.GetPatterns(w.Config.Collaborators.HTTPClientFactory, dev.Org, dev.Pattern, w.Config.Edge.ExchangeURL, deviceId, dev.Token)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read pattern %v from the exchange, error %v", dev.Pattern, err)
+	}
+
+	for _, pattern := range patterns {
+		for _, wl := range pattern.Workloads {
+			if wl.WorkloadArch != cutil.ArchString() || len(wl.WorkloadVersions) == 0 {
+				continue
+			}
+
+			choice := wl.WorkloadVersions[0]
+			for _, c := range wl.WorkloadVersions {
+				if c.Priority.PriorityValue < choice.Priority.PriorityValue {
+					choice = c
+				}
+			}
+
+			workload, _, err := exchange.GetWorkload(w.Config.Collaborators.HTTPClientFactory, wl.WorkloadURL, wl.WorkloadOrg, choice.Version, wl.WorkloadArch, w.Config.Edge.ExchangeURL, deviceId, dev.Token)
+			if err != nil {
+				glog.Warningf("Unable to read workload %v version %v from the exchange, its images are not pre-fetched: %v", wl.WorkloadURL, choice.Version, err)
+				continue
+			} else if workload == nil || len(workload.Workloads) == 0 {
+				continue
+			}
+			deployments = append(deployments, prefetchDeployment{
+				name:                fmt.Sprintf("workload %v version %v", wl.WorkloadURL, workload.Version),
+				org:                 wl.WorkloadOrg,
+				deployment:          workload.Workloads[0].Deployment,
+				deploymentSignature: workload.Workloads[0].DeploymentSignature,
+				torrent:             workload.Workloads[0].Torrent,
+			})
+		}
+	}
+
+	msdefs, err := persistence.FindMicroserviceDefs(w.db, []persistence.MSFilter{persistence.UnarchivedMSFilter()})
+	if err != nil {
+		return nil, fmt.Errorf("unable to read microservice definitions, error %v", err)
+	}
+	for _, msdef := range msdefs {
+		for _, wl := range msdef.Workloads {
+			if wl.Deployment == "" {
+				continue
+			}
+			deployments = append(deployments, prefetchDeployment{
+				name:                fmt.Sprintf("microservice %v version %v", msdef.SpecRef, msdef.Version),
+				org:                 msdef.Org,
+				deployment:          wl.Deployment,
+				deploymentSignature: wl.DeploymentSignature,
+				torrent:             wl.Torrent,
+			})
+		}
+	}
+
+	return deployments, nil
+}
@@ -0,0 +1,348 @@
+package torrent
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+// The states of an image fetch.
+const (
+	FETCH_DOWNLOADING = "downloading"
+	FETCH_DONE        = "done"
+	FETCH_FAILED      = "failed"
+)
+
+// The number of seconds that a finished fetch is still reported.
+const PROGRESS_RETENTION_S = 600
+
+// ImageProgress is an external type exposing the progress of fetching one image. When the images of a deployment
+// are fetched as a package from the torrent URL, the progress is that of the whole package and Image is its URL.
+type ImageProgress struct {
+	Image      string `json:"image"`
+	Reference  string `json:"reference,omitempty"` // the agreement id or microservice instance key that the image is fetched for, empty for a pre-fetch
+	Prefetch   bool   `json:"prefetch"`
+	State      string `json:"state"`
+	BytesDone  int64  `json:"bytes_done"`
+	BytesTotal int64  `json:"bytes_total"` // zero until the size of the image is known
+	LayersDone int    `json:"layers_done"`
+	Layers     int    `json:"layers"`
+	StartTime  uint64 `json:"start_time"`
+	EndTime    uint64 `json:"end_time,omitempty"`
+	ETASeconds int64  `json:"eta_seconds"` // -1 when the remaining time cannot be estimated yet
+	Error      string `json:"error,omitempty"`
+}
+
+func (p ImageProgress) String() string {
+	return fmt.Sprintf("Image: %v, Reference: %v, Prefetch: %v, State: %v, BytesDone: %v, BytesTotal: %v, LayersDone: %v, Layers: %v, ETASeconds: %v, Error: %v", p.Image, p.Reference, p.Prefetch, p.State, p.BytesDone, p.BytesTotal, p.LayersDone, p.Layers, p.ETASeconds, p.Error)
+}
+
+// The time remaining at the average rate of the fetch so far.
+func (p *ImageProgress) eta(now time.Time) int64 {
+	elapsed := now.Unix() - int64(p.StartTime)
+	if p.State != FETCH_DOWNLOADING {
+		return 0
+	} else if p.BytesDone == 0 || p.BytesTotal < p.BytesDone || elapsed <= 0 {
+		return -1
+	}
+	return (p.BytesTotal - p.BytesDone) * elapsed / p.BytesDone
+}
+
+// The torrent worker keeps the progress of the fetches that are in progress or recently finished. The API reads
+// it while the worker updates it, so all access is under the lock.
+type ProgressTracker struct {
+	lock    sync.Mutex
+	fetches map[string]*ImageProgress
+}
+
+func NewProgressTracker() *ProgressTracker {
+	return &ProgressTracker{
+		fetches: make(map[string]*ImageProgress),
+	}
+}
+
+func progressKey(image string, reference string) string {
+	return image + "\x00" + reference
+}
+
+// The progress functions do nothing on a nil tracker.
+func (t *ProgressTracker) begin(image string, reference string) {
+	if t == nil {
+		return
+	}
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	t.fetches[progressKey(image, reference)] = &ImageProgress{
+		Image:     image,
+		Reference: reference,
+		Prefetch:  reference == "",
+		State:     FETCH_DOWNLOADING,
+		StartTime: uint64(time.Now().Unix()),
+	}
+}
+
+func (t *ProgressTracker) update(image string, reference string, fn func(p *ImageProgress)) {
+	if t == nil {
+		return
+	}
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	if p, ok := t.fetches[progressKey(image, reference)]; ok {
+		fn(p)
+	}
+}
+
+func (t *ProgressTracker) end(image string, reference string, err error) {
+	t.update(image, reference, func(p *ImageProgress) {
+		p.EndTime = uint64(time.Now().Unix())
+		if err != nil {
+			p.State = FETCH_FAILED
+			p.Error = err.Error()
+		} else {
+			p.State = FETCH_DONE
+			p.BytesDone = p.BytesTotal
+			p.LayersDone = p.Layers
+		}
+	})
+}
+
+// Returns the fetches in the order they were started. The fetches that finished more than PROGRESS_RETENTION_S
+// seconds ago are dropped.
+func (t *ProgressTracker) ImageProgress() []ImageProgress {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	now := time.Now()
+	out := make([]ImageProgress, 0, len(t.fetches))
+	for key, p := range t.fetches {
+		if p.EndTime != 0 && now.Unix()-int64(p.EndTime) > PROGRESS_RETENTION_S {
+			delete(t.fetches, key)
+			continue
+		}
+		fetch := *p
+		fetch.ETASeconds = p.eta(now)
+		out = append(out, fetch)
+	}
+	sort.Stable(imageProgressByStartTime(out))
+	return out
+}
+
+type imageProgressByStartTime []ImageProgress
+
+func (s imageProgressByStartTime) Len() int           { return len(s) }
+func (s imageProgressByStartTime) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+func (s imageProgressByStartTime) Less(i, j int) bool { return s[i].StartTime < s[j].StartTime }
+
+// A message of the JSON stream that docker writes while it pulls an image.
+type pullMessage struct {
+	Status         string `json:"status"`
+	ID             string `json:"id"`
+	ProgressDetail struct {
+		Current int64 `json:"current"`
+		Total   int64 `json:"total"`
+	} `json:"progressDetail"`
+	Error string `json:"error"`
+}
+
+type layerProgress struct {
+	current int64
+	total   int64
+	done    bool
+}
+
+// Decodes the JSON stream of a docker pull into the progress of the image. Docker reports an error that happens
+// after the pull has started in the stream, not as the result of the pull, so it is kept to be checked afterwards.
+type pullProgressWriter struct {
+	tracker   *ProgressTracker
+	image     string
+	reference string
+	layers    map[string]*layerProgress
+	partial   []byte
+	err       error
+}
+
+func newPullProgressWriter(tracker *ProgressTracker, image string, reference string) *pullProgressWriter {
+	return &pullProgressWriter{
+		tracker:   tracker,
+		image:     image,
+		reference: reference,
+		layers:    make(map[string]*layerProgress),
+	}
+}
+
+func (w *pullProgressWriter) Write(b []byte) (int, error) {
+	w.partial = append(w.partial, b...)
+	for {
+		ix := bytes.IndexByte(w.partial, '\n')
+		if ix == -1 {
+			break
+		}
+		line := bytes.TrimSpace(w.partial[:ix])
+		w.partial = w.partial[ix+1:]
+
+		var msg pullMessage
+		if len(line) == 0 {
+			continue
+		} else if err := json.Unmarshal(line, &msg); err != nil {
+			continue
+		}
+		w.handle(&msg)
+	}
+	return len(b), nil
+}
+
+func (w *pullProgressWriter) handle(msg *pullMessage) {
+	if msg.Error != "" {
+		w.err = pullStreamError{Msg: msg.Error}
+		return
+	} else if msg.ID == "" {
+		return
+	}
+
+	layer, ok := w.layers[msg.ID]
+	switch msg.Status {
+	case "Pulling fs layer", "Waiting", "Downloading", "Verifying Checksum", "Download complete", "Extracting", "Pull complete", "Already exists":
+		if !ok {
+			layer = new(layerProgress)
+			w.layers[msg.ID] = layer
+		}
+	default:
+		// Not a layer, e.g. the tag or the digest of the image.
+		return
+	}
+
+	switch msg.Status {
+	case "Downloading":
+		layer.current = msg.ProgressDetail.Current
+		if msg.ProgressDetail.Total > 0 {
+			layer.total = msg.ProgressDetail.Total
+		}
+	case "Download complete", "Extracting":
+		layer.current = layer.total
+	case "Pull complete", "Already exists":
+		layer.current = layer.total
+		layer.done = true
+	}
+
+	var done, total int64
+	layersDone := 0
+	for _, l := range w.layers {
+		done += l.current
+		total += l.total
+		if l.done {
+			layersDone++
+		}
+	}
+
+	w.tracker.update(w.image, w.reference, func(p *ImageProgress) {
+		p.BytesDone = done
+		p.BytesTotal = total
+		p.Layers = len(w.layers)
+		p.LayersDone = layersDone
+	})
+}
+
+// The number of bytes of the layers that docker downloaded, the layers that already existed do not count.
+func (w *pullProgressWriter) downloaded() int64 {
+	var n int64
+	for _, l := range w.layers {
+		n += l.current
+	}
+	return n
+}
+
+// Limits the rate of a transfer to a number of bytes per second, by sleeping whenever the transfer is ahead of
+// the rate. A nil limiter does not limit.
+type rateLimiter struct {
+	lock           sync.Mutex
+	bytesPerSecond int64
+	start          time.Time
+	bytes          int64
+}
+
+func newRateLimiter(bytesPerSecond int64) *rateLimiter {
+	if bytesPerSecond <= 0 {
+		return nil
+	}
+	return &rateLimiter{bytesPerSecond: bytesPerSecond, start: time.Now()}
+}
+
+func (r *rateLimiter) wait(n int64) {
+	if r == nil {
+		return
+	}
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.bytes += n
+	if ahead := r.ahead(); ahead > 0 {
+		time.Sleep(ahead)
+	}
+}
+
+// How far the transfer is ahead of the rate.
+func (r *rateLimiter) ahead() time.Duration {
+	return time.Duration(r.bytes*int64(time.Second)/r.bytesPerSecond) - time.Since(r.start)
+}
+
+// Counts, and optionally limits, the bytes read from the responses of an HTTP client, for the package fetches.
+type progressTransport struct {
+	next      http.RoundTripper
+	tracker   *ProgressTracker
+	image     string
+	reference string
+	limiter   *rateLimiter
+}
+
+func (t *progressTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := t.next.RoundTrip(req)
+	if err == nil && resp.ContentLength > 0 {
+		t.tracker.update(t.image, t.reference, func(p *ImageProgress) {
+			p.BytesTotal += resp.ContentLength
+			p.Layers++
+		})
+		resp.Body = &progressReader{ReadCloser: resp.Body, transport: t}
+	}
+	return resp, err
+}
+
+// Each part of a package is a layer of its progress.
+type progressReader struct {
+	io.ReadCloser
+	transport *progressTransport
+	eof       bool
+}
+
+func (r *progressReader) Read(b []byte) (int, error) {
+	n, err := r.ReadCloser.Read(b)
+	t := r.transport
+	t.limiter.wait(int64(n))
+	t.tracker.update(t.image, t.reference, func(p *ImageProgress) {
+		p.BytesDone += int64(n)
+		if err == io.EOF && !r.eof {
+			p.LayersDone++
+		}
+	})
+	if err == io.EOF {
+		r.eof = true
+	}
+	return n, err
+}
+
+// Wrap the clients of an HTTP client factory so that a package fetch reports its progress, and is limited to the
+// rate of the limiter when there is one.
+func progressClientFactory(newClient func(*uint) *http.Client, tracker *ProgressTracker, image string, reference string, limiter *rateLimiter) func(*uint) *http.Client {
+	return func(overrideTimeoutS *uint) *http.Client {
+		client := *newClient(overrideTimeoutS)
+		next := client.Transport
+		if next == nil {
+			next = http.DefaultTransport
+		}
+		client.Transport = &progressTransport{next: next, tracker: tracker, image: image, reference: reference, limiter: limiter}
+		return &client
+	}
+}
@@ -0,0 +1,108 @@
+// +build unit
+
+package torrent
+
+import (
+	"testing"
+	"time"
+)
+
+func Test_pullProgressWriter(t *testing.T) {
+	tracker := NewProgressTracker()
+	tracker.begin("gps:1.0", "ag1")
+	pw := newPullProgressWriter(tracker, "gps:1.0", "ag1")
+
+	// Docker splits the stream anywhere, not only between messages.
+	pw.Write([]byte(`{"status":"Pulling from gps","id":"1.0"}
+{"status":"Pulling fs layer","progressDetail":{},"id":"a"}
+{"status":"Already exists","progressDetail":{},"id":"b"}
+{"status":"Downloading","progressDetail":{"current":100,"total":400},"id":"a"}
+{"status":"Downlo`))
+	pw.Write([]byte(`ading","progressDetail":{"current":300,"total":400},"id":"a"}
+`))
+
+	p := tracker.ImageProgress()
+	if len(p) != 1 {
+		t.Fatalf("expected 1 fetch, got %v", p)
+	} else if p[0].BytesDone != 300 || p[0].BytesTotal != 400 || p[0].Layers != 2 || p[0].LayersDone != 1 || p[0].State != FETCH_DOWNLOADING {
+		t.Errorf("unexpected progress %v", p[0])
+	} else if p[0].Prefetch {
+		t.Errorf("a fetch for an agreement is not a pre-fetch")
+	}
+
+	pw.Write([]byte(`{"status":"Pull complete","progressDetail":{},"id":"a"}
+{"status":"Digest: sha256:8c03bb07a531c53ad7d0f6e7041b64d81f99c6e493cb39abba56d956b40eacbc"}
+`))
+	if pw.err != nil {
+		t.Errorf("unexpected error %v", pw.err)
+	} else if pw.downloaded() != 400 {
+		t.Errorf("expected 400 bytes downloaded, got %v", pw.downloaded())
+	}
+
+	tracker.end("gps:1.0", "ag1", nil)
+	if p := tracker.ImageProgress(); p[0].State != FETCH_DONE || p[0].LayersDone != 2 || p[0].ETASeconds != 0 || p[0].EndTime == 0 {
+		t.Errorf("unexpected progress %v", p[0])
+	}
+}
+
+func Test_pullProgressWriter_error(t *testing.T) {
+	pw := newPullProgressWriter(nil, "gps:1.0", "")
+	pw.Write([]byte(`{"status":"Pulling fs layer","progressDetail":{},"id":"a"}
+{"errorDetail":{"message":"unauthorized"},"error":"unauthorized"}
+`))
+	if pw.err == nil || pw.err.Error() != "unauthorized" {
+		t.Errorf("expected the error in the stream, got %v", pw.err)
+	}
+}
+
+func Test_ImageProgress_eta(t *testing.T) {
+	now := time.Now()
+	p := ImageProgress{State: FETCH_DOWNLOADING, StartTime: uint64(now.Unix() - 10), BytesDone: 250, BytesTotal: 1000}
+	if eta := p.eta(now); eta != 30 {
+		t.Errorf("expected 30 seconds, got %v", eta)
+	}
+
+	p.BytesDone = 0
+	if eta := p.eta(now); eta != -1 {
+		t.Errorf("expected an unknown ETA before any bytes are downloaded, got %v", eta)
+	}
+
+	p.State = FETCH_FAILED
+	if eta := p.eta(now); eta != 0 {
+		t.Errorf("expected no ETA for a finished fetch, got %v", eta)
+	}
+}
+
+func Test_ProgressTracker_retention(t *testing.T) {
+	tracker := NewProgressTracker()
+	tracker.begin("old", "")
+	tracker.begin("new", "ag1")
+	tracker.fetches[progressKey("old", "")].EndTime = uint64(time.Now().Unix() - PROGRESS_RETENTION_S - 1)
+
+	if p := tracker.ImageProgress(); len(p) != 1 || p[0].Image != "new" {
+		t.Errorf("expected the old fetch to be dropped, got %v", p)
+	} else if len(tracker.fetches) != 1 {
+		t.Errorf("expected the old fetch to be removed from the tracker")
+	}
+}
+
+func Test_rateLimiter(t *testing.T) {
+	if r := newRateLimiter(0); r != nil {
+		t.Errorf("expected no limiter without a limit")
+	} else {
+		// A nil limiter does not wait.
+		r.wait(1 << 30)
+	}
+
+	r := newRateLimiter(1000)
+	r.start = time.Now().Add(-time.Second)
+	r.bytes = 3000
+	if ahead := r.ahead(); ahead < 1900*time.Millisecond || ahead > 2*time.Second {
+		t.Errorf("expected to be 2 seconds ahead, got %v", ahead)
+	}
+
+	r.bytes = 500
+	if ahead := r.ahead(); ahead > 0 {
+		t.Errorf("expected to be behind the rate, got %v", ahead)
+	}
+}
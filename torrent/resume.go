@@ -0,0 +1,194 @@
+package torrent
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/golang/glog"
+)
+
+// The parts of a package are downloaded by the package fetcher, which starts a part over when a fetch is retried.
+// The HTTP client that it is given keeps a copy of each part in the partial directory of the torrent directory while
+// the part is downloaded, so that a retry asks the server only for the rest of the part. The copy is removed once the
+// part is downloaded completely. A part is resumed only when the server identifies its content with an ETag or a
+// Last-Modified time, so that a part that changed on the server is downloaded again from the start.
+
+// The subdirectory of the torrent directory that keeps the parts whose download did not complete.
+const PARTIAL_DIR = ".partial"
+
+type resumeTransport struct {
+	next http.RoundTripper
+	dir  string
+}
+
+// The file name of a partially downloaded part, and of the validator that identifies its content.
+func partialFile(dir string, u string) (string, string) {
+	sum := sha256.Sum256([]byte(u))
+	name := path.Join(dir, hex.EncodeToString(sum[:]))
+	return name, name + ".validator"
+}
+
+func removePartial(file string, validatorFile string) {
+	os.Remove(file)
+	os.Remove(validatorFile)
+}
+
+// The validator of a response, a strong ETag or the Last-Modified time. Weak ETags cannot be used to resume.
+func responseValidator(resp *http.Response) string {
+	if etag := resp.Header.Get("ETag"); etag != "" && !strings.HasPrefix(etag, "W/") {
+		return etag
+	}
+	return resp.Header.Get("Last-Modified")
+}
+
+func (t *resumeTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Method != http.MethodGet || req.Header.Get("Range") != "" {
+		return t.next.RoundTrip(req)
+	}
+
+	file, validatorFile := partialFile(t.dir, req.URL.String())
+
+	var offset int64
+	validator, _ := ioutil.ReadFile(validatorFile)
+	if fi, err := os.Stat(file); err == nil && len(validator) != 0 && fi.Size() > 0 {
+		offset = fi.Size()
+
+		// The request belongs to the caller, so the headers are changed on a copy.
+		r := *req
+		r.Header = make(http.Header)
+		for k, v := range req.Header {
+			r.Header[k] = v
+		}
+		r.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+		r.Header.Set("If-Range", string(validator))
+		req = &r
+	}
+
+	resp, err := t.next.RoundTrip(req)
+	if err != nil {
+		return resp, err
+	}
+
+	switch {
+	case offset != 0 && resp.StatusCode == http.StatusPartialContent:
+		prefix, err := os.Open(file)
+		if err != nil {
+			resp.Body.Close()
+			return nil, err
+		}
+		out, err := os.OpenFile(file, os.O_WRONLY|os.O_APPEND, 0600)
+		if err != nil {
+			prefix.Close()
+			resp.Body.Close()
+			return nil, err
+		}
+		glog.V(3).Infof("Resuming the download of %v at byte %v", req.URL, offset)
+
+		// The caller asked for the whole part, so the response is made to look like it.
+		if resp.ContentLength >= 0 {
+			resp.ContentLength += offset
+		}
+		resp.StatusCode = http.StatusOK
+		resp.Status = "200 OK"
+		resp.Header.Del("Content-Range")
+		resp.Body = &partialBody{
+			Reader:        io.MultiReader(prefix, io.TeeReader(resp.Body, out)),
+			closers:       []io.Closer{prefix, out, resp.Body},
+			file:          file,
+			validatorFile: validatorFile,
+			length:        resp.ContentLength,
+		}
+
+	case resp.StatusCode == http.StatusOK:
+		// The part is downloaded from the start, because it is not partially downloaded yet, it changed on the
+		// server, or the server does not support ranges.
+		removePartial(file, validatorFile)
+		v := responseValidator(resp)
+		if v == "" || resp.Uncompressed {
+			break
+		}
+		if err := os.MkdirAll(t.dir, 0700); err != nil {
+			glog.Warningf("Unable to create %v, the download of %v cannot be resumed: %v", t.dir, req.URL, err)
+			break
+		} else if err := ioutil.WriteFile(validatorFile, []byte(v), 0600); err != nil {
+			glog.Warningf("Unable to write %v, the download of %v cannot be resumed: %v", validatorFile, req.URL, err)
+			break
+		}
+		out, err := os.OpenFile(file, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+		if err != nil {
+			glog.Warningf("Unable to create %v, the download of %v cannot be resumed: %v", file, req.URL, err)
+			os.Remove(validatorFile)
+			break
+		}
+		resp.Body = &partialBody{
+			Reader:        io.TeeReader(resp.Body, out),
+			closers:       []io.Closer{out, resp.Body},
+			file:          file,
+			validatorFile: validatorFile,
+			length:        resp.ContentLength,
+		}
+
+	default:
+		// Including a range that is not satisfiable, the partial part is not usable.
+		removePartial(file, validatorFile)
+	}
+
+	return resp, nil
+}
+
+// The body of a part whose download can be resumed. The partial copy is removed when the whole part has been read.
+type partialBody struct {
+	io.Reader
+	closers       []io.Closer
+	file          string
+	validatorFile string
+	length        int64
+	read          int64
+	complete      bool
+}
+
+func (b *partialBody) Read(p []byte) (int, error) {
+	n, err := b.Reader.Read(p)
+	b.read += int64(n)
+	if err == io.EOF && (b.length < 0 || b.read == b.length) {
+		b.complete = true
+	}
+	return n, err
+}
+
+func (b *partialBody) Close() error {
+	var err error
+	for _, c := range b.closers {
+		if cerr := c.Close(); cerr != nil && err == nil {
+			err = cerr
+		}
+	}
+	if b.complete {
+		removePartial(b.file, b.validatorFile)
+	}
+	return err
+}
+
+// Wrap the clients of an HTTP client factory so that the downloads of the package parts can be resumed from the
+// partial directory.
+func resumeClientFactory(newClient func(*uint) *http.Client, dir string) func(*uint) *http.Client {
+	if dir == "" {
+		return newClient
+	}
+	return func(overrideTimeoutS *uint) *http.Client {
+		client := *newClient(overrideTimeoutS)
+		next := client.Transport
+		if next == nil {
+			next = http.DefaultTransport
+		}
+		client.Transport = &resumeTransport{next: next, dir: dir}
+		return &client
+	}
+}
@@ -0,0 +1,71 @@
+// +build unit
+
+package torrent
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+)
+
+func Test_resumeTransport(t *testing.T) {
+	content := bytes.Repeat([]byte("0123456789"), 1000)
+	var ranges []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ranges = append(ranges, r.Header.Get("Range"))
+		w.Header().Set("ETag", `"part1"`)
+		http.ServeContent(w, r, "part1", time.Now(), bytes.NewReader(content))
+	}))
+	defer server.Close()
+
+	dir, err := ioutil.TempDir("", "partial")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	client := resumeClientFactory(func(*uint) *http.Client { return &http.Client{} }, dir)(nil)
+
+	// The first download stops part way through.
+	resp, err := client.Get(server.URL + "/part1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf := make([]byte, 3000)
+	if _, err := io.ReadFull(resp.Body, buf); err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	file, _ := partialFile(dir, server.URL+"/part1")
+	if fi, err := os.Stat(file); err != nil || fi.Size() < 3000 {
+		t.Fatalf("expected the partial part to be kept, got %v", err)
+	}
+
+	// The retry asks for the rest only, and the caller gets the whole part.
+	resp, err = client.Get(server.URL + "/part1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		t.Fatal(err)
+	} else if resp.StatusCode != http.StatusOK || resp.ContentLength != int64(len(content)) {
+		t.Errorf("expected the response to be the whole part, got %v with length %v", resp.StatusCode, resp.ContentLength)
+	} else if !bytes.Equal(got, content) {
+		t.Errorf("expected the resumed part to match, got %v bytes", len(got))
+	}
+
+	if len(ranges) != 2 || ranges[0] != "" || ranges[1] == "" {
+		t.Errorf("expected the second request to ask for a range, got %v", ranges)
+	}
+	if _, err := os.Stat(file); !os.IsNotExist(err) {
+		t.Errorf("expected the partial part to be removed once it is complete")
+	}
+}
@@ -0,0 +1,252 @@
+package torrent
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	docker "github.com/fsouza/go-dockerclient"
+	"github.com/golang/glog"
+	"github.com/open-horizon/anax/config"
+	"github.com/open-horizon/horizon-pkg-fetch/fetcherrors"
+)
+
+// A failed image fetch is retried with an exponential backoff when the error is one that a retry can fix, such as a
+// network error, so that a flaky link does not cancel the agreement. The backoff is kept per registry, or per host of
+// the package URL, so that a registry that keeps failing is tried less often by every fetch while the fetches from
+// other registries are not held up. Errors that a retry cannot fix, such as authentication, signature and missing
+// image errors, fail the fetch right away.
+//
+// The fetches for agreements run on the torrent worker's command thread, so a fetch never waits out a backoff itself.
+// It fails with a fetchRetryError instead, and the fetch command is queued again when the backoff is over, unless the
+// agreement or microservice instance has ended by then.
+
+// Defaults for the retry settings that are not set in the config file.
+const DEFAULT_IMAGE_FETCH_MAX_ATTEMPTS = 5
+const DEFAULT_IMAGE_FETCH_BACKOFF_S = 10
+const DEFAULT_IMAGE_FETCH_MAX_BACKOFF_S = 300
+const DEFAULT_IMAGE_FETCH_DEADLINE_S = 300
+
+type fetchRetry struct {
+	maxAttempts int
+	backoff     time.Duration
+	maxBackoff  time.Duration
+	deadline    time.Duration
+	lock        sync.Mutex
+	registries  map[string]*registryBackoff
+}
+
+type registryBackoff struct {
+	failures int
+	retryAt  time.Time
+}
+
+// The deadline of a fetch has to be under the time an agreement has to launch its workload, and under the agreement
+// timeout, or the agreement is cancelled while the fetch is still being retried. A deadline that is not under one of
+// them is cut to half of it, which leaves time to load the images and start the containers.
+func newFetchRetry(cfg *config.Config) *fetchRetry {
+	r := &fetchRetry{
+		maxAttempts: cfg.ImageFetchMaxAttempts,
+		backoff:     time.Duration(cfg.ImageFetchBackoffS) * time.Second,
+		maxBackoff:  time.Duration(cfg.ImageFetchMaxBackoffS) * time.Second,
+		deadline:    time.Duration(cfg.ImageFetchDeadlineS) * time.Second,
+		registries:  make(map[string]*registryBackoff),
+	}
+	if r.maxAttempts <= 0 {
+		r.maxAttempts = DEFAULT_IMAGE_FETCH_MAX_ATTEMPTS
+	}
+	if r.backoff <= 0 {
+		r.backoff = DEFAULT_IMAGE_FETCH_BACKOFF_S * time.Second
+	}
+	if r.maxBackoff < r.backoff {
+		r.maxBackoff = DEFAULT_IMAGE_FETCH_MAX_BACKOFF_S * time.Second
+		if r.maxBackoff < r.backoff {
+			r.maxBackoff = r.backoff
+		}
+	}
+	if r.deadline <= 0 {
+		r.deadline = DEFAULT_IMAGE_FETCH_DEADLINE_S * time.Second
+	}
+	for _, limit := range []time.Duration{config.MAX_CONTRACT_PRELAUNCH_TIME_M * time.Minute, time.Duration(cfg.AgreementTimeoutS) * time.Second} {
+		if limit != 0 && r.deadline >= limit {
+			r.deadline = limit / 2
+		}
+	}
+	return r
+}
+
+// The backoff after the given number of consecutive failures.
+func (r *fetchRetry) delay(failures int) time.Duration {
+	d := r.backoff
+	for i := 1; i < failures && d < r.maxBackoff; i++ {
+		d *= 2
+	}
+	if d > r.maxBackoff {
+		d = r.maxBackoff
+	}
+	return d
+}
+
+// The time until the registry can be tried again.
+func (r *fetchRetry) wait(registry string) time.Duration {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if b, ok := r.registries[registry]; ok {
+		return b.retryAt.Sub(time.Now())
+	}
+	return 0
+}
+
+func (r *fetchRetry) failed(registry string) time.Duration {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	b, ok := r.registries[registry]
+	if !ok {
+		b = new(registryBackoff)
+		r.registries[registry] = b
+	}
+	b.failures++
+	d := r.delay(b.failures)
+	b.retryAt = time.Now().Add(d)
+	return d
+}
+
+func (r *fetchRetry) succeeded(registry string) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	delete(r.registries, registry)
+}
+
+// The error of a fetch that can be tried again once its registry is no longer backed off. The cause is nil when the
+// fetch was not tried because the registry was already backed off.
+type fetchRetryError struct {
+	what     string
+	registry string
+	after    time.Duration
+	cause    error
+}
+
+func (e fetchRetryError) Error() string {
+	if e.cause == nil {
+		return fmt.Sprintf("%v is backed off for %v, %v was not fetched", e.registry, e.after, e.what)
+	}
+	return fmt.Sprintf("Fetch of %v failed, %v is backed off for %v. Error: %v", e.what, e.registry, e.after, e.cause)
+}
+
+// The attempts of one fetch, kept across the retries of the fetch.
+type fetchAttempts struct {
+	start    time.Time
+	attempts int  // the number of times the fetch failed with an error that a retry can fix
+	retried  bool // true once the fetch has been queued again
+}
+
+func newFetchAttempts() *fetchAttempts {
+	return &fetchAttempts{start: time.Now()}
+}
+
+// Call the fetch function once, unless its registry is backed off. Errors that a retry can fix back off the registry
+// and are returned as a fetchRetryError. A nil retry calls the fetch function and returns its error as is.
+func (r *fetchRetry) try(registry string, what string, fetchFn func() error) error {
+	if r == nil {
+		return fetchFn()
+	}
+
+	if d := r.wait(registry); d > 0 {
+		glog.V(3).Infof("Not fetching %v, %v is backed off for %v", what, registry, d)
+		return fetchRetryError{what: what, registry: registry, after: d}
+	}
+
+	if err := fetchFn(); err == nil {
+		r.succeeded(registry)
+		return nil
+	} else if permanentFetchError(err) {
+		glog.Errorf("Fetch of %v failed, not retrying: %v", what, err)
+		return err
+	} else {
+		d := r.failed(registry)
+		glog.Errorf("Fetch of %v failed, %v is backed off for %v. Error: %v", what, registry, d, err)
+		return fetchRetryError{what: what, registry: registry, after: d, cause: err}
+	}
+}
+
+// Returns the time to wait before a failed fetch is tried again, or the error that fails the fetch when it has been
+// tried the maximum number of times, when the next try would start after the deadline, or when a retry cannot fix
+// the error.
+func (r *fetchRetry) retryAfter(a *fetchAttempts, err error) (time.Duration, error) {
+	rerr, ok := err.(fetchRetryError)
+	if !ok || r == nil {
+		return 0, err
+	}
+
+	if rerr.cause != nil {
+		a.attempts++
+	}
+	if a.attempts >= r.maxAttempts {
+		return 0, fetcherrors.PkgSourceFetchError{Msg: fmt.Sprintf("Unable to fetch %v in %v attempts, last error: %v", rerr.what, a.attempts, rerr.cause), InternalError: rerr.cause}
+	} else if time.Since(a.start)+rerr.after > r.deadline {
+		return 0, fetcherrors.PkgSourceFetchError{Msg: fmt.Sprintf("Unable to fetch %v before the deadline of %v, %v is backed off", rerr.what, r.deadline, rerr.registry), InternalError: rerr.cause}
+	}
+	return rerr.after, nil
+}
+
+// An error that docker reports in the stream of a pull.
+type pullStreamError struct {
+	Msg string
+}
+
+func (e pullStreamError) Error() string {
+	return e.Msg
+}
+
+// The messages of the registry errors that a retry cannot fix.
+var permanentPullMessages = []string{"unauthorized", "denied", "authentication required", "not found", "manifest unknown", "invalid reference"}
+
+// True when a retry cannot fix the error.
+func permanentFetchError(err error) bool {
+	switch err.(type) {
+	case fetcherrors.PkgSourceFetchAuthError, fetcherrors.PkgSignatureVerificationError, fetcherrors.PkgMetaError, fetcherrors.PkgSourceError, fetcherrors.PkgPrecheckError, ImageDigestError:
+		return true
+	case *docker.Error:
+		dErr := err.(*docker.Error)
+		if dErr.Status >= 400 && dErr.Status < 500 {
+			return true
+		}
+		return permanentPullMessage(dErr.Message)
+	case pullStreamError:
+		return permanentPullMessage(err.Error())
+	}
+	return false
+}
+
+func permanentPullMessage(msg string) bool {
+	msg = strings.ToLower(msg)
+	for _, m := range permanentPullMessages {
+		if strings.Contains(msg, m) {
+			return true
+		}
+	}
+	return false
+}
+
+// True when docker could not pull the image because of the credentials.
+func pullAuthError(err error) bool {
+	switch err.(type) {
+	case *docker.Error:
+		dErr := err.(*docker.Error)
+		return dErr.Status == 401 || dErr.Status == 403 || (dErr.Status == 500 && strings.Contains(dErr.Message, "cred"))
+	case pullStreamError:
+		msg := strings.ToLower(err.Error())
+		return strings.Contains(msg, "unauthorized") || strings.Contains(msg, "denied") || strings.Contains(msg, "authentication required")
+	}
+	return false
+}
+
+// The registry of a docker repository, the first part of the repository when it is a host name.
+func registryOf(repository string) string {
+	parts := strings.SplitN(repository, "/", 2)
+	if len(parts) == 2 && (strings.ContainsAny(parts[0], ".:") || parts[0] == "localhost") {
+		return parts[0]
+	}
+	return "docker.io"
+}
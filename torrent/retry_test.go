@@ -0,0 +1,172 @@
+// +build unit
+
+package torrent
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	docker "github.com/fsouza/go-dockerclient"
+	"github.com/open-horizon/anax/config"
+	"github.com/open-horizon/horizon-pkg-fetch/fetcherrors"
+)
+
+func Test_newFetchRetry(t *testing.T) {
+	r := newFetchRetry(&config.Config{})
+	if r.maxAttempts != DEFAULT_IMAGE_FETCH_MAX_ATTEMPTS || r.backoff != DEFAULT_IMAGE_FETCH_BACKOFF_S*time.Second || r.deadline != DEFAULT_IMAGE_FETCH_DEADLINE_S*time.Second {
+		t.Errorf("expected the defaults, got %v attempts, %v backoff, %v deadline", r.maxAttempts, r.backoff, r.deadline)
+	}
+
+	r = newFetchRetry(&config.Config{ImageFetchDeadlineS: 1800})
+	if r.deadline != config.MAX_CONTRACT_PRELAUNCH_TIME_M*time.Minute/2 {
+		t.Errorf("expected the deadline to be cut to half of the prelaunch time, got %v", r.deadline)
+	}
+
+	r = newFetchRetry(&config.Config{ImageFetchDeadlineS: 500, AgreementTimeoutS: 360})
+	if r.deadline != 180*time.Second {
+		t.Errorf("expected the deadline to be cut to half of the agreement timeout, got %v", r.deadline)
+	}
+
+	r = newFetchRetry(&config.Config{ImageFetchDeadlineS: 300, AgreementTimeoutS: 360})
+	if r.deadline != 300*time.Second {
+		t.Errorf("expected the configured deadline, got %v", r.deadline)
+	}
+}
+
+func Test_fetchRetry_delay(t *testing.T) {
+	r := newFetchRetry(&config.Config{ImageFetchBackoffS: 10, ImageFetchMaxBackoffS: 60})
+	expected := []time.Duration{10, 20, 40, 60, 60}
+	for i, e := range expected {
+		if d := r.delay(i + 1); d != e*time.Second {
+			t.Errorf("expected a backoff of %vs after %v failures, got %v", e, i+1, d)
+		}
+	}
+}
+
+func Test_fetchRetry_try(t *testing.T) {
+	r := newFetchRetry(&config.Config{ImageFetchBackoffS: 10})
+
+	// A transient error backs off the registry.
+	calls := 0
+	err := r.try("registry", "image", func() error {
+		calls++
+		return errors.New("connection reset by peer")
+	})
+	if rerr, ok := err.(fetchRetryError); !ok || calls != 1 || rerr.after != 10*time.Second || rerr.cause == nil {
+		t.Errorf("expected a retry error after one attempt, got %v after %v attempts", err, calls)
+	} else if r.wait("registry") <= 0 {
+		t.Errorf("expected the registry to be backed off")
+	}
+
+	// A backed off registry is not tried.
+	calls = 0
+	err = r.try("registry", "image", func() error {
+		calls++
+		return nil
+	})
+	if rerr, ok := err.(fetchRetryError); !ok || calls != 0 || rerr.cause != nil {
+		t.Errorf("expected the fetch not to be tried, got %v after %v attempts", err, calls)
+	}
+
+	// Success resets the backoff of the registry.
+	r.registries["registry"].retryAt = time.Now()
+	if err := r.try("registry", "image", func() error { return nil }); err != nil {
+		t.Errorf("unexpected error %v", err)
+	} else if r.wait("registry") != 0 {
+		t.Errorf("expected the registry backoff to be reset")
+	}
+
+	// Errors that a retry cannot fix are returned as they are.
+	err = r.try("other", "image", func() error {
+		return pullStreamError{Msg: "manifest for gps:1.0 not found"}
+	})
+	if _, ok := err.(pullStreamError); !ok {
+		t.Errorf("expected the error without a retry, got %v", err)
+	}
+
+	// Without a retry, the error is returned as is.
+	var none *fetchRetry
+	if err := none.try("registry", "image", func() error { return errors.New("i/o timeout") }); err == nil || err.Error() != "i/o timeout" {
+		t.Errorf("expected the error of the fetch, got %v", err)
+	}
+}
+
+func Test_fetchRetry_retryAfter(t *testing.T) {
+	r := newFetchRetry(&config.Config{ImageFetchMaxAttempts: 3})
+	r.deadline = time.Minute
+	a := newFetchAttempts()
+
+	failed := fetchRetryError{what: "image", registry: "registry", after: time.Second, cause: errors.New("i/o timeout")}
+	backedOff := fetchRetryError{what: "image", registry: "registry", after: time.Second}
+
+	// The fetch is retried after the backoff until the attempts run out, the tries that did not happen do not count.
+	for i, err := range []error{failed, backedOff, failed} {
+		if after, err := r.retryAfter(a, err); err != nil || after != time.Second {
+			t.Errorf("expected retry %v after the backoff, got %v %v", i, after, err)
+		}
+	}
+	if after, err := r.retryAfter(a, failed); after != 0 || err == nil {
+		t.Errorf("expected the attempts to run out, got %v %v", after, err)
+	} else if _, ok := err.(fetcherrors.PkgSourceFetchError); !ok {
+		t.Errorf("expected a fetch error, got %T", err)
+	}
+
+	// A retry that would start after the deadline fails the fetch.
+	a = newFetchAttempts()
+	if after, err := r.retryAfter(a, fetchRetryError{what: "image", registry: "slow", after: time.Hour}); after != 0 || err == nil {
+		t.Errorf("expected the fetch to give up before the deadline, got %v %v", after, err)
+	}
+
+	// Success and errors that a retry cannot fix end the fetch.
+	a = newFetchAttempts()
+	if after, err := r.retryAfter(a, nil); after != 0 || err != nil {
+		t.Errorf("expected success, got %v %v", after, err)
+	} else if after, err := r.retryAfter(a, ImageDigestError{Msg: "digest"}); after != 0 || err == nil {
+		t.Errorf("expected the error, got %v %v", after, err)
+	}
+}
+
+func Test_permanentFetchError(t *testing.T) {
+	permanent := []error{
+		fetcherrors.PkgSourceFetchAuthError{Msg: "auth"},
+		ImageDigestError{Msg: "digest"},
+		&docker.Error{Status: 404, Message: "not found"},
+		pullStreamError{Msg: "unauthorized: authentication required"},
+	}
+	for _, err := range permanent {
+		if !permanentFetchError(err) {
+			t.Errorf("expected %v to fail fast", err)
+		}
+	}
+
+	transient := []error{
+		fetcherrors.PkgSourceFetchError{Msg: "fetch"},
+		&docker.Error{Status: 500, Message: "net/http: TLS handshake timeout"},
+		pullStreamError{Msg: "unexpected EOF"},
+		errors.New("dial tcp: lookup registry: no such host"),
+	}
+	for _, err := range transient {
+		if permanentFetchError(err) {
+			t.Errorf("expected %v to be retried", err)
+		}
+	}
+
+	if !pullAuthError(&docker.Error{Status: 500, Message: "Get https://registry/v2/: no basic auth credentials"}) {
+		t.Errorf("expected missing credentials to be an authentication error")
+	}
+}
+
+func Test_registryOf(t *testing.T) {
+	for repo, registry := range map[string]string{
+		"registry.example.com/org/gps": "registry.example.com",
+		"localhost:5000/gps":           "localhost:5000",
+		"localhost/gps":                "localhost",
+		"openhorizon/gps":              "docker.io",
+		"gps":                          "docker.io",
+	} {
+		if r := registryOf(repo); r != registry {
+			t.Errorf("expected registry %v for %v, got %v", registry, repo, r)
+		}
+	}
+}
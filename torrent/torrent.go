@@ -2,28 +2,40 @@ package torrent
 
 import (
 	"fmt"
+	"net/http"
 	"net/url"
+	"path"
+	"sync"
+	"time"
 
 	"encoding/json"
-	"github.com/boltdb/bolt"
 	docker "github.com/fsouza/go-dockerclient"
 	"github.com/golang/glog"
 	"github.com/open-horizon/anax/config"
 	"github.com/open-horizon/anax/containermessage"
 	"github.com/open-horizon/anax/events"
+	"github.com/open-horizon/anax/metrics"
 	"github.com/open-horizon/anax/persistence"
 	"github.com/open-horizon/anax/worker"
 	fetch "github.com/open-horizon/horizon-pkg-fetch"
 	"github.com/open-horizon/horizon-pkg-fetch/fetcherrors"
 )
 
+// The time taken to fetch the images for a deployment, by result (success or failure).
+var imageFetchDuration = metrics.NodeRegistry.NewSummaryVec("anax_image_fetch_duration_seconds", "The time taken to fetch and load the container images of a deployment, by result.", "result")
+
 type TorrentWorker struct {
 	worker.BaseWorker // embedded field
-	db                *bolt.DB
+	db                persistence.Store
 	client            *docker.Client
+	progress          *ProgressTracker
+	retry             *fetchRetry
+	peerCache         *http.Server
+	prefetchLock      sync.Mutex
+	prefetching       bool
 }
 
-func NewTorrentWorker(name string, config *config.HorizonConfig, db *bolt.DB) *TorrentWorker {
+func NewTorrentWorker(name string, config *config.HorizonConfig, db persistence.Store) *TorrentWorker {
 
 	cl, err := docker.NewClient(config.Edge.DockerEndpoint)
 	if err != nil {
@@ -35,6 +47,8 @@ func NewTorrentWorker(name string, config *config.HorizonConfig, db *bolt.DB) *T
 		BaseWorker: worker.NewBaseWorker(name, config),
 		db:         db,
 		client:     cl,
+		progress:   NewProgressTracker(),
+		retry:      newFetchRetry(&config.Edge),
 	}
 
 	worker.Start(worker, 0)
@@ -45,6 +59,36 @@ func (w *TorrentWorker) Messages() chan events.Message {
 	return w.BaseWorker.Manager.Messages
 }
 
+// The progress of the image fetches that are in progress or recently finished, for the API.
+func (w *TorrentWorker) ImageProgress() []ImageProgress {
+	return w.progress.ImageProgress()
+}
+
+func (w *TorrentWorker) Initialize() bool {
+
+	// The image garbage collector runs on the command thread so that it never removes the parts of a fetch
+	// that is in progress.
+	interval := w.Config.Edge.ImageGCIntervalS
+	if interval <= 0 {
+		interval = DEFAULT_IMAGE_GC_INTERVAL_S
+	}
+	w.DispatchSubworker(IMAGE_GC, func() int {
+		w.Commands <- w.NewImageGCCommand()
+		return 0
+	}, interval)
+
+	// In peer cache mode, the package files that this node fetched are served to the other nodes of the site.
+	if w.Config.Edge.PeerCacheListen != "" {
+		if w.Config.Edge.TorrentDir == "" {
+			glog.Warningf("The peer image cache is not served, there is no torrent directory to keep package files in")
+		} else {
+			w.peerCache = servePeerCache(w.Config.Edge.PeerCacheListen, path.Join(w.Config.Edge.TorrentDir, PEER_CACHE_DIR))
+		}
+	}
+
+	return true
+}
+
 func (w *TorrentWorker) NewEvent(incoming events.Message) {
 
 	switch incoming.(type) {
@@ -60,6 +104,25 @@ func (w *TorrentWorker) NewEvent(incoming events.Message) {
 		fCmd := w.NewFetchCommand(msg.LaunchContext())
 		w.Commands <- fCmd
 
+	case *events.EdgeConfigCompleteMessage:
+		msg, _ := incoming.(*events.EdgeConfigCompleteMessage)
+		switch msg.Event().Id {
+		case events.NEW_DEVICE_CONFIG_COMPLETE:
+			if w.Config.Edge.ImagePrefetch {
+				w.startPrefetch()
+			}
+		}
+
+	case *events.NodeShutdownMessage:
+		msg, _ := incoming.(*events.NodeShutdownMessage)
+		switch msg.Event().Id {
+		case events.START_UNCONFIGURE:
+			if w.peerCache != nil {
+				w.peerCache.Close()
+			}
+			w.Commands <- worker.NewBeginShutdownCommand()
+		}
+
 	case *events.NodeShutdownCompleteMessage:
 		msg, _ := incoming.(*events.NodeShutdownCompleteMessage)
 		switch msg.Event().Id {
@@ -105,7 +168,7 @@ func ExtractAuthAttributes(attributes []persistence.Attribute, httpAuthAttrs map
 	return httpAuthAttrs, dockerAuthConfigurations, nil
 }
 
-func authAttributes(db *bolt.DB) (map[string]map[string]string, *docker.AuthConfigurations, error) {
+func authAttributes(db persistence.Store) (map[string]map[string]string, *docker.AuthConfigurations, error) {
 
 	httpAuthAttrs := make(map[string]map[string]string, 0)
 	dockerAuthConfigurations := make(map[string]docker.AuthConfiguration, 0)
@@ -143,7 +206,10 @@ func processDeployment(cfg *config.HorizonConfig, containerConfig events.Contain
 	return pemFiles, &deploymentDesc, nil
 }
 
-func processFetch(cfg *config.HorizonConfig, client *docker.Client, db *bolt.DB, pemFiles []string, deploymentDesc *containermessage.DeploymentDescription, torrentUrl url.URL, torrentSig string) error {
+// Fetch the images of a deployment, by docker pull or as a package into the torrent directory. The progress is kept
+// in the tracker under the reference, the agreement id or microservice instance key, or an empty reference for a
+// pre-fetch. A fetch that fails with an error that a retry can fix returns a fetchRetryError.
+func processFetch(cfg *config.HorizonConfig, client *docker.Client, db persistence.Store, pemFiles []string, deploymentDesc *containermessage.DeploymentDescription, torrentUrl url.URL, torrentSig string, org string, torrentDir string, progress *ProgressTracker, reference string, limiter *rateLimiter, retry *fetchRetry) error {
 	httpAuth, dockerAuth, err := authAttributes(db)
 	if err != nil {
 		glog.Errorf("Failed to fetch authentication facts before processing packages and / or Docker pulls: %v. Continuing anyway", err)
@@ -158,19 +224,63 @@ func processFetch(cfg *config.HorizonConfig, client *docker.Client, db *bolt.DB,
 		// Note: we don't want to make this a fallback option, it's a potential security vector
 		glog.V(3).Infof("Empty torrent URL '%v' and Signature '%v' provided in LaunchContext, using Docker pull mechanism to retrieve and load Docker images into local registry", torrentUrl.String(), torrentSig)
 
-		fetchErr = pullImageFromRepos(cfg.Edge, dockerAuth, client, &skipCheckFn, deploymentDesc)
+		fetchErr = pullImageFromRepos(cfg.Edge, cfg.Collaborators.HTTPClientFactory.NewHTTPClient(nil), dockerAuth, client, &skipCheckFn, deploymentDesc, org, progress, reference, limiter, retry)
 
 	} else {
 		// using Pkg fetch and image load (traditional option, content of images is packaged completely, all content is checked for signature)
 		// imageFiles is of form {<repotag>: <part abspath> or empty string}
 		var imageFiles map[string]string
 
-		imageFiles, fetchErr = fetch.PkgFetch(cfg.Collaborators.HTTPClientFactory.WrappedNewHTTPClient(), &skipCheckFn, torrentUrl, torrentSig, cfg.Edge.TorrentDir, pemFiles, httpAuth)
+		// the progress of a package is reported under its URL, each part of the package is a layer
+		partialDir := ""
+		if torrentDir != "" {
+			partialDir = path.Join(torrentDir, PARTIAL_DIR)
+		}
+		newClient := func(peers []string) func(*uint) *http.Client {
+			return resumeClientFactory(progressClientFactory(peerClientFactory(cfg.Collaborators.HTTPClientFactory.WrappedNewHTTPClient(), peers), progress, torrentUrl.String(), reference, limiter), partialDir)
+		}
+
+		// In peer cache mode, the files of the package are kept to serve to peers once the package is verified and
+		// loaded.
+		var peerCache *peerCacheWriter
+		if cfg.Edge.PeerCacheListen != "" && cfg.Edge.TorrentDir != "" {
+			if peerCache, err = newPeerCacheWriter(path.Join(cfg.Edge.TorrentDir, PEER_CACHE_DIR)); err != nil {
+				glog.Warningf("Unable to keep package %v for peers, error: %v", torrentUrl.String(), err)
+			}
+		}
+
+		// The peers are tried once before the origin, a package that cannot be fetched or verified through the
+		// peers is fetched from the origin.
+		fetched := false
+		if peers := peerCacheNodes(cfg.Edge.PeerCacheNodes); len(peers) != 0 {
+			progress.begin(torrentUrl.String(), reference)
+			if imageFiles, fetchErr = fetch.PkgFetch(peerCache.clientFactory(newClient(peers)), &skipCheckFn, torrentUrl, torrentSig, torrentDir, pemFiles, httpAuth); fetchErr != nil {
+				glog.Warningf("Unable to fetch package %v through peers %v, fetching it from the origin. Error: %v", torrentUrl.String(), peers, fetchErr)
+			} else {
+				fetched = true
+			}
+		}
+
+		if !fetched {
+			fetchErr = retry.try(torrentUrl.Host, fmt.Sprintf("package %v", torrentUrl.String()), func() error {
+				var err error
+				progress.begin(torrentUrl.String(), reference)
+				imageFiles, err = fetch.PkgFetch(peerCache.clientFactory(newClient(nil)), &skipCheckFn, torrentUrl, torrentSig, torrentDir, pemFiles, httpAuth)
+				return err
+			})
+		}
+		progress.end(torrentUrl.String(), reference, fetchErr)
 
 		if fetchErr == nil {
 			// now load those imageFiles using Docker client
 			fetchErr = LoadImagesFromPkgParts(client, imageFiles)
 		}
+
+		if fetchErr == nil {
+			peerCache.commit()
+		} else {
+			peerCache.discard()
+		}
 	}
 
 	return fetchErr
@@ -187,6 +297,16 @@ func (b *TorrentWorker) CommandHandler(command worker.Command) bool {
 		} else {
 			glog.V(5).Infof("LaunchContext(%T): %v", lc, lc)
 
+			// A fetch that is being retried is dropped once its agreement or microservice instance has ended.
+			if cmd.attempts.retried {
+				if active, err := activeImageReferences(b.db); err != nil {
+					glog.Errorf("Unable to check whether %v is still active, retrying the image fetch anyway: %v", launchReference(lc), err)
+				} else if !active[launchReference(lc)] {
+					glog.Infof("Not retrying the image fetch for %v, it has ended", launchReference(lc))
+					return true
+				}
+			}
+
 			pemFiles, deploymentDesc, err := processDeployment(b.Config, lc.ContainerConfig())
 			if err != nil {
 				glog.Errorf("Failed to process deployment description and signature after agreement negotiation: %v", err)
@@ -194,7 +314,30 @@ func (b *TorrentWorker) CommandHandler(command worker.Command) bool {
 				return true
 			}
 
-			if fetchErr := processFetch(b.Config, b.client, b.db, pemFiles, deploymentDesc, lc.ContainerConfig().TorrentURL, lc.ContainerConfig().TorrentSignature); fetchErr != nil {
+			fetchErr := processFetch(b.Config, b.client, b.db, pemFiles, deploymentDesc, lc.ContainerConfig().TorrentURL, lc.ContainerConfig().TorrentSignature, lc.ContainerConfig().Org, b.Config.Edge.TorrentDir, b.progress, launchReference(lc), nil, b.retry)
+
+			// Queue the fetch again once the registry is no longer backed off, the command thread is not held up
+			// in the meantime.
+			if after, err := b.retry.retryAfter(cmd.attempts, fetchErr); err == nil && after != 0 {
+				glog.Infof("Retrying the image fetch for %v in %v", launchReference(lc), after)
+				cmd.attempts.retried = true
+				time.AfterFunc(after, func() {
+					if !b.IsWorkerShuttingDown() {
+						b.Commands <- cmd
+					}
+				})
+				return true
+			} else {
+				fetchErr = err
+			}
+
+			if fetchErr != nil {
+				imageFetchDuration.Observe(time.Since(cmd.attempts.start).Seconds(), "failure")
+			} else {
+				imageFetchDuration.Observe(time.Since(cmd.attempts.start).Seconds(), "success")
+			}
+
+			if fetchErr != nil {
 				var id events.EventId
 				switch fetchErr.(type) {
 				case fetcherrors.PkgMetaError, fetcherrors.PkgSourceError, fetcherrors.PkgPrecheckError:
@@ -206,7 +349,7 @@ func (b *TorrentWorker) CommandHandler(command worker.Command) bool {
 				case fetcherrors.PkgSourceFetchAuthError:
 					id = events.IMAGE_FETCH_AUTH_ERROR
 
-				case fetcherrors.PkgSignatureVerificationError:
+				case fetcherrors.PkgSignatureVerificationError, ImageDigestError:
 					id = events.IMAGE_SIG_VERIF_ERROR
 
 				default:
@@ -215,11 +358,15 @@ func (b *TorrentWorker) CommandHandler(command worker.Command) bool {
 				glog.Errorf("Failed to fetch image files: %v", fetchErr)
 				b.Messages() <- events.NewTorrentMessage(id, deploymentDesc, lc)
 			} else {
+				recordImageUse(b.db, lc, deploymentDesc)
 				b.Messages() <- events.NewTorrentMessage(events.IMAGE_FETCHED, deploymentDesc, lc)
 			}
 
 		}
 
+	case *ImageGCCommand:
+		b.collectImages()
+
 	default:
 		return false
 	}
@@ -229,6 +376,7 @@ func (b *TorrentWorker) CommandHandler(command worker.Command) bool {
 
 type FetchCommand struct {
 	LaunchContext interface{}
+	attempts      *fetchAttempts
 }
 
 func (f FetchCommand) ShortString() string {
@@ -238,6 +386,7 @@ func (f FetchCommand) ShortString() string {
 func (t *TorrentWorker) NewFetchCommand(launchContext interface{}) *FetchCommand {
 	return &FetchCommand{
 		LaunchContext: launchContext,
+		attempts:      newFetchAttempts(),
 	}
 }
 
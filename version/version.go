@@ -13,6 +13,9 @@ const HORIZON_VERSION = "local build"
 // the required exchange version
 const REQUIRED_EXCHANGE_VERSION = "1.46.0"
 
+// the exchange version that can page through node searches, with the startAfterId and changedSince search parameters
+const SEARCH_PAGING_EXCHANGE_VERSION = "1.47.0"
+
 // This function verifies the exchange version to make sure it meets the requirement.
 // It return nil if the exchange version is okay.
 // or error if there is an error or current version is not okay.
@@ -29,3 +32,16 @@ func VerifyExchangeVersion(httpClientFactory *config.HTTPClientFactory, exchange
 		return nil
 	}
 }
+
+// This function returns true when the exchange version is the given version or later.
+func ExchangeVersionAtLeast(httpClientFactory *config.HTTPClientFactory, exchangeUrl string, minVersion string) (bool, error) {
+	if exch_version, err := exchange.GetExchangeVersion(httpClientFactory, exchangeUrl); err != nil {
+		return false, fmt.Errorf("Failed to get exchange version from the exchange. %v", err)
+	} else if !policy.IsVersionString(exch_version) {
+		return false, fmt.Errorf("The current exchange version %v is not a valid version string.", exch_version)
+	} else if comp, err := policy.CompareVersions(exch_version, minVersion); err != nil {
+		return false, fmt.Errorf("Failed to compare the versions. %v", err)
+	} else {
+		return comp >= 0, nil
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"github.com/golang/glog"
 	"github.com/open-horizon/anax/config"
 	"github.com/open-horizon/anax/events"
+	"github.com/open-horizon/anax/metrics"
 	"runtime"
 	"time"
 )
@@ -12,6 +13,10 @@ import (
 // The core of anax is an event handling system that distributes events to workers, where the workers
 // process events that they are about.
 
+// Metrics maintained by the worker framework.
+var eventsDispatched = metrics.NewCounterVec("anax_events_dispatched_total", "The number of events dispatched to the workers, by event id.", "event_id")
+var commandQueueDepth = metrics.NewGaugeFuncVec("anax_worker_command_queue_depth", "The number of commands waiting on a worker's command queue.", "worker")
+
 type Command interface {
 	ShortString() string
 }
@@ -221,7 +226,10 @@ func (w *BaseWorker) internalCommandhandler(worker Worker, command Command) bool
 
 // This function kicks off the go routine that the worker's logic runs in.
 func (w *BaseWorker) Start(worker Worker, noWorkInterval int) {
+	commandQueueDepth.Set(func() float64 { return float64(len(w.Commands)) }, w.GetName())
+
 	go func() {
+		defer commandQueueDepth.Delete(w.GetName())
 
 		// Allow the worker to initialize itself, or stop it if initialization determines that.
 		if !worker.Initialize() {
@@ -372,16 +380,28 @@ type MessageHandler interface {
 	Messages() chan events.Message
 }
 
+// An event sink is given every event that passes through the message dispatcher, along with the name of the
+// worker that emitted it. Sinks are called on the dispatcher's thread so they must not block, e.g. on a database write.
+type EventSink interface {
+	Record(source string, msg events.Message)
+}
+
 type MessageHandlerRegistry struct {
 	Handlers map[string]*MessageHandler
+	Sinks    []EventSink
 }
 
 func NewMessageHandlerRegistry() *MessageHandlerRegistry {
 	mhr := new(MessageHandlerRegistry)
 	mhr.Handlers = make(map[string]*MessageHandler)
+	mhr.Sinks = make([]EventSink, 0, 2)
 	return mhr
 }
 
+func (m *MessageHandlerRegistry) AddEventSink(sink EventSink) {
+	m.Sinks = append(m.Sinks, sink)
+}
+
 func (m *MessageHandlerRegistry) Add(mh interface {
 	MessageHandler
 }) {
@@ -420,6 +440,8 @@ func eventHandler(incoming events.Message, workers *MessageHandlerRegistry) (str
 		return successMsg, nil
 	}
 
+	eventsDispatched.Inc(string(incoming.Event().Id))
+
 	// Dispatch the message to all workers
 	for name, worker := range workers.Handlers {
 		glog.V(5).Infof(mdLogString(fmt.Sprintf("Delivering message to %v", name)))
@@ -435,9 +457,12 @@ func eventHandler(incoming events.Message, workers *MessageHandlerRegistry) (str
 //
 func mux(workers *MessageHandlerRegistry, muxed chan events.Message) chan events.Message {
 
-	for _, w := range workers.Handlers {
+	for name, w := range workers.Handlers {
 		select {
 		case ev := <-(*w).Messages():
+			for _, sink := range workers.Sinks {
+				sink.Record(name, ev)
+			}
 			muxed <- ev
 		default: // nothing
 		}